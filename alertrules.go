@@ -0,0 +1,177 @@
+package z2mhomekit
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+const (
+	// Offline thresholds follow zigbee2mqtt's availability defaults:
+	// mains-powered routers should report within 10 minutes, battery
+	// devices can sleep for up to 25 hours.
+	activeOfflineAfter  = 10 * time.Minute
+	passiveOfflineAfter = 25 * time.Hour
+
+	// lowBatteryBelow matches the battery level the health score treats
+	// as low.
+	lowBatteryBelow = 25
+)
+
+// alertRule is a single Prometheus alerting rule.
+type alertRule struct {
+	Alert       string
+	Expr        string
+	For         time.Duration
+	Severity    string
+	Summary     string
+	Description string
+	DeviceID    string
+}
+
+// passiveDevice reports whether a device sleeps between reports, so it
+// is given zigbee2mqtt's longer passive availability timeout.
+func passiveDevice(device devices.Device) bool {
+	switch device.Type {
+	case devices.DeviceTypeLightbulb, devices.DeviceTypeOutlet, devices.DeviceTypeSwitch, devices.DeviceTypeFan:
+		return device.Features.Battery
+	}
+	return true
+}
+
+// promLabel quotes a value for use in a PromQL label matcher.
+func promLabel(value string) string {
+	return strconv.Quote(value)
+}
+
+// alertRules builds alerting rules for the configured devices.
+func alertRules(configured []devices.Device) []alertRule {
+	rules := []alertRule{{
+		Alert:       "Z2MHomekitComponentDown",
+		Expr:        `z2m_homekit_component_status{status="connected"} == 0`,
+		For:         5 * time.Minute,
+		Severity:    "critical",
+		Summary:     "z2m-homekit {{ $labels.component }} is not connected",
+		Description: "The {{ $labels.component }} component has not been connected for 5 minutes.",
+	}}
+
+	sorted := append([]devices.Device(nil), configured...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	for _, device := range sorted {
+		id := promLabel(device.ID)
+
+		offlineAfter := activeOfflineAfter
+		if passiveDevice(device) {
+			offlineAfter = passiveOfflineAfter
+		}
+		rules = append(rules, alertRule{
+			Alert:       "Z2MHomekitDeviceOffline",
+			Expr:        fmt.Sprintf("time() - z2m_homekit_device_last_seen_timestamp_seconds{device_id=%s} > %d", id, int(offlineAfter.Seconds())),
+			Severity:    "warning",
+			Summary:     device.Name + " is offline",
+			Description: fmt.Sprintf("%s has not reported for more than %s.", device.Name, offlineAfter),
+			DeviceID:    device.ID,
+		})
+
+		if device.Features.Battery {
+			rules = append(rules, alertRule{
+				Alert:       "Z2MHomekitLowBattery",
+				Expr:        fmt.Sprintf(`z2m_homekit_device_state{device_id=%s,metric="battery"} < %d`, id, lowBatteryBelow),
+				For:         time.Hour,
+				Severity:    "warning",
+				Summary:     device.Name + " battery is low",
+				Description: fmt.Sprintf("%s battery is at {{ $value }}%%.", device.Name),
+				DeviceID:    device.ID,
+			})
+		}
+
+		switch device.Type {
+		case devices.DeviceTypeLeakSensor:
+			rules = append(rules, alertRule{
+				Alert:       "Z2MHomekitLeakDetected",
+				Expr:        fmt.Sprintf(`z2m_homekit_device_state{device_id=%s,metric="water_leak"} == 1`, id),
+				Severity:    "critical",
+				Summary:     "Water leak detected by " + device.Name,
+				Description: device.Name + " is reporting a water leak.",
+				DeviceID:    device.ID,
+			})
+		case devices.DeviceTypeSmokeSensor:
+			rules = append(rules, alertRule{
+				Alert:       "Z2MHomekitSmokeDetected",
+				Expr:        fmt.Sprintf(`z2m_homekit_device_state{device_id=%s,metric="smoke"} == 1`, id),
+				Severity:    "critical",
+				Summary:     "Smoke detected by " + device.Name,
+				Description: device.Name + " is reporting smoke.",
+				DeviceID:    device.ID,
+			})
+		}
+	}
+
+	return rules
+}
+
+// writeAlertRules writes rules as a Prometheus rule file. Strings are
+// emitted double quoted, which YAML reads with the same escapes as Go.
+func writeAlertRules(w io.Writer, rules []alertRule) error {
+	var b strings.Builder
+	b.WriteString("# Generated by z2m-homekit from the device registry.\n")
+	b.WriteString("groups:\n")
+	b.WriteString("  - name: z2m-homekit\n")
+	b.WriteString("    rules:\n")
+	for _, r := range rules {
+		fmt.Fprintf(&b, "      - alert: %s\n", r.Alert)
+		fmt.Fprintf(&b, "        expr: %s\n", strconv.Quote(r.Expr))
+		if r.For > 0 {
+			fmt.Fprintf(&b, "        for: %s\n", promDuration(r.For))
+		}
+		b.WriteString("        labels:\n")
+		fmt.Fprintf(&b, "          severity: %s\n", r.Severity)
+		if r.DeviceID != "" {
+			fmt.Fprintf(&b, "          device_id: %s\n", strconv.Quote(r.DeviceID))
+		}
+		b.WriteString("        annotations:\n")
+		fmt.Fprintf(&b, "          summary: %s\n", strconv.Quote(r.Summary))
+		fmt.Fprintf(&b, "          description: %s\n", strconv.Quote(r.Description))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// promDuration formats d in Prometheus duration syntax, e.g. 1h or 5m.
+func promDuration(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%ds", d/time.Second)
+}
+
+// HandleAlertRules serves Prometheus alerting rules for the current
+// devices, ready to drop into a rule_files entry.
+func (ws *WebServer) HandleAlertRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var configured []devices.Device
+	for _, item := range ws.deviceProvider.Snapshot() {
+		configured = append(configured, item.Device)
+	}
+
+	w.Header().Set("Content-Type", "application/yaml")
+	if err := writeAlertRules(w, alertRules(configured)); err != nil {
+		ws.logger.Error("Failed to write alert rules", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,67 @@
+package z2mhomekit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+func TestAlertRules(t *testing.T) {
+	rules := alertRules([]devices.Device{
+		{ID: "leak", Name: "Kitchen leak", Type: devices.DeviceTypeLeakSensor, Features: devices.DeviceFeatures{Battery: true, WaterLeak: true}},
+		{ID: "lamp", Name: "Lamp", Type: devices.DeviceTypeLightbulb},
+	})
+
+	byAlert := map[string][]alertRule{}
+	for _, r := range rules {
+		byAlert[r.Alert] = append(byAlert[r.Alert], r)
+	}
+
+	if len(byAlert["Z2MHomekitComponentDown"]) != 1 {
+		t.Error("missing component down rule")
+	}
+	if got := byAlert["Z2MHomekitLowBattery"]; len(got) != 1 || got[0].DeviceID != "leak" {
+		t.Errorf("low battery rules = %+v, want only the leak sensor", got)
+	}
+	if got := byAlert["Z2MHomekitLeakDetected"]; len(got) != 1 || !strings.Contains(got[0].Expr, `device_id="leak"`) {
+		t.Errorf("leak rules = %+v", got)
+	}
+
+	offline := byAlert["Z2MHomekitDeviceOffline"]
+	if len(offline) != 2 {
+		t.Fatalf("offline rules = %d, want one per device", len(offline))
+	}
+	// Sorted by ID: the lamp is mains powered, the leak sensor sleeps.
+	if !strings.HasSuffix(offline[0].Expr, "> 600") || !strings.HasSuffix(offline[1].Expr, "> 90000") {
+		t.Errorf("offline thresholds = %q, %q", offline[0].Expr, offline[1].Expr)
+	}
+}
+
+func TestHandleAlertRules(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ws.deviceProvider = fakeDeviceProvider{
+		"smoke": {Device: devices.Device{ID: "smoke", Name: `Hall "smoke"`, Type: devices.DeviceTypeSmokeSensor}},
+	}
+
+	rec := httptest.NewRecorder()
+	ws.HandleAlertRules(rec, httptest.NewRequest(http.MethodGet, "/metrics/alert-rules", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"groups:\n  - name: z2m-homekit\n    rules:\n",
+		"      - alert: Z2MHomekitSmokeDetected\n",
+		`        expr: "z2m_homekit_device_state{device_id=\"smoke\",metric=\"smoke\"} == 1"`,
+		`          summary: "Smoke detected by Hall \"smoke\""`,
+		"        for: 5m\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("rules missing %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package z2mhomekit
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/chasefleming/elem-go"
+	"github.com/chasefleming/elem-go/attrs"
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+// onDashboard reports whether a device belongs on the main dashboard and
+// its summaries. Hidden devices are left out but still listed on /all.
+func onDashboard(device devices.Device) bool {
+	return webEnabled(device) && !device.Hidden
+}
+
+// webEnabled reports whether a device is available in the web UI at all.
+func webEnabled(device devices.Device) bool {
+	return device.Web == nil || *device.Web
+}
+
+// renderDeviceCount renders the dashboard's device count, linking to /all
+// when some devices are hidden.
+func (ws *WebServer) renderDeviceCount(snapshot map[string]struct {
+	Device devices.Device
+	State  devices.State
+},
+) elem.Node {
+	hidden := 0
+	for _, item := range snapshot {
+		if webEnabled(item.Device) && item.Device.Hidden {
+			hidden++
+		}
+	}
+
+	text := elem.Text(fmt.Sprintf("Managing %d devices", len(snapshot)))
+	if hidden == 0 {
+		return elem.P(attrs.Props{}, text)
+	}
+	return elem.P(attrs.Props{}, text, elem.Text(" · "),
+		elem.A(attrs.Props{attrs.Href: "/all"}, elem.Text(fmt.Sprintf("%d hidden", hidden))),
+	)
+}
+
+// deviceMatches reports whether the device's ID, name, room, tags or
+// documentation contain query, ignoring case. An empty query matches
+// every device.
+func deviceMatches(device devices.Device, query string) bool {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return true
+	}
+	fields := append([]string{device.ID, device.Name, device.Room, device.Notes, device.Location, device.PurchaseDate}, device.Tags...)
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// renderDeviceNotes renders a device's location, purchase date and notes,
+// collapsed on its card, or nil when it has none.
+func renderDeviceNotes(device devices.Device) elem.Node {
+	if device.Notes == "" && device.Location == "" && device.PurchaseDate == "" {
+		return nil
+	}
+
+	var lines []elem.Node
+	if device.Location != "" {
+		lines = append(lines, elem.Div(attrs.Props{}, elem.Text("📍 "+device.Location)))
+	}
+	if device.PurchaseDate != "" {
+		lines = append(lines, elem.Div(attrs.Props{}, elem.Text("🛒 Purchased "+device.PurchaseDate)))
+	}
+	if device.Notes != "" {
+		lines = append(lines, elem.P(attrs.Props{attrs.Class: "device-notes-text"}, elem.Text(device.Notes)))
+	}
+	return elem.Details(attrs.Props{attrs.Class: "device-notes"},
+		append([]elem.Node{elem.Summary(attrs.Props{}, elem.Text("Notes"))}, lines...)...,
+	)
+}
+
+// HandleAll lists every web-enabled device, including hidden ones, so
+// internal and virtual devices can be inspected and controlled. With q it
+// lists only the devices matching it, see deviceMatches.
+func (ws *WebServer) HandleAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	snapshot := ws.deviceProvider.Snapshot()
+
+	var hidden, shown []elem.Node
+	for _, id := range sortedDeviceIDs(snapshot, sortByName, "") {
+		item := snapshot[id]
+		if !webEnabled(item.Device) || !deviceMatches(item.Device, query) {
+			continue
+		}
+		card := ws.renderDeviceCard(id, item.Device, item.State)
+		if item.Device.Hidden {
+			hidden = append(hidden, card)
+		} else {
+			shown = append(shown, card)
+		}
+	}
+
+	content := elem.Div(attrs.Props{},
+		elem.H1(attrs.Props{}, elem.Text("All devices")),
+		elem.P(attrs.Props{},
+			elem.Text(fmt.Sprintf("%d hidden, %d on the dashboard · ", len(hidden), len(shown))),
+			elem.A(attrs.Props{attrs.Href: "/"}, elem.Text("Back to dashboard")),
+		),
+		elem.Form(attrs.Props{attrs.Method: "get", attrs.Action: "/all", attrs.Class: "device-search"},
+			elem.Input(attrs.Props{attrs.Type: "search", attrs.Name: "q", attrs.Value: query, attrs.Placeholder: "Search names, rooms, locations and notes"}),
+			elem.Button(attrs.Props{attrs.Type: "submit"}, elem.Text("Search")),
+		),
+		elem.H2(attrs.Props{}, elem.Text("Hidden")),
+		elem.Div(attrs.Props{attrs.Class: "devices-grid"}, hidden...),
+		elem.H2(attrs.Props{}, elem.Text("Dashboard")),
+		elem.Div(attrs.Props{attrs.Class: "devices-grid"}, shown...),
+	)
+
+	w.Header().Set("Content-Type", "text/html")
+	if _, err := fmt.Fprint(w, ws.renderPage("z2m-homekit · all devices", content)); err != nil {
+		ws.logger.Error("Failed to write response", slog.Any("error", err))
+	}
+}
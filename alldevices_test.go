@@ -0,0 +1,74 @@
+package z2mhomekit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+func TestHiddenDevices(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ws.controller = &fakeController{}
+	ws.deviceProvider = fakeDeviceProvider{
+		"lamp":    {Device: devices.Device{ID: "lamp", Name: "Lamp", Type: devices.DeviceTypeLightbulb}},
+		"virtual": {Device: devices.Device{ID: "virtual", Name: "Virtual relay", Type: devices.DeviceTypeSwitch, Hidden: true}},
+		"secret":  {Device: devices.Device{ID: "secret", Name: "Secret plug", Type: devices.DeviceTypeOutlet, Web: devices.Ptr(false)}},
+	}
+
+	rec := httptest.NewRecorder()
+	ws.HandleIndex(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, "Lamp") || strings.Contains(body, "Virtual relay") {
+		t.Error("dashboard should show visible devices only")
+	}
+	if !strings.Contains(body, `href="/all">1 hidden`) {
+		t.Error("dashboard should link to hidden devices")
+	}
+
+	rec = httptest.NewRecorder()
+	ws.HandleAll(rec, httptest.NewRequest(http.MethodGet, "/all", nil))
+	body = rec.Body.String()
+	if !strings.Contains(body, "Virtual relay") || !strings.Contains(body, "Lamp") {
+		t.Errorf("/all should list hidden and visible devices: %s", body)
+	}
+	if strings.Contains(body, "Secret plug") {
+		t.Error("/all must not list web:false devices")
+	}
+
+	rec = httptest.NewRecorder()
+	ws.HandleToggle(rec, httptest.NewRequest(http.MethodPost, "/toggle/virtual", nil))
+	if rec.Code == http.StatusNotFound {
+		t.Error("hidden devices should stay controllable")
+	}
+}
+
+func TestSearchDevices(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ws.controller = &fakeController{}
+	ws.deviceProvider = fakeDeviceProvider{
+		"lamp": {Device: devices.Device{ID: "lamp", Name: "Lamp", Type: devices.DeviceTypeLightbulb}},
+		"leak": {Device: devices.Device{
+			ID: "leak", Name: "Leak sensor", Type: devices.DeviceTypeLeakSensor,
+			Location: "Under the kitchen sink", PurchaseDate: "2024-03-17", Notes: "CR2032, replaced 2025",
+		}},
+	}
+
+	rec := httptest.NewRecorder()
+	ws.HandleAll(rec, httptest.NewRequest(http.MethodGet, "/all?q=KITCHEN", nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, "Leak sensor") || strings.Contains(body, ">Lamp<") {
+		t.Errorf("search for kitchen should list the leak sensor only:\n%s", body)
+	}
+	if !strings.Contains(body, "📍 Under the kitchen sink") || !strings.Contains(body, "🛒 Purchased 2024-03-17") || !strings.Contains(body, "CR2032, replaced 2025") {
+		t.Errorf("card lacks the device notes:\n%s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	ws.HandleDevicesAPI(rec, httptest.NewRequest(http.MethodGet, "/api/v1/devices?q=cr2032", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `"id":"leak"`) || strings.Contains(body, `"id":"lamp"`) || !strings.Contains(body, `"notes":"CR2032, replaced 2025"`) {
+		t.Errorf("API search = %s", body)
+	}
+}
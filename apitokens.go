@@ -0,0 +1,283 @@
+package z2mhomekit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chasefleming/elem-go"
+	"github.com/chasefleming/elem-go/attrs"
+	"github.com/kradalby/z2m-homekit/tokens"
+)
+
+// tokenExpiryOptions are the choices offered when creating a token.
+var tokenExpiryOptions = []struct {
+	Label string
+	TTL   time.Duration
+}{
+	{"Never", 0},
+	{"1 day", 24 * time.Hour},
+	{"30 days", 30 * 24 * time.Hour},
+	{"90 days", 90 * 24 * time.Hour},
+	{"1 year", 365 * 24 * time.Hour},
+}
+
+type tokenNameKey struct{}
+
+// requestActor describes who made a request for the event log: the API
+// token's name or the web user when authenticated, otherwise the client
+// address.
+func requestActor(r *http.Request) string {
+	if name, ok := r.Context().Value(tokenNameKey{}).(string); ok {
+		return "token " + name
+	}
+	if user, ok := r.Context().Value(webUserKey{}).(string); ok {
+		return "user " + user
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		return "API client " + host
+	}
+	return "web UI " + host
+}
+
+// SetTokenStore enables API token management and authentication.
+func (ws *WebServer) SetTokenStore(s *tokens.Store) {
+	ws.tokenStore = s
+}
+
+// requireScope wraps an API handler with bearer token authentication. APIs
+// stay open until the first token is created, so existing monitoring keeps
+// working after an upgrade.
+func (ws *WebServer) requireScope(scope tokens.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ws.tokenStore == nil || !ws.tokenStore.Enabled() {
+			next(w, r)
+			return
+		}
+
+		secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="z2m-homekit"`)
+			http.Error(w, "API token required", http.StatusUnauthorized)
+			return
+		}
+
+		token, err := ws.tokenStore.Authenticate(strings.TrimSpace(secret), scope)
+		switch {
+		case errors.Is(err, tokens.ErrScope):
+			http.Error(w, fmt.Sprintf("API token lacks the %q scope", scope), http.StatusForbidden)
+			return
+		case err != nil:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="z2m-homekit", error="invalid_token"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		ws.logger.Debug("API request authenticated",
+			slog.String("token", token.Name),
+			slog.String("path", r.URL.Path),
+		)
+		next(w, r.WithContext(context.WithValue(r.Context(), tokenNameKey{}, token.Name)))
+	}
+}
+
+// errTokensNeedAuth explains why /tokens refuses to create tokens.
+const errTokensNeedAuth = "API tokens can only be created once web auth is configured (Z2M_HOMEKIT_WEB_AUTH)"
+
+// HandleTokens lists API tokens and creates new ones. Tokens are only
+// created while the web auth is on.
+func (ws *WebServer) HandleTokens(w http.ResponseWriter, r *http.Request) {
+	if ws.tokenStore == nil {
+		http.Error(w, "Token store not configured", http.StatusNotFound)
+		return
+	}
+
+	var created *tokens.Token
+	var secret, formErr string
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		// Without web auth anyone on the network could mint an admin
+		// token for themselves.
+		if !ws.webAuth.enabled() {
+			http.Error(w, errTokensNeedAuth, http.StatusForbidden)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form", http.StatusBadRequest)
+			return
+		}
+
+		var scopes []tokens.Scope
+		for _, s := range r.PostForm["scope"] {
+			scopes = append(scopes, tokens.Scope(s))
+		}
+
+		var ttl time.Duration
+		if v := r.PostFormValue("expiry"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				http.Error(w, "Invalid expiry", http.StatusBadRequest)
+				return
+			}
+			ttl = d
+		}
+
+		token, s, err := ws.tokenStore.Create(r.PostFormValue("name"), scopes, ttl)
+		if err != nil {
+			formErr = err.Error()
+			break
+		}
+		created, secret = &token, s
+		ws.LogEvent(fmt.Sprintf("Web UI: Created API token %q", token.Name))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if formErr != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if _, err := fmt.Fprint(w, ws.renderPage("API Tokens", ws.renderTokens(created, secret, formErr))); err != nil {
+		ws.logger.Error("Failed to write tokens response", slog.Any("error", err))
+	}
+}
+
+// HandleTokenRevoke deletes the token named in the path.
+func (ws *WebServer) HandleTokenRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ws.tokenStore == nil {
+		http.Error(w, "Token store not configured", http.StatusNotFound)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/tokens/revoke/")
+	if err := ws.tokenStore.Revoke(id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	ws.LogEvent(fmt.Sprintf("Web UI: Revoked API token %s", id))
+	http.Redirect(w, r, "/tokens", http.StatusSeeOther)
+}
+
+func (ws *WebServer) renderTokens(created *tokens.Token, secret, formErr string) elem.Node {
+	now := time.Now()
+
+	rows := []elem.Node{
+		elem.Tr(attrs.Props{},
+			elem.Th(attrs.Props{}, elem.Text("Name")),
+			elem.Th(attrs.Props{}, elem.Text("ID")),
+			elem.Th(attrs.Props{}, elem.Text("Scopes")),
+			elem.Th(attrs.Props{}, elem.Text("Created")),
+			elem.Th(attrs.Props{}, elem.Text("Expires")),
+			elem.Th(attrs.Props{}, elem.Text("Last Used")),
+			elem.Th(attrs.Props{}, elem.Text("")),
+		),
+	}
+
+	for _, t := range ws.tokenStore.List() {
+		scopes := make([]string, len(t.Scopes))
+		for i, s := range t.Scopes {
+			scopes[i] = string(s)
+		}
+
+		expires := "Never"
+		if !t.ExpiresAt.IsZero() {
+			expires = t.ExpiresAt.Format(time.RFC3339)
+			if t.Expired(now) {
+				expires += " (expired)"
+			}
+		}
+
+		lastUsed := "Never"
+		if !t.LastUsed.IsZero() {
+			lastUsed = t.LastUsed.Format(time.RFC3339)
+		}
+
+		rows = append(rows, elem.Tr(attrs.Props{},
+			elem.Td(attrs.Props{}, elem.Text(t.Name)),
+			elem.Td(attrs.Props{}, elem.Code(attrs.Props{}, elem.Text(t.ID))),
+			elem.Td(attrs.Props{}, elem.Text(strings.Join(scopes, ", "))),
+			elem.Td(attrs.Props{}, elem.Text(t.CreatedAt.Format(time.RFC3339))),
+			elem.Td(attrs.Props{}, elem.Text(expires)),
+			elem.Td(attrs.Props{}, elem.Text(lastUsed)),
+			elem.Td(attrs.Props{},
+				elem.Form(attrs.Props{attrs.Method: "post", attrs.Action: "/tokens/revoke/" + t.ID},
+					elem.Button(attrs.Props{attrs.Type: "submit", attrs.Class: "token-revoke"}, elem.Text("Revoke")),
+				),
+			),
+		))
+	}
+
+	var scopeInputs []elem.Node
+	for _, s := range tokens.Scopes {
+		props := attrs.Props{attrs.Type: "checkbox", attrs.Name: "scope", attrs.Value: string(s)}
+		if s == tokens.ScopeRead {
+			props[attrs.Checked] = "true"
+		}
+		scopeInputs = append(scopeInputs, elem.Label(attrs.Props{attrs.Class: "token-scope"},
+			elem.Input(props),
+			elem.Text(" "+string(s)),
+		))
+	}
+
+	var expiryOptions []elem.Node
+	for _, opt := range tokenExpiryOptions {
+		value := ""
+		if opt.TTL > 0 {
+			value = opt.TTL.String()
+		}
+		expiryOptions = append(expiryOptions, elem.Option(attrs.Props{attrs.Value: value}, elem.Text(opt.Label)))
+	}
+
+	var banner elem.Node
+	switch {
+	case created != nil:
+		banner = elem.Div(attrs.Props{attrs.Class: "token-created"},
+			elem.P(attrs.Props{}, elem.Text(fmt.Sprintf("Created token %q. Copy it now, it will not be shown again:", created.Name))),
+			elem.Pre(attrs.Props{attrs.Class: "token-secret"}, elem.Text(secret)),
+		)
+	case formErr != "":
+		banner = elem.Div(attrs.Props{attrs.Class: "token-error"}, elem.Text(formErr))
+	}
+
+	createForm := elem.P(attrs.Props{attrs.Class: "token-error"}, elem.Text(errTokensNeedAuth+"."))
+	if ws.webAuth.enabled() {
+		createForm = elem.Form(attrs.Props{attrs.Method: "post", attrs.Action: "/tokens", attrs.Class: "token-form"},
+			elem.Label(attrs.Props{}, elem.Text("Name "),
+				elem.Input(attrs.Props{attrs.Type: "text", attrs.Name: "name", attrs.Required: "true"}),
+			),
+			elem.Div(attrs.Props{}, scopeInputs...),
+			elem.Label(attrs.Props{}, elem.Text("Expires "),
+				elem.Select(attrs.Props{attrs.Name: "expiry"}, expiryOptions...),
+			),
+			elem.Button(attrs.Props{attrs.Type: "submit"}, elem.Text("Create")),
+		)
+	}
+
+	return elem.Div(attrs.Props{},
+		elem.H1(attrs.Props{}, elem.Text("API Tokens")),
+		elem.P(attrs.Props{}, elem.Text("Tokens authenticate requests to /api/ with an \"Authorization: Bearer <token>\" header. While no tokens exist the API is open.")),
+		banner,
+		elem.Table(attrs.Props{attrs.Class: "tokens-table"}, rows...),
+		elem.H2(attrs.Props{}, elem.Text("Create Token")),
+		createForm,
+		elem.P(attrs.Props{}, elem.A(attrs.Props{attrs.Href: "/"}, elem.Text("Back to devices"))),
+	)
+}
@@ -0,0 +1,110 @@
+package z2mhomekit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/tokens"
+)
+
+func TestRequireScope(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	store, err := tokens.Open(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws.SetTokenStore(store)
+
+	handler := ws.requireScope(tokens.ScopeRead, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	call := func(auth string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/status", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+
+	if got := call(""); got != http.StatusNoContent {
+		t.Fatalf("open API status = %d, want 204", got)
+	}
+
+	_, readSecret, err := store.Create("monitor", []tokens.Scope{tokens.ScopeRead}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := call(""); got != http.StatusUnauthorized {
+		t.Errorf("missing token status = %d, want 401", got)
+	}
+	if got := call("z2mh_bogus"); got != http.StatusUnauthorized {
+		t.Errorf("bogus token status = %d, want 401", got)
+	}
+	if got := call(readSecret); got != http.StatusNoContent {
+		t.Errorf("valid token status = %d, want 204", got)
+	}
+
+	control := ws.requireScope(tokens.ScopeControl, func(w http.ResponseWriter, r *http.Request) {})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/x", nil)
+	req.Header.Set("Authorization", "Bearer "+readSecret)
+	rec := httptest.NewRecorder()
+	control(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("read token on control endpoint status = %d, want 403", rec.Code)
+	}
+}
+
+func TestHandleTokensCreateAndRevoke(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	store, err := tokens.Open(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws.SetTokenStore(store)
+
+	form := url.Values{"name": {"ci"}, "scope": {"read", "control"}, "expiry": {"720h0m0s"}}
+	create := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/tokens", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		ws.HandleTokens(rec, req)
+		return rec
+	}
+
+	// Without web auth anyone could mint themselves a token.
+	if rec := create(); rec.Code != http.StatusForbidden || store.Enabled() {
+		t.Fatalf("create without web auth status = %d, tokens = %d; want 403 and none", rec.Code, len(store.List()))
+	}
+
+	ws.SetWebAuth(WebAuth{Mode: WebAuthBasic, Username: "admin", Password: "secret"})
+	rec := create()
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create status = %d, body %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), "z2mh_") {
+		t.Error("created token secret not shown")
+	}
+
+	list := store.List()
+	if len(list) != 1 || len(list[0].Scopes) != 2 || list[0].ExpiresAt.IsZero() {
+		t.Fatalf("stored tokens = %+v", list)
+	}
+
+	rec = httptest.NewRecorder()
+	ws.HandleTokenRevoke(rec, httptest.NewRequest(http.MethodPost, "/tokens/revoke/"+list[0].ID, nil))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("revoke status = %d", rec.Code)
+	}
+	if store.Enabled() {
+		t.Error("token still present after revoke")
+	}
+}
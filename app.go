@@ -2,35 +2,21 @@ package z2mhomekit
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"net"
-	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	homekitqr "github.com/kradalby/homekit-qr"
-	"github.com/kradalby/kra/web"
 	appconfig "github.com/kradalby/z2m-homekit/config"
 	"github.com/kradalby/z2m-homekit/devices"
-	"github.com/kradalby/z2m-homekit/events"
 	"github.com/kradalby/z2m-homekit/logging"
-	"github.com/kradalby/z2m-homekit/metrics"
-
-	mqtt "github.com/mochi-mqtt/server/v2"
-	"github.com/mochi-mqtt/server/v2/hooks/auth"
-	"github.com/mochi-mqtt/server/v2/listeners"
-
-	"github.com/brutella/hap"
-	"tailscale.com/util/eventbus"
 )
 
-var version = "dev"
-
 // getLocalIP returns the local IP address to use for MQTT broker configuration
 func getLocalIP() (string, error) {
 	addrs, err := net.InterfaceAddrs()
@@ -53,234 +39,183 @@ func getLocalIP() (string, error) {
 func Main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	cfg, err := appconfig.Load()
+	cfg, deviceCfg, logger, err := loadConfiguration()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
 
-	logger, err := logging.New(cfg.LogLevel, cfg.LogFormat)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to configure logger: %v\n", err)
-		os.Exit(1)
+	if runningInContainer() {
+		slog.Info("Running in a container", "puid", cfg.PUID, "pgid", cfg.PGID)
 	}
-	slog.SetDefault(logger)
-
-	slog.Info("Starting z2m-homekit Bridge",
-		"version", version,
-		"log_level", cfg.LogLevel,
-		"log_format", cfg.LogFormat,
-	)
-
-	slog.Info("Configuration loaded",
-		"hap_addr", cfg.HAPAddrPort().String(),
-		"web_addr", cfg.WebAddrPort().String(),
-		"mqtt_addr", cfg.MQTTAddrPort().String(),
-		"devices_config", cfg.DevicesConfigPath,
-	)
-
-	deviceCfg, err := devices.LoadConfig(cfg.DevicesConfigPath)
-	if err != nil {
-		slog.Error("Failed to load devices configuration", "error", err)
+	if err := prepareDataDirs(cfg, logger); err != nil {
+		slog.Error("Data directories are not usable", "error", err)
 		os.Exit(1)
 	}
 
-	slog.Info("Loaded devices", "count", len(deviceCfg.Devices))
-	for _, device := range deviceCfg.Devices {
-		slog.Info("Device configured",
-			"id", device.ID,
-			"name", device.Name,
-			"type", device.Type,
-			"topic", device.Topic,
-		)
+	if err := lifecycle.Start(cfg.LifecyclePath, time.Now()); err != nil {
+		slog.Warn("Failed to track lifecycle", "error", err)
 	}
+	slog.Info("Starting", "restart_cause", lifecycle.RestartCause())
+	defer recordPanic()
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	eventBus, err := events.New(logger)
-	if err != nil {
-		slog.Error("Failed to initialize eventbus", "error", err)
-		os.Exit(1)
-	}
-	defer func() {
-		if err := eventBus.Close(); err != nil {
-			slog.Warn("Error closing eventbus", "error", err)
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(shutdown)
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
+	// Discovery asks for a reload when a changed device list from
+	// zigbee2mqtt cannot be applied to the running bridge.
+	rediscovered := make(chan struct{}, 1)
+	onDiscovered := func() {
+		select {
+		case rediscovered <- struct{}{}:
+		default:
 		}
-	}()
+	}
 
-	// Initialize metrics collector
-	metricsCollector, err := metrics.NewCollector(ctx, logger, eventBus, nil)
+	stop, err := runBridge(ctx, cfg, deviceCfg, logger, onDiscovered)
 	if err != nil {
-		slog.Error("Failed to initialize metrics collector", "error", err)
-		os.Exit(1)
+		slog.Error("Failed to start bridge", "error", err)
+		exitWithError(err)
 	}
-	defer metricsCollector.Close()
 
-	commands := make(chan devices.CommandEvent, 10)
+	slog.Info("Server running, press Ctrl+C to stop, send SIGHUP to reload configuration")
+	for {
+		select {
+		case sig := <-shutdown:
+			slog.Info("Shutting down...", "signal", sig.String())
+			stop()
+			if err := lifecycle.Stop(ShutdownSignal, signalName(sig), time.Now()); err != nil {
+				slog.Warn("Failed to record shutdown", "error", err)
+			}
+			slog.Info("Shutdown complete")
+			return
 
-	localIP, err := getLocalIP()
-	if err != nil {
-		slog.Warn("Failed to get local IP, using localhost", "error", err)
-		localIP = "localhost"
-	}
-	slog.Info("Local IP address", "ip", localIP)
+		case <-reload:
+			slog.Info("Received SIGHUP, reloading configuration")
+		case <-rediscovered:
+			slog.Info("Discovered devices changed, reloading configuration")
+		}
 
-	// Create MQTT server
-	mqttServer := mqtt.New(&mqtt.Options{
-		InlineClient: true,
-	})
+		newCfg, newDeviceCfg, newLogger, err := loadConfiguration()
+		if err != nil {
+			slog.Error("Reload failed, keeping current configuration", "error", err)
+			continue
+		}
+		if err := prepareDataDirs(newCfg, newLogger); err != nil {
+			slog.Error("Reload failed, keeping current configuration", "error", err)
+			continue
+		}
 
-	if err := mqttServer.AddHook(new(auth.AllowHook), nil); err != nil {
-		slog.Error("Failed to add MQTT auth hook", "error", err)
-		os.Exit(1)
+		stop()
+		stop, err = runBridge(ctx, newCfg, newDeviceCfg, newLogger, onDiscovered)
+		if err != nil {
+			slog.Error("Failed to restart bridge after reload", "error", err)
+			exitWithError(err)
+		}
+		slog.Info("Configuration reloaded", "devices", len(newDeviceCfg.Devices))
 	}
+}
 
-	// Create device manager
-	deviceManager, err := devices.NewManager(deviceCfg.Devices, commands, eventBus, mqttServer, logger)
-	if err != nil {
-		slog.Error("Failed to initialize device manager", "error", err)
-		os.Exit(1)
+// recordPanic records a panic on the main goroutine as the shutdown reason
+// before letting it crash the process.
+func recordPanic() {
+	r := recover()
+	if r == nil {
+		return
 	}
+	_ = lifecycle.Stop(ShutdownPanic, fmt.Sprint(r), time.Now())
+	panic(r)
+}
 
-	// Add MQTT hook for message processing
-	mqttClient, err := eventBus.Client(events.ClientMQTT)
-	if err != nil {
-		slog.Error("Failed to get MQTT client", "error", err)
-		os.Exit(1)
-	}
-	mqttHook := &MQTTHook{
-		statePublisher: eventbus.Publish[devices.StateChangedEvent](mqttClient),
-		deviceManager:  deviceManager,
-		logger:         logger,
-	}
-	if err := mqttServer.AddHook(mqttHook, nil); err != nil {
-		slog.Error("Failed to add MQTT message hook", "error", err)
-		os.Exit(1)
-	}
+// exitWithError records err as the shutdown reason and exits.
+func exitWithError(err error) {
+	_ = lifecycle.Stop(ShutdownError, err.Error(), time.Now())
+	os.Exit(1)
+}
 
-	tcp := listeners.NewTCP(listeners.Config{
-		ID:      "tcp",
-		Address: cfg.MQTTAddrPort().String(),
-	})
-	if err := mqttServer.AddListener(tcp); err != nil {
-		slog.Error("Failed to add MQTT listener", "error", err)
-		os.Exit(1)
+// signalName returns the conventional name of a shutdown signal.
+func signalName(sig os.Signal) string {
+	switch sig {
+	case os.Interrupt:
+		return "SIGINT"
+	case syscall.SIGTERM:
+		return "SIGTERM"
 	}
+	return sig.String()
+}
 
-	mqttComponent := string(events.ClientMQTT)
-	eventBus.PublishConnectionStatus(mqttClient, events.ConnectionStatusEvent{
-		Timestamp: time.Now(),
-		Component: mqttComponent,
-		Status:    events.ConnectionStatusConnecting,
-	})
-
-	go func() {
-		slog.Info("Starting MQTT broker", "addr", cfg.MQTTAddrPort().String())
-		eventBus.PublishConnectionStatus(mqttClient, events.ConnectionStatusEvent{
-			Timestamp: time.Now(),
-			Component: mqttComponent,
-			Status:    events.ConnectionStatusConnected,
-		})
-		if err := mqttServer.Serve(); err != nil {
-			eventBus.PublishConnectionStatus(mqttClient, events.ConnectionStatusEvent{
-				Timestamp: time.Now(),
-				Component: mqttComponent,
-				Status:    events.ConnectionStatusFailed,
-				Error:     err.Error(),
-			})
-			slog.Error("MQTT server error", "error", err)
-			return
-		}
-		eventBus.PublishConnectionStatus(mqttClient, events.ConnectionStatusEvent{
-			Timestamp: time.Now(),
-			Component: mqttComponent,
-			Status:    events.ConnectionStatusDisconnected,
-		})
-	}()
-
-	slog.Info("MQTT broker started", "addr", cfg.MQTTAddrPort().String())
-
-	go deviceManager.ProcessCommands(ctx)
-	go deviceManager.ProcessStateEvents(ctx)
-
-	// Create HAP manager
-	hapManager := NewHAPManager(deviceCfg.Devices, cfg.BridgeName, commands, deviceManager, eventBus, logger)
-	hapManager.Start(ctx)
-	defer hapManager.Close()
-
-	accessories := hapManager.GetAccessories()
-	if len(accessories) == 0 {
-		slog.Error("No accessories to serve")
-		os.Exit(1)
+// loadConfiguration reads the environment and the devices file and installs
+// the configured logger as the default.
+func loadConfiguration() (*appconfig.Config, *devices.Config, *slog.Logger, error) {
+	cfg, err := appconfig.Load()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to load configuration: %w", err)
 	}
 
-	fsStore := hap.NewFsStore(cfg.HAPStoragePath)
-	hapServer, err := hap.NewServer(
-		fsStore,
-		accessories[0],
-		accessories[1:]...,
-	)
+	logger, err := logging.New(cfg.LogLevel, cfg.LogFormat)
 	if err != nil {
-		slog.Error("Failed to create HAP server", "error", err)
-		os.Exit(1)
+		return nil, nil, nil, fmt.Errorf("failed to configure logger: %w", err)
 	}
+	slog.SetDefault(logger)
 
-	hapServer.Pin = cfg.HAPPin
-	hapServer.Addr = cfg.HAPAddrPort().String()
+	slog.Info("Starting z2m-homekit Bridge",
+		"version", version,
+		"commit", buildInfo().Commit,
+		"build_date", buildInfo().BuildDate,
+		"log_level", cfg.LogLevel,
+		"log_format", cfg.LogFormat,
+	)
 
-	hapManager.SetServer(hapServer)
-	hapManager.SetStore(fsStore)
+	slog.Info("Configuration loaded",
+		"hap_addr", cfg.HAPAddrPort().String(),
+		"web_addr", cfg.WebAddrPort().String(),
+		"mqtt_addr", cfg.MQTTAddrPort().String(),
+		"devices_config", cfg.DevicesConfigPath,
+	)
 
-	hapStatusClient, err := eventBus.Client(events.ClientHAP)
-	if err != nil {
-		slog.Error("Failed to get HAP client", "error", err)
-		os.Exit(1)
+	var deviceCfg *devices.Config
+	if cfg.Discovery {
+		discovered, err := devices.LoadDiscovered(cfg.DiscoveryPath)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		slog.Info("Loaded discovered devices", "count", len(discovered), "path", cfg.DiscoveryPath)
+		deviceCfg, err = devices.LoadConfigWithDiscovered(cfg.DevicesConfigPath, discovered)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to load devices configuration: %w", err)
+		}
+	} else {
+		deviceCfg, err = devices.LoadConfig(cfg.DevicesConfigPath)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to load devices configuration: %w", err)
+		}
 	}
-	hapComponent := string(events.ClientHAP)
-	eventBus.PublishConnectionStatus(hapStatusClient, events.ConnectionStatusEvent{
-		Timestamp: time.Now(),
-		Component: hapComponent,
-		Status:    events.ConnectionStatusConnecting,
-	})
-
-	go func() {
-		slog.Info("Starting HomeKit server",
-			"addr", cfg.HAPAddrPort().String(),
-			"pin", cfg.HAPPin,
+
+	slog.Info("Loaded devices", "count", len(deviceCfg.Devices))
+	for _, device := range deviceCfg.Devices {
+		slog.Info("Device configured",
+			"id", device.ID,
+			"name", device.Name,
+			"type", device.Type,
+			"topic", device.Topic,
 		)
-		eventBus.PublishConnectionStatus(hapStatusClient, events.ConnectionStatusEvent{
-			Timestamp: time.Now(),
-			Component: hapComponent,
-			Status:    events.ConnectionStatusConnected,
-		})
-		if err := hapServer.ListenAndServe(ctx); err != nil {
-			if errors.Is(err, context.Canceled) {
-				eventBus.PublishConnectionStatus(hapStatusClient, events.ConnectionStatusEvent{
-					Timestamp: time.Now(),
-					Component: hapComponent,
-					Status:    events.ConnectionStatusDisconnected,
-				})
-			} else {
-				eventBus.PublishConnectionStatus(hapStatusClient, events.ConnectionStatusEvent{
-					Timestamp: time.Now(),
-					Component: hapComponent,
-					Status:    events.ConnectionStatusFailed,
-					Error:     err.Error(),
-				})
-				slog.Error("HAP server error", "error", err)
-			}
-			return
-		}
-		eventBus.PublishConnectionStatus(hapStatusClient, events.ConnectionStatusEvent{
-			Timestamp: time.Now(),
-			Component: hapComponent,
-			Status:    events.ConnectionStatusDisconnected,
-		})
-	}()
+	}
 
-	fmt.Printf("HomeKit bridge ready - pair with PIN: %s\n\n", cfg.HAPPin)
+	return cfg, deviceCfg, logger, nil
+}
 
+// runBridge starts a bridge for the configuration and prints the pairing
+// details. onDiscovered is called when discovery changes the device list.
+// The returned function stops it.
+func runBridge(ctx context.Context, cfg *appconfig.Config, deviceCfg *devices.Config, logger *slog.Logger, onDiscovered func()) (func(), error) {
 	qrConfig := homekitqr.QRCodeConfig{
 		SetupURIConfig: homekitqr.SetupURIConfig{
 			PairingCode: cfg.HAPPin,
@@ -292,74 +227,31 @@ func Main() {
 	qr, err := homekitqr.GenerateQRTerminal(qrConfig)
 	if err != nil {
 		slog.Warn("Failed to generate QR code", "error", err)
-	} else {
-		fmt.Println(qr)
-	}
-
-	fmt.Println("========================================")
-	slog.Info("Scan QR code or enter PIN manually in Home app", "pin", cfg.HAPPin)
-
-	qrCode := ""
-	if qr != "" {
-		qrCode = qr
 	}
 
-	kraOpts := []web.Option{
-		web.WithStdLogger(log.New(os.Stdout, "kraweb: ", log.LstdFlags)),
-		web.WithLogger(logger),
-		web.WithTailscaleStateDir(cfg.TailscaleStateDir),
+	bridge, err := NewBridge(cfg, deviceCfg, logger, BridgeOptions{QRCode: qr, OnDevicesDiscovered: onDiscovered})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bridge: %w", err)
 	}
 
-	enableTailscale := cfg.TailscaleAuthKey != ""
-	kraConfig := web.ServerConfig{
-		Hostname:        cfg.TailscaleHostname,
-		LocalAddr:       cfg.WebAddrPort().String(),
-		AuthKey:         cfg.TailscaleAuthKey,
-		EnableTailscale: enableTailscale,
+	bridgeCtx, cancel := context.WithCancel(ctx)
+	stop := func() {
+		cancel()
+		bridge.Close()
 	}
 
-	kraWeb, err := web.NewServer(kraConfig, kraOpts...)
-	if err != nil {
-		slog.Error("Failed to configure web server", "error", err)
-		os.Exit(1)
+	if err := bridge.Start(bridgeCtx); err != nil {
+		stop()
+		return nil, err
 	}
 
-	webServer := NewWebServer(logger, deviceManager, deviceManager, eventBus, kraWeb, cfg.HAPPin, qrCode, hapManager)
-	webServer.LogEvent("Server starting...")
-	webServer.Start(ctx)
-	defer webServer.Close()
-
-	kraWeb.Handle("/", http.HandlerFunc(webServer.HandleIndex))
-	kraWeb.Handle("/toggle/", http.HandlerFunc(webServer.HandleToggle))
-	kraWeb.Handle("/brightness/", http.HandlerFunc(webServer.HandleBrightness))
-	kraWeb.Handle("/events", http.HandlerFunc(webServer.HandleSSE))
-	kraWeb.Handle("/health", http.HandlerFunc(webServer.HandleHealth))
-	kraWeb.Handle("/qrcode", http.HandlerFunc(webServer.HandleQRCode))
-	kraWeb.Handle("/debug/eventbus", http.HandlerFunc(webServer.HandleEventBusDebug))
-	// Note: /metrics is provided by kraweb internally
-
-	// Setup debug handlers
-	SetupDebugHandlers(kraWeb, hapManager)
-
-	webURL := fmt.Sprintf("http://%s", cfg.WebAddrPort().String())
-	if enableTailscale {
-		webURL = fmt.Sprintf("https://%s (and http://%s)", cfg.TailscaleHostname, cfg.WebAddrPort().String())
+	fmt.Printf("HomeKit bridge ready - pair with PIN: %s\n\n", cfg.HAPPin)
+	if qr != "" {
+		fmt.Println(qr)
 	}
-	slog.Info("Web UI available", "url", webURL)
 
-	slog.Info("Server running, press Ctrl+C to stop")
-	<-ctx.Done()
-	slog.Info("Shutting down...")
+	fmt.Println("========================================")
+	slog.Info("Scan QR code or enter PIN manually in Home app", "pin", cfg.HAPPin)
 
-	slog.Info("Stopping web server...")
-	slog.Info("Stopping MQTT broker...")
-	if err := mqttServer.Close(); err != nil {
-		slog.Error("Error stopping MQTT broker", "error", err)
-	}
-	eventBus.PublishConnectionStatus(mqttClient, events.ConnectionStatusEvent{
-		Timestamp: time.Now(),
-		Component: mqttComponent,
-		Status:    events.ConnectionStatusDisconnected,
-	})
-	slog.Info("Shutdown complete")
+	return stop, nil
 }
@@ -0,0 +1,124 @@
+(function () {
+  // Reload now and then so layout and configuration changes reach panels
+  // that are never touched.
+  const reloadInterval = 60 * 60 * 1000;
+  // Shift the panel by a few pixels every minute against burn-in.
+  const shiftInterval = 60 * 1000;
+  const maxShift = 6;
+
+  function tileState(tile, on) {
+    tile.classList.toggle('on', on);
+    tile.querySelector('[data-role="tile-state"]').textContent = on ? 'On' : 'Off';
+  }
+
+  function updateLightsOn() {
+    const widget = document.querySelector('[data-role="lights-on"]');
+    if (!widget) {
+      return;
+    }
+    const lit = document.querySelectorAll('.kiosk-tile.on[data-light="true"]').length;
+    widget.textContent = lit === 1 ? '1 light on' : lit + ' lights on';
+  }
+
+  function updateClimate() {
+    const sensors = document.querySelectorAll('[data-climate-id]');
+    let tempSum = 0, tempCount = 0, humSum = 0, humCount = 0;
+
+    sensors.forEach(function (sensor) {
+      const parts = [];
+      if (sensor.dataset.temperature) {
+        tempSum += parseFloat(sensor.dataset.temperature);
+        tempCount++;
+        parts.push(sensor.dataset.temperature + '°');
+      }
+      if (sensor.dataset.humidity) {
+        humSum += parseFloat(sensor.dataset.humidity);
+        humCount++;
+        parts.push(sensor.dataset.humidity + '%');
+      }
+      sensor.querySelector('[data-role="sensor-value"]').textContent = parts.join(' · ');
+    });
+
+    const average = document.querySelector('[data-role="climate-average"]');
+    if (!average) {
+      return;
+    }
+    const parts = [];
+    if (tempCount > 0) {
+      parts.push((tempSum / tempCount).toFixed(1) + '°');
+    }
+    if (humCount > 0) {
+      parts.push(Math.round(humSum / humCount) + '%');
+    }
+    average.textContent = parts.join(' · ');
+  }
+
+  function updateClock() {
+    const clock = document.querySelector('[data-role="clock"]');
+    if (clock) {
+      clock.textContent = new Date().toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' });
+    }
+  }
+
+  function shift() {
+    const panel = document.getElementById('kiosk');
+    const x = Math.round((Math.random() * 2 - 1) * maxShift);
+    const y = Math.round((Math.random() * 2 - 1) * maxShift);
+    panel.style.transform = 'translate(' + x + 'px, ' + y + 'px)';
+  }
+
+  document.addEventListener('click', function (event) {
+    const tile = event.target.closest('.kiosk-tile');
+    if (!tile) {
+      return;
+    }
+    const on = !tile.classList.contains('on');
+    tileState(tile, on);
+    updateLightsOn();
+    fetch('/toggle/' + encodeURIComponent(tile.dataset.deviceId), {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/x-www-form-urlencoded' },
+      body: 'action=' + (on ? 'on' : 'off'),
+      redirect: 'manual',
+    }).catch(function (err) {
+      console.error('toggle failed', err);
+    });
+  });
+
+  document.addEventListener('DOMContentLoaded', function () {
+    updateClock();
+    updateClimate();
+    updateLightsOn();
+    setInterval(updateClock, 10 * 1000);
+    setInterval(shift, shiftInterval);
+    setTimeout(function () { location.reload(); }, reloadInterval);
+
+    const source = new EventSource('/events');
+    source.onmessage = function (event) {
+      let data;
+      try {
+        data = JSON.parse(event.data);
+      } catch (err) {
+        console.error('invalid SSE payload', err);
+        return;
+      }
+
+      const tile = document.querySelector('.kiosk-tile[data-device-id="' + data.device_id + '"]');
+      if (tile && data.on !== undefined && data.on !== null) {
+        tileState(tile, data.on);
+        updateLightsOn();
+      }
+
+      const sensor = document.querySelector('[data-climate-id="' + data.device_id + '"]');
+      if (sensor) {
+        if (data.temperature !== undefined && data.temperature !== null) {
+          sensor.dataset.temperature = data.temperature.toFixed(1);
+        }
+        if (data.humidity !== undefined && data.humidity !== null) {
+          sensor.dataset.humidity = Math.round(data.humidity);
+        }
+        updateClimate();
+      }
+    };
+  });
+})();
@@ -10,8 +10,118 @@
     return date.toLocaleTimeString();
   }
 
+  function linkQualityLevel(lq) {
+    if (!lq || lq <= 0) {
+      return 'unknown';
+    }
+    if (lq < 50) {
+      return 'weak';
+    }
+    if (lq < 100) {
+      return 'fair';
+    }
+    return 'good';
+  }
+
+  const trendSymbols = { rising: '↑', falling: '↓', steady: '→' };
+
+  function updateWeatherCard(data) {
+    const card = document.querySelector('[data-weather-source="' + data.device_id + '"]');
+    if (!card || !data.pressure_trend || data.pressure_change === undefined || data.pressure_change === null) {
+      return;
+    }
+
+    const forecastEl = card.querySelector('[data-role="forecast-value"]');
+    if (forecastEl) {
+      forecastEl.textContent = data.forecast || '';
+    }
+
+    const trendEl = card.querySelector('[data-role="trend-value"]');
+    if (trendEl) {
+      const change = (data.pressure_change >= 0 ? '+' : '') + data.pressure_change.toFixed(1);
+      trendEl.textContent = trendSymbols[data.pressure_trend] + ' ' + data.pressure_trend + ' (' + change + ' hPa/3h)';
+    }
+
+    const pressureEl = card.querySelector('[data-role="pressure-value"]');
+    if (pressureEl && data.pressure !== undefined && data.pressure !== null) {
+      pressureEl.textContent = data.pressure.toFixed(1) + ' hPa';
+    }
+  }
+
+  function updateGroupCards(data) {
+    if (data.on === undefined || data.on === null) {
+      return;
+    }
+
+    document.querySelectorAll('[data-member-id="' + data.device_id + '"]').forEach(function (member) {
+      member.classList.toggle('on', data.on);
+
+      const group = member.closest('[data-group-id]');
+      const total = group.querySelectorAll('[data-member-id]').length;
+      const lit = group.querySelectorAll('[data-member-id].on').length;
+
+      group.classList.toggle('on', lit > 0);
+      group.classList.toggle('off', lit === 0);
+
+      const status = group.querySelector('[data-role="group-status"]');
+      if (status) {
+        status.textContent = lit === 0 ? 'All off' : (lit === total ? 'All on' : lit + ' of ' + total + ' on');
+      }
+
+      const actionInput = group.querySelector('[data-role="action-input"]');
+      const button = group.querySelector('[data-role="toggle-button"]');
+      if (actionInput && button) {
+        actionInput.value = lit > 0 ? 'off' : 'on';
+        button.textContent = lit > 0 ? 'Turn Off' : 'Turn On';
+        button.classList.toggle('off', lit > 0);
+        button.classList.toggle('on', lit === 0);
+      }
+    });
+  }
+
+  // Mirrors firmwareUpdateText in ota.go.
+  function firmwareUpdateText(data) {
+    switch (data.update_state) {
+      case 'available':
+        return 'Firmware update available';
+      case 'scheduled':
+        return 'Firmware update scheduled';
+      case 'requested':
+        return 'Firmware update requested';
+      case 'updating': {
+        let text = 'Updating firmware';
+        if (data.update_progress !== undefined && data.update_progress !== null) {
+          text += ': ' + data.update_progress.toFixed(0) + '%';
+        }
+        if (data.update_remaining !== undefined && data.update_remaining !== null) {
+          text += ', ' + Math.max(1, Math.ceil(data.update_remaining / 60)) + ' min left';
+        }
+        return text;
+      }
+    }
+    return '';
+  }
+
+  function updateFirmware(card, data) {
+    const block = card.querySelector('[data-role="firmware-update"]');
+    if (!block) {
+      return;
+    }
+    block.dataset.state = data.update_state || '';
+
+    const progress = block.querySelector('[data-role="update-progress"]');
+    if (data.update_progress !== undefined && data.update_progress !== null) {
+      progress.value = data.update_progress;
+    } else {
+      progress.removeAttribute('value');
+    }
+    block.querySelector('[data-role="update-text"]').textContent = firmwareUpdateText(data);
+  }
+
   function updateDeviceCard(data) {
     console.log('SSE Data received:', data);
+    updateWeatherCard(data);
+    updateGroupCards(data);
     const card = document.querySelector('[data-device-id="' + data.device_id + '"]');
     if (!card) {
       return;
@@ -60,6 +170,17 @@
       connectionText.textContent = data.connection_note || '';
     }
 
+    const linkQuality = card.querySelector('[data-role="link-quality"]');
+    if (linkQuality && data.link_quality !== undefined && data.link_quality !== null) {
+      linkQuality.classList.remove('unknown', 'weak', 'fair', 'good');
+      linkQuality.classList.add(linkQualityLevel(data.link_quality));
+      linkQuality.dataset.value = data.link_quality;
+      const lqValue = linkQuality.querySelector('[data-role="link-quality-value"]');
+      if (lqValue) {
+        lqValue.textContent = data.link_quality > 0 ? String(data.link_quality) : 'n/a';
+      }
+    }
+
     // Update sensor values
     const tempEl = card.querySelector('[data-role="temperature-value"]');
     if (tempEl && data.temperature !== undefined && data.temperature !== null) {
@@ -71,6 +192,16 @@
       humidityEl.textContent = data.humidity.toFixed(1) + ' %';
     }
 
+    const pressureEl = card.querySelector('[data-role="pressure-value"]');
+    if (pressureEl && data.pressure !== undefined && data.pressure !== null) {
+      pressureEl.textContent = data.pressure.toFixed(1) + ' hPa';
+    }
+
+    const trendEl = card.querySelector('[data-role="pressure-trend"]');
+    if (trendEl && data.pressure_trend) {
+      trendEl.textContent = trendSymbols[data.pressure_trend] || '';
+    }
+
     const batteryEl = card.querySelector('[data-role="battery-value"]');
     if (batteryEl && data.battery !== undefined && data.battery !== null) {
       batteryEl.textContent = data.battery + ' %';
@@ -101,9 +232,126 @@
     if (ctEl && data.color_temp !== undefined && data.color_temp !== null) {
       ctEl.textContent = data.color_temp + ' mireds';
     }
+
+    updateFirmware(card, data);
+  }
+
+  // Press-and-hold dimming: start on press, stop on release. Bound on the
+  // document so buttons in cards swapped in by htmx keep working.
+  let dimming = null;
+
+  function postDim(deviceId, direction) {
+    const body = new URLSearchParams({ direction: direction });
+    return fetch('/dim/' + encodeURIComponent(deviceId), { method: 'POST', body: body })
+      .catch(function (err) {
+        console.error('dim request failed', err);
+      });
+  }
+
+  function stopDimming() {
+    if (!dimming) {
+      return;
+    }
+    const deviceId = dimming;
+    dimming = null;
+    postDim(deviceId, 'stop');
+  }
+
+  document.addEventListener('pointerdown', function (event) {
+    const button = event.target.closest('[data-role="dim-button"]');
+    if (!button) {
+      return;
+    }
+    event.preventDefault();
+    stopDimming();
+    dimming = button.dataset.deviceId;
+    postDim(dimming, button.dataset.direction);
+  });
+
+  ['pointerup', 'pointercancel'].forEach(function (type) {
+    document.addEventListener(type, stopDimming);
+  });
+  document.addEventListener('pointerout', function (event) {
+    if (event.target.closest('[data-role="dim-button"]')) {
+      stopDimming();
+    }
+  });
+  window.addEventListener('blur', stopDimming);
+
+  // Drag-and-drop reordering of device cards in custom sort mode. The new
+  // order is saved in a cookie by POST /order.
+  function setupReordering() {
+    const grid = document.querySelector('.devices-grid[data-sortable="true"]');
+    if (!grid) {
+      return;
+    }
+    let dragged = null;
+
+    grid.querySelectorAll(':scope > [data-device-id]').forEach(function (card) {
+      card.setAttribute('draggable', 'true');
+    });
+
+    grid.addEventListener('dragstart', function (event) {
+      dragged = event.target.closest('[data-device-id]');
+      if (dragged) {
+        dragged.classList.add('dragging');
+        event.dataTransfer.effectAllowed = 'move';
+      }
+    });
+
+    grid.addEventListener('dragover', function (event) {
+      const target = event.target.closest('[data-device-id]');
+      if (!dragged || !target || target === dragged) {
+        return;
+      }
+      event.preventDefault();
+      const rect = target.getBoundingClientRect();
+      const after = event.clientX > rect.left + rect.width / 2;
+      grid.insertBefore(dragged, after ? target.nextSibling : target);
+    });
+
+    grid.addEventListener('dragend', function () {
+      if (!dragged) {
+        return;
+      }
+      dragged.classList.remove('dragging');
+      dragged = null;
+
+      const order = Array.from(grid.querySelectorAll(':scope > [data-device-id]'))
+        .map(function (card) { return card.dataset.deviceId; });
+      fetch('/order', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/x-www-form-urlencoded' },
+        body: 'order=' + encodeURIComponent(order.join(',')),
+        redirect: 'manual',
+      }).catch(function (err) {
+        console.error('saving order failed', err);
+      });
+    });
+  }
+
+  // Ticks down the permit join countdown and reloads once the network has
+  // closed, to show the button again.
+  function setupPermitJoin() {
+    const countdown = document.querySelector('[data-role="permit-join-countdown"]');
+    if (!countdown) {
+      return;
+    }
+    const end = Date.now() + Number(countdown.dataset.remaining) * 1000;
+    const timer = setInterval(function () {
+      const remaining = Math.ceil((end - Date.now()) / 1000);
+      if (remaining <= 0) {
+        clearInterval(timer);
+        location.reload();
+        return;
+      }
+      countdown.textContent = Math.floor(remaining / 60) + ':' + String(remaining % 60).padStart(2, '0');
+    }, 1000);
   }
 
   document.addEventListener('DOMContentLoaded', function () {
+    setupReordering();
+    setupPermitJoin();
     const source = new EventSource('/events');
     source.onmessage = function (event) {
       try {
@@ -0,0 +1,865 @@
+package z2mhomekit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/kradalby/kra/web"
+	appconfig "github.com/kradalby/z2m-homekit/config"
+	"github.com/kradalby/z2m-homekit/devices"
+	"github.com/kradalby/z2m-homekit/events"
+	"github.com/kradalby/z2m-homekit/metrics"
+	"github.com/kradalby/z2m-homekit/tokens"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/listeners"
+
+	"github.com/brutella/hap"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"tailscale.com/util/eventbus"
+)
+
+// BridgeOptions customises how a Bridge is assembled. The zero value matches
+// the production setup.
+type BridgeOptions struct {
+	// HAPStore persists pairings and keys. Defaults to a filesystem store at
+	// the configured HAP storage path.
+	HAPStore hap.Store
+
+	// Registerer receives the Prometheus metrics. Defaults to the global
+	// registerer.
+	Registerer prometheus.Registerer
+
+	// QRCode is the pairing QR code shown in the web UI.
+	QRCode string
+
+	// DisableWeb skips the web UI listener.
+	DisableWeb bool
+
+	// OnDevicesDiscovered is called when discovery saves a changed device
+	// list that cannot be applied to the running bridge, so the bridge can
+	// be reloaded with it.
+	OnDevicesDiscovered func()
+}
+
+// Bridge wires the embedded MQTT broker, device manager, HomeKit server and
+// web UI together.
+type Bridge struct {
+	cfg           *appconfig.Config
+	devices       []devices.Device
+	smokeResponse *devices.SmokeResponse
+	nightMode     *devices.NightMode
+	groups        []devices.Group
+	schedules     []devices.Schedule
+	location      *devices.Location
+	humidityFans  []devices.HumidityFan
+	scenes        []devices.Scene
+	lightPresets  *devices.LightPresets
+	logger        *slog.Logger
+	opts          BridgeOptions
+
+	eventBus      *events.Bus
+	metrics       *metrics.Collector
+	mqttServer    *mqtt.Server
+	externalMQTT  *ExternalMQTT
+	mqttClient    *eventbus.Client
+	deviceManager *devices.Manager
+	simClock      *devices.SimClock // nil unless time is simulated
+	commandLog    *devices.CommandLog
+	journal       *EventJournal
+	history       *History
+	snapshots     *ConfigSnapshots
+	hapManager    *HAPManager
+	webServer     *WebServer
+
+	// running is set once the bridge can apply device changes.
+	running atomic.Bool
+	// updateMu serialises device changes from discovery and config
+	// reloads.
+	updateMu sync.Mutex
+	// configMu serialises writes to the devices config file.
+	configMu sync.Mutex
+
+	// workers tracks goroutines that publish on the eventbus so Close can
+	// wait for them before closing it.
+	workers sync.WaitGroup
+}
+
+// NewBridge creates a bridge for the given configuration. Nothing is started
+// until Start is called.
+func NewBridge(cfg *appconfig.Config, deviceCfg *devices.Config, logger *slog.Logger, opts BridgeOptions) (*Bridge, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("config is required")
+	}
+	if deviceCfg == nil {
+		return nil, fmt.Errorf("device config is required")
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if opts.HAPStore == nil {
+		opts.HAPStore = hap.NewFsStore(cfg.HAPStoragePath)
+	}
+
+	return &Bridge{
+		cfg:           cfg,
+		devices:       deviceCfg.Devices,
+		smokeResponse: deviceCfg.SmokeResponse,
+		nightMode:     deviceCfg.NightMode,
+		groups:        deviceCfg.Groups,
+		schedules:     deviceCfg.Schedules,
+		location:      deviceCfg.Location,
+		humidityFans:  deviceCfg.HumidityFans,
+		scenes:        deviceCfg.Scenes,
+		lightPresets:  deviceCfg.LightPresets,
+		logger:        logger,
+		opts:          opts,
+	}, nil
+}
+
+// Start brings up all components. They run until ctx is cancelled; call
+// Close afterwards to release resources.
+func (b *Bridge) Start(ctx context.Context) error {
+	cfg := b.cfg
+	logger := b.logger
+
+	eventBus, err := events.New(logger)
+	if err != nil {
+		return fmt.Errorf("failed to initialize eventbus: %w", err)
+	}
+	b.eventBus = eventBus
+	eventBus.SetStateTTL(cfg.StateDedupTTL)
+	eventBus.SetLivenessEvents(cfg.LivenessEvents)
+	eventBus.OnConnectionStatus(lifecycle.ObserveStatus)
+
+	// Initialize metrics collector
+	metricsExclude, err := metrics.ParseExclude(cfg.MetricsExclude)
+	if err != nil {
+		return err
+	}
+	metricsCollector, err := metrics.NewCollectorWithOptions(ctx, logger, eventBus, b.opts.Registerer, metrics.Options{
+		DropName: !cfg.MetricsNameLabel,
+		HashIDs:  cfg.MetricsHashIDs,
+		Exclude:  metricsExclude,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize metrics collector: %w", err)
+	}
+	b.metrics = metricsCollector
+
+	info := buildInfo()
+	metrics.RegisterBuildInfo(b.opts.Registerer, info.Version, info.Commit, info.BuildDate, info.GoVersion)
+
+	commands := make(chan devices.CommandEvent, 10)
+
+	localIP, err := getLocalIP()
+	if err != nil {
+		logger.Warn("Failed to get local IP, using localhost", "error", err)
+		localIP = "localhost"
+	}
+	logger.Info("Local IP address", "ip", localIP)
+
+	// Create the embedded MQTT server, or a client for an external broker
+	var publisher devices.Publisher
+	var mqttServer *mqtt.Server
+	var externalMQTT *ExternalMQTT
+	if cfg.MQTTBroker != "" {
+		externalMQTT = NewExternalMQTT(ExternalMQTTOptions{
+			Addr:      cfg.MQTTBroker,
+			ClientID:  cfg.MQTTClientID,
+			Username:  cfg.MQTTUsername,
+			Password:  cfg.MQTTPassword,
+			Keepalive: cfg.MQTTKeepalive,
+		}, logger)
+		b.externalMQTT = externalMQTT
+		publisher = externalMQTT
+		if cfg.MQTTAllowCIDRs != "" || cfg.MQTTAllowClientIDs != "" {
+			logger.Warn("MQTT allowlist only applies to the embedded broker, ignoring it")
+		}
+	} else {
+		allowCIDRs, err := ParseAllowCIDRs(cfg.MQTTAllowCIDRs)
+		if err != nil {
+			return err
+		}
+		mqttServer, err = newEmbeddedBroker(BrokerOptions{
+			MaxClients:     cfg.MQTTMaxClients,
+			MaxInflight:    cfg.MQTTMaxInflight,
+			ReceiveMaximum: cfg.MQTTReceiveMaximum,
+			MaxPacketSize:  cfg.MQTTMaxPacketSize,
+			Keepalive:      cfg.MQTTServerKeepalive,
+			SysInterval:    cfg.MQTTSysInterval,
+			AllowCIDRs:     allowCIDRs,
+			AllowClientIDs: ParseAllowClientIDs(cfg.MQTTAllowClientIDs),
+		}, logger)
+		if err != nil {
+			return err
+		}
+		b.mqttServer = mqttServer
+		publisher = mqttServer
+	}
+
+	// Create device manager
+	deviceManager, err := devices.NewManager(b.devices, commands, eventBus, publisher, logger)
+	if err != nil {
+		return fmt.Errorf("failed to initialize device manager: %w", err)
+	}
+	b.deviceManager = deviceManager
+	if cfg.SimulateTime {
+		b.simClock = devices.NewSimClock()
+		deviceManager.SetClock(b.simClock)
+		logger.Warn("Time is simulated, move it with /debug/clock")
+	}
+
+	if cfg.CommandLogPath != "" {
+		commandLog, err := devices.OpenCommandLog(cfg.CommandLogPath)
+		if err != nil {
+			return err
+		}
+		b.commandLog = commandLog
+		deviceManager.SetCommandLog(commandLog)
+	}
+
+	if cfg.ScenesPath != "" {
+		if err := deviceManager.SetSceneFile(cfg.ScenesPath); err != nil {
+			return err
+		}
+	}
+	if cfg.DisabledPath != "" {
+		if err := deviceManager.SetDisabledFile(cfg.DisabledPath); err != nil {
+			return err
+		}
+	}
+
+	// Add MQTT hook for message processing
+	mqttClient, err := eventBus.Client(events.ClientMQTT)
+	if err != nil {
+		return fmt.Errorf("failed to get MQTT client: %w", err)
+	}
+	b.mqttClient = mqttClient
+	if cfg.EventJournalPath != "" {
+		journal, err := OpenEventJournal(cfg.EventJournalPath)
+		if err != nil {
+			return err
+		}
+		b.journal = journal
+	}
+	mqttHook := &MQTTHook{
+		statePublisher: eventbus.Publish[devices.StateChangedEvent](mqttClient),
+		deviceManager:  deviceManager,
+		clock:          deviceManager,
+		journal:        b.journal,
+		timings:        metricsCollector,
+		slowMessage:    cfg.MQTTSlowMessage,
+		maxPayload:     cfg.MQTTMaxPayload,
+		logger:         logger,
+	}
+	if cfg.Discovery {
+		known, err := devices.LoadDiscovered(cfg.DiscoveryPath)
+		if err != nil {
+			logger.Warn("Failed to load discovered devices", "error", err)
+		}
+		mqttHook.discovery = NewDeviceDiscovery(cfg.DiscoveryPath, known, b.applyDiscovered, logger)
+	}
+	mqttSupervisor := newSupervisor(string(events.ClientMQTT), eventBus, mqttClient, logger)
+	mqttSupervisor.connecting()
+
+	if externalMQTT != nil {
+		b.workers.Add(1)
+		go func() {
+			defer b.workers.Done()
+			logger.Info("Connecting to external MQTT broker", "addr", cfg.MQTTBroker)
+			mqttSupervisor.serve(ctx, func(ctx context.Context) error {
+				return externalMQTT.Run(ctx, mqttHook.HandleMessage, mqttSupervisor.up)
+			})
+		}()
+	} else {
+		if err := mqttServer.AddHook(mqttHook, nil); err != nil {
+			return fmt.Errorf("failed to add MQTT message hook: %w", err)
+		}
+
+		tcp := listeners.NewTCP(listeners.Config{
+			ID:      "tcp",
+			Address: cfg.MQTTAddrPort().String(),
+		})
+		if err := mqttServer.AddListener(tcp); err != nil {
+			return fmt.Errorf("failed to add MQTT listener: %w", err)
+		}
+
+		b.workers.Add(1)
+		go func() {
+			defer b.workers.Done()
+			logger.Info("Starting MQTT broker", "addr", cfg.MQTTAddrPort().String())
+			mqttSupervisor.serve(ctx, func(ctx context.Context) error {
+				// Serve starts the listeners in the background and returns.
+				if err := mqttServer.Serve(); err != nil {
+					return err
+				}
+				mqttSupervisor.up()
+				<-ctx.Done()
+				return nil
+			})
+		}()
+
+		logger.Info("MQTT broker started", "addr", cfg.MQTTAddrPort().String())
+	}
+
+	deviceManager.SetLinkQualityAlert(cfg.LinkQualityAlertThreshold, cfg.LinkQualityAlertDuration)
+	deviceManager.SetSmokeResponse(b.smokeResponse)
+	deviceManager.SetAlertSilence(cfg.AlertSilence)
+	deviceManager.SetNightModeConfig(b.nightMode)
+	deviceManager.SetGroups(b.groups)
+	deviceManager.SetSchedules(b.schedules, b.location)
+	deviceManager.SetHumidityFans(b.humidityFans)
+	deviceManager.SetScenes(b.scenes)
+	deviceManager.SetLightPresets(b.lightPresets)
+
+	if err := metricsCollector.SetHealthSource(func() []metrics.HealthSample {
+		var samples []metrics.HealthSample
+		for id, item := range deviceManager.Snapshot() {
+			samples = append(samples, metrics.HealthSample{
+				DeviceID: id,
+				Name:     item.Device.Name,
+				Score:    item.State.Health.Score,
+			})
+		}
+		return samples
+	}); err != nil {
+		return err
+	}
+
+	if err := metricsCollector.SetLifecycleSource(func() metrics.LifecycleSample {
+		sample := metrics.LifecycleSample{
+			StartTime:         processStart,
+			ComponentRestarts: lifecycle.ComponentRestarts(),
+		}
+		if prev := lifecycle.PreviousShutdown(); prev != nil {
+			sample.LastShutdown = prev.Reason
+		}
+		return sample
+	}); err != nil {
+		return err
+	}
+
+	go deviceManager.ProcessCommands(ctx)
+	go deviceManager.ProcessStateEvents(ctx)
+	go deviceManager.RunNightMode(ctx)
+	go deviceManager.RunSchedules(ctx)
+	go deviceManager.ReplayCommandLog(ctx)
+
+	if cfg.HistoryDir != "" {
+		history, err := NewHistory(cfg.HistoryDir, cfg.HistoryRetention, eventBus, logger)
+		if err != nil {
+			return err
+		}
+		b.history = history
+		go history.Run(ctx)
+	}
+
+	if cfg.ConfigSnapshotsDir != "" {
+		snapshots, err := OpenConfigSnapshots(cfg.ConfigSnapshotsDir, cfg.ConfigSnapshotsKeep)
+		if err != nil {
+			return err
+		}
+		b.snapshots = snapshots
+		b.saveConfigSnapshot("startup", fmt.Sprintf("%d devices", len(b.devices)))
+	}
+
+	if cfg.StateMirror {
+		mirror, err := NewStateMirror(eventBus, publisher, logger)
+		if err != nil {
+			return err
+		}
+		go mirror.Run(ctx)
+	}
+	if cfg.MQTTSysInterval > 0 {
+		go NewBridgeInfoPublisher(publisher, deviceManager.DeviceCount, cfg.MQTTSysInterval, logger).Run(ctx)
+	}
+
+	// Create HAP manager
+	hapManager := NewHAPManager(b.devices, cfg.BridgeName, commands, deviceManager, eventBus, logger)
+	hapManager.SetWriteMetrics(metricsCollector)
+	hapManager.SetCommandLimit(cfg.HAPCommandInterval, cfg.HAPCommandBurst)
+	hapManager.Start(ctx)
+	b.hapManager = hapManager
+
+	hapManager.SetStore(b.opts.HAPStore)
+	serial := cfg.BridgeSerial
+	if serial == "" {
+		serial, err = storeSerial(b.opts.HAPStore)
+		if err != nil {
+			return err
+		}
+	}
+	hapManager.SetBridgeInfo(BridgeInfo{
+		Manufacturer: cfg.BridgeManufacturer,
+		Model:        cfg.BridgeModel,
+		SerialNumber: serial,
+	})
+	hapServer, err := b.newHAPServer()
+	if err != nil {
+		return err
+	}
+	b.running.Store(true)
+
+	if cfg.DevicesReloadInterval > 0 {
+		watcher, err := NewConfigWatcher(cfg.DevicesConfigPath, cfg.DevicesReloadInterval, b.reloadDevices, eventBus, logger)
+		if err != nil {
+			return fmt.Errorf("failed to watch devices config: %w", err)
+		}
+		b.workers.Add(1)
+		go func() {
+			defer b.workers.Done()
+			watcher.Run(ctx)
+		}()
+	}
+
+	hapStatusClient, err := eventBus.Client(events.ClientHAP)
+	if err != nil {
+		return fmt.Errorf("failed to get HAP client: %w", err)
+	}
+	hapSupervisor := newSupervisor(string(events.ClientHAP), eventBus, hapStatusClient, logger)
+	hapSupervisor.connecting()
+
+	b.workers.Add(1)
+	go func() {
+		defer b.workers.Done()
+		logger.Info("Starting HomeKit server",
+			"addr", cfg.HAPAddrPort().String(),
+			"pin", cfg.HAPPin,
+		)
+		hapSupervisor.serve(ctx, func(ctx context.Context) error {
+			// ListenAndServe gives no signal once it is listening and
+			// takes no listener, so check the port up front.
+			ln, err := net.Listen("tcp", hapServer.Addr)
+			if err != nil {
+				return err
+			}
+			ln.Close()
+			hapSupervisor.up()
+			return b.serveHAP(ctx, hapServer)
+		})
+	}()
+
+	if b.opts.DisableWeb {
+		return nil
+	}
+
+	return b.startWeb(ctx)
+}
+
+// newHAPServer creates a HAP server for the current accessories.
+func (b *Bridge) newHAPServer() (*hap.Server, error) {
+	accessories := b.hapManager.GetAccessories()
+	hapServer, err := hap.NewServer(
+		b.opts.HAPStore,
+		accessories[0],
+		accessories[1:]...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HAP server: %w", err)
+	}
+
+	hapServer.Pin = b.cfg.HAPPin
+	hapServer.Addr = b.cfg.HAPAddrPort().String()
+	b.hapManager.SetServer(hapServer)
+	return hapServer, nil
+}
+
+// serveHAP runs server until ctx is cancelled. When the accessories
+// change it is replaced by a server for the new ones, which announces
+// the change to paired controllers.
+func (b *Bridge) serveHAP(ctx context.Context, server *hap.Server) error {
+	for {
+		serveCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() { done <- server.ListenAndServe(serveCtx) }()
+
+		select {
+		case err := <-done:
+			cancel()
+			return err
+		case <-b.hapManager.AccessoriesChanged():
+			cancel()
+			<-done
+		}
+
+		b.logger.Info("Restarting HomeKit server with changed accessories")
+		next, err := b.newHAPServer()
+		if err != nil {
+			return err
+		}
+		server = next
+	}
+}
+
+// UpdateDevices applies a changed device list while the bridge runs:
+// devices are added to and removed from the device manager, and the HAP
+// server is restarted if the accessories changed. It reports what
+// changed.
+func (b *Bridge) UpdateDevices(configs []devices.Device) devices.DeviceChanges {
+	b.updateMu.Lock()
+	defer b.updateMu.Unlock()
+
+	changes := b.deviceManager.SetDevices(configs)
+	if !changes.Empty() {
+		b.logger.Info("Devices changed",
+			"added", changes.Added,
+			"removed", changes.Removed,
+			"renamed", changes.Renamed,
+			"updated", changes.Updated,
+		)
+	}
+	b.hapManager.SetDevices(configs)
+	b.devices = configs
+	return changes
+}
+
+// applyDiscovered applies a changed list of discovered devices. Until the
+// bridge is running, or if the device config no longer loads with them,
+// OnDevicesDiscovered is asked to reload the bridge instead.
+func (b *Bridge) applyDiscovered() {
+	if b.running.Load() {
+		_, err := b.reloadDevices()
+		if err == nil {
+			return
+		}
+		b.logger.Warn("Failed to apply discovered devices", "error", err)
+	}
+	if b.opts.OnDevicesDiscovered != nil {
+		b.opts.OnDevicesDiscovered()
+	}
+}
+
+// reloadDevices loads the device config, with the discovered devices when
+// discovery is enabled, and applies its devices and groups. Night mode and
+// the smoke response are only read at startup.
+func (b *Bridge) reloadDevices() (devices.DeviceChanges, error) {
+	return b.reloadDevicesBy("file")
+}
+
+// reloadDevicesBy is reloadDevices, saving a snapshot of the applied
+// config as applied by source.
+func (b *Bridge) reloadDevicesBy(source string) (devices.DeviceChanges, error) {
+	var deviceCfg *devices.Config
+	if b.cfg.Discovery {
+		discovered, err := devices.LoadDiscovered(b.cfg.DiscoveryPath)
+		if err != nil {
+			return devices.DeviceChanges{}, err
+		}
+		deviceCfg, err = devices.LoadConfigWithDiscovered(b.cfg.DevicesConfigPath, discovered)
+		if err != nil {
+			return devices.DeviceChanges{}, err
+		}
+	} else {
+		var err error
+		deviceCfg, err = devices.LoadConfig(b.cfg.DevicesConfigPath)
+		if err != nil {
+			return devices.DeviceChanges{}, err
+		}
+	}
+
+	if !reflect.DeepEqual(deviceCfg.NightMode, b.nightMode) || !reflect.DeepEqual(deviceCfg.SmokeResponse, b.smokeResponse) {
+		b.logger.Warn("Night mode and smoke response changes apply on restart", "path", b.cfg.DevicesConfigPath)
+	}
+	b.deviceManager.SetGroups(deviceCfg.Groups)
+	b.deviceManager.SetSchedules(deviceCfg.Schedules, deviceCfg.Location)
+	b.deviceManager.SetHumidityFans(deviceCfg.HumidityFans)
+	b.deviceManager.SetScenes(deviceCfg.Scenes)
+	b.deviceManager.SetLightPresets(deviceCfg.LightPresets)
+	changes := b.UpdateDevices(deviceCfg.Devices)
+	b.saveConfigSnapshot(source, changes.String())
+	return changes, nil
+}
+
+// saveConfigSnapshot saves the devices config file as a snapshot, if
+// snapshots are enabled and it changed.
+func (b *Bridge) saveConfigSnapshot(source, changes string) {
+	if b.snapshots == nil {
+		return
+	}
+	data, err := os.ReadFile(b.cfg.DevicesConfigPath)
+	if err != nil {
+		b.logger.Warn("Failed to read devices config for a snapshot", "path", b.cfg.DevicesConfigPath, "error", err)
+		return
+	}
+	if _, err := b.snapshots.Save(data, source, changes); err != nil {
+		b.logger.Warn("Failed to save config snapshot", "error", err)
+	}
+}
+
+// RollbackConfig writes the config snapshot with id back to the devices
+// config file and applies it.
+func (b *Bridge) RollbackConfig(id string) (devices.DeviceChanges, error) {
+	if b.snapshots == nil {
+		return devices.DeviceChanges{}, ErrSnapshotNotFound
+	}
+	snapshot, _, err := b.snapshots.Get(id)
+	if err != nil {
+		return devices.DeviceChanges{}, err
+	}
+
+	b.configMu.Lock()
+	defer b.configMu.Unlock()
+	path := b.cfg.DevicesConfigPath
+	if err := writeDevicesConfig(path, []byte(snapshot.Config)); err != nil {
+		return devices.DeviceChanges{}, err
+	}
+	b.logger.Info("Rolled back devices config", "path", path, "snapshot", id)
+	return b.reloadDevicesBy("rollback to " + id)
+}
+
+// registerWebRoutes registers the web UI and API routes of webServer on
+// registrar, which is the web server itself outside of tests. Routes of
+// the JSON API must be listed in apiRoutes.
+func (b *Bridge) registerWebRoutes(webServer *WebServer, registrar interface{ Handle(string, http.Handler) }) {
+	// Every route but the exempt ones goes through the web auth.
+	mux := authMux{mux: registrar, ws: webServer}
+	mux.Handle("/", http.HandlerFunc(webServer.HandleIndex))
+	mux.Handle("/toggle/", http.HandlerFunc(webServer.HandleToggle))
+	mux.Handle("/brightness/", http.HandlerFunc(webServer.HandleBrightness))
+	mux.Handle("/position/", http.HandlerFunc(webServer.HandlePosition))
+	mux.Handle("/arm/", http.HandlerFunc(webServer.HandleArm))
+	mux.Handle("/siren/", http.HandlerFunc(webServer.HandleSiren))
+	mux.Handle("/dim/", http.HandlerFunc(webServer.HandleDim))
+	mux.Handle("/leak/ack/", http.HandlerFunc(webServer.HandleLeakAck))
+	mux.Handle("/api/v1/leak/ack/", webServer.requireScope(tokens.ScopeControl, webServer.HandleLeakAck))
+	mux.Handle("/smoke/drill", http.HandlerFunc(webServer.HandleSmokeDrill))
+	mux.Handle("/alert/ack/", http.HandlerFunc(webServer.HandleAlertAck))
+	mux.Handle("/testfire/", http.HandlerFunc(webServer.HandleTestFire))
+	mux.Handle("/api/v1/testfire/", webServer.requireScope(tokens.ScopeControl, webServer.HandleTestFire))
+	mux.Handle("/calibrate/", http.HandlerFunc(webServer.HandleCoverCalibration))
+	mux.Handle("/api/v1/calibrate/", webServer.requireScope(tokens.ScopeControl, webServer.HandleCoverCalibration))
+	mux.Handle("/disable/", http.HandlerFunc(webServer.HandleDeviceDisable))
+	mux.Handle("/api/v1/disable/", webServer.requireScope(tokens.ScopeControl, webServer.HandleDeviceDisable))
+	mux.Handle("/ota/", http.HandlerFunc(webServer.HandleFirmwareUpdate))
+	mux.Handle("/api/v1/ota/", webServer.requireScope(tokens.ScopeControl, webServer.HandleFirmwareUpdate))
+	mux.Handle("/nightmode", http.HandlerFunc(webServer.HandleNightMode))
+	mux.Handle("/guest", http.HandlerFunc(webServer.HandleGuest))
+	mux.Handle("/all", http.HandlerFunc(webServer.HandleAll))
+	mux.Handle("/device/", http.HandlerFunc(webServer.HandleDevice))
+	mux.Handle("/kiosk", http.HandlerFunc(webServer.HandleKiosk))
+	mux.Handle("/widgets", http.HandlerFunc(webServer.HandleWidgets))
+	mux.Handle("/group/toggle/", http.HandlerFunc(webServer.HandleGroupToggle))
+	mux.Handle("/scenes", http.HandlerFunc(webServer.HandleScenes))
+	mux.Handle("/inventory", http.HandlerFunc(webServer.HandleInventory))
+	mux.Handle("/config/snapshots", http.HandlerFunc(webServer.HandleConfigSnapshots))
+	mux.Handle("/config/snapshots/", http.HandlerFunc(webServer.HandleConfigSnapshots))
+	mux.Handle("/scenes/recall/", http.HandlerFunc(webServer.HandleSceneRecall))
+	mux.Handle("/scenes/delete/", http.HandlerFunc(webServer.HandleSceneDelete))
+	mux.Handle("/order", http.HandlerFunc(webServer.HandleOrder))
+	mux.Handle("/guest/control/", http.HandlerFunc(webServer.HandleGuestControl))
+	mux.Handle("/api/v1/nightmode", webServer.requireScope(tokens.ScopeControl, webServer.HandleNightMode))
+	mux.Handle("/permitjoin", http.HandlerFunc(webServer.HandlePermitJoin))
+	mux.Handle("/api/v1/permitjoin", webServer.requireScope(tokens.ScopeControl, webServer.HandlePermitJoin))
+	mux.Handle("/api/v1/alert/ack/", webServer.requireScope(tokens.ScopeControl, webServer.HandleAlertAck))
+	mux.Handle("/api/v1/smoke/drill", webServer.requireScope(tokens.ScopeControl, webServer.HandleSmokeDrill))
+	mux.Handle("/events", http.HandlerFunc(webServer.HandleSSE))
+	mux.Handle("/ws", webServer.requireSessionOrScope(tokens.ScopeControl, webServer.HandleWebSocket))
+	mux.Handle("/health", http.HandlerFunc(webServer.HandleHealth))
+	mux.Handle("/api/v1/status", webServer.requireScope(tokens.ScopeRead, webServer.HandleStatus))
+	mux.Handle("/api/v1/devices", webServer.requireScope(tokens.ScopeRead, webServer.HandleDevicesAPI))
+	mux.Handle("/api/v1/devices/", webServer.deviceAPI())
+	mux.Handle("/api/v1/events/replay", webServer.requireScope(tokens.ScopeRead, webServer.HandleEventReplay))
+	mux.Handle("/api/v1/history", webServer.requireScope(tokens.ScopeRead, webServer.HandleHistory))
+	mux.Handle("/api/v1/scenes", webServer.requireScope(tokens.ScopeRead, webServer.HandleScenesAPI))
+	mux.Handle("/api/v1/inventory", webServer.requireScope(tokens.ScopeRead, webServer.HandleInventoryAPI))
+	mux.Handle("/api/v1/scenes/", webServer.requireScope(tokens.ScopeControl, webServer.HandleSceneRecallAPI))
+	mux.Handle("/api/v1/config/apply", webServer.requireScope(tokens.ScopeAdmin, webServer.HandleConfigApply))
+	mux.Handle("/api/v1/capabilities", webServer.requireScope(tokens.ScopeRead, webServer.HandleCapabilities))
+	mux.Handle("/api/v1/openapi.json", webServer.requireScope(tokens.ScopeRead, webServer.HandleOpenAPI))
+	mux.Handle("/api/docs", http.HandlerFunc(webServer.HandleAPIDocs))
+	mux.Handle("/tokens", http.HandlerFunc(webServer.HandleTokens))
+	mux.Handle("/tokens/revoke/", http.HandlerFunc(webServer.HandleTokenRevoke))
+	mux.Handle("/qrcode", http.HandlerFunc(webServer.HandleQRCode))
+	mux.Handle("/debug/eventbus", http.HandlerFunc(webServer.HandleEventBusDebug))
+	mux.Handle("/debug/mqtt", mqttDebugHandler(b.mqttServer, b.externalMQTT, b.cfg.MQTTServerKeepalive))
+	mux.Handle("/metrics/alert-rules", http.HandlerFunc(webServer.HandleAlertRules))
+
+	// Setup debug handlers
+	SetupDebugHandlers(mux, b.hapManager)
+	if b.simClock != nil {
+		mux.Handle("/debug/clock", clockDebugHandler(b.simClock, b.deviceManager))
+	}
+}
+
+func (b *Bridge) startWeb(ctx context.Context) error {
+	cfg := b.cfg
+
+	kraOpts := []web.Option{
+		web.WithStdLogger(log.New(os.Stdout, "kraweb: ", log.LstdFlags)),
+		web.WithLogger(b.logger),
+		web.WithTailscaleStateDir(cfg.TailscaleStateDir),
+	}
+
+	enableTailscale := cfg.TailscaleAuthKey != ""
+	kraConfig := web.ServerConfig{
+		Hostname: cfg.TailscaleHostname,
+		// The web server binds the local address itself; kraweb, which
+		// only serves Tailscale for it, gets a throwaway loopback port
+		// with nothing registered on it.
+		LocalAddr:       "127.0.0.1:0",
+		AuthKey:         cfg.TailscaleAuthKey,
+		EnableTailscale: enableTailscale,
+	}
+
+	kraWeb, err := web.NewServer(kraConfig, kraOpts...)
+	if err != nil {
+		return fmt.Errorf("failed to configure web server: %w", err)
+	}
+
+	webServer := NewWebServer(b.logger, b.deviceManager, b.deviceManager, b.eventBus, kraWeb, cfg.WebAddrPort().String(), cfg.HAPPin, b.opts.QRCode, b.hapManager)
+	webServer.SetMQTTServer(b.mqttServer)
+
+	tokenStore, err := tokens.Open(cfg.TokensPath)
+	if err != nil {
+		return fmt.Errorf("failed to open token store: %w", err)
+	}
+	webServer.SetTokenStore(tokenStore)
+	webServer.SetWebAuth(WebAuth{
+		Mode:     cfg.WebAuth,
+		Username: cfg.WebUsername,
+		Password: cfg.WebPassword,
+		Users:    ParseWebUsers(cfg.WebTailscaleUsers),
+		WhoIs: func(ctx context.Context, remoteAddr string) (string, error) {
+			// The tsnet node only exists once the web server is up.
+			lc := kraWeb.TailscaleLocalClient()
+			if lc == nil {
+				return "", errors.New("tailscale is not running")
+			}
+			who, err := lc.WhoIs(ctx, remoteAddr)
+			if err != nil {
+				return "", err
+			}
+			return who.UserProfile.LoginName, nil
+		},
+	})
+	if b.journal != nil {
+		webServer.SetEventJournal(b.journal)
+	}
+	if b.history != nil {
+		webServer.SetHistory(b.history)
+	}
+	if b.snapshots != nil {
+		webServer.SetConfigSnapshots(b.snapshots, b.RollbackConfig)
+	}
+	webServer.SetConfigApplier(b.ApplyConfig)
+	webServer.SetInventory(b.deviceManager.Inventory)
+	if err := webServer.SetDashboardWidgets(cfg.DashboardWidgets); err != nil {
+		return err
+	}
+	webServer.LogEvent("Server starting...")
+	b.deviceManager.OnFirmwareUpdate(webServer.LogFirmwareUpdate)
+	b.deviceManager.OnDeviceJoined(webServer.LogDeviceJoined)
+
+	b.registerWebRoutes(webServer, webServer)
+	webServer.handleMetrics(promhttp.Handler(), cfg.MetricsPublic)
+
+	if b.simClock != nil {
+		webServer.SetClock(b.simClock)
+	}
+	b.webServer = webServer
+	webServer.SetTailscale(enableTailscale)
+	if err := webServer.Start(ctx); err != nil {
+		return err
+	}
+
+	// The tsnet node is started by the web server, so watch it only once
+	// that is up.
+	if enableTailscale {
+		if lc := kraWeb.TailscaleLocalClient(); lc != nil {
+			webClient, err := b.eventBus.Client(events.ClientWeb)
+			if err != nil {
+				return fmt.Errorf("failed to get web client: %w", err)
+			}
+			tsSupervisor := newSupervisor(tailscaleComponent, b.eventBus, webClient, b.logger)
+			b.workers.Add(1)
+			go func() {
+				defer b.workers.Done()
+				watchTailscale(ctx, tsSupervisor, func(ctx context.Context) (string, error) {
+					st, err := lc.StatusWithoutPeers(ctx)
+					if err != nil {
+						return "", err
+					}
+					return st.BackendState, nil
+				})
+			}()
+		}
+	}
+
+	webURL := fmt.Sprintf("http://%s", cfg.WebAddrPort().String())
+	if enableTailscale {
+		webURL = fmt.Sprintf("https://%s (and http://%s)", cfg.TailscaleHostname, cfg.WebAddrPort().String())
+	}
+	b.logger.Info("Web UI available", "url", webURL)
+
+	return nil
+}
+
+// Close stops the MQTT broker and releases subscriptions. The context passed
+// to Start should be cancelled first.
+func (b *Bridge) Close() {
+	if b.webServer != nil {
+		b.logger.Info("Stopping web server...")
+		b.webServer.Close()
+	}
+	if b.hapManager != nil {
+		b.hapManager.Close()
+	}
+	if b.mqttServer != nil {
+		b.logger.Info("Stopping MQTT broker...")
+		if err := b.mqttServer.Close(); err != nil {
+			b.logger.Error("Error stopping MQTT broker", "error", err)
+		}
+	}
+	b.workers.Wait()
+	if b.commandLog != nil {
+		if err := b.commandLog.Close(); err != nil {
+			b.logger.Warn("Error closing command log", "error", err)
+		}
+	}
+	if b.journal != nil {
+		if err := b.journal.Close(); err != nil {
+			b.logger.Warn("Error closing event journal", "error", err)
+		}
+	}
+	if b.history != nil {
+		if err := b.history.Close(); err != nil {
+			b.logger.Warn("Error closing history", "error", err)
+		}
+	}
+	if b.metrics != nil {
+		b.metrics.Close()
+	}
+	if b.eventBus != nil {
+		if err := b.eventBus.Close(); err != nil {
+			b.logger.Warn("Error closing eventbus", "error", err)
+		}
+	}
+}
+
+// MQTTServer returns the embedded broker. It is nil until Start is called,
+// and when connected to an external broker.
+func (b *Bridge) MQTTServer() *mqtt.Server {
+	return b.mqttServer
+}
+
+// DeviceManager returns the device manager. It is nil until Start is called.
+func (b *Bridge) DeviceManager() *devices.Manager {
+	return b.deviceManager
+}
+
+// HAPManager returns the HomeKit accessory manager. It is nil until Start is
+// called.
+func (b *Bridge) HAPManager() *HAPManager {
+	return b.hapManager
+}
@@ -0,0 +1,83 @@
+package z2mhomekit
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+// BridgeInfoTopic is the retained topic the bridge describes itself on, so
+// monitoring can watch the bridge over MQTT instead of scraping HTTP.
+const BridgeInfoTopic = "z2m-homekit/bridge/info"
+
+// BridgeInfoMessage is the payload of BridgeInfoTopic.
+type BridgeInfoMessage struct {
+	Version       string    `json:"version"`
+	Commit        string    `json:"commit"`
+	Devices       int       `json:"devices"`
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// BridgeInfoPublisher publishes BridgeInfoMessage on an interval.
+type BridgeInfoPublisher struct {
+	server   devices.Publisher
+	devices  func() int
+	build    BuildInfo
+	interval time.Duration
+	logger   *slog.Logger
+}
+
+// NewBridgeInfoPublisher creates a publisher reporting the device count
+// returned by deviceCount every interval.
+func NewBridgeInfoPublisher(server devices.Publisher, deviceCount func() int, interval time.Duration, logger *slog.Logger) *BridgeInfoPublisher {
+	return &BridgeInfoPublisher{
+		server:   server,
+		devices:  deviceCount,
+		build:    buildInfo(),
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run publishes at once and then every interval until ctx is cancelled.
+func (p *BridgeInfoPublisher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.publish(time.Now())
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *BridgeInfoPublisher) message(now time.Time) BridgeInfoMessage {
+	return BridgeInfoMessage{
+		Version:       p.build.Version,
+		Commit:        p.build.Commit,
+		Devices:       p.devices(),
+		StartedAt:     processStart,
+		UptimeSeconds: int64(now.Sub(processStart).Seconds()),
+		Timestamp:     now,
+	}
+}
+
+func (p *BridgeInfoPublisher) publish(now time.Time) {
+	data, err := json.Marshal(p.message(now))
+	if err != nil {
+		p.logger.Error("Failed to marshal bridge info", "error", err)
+		return
+	}
+
+	if err := p.server.Publish(BridgeInfoTopic, data, true, 0); err != nil {
+		p.logger.Warn("Failed to publish bridge info", "error", err)
+	}
+}
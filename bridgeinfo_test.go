@@ -0,0 +1,68 @@
+package z2mhomekit
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+func TestBridgeInfoPublisher(t *testing.T) {
+	logger := testLogger()
+	server, err := newEmbeddedBroker(BrokerOptions{SysInterval: time.Second}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = server.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go NewBridgeInfoPublisher(server, func() int { return 3 }, time.Minute, logger).Run(ctx)
+
+	info := make(chan packets.Packet, 1)
+	if err := server.Subscribe(BridgeInfoTopic, 1, func(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+		select {
+		case info <- pk:
+		default:
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sys := make(chan packets.Packet, 1)
+	if err := server.Subscribe("$SYS/broker/uptime", 2, func(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+		select {
+		case sys <- pk:
+		default:
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case pk := <-info:
+		if !pk.FixedHeader.Retain {
+			t.Error("bridge info should be retained")
+		}
+		var got BridgeInfoMessage
+		if err := json.Unmarshal(pk.Payload, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Devices != 3 || got.Version == "" || got.StartedAt.IsZero() {
+			t.Errorf("bridge info = %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("bridge info was not published")
+	}
+
+	select {
+	case <-sys:
+	case <-time.After(3 * time.Second):
+		t.Fatal("$SYS statistics were not published")
+	}
+}
@@ -0,0 +1,272 @@
+package z2mhomekit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/mochi-mqtt/server/v2/system"
+)
+
+// BrokerOptions are the limits of the embedded MQTT broker. mochi-mqtt's
+// defaults suit a general purpose broker; the bridge serves zigbee2mqtt
+// and a few tools, often on a Raspberry Pi. Zero fields keep mochi-mqtt's
+// defaults.
+type BrokerOptions struct {
+	MaxClients     int
+	MaxInflight    int // QoS 1 and 2 messages stored per client
+	ReceiveMaximum int // concurrent QoS 1 and 2 messages per client
+	MaxPacketSize  int // bytes, 0 for no limit
+
+	// Keepalive overrides the keepalive clients ask for; 0 keeps theirs.
+	Keepalive time.Duration
+
+	// SysInterval is how often $SYS statistics are published, rounded
+	// down to whole seconds.
+	SysInterval time.Duration
+
+	// AllowCIDRs and AllowClientIDs restrict which clients may connect,
+	// as defence in depth where MQTT credentials are not practical. A
+	// client must match both lists when both are set; empty lists allow
+	// anyone.
+	AllowCIDRs     []netip.Prefix
+	AllowClientIDs []string
+}
+
+// newEmbeddedBroker creates the embedded broker with opts applied.
+func newEmbeddedBroker(opts BrokerOptions, logger *slog.Logger) (*mqtt.Server, error) {
+	caps := mqtt.NewDefaultServerCapabilities()
+	if opts.MaxClients > 0 {
+		caps.MaximumClients = int64(opts.MaxClients)
+	}
+	if opts.MaxInflight > 0 {
+		caps.MaximumInflight = uint16(opts.MaxInflight)
+	}
+	if opts.ReceiveMaximum > 0 {
+		caps.ReceiveMaximum = uint16(opts.ReceiveMaximum)
+	}
+	caps.MaximumPacketSize = uint32(opts.MaxPacketSize)
+
+	server := mqtt.New(&mqtt.Options{
+		InlineClient:           true,
+		Capabilities:           caps,
+		SysTopicResendInterval: int64(opts.SysInterval / time.Second),
+	})
+
+	var authHook mqtt.Hook = new(auth.AllowHook)
+	if len(opts.AllowCIDRs) > 0 || len(opts.AllowClientIDs) > 0 {
+		authHook = &allowlistHook{
+			cidrs:     opts.AllowCIDRs,
+			clientIDs: opts.AllowClientIDs,
+			logger:    logger,
+		}
+	}
+	if err := server.AddHook(authHook, nil); err != nil {
+		return nil, fmt.Errorf("failed to add MQTT auth hook: %w", err)
+	}
+
+	if opts.Keepalive > 0 {
+		hook := &keepaliveHook{keepalive: uint16(opts.Keepalive / time.Second)}
+		if err := server.AddHook(hook, nil); err != nil {
+			return nil, fmt.Errorf("failed to add MQTT keepalive hook: %w", err)
+		}
+	}
+	return server, nil
+}
+
+// ParseAllowCIDRs parses a comma separated list of CIDRs. A bare address
+// allows that address alone.
+func ParseAllowCIDRs(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for entry := range strings.SplitSeq(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MQTT allow CIDR %q: %w", entry, err)
+		}
+		// Remote addresses are unmapped before matching, so IPv4-mapped
+		// prefixes are too, e.g. ::ffff:10.0.0.0/104 to 10.0.0.0/8.
+		if prefix.Addr().Is4In6() {
+			if prefix.Bits() < 96 {
+				return nil, fmt.Errorf("invalid MQTT allow CIDR %q: IPv4-mapped prefix shorter than /96", entry)
+			}
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// ParseAllowClientIDs splits a comma separated list of client IDs.
+func ParseAllowClientIDs(s string) []string {
+	var ids []string
+	for id := range strings.SplitSeq(s, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// allowlistHook admits only clients from allowed networks with allowed
+// client IDs, in place of the allow-all auth hook. Rejected clients are
+// sent a not authorized connack.
+type allowlistHook struct {
+	mqtt.HookBase
+	cidrs     []netip.Prefix
+	clientIDs []string
+	logger    *slog.Logger
+}
+
+func (h *allowlistHook) ID() string {
+	return "z2m-allowlist"
+}
+
+func (h *allowlistHook) Provides(b byte) bool {
+	return bytes.Contains([]byte{mqtt.OnConnectAuthenticate, mqtt.OnACLCheck}, []byte{b})
+}
+
+func (h *allowlistHook) OnConnectAuthenticate(cl *mqtt.Client, pk packets.Packet) bool {
+	if reason := h.reject(cl.ID, cl.Net.Remote); reason != "" {
+		h.logger.Warn("Rejected MQTT connection",
+			"client_id", cl.ID,
+			"remote", cl.Net.Remote,
+			"reason", reason,
+		)
+		return false
+	}
+	return true
+}
+
+// OnACLCheck allows admitted clients every topic, as the allow-all hook
+// does.
+func (h *allowlistHook) OnACLCheck(cl *mqtt.Client, topic string, write bool) bool {
+	return true
+}
+
+// reject returns why a client may not connect, or "" if it may.
+func (h *allowlistHook) reject(clientID, remote string) string {
+	if len(h.cidrs) > 0 {
+		addrPort, err := netip.ParseAddrPort(remote)
+		if err != nil {
+			return "unknown source address"
+		}
+		addr := addrPort.Addr().Unmap()
+		if !slices.ContainsFunc(h.cidrs, func(p netip.Prefix) bool { return p.Contains(addr) }) {
+			return "source address not allowed"
+		}
+	}
+	if len(h.clientIDs) > 0 && !slices.Contains(h.clientIDs, clientID) {
+		return "client ID not allowed"
+	}
+	return ""
+}
+
+// keepaliveHook imposes the broker's keepalive on connecting clients.
+// MQTT 5 clients are told in the connack; older clients are disconnected
+// after one and a half keepalives without a packet either way.
+type keepaliveHook struct {
+	mqtt.HookBase
+	keepalive uint16 // seconds
+}
+
+func (h *keepaliveHook) ID() string {
+	return "z2m-keepalive"
+}
+
+func (h *keepaliveHook) Provides(b byte) bool {
+	return bytes.Contains([]byte{mqtt.OnConnect}, []byte{b})
+}
+
+func (h *keepaliveHook) OnConnect(cl *mqtt.Client, pk packets.Packet) error {
+	cl.State.Keepalive = h.keepalive
+	cl.State.ServerKeepalive = true
+	return nil
+}
+
+// MQTTDebugInfo describes the MQTT connection for /debug/mqtt.
+type MQTTDebugInfo struct {
+	Mode     string                 `json:"mode"` // embedded or external
+	Broker   *BrokerDebugInfo       `json:"broker,omitempty"`
+	External *ExternalMQTTDebugInfo `json:"external,omitempty"`
+}
+
+// BrokerDebugInfo holds the embedded broker's settings and counters.
+type BrokerDebugInfo struct {
+	MaxClients     int64        `json:"max_clients"` // 0 for no limit
+	MaxInflight    uint16       `json:"max_inflight"`
+	ReceiveMaximum uint16       `json:"receive_maximum"`
+	MaxPacketSize  uint32       `json:"max_packet_size"` // 0 for no limit
+	Keepalive      string       `json:"keepalive"`
+	Stats          *system.Info `json:"stats"`
+}
+
+// ExternalMQTTDebugInfo describes the connection to an external broker.
+type ExternalMQTTDebugInfo struct {
+	Addr      string `json:"addr"`
+	ClientID  string `json:"client_id"`
+	Keepalive string `json:"keepalive"`
+	Connected bool   `json:"connected"`
+}
+
+// mqttDebugHandler serves /debug/mqtt for the embedded broker server or
+// the client of an external broker, whichever is running.
+func mqttDebugHandler(server *mqtt.Server, external *ExternalMQTT, keepalive time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var info MQTTDebugInfo
+		switch {
+		case server != nil:
+			caps := server.Options.Capabilities
+			maxClients := caps.MaximumClients
+			if maxClients == math.MaxInt64 {
+				maxClients = 0
+			}
+			keepaliveText := "client"
+			if keepalive > 0 {
+				keepaliveText = keepalive.String()
+			}
+			info.Mode = "embedded"
+			info.Broker = &BrokerDebugInfo{
+				MaxClients:     maxClients,
+				MaxInflight:    caps.MaximumInflight,
+				ReceiveMaximum: caps.ReceiveMaximum,
+				MaxPacketSize:  caps.MaximumPacketSize,
+				Keepalive:      keepaliveText,
+				Stats:          server.Info.Clone(),
+			}
+		case external != nil:
+			info.Mode = "external"
+			info.External = &ExternalMQTTDebugInfo{
+				Addr:      external.opts.Addr,
+				ClientID:  external.opts.ClientID,
+				Keepalive: external.opts.Keepalive.String(),
+				Connected: external.Connected(),
+			}
+		}
+
+		data, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to marshal debug info: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	})
+}
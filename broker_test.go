@@ -0,0 +1,130 @@
+package z2mhomekit
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+func TestEmbeddedBrokerOptions(t *testing.T) {
+	server, err := newEmbeddedBroker(BrokerOptions{
+		MaxClients:     4,
+		MaxInflight:    16,
+		ReceiveMaximum: 8,
+		MaxPacketSize:  1 << 20,
+		Keepalive:      20 * time.Second,
+	}, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = server.Close() })
+
+	caps := server.Options.Capabilities
+	if caps.MaximumClients != 4 || caps.MaximumInflight != 16 || caps.ReceiveMaximum != 8 || caps.MaximumPacketSize != 1<<20 {
+		t.Errorf("capabilities = %+v", caps)
+	}
+
+	cl := &mqtt.Client{}
+	if err := (&keepaliveHook{keepalive: 20}).OnConnect(cl, packets.Packet{}); err != nil {
+		t.Fatal(err)
+	}
+	if cl.State.Keepalive != 20 || !cl.State.ServerKeepalive {
+		t.Errorf("client keepalive = %d (server %v), want 20 set by the server", cl.State.Keepalive, cl.State.ServerKeepalive)
+	}
+
+	rec := httptest.NewRecorder()
+	mqttDebugHandler(server, nil, 20*time.Second).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/mqtt", nil))
+	var info MQTTDebugInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatalf("decode /debug/mqtt: %v", err)
+	}
+	if info.Mode != "embedded" || info.Broker == nil || info.Broker.MaxClients != 4 || info.Broker.Keepalive != "20s" || info.Broker.Stats == nil {
+		t.Errorf("debug info = %+v", info)
+	}
+}
+
+func TestMQTTDebugExternal(t *testing.T) {
+	client := NewExternalMQTT(ExternalMQTTOptions{Addr: "mosquitto:1883", ClientID: "z2m-homekit", Keepalive: 30 * time.Second}, testLogger())
+
+	rec := httptest.NewRecorder()
+	mqttDebugHandler(nil, client, 0).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/mqtt", nil))
+	var info MQTTDebugInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatalf("decode /debug/mqtt: %v", err)
+	}
+	if info.Mode != "external" || info.External == nil || info.External.Addr != "mosquitto:1883" || info.External.Connected {
+		t.Errorf("debug info = %+v", info)
+	}
+}
+
+func TestAllowlistHook(t *testing.T) {
+	cidrs, err := ParseAllowCIDRs("10.0.0.0/24, 192.168.1.7, fd00::/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		clientIDs []string
+		cidrs     []netip.Prefix
+		id        string
+		remote    string
+		want      bool
+	}{
+		{"cidr match", nil, cidrs, "any", "10.0.0.5:51000", true},
+		{"bare address", nil, cidrs, "any", "192.168.1.7:51000", true},
+		{"ipv4 mapped", nil, cidrs, "any", "[::ffff:10.0.0.9]:51000", true},
+		{"ipv6", nil, cidrs, "any", "[fd12::1]:51000", true},
+		{"cidr mismatch", nil, cidrs, "any", "192.168.1.8:51000", false},
+		{"unknown remote", nil, cidrs, "any", "inline", false},
+		{"client id match", []string{"zigbee2mqtt"}, nil, "zigbee2mqtt", "203.0.113.1:51000", true},
+		{"client id mismatch", []string{"zigbee2mqtt"}, nil, "mqtt-explorer", "203.0.113.1:51000", false},
+		{"both match", []string{"zigbee2mqtt"}, cidrs, "zigbee2mqtt", "10.0.0.5:51000", true},
+		{"both, wrong network", []string{"zigbee2mqtt"}, cidrs, "zigbee2mqtt", "203.0.113.1:51000", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := &allowlistHook{cidrs: tt.cidrs, clientIDs: tt.clientIDs, logger: testLogger()}
+			cl := &mqtt.Client{ID: tt.id, Net: mqtt.ClientConnection{Remote: tt.remote}}
+			if got := hook.OnConnectAuthenticate(cl, packets.Packet{}); got != tt.want {
+				t.Errorf("OnConnectAuthenticate(%s from %s) = %v, want %v", tt.id, tt.remote, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAllowCIDRs(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "10.0.0.1/24", want: []string{"10.0.0.0/24"}},
+		{in: " 192.168.1.7 , ::1", want: []string{"192.168.1.7/32", "::1/128"}},
+		{in: "::ffff:10.1.2.3/104, ::ffff:192.168.1.7", want: []string{"10.0.0.0/8", "192.168.1.7/32"}},
+		{in: "::ffff:0:0/80", wantErr: true},
+		{in: "10.0.0.0/33", wantErr: true},
+		{in: "zigbee2mqtt", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAllowCIDRs(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAllowCIDRs(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		var gotText []string
+		for _, p := range got {
+			gotText = append(gotText, p.String())
+		}
+		if !slices.Equal(gotText, tt.want) {
+			t.Errorf("ParseAllowCIDRs(%q) = %v, want %v", tt.in, gotText, tt.want)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package z2mhomekit
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+	"github.com/kradalby/z2m-homekit/devices"
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+// Capabilities describes every exposed accessory and how to drive it, for
+// generating dashboards and documentation.
+type Capabilities struct {
+	Accessories []AccessoryCapabilities `json:"accessories"`
+}
+
+// AccessoryCapabilities describes one device's HomeKit accessory and the
+// equivalent web API and MQTT operations.
+type AccessoryCapabilities struct {
+	ID         string                `json:"id"`
+	Name       string                `json:"name"`
+	Type       devices.DeviceType    `json:"type"`
+	Room       string                `json:"room,omitempty"`
+	AID        uint64                `json:"aid"`
+	Services   []ServiceCapabilities `json:"services"`
+	Operations []APIOperation        `json:"operations"`
+}
+
+// ServiceCapabilities describes a HomeKit service.
+type ServiceCapabilities struct {
+	Type            string                       `json:"type"`
+	Name            string                       `json:"name"`
+	Characteristics []CharacteristicCapabilities `json:"characteristics"`
+}
+
+// CharacteristicCapabilities describes a HomeKit characteristic.
+type CharacteristicCapabilities struct {
+	Type        string   `json:"type"`
+	Name        string   `json:"name"`
+	Format      string   `json:"format"`
+	Unit        string   `json:"unit,omitempty"`
+	Permissions []string `json:"permissions"`
+	Min         any      `json:"min,omitempty"`
+	Max         any      `json:"max,omitempty"`
+	Step        any      `json:"step,omitempty"`
+}
+
+// APIOperation is a web API request or MQTT message acting on a device.
+// Path is the URL path for http and the topic for mqtt; Params are form
+// fields or JSON payload keys.
+type APIOperation struct {
+	Protocol    string   `json:"protocol"`
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	Params      []string `json:"params,omitempty"`
+	Description string   `json:"description"`
+}
+
+// serviceNames names the HomeKit services the bridge creates.
+var serviceNames = map[string]string{
+	service.TypeAccessoryInformation:        "Accessory Information",
+	service.TypeBatteryService:              "Battery",
+	service.TypeContactSensor:               "Contact Sensor",
+	service.TypeDoorbell:                    "Doorbell",
+	service.TypeFan:                         "Fan",
+	service.TypeHumiditySensor:              "Humidity Sensor",
+	service.TypeLeakSensor:                  "Leak Sensor",
+	service.TypeLightbulb:                   "Lightbulb",
+	service.TypeOccupancySensor:             "Occupancy Sensor",
+	service.TypeOutlet:                      "Outlet",
+	service.TypeSecuritySystem:              "Security System",
+	service.TypeServiceLabel:                "Service Label",
+	service.TypeSmokeSensor:                 "Smoke Sensor",
+	service.TypeStatelessProgrammableSwitch: "Stateless Programmable Switch",
+	service.TypeSwitch:                      "Switch",
+	service.TypeTemperatureSensor:           "Temperature Sensor",
+	service.TypeWindowCovering:              "Window Covering",
+	TypeDiagnosticsService:                  "Diagnostics",
+}
+
+// characteristicNames names the HomeKit characteristics the bridge
+// creates. Custom characteristics carry their name as a description.
+var characteristicNames = map[string]string{
+	characteristic.TypeBatteryLevel:               "Battery Level",
+	characteristic.TypeBrightness:                 "Brightness",
+	characteristic.TypeChargingState:              "Charging State",
+	characteristic.TypeColorTemperature:           "Color Temperature",
+	characteristic.TypeConfiguredName:             "Configured Name",
+	characteristic.TypeContactSensorState:         "Contact Sensor State",
+	characteristic.TypeCurrentHorizontalTiltAngle: "Current Horizontal Tilt Angle",
+	characteristic.TypeCurrentPosition:            "Current Position",
+	characteristic.TypeCurrentRelativeHumidity:    "Current Relative Humidity",
+	characteristic.TypeCurrentTemperature:         "Current Temperature",
+	characteristic.TypeFirmwareRevision:           "Firmware Revision",
+	characteristic.TypeHue:                        "Hue",
+	characteristic.TypeIdentify:                   "Identify",
+	characteristic.TypeLeakDetected:               "Leak Detected",
+	characteristic.TypeManufacturer:               "Manufacturer",
+	characteristic.TypeModel:                      "Model",
+	characteristic.TypeName:                       "Name",
+	characteristic.TypeOccupancyDetected:          "Occupancy Detected",
+	characteristic.TypeOn:                         "On",
+	characteristic.TypeOutletInUse:                "Outlet In Use",
+	characteristic.TypePositionState:              "Position State",
+	characteristic.TypeRotationSpeed:              "Rotation Speed",
+	characteristic.TypeSaturation:                 "Saturation",
+	characteristic.TypeSecuritySystemCurrentState: "Security System Current State",
+	characteristic.TypeSecuritySystemTargetState:  "Security System Target State",
+	characteristic.TypeSerialNumber:               "Serial Number",
+	characteristic.TypeSmokeDetected:              "Smoke Detected",
+	characteristic.TypeStatusLowBattery:           "Status Low Battery",
+	characteristic.TypeStatusTampered:             "Status Tampered",
+	characteristic.TypeTargetHorizontalTiltAngle:  "Target Horizontal Tilt Angle",
+	characteristic.TypeTargetPosition:             "Target Position",
+}
+
+// Capabilities describes the accessories the manager exposes, in bridge
+// order.
+func (hm *HAPManager) Capabilities() Capabilities {
+	caps := Capabilities{Accessories: []AccessoryCapabilities{}}
+	for _, accInfo := range hm.accessoryInfos() {
+		acc := AccessoryCapabilities{
+			ID:         accInfo.DeviceID,
+			Name:       accInfo.Device.Name,
+			Type:       accInfo.Device.Type,
+			Room:       accInfo.Device.Room,
+			AID:        accInfo.Accessory.Id,
+			Services:   []ServiceCapabilities{},
+			Operations: deviceOperations(accInfo.Device),
+		}
+		for _, s := range accInfo.Accessory.Ss {
+			svc := ServiceCapabilities{
+				Type:            s.Type,
+				Name:            nameOr(serviceNames[s.Type], s.Type),
+				Characteristics: []CharacteristicCapabilities{},
+			}
+			for _, c := range s.Cs {
+				svc.Characteristics = append(svc.Characteristics, CharacteristicCapabilities{
+					Type:        c.Type,
+					Name:        nameOr(characteristicNames[c.Type], nameOr(c.Description, c.Type)),
+					Format:      c.Format,
+					Unit:        c.Unit,
+					Permissions: c.Permissions,
+					Min:         c.MinVal,
+					Max:         c.MaxVal,
+					Step:        c.StepVal,
+				})
+			}
+			acc.Services = append(acc.Services, svc)
+		}
+		caps.Accessories = append(caps.Accessories, acc)
+	}
+	return caps
+}
+
+func nameOr(name, fallback string) string {
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+// raisesAlerts reports whether a device raises alerts that can be
+// acknowledged.
+func raisesAlerts(device devices.Device) bool {
+	switch device.Type {
+	case devices.DeviceTypeLeakSensor, devices.DeviceTypeSmokeSensor:
+		return true
+	case devices.DeviceTypeContactSensor:
+		return device.AlertOnOpen
+	}
+	return false
+}
+
+// deviceOperations lists the web API and MQTT operations for a device.
+func deviceOperations(device devices.Device) []APIOperation {
+	var ops []APIOperation
+	light := device.Type == devices.DeviceTypeLightbulb
+
+	if webEnabled(device) {
+		if isControllable(device.Type) {
+			ops = append(ops, APIOperation{
+				Protocol: "http", Method: http.MethodPost, Path: "/toggle/" + device.ID,
+				Params: []string{"action"}, Description: "Switch on (action=on) or off",
+			})
+		}
+		if light && device.Features.Brightness {
+			ops = append(ops,
+				APIOperation{
+					Protocol: "http", Method: http.MethodPost, Path: "/brightness/" + device.ID,
+					Params: []string{"brightness"}, Description: "Set brightness, 0-100",
+				},
+				APIOperation{
+					Protocol: "http", Method: http.MethodPost, Path: "/dim/" + device.ID,
+					Params: []string{"direction"}, Description: "Start dimming up or down, or stop",
+				},
+			)
+		}
+		if device.Type == devices.DeviceTypeCover {
+			ops = append(ops, APIOperation{
+				Protocol: "http", Method: http.MethodPost, Path: "/position/" + device.ID,
+				Params: []string{"position"}, Description: "Set position, 0 (closed) to 100 (open)",
+			})
+		}
+		if device.Type == devices.DeviceTypeSecuritySystem {
+			ops = append(ops, APIOperation{
+				Protocol: "http", Method: http.MethodPost, Path: "/arm/" + device.ID,
+				Params: []string{"mode"}, Description: "Arm (mode=stay, away or night) or disarm (mode=disarmed)",
+			})
+		}
+		if hasSiren(device) {
+			ops = append(ops, APIOperation{
+				Protocol: "http", Method: http.MethodPost, Path: "/siren/" + device.ID,
+				Params: []string{"action"}, Description: "Sound (action=on) or silence the siren",
+			})
+		}
+		if raisesAlerts(device) {
+			ops = append(ops, APIOperation{
+				Protocol: "http", Method: http.MethodPost, Path: "/api/v1/alert/ack/" + device.ID,
+				Description: "Acknowledge the active alert",
+			})
+		}
+		if device.Type == devices.DeviceTypeLeakSensor && len(device.ShutoffValves) > 0 {
+			ops = append(ops, APIOperation{
+				Protocol: "http", Method: http.MethodPost, Path: "/api/v1/leak/ack/" + device.ID,
+				Description: "Acknowledge the leak and unlock its shutoff valves",
+			})
+		}
+	}
+
+	ops = append(ops, APIOperation{
+		Protocol: "mqtt", Method: "subscribe", Path: StateMirrorPrefix + device.ID,
+		Description: "Normalized device state, retained",
+	})
+
+	var params []string
+	if isControllable(device.Type) {
+		params = append(params, "on")
+	}
+	if light {
+		params = append(params, "brightness", "hue", "saturation", "color_temp")
+	}
+	if device.Type == devices.DeviceTypeFan {
+		params = append(params, "fan_speed")
+	}
+	if device.Type == devices.DeviceTypeCover {
+		params = append(params, "position")
+	}
+	if device.Type == devices.DeviceTypeSecuritySystem {
+		params = append(params, "arm_mode")
+	}
+	if hasSiren(device) {
+		params = append(params, "siren")
+	}
+	if len(params) > 0 {
+		ops = append(ops, APIOperation{
+			Protocol: "mqtt", Method: "publish", Path: CommandTopicPrefix + device.ID,
+			Params: params, Description: "Send a command",
+		})
+	}
+
+	return ops
+}
+
+// HandleCapabilities serves the capability export as JSON.
+func (ws *WebServer) HandleCapabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ws.hapManager == nil {
+		http.Error(w, "HomeKit is not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ws.hapManager.Capabilities()); err != nil {
+		ws.logger.Error("Failed to encode capabilities", "error", err)
+	}
+}
+
+// ExportCapabilities implements the export-capabilities subcommand and
+// returns the process exit code.
+func ExportCapabilities(args []string) int {
+	fs := flag.NewFlagSet("export-capabilities", flag.ContinueOnError)
+	devicesPath := fs.String("devices", envOr("Z2M_HOMEKIT_DEVICES_CONFIG", "./devices.hujson"), "path to devices.hujson")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: z2m-homekit export-capabilities [flags]\n\n")
+		fmt.Fprintf(fs.Output(), "Prints the HomeKit accessories, services and characteristics for the\n")
+		fmt.Fprintf(fs.Output(), "configured devices, and the API operations for each, as JSON.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if err := exportCapabilities(os.Stdout, *devicesPath); err != nil {
+		fmt.Fprintf(os.Stderr, "export-capabilities: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func exportCapabilities(out io.Writer, devicesPath string) error {
+	deviceCfg, err := devices.LoadConfig(devicesPath)
+	if err != nil {
+		return err
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	bus, err := events.New(logger)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = bus.Close() }()
+
+	hm := NewHAPManager(deviceCfg.Devices, "z2m-homekit", nil, nil, bus, logger)
+	defer hm.Close()
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(hm.Capabilities())
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
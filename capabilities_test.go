@@ -0,0 +1,97 @@
+package z2mhomekit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+func TestExportCapabilities(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.hujson")
+	cfg := `{
+  "devices": [
+    {"id": "lamp", "name": "Lamp", "topic": "lamp", "type": "lightbulb", "features": {"brightness": true}},
+    {"id": "leak", "name": "Leak", "topic": "leak", "type": "leak_sensor", "features": {"water_leak": true}},
+  ],
+}`
+	if err := os.WriteFile(path, []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := exportCapabilities(&out, path); err != nil {
+		t.Fatalf("exportCapabilities: %v", err)
+	}
+	var caps Capabilities
+	if err := json.Unmarshal(out.Bytes(), &caps); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(caps.Accessories) != 2 {
+		t.Fatalf("got %d accessories, want 2", len(caps.Accessories))
+	}
+
+	lamp := caps.Accessories[0]
+	var chars []string
+	for _, s := range lamp.Services {
+		if s.Name != "Lightbulb" {
+			continue
+		}
+		for _, c := range s.Characteristics {
+			chars = append(chars, c.Name)
+		}
+	}
+	if !slices.Contains(chars, "On") || !slices.Contains(chars, "Brightness") {
+		t.Errorf("lightbulb characteristics = %v, want On and Brightness", chars)
+	}
+
+	var paths []string
+	for _, op := range lamp.Operations {
+		paths = append(paths, op.Method+" "+op.Path)
+	}
+	for _, want := range []string{"POST /toggle/lamp", "POST /brightness/lamp", "publish z2m-homekit/command/lamp"} {
+		if !slices.Contains(paths, want) {
+			t.Errorf("lamp operations %v missing %q", paths, want)
+		}
+	}
+
+	leak := caps.Accessories[1]
+	for _, op := range leak.Operations {
+		if op.Path == CommandTopicPrefix+"leak" || op.Path == "/toggle/leak" {
+			t.Errorf("sensor lists command operation %s", op.Path)
+		}
+	}
+}
+
+func TestHandleCapabilities(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	configs := []devices.Device{{ID: "plug", Name: "Plug", Topic: "plug", Type: devices.DeviceTypeOutlet}}
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ws.hapManager = NewHAPManager(configs, "Test Bridge", nil, nil, bus, logger)
+
+	rec := httptest.NewRecorder()
+	ws.HandleCapabilities(rec, httptest.NewRequest("GET", "/api/v1/capabilities", nil))
+	if rec.Code != 200 {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	var caps Capabilities
+	if err := json.Unmarshal(rec.Body.Bytes(), &caps); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(caps.Accessories) != 1 || caps.Accessories[0].ID != "plug" {
+		t.Errorf("accessories = %+v", caps.Accessories)
+	}
+
+	rec = httptest.NewRecorder()
+	ws.HandleCapabilities(rec, httptest.NewRequest("POST", "/api/v1/capabilities", nil))
+	if rec.Code != 405 {
+		t.Errorf("POST status = %d, want 405", rec.Code)
+	}
+}
@@ -0,0 +1,78 @@
+package z2mhomekit
+
+import (
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+)
+
+// Custom HomeKit types for bridge-specific diagnostics. The Home app ignores
+// them, but third-party HomeKit apps (Eve, Controller) display them.
+const (
+	TypeDiagnosticsService = "5A2D0000-7A32-4B6E-9C1F-1B2A3C4D5E6F"
+	TypeLinkQuality        = "5A2D0001-7A32-4B6E-9C1F-1B2A3C4D5E6F"
+	TypeAlertAcknowledged  = "5A2D0002-7A32-4B6E-9C1F-1B2A3C4D5E6F"
+)
+
+// LinkQuality reports the Zigbee link quality (0-255) of a device.
+type LinkQuality struct {
+	*characteristic.Int
+}
+
+// NewLinkQuality creates a read-only link quality characteristic.
+func NewLinkQuality() *LinkQuality {
+	c := characteristic.NewInt(TypeLinkQuality)
+	c.Format = characteristic.FormatUInt8
+	c.Permissions = []string{characteristic.PermissionRead, characteristic.PermissionEvents}
+	c.Description = "Link Quality"
+	c.SetMinValue(0)
+	c.SetMaxValue(255)
+	c.SetStepValue(1)
+	_ = c.SetValue(0)
+
+	return &LinkQuality{c}
+}
+
+// AlertAcknowledged is true while a sensor's alert has been acknowledged
+// and repeats are silenced.
+type AlertAcknowledged struct {
+	*characteristic.Bool
+}
+
+// NewAlertAcknowledged creates a read-only alert acknowledged
+// characteristic.
+func NewAlertAcknowledged() *AlertAcknowledged {
+	c := characteristic.NewBool(TypeAlertAcknowledged)
+	c.Permissions = []string{characteristic.PermissionRead, characteristic.PermissionEvents}
+	c.Description = "Alert Acknowledged"
+	c.SetValue(false)
+
+	return &AlertAcknowledged{c}
+}
+
+// DiagnosticsService groups bridge diagnostics for an accessory.
+type DiagnosticsService struct {
+	*service.S
+
+	LinkQuality *LinkQuality
+
+	// AlertAcknowledged is only present on sensors with acknowledgeable
+	// alerts.
+	AlertAcknowledged *AlertAcknowledged
+}
+
+// NewDiagnosticsService creates the diagnostics service.
+func NewDiagnosticsService() *DiagnosticsService {
+	s := DiagnosticsService{}
+	s.S = service.New(TypeDiagnosticsService)
+
+	s.LinkQuality = NewLinkQuality()
+	s.AddC(s.LinkQuality.C)
+
+	return &s
+}
+
+// AddAlertAcknowledged adds the alert acknowledged characteristic.
+func (s *DiagnosticsService) AddAlertAcknowledged() {
+	s.AlertAcknowledged = NewAlertAcknowledged()
+	s.AddC(s.AlertAcknowledged.C)
+}
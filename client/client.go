@@ -0,0 +1,324 @@
+// Package client is a typed Go client for the z2m-homekit bridge's JSON
+// API. It depends only on the standard library so other home automation
+// tools can import it without pulling in the bridge.
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options configures a Client.
+type Options struct {
+	// Token is an API token, sent as a bearer token. It can be empty while
+	// the bridge has no tokens.
+	Token string
+
+	// HTTPClient defaults to http.DefaultClient. Event streams run until
+	// their context is cancelled, so it should not set a Timeout.
+	HTTPClient *http.Client
+}
+
+// Client calls the bridge's JSON API.
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// New returns a client for the bridge web server at baseURL, e.g.
+// http://z2m-homekit:8081.
+func New(baseURL string, opts Options) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: scheme must be http or https", baseURL)
+	}
+
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   opts.Token,
+		http:    httpClient,
+	}, nil
+}
+
+// Error is a non-success response from the bridge.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("z2m-homekit: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// ErrNotFound matches errors for unknown devices with errors.Is.
+var ErrNotFound = errors.New("not found")
+
+// Is reports whether the error is ErrNotFound for a 404 response.
+func (e *Error) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+func (c *Client) do(ctx context.Context, method, path string, form url.Values, out any) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", path, err)
+	}
+	return nil
+}
+
+// send sends req with the token, turning non-2xx responses into *Error.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	return resp, nil
+}
+
+// ListDevices returns the devices available on the web, sorted by ID.
+func (c *Client) ListDevices(ctx context.Context) ([]Device, error) {
+	var devices []Device
+	if err := c.do(ctx, http.MethodGet, "/api/v1/devices", nil, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// Device returns a single device.
+func (c *Client) Device(ctx context.Context, id string) (Device, error) {
+	var device Device
+	err := c.do(ctx, http.MethodGet, "/api/v1/devices/"+url.PathEscape(id), nil, &device)
+	return device, err
+}
+
+// SetPower switches a device on or off.
+func (c *Client) SetPower(ctx context.Context, id string, on bool) error {
+	return c.command(ctx, id, "power", url.Values{"on": {strconv.FormatBool(on)}})
+}
+
+// SetBrightness sets a light's brightness, 0-100.
+func (c *Client) SetBrightness(ctx context.Context, id string, brightness int) error {
+	return c.command(ctx, id, "brightness", url.Values{"brightness": {strconv.Itoa(brightness)}})
+}
+
+// SetColor sets a light's hue, 0-360, and saturation, 0-100.
+func (c *Client) SetColor(ctx context.Context, id string, hue, saturation float64) error {
+	return c.command(ctx, id, "color", url.Values{
+		"hue":        {strconv.FormatFloat(hue, 'f', -1, 64)},
+		"saturation": {strconv.FormatFloat(saturation, 'f', -1, 64)},
+	})
+}
+
+// SetColorTemp sets a light's color temperature in mireds.
+func (c *Client) SetColorTemp(ctx context.Context, id string, mireds int) error {
+	return c.command(ctx, id, "color", url.Values{"color_temp": {strconv.Itoa(mireds)}})
+}
+
+func (c *Client) command(ctx context.Context, id, command string, form url.Values) error {
+	return c.do(ctx, http.MethodPost, "/api/v1/devices/"+url.PathEscape(id)+"/"+command, form, nil)
+}
+
+// Status returns the bridge status.
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	var status Status
+	err := c.do(ctx, http.MethodGet, "/api/v1/status", nil, &status)
+	return status, err
+}
+
+// Event is a state update from the event stream. ID can be passed to
+// WatchEvents to resume after a disconnect.
+type Event struct {
+	ID    string
+	State State
+}
+
+// WatchEvents streams state updates to fn until ctx is cancelled or the
+// connection drops. The stream starts with the current state of every
+// device, or with the updates missed since lastEventID if the bridge still
+// has them. It returns nil when ctx is cancelled.
+func (c *Client) WatchEvents(ctx context.Context, lastEventID string, fn func(Event)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/events", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var id string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if v, ok := strings.CutPrefix(line, "id: "); ok {
+			id = v
+			continue
+		}
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var state State
+		if err := json.Unmarshal([]byte(data), &state); err != nil {
+			return fmt.Errorf("invalid event: %w", err)
+		}
+		fn(Event{ID: id, State: state})
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// Device is a device known to the bridge.
+type Device struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Room     string   `json:"room,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Hidden   bool     `json:"hidden,omitempty"`
+	Features Features `json:"features"`
+
+	// State is nil until the device has reported.
+	State *State `json:"state,omitempty"`
+}
+
+// Features lists what a device supports.
+type Features struct {
+	Temperature      bool `json:"temperature,omitempty"`
+	Humidity         bool `json:"humidity,omitempty"`
+	Battery          bool `json:"battery,omitempty"`
+	Occupancy        bool `json:"occupancy,omitempty"`
+	Illuminance      bool `json:"illuminance,omitempty"`
+	Pressure         bool `json:"pressure,omitempty"`
+	Contact          bool `json:"contact,omitempty"`
+	WaterLeak        bool `json:"water_leak,omitempty"`
+	Smoke            bool `json:"smoke,omitempty"`
+	Tamper           bool `json:"tamper,omitempty"`
+	Brightness       bool `json:"brightness,omitempty"`
+	Color            bool `json:"color,omitempty"`
+	ColorTemperature bool `json:"color_temperature,omitempty"`
+	Power            bool `json:"power,omitempty"`
+	Speed            bool `json:"speed,omitempty"`
+	Direction        bool `json:"direction,omitempty"`
+	Swing            bool `json:"swing,omitempty"`
+}
+
+// State is a device's normalized state. Unset values were not reported.
+type State struct {
+	Timestamp time.Time `json:"timestamp"`
+	Source    string    `json:"source"`
+	DeviceID  string    `json:"device_id"`
+	Name      string    `json:"name"`
+
+	Temperature *float64 `json:"temperature,omitempty"`
+	Humidity    *float64 `json:"humidity,omitempty"`
+	Battery     *int     `json:"battery,omitempty"`
+	Occupancy   *bool    `json:"occupancy,omitempty"`
+	Illuminance *int     `json:"illuminance,omitempty"`
+	Pressure    *float64 `json:"pressure,omitempty"`
+	Contact     *bool    `json:"contact,omitempty"`    // true = closed
+	WaterLeak   *bool    `json:"water_leak,omitempty"` // true = leak detected
+	Smoke       *bool    `json:"smoke,omitempty"`
+	Tamper      *bool    `json:"tamper,omitempty"`
+
+	PressureTrend  string   `json:"pressure_trend,omitempty"`
+	PressureChange *float64 `json:"pressure_change,omitempty"`
+	Forecast       string   `json:"forecast,omitempty"`
+
+	FrostWarning      *bool `json:"frost_warning,omitempty"`
+	HeatWarning       *bool `json:"heat_warning,omitempty"`
+	AlertAcknowledged bool  `json:"alert_acknowledged,omitempty"`
+
+	On         *bool    `json:"on,omitempty"`
+	Brightness *int     `json:"brightness,omitempty"` // 0-100
+	Hue        *float64 `json:"hue,omitempty"`        // 0-360
+	Saturation *float64 `json:"saturation,omitempty"` // 0-100
+	ColorTemp  *int     `json:"color_temp,omitempty"` // mireds
+	Power      *float64 `json:"power,omitempty"`      // watts
+	Voltage    *float64 `json:"voltage,omitempty"`    // volts
+	Current    *float64 `json:"current,omitempty"`    // amperes
+	Energy     *float64 `json:"energy,omitempty"`     // kWh
+	FanSpeed   *int     `json:"fan_speed,omitempty"`  // 0-100
+
+	LinkQuality     int       `json:"link_quality"`
+	LastSeen        time.Time `json:"last_seen"`
+	LastUpdated     time.Time `json:"last_updated"`
+	ConnectionState string    `json:"connection_state"`
+	ConnectionNote  string    `json:"connection_note"`
+}
+
+// Status is a summary of the bridge status.
+type Status struct {
+	Version       string    `json:"version"`
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+	RestartCause  string    `json:"restart_cause"`
+	Components    map[string]struct {
+		Status string `json:"status"`
+		Error  string `json:"error,omitempty"`
+	} `json:"components"`
+	Devices struct {
+		Total int `json:"total"`
+		Seen  int `json:"seen"`
+	} `json:"devices"`
+	Timestamp time.Time `json:"timestamp"`
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWatchEvents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			http.Error(w, "API token required", http.StatusUnauthorized)
+			return
+		}
+		if got := r.Header.Get("Last-Event-ID"); got != "6" {
+			t.Errorf("Last-Event-ID = %q, want 6", got)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": keepalive\n\n")
+		fmt.Fprint(w, "id: 7\ndata: {\"device_id\":\"lamp\",\"on\":true}\n\n")
+		fmt.Fprint(w, "id: 8\ndata: {\"device_id\":\"plug\",\"power\":12.5}\n\n")
+	}))
+	t.Cleanup(srv.Close)
+
+	c, err := New(srv.URL+"/", Options{Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []Event
+	err = c.WatchEvents(context.Background(), "6", func(e Event) { got = append(got, e) })
+	if err == nil {
+		t.Error("WatchEvents returned nil after the stream ended")
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d events, want 2", len(got))
+	}
+	if got[0].ID != "7" || got[0].State.DeviceID != "lamp" || !*got[0].State.On {
+		t.Errorf("first event = %+v", got[0])
+	}
+	if got[1].ID != "8" || *got[1].State.Power != 12.5 {
+		t.Errorf("second event = %+v", got[1])
+	}
+
+	c, _ = New(srv.URL, Options{})
+	err = c.WatchEvents(context.Background(), "", func(Event) {})
+	if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unauthenticated error = %v, want 401", err)
+	}
+}
+
+func TestNewRejectsBadURL(t *testing.T) {
+	if _, err := New("z2m-homekit:8081", Options{}); err == nil {
+		t.Error("New accepted a URL without a scheme")
+	}
+}
@@ -1,7 +1,28 @@
 package main
 
-import z2mhomekit "github.com/kradalby/z2m-homekit"
+import (
+	"os"
+
+	z2mhomekit "github.com/kradalby/z2m-homekit"
+)
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "loadtest":
+			os.Exit(z2mhomekit.LoadTest(os.Args[2:]))
+		case "init":
+			os.Exit(z2mhomekit.Init(os.Args[2:]))
+		case "secrets":
+			os.Exit(z2mhomekit.Secrets(os.Args[2:]))
+		case "import":
+			os.Exit(z2mhomekit.Import(os.Args[2:]))
+		case "export-homeassistant":
+			os.Exit(z2mhomekit.ExportHomeAssistant(os.Args[2:]))
+		case "export-capabilities":
+			os.Exit(z2mhomekit.ExportCapabilities(os.Args[2:]))
+		}
+	}
+
 	z2mhomekit.Main()
 }
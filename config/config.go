@@ -2,10 +2,16 @@ package config
 
 import (
 	"fmt"
+	"math"
+	"net"
 	"net/netip"
 	"os"
+	"path/filepath"
+	"slices"
+	"time"
 
 	env "github.com/Netflix/go-env"
+	"github.com/kradalby/z2m-homekit/secrets"
 )
 
 const (
@@ -25,22 +31,111 @@ type Config struct {
 	HAPBindAddress string `env:"Z2M_HOMEKIT_HAP_BIND_ADDRESS,default=0.0.0.0"`
 	HAPPort        int    `env:"Z2M_HOMEKIT_HAP_PORT,default=51826"`
 
+	// HomeKit commands per device: a burst, then one per interval. Writes
+	// beyond it are refused as busy (interval 0 disables)
+	HAPCommandInterval time.Duration `env:"Z2M_HOMEKIT_HAP_COMMAND_INTERVAL,default=200ms"`
+	HAPCommandBurst    int           `env:"Z2M_HOMEKIT_HAP_COMMAND_BURST,default=10"`
+
 	// Web listener configuration
 	WebAddr        string `env:"Z2M_HOMEKIT_WEB_ADDR"`
 	WebBindAddress string `env:"Z2M_HOMEKIT_WEB_BIND_ADDRESS,default=0.0.0.0"`
 	WebPort        int    `env:"Z2M_HOMEKIT_WEB_PORT,default=8081"`
 
+	// Web UI and API authentication: "none", "basic" for
+	// WebUsername/WebPassword, or "tailscale" for the tailnet identity of
+	// the client, limited to WebTailscaleUsers when set. In tailscale mode
+	// the local listener takes basic auth when a password is set and is
+	// refused otherwise. API tokens are accepted in every mode, but can
+	// only be created in a mode other than "none". /health is always
+	// open. /metrics on the local listener is behind the web auth too,
+	// taking read tokens, unless MetricsPublic is set.
+	WebAuth           string `env:"Z2M_HOMEKIT_WEB_AUTH,default=none"`
+	WebUsername       string `env:"Z2M_HOMEKIT_WEB_USERNAME"`
+	WebPassword       string `env:"Z2M_HOMEKIT_WEB_PASSWORD"`
+	WebTailscaleUsers string `env:"Z2M_HOMEKIT_WEB_TAILSCALE_USERS"`
+
 	// Embedded MQTT listener configuration
 	MQTTAddr        string `env:"Z2M_HOMEKIT_MQTT_ADDR"`
 	MQTTBindAddress string `env:"Z2M_HOMEKIT_MQTT_BIND_ADDRESS,default=0.0.0.0"`
 	MQTTPort        int    `env:"Z2M_HOMEKIT_MQTT_PORT,default=1883"`
 
+	// Embedded broker limits, sized for zigbee2mqtt and a few tools on
+	// small hardware. MQTTMaxPacketSize is in bytes, 0 for no limit;
+	// MQTTServerKeepalive overrides the clients' keepalive, 0 keeps it.
+	MQTTMaxClients      int           `env:"Z2M_HOMEKIT_MQTT_MAX_CLIENTS,default=32"`
+	MQTTMaxInflight     int           `env:"Z2M_HOMEKIT_MQTT_MAX_INFLIGHT,default=256"`
+	MQTTReceiveMaximum  int           `env:"Z2M_HOMEKIT_MQTT_RECEIVE_MAXIMUM,default=64"`
+	MQTTMaxPacketSize   int           `env:"Z2M_HOMEKIT_MQTT_MAX_PACKET_SIZE,default=4194304"`
+	MQTTServerKeepalive time.Duration `env:"Z2M_HOMEKIT_MQTT_SERVER_KEEPALIVE,default=0"`
+
+	// Interval of the embedded broker's $SYS statistics and the retained
+	// z2m-homekit/bridge/info topic
+	MQTTSysInterval time.Duration `env:"Z2M_HOMEKIT_MQTT_SYS_INTERVAL,default=30s"`
+
+	// Restrict embedded broker connections to comma separated source
+	// CIDRs and/or client IDs, e.g. the zigbee2mqtt host; empty allows
+	// any client
+	MQTTAllowCIDRs     string `env:"Z2M_HOMEKIT_MQTT_ALLOW_CIDRS"`
+	MQTTAllowClientIDs string `env:"Z2M_HOMEKIT_MQTT_ALLOW_CLIENT_IDS"`
+
+	// External MQTT broker (host:port) to connect to as a client instead
+	// of running the embedded broker; empty runs the embedded broker
+	MQTTBroker    string        `env:"Z2M_HOMEKIT_MQTT_BROKER"`
+	MQTTClientID  string        `env:"Z2M_HOMEKIT_MQTT_CLIENT_ID,default=z2m-homekit"`
+	MQTTUsername  string        `env:"Z2M_HOMEKIT_MQTT_USERNAME"`
+	MQTTPassword  string        `env:"Z2M_HOMEKIT_MQTT_PASSWORD"`
+	MQTTKeepalive time.Duration `env:"Z2M_HOMEKIT_MQTT_KEEPALIVE,default=30s"`
+
+	// Log MQTT messages that take at least this long to handle; 0
+	// disables the log
+	MQTTSlowMessage time.Duration `env:"Z2M_HOMEKIT_MQTT_SLOW_MESSAGE,default=100ms"`
+
+	// Largest device or command payload handled, in bytes; larger and
+	// binary payloads are dropped unparsed. 0 accepts any size.
+	MQTTMaxPayload int `env:"Z2M_HOMEKIT_MQTT_MAX_PAYLOAD,default=65536"`
+
+	// Bridge accessory information shown in the Home app. The serial
+	// number defaults to one derived from the bridge's HAP identity.
+	BridgeManufacturer string `env:"Z2M_HOMEKIT_BRIDGE_MANUFACTURER,default=z2m-homekit"`
+	BridgeModel        string `env:"Z2M_HOMEKIT_BRIDGE_MODEL,default=Bridge"`
+	BridgeSerial       string `env:"Z2M_HOMEKIT_BRIDGE_SERIAL"`
+
 	// Tailscale configuration
 	BridgeName        string `env:"Z2M_HOMEKIT_BRIDGE_NAME"`
 	TailscaleHostname string `env:"Z2M_HOMEKIT_TS_HOSTNAME"`
 	TailscaleAuthKey  string `env:"Z2M_HOMEKIT_TS_AUTHKEY"`
 	TailscaleStateDir string `env:"Z2M_HOMEKIT_TS_STATE_DIR,default=./data/tailscale"`
 
+	// API token store
+	TokensPath string `env:"Z2M_HOMEKIT_TOKENS_PATH,default=./data/tokens.json"`
+
+	// Records how the previous run ended, for restart cause reporting
+	LifecyclePath string `env:"Z2M_HOMEKIT_LIFECYCLE_PATH,default=./data/lifecycle.json"`
+
+	// Write-ahead log of in-flight commands, replayed after a crash;
+	// empty disables it
+	CommandLogPath string `env:"Z2M_HOMEKIT_COMMAND_LOG_PATH,default=./data/commands.wal"`
+
+	// Journal of device messages from zigbee2mqtt for the event replay
+	// API; empty disables it
+	EventJournalPath string `env:"Z2M_HOMEKIT_EVENT_JOURNAL_PATH,default=./data/events.jsonl"`
+
+	// Scenes saved from the web UI; empty disables saving scenes there
+	ScenesPath string `env:"Z2M_HOMEKIT_SCENES_PATH,default=./data/scenes.json"`
+
+	// Devices disabled from the web UI or API; empty keeps them disabled
+	// only until restart
+	DisabledPath string `env:"Z2M_HOMEKIT_DISABLED_PATH,default=./data/disabled.json"`
+
+	// Directory of recorded sensor and state history for the history API;
+	// empty disables it. Days older than two days are compacted to hourly
+	// values, and history older than the retention is deleted.
+	HistoryDir       string        `env:"Z2M_HOMEKIT_HISTORY_DIR,default=./data/history"`
+	HistoryRetention time.Duration `env:"Z2M_HOMEKIT_HISTORY_RETENTION,default=720h"`
+
+	// Key file for secrets stored as enc:v1:... values
+	SecretsKeyFile string `env:"Z2M_HOMEKIT_SECRETS_KEY_FILE"`
+
 	// Logging options
 	LogLevel  string `env:"Z2M_HOMEKIT_LOG_LEVEL,default=info"`
 	LogFormat string `env:"Z2M_HOMEKIT_LOG_FORMAT,default=json"`
@@ -48,9 +143,75 @@ type Config struct {
 	// Devices configuration file
 	DevicesConfigPath string `env:"Z2M_HOMEKIT_DEVICES_CONFIG,default=./devices.hujson"`
 
+	// How often the devices configuration file is checked for changes,
+	// which are applied without a restart (0 disables)
+	DevicesReloadInterval time.Duration `env:"Z2M_HOMEKIT_DEVICES_RELOAD_INTERVAL,default=2s"`
+
+	// Directory of the versions of the devices configuration file as they
+	// were applied, for rolling back from the web UI; empty disables it.
+	// Only the last ConfigSnapshotsKeep versions are kept.
+	ConfigSnapshotsDir  string `env:"Z2M_HOMEKIT_CONFIG_SNAPSHOTS_DIR,default=./data/config-snapshots"`
+	ConfigSnapshotsKeep int    `env:"Z2M_HOMEKIT_CONFIG_SNAPSHOTS_KEEP,default=50"`
+
+	// Link quality alerting (threshold 0 disables)
+	LinkQualityAlertThreshold int           `env:"Z2M_HOMEKIT_LINK_QUALITY_ALERT_THRESHOLD,default=20"`
+	LinkQualityAlertDuration  time.Duration `env:"Z2M_HOMEKIT_LINK_QUALITY_ALERT_DURATION,default=10m"`
+
+	// Dashboard widgets, comma separated (climate, weather, windows,
+	// lights, alerts). Empty shows all, "none" hides the row.
+	DashboardWidgets string `env:"Z2M_HOMEKIT_DASHBOARD_WIDGETS"`
+
+	// Mirror normalized device state to z2m-homekit/state/<id> as retained
+	// MQTT messages
+	StateMirror bool `env:"Z2M_HOMEKIT_STATE_MIRROR,default=true"`
+
+	// How long acknowledging a leak, smoke or contact alert silences repeats
+	AlertSilence time.Duration `env:"Z2M_HOMEKIT_ALERT_SILENCE,default=1h"`
+
+	// How long the last state of a device is kept to drop duplicate
+	// updates. Zero keeps it while the device is configured.
+	StateDedupTTL time.Duration `env:"Z2M_HOMEKIT_STATE_DEDUP_TTL,default=0"`
+
+	// Publish reports that only change link quality or last seen as
+	// device seen events, at most every 10s per device, instead of state
+	// updates
+	LivenessEvents bool `env:"Z2M_HOMEKIT_LIVENESS_EVENTS,default=true"`
+
+	// Discover devices from zigbee2mqtt/bridge/devices in addition to the
+	// devices file. Discovered devices are saved to DiscoveryPath and the
+	// bridge reloads when the list changes.
+	Discovery     bool   `env:"Z2M_HOMEKIT_DISCOVERY,default=false"`
+	DiscoveryPath string `env:"Z2M_HOMEKIT_DISCOVERY_PATH,default=./data/discovered.json"`
+
+	// Run the device manager on a simulated clock that /debug/clock can
+	// move, for testing schedules and other time based behaviour. Not for
+	// production use.
+	SimulateTime bool `env:"Z2M_HOMEKIT_SIMULATE_TIME,default=false"`
+
+	// Metrics cardinality: leave the device name label off, hash device
+	// IDs in labels, and a comma separated list of per-device metrics not
+	// to export ("device", "device:metric" or "*:metric")
+	MetricsNameLabel bool   `env:"Z2M_HOMEKIT_METRICS_NAME_LABEL,default=true"`
+	MetricsHashIDs   bool   `env:"Z2M_HOMEKIT_METRICS_HASH_IDS,default=false"`
+	MetricsExclude   string `env:"Z2M_HOMEKIT_METRICS_EXCLUDE"`
+
+	// Serve /metrics on the local listener without the web auth, for
+	// scrapers that cannot send credentials. Over Tailscale, /metrics is
+	// served by kraweb to the whole tailnet regardless of this and of the
+	// web auth; limit it with tailnet ACLs.
+	MetricsPublic bool `env:"Z2M_HOMEKIT_METRICS_PUBLIC,default=false"`
+
+	// Container ownership of the data directories (PUID/PGID convention).
+	// When set and running as root, the data directories are chowned and
+	// the process drops to this user and group.
+	PUID int `env:"PUID"`
+	PGID int `env:"PGID"`
+
 	hapAddr  netip.AddrPort
 	webAddr  netip.AddrPort
 	mqttAddr netip.AddrPort
+
+	secrets *secrets.Box
 }
 
 // Load reads configuration from the environment.
@@ -62,6 +223,10 @@ func Load() (*Config, error) {
 
 	cfg.applyNameDefaults()
 
+	if err := cfg.decryptSecrets(); err != nil {
+		return nil, err
+	}
+
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
@@ -74,6 +239,9 @@ func (c *Config) Validate() error {
 	if len(c.HAPPin) != 8 {
 		return fmt.Errorf("HAP PIN must be exactly 8 digits")
 	}
+	if c.BridgeManufacturer == "" || c.BridgeModel == "" {
+		return fmt.Errorf("bridge manufacturer and model cannot be empty")
+	}
 	if c.BridgeName == "" {
 		return fmt.Errorf("BridgeName cannot be empty")
 	}
@@ -92,6 +260,80 @@ func (c *Config) Validate() error {
 	if c.TailscaleStateDir == "" {
 		return fmt.Errorf("TailscaleStateDir cannot be empty")
 	}
+	if c.TokensPath == "" {
+		return fmt.Errorf("TokensPath cannot be empty")
+	}
+	if err := c.validateWebAuth(); err != nil {
+		return err
+	}
+	if c.LinkQualityAlertThreshold < 0 || c.LinkQualityAlertThreshold > 255 {
+		return fmt.Errorf("link quality alert threshold must be between 0 and 255, got %d", c.LinkQualityAlertThreshold)
+	}
+	if c.LinkQualityAlertDuration < 0 {
+		return fmt.Errorf("link quality alert duration cannot be negative")
+	}
+	if c.AlertSilence < 0 {
+		return fmt.Errorf("alert silence cannot be negative")
+	}
+	if c.StateDedupTTL < 0 {
+		return fmt.Errorf("state dedup TTL cannot be negative")
+	}
+	if c.MQTTMaxClients < 1 {
+		return fmt.Errorf("MQTT max clients must be at least 1, got %d", c.MQTTMaxClients)
+	}
+	if c.MQTTMaxInflight < 1 || c.MQTTMaxInflight > math.MaxUint16 {
+		return fmt.Errorf("MQTT max inflight must be between 1 and %d, got %d", math.MaxUint16, c.MQTTMaxInflight)
+	}
+	if c.MQTTReceiveMaximum < 1 || c.MQTTReceiveMaximum > math.MaxUint16 {
+		return fmt.Errorf("MQTT receive maximum must be between 1 and %d, got %d", math.MaxUint16, c.MQTTReceiveMaximum)
+	}
+	if c.MQTTMaxPacketSize < 0 || c.MQTTMaxPacketSize > math.MaxUint32 {
+		return fmt.Errorf("MQTT max packet size must be between 0 and %d, got %d", uint32(math.MaxUint32), c.MQTTMaxPacketSize)
+	}
+	if c.MQTTServerKeepalive != 0 && (c.MQTTServerKeepalive < time.Second || c.MQTTServerKeepalive > math.MaxUint16*time.Second) {
+		return fmt.Errorf("MQTT server keepalive must be 0 or between 1s and %s", math.MaxUint16*time.Second)
+	}
+	if c.MQTTSysInterval < time.Second {
+		return fmt.Errorf("MQTT $SYS interval must be at least 1s, got %s", c.MQTTSysInterval)
+	}
+	if c.HAPCommandInterval < 0 {
+		return fmt.Errorf("HAP command interval cannot be negative")
+	}
+	if c.HAPCommandInterval > 0 && c.HAPCommandBurst < 1 {
+		return fmt.Errorf("HAP command burst must be at least 1, got %d", c.HAPCommandBurst)
+	}
+	if c.DevicesReloadInterval < 0 {
+		return fmt.Errorf("devices reload interval cannot be negative")
+	}
+	if c.ConfigSnapshotsDir != "" && c.ConfigSnapshotsKeep < 2 {
+		return fmt.Errorf("config snapshots kept must be at least 2, got %d", c.ConfigSnapshotsKeep)
+	}
+	if c.HistoryDir != "" && c.HistoryRetention < 24*time.Hour {
+		return fmt.Errorf("history retention must be at least 24h, got %s", c.HistoryRetention)
+	}
+	if c.MQTTSlowMessage < 0 {
+		return fmt.Errorf("MQTT slow message threshold cannot be negative")
+	}
+	if c.MQTTMaxPayload < 0 {
+		return fmt.Errorf("MQTT max payload cannot be negative")
+	}
+	if c.MQTTBroker != "" {
+		if _, _, err := net.SplitHostPort(c.MQTTBroker); err != nil {
+			return fmt.Errorf("invalid MQTT broker %q, want host:port: %w", c.MQTTBroker, err)
+		}
+		if c.MQTTClientID == "" {
+			return fmt.Errorf("MQTT client ID cannot be empty when using an external broker")
+		}
+		if c.MQTTKeepalive < time.Second || c.MQTTKeepalive > math.MaxUint16*time.Second {
+			return fmt.Errorf("MQTT keepalive must be between 1s and %s", math.MaxUint16*time.Second)
+		}
+	}
+	if c.Discovery && c.DiscoveryPath == "" {
+		return fmt.Errorf("DiscoveryPath cannot be empty when discovery is enabled")
+	}
+	if c.PUID < 0 || c.PGID < 0 {
+		return fmt.Errorf("PUID and PGID cannot be negative")
+	}
 	return nil
 }
 
@@ -210,6 +452,67 @@ func (c *Config) applyNameDefaults() {
 	}
 }
 
+// secretFields lists the values that may be stored encrypted, keyed by their
+// environment variable.
+func (c *Config) secretFields() map[string]*string {
+	return map[string]*string{
+		"Z2M_HOMEKIT_TS_AUTHKEY":    &c.TailscaleAuthKey,
+		"Z2M_HOMEKIT_MQTT_PASSWORD": &c.MQTTPassword,
+		"Z2M_HOMEKIT_WEB_PASSWORD":  &c.WebPassword,
+	}
+}
+
+// decryptSecrets loads the secrets key, if configured, and replaces
+// encrypted values with their plaintext.
+func (c *Config) decryptSecrets() error {
+	if c.SecretsKeyFile != "" {
+		box, err := secrets.LoadKey(c.SecretsKeyFile)
+		if err != nil {
+			return err
+		}
+		c.secrets = box
+	}
+
+	for name, field := range c.secretFields() {
+		plain, err := c.secrets.Open(*field)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", name, err)
+		}
+		*field = plain
+	}
+
+	return nil
+}
+
+// Secrets returns the box for encrypting values at rest, or nil when no key
+// file is configured.
+func (c *Config) Secrets() *secrets.Box {
+	return c.secrets
+}
+
+// DataDirs returns the directories the bridge writes persistent state to.
+func (c *Config) DataDirs() []string {
+	dirs := []string{c.HAPStoragePath, c.TailscaleStateDir, filepath.Dir(c.TokensPath)}
+	for _, dir := range []string{c.HistoryDir, c.ConfigSnapshotsDir} {
+		if dir != "" && !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	paths := []string{c.LifecyclePath, c.CommandLogPath, c.EventJournalPath, c.ScenesPath, c.DisabledPath}
+	if c.Discovery {
+		paths = append(paths, c.DiscoveryPath)
+	}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if dir := filepath.Dir(path); !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
 // SetListenerAddrsForTesting overrides listener addresses in tests.
 func (c *Config) SetListenerAddrsForTesting(hap, web, mqtt string) {
 	c.hapAddr = netip.MustParseAddrPort(hap)
@@ -242,6 +545,27 @@ func validateLogFormat(format string) error {
 	}
 }
 
+func (c *Config) validateWebAuth() error {
+	switch c.WebAuth {
+	case "", "none":
+		return nil
+	case "basic":
+		if c.WebUsername == "" || c.WebPassword == "" {
+			return fmt.Errorf("web username and password are required for basic auth")
+		}
+	case "tailscale":
+		if c.TailscaleAuthKey == "" {
+			return fmt.Errorf("tailscale web auth requires Tailscale to be enabled")
+		}
+		if (c.WebUsername == "") != (c.WebPassword == "") {
+			return fmt.Errorf("web username and password must be set together")
+		}
+	default:
+		return fmt.Errorf("invalid web auth %q, must be 'none', 'basic' or 'tailscale'", c.WebAuth)
+	}
+	return nil
+}
+
 func envVarSet(key string) bool {
 	if key == "" {
 		return false
@@ -0,0 +1,303 @@
+package z2mhomekit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+// maxConfigSize limits the body of /api/v1/config/apply.
+const maxConfigSize = 1 << 20
+
+// ErrInvalidConfig is returned for a devices config that does not load.
+var ErrInvalidConfig = errors.New("invalid devices config")
+
+// restartSections are the config sections only read at startup.
+var restartSections = []string{"night_mode", "smoke_response"}
+
+// HAPImpact is how a config change affects a device's HomeKit accessory.
+type HAPImpact string
+
+const (
+	// HAPNone leaves HomeKit as it is: the device is not exposed there,
+	// or its config is unchanged.
+	HAPNone HAPImpact = "none"
+	// HAPAdded adds an accessory to Home.
+	HAPAdded HAPImpact = "added"
+	// HAPRemoved removes the accessory from Home, with its room, scenes
+	// and automations.
+	HAPRemoved HAPImpact = "removed"
+	// HAPUpdated rebuilds the accessory in place; paired controllers pick
+	// it up without re-pairing.
+	HAPUpdated HAPImpact = "updated"
+	// HAPReplaced changes the accessory's service, e.g. a switch shown as
+	// a fan. Home drops the scenes and automations using it and may only
+	// show the new service once the bridge is paired again.
+	HAPReplaced HAPImpact = "replaced"
+)
+
+// DevicePlan is a device a config adds, removes or changes.
+type DevicePlan struct {
+	ID     string    `json:"id"`
+	Name   string    `json:"name"`
+	Fields []string  `json:"fields,omitempty"` // changed config fields
+	HAP    HAPImpact `json:"hap"`
+}
+
+// HAPPlan sums up what a config does to the HomeKit bridge.
+type HAPPlan struct {
+	// Rebuild is set when the accessories are rebuilt, which restarts the
+	// HAP server and briefly disconnects controllers.
+	Rebuild bool `json:"rebuild"`
+	// RepairNeeded is set when an accessory is replaced, see HAPReplaced.
+	RepairNeeded bool `json:"repair_needed"`
+	// Accessories is the number of device accessories afterwards.
+	Accessories int `json:"accessories"`
+}
+
+// ConfigPlanResponse is what applying a devices config changes, as served
+// by /api/v1/config/apply.
+type ConfigPlanResponse struct {
+	DryRun  bool         `json:"dry_run"`
+	Applied bool         `json:"applied"`
+	Add     []DevicePlan `json:"add"`
+	Remove  []DevicePlan `json:"remove"`
+	Change  []DevicePlan `json:"change"`
+	// Sections lists the other changed config sections, e.g. groups.
+	Sections []string `json:"sections,omitempty"`
+	// RestartRequired lists the changed sections that only apply on
+	// restart.
+	RestartRequired []string `json:"restart_required,omitempty"`
+	HAP             HAPPlan  `json:"hap"`
+}
+
+// String summarises the plan, e.g. "1 added, 0 removed, 2 changed".
+func (p ConfigPlanResponse) String() string {
+	return fmt.Sprintf("%d added, %d removed, %d changed", len(p.Add), len(p.Remove), len(p.Change))
+}
+
+// planConfig compares the running devices and the config file's sections
+// to next, for the devices exposed on bridge. current is nil when the file
+// does not load.
+func planConfig(running []devices.Device, current, next *devices.Config, bridge string) ConfigPlanResponse {
+	plan := ConfigPlanResponse{Add: []DevicePlan{}, Remove: []DevicePlan{}, Change: []DevicePlan{}}
+
+	before := make(map[string]devices.Device, len(running))
+	for _, d := range running {
+		before[d.ID] = d
+	}
+	for _, d := range next.Devices {
+		if d.ExposedOn(bridge) {
+			plan.HAP.Accessories++
+		}
+		prev, ok := before[d.ID]
+		switch {
+		case !ok:
+			plan.Add = append(plan.Add, DevicePlan{ID: d.ID, Name: d.Name, HAP: hapImpact(nil, &d, bridge)})
+		case !reflect.DeepEqual(prev, d):
+			plan.Change = append(plan.Change, DevicePlan{ID: d.ID, Name: d.Name, Fields: changedFields(prev, d), HAP: hapImpact(&prev, &d, bridge)})
+		}
+		delete(before, d.ID)
+	}
+	for _, d := range running {
+		if _, ok := before[d.ID]; ok {
+			plan.Remove = append(plan.Remove, DevicePlan{ID: d.ID, Name: d.Name, HAP: hapImpact(&d, nil, bridge)})
+		}
+	}
+
+	if current == nil {
+		current = &devices.Config{}
+	}
+	currentSections, nextSections := *current, *next
+	currentSections.Devices, nextSections.Devices = nil, nil
+	plan.Sections = changedFields(currentSections, nextSections)
+	for _, section := range plan.Sections {
+		if slices.Contains(restartSections, section) {
+			plan.RestartRequired = append(plan.RestartRequired, section)
+		}
+	}
+
+	for _, d := range slices.Concat(plan.Add, plan.Remove, plan.Change) {
+		if d.HAP != HAPNone {
+			plan.HAP.Rebuild = true
+		}
+		if d.HAP == HAPReplaced {
+			plan.HAP.RepairNeeded = true
+		}
+	}
+	if slices.Contains(plan.Sections, "scenes") {
+		plan.HAP.Rebuild = true
+	}
+	return plan
+}
+
+// hapImpact returns how changing a device from prev to next, either nil
+// when the device is added or removed, affects its accessory on bridge.
+func hapImpact(prev, next *devices.Device, bridge string) HAPImpact {
+	wasExposed := prev != nil && prev.ExposedOn(bridge)
+	isExposed := next != nil && next.ExposedOn(bridge)
+	switch {
+	case !wasExposed && !isExposed:
+		return HAPNone
+	case !wasExposed:
+		return HAPAdded
+	case !isExposed:
+		return HAPRemoved
+	case prev.Type != next.Type || prev.HomeKitPresentation() != next.HomeKitPresentation() || prev.Category != next.Category:
+		return HAPReplaced
+	case reflect.DeepEqual(*prev, *next):
+		return HAPNone
+	}
+	return HAPUpdated
+}
+
+// changedFields returns the JSON fields that differ between two values of
+// the same struct type, sorted.
+func changedFields(a, b any) []string {
+	var x, y map[string]json.RawMessage
+	if data, err := json.Marshal(a); err == nil {
+		_ = json.Unmarshal(data, &x)
+	}
+	if data, err := json.Marshal(b); err == nil {
+		_ = json.Unmarshal(data, &y)
+	}
+
+	var fields []string
+	for name, value := range x {
+		if other, ok := y[name]; !ok || string(other) != string(value) {
+			fields = append(fields, name)
+		}
+	}
+	for name := range y {
+		if _, ok := x[name]; !ok {
+			fields = append(fields, name)
+		}
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+// ApplyConfig plans replacing the devices config file with data and,
+// unless dryRun is set, writes and applies it as applied by source. The
+// file is only replaced once data loads, and is restored if applying it
+// fails.
+func (b *Bridge) ApplyConfig(data []byte, dryRun bool, source string) (ConfigPlanResponse, error) {
+	b.configMu.Lock()
+	defer b.configMu.Unlock()
+
+	var discovered []devices.Device
+	if b.cfg.Discovery {
+		var err error
+		discovered, err = devices.LoadDiscovered(b.cfg.DiscoveryPath)
+		if err != nil {
+			return ConfigPlanResponse{}, err
+		}
+	}
+	next, err := devices.ParseConfig(data, discovered, b.cfg.Discovery)
+	if err != nil {
+		return ConfigPlanResponse{}, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	path := b.cfg.DevicesConfigPath
+	old, err := os.ReadFile(path)
+	if err != nil {
+		return ConfigPlanResponse{}, fmt.Errorf("failed to read devices config file: %w", err)
+	}
+	current, err := devices.ParseConfig(old, discovered, b.cfg.Discovery)
+	if err != nil {
+		current = nil
+	}
+
+	b.updateMu.Lock()
+	running := slices.Clone(b.devices)
+	b.updateMu.Unlock()
+
+	plan := planConfig(running, current, next, b.cfg.BridgeName)
+	if dryRun {
+		plan.DryRun = true
+		return plan, nil
+	}
+
+	if err := writeDevicesConfig(path, data); err != nil {
+		return ConfigPlanResponse{}, err
+	}
+	if _, err := b.reloadDevicesBy(source); err != nil {
+		if restoreErr := writeDevicesConfig(path, old); restoreErr != nil {
+			b.logger.Error("Failed to restore devices config", "path", path, "error", restoreErr)
+		}
+		return ConfigPlanResponse{}, err
+	}
+	b.logger.Info("Applied devices config", "path", path, "by", source, "changes", plan.String())
+	plan.Applied = true
+	return plan, nil
+}
+
+// writeDevicesConfig replaces the devices config file at path with data.
+func writeDevicesConfig(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write devices config: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write devices config: %w", err)
+	}
+	return nil
+}
+
+// SetConfigApplier enables /api/v1/config/apply, applying with apply.
+func (ws *WebServer) SetConfigApplier(apply func(data []byte, dryRun bool, source string) (ConfigPlanResponse, error)) {
+	ws.applyConfig = apply
+}
+
+// HandleConfigApply replaces the devices config with the HuJSON body and
+// returns what changed. With dry_run=true it only returns what would
+// change.
+func (ws *WebServer) HandleConfigApply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ws.applyConfig == nil {
+		http.Error(w, "Config apply is unavailable", http.StatusNotFound)
+		return
+	}
+
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "Invalid dry_run", http.StatusBadRequest)
+			return
+		}
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxConfigSize))
+	if err != nil {
+		http.Error(w, "Failed to read config: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	by := "API: " + requestActor(r)
+	plan, err := ws.applyConfig(data, dryRun, by)
+	if err != nil {
+		if errors.Is(err, ErrInvalidConfig) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ws.logger.Error("Failed to apply devices config", "error", err)
+		http.Error(w, "Failed to apply config: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if plan.Applied {
+		ws.LogEvent(fmt.Sprintf("%s: Applied devices config (%s)", by, plan))
+	}
+	ws.writeJSON(w, plan)
+}
@@ -0,0 +1,146 @@
+package z2mhomekit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	appconfig "github.com/kradalby/z2m-homekit/config"
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+func TestPlanConfig(t *testing.T) {
+	on, off := true, false
+	running := []devices.Device{
+		{ID: "lamp", Name: "Lamp", Topic: "lamp", Type: devices.DeviceTypeLightbulb, HomeKit: &on, Web: &on},
+		{ID: "plug", Name: "Plug", Topic: "plug", Type: devices.DeviceTypeOutlet, HomeKit: &on, Web: &on},
+		{ID: "fan", Name: "Fan", Topic: "fan", Type: devices.DeviceTypeOutlet, HomeKit: &on, Web: &on},
+		{ID: "door", Name: "Door", Topic: "door", Type: devices.DeviceTypeContactSensor, HomeKit: &on, Web: &on},
+	}
+	next := &devices.Config{
+		Devices: []devices.Device{
+			{ID: "lamp", Name: "Lamp", Topic: "lamp", Type: devices.DeviceTypeLightbulb, HomeKit: &on, Web: &on, Room: "Hall"},
+			{ID: "fan", Name: "Fan", Topic: "fan", Type: devices.DeviceTypeOutlet, Presentation: devices.PresentationFan, HomeKit: &on, Web: &on},
+			{ID: "door", Name: "Door", Topic: "door", Type: devices.DeviceTypeContactSensor, HomeKit: &off, Web: &on},
+			{ID: "leak", Name: "Leak", Topic: "leak", Type: devices.DeviceTypeLeakSensor, HomeKit: &on, Web: &on},
+		},
+		NightMode: &devices.NightMode{},
+	}
+
+	plan := planConfig(running, &devices.Config{Devices: running}, next, "main")
+
+	if len(plan.Add) != 1 || plan.Add[0].ID != "leak" || plan.Add[0].HAP != HAPAdded {
+		t.Errorf("Add = %+v", plan.Add)
+	}
+	if len(plan.Remove) != 1 || plan.Remove[0].ID != "plug" || plan.Remove[0].HAP != HAPRemoved {
+		t.Errorf("Remove = %+v", plan.Remove)
+	}
+	want := map[string]HAPImpact{"lamp": HAPUpdated, "fan": HAPReplaced, "door": HAPRemoved}
+	if len(plan.Change) != len(want) {
+		t.Errorf("Change = %+v", plan.Change)
+	}
+	for _, d := range plan.Change {
+		if d.HAP != want[d.ID] {
+			t.Errorf("%s HAP impact = %s, want %s", d.ID, d.HAP, want[d.ID])
+		}
+		if d.ID == "lamp" && !slices.Equal(d.Fields, []string{"room"}) {
+			t.Errorf("lamp fields = %v, want [room]", d.Fields)
+		}
+	}
+	if !plan.HAP.Rebuild || !plan.HAP.RepairNeeded || plan.HAP.Accessories != 3 {
+		t.Errorf("HAP = %+v", plan.HAP)
+	}
+	if !slices.Equal(plan.Sections, []string{"night_mode"}) || !slices.Equal(plan.RestartRequired, []string{"night_mode"}) {
+		t.Errorf("Sections = %v, RestartRequired = %v", plan.Sections, plan.RestartRequired)
+	}
+}
+
+func TestBridgeApplyConfigDryRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.hujson")
+	current := `{"devices": [{"id": "plug", "name": "Plug", "topic": "plug", "type": "outlet"}]}`
+	if err := os.WriteFile(path, []byte(current), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	deviceCfg, err := devices.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	b := &Bridge{
+		cfg:     &appconfig.Config{DevicesConfigPath: path, BridgeName: "main"},
+		devices: deviceCfg.Devices,
+		logger:  testLogger(),
+	}
+
+	next := `{
+  // The plug is now a lamp.
+  "devices": [{"id": "lamp", "name": "Lamp", "topic": "lamp", "type": "lightbulb"}],
+}`
+	plan, err := b.ApplyConfig([]byte(next), true, "test")
+	if err != nil {
+		t.Fatalf("ApplyConfig: %v", err)
+	}
+	if !plan.DryRun || plan.Applied || len(plan.Add) != 1 || len(plan.Remove) != 1 {
+		t.Errorf("plan = %+v", plan)
+	}
+	if data, _ := os.ReadFile(path); string(data) != current {
+		t.Errorf("dry run changed the config file:\n%s", data)
+	}
+
+	if _, err := b.ApplyConfig([]byte(`{"devices": [{"id": "lamp"}]}`), false, "test"); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("ApplyConfig with an invalid config = %v, want ErrInvalidConfig", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != current {
+		t.Errorf("invalid config was written:\n%s", data)
+	}
+}
+
+func TestHandleConfigApply(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+
+	var dryRuns []bool
+	ws.SetConfigApplier(func(data []byte, dryRun bool, source string) (ConfigPlanResponse, error) {
+		if string(data) == "bad" {
+			return ConfigPlanResponse{}, ErrInvalidConfig
+		}
+		dryRuns = append(dryRuns, dryRun)
+		return ConfigPlanResponse{DryRun: dryRun, Applied: !dryRun, Add: []DevicePlan{{ID: "lamp", HAP: HAPAdded}}}, nil
+	})
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		ws.HandleConfigApply(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := post("/api/v1/config/apply?dry_run=true", "{}")
+	var plan ConfigPlanResponse
+	if err := json.NewDecoder(rec.Body).Decode(&plan); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !plan.DryRun || len(plan.Add) != 1 {
+		t.Errorf("dry run plan = %+v", plan)
+	}
+
+	if rec := post("/api/v1/config/apply", "{}"); rec.Code != http.StatusOK {
+		t.Errorf("apply status = %d", rec.Code)
+	}
+	if last := ws.eventLog[len(ws.eventLog)-1]; !strings.HasSuffix(last, "Applied devices config (1 added, 0 removed, 0 changed)") {
+		t.Errorf("last event = %q", last)
+	}
+	if !slices.Equal(dryRuns, []bool{true, false}) {
+		t.Errorf("dry runs = %v", dryRuns)
+	}
+
+	if rec := post("/api/v1/config/apply", "bad"); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid config status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := post("/api/v1/config/apply?dry_run=maybe", "{}"); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid dry_run status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,382 @@
+package z2mhomekit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chasefleming/elem-go"
+	"github.com/chasefleming/elem-go/attrs"
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+// configSnapshotLayout names the snapshot files, so they sort by time.
+const configSnapshotLayout = "20060102T150405.000Z"
+
+// diffContext is how many unchanged lines are shown around a change.
+const diffContext = 3
+
+// ErrSnapshotNotFound is returned for a config snapshot that does not
+// exist.
+var ErrSnapshotNotFound = errors.New("config snapshot not found")
+
+// ConfigSnapshot is a version of the devices config file as it was
+// applied.
+type ConfigSnapshot struct {
+	ID      string    `json:"id"`
+	At      time.Time `json:"at"`
+	Source  string    `json:"source"`  // what applied it, e.g. "file" or "rollback"
+	Changes string    `json:"changes"` // the device changes it made
+	Config  string    `json:"config"`
+}
+
+// ConfigSnapshots keeps the last versions of the devices config, one JSON
+// file each, so a bad edit can be rolled back. A version is only saved
+// when it differs from the one before.
+type ConfigSnapshots struct {
+	dir  string
+	keep int
+
+	mu        sync.Mutex
+	snapshots []ConfigSnapshot // oldest first
+}
+
+// OpenConfigSnapshots opens the snapshots in dir, keeping the last keep.
+func OpenConfigSnapshots(dir string, keep int) (*ConfigSnapshots, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create config snapshot directory: %w", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+
+	s := &ConfigSnapshots{dir: dir, keep: keep}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config snapshot: %w", err)
+		}
+		var snapshot ConfigSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("failed to parse config snapshot %s: %w", path, err)
+		}
+		s.snapshots = append(s.snapshots, snapshot)
+	}
+	return s, nil
+}
+
+// Save records config as applied by source, unless it is the same as the
+// latest snapshot. It reports whether a snapshot was saved.
+func (s *ConfigSnapshots) Save(config []byte, source, changes string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n := len(s.snapshots); n > 0 && s.snapshots[n-1].Config == string(config) {
+		return false, nil
+	}
+
+	at := time.Now().UTC()
+	// IDs have millisecond precision; keep them unique and in order.
+	if n := len(s.snapshots); n > 0 && !at.After(s.snapshots[n-1].At.Add(time.Millisecond)) {
+		at = s.snapshots[n-1].At.Add(time.Millisecond)
+	}
+	snapshot := ConfigSnapshot{
+		ID:      at.Format(configSnapshotLayout),
+		At:      at,
+		Source:  source,
+		Changes: changes,
+		Config:  string(config),
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return false, err
+	}
+	path := filepath.Join(s.dir, snapshot.ID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return false, fmt.Errorf("failed to write config snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return false, fmt.Errorf("failed to write config snapshot: %w", err)
+	}
+	s.snapshots = append(s.snapshots, snapshot)
+
+	for len(s.snapshots) > s.keep {
+		if err := os.Remove(filepath.Join(s.dir, s.snapshots[0].ID+".json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return true, fmt.Errorf("failed to delete old config snapshot: %w", err)
+		}
+		s.snapshots = s.snapshots[1:]
+	}
+	return true, nil
+}
+
+// List returns the snapshots, newest first.
+func (s *ConfigSnapshots) List() []ConfigSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := slices.Clone(s.snapshots)
+	slices.Reverse(list)
+	return list
+}
+
+// Get returns the snapshot with id and the one saved before it, which is
+// the zero value for the oldest snapshot.
+func (s *ConfigSnapshots) Get(id string) (snapshot, previous ConfigSnapshot, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, snap := range s.snapshots {
+		if snap.ID != id {
+			continue
+		}
+		if i > 0 {
+			previous = s.snapshots[i-1]
+		}
+		return snap, previous, nil
+	}
+	return ConfigSnapshot{}, ConfigSnapshot{}, ErrSnapshotNotFound
+}
+
+// Latest returns the newest snapshot, and false when there is none.
+func (s *ConfigSnapshots) Latest() (ConfigSnapshot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.snapshots) == 0 {
+		return ConfigSnapshot{}, false
+	}
+	return s.snapshots[len(s.snapshots)-1], true
+}
+
+// SetConfigSnapshots enables the config history pages, rolling back with
+// rollback.
+func (ws *WebServer) SetConfigSnapshots(s *ConfigSnapshots, rollback func(id string) (devices.DeviceChanges, error)) {
+	ws.configSnapshots = s
+	ws.rollbackConfig = rollback
+}
+
+// HandleConfigSnapshots lists the saved versions of the devices config at
+// /config/snapshots, shows one with what it changed at
+// /config/snapshots/<id>, and rolls back to it on POST to
+// /config/snapshots/<id>/rollback.
+func (ws *WebServer) HandleConfigSnapshots(w http.ResponseWriter, r *http.Request) {
+	if ws.configSnapshots == nil {
+		http.Error(w, "Config snapshots are disabled", http.StatusNotFound)
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/config/snapshots"), "/")
+	id, rollback := strings.CutSuffix(rest, "/rollback")
+
+	if rollback {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		changes, err := ws.rollbackConfig(id)
+		if err != nil {
+			if errors.Is(err, ErrSnapshotNotFound) {
+				http.Error(w, "Snapshot not found", http.StatusNotFound)
+				return
+			}
+			ws.logger.Error("Failed to roll back devices config", "snapshot", id, "error", err)
+			http.Error(w, "Failed to roll back: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ws.LogEvent(fmt.Sprintf("Web UI: Rolled back devices config to %s (%s)", id, changes))
+		http.Redirect(w, r, "/config/snapshots", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	content := ws.renderConfigSnapshots()
+	if id != "" {
+		snapshot, previous, err := ws.configSnapshots.Get(id)
+		if err != nil {
+			http.Error(w, "Snapshot not found", http.StatusNotFound)
+			return
+		}
+		content = ws.renderConfigSnapshot(snapshot, previous)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := fmt.Fprint(w, ws.renderPage("z2m-homekit · config history", content)); err != nil {
+		ws.logger.Error("Failed to write config snapshots response", slog.Any("error", err))
+	}
+}
+
+func (ws *WebServer) renderConfigSnapshots() elem.Node {
+	rows := []elem.Node{
+		elem.Tr(attrs.Props{},
+			elem.Th(attrs.Props{}, elem.Text("Applied")),
+			elem.Th(attrs.Props{}, elem.Text("By")),
+			elem.Th(attrs.Props{}, elem.Text("Changes")),
+			elem.Th(attrs.Props{}, elem.Text("")),
+		),
+	}
+	for i, s := range ws.configSnapshots.List() {
+		actions := []elem.Node{
+			elem.A(attrs.Props{attrs.Href: "/config/snapshots/" + s.ID}, elem.Text("Diff")),
+		}
+		if i == 0 {
+			actions = append(actions, elem.Text(" · current"))
+		} else {
+			actions = append(actions, renderRollbackForm(s.ID))
+		}
+		rows = append(rows, elem.Tr(attrs.Props{"data-snapshot-id": s.ID},
+			elem.Td(attrs.Props{}, elem.Text(s.At.Local().Format("2006-01-02 15:04:05"))),
+			elem.Td(attrs.Props{}, elem.Text(s.Source)),
+			elem.Td(attrs.Props{}, elem.Text(s.Changes)),
+			elem.Td(attrs.Props{}, actions...),
+		))
+	}
+
+	return elem.Div(attrs.Props{},
+		elem.H1(attrs.Props{}, elem.Text("Config History")),
+		elem.P(attrs.Props{}, elem.A(attrs.Props{attrs.Href: "/"}, elem.Text("Back to dashboard"))),
+		elem.P(attrs.Props{}, elem.Text("Each version of the devices config as it was applied. Rolling back writes the version back to the config file and reloads it.")),
+		elem.Table(attrs.Props{attrs.Class: "tokens-table"}, rows...),
+	)
+}
+
+func (ws *WebServer) renderConfigSnapshot(snapshot, previous ConfigSnapshot) elem.Node {
+	content := []elem.Node{
+		elem.H1(attrs.Props{}, elem.Text("Config "+snapshot.At.Local().Format("2006-01-02 15:04:05"))),
+		elem.P(attrs.Props{}, elem.A(attrs.Props{attrs.Href: "/config/snapshots"}, elem.Text("Back to config history"))),
+		elem.P(attrs.Props{}, elem.Text(fmt.Sprintf("Applied by %s: %s", snapshot.Source, snapshot.Changes))),
+		elem.H2(attrs.Props{}, elem.Text("Changes from the version before")),
+		renderDiff(lineDiff(previous.Config, snapshot.Config)),
+	}
+
+	if latest, ok := ws.configSnapshots.Latest(); ok && latest.ID != snapshot.ID {
+		content = append(content,
+			elem.H2(attrs.Props{}, elem.Text("Rolling back changes the current config by")),
+			renderDiff(lineDiff(latest.Config, snapshot.Config)),
+			renderRollbackForm(snapshot.ID),
+		)
+	}
+	return elem.Div(attrs.Props{}, content...)
+}
+
+func renderRollbackForm(id string) elem.Node {
+	return elem.Form(attrs.Props{attrs.Method: "post", attrs.Action: "/config/snapshots/" + id + "/rollback", attrs.Class: "rollback-form"},
+		elem.Button(attrs.Props{attrs.Type: "submit", attrs.Class: "off"}, elem.Text("Roll back")),
+	)
+}
+
+// diffLine is a line of a diff: op is ' ' for an unchanged line, '-' for
+// a removed one and '+' for an added one.
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// lineDiff returns the lines of b as changed from a, from their longest
+// common subsequence of lines.
+func lineDiff(a, b string) []diffLine {
+	x, y := splitLines(a), splitLines(b)
+
+	// Lines the same at the start and end need no table.
+	var head, tail []diffLine
+	for len(x) > 0 && len(y) > 0 && x[0] == y[0] {
+		head = append(head, diffLine{' ', x[0]})
+		x, y = x[1:], y[1:]
+	}
+	for len(x) > 0 && len(y) > 0 && x[len(x)-1] == y[len(y)-1] {
+		tail = append(tail, diffLine{' ', x[len(x)-1]})
+		x, y = x[:len(x)-1], y[:len(y)-1]
+	}
+	slices.Reverse(tail)
+
+	// common[i][j] is the length of the longest common subsequence of
+	// x[i:] and y[j:].
+	common := make([][]int, len(x)+1)
+	for i := range common {
+		common[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	lines := head
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			lines = append(lines, diffLine{' ', x[i]})
+			i++
+			j++
+		case j < len(y) && (i == len(x) || common[i][j+1] >= common[i+1][j]):
+			lines = append(lines, diffLine{'+', y[j]})
+			j++
+		default:
+			lines = append(lines, diffLine{'-', x[i]})
+			i++
+		}
+	}
+	return append(lines, tail...)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// renderDiff renders the changed lines of a diff with diffContext lines
+// around them, eliding the rest.
+func renderDiff(lines []diffLine) elem.Node {
+	show := make([]bool, len(lines))
+	changed := false
+	for i, l := range lines {
+		if l.op == ' ' {
+			continue
+		}
+		changed = true
+		for k := max(0, i-diffContext); k <= min(len(lines)-1, i+diffContext); k++ {
+			show[k] = true
+		}
+	}
+	if !changed {
+		return elem.P(attrs.Props{}, elem.Text("No changes."))
+	}
+
+	var nodes []elem.Node
+	for i, l := range lines {
+		if !show[i] {
+			if i == 0 || show[i-1] {
+				nodes = append(nodes, elem.Span(attrs.Props{attrs.Class: "diff-skip"}, elem.Text("…\n")))
+			}
+			continue
+		}
+		class := "diff-same"
+		switch l.op {
+		case '+':
+			class = "diff-add"
+		case '-':
+			class = "diff-del"
+		}
+		nodes = append(nodes, elem.Span(attrs.Props{attrs.Class: class}, elem.Text(string(l.op)+" "+l.text+"\n")))
+	}
+	return elem.Pre(attrs.Props{attrs.Class: "config-diff"}, nodes...)
+}
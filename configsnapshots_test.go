@@ -0,0 +1,116 @@
+package z2mhomekit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+func TestConfigSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenConfigSnapshots(dir, 2)
+	if err != nil {
+		t.Fatalf("OpenConfigSnapshots: %v", err)
+	}
+
+	for i, config := range []string{"a\n", "a\n", "b\n", "c\n"} {
+		saved, err := s.Save([]byte(config), "file", "no device changes")
+		if err != nil {
+			t.Fatalf("Save %d: %v", i, err)
+		}
+		if want := i != 1; saved != want {
+			t.Errorf("Save %d (%q) saved = %v, want %v", i, config, saved, want)
+		}
+	}
+
+	list := s.List()
+	if len(list) != 2 || list[0].Config != "c\n" || list[1].Config != "b\n" {
+		t.Fatalf("List() = %+v, want c then b", list)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(files) != 2 {
+		t.Errorf("snapshot files = %v, want the last 2", files)
+	}
+
+	reopened, err := OpenConfigSnapshots(dir, 2)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	snapshot, previous, err := reopened.Get(list[0].ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if snapshot.Config != "c\n" || previous.Config != "b\n" {
+		t.Errorf("Get = %q after %q, want c after b", snapshot.Config, previous.Config)
+	}
+	if _, _, err := reopened.Get("missing"); err != ErrSnapshotNotFound {
+		t.Errorf("Get(missing) = %v, want ErrSnapshotNotFound", err)
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	var got []string
+	for _, l := range lineDiff("a\nb\nc\nd\n", "a\nc\nx\nd\n") {
+		got = append(got, string(l.op)+l.text)
+	}
+	want := []string{" a", "-b", " c", "+x", " d"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("lineDiff = %q, want %q", got, want)
+	}
+
+	if lines := lineDiff("", "a\n"); len(lines) != 1 || lines[0].op != '+' {
+		t.Errorf("lineDiff from nothing = %+v", lines)
+	}
+}
+
+func TestHandleConfigSnapshots(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+
+	req := httptest.NewRequest(http.MethodGet, "/config/snapshots", nil)
+	rec := httptest.NewRecorder()
+	ws.HandleConfigSnapshots(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status without snapshots = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	s, err := OpenConfigSnapshots(t.TempDir(), 10)
+	if err != nil {
+		t.Fatalf("OpenConfigSnapshots: %v", err)
+	}
+	for _, config := range []string{"{\n  lamp\n  plug\n}\n", "{\n  lamp\n}\n"} {
+		if _, err := s.Save([]byte(config), "file", "removed plug"); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	first := s.List()[1]
+
+	var rolledBack []string
+	ws.SetConfigSnapshots(s, func(id string) (devices.DeviceChanges, error) {
+		rolledBack = append(rolledBack, id)
+		return devices.DeviceChanges{Added: []string{"plug"}}, nil
+	})
+
+	rec = httptest.NewRecorder()
+	ws.HandleConfigSnapshots(rec, httptest.NewRequest(http.MethodGet, "/config/snapshots", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `action="/config/snapshots/`+first.ID+`/rollback"`) {
+		t.Errorf("list lacks a rollback for the first snapshot:\n%s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	ws.HandleConfigSnapshots(rec, httptest.NewRequest(http.MethodGet, "/config/snapshots/"+s.List()[0].ID, nil))
+	if body := rec.Body.String(); !strings.Contains(body, `<span class="diff-del">-   plug`) {
+		t.Errorf("diff lacks the removed plug:\n%s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	ws.HandleConfigSnapshots(rec, httptest.NewRequest(http.MethodPost, "/config/snapshots/"+first.ID+"/rollback", nil))
+	if rec.Code != http.StatusSeeOther || len(rolledBack) != 1 || rolledBack[0] != first.ID {
+		t.Errorf("rollback status = %d, rolled back %v", rec.Code, rolledBack)
+	}
+	if last := ws.eventLog[len(ws.eventLog)-1]; !strings.HasSuffix(last, "Rolled back devices config to "+first.ID+" (added plug)") {
+		t.Errorf("last event = %q", last)
+	}
+}
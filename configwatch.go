@@ -0,0 +1,125 @@
+package z2mhomekit
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/devices"
+	"github.com/kradalby/z2m-homekit/events"
+	"tailscale.com/util/eventbus"
+)
+
+// ConfigWatcher applies changes to the devices config file while the
+// bridge runs. The file is polled rather than watched for events, which
+// also catches editors that replace the file and bind mounts that do not
+// pass events through. A change is applied once the file has stayed the
+// same for one interval, so a half-written file is not loaded.
+//
+// Each reload is reported as the status of the config component:
+// connected with what changed, or failed with why the file did not load.
+// A file that fails to load leaves the running devices as they were.
+type ConfigWatcher struct {
+	path     string
+	interval time.Duration
+	apply    func() (devices.DeviceChanges, error)
+	bus      *events.Bus
+	client   *eventbus.Client
+	logger   *slog.Logger
+
+	loaded  fileStamp // the file as last applied
+	pending fileStamp // a change waiting to settle
+}
+
+// fileStamp identifies a version of a file; the zero value is a missing
+// file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewConfigWatcher returns a watcher applying changes to the file at path
+// with apply, checking every interval.
+func NewConfigWatcher(path string, interval time.Duration, apply func() (devices.DeviceChanges, error), bus *events.Bus, logger *slog.Logger) (*ConfigWatcher, error) {
+	client, err := bus.Client(events.ClientConfig)
+	if err != nil {
+		return nil, err
+	}
+	w := &ConfigWatcher{
+		path:     path,
+		interval: interval,
+		apply:    apply,
+		bus:      bus,
+		client:   client,
+		logger:   logger.With(slog.String("component", string(events.ClientConfig))),
+	}
+	w.loaded, _ = w.stat()
+	return w, nil
+}
+
+// Run checks the file until ctx is cancelled.
+func (w *ConfigWatcher) Run(ctx context.Context) {
+	w.publish(events.ConnectionStatusConnected, "", "watching "+w.path)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.check()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// check applies the file if it changed and has since settled.
+func (w *ConfigWatcher) check() {
+	stamp, err := w.stat()
+	if err != nil {
+		if w.loaded != (fileStamp{}) {
+			w.logger.Warn("Failed to check devices config", "path", w.path, "error", err)
+			w.publish(events.ConnectionStatusFailed, err.Error(), "")
+		}
+		w.loaded = fileStamp{}
+		return
+	}
+	if stamp == w.loaded {
+		w.pending = fileStamp{}
+		return
+	}
+	if stamp != w.pending {
+		w.pending = stamp
+		return
+	}
+
+	w.loaded = stamp
+	w.pending = fileStamp{}
+	changes, err := w.apply()
+	if err != nil {
+		w.logger.Error("Failed to reload devices config, keeping the running devices", "path", w.path, "error", err)
+		w.publish(events.ConnectionStatusFailed, err.Error(), "")
+		return
+	}
+	w.logger.Info("Reloaded devices config", "path", w.path, "changes", changes.String())
+	w.publish(events.ConnectionStatusConnected, "", "reloaded: "+changes.String())
+}
+
+func (w *ConfigWatcher) stat() (fileStamp, error) {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+func (w *ConfigWatcher) publish(status events.ConnectionStatus, errMsg, detail string) {
+	w.bus.PublishConnectionStatus(w.client, events.ConnectionStatusEvent{
+		Timestamp: time.Now(),
+		Component: string(events.ClientConfig),
+		Status:    status,
+		Error:     errMsg,
+		Detail:    detail,
+	})
+}
@@ -0,0 +1,78 @@
+package z2mhomekit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/devices"
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+func TestConfigWatcher(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	path := filepath.Join(t.TempDir(), "devices.hujson")
+	write := func(content string, modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now().Add(-time.Hour)
+	write(`{"devices": []}`, start)
+
+	applied := 0
+	var applyErr error
+	w, err := NewConfigWatcher(path, time.Second, func() (devices.DeviceChanges, error) {
+		applied++
+		return devices.DeviceChanges{Added: []string{"lamp"}}, applyErr
+	}, bus, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := func() events.ConnectionStatusEvent {
+		for _, evt := range bus.ConnectionStatuses() {
+			if evt.Component == string(events.ClientConfig) {
+				return evt
+			}
+		}
+		return events.ConnectionStatusEvent{}
+	}
+
+	w.check()
+	if applied != 0 {
+		t.Fatal("unchanged config applied")
+	}
+
+	write(`{"devices": [{"id": "lamp"}]}`, start.Add(time.Minute))
+	w.check()
+	if applied != 0 {
+		t.Fatal("config applied before it settled")
+	}
+	w.check()
+	if applied != 1 {
+		t.Fatalf("changed config applied %d times, want once", applied)
+	}
+	if got := status(); got.Status != events.ConnectionStatusConnected || got.Detail != "reloaded: added lamp" {
+		t.Errorf("status = %s %q, want connected with the changes", got.Status, got.Detail)
+	}
+	w.check()
+	if applied != 1 {
+		t.Error("config applied again without changing")
+	}
+
+	applyErr = errors.New("device lamp has invalid type")
+	write(`{"devices": [{"id": "lamp", "type": "lamp"}]}`, start.Add(2*time.Minute))
+	w.check()
+	w.check()
+	if got := status(); got.Status != events.ConnectionStatusFailed || got.Error != applyErr.Error() {
+		t.Errorf("status = %s %q, want failed with the load error", got.Status, got.Error)
+	}
+}
@@ -0,0 +1,104 @@
+package z2mhomekit
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	appconfig "github.com/kradalby/z2m-homekit/config"
+)
+
+// runningInContainer reports whether the process appears to run inside a
+// Docker or Podman container.
+func runningInContainer() bool {
+	for _, marker := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+	return os.Getenv("container") != ""
+}
+
+// prepareDataDirs creates the data directories, hands them to PUID/PGID when
+// running as root, drops privileges to that user, and then verifies that the
+// directories are writable. It fails early with a clear error instead of
+// letting HAP pairing or Tailscale state writes fail later on.
+func prepareDataDirs(cfg *appconfig.Config, logger *slog.Logger) error {
+	dirs := cfg.DataDirs()
+
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return dataDirError(dir, err)
+		}
+	}
+
+	if cfg.PUID > 0 || cfg.PGID > 0 {
+		if os.Geteuid() == 0 {
+			uid, gid := cfg.PUID, cfg.PGID
+			if uid == 0 {
+				uid = -1
+			}
+			if gid == 0 {
+				gid = -1
+			}
+			for _, dir := range dirs {
+				if err := chownTree(dir, uid, gid); err != nil {
+					return fmt.Errorf("failed to chown data directory %q to %d:%d: %w", dir, cfg.PUID, cfg.PGID, err)
+				}
+			}
+			if err := dropPrivileges(cfg.PUID, cfg.PGID); err != nil {
+				return fmt.Errorf("failed to switch to PUID=%d PGID=%d: %w", cfg.PUID, cfg.PGID, err)
+			}
+			logger.Info("Dropped privileges", "uid", os.Getuid(), "gid", os.Getgid())
+		} else if cfg.PUID > 0 && cfg.PUID != os.Getuid() {
+			logger.Warn("PUID is set but the process is not running as root, ignoring",
+				"puid", cfg.PUID,
+				"uid", os.Getuid(),
+			)
+		}
+	}
+
+	for _, dir := range dirs {
+		if err := checkWritable(dir); err != nil {
+			return dataDirError(dir, err)
+		}
+	}
+
+	return nil
+}
+
+func chownTree(root string, uid, gid int) error {
+	return filepath.WalkDir(root, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, uid, gid)
+	})
+}
+
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".write-test-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	if err := f.Close(); err != nil {
+		_ = os.Remove(name)
+		return err
+	}
+	return os.Remove(name)
+}
+
+func dataDirError(dir string, err error) error {
+	if errors.Is(err, syscall.EROFS) {
+		return fmt.Errorf("data directory %q is on a read-only filesystem; mount the volume read-write: %w", dir, err)
+	}
+	if errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("data directory %q is not writable by uid %d; fix the volume ownership or set PUID/PGID: %w", dir, os.Getuid(), err)
+	}
+	return fmt.Errorf("data directory %q is not usable: %w", dir, err)
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package z2mhomekit
+
+import "errors"
+
+func dropPrivileges(uid, gid int) error {
+	return errors.New("PUID/PGID are only supported on Unix")
+}
@@ -0,0 +1,55 @@
+package z2mhomekit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	appconfig "github.com/kradalby/z2m-homekit/config"
+)
+
+func TestPrepareDataDirsCreatesDirectories(t *testing.T) {
+	root := t.TempDir()
+	cfg := &appconfig.Config{
+		HAPStoragePath:    filepath.Join(root, "data", "hap"),
+		TailscaleStateDir: filepath.Join(root, "data", "tailscale"),
+		TokensPath:        filepath.Join(root, "data", "tokens", "tokens.json"),
+	}
+
+	if err := prepareDataDirs(cfg, testLogger()); err != nil {
+		t.Fatalf("prepareDataDirs: %v", err)
+	}
+
+	for _, dir := range cfg.DataDirs() {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("ReadDir(%s): %v", dir, err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("%s contains leftover files: %v", dir, entries)
+		}
+	}
+}
+
+func TestPrepareDataDirsUnusable(t *testing.T) {
+	root := t.TempDir()
+	blocker := filepath.Join(root, "file")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &appconfig.Config{
+		HAPStoragePath:    filepath.Join(blocker, "hap"),
+		TailscaleStateDir: filepath.Join(root, "tailscale"),
+		TokensPath:        filepath.Join(root, "tokens.json"),
+	}
+
+	err := prepareDataDirs(cfg, testLogger())
+	if err == nil {
+		t.Fatal("prepareDataDirs succeeded with a file in place of the data directory")
+	}
+	if !strings.Contains(err.Error(), cfg.HAPStoragePath) {
+		t.Errorf("error %q does not name the directory", err)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package z2mhomekit
+
+import "syscall"
+
+// dropPrivileges switches the process to uid and gid. Zero leaves the
+// respective ID unchanged.
+func dropPrivileges(uid, gid int) error {
+	if gid > 0 {
+		if err := syscall.Setgroups([]int{gid}); err != nil {
+			return err
+		}
+		if err := syscall.Setgid(gid); err != nil {
+			return err
+		}
+	}
+	if uid > 0 {
+		if err := syscall.Setuid(uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package z2mhomekit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/chasefleming/elem-go"
+	"github.com/chasefleming/elem-go/attrs"
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+// coverCalibrationLabels names the calibration steps on the device page.
+var coverCalibrationLabels = map[devices.CoverCalibration]string{
+	devices.CoverCalibrationReverse:    "Reverse direction",
+	devices.CoverCalibrationLimitOpen:  "Set open limit",
+	devices.CoverCalibrationLimitClose: "Set closed limit",
+	devices.CoverCalibrationStart:      "Start travel calibration",
+	devices.CoverCalibrationStop:       "Stop travel calibration",
+}
+
+// HandleCoverCalibration sends a calibration step (action) to a cover. It
+// serves both the web UI (/calibrate/{id}) and the API
+// (/api/v1/calibrate/{id}), which returns the step as JSON.
+func (ws *WebServer) HandleCoverCalibration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deviceID := path.Base(r.URL.Path)
+	device, _, exists := ws.deviceProvider.Device(deviceID)
+	if !exists {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	action := devices.CoverCalibration(r.FormValue("action"))
+	label, ok := coverCalibrationLabels[action]
+	if !ok {
+		http.Error(w, "Invalid calibration action", http.StatusBadRequest)
+		return
+	}
+
+	actor := requestActor(r)
+	calibration, err := ws.controller.CalibrateCover(r.Context(), deviceID, action, actor)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ws.LogEvent(fmt.Sprintf("%s: %s by %s", device.Name, strings.ToLower(label), actor))
+
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		http.Redirect(w, r, "/device/"+deviceID, http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(calibration); err != nil {
+		ws.logger.Error("Failed to write calibration response", slog.Any("error", err))
+	}
+}
+
+// renderCoverCalibration renders the calibration section of a cover's
+// device page: the travel time and direction it reports, the latest step
+// and whether the cover confirmed it, and a button per step.
+func renderCoverCalibration(deviceID string, device devices.Device, state devices.State) elem.Node {
+	if device.Type != devices.DeviceTypeCover {
+		return nil
+	}
+
+	travel := "not calibrated"
+	if state.TravelTime != nil {
+		travel = fmt.Sprintf("%.1f s", *state.TravelTime)
+	}
+	direction := "unknown"
+	if state.MotorReversed != nil {
+		direction = "normal"
+		if *state.MotorReversed {
+			direction = "reversed"
+		}
+	}
+	rows := []elem.Node{
+		stateRow("travel_time", travel),
+		stateRow("direction", direction),
+	}
+	if state.Calibrating != nil && *state.Calibrating {
+		rows = append(rows, stateRow("calibrating", "yes, stop once the cover has run end to end"))
+	}
+	if c := state.Calibration; c != nil {
+		status := "waiting for the cover to confirm"
+		switch {
+		case c.Confirmed != nil:
+			status = "confirmed at " + c.Confirmed.Format("15:04:05")
+		case c.Unconfirmed:
+			status = "not confirmed by the cover"
+		}
+		rows = append(rows, stateRow("last_step", fmt.Sprintf("%s by %s at %s, %s",
+			coverCalibrationLabels[c.Action], c.By, c.Requested.Format("15:04:05"), status)))
+	}
+
+	buttons := make([]elem.Node, 0, len(devices.CoverCalibrations))
+	for _, action := range devices.CoverCalibrations {
+		buttons = append(buttons, elem.Button(attrs.Props{
+			attrs.Type:  "submit",
+			attrs.Name:  "action",
+			attrs.Value: string(action),
+		}, elem.Text(coverCalibrationLabels[action])))
+	}
+
+	return elem.Div(attrs.Props{attrs.Class: "cover-calibration"},
+		elem.H2(attrs.Props{}, elem.Text("Calibration")),
+		elem.Table(attrs.Props{attrs.Class: "device-state-table"}, rows...),
+		elem.Form(attrs.Props{attrs.Class: "cover-calibration-form", attrs.Method: "post", attrs.Action: "/calibrate/" + deviceID},
+			buttons...,
+		),
+	)
+}
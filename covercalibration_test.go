@@ -0,0 +1,107 @@
+package z2mhomekit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+func TestHandleCoverCalibration(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ctrl := &fakeController{}
+	ws.controller = ctrl
+	ws.deviceProvider = fakeDeviceProvider{
+		"blind": {Device: devices.Device{ID: "blind", Name: "Blind", Type: devices.DeviceTypeCover}},
+	}
+
+	form := url.Values{"action": {"start"}}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/calibrate/blind", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(context.WithValue(req.Context(), tokenNameKey{}, "ops"))
+	rec := httptest.NewRecorder()
+	ws.HandleCoverCalibration(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"action":"start"`) {
+		t.Fatalf("calibrate = %d %s, want 200 with the step", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	ws.HandleCoverCalibration(rec, httptest.NewRequest(http.MethodPost, "/calibrate/blind?action=reverse", nil))
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/device/blind" {
+		t.Errorf("web calibrate = %d to %q, want 303 to /device/blind", rec.Code, rec.Header().Get("Location"))
+	}
+
+	for path, want := range map[string]int{
+		"/calibrate/missing?action=start": http.StatusNotFound,
+		"/calibrate/blind?action=spin":    http.StatusBadRequest,
+		"/calibrate/blind":                http.StatusBadRequest,
+	} {
+		rec = httptest.NewRecorder()
+		ws.HandleCoverCalibration(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		if rec.Code != want {
+			t.Errorf("%s = %d, want %d", path, rec.Code, want)
+		}
+	}
+
+	want := []string{"calibrate blind start by token ops", "calibrate blind reverse by web UI 192.0.2.1"}
+	if !slices.Equal(ctrl.calls, want) {
+		t.Errorf("controller calls = %v, want %v", ctrl.calls, want)
+	}
+}
+
+func TestRenderCoverCalibration(t *testing.T) {
+	cover := devices.Device{ID: "blind", Name: "Blind", Type: devices.DeviceTypeCover}
+	if node := renderCoverCalibration("plug", devices.Device{Type: devices.DeviceTypeOutlet}, devices.State{}); node != nil {
+		t.Error("calibration rendered for an outlet")
+	}
+
+	html := renderCoverCalibration("blind", cover, devices.State{}).Render()
+	for _, want := range []string{"<td>not calibrated</td>", `action="/calibrate/blind"`, `value="start"`, `value="reverse"`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("calibration lacks %q", want)
+		}
+	}
+
+	confirmed := time.Date(2024, 6, 21, 12, 0, 5, 0, time.Local)
+	html = renderCoverCalibration("blind", cover, devices.State{
+		TravelTime:    devices.Ptr(23.4),
+		MotorReversed: devices.Ptr(true),
+		Calibration: &devices.Calibration{
+			Action:    devices.CoverCalibrationStop,
+			By:        "user alice",
+			Requested: confirmed.Add(-5 * time.Second),
+			Confirmed: &confirmed,
+		},
+	}).Render()
+	for _, want := range []string{"<td>23.4 s</td>", "<td>reversed</td>", "Stop travel calibration by user alice at 12:00:00, confirmed at 12:00:05"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("calibration lacks %q:\n%s", want, html)
+		}
+	}
+}
+
+func TestParseCoverCalibration(t *testing.T) {
+	hook := &MQTTHook{logger: testLogger()}
+	msg := map[string]any{"position": 40.0, "calibration": "OFF", "calibration_time": 23.4, "motor_reversal": "ON"}
+
+	state, fields := hook.parseZ2MMessage(devices.Device{ID: "blind", Type: devices.DeviceTypeCover}, msg)
+	if state.Calibrating == nil || *state.Calibrating || state.TravelTime == nil || *state.TravelTime != 23.4 || state.MotorReversed == nil || !*state.MotorReversed {
+		t.Errorf("cover calibration = %v %v %v, want not calibrating, 23.4 s, reversed", state.Calibrating, state.TravelTime, state.MotorReversed)
+	}
+	for _, field := range []string{"Calibrating", "TravelTime", "MotorReversed"} {
+		if !slices.Contains(fields, field) {
+			t.Errorf("fields = %v, missing %s", fields, field)
+		}
+	}
+
+	state, _ = hook.parseZ2MMessage(devices.Device{ID: "plug", Type: devices.DeviceTypeOutlet}, msg)
+	if state.Calibrating != nil || state.TravelTime != nil || state.MotorReversed != nil {
+		t.Error("calibration parsed for an outlet")
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/brutella/hap"
 	"github.com/brutella/hap/accessory"
+	"github.com/kradalby/z2m-homekit/devices"
 )
 
 // SetupDebugHandlers registers the HAP debug handler
@@ -30,11 +31,61 @@ func SetupDebugHandlers(kraWeb interface {
 	}))
 }
 
+// ClockDebugInfo is the simulated time reported by /debug/clock.
+type ClockDebugInfo struct {
+	Now    time.Time `json:"now"`
+	Offset string    `json:"offset"`
+}
+
+// clockDebugHandler shows the simulated clock and, on POST, moves it:
+// warp=1h30m (or -10m) moves it by a duration, set=2006-01-02T15:04:05Z07:00
+// to a time. Schedules and night mode are checked right after a move.
+func clockDebugHandler(clock *devices.SimClock, timers interface{ CheckTimers() }) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			warp, set := r.FormValue("warp"), r.FormValue("set")
+			switch {
+			case warp != "" && set == "":
+				d, err := time.ParseDuration(warp)
+				if err != nil {
+					http.Error(w, "Invalid warp duration", http.StatusBadRequest)
+					return
+				}
+				clock.Warp(d)
+			case set != "" && warp == "":
+				t, err := time.Parse(time.RFC3339, set)
+				if err != nil {
+					http.Error(w, "Invalid set time, want RFC 3339", http.StatusBadRequest)
+					return
+				}
+				clock.Set(t)
+			default:
+				http.Error(w, "Give one of warp or set", http.StatusBadRequest)
+				return
+			}
+			timers.CheckTimers()
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		data, err := json.MarshalIndent(ClockDebugInfo{Now: clock.Now(), Offset: clock.Offset().String()}, "", "  ")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to marshal clock: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	})
+}
+
 // HAPDebugInfo contains debug information about the HomeKit service
 type HAPDebugInfo struct {
-	Server      *ServerInfo     `json:"server,omitempty"`
-	Pairings    []PairingInfo   `json:"pairings,omitempty"`
-	Stats       StatsInfo       `json:"stats"`
+	Server      *ServerInfo          `json:"server,omitempty"`
+	Pairings    []PairingInfo        `json:"pairings,omitempty"`
+	Stats       StatsInfo            `json:"stats"`
 	Accessories []AccessoryDebugInfo `json:"accessories"`
 }
 
@@ -55,7 +106,14 @@ type PairingInfo struct {
 type StatsInfo struct {
 	IncomingCommands uint64 `json:"incoming_commands"`
 	OutgoingUpdates  uint64 `json:"outgoing_updates"`
+	RejectedWrites   uint64 `json:"rejected_writes"`
+	ThrottledWrites  uint64 `json:"throttled_writes"`
 	LastActivity     string `json:"last_activity"`
+
+	// MQTT to HAP update latency
+	UpdateLatencyCount uint64  `json:"update_latency_count"`
+	UpdateLatencyAvgMs float64 `json:"update_latency_avg_ms"`
+	UpdateLatencyMaxMs float64 `json:"update_latency_max_ms"`
 }
 
 // AccessoryDebugInfo contains information about a HomeKit accessory
@@ -76,11 +134,11 @@ func (hm *HAPManager) DebugInfo() HAPDebugInfo {
 	}
 
 	// Server info
-	if hm.server != nil {
+	if server := hm.server.Load(); server != nil {
 		info.Server = &ServerInfo{
-			Address: hm.server.Addr,
-			PIN:     hm.server.Pin,
-			Paired:  hm.server.IsPaired(),
+			Address: server.Addr,
+			PIN:     server.Pin,
+			Paired:  server.IsPaired(),
 		}
 	}
 
@@ -116,9 +174,18 @@ func (hm *HAPManager) DebugInfo() HAPDebugInfo {
 	info.Stats = StatsInfo{
 		IncomingCommands: hm.incomingCommands.Load(),
 		OutgoingUpdates:  hm.outgoingUpdates.Load(),
+		RejectedWrites:   hm.rejectedWrites.Load(),
+		ThrottledWrites:  hm.throttledWrites.Load(),
 		LastActivity:     lastActivityStr,
 	}
 
+	if count := hm.updateLatencyCount.Load(); count > 0 {
+		total := time.Duration(hm.updateLatencyTotal.Load())
+		info.Stats.UpdateLatencyCount = count
+		info.Stats.UpdateLatencyAvgMs = float64(total.Microseconds()) / 1000 / float64(count)
+		info.Stats.UpdateLatencyMaxMs = float64(time.Duration(hm.updateLatencyMax.Load()).Microseconds()) / 1000
+	}
+
 	// Accessories
 	for _, acc := range hm.GetAccessories() {
 		accType := "Unknown"
@@ -133,6 +200,8 @@ func (hm *HAPManager) DebugInfo() HAPDebugInfo {
 			accType = "Sensor"
 		case accessory.TypeSwitch:
 			accType = "Switch"
+		case accessory.TypeFan:
+			accType = "Fan"
 		}
 
 		info.Accessories = append(info.Accessories, AccessoryDebugInfo{
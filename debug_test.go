@@ -0,0 +1,58 @@
+package z2mhomekit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+type fakeTimers struct{ checks int }
+
+func (f *fakeTimers) CheckTimers() { f.checks++ }
+
+func TestClockDebugHandler(t *testing.T) {
+	clock := devices.NewSimClock()
+	timers := &fakeTimers{}
+	handler := clockDebugHandler(clock, timers)
+
+	tests := []struct {
+		method   string
+		target   string
+		wantCode int
+	}{
+		{http.MethodGet, "/debug/clock", http.StatusOK},
+		{http.MethodPost, "/debug/clock?warp=90m", http.StatusOK},
+		{http.MethodPost, "/debug/clock?warp=soon", http.StatusBadRequest},
+		{http.MethodPost, "/debug/clock?set=yesterday", http.StatusBadRequest},
+		{http.MethodPost, "/debug/clock?warp=1h&set=2024-06-21T23:00:00Z", http.StatusBadRequest},
+		{http.MethodPost, "/debug/clock", http.StatusBadRequest},
+		{http.MethodDelete, "/debug/clock", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+		if rec.Code != tt.wantCode {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.target, rec.Code, tt.wantCode)
+		}
+	}
+	if clock.Offset() < 90*time.Minute-time.Second || clock.Offset() > 90*time.Minute {
+		t.Errorf("offset = %s, want 1h30m", clock.Offset())
+	}
+	if timers.checks != 1 {
+		t.Errorf("timers checked %d times, want once", timers.checks)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/clock?set=2024-06-21T23:00:00Z", nil))
+	var info ClockDebugInfo
+	if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if want := time.Date(2024, 6, 21, 23, 0, 0, 0, time.UTC); info.Now.Sub(want) < 0 || info.Now.Sub(want) > time.Second {
+		t.Errorf("now = %s, want %s", info.Now, want)
+	}
+}
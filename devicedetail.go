@@ -0,0 +1,262 @@
+package z2mhomekit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chasefleming/elem-go"
+	"github.com/chasefleming/elem-go/attrs"
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+const (
+	// deviceChartWindow is how far back the device page charts go.
+	deviceChartWindow = 24 * time.Hour
+
+	// deviceRecentEvents is how many event log entries and zigbee2mqtt
+	// messages the device page shows.
+	deviceRecentEvents = 20
+
+	// Size of a sparkline, in SVG user units.
+	sparklineWidth  = 300
+	sparklineHeight = 60
+)
+
+// deviceChartMetrics are the history metrics charted on the device page.
+var deviceChartMetrics = []struct {
+	Metric string
+	Label  string
+	Format string
+}{
+	{"temperature", "Temperature", "%.1f°C"},
+	{"humidity", "Humidity", "%.0f%%"},
+	{"power", "Power", "%.1f W"},
+}
+
+// HandleDevice serves a device's page (/device/{id}): its card, full
+// state, charts of its history and recent events. The charts load from
+// /device/{id}/charts and refresh themselves.
+func (ws *WebServer) HandleDevice(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deviceID, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/device/"), "/")
+	device, state, exists := ws.deviceProvider.Device(deviceID)
+	if !exists || !webEnabled(device) {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	switch rest {
+	case "":
+	case "charts":
+		w.Header().Set("Content-Type", "text/html")
+		if _, err := fmt.Fprint(w, ws.renderDeviceCharts(device).Render()); err != nil {
+			ws.logger.Error("Failed to write response", slog.Any("error", err))
+		}
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	children := []elem.Node{
+		elem.H1(attrs.Props{}, elem.Text(device.Name)),
+		elem.P(attrs.Props{}, elem.A(attrs.Props{attrs.Href: "/"}, elem.Text("Back to dashboard"))),
+		elem.Div(attrs.Props{attrs.Class: "devices-grid"}, ws.renderDeviceCard(deviceID, device, state)),
+	}
+	if test := renderTestFireForm(deviceID, device, state); test != nil {
+		children = append(children, test)
+	}
+	if calibration := renderCoverCalibration(deviceID, device, state); calibration != nil {
+		children = append(children, calibration)
+	}
+	children = append(children,
+		elem.H2(attrs.Props{}, elem.Text("History")),
+		elem.Div(attrs.Props{
+			attrs.ID:     "device-charts",
+			"hx-get":     "/device/" + deviceID + "/charts",
+			"hx-trigger": "load, every 60s",
+			"hx-swap":    "innerHTML",
+		}, elem.Text("Loading…")),
+		elem.H2(attrs.Props{}, elem.Text("State")),
+		ws.renderDeviceState(device),
+		elem.H2(attrs.Props{}, elem.Text("Recent events")),
+		ws.renderDeviceEvents(device),
+	)
+	content := elem.Div(attrs.Props{attrs.Class: "device-detail"}, children...)
+
+	w.Header().Set("Content-Type", "text/html")
+	if _, err := fmt.Fprint(w, ws.renderPage("z2m-homekit · "+device.Name, content)); err != nil {
+		ws.logger.Error("Failed to write response", slog.Any("error", err))
+	}
+}
+
+// renderDeviceCharts renders a sparkline of each charted metric the device
+// has history for.
+func (ws *WebServer) renderDeviceCharts(device devices.Device) elem.Node {
+	if ws.history == nil {
+		return elem.P(attrs.Props{}, elem.Text("History is disabled."))
+	}
+
+	now := time.Now()
+	series, err := ws.history.Query(device.ID, "", now.Add(-deviceChartWindow), now)
+	if err != nil {
+		ws.logger.Warn("Failed to read history", "device", device.ID, "error", err)
+		return elem.P(attrs.Props{}, elem.Text("History could not be read."))
+	}
+
+	var charts []elem.Node
+	for _, m := range deviceChartMetrics {
+		samples := series[m.Metric]
+		if len(samples) == 0 {
+			continue
+		}
+		lo, hi := samples[0].Value, samples[0].Value
+		for _, s := range samples {
+			lo, hi = min(lo, s.Value), max(hi, s.Value)
+		}
+		last := samples[len(samples)-1].Value
+		charts = append(charts, elem.Div(attrs.Props{attrs.Class: "device-chart"},
+			elem.Div(attrs.Props{attrs.Class: "device-chart-label"},
+				elem.Text(fmt.Sprintf("%s "+m.Format, m.Label, last)),
+			),
+			elem.Raw(sparkline(samples, now.Add(-deviceChartWindow), now)),
+			elem.Div(attrs.Props{attrs.Class: "device-chart-range"},
+				elem.Text(fmt.Sprintf("min "+m.Format+" · max "+m.Format+" · last 24h", lo, hi)),
+			),
+		))
+	}
+	if len(charts) == 0 {
+		return elem.P(attrs.Props{}, elem.Text("No history recorded in the last 24 hours."))
+	}
+	return elem.Div(attrs.Props{attrs.Class: "device-charts"}, charts...)
+}
+
+// sparkline draws samples between from and to as an SVG polyline, scaled
+// to the range of the values.
+func sparkline(samples []HistorySample, from, to time.Time) string {
+	lo, hi := samples[0].Value, samples[0].Value
+	for _, s := range samples {
+		lo, hi = min(lo, s.Value), max(hi, s.Value)
+	}
+	span := to.Sub(from).Seconds()
+
+	points := make([]string, 0, len(samples)+1)
+	var y float64
+	for _, s := range samples {
+		x := sparklineWidth * s.At.Sub(from).Seconds() / span
+		y = sparklineHeight / 2
+		if hi > lo {
+			// Leave a unit so the extremes are not clipped.
+			y = 1 + (sparklineHeight-2)*(hi-s.Value)/(hi-lo)
+		}
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+	// Carry the last value to now, as it still holds.
+	points = append(points, fmt.Sprintf("%d,%.1f", sparklineWidth, y))
+
+	return fmt.Sprintf(`<svg class="sparkline" viewBox="0 0 %d %d" preserveAspectRatio="none" role="img"><polyline points="%s"/></svg>`,
+		sparklineWidth, sparklineHeight, strings.Join(points, " "))
+}
+
+// renderDeviceState renders the device's configuration and every field of
+// its latest state.
+func (ws *WebServer) renderDeviceState(device devices.Device) elem.Node {
+	rows := []elem.Node{
+		stateRow("id", device.ID),
+		stateRow("type", string(device.Type)),
+		stateRow("topic", device.Topic),
+	}
+	for _, field := range []struct{ name, value string }{
+		{"room", device.Room},
+		{"tags", strings.Join(device.Tags, ", ")},
+		{"location", device.Location},
+		{"purchase_date", device.PurchaseDate},
+		{"battery_type", device.BatteryType},
+	} {
+		if field.value != "" {
+			rows = append(rows, stateRow(field.name, field.value))
+		}
+	}
+
+	ws.stateMu.RLock()
+	evt, ok := ws.currentState[device.ID]
+	ws.stateMu.RUnlock()
+	if ok {
+		var fields map[string]json.RawMessage
+		data, err := json.Marshal(evt)
+		if err == nil {
+			err = json.Unmarshal(data, &fields)
+		}
+		if err != nil {
+			ws.logger.Error("Failed to encode device state", "device", device.ID, "error", err)
+		}
+		delete(fields, "device_id")
+		for _, name := range slices.Sorted(maps.Keys(fields)) {
+			rows = append(rows, stateRow(name, strings.Trim(string(fields[name]), `"`)))
+		}
+	}
+
+	return elem.Table(attrs.Props{attrs.Class: "device-state-table"}, rows...)
+}
+
+func stateRow(name, value string) elem.Node {
+	return elem.Tr(attrs.Props{},
+		elem.Th(attrs.Props{}, elem.Text(name)),
+		elem.Td(attrs.Props{}, elem.Text(value)),
+	)
+}
+
+// renderDeviceEvents renders the event log entries naming the device and,
+// when the journal is enabled, its latest zigbee2mqtt messages, newest
+// first.
+func (ws *WebServer) renderDeviceEvents(device devices.Device) elem.Node {
+	ws.eventLogMu.RLock()
+	var entries []elem.Node
+	for _, entry := range slices.Backward(ws.eventLog) {
+		if len(entries) == deviceRecentEvents {
+			break
+		}
+		if strings.Contains(entry, device.Name) || strings.Contains(entry, device.ID) {
+			entries = append(entries, elem.Li(attrs.Props{}, elem.Text(entry)))
+		}
+	}
+	ws.eventLogMu.RUnlock()
+	if len(entries) == 0 {
+		entries = append(entries, elem.Li(attrs.Props{}, elem.Text("No recent events.")))
+	}
+	nodes := []elem.Node{elem.Ul(attrs.Props{attrs.Class: "device-events"}, entries...)}
+
+	if ws.journal != nil {
+		recs, err := ws.journal.Read(device.ID, time.Now().Add(-deviceChartWindow))
+		if err != nil {
+			ws.logger.Warn("Failed to read event journal", "device", device.ID, "error", err)
+		}
+		if len(recs) > deviceRecentEvents {
+			recs = recs[len(recs)-deviceRecentEvents:]
+		}
+		var messages []elem.Node
+		for _, rec := range slices.Backward(recs) {
+			messages = append(messages, elem.Li(attrs.Props{},
+				elem.Text(rec.At.Local().Format("15:04:05")+" "),
+				elem.Code(attrs.Props{}, elem.Text(string(rec.Payload))),
+			))
+		}
+		if len(messages) > 0 {
+			nodes = append(nodes,
+				elem.H3(attrs.Props{}, elem.Text("zigbee2mqtt messages")),
+				elem.Ul(attrs.Props{attrs.Class: "device-events"}, messages...),
+			)
+		}
+	}
+	return elem.Div(attrs.Props{}, nodes...)
+}
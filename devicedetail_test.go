@@ -0,0 +1,89 @@
+package z2mhomekit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/devices"
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+func TestHandleDevice(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ws.deviceProvider = fakeDeviceProvider{
+		"kitchen": {Device: devices.Device{ID: "kitchen", Name: "Kitchen", Topic: "kitchen_sensor", Type: devices.DeviceTypeClimateSensor, Room: "Kitchen"}},
+	}
+	temp := 21.5
+	ws.currentState["kitchen"] = events.StateUpdateEvent{DeviceID: "kitchen", Temperature: &temp}
+	ws.LogEvent("Kitchen went offline")
+	ws.LogEvent("Hall went offline")
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		ws.HandleDevice(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/device/kitchen")
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	for _, want := range []string{`href="/device/kitchen"`, `hx-get="/device/kitchen/charts"`, "kitchen_sensor", "<th>temperature</th><td>21.5</td>", "Kitchen went offline"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page lacks %q", want)
+		}
+	}
+	if strings.Contains(body, "Hall went offline") {
+		t.Error("page shows another device's events")
+	}
+
+	if rec := get("/device/kitchen/charts"); !strings.Contains(rec.Body.String(), "History is disabled") {
+		t.Errorf("charts without history = %s", rec.Body.String())
+	}
+
+	h, err := NewHistory(t.TempDir(), 48*time.Hour, ws.eventBus, testLogger())
+	if err != nil {
+		t.Fatalf("NewHistory: %v", err)
+	}
+	t.Cleanup(func() { _ = h.Close() })
+	for i, v := range []float64{20, 22, 21.5} {
+		at := time.Now().Add(time.Duration(i-3) * time.Hour)
+		if err := h.Record(events.StateUpdateEvent{Timestamp: at, DeviceID: "kitchen", Temperature: &v}); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	ws.SetHistory(h)
+
+	charts := get("/device/kitchen/charts").Body.String()
+	for _, want := range []string{"<svg", "Temperature 21.5°C", "min 20.0°C · max 22.0°C"} {
+		if !strings.Contains(charts, want) {
+			t.Errorf("charts lack %q:\n%s", want, charts)
+		}
+	}
+	if strings.Contains(charts, "Humidity") {
+		t.Error("charts show a metric without history")
+	}
+
+	if rec := get("/device/missing"); rec.Code != http.StatusNotFound {
+		t.Errorf("missing device status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	from := time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+
+	flat := sparkline([]HistorySample{{At: from, Value: 5}, {At: from.Add(30 * time.Minute), Value: 5}}, from, to)
+	if !strings.Contains(flat, `points="0.0,30.0 150.0,30.0 300,30.0"`) {
+		t.Errorf("flat sparkline = %s", flat)
+	}
+
+	rising := sparkline([]HistorySample{{At: from, Value: 0}, {At: to, Value: 10}}, from, to)
+	if !strings.Contains(rising, `points="0.0,59.0 300.0,1.0 300,1.0"`) {
+		t.Errorf("rising sparkline = %s", rising)
+	}
+}
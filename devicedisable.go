@@ -0,0 +1,81 @@
+package z2mhomekit
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/chasefleming/elem-go"
+	"github.com/chasefleming/elem-go/attrs"
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+// HandleDeviceDisable disables or enables a device (disabled=true|false).
+// It serves both the web UI (/disable/{id}) and the API
+// (/api/v1/disable/{id}), which answers 204 instead of a page.
+func (ws *WebServer) HandleDeviceDisable(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deviceID := path.Base(r.URL.Path)
+	device, _, exists := ws.deviceProvider.Device(deviceID)
+	if !exists || !webEnabled(device) {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	disabled, err := formValue(r, "disabled", strconv.ParseBool)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := ws.controller.SetDeviceDisabled(deviceID, *disabled); err != nil {
+		ws.logger.Error("Failed to disable device", "device_id", deviceID, "error", err)
+		http.Error(w, "Failed to disable device", http.StatusInternalServerError)
+		return
+	}
+
+	verb := "Enabled"
+	if *disabled {
+		verb = "Disabled"
+	}
+	ws.LogEvent(fmt.Sprintf("%s %s by %s", verb, device.Name, requestActor(r)))
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/"):
+		w.WriteHeader(http.StatusNoContent)
+	case r.Header.Get("HX-Request") == "true":
+		device, state, _ := ws.deviceProvider.Device(deviceID)
+		w.Header().Set("Content-Type", "text/html")
+		if _, err := fmt.Fprint(w, ws.renderDeviceCard(deviceID, device, state).Render()); err != nil {
+			ws.logger.Error("Failed to write response", slog.Any("error", err))
+		}
+	default:
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// renderDisable renders the button disabling a device, or enabling it
+// again.
+func (ws *WebServer) renderDisable(deviceID string, state devices.State) elem.Node {
+	label, value := "Disable", "true"
+	if state.Disabled != nil {
+		label, value = "Enable", "false"
+	}
+
+	return elem.Form(attrs.Props{
+		attrs.Class: "device-disable",
+		"hx-post":   "/disable/" + deviceID,
+		"hx-target": "#device-" + deviceID,
+		"hx-swap":   "outerHTML",
+	},
+		elem.Input(attrs.Props{attrs.Type: "hidden", attrs.Name: "disabled", attrs.Value: value}),
+		elem.Button(attrs.Props{attrs.Type: "submit", "data-role": "disable-button"}, elem.Text(label)),
+	)
+}
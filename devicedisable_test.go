@@ -0,0 +1,72 @@
+package z2mhomekit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brutella/hap"
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+func TestHandleDeviceDisable(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ctrl := &fakeController{}
+	ws.controller = ctrl
+	since := time.Now()
+	ws.deviceProvider = fakeDeviceProvider{
+		"plug": {Device: devices.Device{ID: "plug", Name: "Plug", Type: devices.DeviceTypeOutlet}, State: devices.State{Disabled: &since}},
+	}
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		ws.HandleDeviceDisable(rec, req)
+		return rec
+	}
+
+	if rec := post("/api/v1/disable/plug", "disabled=true"); rec.Code != http.StatusNoContent {
+		t.Errorf("API status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if rec := post("/api/v1/disable/plug", "disabled=maybe"); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid value status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := post("/disable/lamp", "disabled=true"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown device status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if len(ctrl.calls) != 1 || ctrl.calls[0] != "disabled plug true" {
+		t.Errorf("calls = %v, want the plug disabled", ctrl.calls)
+	}
+
+	card := ws.renderDeviceCard("plug", devices.Device{ID: "plug", Name: "Plug", Type: devices.DeviceTypeOutlet}, devices.State{Disabled: &since}).Render()
+	if !strings.Contains(card, "Disabled since") || !strings.Contains(card, `value="false"`) {
+		t.Errorf("disabled card lacks its status or the enable button:\n%s", card)
+	}
+}
+
+func TestDisabledAccessoryNotResponding(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	configs := []devices.Device{{ID: "plug", Name: "Plug", Topic: "plug", Type: devices.DeviceTypeOutlet}}
+	dm := newTestDeviceManager(t, bus, configs, nil)
+	hm := NewHAPManager(configs, "Test Bridge", nil, dm, bus, logger)
+	on := hm.accessories["plug"].Outlet.On
+	req := httptest.NewRequest(http.MethodGet, "/characteristics", nil)
+
+	if err := dm.SetDeviceDisabled("plug", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, status := on.ValueRequest(req); status != hap.JsonStatusServiceCommunicationFailure {
+		t.Errorf("disabled read status = %d, want communication failure", status)
+	}
+	if err := dm.SetDeviceDisabled("plug", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, status := on.ValueRequest(req); status != hap.JsonStatusSuccess {
+		t.Errorf("enabled read status = %d", status)
+	}
+}
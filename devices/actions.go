@@ -0,0 +1,212 @@
+package devices
+
+import (
+	"fmt"
+
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+// ActionCommand is the command an action binding sends to its target.
+type ActionCommand string
+
+const (
+	ActionCommandOn             ActionCommand = "on"
+	ActionCommandOff            ActionCommand = "off"
+	ActionCommandToggle         ActionCommand = "toggle"
+	ActionCommandBrightness     ActionCommand = "brightness"
+	ActionCommandBrightnessUp   ActionCommand = "brightness_up"
+	ActionCommandBrightnessDown ActionCommand = "brightness_down"
+	ActionCommandDimUp          ActionCommand = "dim_up"
+	ActionCommandDimDown        ActionCommand = "dim_down"
+	ActionCommandDimStop        ActionCommand = "dim_stop"
+)
+
+// DefaultBrightnessStep is the brightness change in percent applied by
+// brightness_up and brightness_down when a binding sets no step.
+const DefaultBrightnessStep = 10
+
+// ActionBinding routes a zigbee2mqtt action reported by a device (e.g.
+// "double" or "brightness_move_up") to a command on another device. Bind a
+// remote's brightness_move_up/down to dim_up/dim_down and brightness_stop to
+// dim_stop to dim a light for as long as the button is held.
+type ActionBinding struct {
+	Target  string        `json:"target"`
+	Command ActionCommand `json:"command"`
+
+	// Brightness is the level in percent for the brightness command, or the
+	// step for brightness_up and brightness_down.
+	Brightness int `json:"brightness,omitempty"`
+}
+
+func isPowerTarget(t DeviceType) bool {
+	switch t {
+	case DeviceTypeLightbulb, DeviceTypeOutlet, DeviceTypeSwitch, DeviceTypeFan:
+		return true
+	}
+	return false
+}
+
+// validateActions checks that every binding names a known target that
+// supports its command. It runs after all devices are loaded.
+func validateActions(cfg *Config) error {
+	byID := devicesByID(cfg)
+
+	for _, device := range cfg.Devices {
+		for action, bindings := range device.Actions {
+			if action == "" {
+				return fmt.Errorf("device %s: actions contains an empty action name", device.ID)
+			}
+			if device.Remote != "" && !device.Remote.reports(action) {
+				return fmt.Errorf("device %s: action %q is not reported by remote %s", device.ID, action, device.Remote)
+			}
+			for _, b := range bindings {
+				if err := b.validate(byID); err != nil {
+					return fmt.Errorf("device %s: action %q: %w", device.ID, action, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func devicesByID(cfg *Config) map[string]Device {
+	byID := make(map[string]Device, len(cfg.Devices))
+	for _, d := range cfg.Devices {
+		byID[d.ID] = d
+	}
+	return byID
+}
+
+// validate checks that the binding's target is known and supports its
+// command.
+func (b ActionBinding) validate(byID map[string]Device) error {
+	target, ok := byID[b.Target]
+	if !ok {
+		return fmt.Errorf("unknown target device %q", b.Target)
+	}
+
+	switch b.Command {
+	case ActionCommandOn, ActionCommandOff, ActionCommandToggle:
+		if !isPowerTarget(target.Type) {
+			return fmt.Errorf("%s cannot be switched on or off", b.Target)
+		}
+	case ActionCommandBrightness, ActionCommandBrightnessUp, ActionCommandBrightnessDown,
+		ActionCommandDimUp, ActionCommandDimDown, ActionCommandDimStop:
+		if target.Type != DeviceTypeLightbulb {
+			return fmt.Errorf("%s is not a lightbulb", b.Target)
+		}
+		if b.Brightness < 0 || b.Brightness > 100 {
+			return fmt.Errorf("brightness %d out of range 0-100", b.Brightness)
+		}
+	default:
+		return fmt.Errorf("invalid command %q", b.Command)
+	}
+	return nil
+}
+
+// HandleAction publishes an action reported by a device and queues the
+// commands bound to it, and the arm mode a keypad asks for. It reports how many commands were queued.
+func (dm *Manager) HandleAction(deviceID, action string) int {
+	device, _, ok := dm.Device(deviceID)
+	if !ok {
+		return 0
+	}
+
+	dm.eventBus.PublishAction(dm.stateEventClient, events.ActionEvent{
+		Timestamp: dm.Now(),
+		DeviceID:  deviceID,
+		Name:      device.Name,
+		Action:    action,
+	})
+
+	queued := 0
+
+	// A code entered on a keypad arms or disarms its security system.
+	if mode, ok := ArmModeFromAction(action); ok && device.Type == DeviceTypeSecuritySystem {
+		if dm.tryQueueCommand(CommandEvent{DeviceID: deviceID, ArmMode: &mode}) {
+			queued++
+		} else {
+			dm.logger.Warn("Command queue full, dropping arm mode", "device_id", deviceID, "mode", mode)
+		}
+	}
+
+	for _, b := range device.Actions[action] {
+		cmd, ok := dm.resolveAction(b)
+		if !ok {
+			continue
+		}
+
+		dm.logger.Info("Routing device action",
+			"device_id", deviceID,
+			"action", action,
+			"target", b.Target,
+			"command", b.Command,
+		)
+
+		// Commands go through the queue rather than straight to MQTT so
+		// they are applied in order with HAP and web commands, and never
+		// from inside the broker's publish hook.
+		if dm.tryQueueCommand(cmd) {
+			queued++
+		} else {
+			dm.logger.Warn("Command queue full, dropping action",
+				"device_id", deviceID,
+				"action", action,
+				"target", b.Target,
+			)
+		}
+	}
+
+	return queued
+}
+
+// resolveAction turns a binding into a command using the target's current
+// state for toggle and relative brightness.
+func (dm *Manager) resolveAction(b ActionBinding) (CommandEvent, bool) {
+	_, state, ok := dm.Device(b.Target)
+	if !ok {
+		return CommandEvent{}, false
+	}
+
+	cmd := CommandEvent{DeviceID: b.Target}
+	switch b.Command {
+	case ActionCommandOn, ActionCommandOff:
+		on := b.Command == ActionCommandOn
+		cmd.On = &on
+	case ActionCommandToggle:
+		on := state.On == nil || !*state.On
+		cmd.On = &on
+	case ActionCommandBrightness:
+		level := b.Brightness
+		cmd.Brightness = &level
+	case ActionCommandBrightnessUp, ActionCommandBrightnessDown:
+		step := b.Brightness
+		if step == 0 {
+			step = DefaultBrightnessStep
+		}
+		if b.Command == ActionCommandBrightnessDown {
+			step = -step
+		}
+
+		current := 0
+		if state.Brightness != nil && (state.On == nil || *state.On) {
+			current = Z2MBrightnessToHAP(*state.Brightness)
+		}
+		level := min(max(current+step, 0), 100)
+		cmd.Brightness = &level
+	case ActionCommandDimUp, ActionCommandDimDown, ActionCommandDimStop:
+		dim := 0
+		switch b.Command {
+		case ActionCommandDimUp:
+			dim = 1
+		case ActionCommandDimDown:
+			dim = -1
+		}
+		cmd.Dim = &dim
+	default:
+		return CommandEvent{}, false
+	}
+
+	return cmd, true
+}
@@ -0,0 +1,124 @@
+package devices
+
+import (
+	"testing"
+)
+
+func TestValidateActions(t *testing.T) {
+	devices := []Device{
+		{ID: "remote", Type: DeviceTypeSwitch},
+		{ID: "lamp", Type: DeviceTypeLightbulb},
+		{ID: "plug", Type: DeviceTypeOutlet},
+		{ID: "temp", Type: DeviceTypeClimateSensor},
+	}
+
+	tests := []struct {
+		name    string
+		actions map[string][]ActionBinding
+		wantErr bool
+	}{
+		{"toggle lamp", map[string][]ActionBinding{"single": {{Target: "lamp", Command: ActionCommandToggle}}}, false},
+		{"dim lamp", map[string][]ActionBinding{"hold": {{Target: "lamp", Command: ActionCommandBrightnessDown, Brightness: 20}}}, false},
+		{"plug off", map[string][]ActionBinding{"double": {{Target: "plug", Command: ActionCommandOff}}}, false},
+		{"unknown target", map[string][]ActionBinding{"single": {{Target: "nope", Command: ActionCommandOn}}}, true},
+		{"unknown command", map[string][]ActionBinding{"single": {{Target: "lamp", Command: "explode"}}}, true},
+		{"dim outlet", map[string][]ActionBinding{"single": {{Target: "plug", Command: ActionCommandBrightnessUp}}}, true},
+		{"toggle sensor", map[string][]ActionBinding{"single": {{Target: "temp", Command: ActionCommandToggle}}}, true},
+		{"brightness range", map[string][]ActionBinding{"single": {{Target: "lamp", Command: ActionCommandBrightness, Brightness: 150}}}, true},
+		{"empty action", map[string][]ActionBinding{"": {{Target: "lamp", Command: ActionCommandOn}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Devices: append([]Device(nil), devices...)}
+			cfg.Devices[0].Actions = tt.actions
+
+			err := validateActions(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateActions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHandleAction(t *testing.T) {
+	configs := []Device{
+		{ID: "remote", Name: "Remote", Type: DeviceTypeSwitch, Actions: map[string][]ActionBinding{
+			"single":             {{Target: "lamp", Command: ActionCommandToggle}},
+			"double":             {{Target: "lamp", Command: ActionCommandOff}, {Target: "plug", Command: ActionCommandOff}},
+			"brightness_move_up": {{Target: "lamp", Command: ActionCommandBrightnessUp, Brightness: 25}},
+			"hold":               {{Target: "lamp", Command: ActionCommandBrightnessDown}},
+		}},
+		{ID: "lamp", Name: "Lamp", Type: DeviceTypeLightbulb},
+		{ID: "plug", Name: "Plug", Type: DeviceTypeOutlet},
+	}
+
+	commands := make(chan CommandEvent, 10)
+	dm, bus := newTestManager(t, configs, commands, nil)
+
+	on := true
+	brightness := 127 // 50%
+	dm.states["lamp"].On = &on
+	dm.states["lamp"].Brightness = &brightness
+
+	drain := func() []CommandEvent {
+		var got []CommandEvent
+		for {
+			select {
+			case cmd := <-commands:
+				got = append(got, cmd)
+			default:
+				return got
+			}
+		}
+	}
+
+	if n := dm.HandleAction("remote", "single"); n != 1 {
+		t.Fatalf("single queued %d commands, want 1", n)
+	}
+	if got := drain(); got[0].DeviceID != "lamp" || got[0].On == nil || *got[0].On {
+		t.Errorf("toggle of lit lamp = %+v, want off", got[0])
+	}
+
+	if n := dm.HandleAction("remote", "double"); n != 2 {
+		t.Fatalf("double queued %d commands, want 2", n)
+	}
+	if got := drain(); got[1].DeviceID != "plug" || *got[1].On {
+		t.Errorf("double second command = %+v, want plug off", got[1])
+	}
+
+	dm.HandleAction("remote", "brightness_move_up")
+	if got := drain(); got[0].Brightness == nil || *got[0].Brightness != 75 {
+		t.Errorf("brightness_up = %+v, want 75", got[0])
+	}
+
+	dm.HandleAction("remote", "hold")
+	if got := drain(); got[0].Brightness == nil || *got[0].Brightness != 40 {
+		t.Errorf("brightness_down = %+v, want 40", got[0])
+	}
+
+	if n := dm.HandleAction("remote", "triple"); n != 0 {
+		t.Errorf("unbound action queued %d commands", n)
+	}
+	if n := dm.HandleAction("unknown", "single"); n != 0 {
+		t.Errorf("unknown device queued %d commands", n)
+	}
+	if got := bus.Stats().Actions; got != 5 {
+		t.Errorf("Stats().Actions = %d, want 5", got)
+	}
+}
+
+func TestResolveDimActions(t *testing.T) {
+	dm, _ := newTestManager(t, []Device{{ID: "lamp", Name: "Lamp", Type: DeviceTypeLightbulb}}, nil, nil)
+
+	for command, want := range map[ActionCommand]int{
+		ActionCommandDimUp:   1,
+		ActionCommandDimDown: -1,
+		ActionCommandDimStop: 0,
+	} {
+		cmd, ok := dm.resolveAction(ActionBinding{Target: "lamp", Command: command})
+		if !ok || cmd.Dim == nil || *cmd.Dim != want {
+			t.Errorf("resolveAction(%s) = %+v, want Dim %d", command, cmd, want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+// DefaultAlertSilence is how long an acknowledged alert stays silenced when
+// no window is configured.
+const DefaultAlertSilence = time.Hour
+
+// ErrNoActiveAlert is returned when acknowledging a device without an active
+// leak, smoke or contact alert.
+var ErrNoActiveAlert = errors.New("no active alert to acknowledge")
+
+// AlertAck records who acknowledged a device's alert. Repeats of the alert
+// are silenced until Until.
+type AlertAck struct {
+	Kind  events.AlertKind
+	By    string
+	At    time.Time
+	Until time.Time
+}
+
+// sensorAlertKind returns the acknowledgeable alert kind raised by a device
+// type, if any.
+func sensorAlertKind(device Device) (events.AlertKind, bool) {
+	switch device.Type {
+	case DeviceTypeLeakSensor:
+		return events.AlertKindLeak, true
+	case DeviceTypeSmokeSensor:
+		return events.AlertKindSmoke, true
+	case DeviceTypeContactSensor:
+		return events.AlertKindContact, device.AlertOnOpen
+	}
+	return "", false
+}
+
+// sensorAlarm reports whether the state shows the alarm condition for the
+// given alert kind.
+func sensorAlarm(kind events.AlertKind, state State) bool {
+	switch kind {
+	case events.AlertKindLeak:
+		return state.WaterLeak != nil && *state.WaterLeak
+	case events.AlertKindSmoke:
+		return state.Smoke != nil && *state.Smoke
+	case events.AlertKindContact:
+		// zigbee2mqtt reports contact=false when the contact is open.
+		return state.Contact != nil && !*state.Contact
+	}
+	return false
+}
+
+// ActiveAlert reports the acknowledgeable alert a device's state is
+// currently raising, if any.
+func ActiveAlert(device Device, state State) (events.AlertKind, bool) {
+	kind, ok := sensorAlertKind(device)
+	if !ok || !sensorAlarm(kind, state) {
+		return "", false
+	}
+	return kind, true
+}
+
+// SetAlertSilence sets how long an acknowledged alert stays silenced.
+func (dm *Manager) SetAlertSilence(window time.Duration) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.alertSilence = window
+}
+
+// alertAck returns the unexpired acknowledgement for a device, if any.
+// Callers must hold dm.mu.
+func (dm *Manager) alertAck(deviceID string, now time.Time) *AlertAck {
+	ack, ok := dm.acks[deviceID]
+	if !ok || !now.Before(ack.Until) {
+		return nil
+	}
+	return &ack
+}
+
+// AcknowledgeAlert acknowledges the active leak, smoke or contact alert of a
+// sensor on behalf of by. The acknowledgement is recorded in the event log,
+// exposed to HomeKit and silences repeats of the alert for the configured
+// window.
+func (dm *Manager) AcknowledgeAlert(deviceID, by string) (AlertAck, error) {
+	info, ok := dm.deviceInfos()[deviceID]
+	if !ok {
+		return AlertAck{}, fmt.Errorf("device %s not found", deviceID)
+	}
+	kind, ok := sensorAlertKind(info.Config)
+	if !ok {
+		return AlertAck{}, fmt.Errorf("device %s does not raise acknowledgeable alerts", deviceID)
+	}
+
+	now := dm.Now()
+	dm.mu.Lock()
+	if !sensorAlarm(kind, *dm.states[deviceID]) {
+		dm.mu.Unlock()
+		return AlertAck{}, ErrNoActiveAlert
+	}
+	window := dm.alertSilence
+	if window <= 0 {
+		window = DefaultAlertSilence
+	}
+	ack := AlertAck{Kind: kind, By: by, At: now, Until: now.Add(window)}
+	dm.acks[deviceID] = ack
+	stateCopy := *dm.states[deviceID]
+	dm.mu.Unlock()
+
+	dm.logger.Info("Alert acknowledged",
+		"device_id", deviceID,
+		"kind", kind,
+		"by", by,
+		"silenced_until", ack.Until,
+	)
+
+	if dm.eventBus != nil && dm.stateEventClient != nil {
+		dm.publishAlert(events.AlertEvent{
+			Timestamp:      now,
+			DeviceID:       deviceID,
+			Name:           info.Config.Name,
+			Kind:           kind,
+			Active:         true,
+			Message:        fmt.Sprintf("Acknowledged by %s, repeats silenced until %s", by, ack.Until.Format(time.Kitchen)),
+			AcknowledgedBy: by,
+		})
+	}
+
+	// Push the acknowledgement to HomeKit now and clear it there once the
+	// silence window ends.
+	dm.publishStateUpdate("ack", deviceID, stateCopy)
+	time.AfterFunc(window, func() {
+		if _, state, ok := dm.Device(deviceID); ok {
+			dm.publishStateUpdate("ack", deviceID, state)
+		}
+	})
+
+	return ack, nil
+}
+
+// raiseSensorAlert publishes a leak, smoke or contact alert for a sensor.
+// New alerts are not published while an acknowledgement silences them;
+// clears always are.
+func (dm *Manager) raiseSensorAlert(deviceID string, kind events.AlertKind, active bool, message string) {
+	if dm.eventBus == nil || dm.stateEventClient == nil {
+		return
+	}
+
+	if active {
+		dm.mu.RLock()
+		ack := dm.alertAck(deviceID, dm.Now())
+		dm.mu.RUnlock()
+		if ack != nil && ack.Kind == kind {
+			dm.logger.Info("Alert silenced by acknowledgement",
+				"device_id", deviceID,
+				"kind", kind,
+				"acknowledged_by", ack.By,
+			)
+			return
+		}
+	}
+
+	dm.publishAlert(events.AlertEvent{
+		Timestamp: dm.Now(),
+		DeviceID:  deviceID,
+		Name:      dm.deviceInfos()[deviceID].Config.Name,
+		Kind:      kind,
+		Active:    active,
+		Message:   message,
+	})
+}
+
+// checkSensorAlert raises or clears a sensor's alert when its alarm
+// condition changes, closing shutoff valves on a leak and running the smoke
+// response plan on smoke.
+func (dm *Manager) checkSensorAlert(ctx context.Context, deviceID string, before, after State) {
+	kind, ok := sensorAlertKind(dm.deviceInfos()[deviceID].Config)
+	if !ok {
+		return
+	}
+
+	was, is := sensorAlarm(kind, before), sensorAlarm(kind, after)
+	switch {
+	case is && !was:
+		message := dm.testLabel(deviceID, alertMessage(kind, true))
+		switch kind {
+		case events.AlertKindLeak:
+			dm.handleLeak(ctx, deviceID)
+		case events.AlertKindSmoke:
+			if n, ok := dm.handleSmoke(ctx, deviceID); ok {
+				message += fmt.Sprintf(", response plan activated %d devices", n)
+			}
+		}
+		dm.raiseSensorAlert(deviceID, kind, true, message)
+	case was && !is:
+		dm.raiseSensorAlert(deviceID, kind, false, dm.testLabel(deviceID, alertMessage(kind, false)))
+	}
+}
+
+func alertMessage(kind events.AlertKind, active bool) string {
+	switch kind {
+	case events.AlertKindLeak:
+		if active {
+			return "Water leak detected"
+		}
+		return "Leak cleared"
+	case events.AlertKindSmoke:
+		if active {
+			return "Smoke detected"
+		}
+		return "Smoke cleared"
+	default:
+		if active {
+			return "Contact opened"
+		}
+		return "Contact closed"
+	}
+}
@@ -0,0 +1,54 @@
+package devices
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+func TestAcknowledgeAlert(t *testing.T) {
+	dm, bus := newTestManager(t, []Device{
+		{ID: "leak", Name: "Leak", Type: DeviceTypeLeakSensor},
+		{ID: "door", Name: "Door", Type: DeviceTypeContactSensor},
+		{ID: "gate", Name: "Gate", Type: DeviceTypeContactSensor, AlertOnOpen: true},
+	}, nil, nil)
+	dm.SetAlertSilence(time.Hour)
+
+	if _, err := dm.AcknowledgeAlert("leak", "alice"); !errors.Is(err, ErrNoActiveAlert) {
+		t.Fatalf("ack without alert: err = %v, want ErrNoActiveAlert", err)
+	}
+	if _, err := dm.AcknowledgeAlert("door", "alice"); err == nil {
+		t.Error("acknowledged a contact sensor without alert_on_open")
+	}
+
+	wet := true
+	dm.states["leak"].WaterLeak = &wet
+	ack, err := dm.AcknowledgeAlert("leak", "alice")
+	if err != nil {
+		t.Fatalf("AcknowledgeAlert: %v", err)
+	}
+	if ack.Kind != events.AlertKindLeak || ack.By != "alice" || ack.Until.Sub(ack.At) != time.Hour {
+		t.Errorf("ack = %+v, want leak by alice for an hour", ack)
+	}
+	if _, state, _ := dm.Device("leak"); state.Ack == nil || state.Ack.By != "alice" {
+		t.Errorf("state.Ack = %+v, want acknowledged by alice", state.Ack)
+	}
+
+	alerts := bus.Stats().Alerts
+	dm.raiseSensorAlert("leak", events.AlertKindLeak, true, "Water leak detected")
+	if got := bus.Stats().Alerts; got != alerts {
+		t.Errorf("repeat alert published while silenced (%d alerts, want %d)", got, alerts)
+	}
+	dm.raiseSensorAlert("leak", events.AlertKindLeak, false, "Leak cleared")
+	if got := bus.Stats().Alerts; got != alerts+1 {
+		t.Errorf("clear not published while silenced (%d alerts, want %d)", got, alerts+1)
+	}
+
+	open := false
+	dm.states["gate"].Contact = &open
+	if kind, ok := ActiveAlert(dm.deviceInfos()["gate"].Config, *dm.states["gate"]); !ok || kind != events.AlertKindContact {
+		t.Errorf("ActiveAlert(open gate) = %q, %v, want contact", kind, ok)
+	}
+}
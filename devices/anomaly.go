@@ -0,0 +1,125 @@
+package devices
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+const (
+	// anomalyAlpha is the EWMA weight of the latest accepted reading.
+	anomalyAlpha = 0.1
+	// anomalyWarmup is how many readings are needed before spikes are
+	// detected.
+	anomalyWarmup = 10
+	// anomalyBand is the number of standard deviations a reading may move
+	// from the running mean before it counts as a spike.
+	anomalyBand = 4.0
+	// anomalyRebase is how many consecutive, mutually consistent spike
+	// readings are taken as a real change rather than a fault.
+	anomalyRebase = 3
+)
+
+// anomalyLimits are the plausible range and the smallest jump treated as a
+// spike for each checked sensor field. Pressure sensors report station
+// pressure, which at altitude is well below sea level pressure (about
+// 835 hPa at 1600 m), so its range only rules out the impossible and
+// faulty readings are left to the spike check.
+var anomalyLimits = map[string]struct {
+	min, max float64
+	minJump  float64
+	unit     string
+}{
+	"Temperature": {min: -39.9, max: 85, minJump: 5, unit: "°C"},
+	"Humidity":    {min: 0.1, max: 100, minJump: 15, unit: "%"},
+	"Pressure":    {min: 300, max: 1100, minJump: 10, unit: "hPa"},
+}
+
+type anomalyStats struct {
+	n        int
+	mean     float64
+	variance float64
+	spikes   []float64 // consecutive rejected spike readings
+}
+
+// AnomalyDetector flags sensor readings that are physically implausible or
+// far outside a device's recent behaviour, so a faulty reading does not
+// reach HomeKit automations.
+type AnomalyDetector struct {
+	mu    sync.Mutex
+	stats map[string]*anomalyStats
+}
+
+// NewAnomalyDetector creates an empty detector.
+func NewAnomalyDetector() *AnomalyDetector {
+	return &AnomalyDetector{stats: make(map[string]*anomalyStats)}
+}
+
+// Check reports why a reading of field is anomalous, or "" if it is
+// accepted. Accepted readings update the running statistics.
+func (d *AnomalyDetector) Check(deviceID, field string, value float64) string {
+	limits, ok := anomalyLimits[field]
+	if !ok {
+		return ""
+	}
+
+	if math.IsNaN(value) || math.IsInf(value, 0) || value < limits.min || value > limits.max {
+		return fmt.Sprintf("implausible %s reading %g %s", field, value, limits.unit)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := deviceID + "/" + field
+	s, ok := d.stats[key]
+	if !ok {
+		s = &anomalyStats{}
+		d.stats[key] = s
+	}
+
+	if s.n >= anomalyWarmup {
+		dev := math.Abs(value - s.mean)
+		if dev > limits.minJump && dev > anomalyBand*math.Sqrt(s.variance) {
+			if !s.consistentSpike(value, limits.minJump) {
+				s.spikes = s.spikes[:0]
+			}
+			s.spikes = append(s.spikes, value)
+			if len(s.spikes) < anomalyRebase {
+				return fmt.Sprintf("%s jumped to %g %s from around %.1f %s", field, value, limits.unit, s.mean, limits.unit)
+			}
+
+			// The sensor keeps agreeing with itself, so the change is
+			// real (e.g. it was moved). Start over from the new level.
+			spikes := s.spikes
+			*s = anomalyStats{}
+			for _, v := range spikes {
+				s.observe(v)
+			}
+			return ""
+		}
+	}
+
+	s.spikes = s.spikes[:0]
+	s.observe(value)
+	return ""
+}
+
+func (s *anomalyStats) consistentSpike(value, tolerance float64) bool {
+	for _, v := range s.spikes {
+		if math.Abs(v-value) > tolerance {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *anomalyStats) observe(value float64) {
+	s.n++
+	if s.n == 1 {
+		s.mean = value
+		return
+	}
+	diff := value - s.mean
+	s.mean += anomalyAlpha * diff
+	s.variance = (1 - anomalyAlpha) * (s.variance + anomalyAlpha*diff*diff)
+}
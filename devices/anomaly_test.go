@@ -0,0 +1,97 @@
+package devices
+
+import (
+	"testing"
+)
+
+func TestAnomalyDetectorImplausible(t *testing.T) {
+	d := NewAnomalyDetector()
+
+	for _, tt := range []struct {
+		field string
+		value float64
+	}{
+		{"Temperature", -40},
+		{"Temperature", 120},
+		{"Humidity", 0},
+		{"Humidity", 101},
+		{"Pressure", 0},
+	} {
+		if reason := d.Check("dev", tt.field, tt.value); reason == "" {
+			t.Errorf("Check(%s, %v) accepted implausible reading", tt.field, tt.value)
+		}
+	}
+
+	// Station pressure at altitude is plausible.
+	for range anomalyWarmup + 1 {
+		if reason := d.Check("mountain", "Pressure", 835); reason != "" {
+			t.Fatalf("pressure at 1600 m flagged: %s", reason)
+		}
+	}
+
+	if reason := d.Check("dev", "Illuminance", -5); reason != "" {
+		t.Errorf("unchecked field flagged: %s", reason)
+	}
+}
+
+func TestAnomalyDetectorSpike(t *testing.T) {
+	d := NewAnomalyDetector()
+
+	for i := range anomalyWarmup {
+		if reason := d.Check("dev", "Temperature", 21+float64(i%3)*0.1); reason != "" {
+			t.Fatalf("normal reading %d flagged: %s", i, reason)
+		}
+	}
+
+	if reason := d.Check("dev", "Temperature", 60); reason == "" {
+		t.Fatal("spike accepted")
+	}
+	if reason := d.Check("dev", "Temperature", 21.1); reason != "" {
+		t.Fatalf("reading after spike flagged: %s", reason)
+	}
+
+	// A sustained, consistent change is accepted as real after a few
+	// readings, e.g. a sensor moved outdoors.
+	for i := range anomalyRebase - 1 {
+		if reason := d.Check("dev", "Temperature", 2); reason == "" {
+			t.Fatalf("reading %d of new level accepted too early", i)
+		}
+	}
+	if reason := d.Check("dev", "Temperature", 2); reason != "" {
+		t.Fatalf("sustained change still flagged: %s", reason)
+	}
+	if reason := d.Check("dev", "Temperature", 2.2); reason != "" {
+		t.Fatalf("reading at new level flagged: %s", reason)
+	}
+}
+
+func TestManagerRejectsAnomalousReadings(t *testing.T) {
+	dm, _ := newTestManager(t, []Device{{ID: "sensor", Name: "Sensor", Type: DeviceTypeClimateSensor}}, nil, nil)
+
+	good, bad := 21.5, -40.0
+	state := dm.states["sensor"]
+
+	if !dm.acceptReading(state, "Temperature", &good) {
+		t.Fatal("good reading rejected")
+	}
+	state.Temperature = &good
+
+	if dm.acceptReading(state, "Temperature", &bad) {
+		t.Fatal("implausible reading accepted")
+	}
+	if _, ok := state.Anomalies["Temperature"]; !ok {
+		t.Fatalf("Anomalies = %v, want Temperature flagged", state.Anomalies)
+	}
+
+	// The flag is on a copy, so an earlier snapshot is unaffected.
+	snapshot := *state
+	if !dm.acceptReading(state, "Temperature", &good) {
+		t.Fatal("good reading after anomaly rejected")
+	}
+	if state.Anomalies != nil {
+		t.Errorf("Anomalies = %v, want cleared", state.Anomalies)
+	}
+	if _, ok := snapshot.Anomalies["Temperature"]; !ok {
+		t.Error("clearing the anomaly mutated an earlier snapshot")
+	}
+}
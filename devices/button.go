@@ -0,0 +1,130 @@
+package devices
+
+import "fmt"
+
+// ButtonPress is a press reported to HomeKit, with the values of the
+// ProgrammableSwitchEvent characteristic.
+type ButtonPress int
+
+const (
+	ButtonPressSingle ButtonPress = 0
+	ButtonPressDouble ButtonPress = 1
+	ButtonPressLong   ButtonPress = 2
+)
+
+// Button is one button of a remote and the zigbee2mqtt actions that count
+// as a single, double and long press of it, e.g. "1_single", "1_double"
+// and "1_hold". An empty action means the button does not report that
+// press.
+//
+// Release is the action reported when a held button is let go, e.g.
+// "1_release". It is not a press; a button with a release reports its
+// long press once per hold even when the remote repeats the hold action.
+type Button struct {
+	Name    string `json:"name"`
+	Single  string `json:"single,omitempty"`
+	Double  string `json:"double,omitempty"`
+	Long    string `json:"long,omitempty"`
+	Release string `json:"release,omitempty"`
+}
+
+// DefaultButtons is a single button reporting zigbee2mqtt's common
+// single, double and hold actions, used when a button device lists none.
+var DefaultButtons = []Button{{Name: "Button", Single: "single", Double: "double", Long: "hold"}}
+
+// ButtonList returns the buttons of a button or doorbell device.
+func (d Device) ButtonList() []Button {
+	if len(d.Buttons) > 0 {
+		return d.Buttons
+	}
+	if remote, ok := remotes[d.Remote]; ok {
+		return remote.buttons
+	}
+	return DefaultButtons
+}
+
+// Presses returns the presses the button reports.
+func (b Button) Presses() []ButtonPress {
+	var presses []ButtonPress
+	if b.Single != "" {
+		presses = append(presses, ButtonPressSingle)
+	}
+	if b.Double != "" {
+		presses = append(presses, ButtonPressDouble)
+	}
+	if b.Long != "" {
+		presses = append(presses, ButtonPressLong)
+	}
+	return presses
+}
+
+// ButtonPress returns which button an action pressed and how. ok is false
+// for actions that are not a press, such as a release.
+func (d Device) ButtonPress(action string) (index int, press ButtonPress, ok bool) {
+	for i, b := range d.ButtonList() {
+		switch action {
+		case b.Single:
+			return i, ButtonPressSingle, true
+		case b.Double:
+			return i, ButtonPressDouble, true
+		case b.Long:
+			return i, ButtonPressLong, true
+		}
+	}
+	return 0, 0, false
+}
+
+// ButtonRelease returns the buttons an action releases. Buttons may share
+// a release, as the dimming buttons of IKEA remotes do.
+func (d Device) ButtonRelease(action string) []int {
+	var released []int
+	for i, b := range d.ButtonList() {
+		if b.Release != "" && b.Release == action {
+			released = append(released, i)
+		}
+	}
+	return released
+}
+
+func (d Device) validateButtons() error {
+	if len(d.Buttons) > 0 && d.Type != DeviceTypeButton && d.Type != DeviceTypeDoorbell {
+		return fmt.Errorf("device %s: buttons are only supported for button and doorbell devices", d.ID)
+	}
+	if len(d.Buttons) > 1 && d.Type == DeviceTypeDoorbell {
+		return fmt.Errorf("device %s: a doorbell has a single button", d.ID)
+	}
+
+	names := make(map[string]bool, len(d.Buttons))
+	actions := make(map[string]bool)
+	for _, b := range d.Buttons {
+		if b.Name == "" {
+			return fmt.Errorf("device %s: button without a name", d.ID)
+		}
+		if names[b.Name] {
+			return fmt.Errorf("device %s: button %q listed twice", d.ID, b.Name)
+		}
+		names[b.Name] = true
+
+		if len(b.Presses()) == 0 {
+			return fmt.Errorf("device %s: button %q has no actions", d.ID, b.Name)
+		}
+		for _, action := range []string{b.Single, b.Double, b.Long} {
+			if action == "" {
+				continue
+			}
+			if actions[action] {
+				return fmt.Errorf("device %s: action %q is bound to more than one press", d.ID, action)
+			}
+			actions[action] = true
+		}
+		if b.Release != "" && b.Long == "" {
+			return fmt.Errorf("device %s: button %q has a release but no long press", d.ID, b.Name)
+		}
+	}
+	for _, b := range d.Buttons {
+		if actions[b.Release] {
+			return fmt.Errorf("device %s: release %q of button %q is also a press", d.ID, b.Release, b.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package devices
+
+import "testing"
+
+func TestButtonPress(t *testing.T) {
+	remote := Device{ID: "remote", Type: DeviceTypeButton, Buttons: []Button{
+		{Name: "On", Single: "on", Long: "brightness_move_up"},
+		{Name: "Off", Single: "off", Long: "brightness_move_down"},
+	}}
+
+	tests := []struct {
+		device    Device
+		action    string
+		wantIndex int
+		wantPress ButtonPress
+		wantOK    bool
+	}{
+		{remote, "on", 0, ButtonPressSingle, true},
+		{remote, "brightness_move_down", 1, ButtonPressLong, true},
+		{remote, "brightness_stop", 0, 0, false},
+		{Device{Type: DeviceTypeButton}, "double", 0, ButtonPressDouble, true},
+		{Device{Type: DeviceTypeButton}, "hold", 0, ButtonPressLong, true},
+		{Device{Type: DeviceTypeButton}, "release", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			index, press, ok := tt.device.ButtonPress(tt.action)
+			if index != tt.wantIndex || press != tt.wantPress || ok != tt.wantOK {
+				t.Errorf("ButtonPress(%q) = %d, %d, %v, want %d, %d, %v", tt.action, index, press, ok, tt.wantIndex, tt.wantPress, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidateButtons(t *testing.T) {
+	tests := []struct {
+		name    string
+		device  Device
+		wantErr bool
+	}{
+		{"default buttons", Device{ID: "a", Type: DeviceTypeButton}, false},
+		{"two buttons", Device{ID: "a", Type: DeviceTypeButton, Buttons: []Button{{Name: "1", Single: "1_single"}, {Name: "2", Single: "2_single"}}}, false},
+		{"not a button device", Device{ID: "a", Type: DeviceTypeSwitch, Buttons: []Button{{Name: "1", Single: "single"}}}, true},
+		{"no name", Device{ID: "a", Type: DeviceTypeButton, Buttons: []Button{{Single: "single"}}}, true},
+		{"duplicate name", Device{ID: "a", Type: DeviceTypeButton, Buttons: []Button{{Name: "1", Single: "a"}, {Name: "1", Single: "b"}}}, true},
+		{"no actions", Device{ID: "a", Type: DeviceTypeButton, Buttons: []Button{{Name: "1"}}}, true},
+		{"doorbell ring action", Device{ID: "a", Type: DeviceTypeDoorbell, Buttons: []Button{{Name: "Bell", Single: "ring"}}}, false},
+		{"doorbell with two buttons", Device{ID: "a", Type: DeviceTypeDoorbell, Buttons: []Button{{Name: "1", Single: "a"}, {Name: "2", Single: "b"}}}, true},
+		{"action twice", Device{ID: "a", Type: DeviceTypeButton, Buttons: []Button{{Name: "1", Single: "a"}, {Name: "2", Long: "a"}}}, true},
+		{"shared release", Device{ID: "a", Type: DeviceTypeButton, Buttons: []Button{{Name: "1", Long: "1_hold", Release: "stop"}, {Name: "2", Long: "2_hold", Release: "stop"}}}, false},
+		{"release without long press", Device{ID: "a", Type: DeviceTypeButton, Buttons: []Button{{Name: "1", Single: "a", Release: "stop"}}}, true},
+		{"release is a press", Device{ID: "a", Type: DeviceTypeButton, Buttons: []Button{{Name: "1", Single: "a", Long: "b", Release: "a"}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.device.validateButtons()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateButtons() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRemote(t *testing.T) {
+	styrbar := Device{ID: "styrbar", Type: DeviceTypeButton, Remote: RemoteStyrbar}
+
+	if got := len(styrbar.ButtonList()); got != 4 {
+		t.Errorf("STYRBAR buttons = %d, want 4", got)
+	}
+	if index, press, ok := styrbar.ButtonPress("arrow_right_hold"); !ok || index != 3 || press != ButtonPressLong {
+		t.Errorf("ButtonPress(arrow_right_hold) = %d, %d, %v, want right button long press", index, press, ok)
+	}
+	if got := styrbar.ButtonRelease("brightness_stop"); len(got) != 2 || got[0] != 0 || got[1] != 1 {
+		t.Errorf("ButtonRelease(brightness_stop) = %v, want on and off", got)
+	}
+	if _, _, ok := styrbar.ButtonPress("brightness_stop"); ok {
+		t.Error("a release counted as a press")
+	}
+
+	if r, ok := RemoteForModel("E1524/E1810"); !ok || r != RemoteTradfri {
+		t.Errorf("RemoteForModel(E1524/E1810) = %q, %v", r, ok)
+	}
+
+	cube := Device{ID: "cube", Type: DeviceTypeButton, Remote: RemoteAqaraCube}
+	if index, press, ok := cube.ButtonPress("flip180"); !ok || index != 1 || press != ButtonPressDouble {
+		t.Errorf("ButtonPress(flip180) = %d, %d, %v, want flip double press", index, press, ok)
+	}
+	if r, ok := RemoteForModel("CTP-R01"); !ok || r != RemoteAqaraCube {
+		t.Errorf("RemoteForModel(CTP-R01) = %q, %v", r, ok)
+	}
+	lamp := Device{ID: "lamp", Type: DeviceTypeLightbulb}
+	for action, wantErr := range map[string]bool{"throw": false, "rotate_left": false, "brightness_stop": true} {
+		cube.Actions = map[string][]ActionBinding{action: {{Target: "lamp", Command: ActionCommandToggle}}}
+		err := validateActions(&Config{Devices: []Device{cube, lamp}})
+		if (err != nil) != wantErr {
+			t.Errorf("cube action %q: validateActions() error = %v, wantErr %v", action, err, wantErr)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		device  Device
+		wantErr bool
+	}{
+		{"styrbar", styrbar, false},
+		{"unknown remote", Device{ID: "a", Type: DeviceTypeButton, Remote: "hue_dimmer"}, true},
+		{"not a button", Device{ID: "a", Type: DeviceTypeDoorbell, Remote: RemoteStyrbar}, true},
+		{"remote and buttons", Device{ID: "a", Type: DeviceTypeButton, Remote: RemoteStyrbar, Buttons: []Button{{Name: "1", Single: "a"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.device.validateRemote()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateRemote() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package devices
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Category overrides the HomeKit accessory category of a device, which
+// picks the icon the Home app shows for it, e.g. to show a plug powering
+// a lamp as a lightbulb.
+type Category string
+
+const (
+	CategoryOther              Category = "other"
+	CategoryFan                Category = "fan"
+	CategoryGarageDoor         Category = "garage_door"
+	CategoryLightbulb          Category = "lightbulb"
+	CategoryDoorLock           Category = "door_lock"
+	CategoryOutlet             Category = "outlet"
+	CategorySwitch             Category = "switch"
+	CategoryThermostat         Category = "thermostat"
+	CategorySensor             Category = "sensor"
+	CategorySecuritySystem     Category = "security_system"
+	CategoryDoor               Category = "door"
+	CategoryWindow             Category = "window"
+	CategoryWindowCovering     Category = "window_covering"
+	CategoryProgrammableSwitch Category = "programmable_switch"
+	CategoryVideoDoorbell      Category = "video_doorbell"
+	CategoryAirPurifier        Category = "air_purifier"
+	CategoryHeater             Category = "heater"
+	CategoryAirConditioner     Category = "air_conditioner"
+	CategoryHumidifier         Category = "humidifier"
+	CategoryDehumidifier       Category = "dehumidifier"
+	CategorySprinkler          Category = "sprinkler"
+	CategoryFaucet             Category = "faucet"
+	CategoryShowerSystem       Category = "shower_system"
+)
+
+// Categories lists the accessory categories a device may be given.
+var Categories = []Category{
+	CategoryOther,
+	CategoryFan,
+	CategoryGarageDoor,
+	CategoryLightbulb,
+	CategoryDoorLock,
+	CategoryOutlet,
+	CategorySwitch,
+	CategoryThermostat,
+	CategorySensor,
+	CategorySecuritySystem,
+	CategoryDoor,
+	CategoryWindow,
+	CategoryWindowCovering,
+	CategoryProgrammableSwitch,
+	CategoryVideoDoorbell,
+	CategoryAirPurifier,
+	CategoryHeater,
+	CategoryAirConditioner,
+	CategoryHumidifier,
+	CategoryDehumidifier,
+	CategorySprinkler,
+	CategoryFaucet,
+	CategoryShowerSystem,
+}
+
+func validateCategory(device Device) error {
+	if device.Category == "" || slices.Contains(Categories, device.Category) {
+		return nil
+	}
+	return fmt.Errorf("device %s has invalid category %q", device.ID, device.Category)
+}
+
+// categoryPresentation returns the service a switch or outlet device with
+// category c is exposed as. The Home app draws bridged accessories from
+// their service, so the category alone would not change the icon.
+func categoryPresentation(c Category) (Presentation, bool) {
+	switch c {
+	case CategorySwitch:
+		return PresentationSwitch, true
+	case CategoryOutlet:
+		return PresentationOutlet, true
+	case CategoryFan:
+		return PresentationFan, true
+	case CategoryLightbulb:
+		return PresentationLightbulb, true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,61 @@
+package devices
+
+import "fmt"
+
+// climateHysteresis is how far the temperature must recover past a frost or
+// heat threshold before the warning clears, so a reading hovering at the
+// threshold does not flap.
+const climateHysteresis = 0.5
+
+// ClimateWarning is a frost or heat warning change for a device.
+type ClimateWarning struct {
+	Kind        string // "frost" or "heat"
+	Active      bool
+	Threshold   float64
+	Temperature float64
+}
+
+func validateClimateThresholds(device Device) error {
+	if device.FrostBelow == nil && device.HeatAbove == nil {
+		return nil
+	}
+	if device.Type != DeviceTypeClimateSensor || !device.Features.Temperature {
+		return fmt.Errorf("device %s: frost_below and heat_above need a climate sensor with temperature", device.ID)
+	}
+	if device.FrostBelow != nil && device.HeatAbove != nil && *device.FrostBelow >= *device.HeatAbove {
+		return fmt.Errorf("device %s: frost_below (%g) must be below heat_above (%g)", device.ID, *device.FrostBelow, *device.HeatAbove)
+	}
+	return nil
+}
+
+// evaluateClimate updates the frost and heat warnings on state for a new
+// temperature and returns the warnings that changed.
+func evaluateClimate(device Device, state *State, temperature float64) []ClimateWarning {
+	var changed []ClimateWarning
+
+	if device.FrostBelow != nil {
+		threshold := *device.FrostBelow
+		active := state.FrostWarning != nil && *state.FrostWarning
+		next := temperature < threshold || (active && temperature < threshold+climateHysteresis)
+		if state.FrostWarning == nil || next != active {
+			state.FrostWarning = &next
+			if next != active {
+				changed = append(changed, ClimateWarning{Kind: "frost", Active: next, Threshold: threshold, Temperature: temperature})
+			}
+		}
+	}
+
+	if device.HeatAbove != nil {
+		threshold := *device.HeatAbove
+		active := state.HeatWarning != nil && *state.HeatWarning
+		next := temperature > threshold || (active && temperature > threshold-climateHysteresis)
+		if state.HeatWarning == nil || next != active {
+			state.HeatWarning = &next
+			if next != active {
+				changed = append(changed, ClimateWarning{Kind: "heat", Active: next, Threshold: threshold, Temperature: temperature})
+			}
+		}
+	}
+
+	return changed
+}
@@ -0,0 +1,55 @@
+package devices
+
+import "testing"
+
+func TestEvaluateClimate(t *testing.T) {
+	frost, heat := 2.0, 45.0
+	device := Device{ID: "greenhouse", Type: DeviceTypeClimateSensor, FrostBelow: &frost, HeatAbove: &heat}
+	state := &State{}
+
+	steps := []struct {
+		temp        float64
+		frost, heat bool
+		changes     int
+	}{
+		{10, false, false, 0},
+		{1.9, true, false, 1},
+		{2.3, true, false, 0}, // within hysteresis
+		{2.5, false, false, 1},
+		{45.2, false, true, 1},
+		{44.6, false, true, 0},
+		{44.4, false, false, 1},
+	}
+
+	for _, s := range steps {
+		changed := evaluateClimate(device, state, s.temp)
+		if *state.FrostWarning != s.frost || *state.HeatWarning != s.heat {
+			t.Errorf("at %.1f °C frost=%v heat=%v, want %v %v", s.temp, *state.FrostWarning, *state.HeatWarning, s.frost, s.heat)
+		}
+		if len(changed) != s.changes {
+			t.Errorf("at %.1f °C %d warnings changed, want %d", s.temp, len(changed), s.changes)
+		}
+	}
+}
+
+func TestValidateClimateThresholds(t *testing.T) {
+	low, high := 2.0, 45.0
+	climate := Device{ID: "c", Type: DeviceTypeClimateSensor, Features: DeviceFeatures{Temperature: true}}
+
+	ok := climate
+	ok.FrostBelow, ok.HeatAbove = &low, &high
+	if err := validateClimateThresholds(ok); err != nil {
+		t.Errorf("valid thresholds rejected: %v", err)
+	}
+
+	inverted := climate
+	inverted.FrostBelow, inverted.HeatAbove = &high, &low
+	if err := validateClimateThresholds(inverted); err == nil {
+		t.Error("frost_below above heat_above accepted")
+	}
+
+	plug := Device{ID: "p", Type: DeviceTypeOutlet, FrostBelow: &low}
+	if err := validateClimateThresholds(plug); err == nil {
+		t.Error("threshold on an outlet accepted")
+	}
+}
@@ -0,0 +1,81 @@
+package devices
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time. The manager reads it for schedules, night mode,
+// alert acknowledgements, health and LastSeen, so tests and the time
+// simulator can move time for them.
+type Clock interface {
+	Now() time.Time
+}
+
+// WallClock is the system clock.
+type WallClock struct{}
+
+// Now returns the current time.
+func (WallClock) Now() time.Time { return time.Now() }
+
+// SimClock is a clock that runs at the wall clock's pace from an offset
+// that can be moved, for simulating time in tests and the simulator.
+type SimClock struct {
+	mu     sync.Mutex
+	offset time.Duration
+}
+
+// NewSimClock returns a simulated clock starting at the wall clock's time.
+func NewSimClock() *SimClock {
+	return &SimClock{}
+}
+
+// Now returns the simulated time.
+func (c *SimClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Now().Add(c.offset)
+}
+
+// Warp moves the clock by d, forwards or backwards.
+func (c *SimClock) Warp(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset += d
+}
+
+// Set moves the clock to t.
+func (c *SimClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset = time.Until(t)
+}
+
+// Offset returns how far the clock is from the wall clock.
+func (c *SimClock) Offset() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.offset
+}
+
+// SetClock sets the clock the manager reads, before it runs. nil restores
+// the wall clock.
+func (dm *Manager) SetClock(clock Clock) {
+	if clock == nil {
+		clock = WallClock{}
+	}
+	dm.clock = clock
+}
+
+// Now returns the time on the manager's clock.
+func (dm *Manager) Now() time.Time {
+	return dm.clock.Now()
+}
+
+// CheckTimers runs the schedule and night mode checks now rather than at
+// their next tick, e.g. after the simulated clock moved.
+func (dm *Manager) CheckTimers() {
+	now := dm.Now()
+	dm.runSchedules(now)
+	dm.evaluateNightMode(now)
+}
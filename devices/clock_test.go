@@ -0,0 +1,114 @@
+package devices
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSimClock(t *testing.T) {
+	clock := NewSimClock()
+	if d := time.Since(clock.Now()); d < -time.Second || d > time.Second {
+		t.Errorf("new clock is %s off the wall clock", d)
+	}
+
+	clock.Warp(2 * time.Hour)
+	if d := clock.Now().Sub(time.Now()); d < 2*time.Hour-time.Second || d > 2*time.Hour+time.Second {
+		t.Errorf("warped clock is %s ahead, want 2h", d)
+	}
+
+	at := time.Date(2024, 6, 21, 22, 59, 0, 0, time.Local)
+	clock.Set(at)
+	if d := clock.Now().Sub(at); d < 0 || d > time.Second {
+		t.Errorf("set clock = %s, want %s", clock.Now(), at)
+	}
+}
+
+func TestManagerSimClock(t *testing.T) {
+	commands := make(chan CommandEvent, 10)
+	dm, _ := newTestManager(t, []Device{
+		{ID: "plug", Name: "Plug", Type: DeviceTypeOutlet},
+		{ID: "leak", Name: "Leak", Type: DeviceTypeLeakSensor},
+	}, commands, nil)
+	clock := NewSimClock()
+	clock.Set(time.Date(2024, 6, 21, 22, 59, 0, 0, time.Local))
+	dm.SetClock(clock)
+
+	// A schedule runs once the clock is warped past its time.
+	dm.SetSchedules([]Schedule{{At: "23:00", Actions: []ActionBinding{{Target: "plug", Command: ActionCommandOff}}}}, nil)
+	dm.CheckTimers()
+	if len(commands) != 0 {
+		t.Fatal("schedule ran before 23:00")
+	}
+	clock.Warp(2 * time.Minute)
+	dm.CheckTimers()
+	select {
+	case cmd := <-commands:
+		if cmd.DeviceID != "plug" || cmd.On == nil || *cmd.On {
+			t.Errorf("command = %+v, want the plug off", cmd)
+		}
+	default:
+		t.Error("schedule did not run after warping past 23:00")
+	}
+
+	// An acknowledgement expires once the clock passes its window.
+	dm.SetAlertSilence(time.Hour)
+	wet := true
+	dm.states["leak"].WaterLeak = &wet
+	if _, err := dm.AcknowledgeAlert("leak", "alice"); err != nil {
+		t.Fatalf("AcknowledgeAlert: %v", err)
+	}
+	clock.Warp(59 * time.Minute)
+	if _, state, _ := dm.Device("leak"); state.Ack == nil {
+		t.Error("acknowledgement expired within its window")
+	}
+	clock.Warp(2 * time.Minute)
+	if _, state, _ := dm.Device("leak"); state.Ack != nil {
+		t.Errorf("acknowledgement = %+v after its window, want expired", state.Ack)
+	}
+}
+
+func TestConnectionStatus(t *testing.T) {
+	now := time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		lastSeen  time.Time
+		wantState string
+		wantNote  string
+	}{
+		{"never seen", time.Time{}, "disconnected", "Never seen"},
+		{"just now", now, "connected", "Last seen: 0s ago"},
+		{"under 30s", now.Add(-29 * time.Second), "connected", "Last seen: 29s ago"},
+		{"at 30s", now.Add(-30 * time.Second), "stale", "Last seen: 30s ago"},
+		{"under 60s", now.Add(-59 * time.Second), "stale", "Last seen: 59s ago"},
+		{"at 60s", now.Add(-60 * time.Second), "disconnected", "Last seen: 1m0s ago"},
+		{"an hour", now.Add(-time.Hour), "disconnected", "Last seen: 1h0m0s ago"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, note := ConnectionStatus(tt.lastSeen, now)
+			if state != tt.wantState || note != tt.wantNote {
+				t.Errorf("ConnectionStatus = %q, %q, want %q, %q", state, note, tt.wantState, tt.wantNote)
+			}
+		})
+	}
+}
+
+func TestStateUpdateConnectionUsesClock(t *testing.T) {
+	dm, _ := newTestManager(t, []Device{{ID: "plug", Name: "Plug", Type: DeviceTypeOutlet}}, nil, nil)
+	clock := NewSimClock()
+	dm.SetClock(clock)
+
+	state := State{LastSeen: clock.Now()}
+	if got := dm.stateUpdateEvent("test", "plug", state).ConnectionState; got != "connected" {
+		t.Errorf("connection = %q, want connected", got)
+	}
+	clock.Warp(45 * time.Second)
+	if got := dm.stateUpdateEvent("test", "plug", state).ConnectionState; got != "stale" {
+		t.Errorf("connection after 45s = %q, want stale", got)
+	}
+	clock.Warp(time.Minute)
+	if got := dm.stateUpdateEvent("test", "plug", state).ConnectionState; got != "disconnected" {
+		t.Errorf("connection after 105s = %q, want disconnected", got)
+	}
+}
@@ -0,0 +1,24 @@
+package devices
+
+import "fmt"
+
+// ColorTempRange is the color temperature range of a light in mireds, as
+// zigbee2mqtt reports it in the color_temp expose, e.g. 153 to 454.
+type ColorTempRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+func validateColorTempRange(device Device) error {
+	r := device.ColorTempRange
+	if r == nil {
+		return nil
+	}
+	if device.Type != DeviceTypeLightbulb || !device.Features.ColorTemperature {
+		return fmt.Errorf("device %s: color_temp_range needs a light with color_temperature", device.ID)
+	}
+	if r.Min <= 0 || r.Min >= r.Max {
+		return fmt.Errorf("device %s: color_temp_range min (%d) must be positive and below max (%d)", device.ID, r.Min, r.Max)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package devices
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// SetCoverPosition moves a cover to position, 0 (closed) to 100 (open).
+func (dm *Manager) SetCoverPosition(ctx context.Context, deviceID string, position int) error {
+	return dm.setCover(deviceID, "position", position)
+}
+
+// SetCoverTilt tilts a cover's slats, 0 to 100.
+func (dm *Manager) SetCoverTilt(ctx context.Context, deviceID string, tilt int) error {
+	return dm.setCover(deviceID, "tilt", tilt)
+}
+
+func (dm *Manager) setCover(deviceID, property string, value int) error {
+	info, exists := dm.deviceInfos()[deviceID]
+	if !exists {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+	if info.Config.Type != DeviceTypeCover {
+		return fmt.Errorf("device %s is not a cover", deviceID)
+	}
+
+	value = ClampPercentage(value)
+	topic := fmt.Sprintf("zigbee2mqtt/%s/set", info.Config.Topic)
+	data, err := json.Marshal(map[string]interface{}{property: value})
+	if err != nil {
+		return fmt.Errorf("failed to marshal command: %w", err)
+	}
+
+	dm.logger.Info("Sending cover command",
+		"device_id", deviceID,
+		"topic", topic,
+		property, value,
+	)
+
+	if err := dm.publishCommand(deviceID, topic, data); err != nil {
+		return fmt.Errorf("failed to publish cover %s command: %w", property, err)
+	}
+
+	return nil
+}
+
+// TiltAngle converts a tilt percentage to the HomeKit tilt angle, -90° to
+// 90°.
+func TiltAngle(tilt int) int {
+	return ClampPercentage(tilt)*180/100 - 90
+}
+
+// TiltFromAngle converts a HomeKit tilt angle to a tilt percentage.
+func TiltFromAngle(angle int) int {
+	return ClampPercentage((angle + 90) * 100 / 180)
+}
@@ -0,0 +1,130 @@
+package devices
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTiltAngle(t *testing.T) {
+	tests := []struct {
+		tilt  int
+		angle int
+	}{
+		{0, -90},
+		{50, 0},
+		{100, 90},
+	}
+
+	for _, tt := range tests {
+		if got := TiltAngle(tt.tilt); got != tt.angle {
+			t.Errorf("TiltAngle(%d) = %d, want %d", tt.tilt, got, tt.angle)
+		}
+		if got := TiltFromAngle(tt.angle); got != tt.tilt {
+			t.Errorf("TiltFromAngle(%d) = %d, want %d", tt.angle, got, tt.tilt)
+		}
+	}
+
+	if got := TiltAngle(150); got != 90 {
+		t.Errorf("TiltAngle(150) = %d, want 90", got)
+	}
+}
+
+// recordingPublisher records the MQTT messages published to it.
+type recordingPublisher struct {
+	messages []string
+}
+
+func (p *recordingPublisher) Publish(topic string, payload []byte, _ bool, _ byte) error {
+	p.messages = append(p.messages, topic+" "+string(payload))
+	return nil
+}
+
+func TestCalibrateCover(t *testing.T) {
+	pub := &recordingPublisher{}
+	dm, _ := newTestManager(t, []Device{
+		{ID: "blind", Name: "Blind", Topic: "blind", Type: DeviceTypeCover},
+		{ID: "plug", Name: "Plug", Topic: "plug", Type: DeviceTypeOutlet},
+	}, nil, pub)
+	clock := NewSimClock()
+	dm.SetClock(clock)
+	ctx := context.Background()
+
+	report := func(fields []string, state State) {
+		dm.ApplyStateChange(ctx, StateChangedEvent{DeviceID: "blind", State: state, UpdatedFields: fields})
+	}
+	calibration := func() *Calibration {
+		_, state, _ := dm.Device("blind")
+		return state.Calibration
+	}
+
+	// Travel-time calibration is confirmed by the motor reporting it is
+	// calibrating, then the travel time it learned.
+	if _, err := dm.CalibrateCover(ctx, "blind", CoverCalibrationStart, "alice"); err != nil {
+		t.Fatalf("CalibrateCover start: %v", err)
+	}
+	if c := calibration(); c == nil || c.Action != CoverCalibrationStart || c.By != "alice" || c.Confirmed != nil {
+		t.Fatalf("calibration = %+v, want start by alice awaiting confirmation", c)
+	}
+	report([]string{"Calibrating"}, State{Calibrating: Ptr(true)})
+	if c := calibration(); c.Confirmed == nil {
+		t.Error("start not confirmed by the cover calibrating")
+	}
+
+	if _, err := dm.CalibrateCover(ctx, "blind", CoverCalibrationStop, "alice"); err != nil {
+		t.Fatalf("CalibrateCover stop: %v", err)
+	}
+	report([]string{"Calibrating"}, State{Calibrating: Ptr(false)})
+	if c := calibration(); c.Confirmed != nil {
+		t.Error("stop confirmed before the travel time was reported")
+	}
+	report([]string{"TravelTime"}, State{TravelTime: Ptr(23.4)})
+	_, state, _ := dm.Device("blind")
+	if state.Calibration.Confirmed == nil || state.TravelTime == nil || *state.TravelTime != 23.4 {
+		t.Errorf("after stop: calibration %+v, travel time %v; want confirmed, 23.4", state.Calibration, state.TravelTime)
+	}
+
+	// Reversing flips the reported direction; a cover that never reports
+	// it leaves the step unconfirmed.
+	if _, err := dm.CalibrateCover(ctx, "blind", CoverCalibrationReverse, "bob"); err != nil {
+		t.Fatalf("CalibrateCover reverse: %v", err)
+	}
+	clock.Warp(coverCalibrationConfirmWindow + time.Second)
+	if c := calibration(); c.Confirmed != nil || !c.Unconfirmed {
+		t.Errorf("calibration = %+v, want unconfirmed after the window", c)
+	}
+	report([]string{"MotorReversed"}, State{MotorReversed: Ptr(true)})
+	if _, err := dm.CalibrateCover(ctx, "blind", CoverCalibrationReverse, "bob"); err != nil {
+		t.Fatalf("CalibrateCover reverse: %v", err)
+	}
+	if _, err := dm.CalibrateCover(ctx, "blind", CoverCalibrationLimitOpen, "bob"); err != nil {
+		t.Fatalf("CalibrateCover limit: %v", err)
+	}
+	report([]string{"Position"}, State{Position: Ptr(100)})
+	if c := calibration(); c.Confirmed == nil {
+		t.Error("open limit not confirmed by the cover reporting open")
+	}
+
+	want := []string{
+		`zigbee2mqtt/blind/set {"calibration":"ON"}`,
+		`zigbee2mqtt/blind/set {"calibration":"OFF"}`,
+		`zigbee2mqtt/blind/set {"motor_reversal":"ON"}`,
+		`zigbee2mqtt/blind/set {"motor_reversal":"OFF"}`,
+		`zigbee2mqtt/blind/set {"border":"up"}`,
+	}
+	if len(pub.messages) != len(want) {
+		t.Fatalf("published %q, want %q", pub.messages, want)
+	}
+	for i := range want {
+		if pub.messages[i] != want[i] {
+			t.Errorf("message %d = %s, want %s", i, pub.messages[i], want[i])
+		}
+	}
+
+	if _, err := dm.CalibrateCover(ctx, "plug", CoverCalibrationStart, "bob"); err == nil {
+		t.Error("calibrated an outlet")
+	}
+	if _, err := dm.CalibrateCover(ctx, "blind", "spin", "bob"); err == nil {
+		t.Error("accepted an unknown step")
+	}
+}
@@ -0,0 +1,150 @@
+package devices
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// CoverCalibration is a calibration step of a curtain or roller motor.
+type CoverCalibration string
+
+// Cover calibration steps. Travel-time calibration starts the motor
+// learning how long it takes end to end and stops once it has run a full
+// stroke; the motor then reports the time it learned. Motors take the
+// zigbee2mqtt options they expose and ignore the rest.
+const (
+	CoverCalibrationStart      CoverCalibration = "start"       // calibration ON
+	CoverCalibrationStop       CoverCalibration = "stop"        // calibration OFF
+	CoverCalibrationLimitOpen  CoverCalibration = "limit_open"  // border up, at the open end
+	CoverCalibrationLimitClose CoverCalibration = "limit_close" // border down, at the closed end
+	CoverCalibrationReverse    CoverCalibration = "reverse"     // toggle motor_reversal
+)
+
+// CoverCalibrations lists the calibration steps in the order they are
+// usually run.
+var CoverCalibrations = []CoverCalibration{
+	CoverCalibrationReverse,
+	CoverCalibrationLimitOpen,
+	CoverCalibrationLimitClose,
+	CoverCalibrationStart,
+	CoverCalibrationStop,
+}
+
+// coverCalibrationConfirmWindow is how long a cover has to report the
+// state a calibration step asked for.
+const coverCalibrationConfirmWindow = 2 * time.Minute
+
+// Calibration is the latest calibration step sent to a cover and whether
+// the cover's reported state confirmed it.
+type Calibration struct {
+	Action    CoverCalibration `json:"action"`
+	By        string           `json:"by"`
+	Requested time.Time        `json:"requested"`
+	// Confirmed is when the cover reported the requested state, nil until
+	// then.
+	Confirmed *time.Time `json:"confirmed,omitempty"`
+	// Unconfirmed is set once the confirm window passed without the
+	// cover reporting the requested state.
+	Unconfirmed bool `json:"unconfirmed,omitempty"`
+
+	// confirms reports whether a state shows the step took effect.
+	confirms func(State) bool
+}
+
+// CalibrateCover sends a calibration step to a cover. The step is
+// confirmed once the cover reports the state it asks for: calibrating
+// while learning travel time, a travel time once stopped, fully open or
+// closed at a limit, and the flipped direction when reversed.
+func (dm *Manager) CalibrateCover(ctx context.Context, deviceID string, action CoverCalibration, by string) (Calibration, error) {
+	info, exists := dm.deviceInfos()[deviceID]
+	if !exists {
+		return Calibration{}, fmt.Errorf("device %s not found", deviceID)
+	}
+	if info.Config.Type != DeviceTypeCover {
+		return Calibration{}, fmt.Errorf("device %s is not a cover", deviceID)
+	}
+
+	dm.mu.RLock()
+	reversed := dm.states[deviceID].MotorReversed != nil && *dm.states[deviceID].MotorReversed
+	dm.mu.RUnlock()
+
+	var payload map[string]any
+	var confirms func(State) bool
+	switch action {
+	case CoverCalibrationStart:
+		payload = map[string]any{"calibration": "ON"}
+		confirms = func(s State) bool { return s.Calibrating != nil && *s.Calibrating }
+	case CoverCalibrationStop:
+		payload = map[string]any{"calibration": "OFF"}
+		confirms = func(s State) bool { return s.Calibrating != nil && !*s.Calibrating && s.TravelTime != nil }
+	case CoverCalibrationLimitOpen:
+		payload = map[string]any{"border": "up"}
+		confirms = func(s State) bool { return s.Position != nil && *s.Position == 100 }
+	case CoverCalibrationLimitClose:
+		payload = map[string]any{"border": "down"}
+		confirms = func(s State) bool { return s.Position != nil && *s.Position == 0 }
+	case CoverCalibrationReverse:
+		payload = map[string]any{"motor_reversal": BoolToZ2MState(!reversed)}
+		confirms = func(s State) bool { return s.MotorReversed != nil && *s.MotorReversed == !reversed }
+	default:
+		return Calibration{}, fmt.Errorf("unknown calibration step %q", action)
+	}
+
+	topic := fmt.Sprintf("zigbee2mqtt/%s/set", info.Config.Topic)
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Calibration{}, fmt.Errorf("failed to marshal command: %w", err)
+	}
+
+	dm.logger.Info("Sending cover calibration",
+		"device_id", deviceID,
+		"topic", topic,
+		"action", action,
+		"by", by,
+	)
+
+	if err := dm.publishCommand(deviceID, topic, data); err != nil {
+		return Calibration{}, fmt.Errorf("failed to publish cover calibration: %w", err)
+	}
+
+	calibration := &Calibration{
+		Action:    action,
+		By:        by,
+		Requested: dm.Now(),
+		confirms:  confirms,
+	}
+	dm.mu.Lock()
+	dm.calibrations[deviceID] = calibration
+	dm.mu.Unlock()
+
+	return *calibration, nil
+}
+
+// confirmCalibration marks a cover's pending calibration step confirmed
+// when state shows it took effect. Callers must hold dm.mu.
+func (dm *Manager) confirmCalibration(deviceID string, state State) {
+	calibration, ok := dm.calibrations[deviceID]
+	if !ok || calibration.Confirmed != nil || !calibration.confirms(state) {
+		return
+	}
+	now := dm.Now()
+	calibration.Confirmed = &now
+	dm.logger.Info("Cover calibration confirmed",
+		"device_id", deviceID,
+		"action", calibration.Action,
+	)
+}
+
+// coverCalibration returns the latest calibration step of a cover, if
+// any. Callers must hold dm.mu.
+func (dm *Manager) coverCalibration(deviceID string, now time.Time) *Calibration {
+	calibration, ok := dm.calibrations[deviceID]
+	if !ok {
+		return nil
+	}
+	copied := *calibration
+	copied.Unconfirmed = copied.Confirmed == nil && now.Sub(copied.Requested) > coverCalibrationConfirmWindow
+	return &copied
+}
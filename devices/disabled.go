@@ -0,0 +1,124 @@
+package devices
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrDeviceDisabled is returned for commands to a disabled device.
+var ErrDeviceDisabled = errors.New("device is disabled")
+
+// SetDisabledFile keeps the disabled devices in path, so they stay
+// disabled across restarts, and loads those disabled before. Without it
+// devices are only disabled until the bridge restarts.
+func (dm *Manager) SetDisabledFile(path string) error {
+	disabled, err := loadDisabled(path)
+	if err != nil {
+		return err
+	}
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.disabledFile = path
+	dm.disabled = disabled
+	return nil
+}
+
+// SetDeviceDisabled disables or enables a device. A disabled device is
+// kept in the config, but commands to it are refused, its reports are
+// ignored and HomeKit shows it as not responding; for a device removed
+// for a while, e.g. a plug taken on holiday.
+func (dm *Manager) SetDeviceDisabled(deviceID string, disabled bool) error {
+	if _, ok := dm.deviceInfos()[deviceID]; !ok {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+
+	dm.mu.Lock()
+	if _, was := dm.disabled[deviceID]; was == disabled {
+		dm.mu.Unlock()
+		return nil
+	}
+	next := maps.Clone(dm.disabled)
+	if next == nil {
+		next = make(map[string]time.Time)
+	}
+	if disabled {
+		next[deviceID] = dm.Now()
+	} else {
+		delete(next, deviceID)
+	}
+	if dm.disabledFile != "" {
+		if err := saveDisabled(dm.disabledFile, next); err != nil {
+			dm.mu.Unlock()
+			return err
+		}
+	}
+	dm.disabled = next
+	state := *dm.states[deviceID]
+	dm.mu.Unlock()
+
+	dm.logger.Info("Device disabled changed", "device_id", deviceID, "disabled", disabled)
+	dm.publishStateUpdate("disabled", deviceID, state)
+	return nil
+}
+
+// DeviceDisabled reports whether a device is disabled.
+func (dm *Manager) DeviceDisabled(deviceID string) bool {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	_, ok := dm.disabled[deviceID]
+	return ok
+}
+
+// disabledSince returns when a device was disabled, or nil. Callers must
+// hold dm.mu.
+func (dm *Manager) disabledSince(deviceID string) *time.Time {
+	since, ok := dm.disabled[deviceID]
+	if !ok {
+		return nil
+	}
+	return &since
+}
+
+// loadDisabled reads the disabled devices saved by saveDisabled. A missing
+// file means none are disabled.
+func loadDisabled(path string) (map[string]time.Time, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]time.Time{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read disabled devices: %w", err)
+	}
+
+	disabled := map[string]time.Time{}
+	if err := json.Unmarshal(data, &disabled); err != nil {
+		return nil, fmt.Errorf("failed to parse disabled devices: %w", err)
+	}
+	return disabled, nil
+}
+
+// saveDisabled writes the disabled devices, with when each was disabled,
+// to path atomically.
+func saveDisabled(path string, disabled map[string]time.Time) error {
+	data, err := json.MarshalIndent(disabled, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create disabled devices directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write disabled devices: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write disabled devices: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package devices
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+func TestDeviceDisabled(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	configs := []Device{{ID: "plug", Name: "Plug", Topic: "plug", Type: DeviceTypeOutlet}}
+	newManager := func() *Manager {
+		bus, err := events.New(logger)
+		if err != nil {
+			t.Fatalf("events.New: %v", err)
+		}
+		t.Cleanup(func() { _ = bus.Close() })
+		dm, err := NewManager(configs, make(chan CommandEvent, 1), bus, nil, logger)
+		if err != nil {
+			t.Fatalf("NewManager: %v", err)
+		}
+		return dm
+	}
+
+	path := filepath.Join(t.TempDir(), "disabled.json")
+	dm := newManager()
+	if err := dm.SetDisabledFile(path); err != nil {
+		t.Fatalf("SetDisabledFile: %v", err)
+	}
+	if err := dm.SetDeviceDisabled("lamp", true); err == nil {
+		t.Error("disabled an unknown device")
+	}
+	if err := dm.SetDeviceDisabled("plug", true); err != nil {
+		t.Fatalf("SetDeviceDisabled: %v", err)
+	}
+
+	if err := dm.SubmitCommand(CommandEvent{DeviceID: "plug", On: Ptr(true)}); !errors.Is(err, ErrDeviceDisabled) {
+		t.Errorf("SubmitCommand = %v, want ErrDeviceDisabled", err)
+	}
+	if err := dm.SetPower(t.Context(), "plug", true); !errors.Is(err, ErrDeviceDisabled) {
+		t.Errorf("SetPower = %v, want ErrDeviceDisabled", err)
+	}
+
+	dm.ApplyStateChange(t.Context(), StateChangedEvent{DeviceID: "plug", State: State{On: Ptr(true)}, UpdatedFields: []string{"On"}})
+	_, state, _ := dm.Device("plug")
+	if state.On != nil {
+		t.Error("a disabled device's report was applied")
+	}
+	if state.Disabled == nil {
+		t.Error("state does not show the device disabled")
+	}
+	if update, _ := dm.StateUpdate("plug"); update.ConnectionNote != "Disabled" {
+		t.Errorf("connection note = %q, want Disabled", update.ConnectionNote)
+	}
+
+	// Disabled devices stay disabled after a restart.
+	dm = newManager()
+	if err := dm.SetDisabledFile(path); err != nil {
+		t.Fatalf("SetDisabledFile: %v", err)
+	}
+	if !dm.DeviceDisabled("plug") {
+		t.Fatal("plug not disabled after a restart")
+	}
+	if err := dm.SetDeviceDisabled("plug", false); err != nil {
+		t.Fatalf("SetDeviceDisabled: %v", err)
+	}
+	if err := dm.SubmitCommand(CommandEvent{DeviceID: "plug", On: Ptr(true)}); err != nil {
+		t.Errorf("SubmitCommand after enabling = %v", err)
+	}
+}
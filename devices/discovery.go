@@ -0,0 +1,244 @@
+package devices
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Z2MDevice is an entry of the zigbee2mqtt/bridge/devices list.
+type Z2MDevice struct {
+	IEEEAddress  string         `json:"ieee_address"`
+	FriendlyName string         `json:"friendly_name"`
+	Type         string         `json:"type"` // Coordinator, Router or EndDevice
+	Supported    bool           `json:"supported"`
+	Disabled     bool           `json:"disabled"`
+	PowerSource  string         `json:"power_source"` // e.g. Battery or Mains (single phase)
+	Definition   *Z2MDefinition `json:"definition"`
+}
+
+// Z2MDefinition describes a supported device model.
+type Z2MDefinition struct {
+	Model       string      `json:"model"`
+	Vendor      string      `json:"vendor"`
+	Description string      `json:"description"`
+	Exposes     []Z2MExpose `json:"exposes"`
+}
+
+// Z2MExpose is one capability of a device. Specific types such as light,
+// switch and fan group their properties under Features.
+type Z2MExpose struct {
+	Type     string      `json:"type"`
+	Name     string      `json:"name"`
+	Property string      `json:"property"`
+	Features []Z2MExpose `json:"features"`
+	ValueMin *float64    `json:"value_min"`
+	ValueMax *float64    `json:"value_max"`
+}
+
+// ParseBridgeDevices parses a zigbee2mqtt/bridge/devices payload.
+func ParseBridgeDevices(payload []byte) ([]Z2MDevice, error) {
+	var list []Z2MDevice
+	if err := json.Unmarshal(payload, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse bridge devices: %w", err)
+	}
+	return list, nil
+}
+
+// DiscoverDevices maps the zigbee2mqtt device list to device configuration.
+// The coordinator, disabled and unsupported devices, and devices exposing
+// nothing HomeKit can show are skipped.
+func DiscoverDevices(list []Z2MDevice) []Device {
+	var discovered []Device
+	for _, z := range list {
+		if device, ok := DiscoverDevice(z); ok {
+			discovered = append(discovered, device)
+		}
+	}
+	return discovered
+}
+
+// DiscoverDevice maps a zigbee2mqtt device to a device configuration from
+// its exposes. ok is false when the device cannot be represented.
+func DiscoverDevice(z Z2MDevice) (Device, bool) {
+	if z.Type == "Coordinator" || z.Disabled || !z.Supported || z.Definition == nil || z.FriendlyName == "" {
+		return Device{}, false
+	}
+
+	exposed := make(map[string]bool)
+	kinds := make(map[string]bool)
+	var colorTemp *Z2MExpose
+	for _, e := range z.Definition.Exposes {
+		kinds[e.Type] = true
+		exposed[e.name()] = true
+		// Nested features are keyed by name: color_xy and color_hs
+		// both report the color property.
+		for _, f := range e.Features {
+			exposed[e.Type+"."+f.Name] = true
+			if e.Type == "light" && f.Name == "color_temp" && colorTemp == nil {
+				colorTemp = &f
+			}
+		}
+	}
+
+	device := Device{
+		ID:    discoveredID(z.FriendlyName),
+		Name:  z.FriendlyName,
+		Topic: z.FriendlyName,
+	}
+	f := &device.Features
+
+	remote, isRemote := RemoteForModel(z.Definition.Model)
+
+	switch {
+	case isRemote && exposed["action"]:
+		device.Type = DeviceTypeButton
+		device.Remote = remote
+	case kinds["light"]:
+		device.Type = DeviceTypeLightbulb
+		f.Brightness = exposed["light.brightness"]
+		f.ColorTemperature = exposed["light.color_temp"]
+		if colorTemp != nil && colorTemp.ValueMin != nil && colorTemp.ValueMax != nil && *colorTemp.ValueMin > 0 && *colorTemp.ValueMin < *colorTemp.ValueMax {
+			device.ColorTempRange = &ColorTempRange{Min: int(*colorTemp.ValueMin), Max: int(*colorTemp.ValueMax)}
+		}
+		f.Color = exposed["light.color_hs"] || exposed["light.color_xy"]
+	case kinds["fan"]:
+		device.Type = DeviceTypeFan
+		f.Speed = exposed["fan.fan_mode"] || exposed["fan.fan_speed"]
+	case kinds["switch"]:
+		device.Type = DeviceTypeSwitch
+		if exposed["power"] {
+			device.Type = DeviceTypeOutlet
+			f.Power = true
+		}
+	case kinds["cover"]:
+		device.Type = DeviceTypeCover
+		f.Position = exposed["cover.position"]
+		f.Tilt = exposed["cover.tilt"]
+	case exposed["warning"] || exposed["alarm"] || exposed["arm_mode"]:
+		device.Type = DeviceTypeSecuritySystem
+		f.Siren = exposed["warning"]
+		f.Alarm = exposed["alarm"]
+		f.ArmMode = exposed["arm_mode"]
+	case exposed["water_leak"]:
+		device.Type = DeviceTypeLeakSensor
+	case exposed["smoke"]:
+		device.Type = DeviceTypeSmokeSensor
+	case exposed["contact"]:
+		device.Type = DeviceTypeContactSensor
+	case exposed["occupancy"]:
+		device.Type = DeviceTypeOccupancySensor
+	case exposed["temperature"] || exposed["humidity"] || exposed["pressure"]:
+		device.Type = DeviceTypeClimateSensor
+	default:
+		return Device{}, false
+	}
+
+	if device.Type != DeviceTypeLightbulb && device.Type != DeviceTypeFan && device.Type != DeviceTypeSwitch && device.Type != DeviceTypeOutlet && device.Type != DeviceTypeSecuritySystem {
+		f.Temperature = exposed["temperature"]
+		f.Humidity = exposed["humidity"]
+		f.Pressure = exposed["pressure"]
+		f.Occupancy = exposed["occupancy"]
+		f.Illuminance = exposed["illuminance"] || exposed["illuminance_lux"]
+		f.Contact = exposed["contact"]
+		f.WaterLeak = exposed["water_leak"]
+		f.Smoke = exposed["smoke"]
+		f.Tamper = exposed["tamper"]
+	}
+	f.Battery = exposed["battery"] || device.Remote != ""
+
+	return device, true
+}
+
+// name returns the property an expose reports, which is what state
+// messages are keyed by.
+func (e Z2MExpose) name() string {
+	if e.Property != "" {
+		return e.Property
+	}
+	return e.Name
+}
+
+// discoveredID derives a device ID from a friendly name, e.g.
+// "Living room/Lamp" becomes "living-room-lamp".
+func discoveredID(friendlyName string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(friendlyName) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
+
+// MergeDiscovered returns configured followed by the discovered devices
+// that are not already configured. A device configured by hand for the
+// same topic or ID takes precedence.
+func MergeDiscovered(configured, discovered []Device) []Device {
+	topics := make(map[string]bool, len(configured))
+	ids := make(map[string]bool, len(configured))
+	for _, d := range configured {
+		topics[d.Topic] = true
+		ids[d.ID] = true
+	}
+
+	merged := slices.Clone(configured)
+	for _, d := range discovered {
+		if topics[d.Topic] || ids[d.ID] {
+			continue
+		}
+		topics[d.Topic] = true
+		ids[d.ID] = true
+		merged = append(merged, d)
+	}
+	return merged
+}
+
+// LoadDiscovered reads devices saved by SaveDiscovered. A missing file
+// means nothing has been discovered yet.
+func LoadDiscovered(path string) ([]Device, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read discovered devices: %w", err)
+	}
+
+	var discovered []Device
+	if err := json.Unmarshal(data, &discovered); err != nil {
+		return nil, fmt.Errorf("failed to parse discovered devices: %w", err)
+	}
+	return discovered, nil
+}
+
+// SaveDiscovered writes the discovered devices to path atomically.
+func SaveDiscovered(path string, discovered []Device) error {
+	data, err := json.MarshalIndent(discovered, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create discovered devices directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write discovered devices: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write discovered devices: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package devices
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const bridgeDevicesPayload = `[
+  {"ieee_address": "0x00124b0001", "friendly_name": "Coordinator", "type": "Coordinator", "supported": false, "disabled": false, "definition": null},
+  {"ieee_address": "0x00158d0001", "friendly_name": "Kitchen Aqara", "type": "EndDevice", "supported": true, "disabled": false,
+   "definition": {"model": "WSDCGQ11LM", "vendor": "Aqara", "description": "Temperature, humidity and pressure sensor", "exposes": [
+     {"type": "numeric", "name": "temperature", "property": "temperature"},
+     {"type": "numeric", "name": "humidity", "property": "humidity"},
+     {"type": "numeric", "name": "pressure", "property": "pressure"},
+     {"type": "numeric", "name": "battery", "property": "battery"},
+     {"type": "numeric", "name": "linkquality", "property": "linkquality"}
+   ]}},
+  {"ieee_address": "0x00158d0002", "friendly_name": "Living room/Lamp", "type": "Router", "supported": true, "disabled": false,
+   "definition": {"model": "LED1836G9", "vendor": "IKEA", "description": "TRADFRI bulb", "exposes": [
+     {"type": "light", "features": [
+       {"type": "binary", "name": "state", "property": "state"},
+       {"type": "numeric", "name": "brightness", "property": "brightness"},
+       {"type": "numeric", "name": "color_temp", "property": "color_temp", "value_min": 250, "value_max": 454},
+       {"type": "composite", "name": "color_xy", "property": "color"}
+     ]}
+   ]}},
+  {"ieee_address": "0x00158d0003", "friendly_name": "desk-plug", "type": "Router", "supported": true, "disabled": false,
+   "definition": {"model": "ZNCZ04LM", "vendor": "Aqara", "description": "Smart plug", "exposes": [
+     {"type": "switch", "features": [{"type": "binary", "name": "state", "property": "state"}]},
+     {"type": "numeric", "name": "power", "property": "power"}
+   ]}},
+  {"ieee_address": "0x00158d0004", "friendly_name": "hall-motion", "type": "EndDevice", "supported": true, "disabled": false,
+   "definition": {"model": "RTCGQ11LM", "vendor": "Aqara", "description": "Motion sensor", "exposes": [
+     {"type": "binary", "name": "occupancy", "property": "occupancy"},
+     {"type": "numeric", "name": "illuminance_lux", "property": "illuminance_lux"},
+     {"type": "numeric", "name": "battery", "property": "battery"}
+   ]}},
+  {"ieee_address": "0x00158d0005", "friendly_name": "old-remote", "type": "EndDevice", "supported": true, "disabled": true,
+   "definition": {"model": "E1524", "vendor": "IKEA", "description": "Remote", "exposes": [
+     {"type": "enum", "name": "action", "property": "action"}
+   ]}},
+  {"ieee_address": "0x00158d0006", "friendly_name": "new-remote", "type": "EndDevice", "supported": true, "disabled": false,
+   "definition": {"model": "E1524", "vendor": "IKEA", "description": "Remote", "exposes": [
+     {"type": "enum", "name": "action", "property": "action"}
+   ]}}
+]`
+
+func TestDiscoverDevices(t *testing.T) {
+	list, err := ParseBridgeDevices([]byte(bridgeDevicesPayload))
+	if err != nil {
+		t.Fatalf("ParseBridgeDevices() error = %v", err)
+	}
+
+	want := []Device{
+		{
+			ID: "kitchen-aqara", Name: "Kitchen Aqara", Topic: "Kitchen Aqara", Type: DeviceTypeClimateSensor,
+			Features: DeviceFeatures{Temperature: true, Humidity: true, Pressure: true, Battery: true},
+		},
+		{
+			ID: "living-room-lamp", Name: "Living room/Lamp", Topic: "Living room/Lamp", Type: DeviceTypeLightbulb,
+			Features:       DeviceFeatures{Brightness: true, ColorTemperature: true, Color: true},
+			ColorTempRange: &ColorTempRange{Min: 250, Max: 454},
+		},
+		{
+			ID: "desk-plug", Name: "desk-plug", Topic: "desk-plug", Type: DeviceTypeOutlet,
+			Features: DeviceFeatures{Power: true},
+		},
+		{
+			ID: "hall-motion", Name: "hall-motion", Topic: "hall-motion", Type: DeviceTypeOccupancySensor,
+			Features: DeviceFeatures{Occupancy: true, Illuminance: true, Battery: true},
+		},
+		{
+			ID: "new-remote", Name: "new-remote", Topic: "new-remote", Type: DeviceTypeButton,
+			Remote: RemoteTradfri, Features: DeviceFeatures{Battery: true},
+		},
+	}
+	if got := DiscoverDevices(list); !reflect.DeepEqual(got, want) {
+		t.Errorf("DiscoverDevices() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestDiscoverCover(t *testing.T) {
+	blind := Z2MDevice{
+		IEEEAddress: "0x00158d0007", FriendlyName: "bedroom-blind", Type: "EndDevice", Supported: true,
+		Definition: &Z2MDefinition{Model: "E1757", Vendor: "IKEA", Exposes: []Z2MExpose{
+			{Type: "cover", Features: []Z2MExpose{
+				{Type: "enum", Name: "state", Property: "state"},
+				{Type: "numeric", Name: "position", Property: "position"},
+			}},
+			{Type: "numeric", Name: "battery", Property: "battery"},
+		}},
+	}
+
+	want := Device{
+		ID: "bedroom-blind", Name: "bedroom-blind", Topic: "bedroom-blind", Type: DeviceTypeCover,
+		Features: DeviceFeatures{Position: true, Battery: true},
+	}
+	got, ok := DiscoverDevice(blind)
+	if !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("DiscoverDevice() = %+v, %v, want %+v", got, ok, want)
+	}
+}
+
+func TestDiscoverSecuritySystem(t *testing.T) {
+	siren := Z2MDevice{
+		IEEEAddress: "0x00158d0008", FriendlyName: "hall-siren", Type: "Router", Supported: true,
+		Definition: &Z2MDefinition{Model: "HS2WD-E", Vendor: "Heiman", Exposes: []Z2MExpose{
+			{Type: "composite", Name: "warning", Property: "warning"},
+			{Type: "numeric", Name: "temperature", Property: "temperature"},
+			{Type: "numeric", Name: "battery", Property: "battery"},
+		}},
+	}
+
+	want := Device{
+		ID: "hall-siren", Name: "hall-siren", Topic: "hall-siren", Type: DeviceTypeSecuritySystem,
+		Features: DeviceFeatures{Siren: true, Battery: true},
+	}
+	got, ok := DiscoverDevice(siren)
+	if !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("DiscoverDevice() = %+v, %v, want %+v", got, ok, want)
+	}
+}
+
+func TestMergeDiscovered(t *testing.T) {
+	configured := []Device{
+		{ID: "kitchen", Name: "Kitchen", Topic: "Kitchen Aqara", Type: DeviceTypeClimateSensor},
+		{ID: "desk-plug", Name: "Desk", Topic: "office/plug", Type: DeviceTypeSwitch},
+	}
+	discovered := []Device{
+		{ID: "kitchen-aqara", Topic: "Kitchen Aqara", Type: DeviceTypeClimateSensor},
+		{ID: "desk-plug", Topic: "desk-plug", Type: DeviceTypeOutlet},
+		{ID: "hall-motion", Topic: "hall-motion", Type: DeviceTypeOccupancySensor},
+	}
+
+	merged := MergeDiscovered(configured, discovered)
+	var ids []string
+	for _, d := range merged {
+		ids = append(ids, d.ID)
+	}
+	if want := []string{"kitchen", "desk-plug", "hall-motion"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("merged IDs = %v, want %v", ids, want)
+	}
+	if merged[1].Type != DeviceTypeSwitch {
+		t.Errorf("configured device replaced by discovered one: %+v", merged[1])
+	}
+}
+
+func TestLoadConfigWithDiscovered(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "devices.hujson")
+	if err := os.WriteFile(configPath, []byte(`{"devices": []}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadConfig(configPath); err == nil {
+		t.Error("LoadConfig() with no devices succeeded, want error")
+	}
+
+	discoveredPath := filepath.Join(dir, "data", "discovered.json")
+	discovered, err := LoadDiscovered(discoveredPath)
+	if err != nil || discovered != nil {
+		t.Fatalf("LoadDiscovered() before discovery = %v, %v, want nothing", discovered, err)
+	}
+
+	cfg, err := LoadConfigWithDiscovered(configPath, nil)
+	if err != nil {
+		t.Fatalf("LoadConfigWithDiscovered() with nothing discovered error = %v", err)
+	}
+	if len(cfg.Devices) != 0 {
+		t.Errorf("devices = %+v, want none", cfg.Devices)
+	}
+
+	list, err := ParseBridgeDevices([]byte(bridgeDevicesPayload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveDiscovered(discoveredPath, DiscoverDevices(list)); err != nil {
+		t.Fatalf("SaveDiscovered() error = %v", err)
+	}
+	discovered, err = LoadDiscovered(discoveredPath)
+	if err != nil {
+		t.Fatalf("LoadDiscovered() error = %v", err)
+	}
+	if !reflect.DeepEqual(discovered, DiscoverDevices(list)) {
+		t.Errorf("LoadDiscovered() = %+v, want the saved devices", discovered)
+	}
+
+	cfg, err = LoadConfigWithDiscovered(configPath, discovered)
+	if err != nil {
+		t.Fatalf("LoadConfigWithDiscovered() error = %v", err)
+	}
+	if len(cfg.Devices) != 5 {
+		t.Fatalf("devices = %d, want 5", len(cfg.Devices))
+	}
+	for _, d := range cfg.Devices {
+		if d.HomeKit == nil || !*d.HomeKit || d.Web == nil || !*d.Web {
+			t.Errorf("device %s: HomeKit and Web defaults not applied", d.ID)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package devices
+
+import (
+	"fmt"
+	"sort"
+)
+
+// FanMode maps a Z2M fan_mode preset to a HAP rotation speed percentage.
+// A negative speed marks a mode that is not a fixed speed (e.g. "auto").
+type FanMode struct {
+	Mode  string
+	Speed int // 0-100 (percentage), or -1 for non-speed modes
+}
+
+// DefaultFanModes is the preset table used when a device does not
+// configure its own.
+var DefaultFanModes = []FanMode{
+	{Mode: "off", Speed: 0},
+	{Mode: "low", Speed: 33},
+	{Mode: "medium", Speed: 66},
+	{Mode: "high", Speed: 100},
+	{Mode: "auto", Speed: -1},
+}
+
+// defaultFanModeSpeed is reported for modes without a fixed speed.
+const defaultFanModeSpeed = 50
+
+// fanModeTable returns the device's mode table: fan_mode_map when
+// configured, DefaultFanModes otherwise.
+func (d Device) fanModeTable() []FanMode {
+	if len(d.FanModeMap) == 0 {
+		return DefaultFanModes
+	}
+
+	table := make([]FanMode, 0, len(d.FanModeMap))
+	for mode, speed := range d.FanModeMap {
+		table = append(table, FanMode{Mode: mode, Speed: speed})
+	}
+	sort.Slice(table, func(i, j int) bool {
+		if table[i].Speed != table[j].Speed {
+			return table[i].Speed < table[j].Speed
+		}
+		return table[i].Mode < table[j].Mode
+	})
+	return table
+}
+
+// FanModes returns the presets supported by the device. fan_modes selects a
+// subset of the device's mode table; without it the whole table is used.
+func (d Device) FanModes() []FanMode {
+	table := d.fanModeTable()
+	if len(d.FanModeNames) == 0 {
+		return table
+	}
+
+	modes := make([]FanMode, 0, len(d.FanModeNames))
+	for _, name := range d.FanModeNames {
+		if m, ok := lookupFanMode(table, name); ok {
+			modes = append(modes, m)
+		}
+	}
+	return modes
+}
+
+// UsesFanModes reports whether speed commands should be sent as fan_mode
+// presets rather than a numeric fan_speed.
+func (d Device) UsesFanModes() bool {
+	return len(d.FanModeNames) > 0 || len(d.FanModeMap) > 0
+}
+
+// validateFanModes checks fan_modes and fan_mode_map for consistency.
+func (d Device) validateFanModes() error {
+	for mode, speed := range d.FanModeMap {
+		if speed > 100 {
+			return fmt.Errorf("device %s fan mode %q speed %d exceeds 100", d.ID, mode, speed)
+		}
+	}
+
+	table := d.fanModeTable()
+	for _, mode := range d.FanModeNames {
+		if _, ok := lookupFanMode(table, mode); !ok {
+			return fmt.Errorf("device %s has unknown fan mode %q", d.ID, mode)
+		}
+	}
+
+	return nil
+}
+
+// FanModeToSpeed converts a Z2M fan_mode string to a percentage. Only the
+// device's modes are looked up, so a partial fan_mode_map round-trips with
+// NearestFanMode; other modes count as without a fixed speed.
+func FanModeToSpeed(modes []FanMode, mode string) int {
+	m, ok := lookupFanMode(modes, mode)
+	if !ok || m.Speed < 0 {
+		return defaultFanModeSpeed
+	}
+	return m.Speed
+}
+
+// NearestFanMode returns the preset closest to the requested percentage.
+// Modes without a fixed speed are never selected.
+func NearestFanMode(modes []FanMode, speed int) string {
+	best := ""
+	bestDiff := -1
+	for _, m := range modes {
+		if m.Speed < 0 {
+			continue
+		}
+		diff := absInt(m.Speed - speed)
+		if bestDiff < 0 || diff < bestDiff {
+			best = m.Mode
+			bestDiff = diff
+		}
+	}
+	return best
+}
+
+// ClampPercentage clamps a value to the 0-100 range.
+func ClampPercentage(v int) int {
+	if v < 0 {
+		return 0
+	}
+	if v > 100 {
+		return 100
+	}
+	return v
+}
+
+func lookupFanMode(modes []FanMode, mode string) (FanMode, bool) {
+	for _, m := range modes {
+		if m.Mode == mode {
+			return m, true
+		}
+	}
+	return FanMode{}, false
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
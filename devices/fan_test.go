@@ -0,0 +1,159 @@
+package devices
+
+import "testing"
+
+func TestNearestFanMode(t *testing.T) {
+	device := Device{FanModeNames: []string{"off", "low", "medium", "high"}}
+	modes := device.FanModes()
+
+	tests := []struct {
+		name  string
+		speed int
+		want  string
+	}{
+		{"zero", 0, "off"},
+		{"exact low", 33, "low"},
+		{"rounds down to low", 45, "low"},
+		{"rounds up to medium", 55, "medium"},
+		{"exact high", 100, "high"},
+		{"near off", 10, "off"},
+		{"above max", 150, "high"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NearestFanMode(modes, tt.speed)
+			if got != tt.want {
+				t.Errorf("NearestFanMode(%d) = %q, want %q", tt.speed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNearestFanModeSubset(t *testing.T) {
+	device := Device{FanModeNames: []string{"off", "low", "high"}}
+
+	if got := NearestFanMode(device.FanModes(), 70); got != "high" {
+		t.Errorf("NearestFanMode(70) = %q, want %q", got, "high")
+	}
+}
+
+func TestNearestFanModeSkipsAuto(t *testing.T) {
+	device := Device{FanModeNames: []string{"auto", "low", "high"}}
+
+	if got := NearestFanMode(device.FanModes(), 50); got != "low" {
+		t.Errorf("NearestFanMode(50) = %q, want %q", got, "low")
+	}
+}
+
+func TestFanModeToSpeed(t *testing.T) {
+	tests := []struct {
+		mode string
+		want int
+	}{
+		{"off", 0},
+		{"low", 33},
+		{"medium", 66},
+		{"high", 100},
+		{"auto", 50},
+		{"unknown", 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			got := FanModeToSpeed(DefaultFanModes, tt.mode)
+			if got != tt.want {
+				t.Errorf("FanModeToSpeed(%q) = %d, want %d", tt.mode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUsesFanModes(t *testing.T) {
+	if (Device{}).UsesFanModes() {
+		t.Error("device without fan_modes should use numeric fan_speed")
+	}
+	if !(Device{FanModeNames: []string{"low"}}).UsesFanModes() {
+		t.Error("device with fan_modes should use presets")
+	}
+}
+
+func TestFanModeMap(t *testing.T) {
+	device := Device{
+		ID: "fan",
+		FanModeMap: map[string]int{
+			"off":   0,
+			"1":     25,
+			"2":     50,
+			"3":     75,
+			"4":     100,
+			"smart": -1,
+		},
+	}
+
+	if !device.UsesFanModes() {
+		t.Fatal("device with fan_mode_map should use presets")
+	}
+
+	modes := device.FanModes()
+	if got := NearestFanMode(modes, 60); got != "2" {
+		t.Errorf("NearestFanMode(60) = %q, want %q", got, "2")
+	}
+	if got := NearestFanMode(modes, 90); got != "4" {
+		t.Errorf("NearestFanMode(90) = %q, want %q", got, "4")
+	}
+	if got := FanModeToSpeed(modes, "3"); got != 75 {
+		t.Errorf("FanModeToSpeed(3) = %d, want 75", got)
+	}
+	if got := FanModeToSpeed(modes, "smart"); got != defaultFanModeSpeed {
+		t.Errorf("FanModeToSpeed(smart) = %d, want %d", got, defaultFanModeSpeed)
+	}
+
+	// Round trip: every fixed-speed mode maps back to itself.
+	for _, m := range modes {
+		if m.Speed < 0 {
+			continue
+		}
+		if got := NearestFanMode(modes, FanModeToSpeed(modes, m.Mode)); got != m.Mode {
+			t.Errorf("round trip of %q = %q", m.Mode, got)
+		}
+	}
+}
+
+func TestPartialFanModeMap(t *testing.T) {
+	device := Device{ID: "fan", FanModeMap: map[string]int{"low": 20, "high": 80}}
+	modes := device.FanModes()
+
+	// Modes missing from the map do not fall back to the defaults.
+	if got := FanModeToSpeed(modes, "medium"); got != defaultFanModeSpeed {
+		t.Errorf("FanModeToSpeed(medium) = %d, want %d", got, defaultFanModeSpeed)
+	}
+	for _, mode := range []string{"low", "high"} {
+		if got := NearestFanMode(modes, FanModeToSpeed(modes, mode)); got != mode {
+			t.Errorf("round trip of %q = %q", mode, got)
+		}
+	}
+}
+
+func TestValidateFanModes(t *testing.T) {
+	tests := []struct {
+		name    string
+		device  Device
+		wantErr bool
+	}{
+		{"defaults", Device{ID: "a", FanModeNames: []string{"low", "high"}}, false},
+		{"unknown default mode", Device{ID: "a", FanModeNames: []string{"turbo"}}, true},
+		{"subset of map", Device{ID: "a", FanModeMap: map[string]int{"1": 50, "2": 100}, FanModeNames: []string{"2"}}, false},
+		{"name not in map", Device{ID: "a", FanModeMap: map[string]int{"1": 50}, FanModeNames: []string{"low"}}, true},
+		{"speed above 100", Device{ID: "a", FanModeMap: map[string]int{"1": 150}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.device.validateFanModes()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateFanModes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Group is a set of devices the web UI shows as one card with a master
+// toggle, e.g. "Living room lights". It is independent of zigbee2mqtt
+// groups: commands fan out to each member.
+type Group struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Devices []string `json:"devices"`
+}
+
+func validateGroups(cfg *Config) error {
+	byID := make(map[string]Device, len(cfg.Devices))
+	for _, d := range cfg.Devices {
+		byID[d.ID] = d
+	}
+
+	seen := make(map[string]bool, len(cfg.Groups))
+	for _, g := range cfg.Groups {
+		if g.ID == "" || g.Name == "" {
+			return fmt.Errorf("groups: id and name are required")
+		}
+		if seen[g.ID] {
+			return fmt.Errorf("groups: duplicate group id %q", g.ID)
+		}
+		seen[g.ID] = true
+
+		if len(g.Devices) == 0 {
+			return fmt.Errorf("group %s: devices is empty", g.ID)
+		}
+		for _, id := range g.Devices {
+			d, ok := byID[id]
+			if !ok {
+				return fmt.Errorf("group %s: unknown device %q", g.ID, id)
+			}
+			if !isPowerTarget(d.Type) {
+				return fmt.Errorf("group %s: %s cannot be switched on or off", g.ID, id)
+			}
+		}
+	}
+
+	return nil
+}
+
+// SetGroups sets the UI groups.
+func (dm *Manager) SetGroups(groups []Group) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.groups = slices.Clone(groups)
+}
+
+// Groups returns the UI groups in configuration order.
+func (dm *Manager) Groups() []Group {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	return slices.Clone(dm.groups)
+}
+
+// SetGroupPower switches every member of a group on or off. It carries on
+// past failing members and reports all failures.
+func (dm *Manager) SetGroupPower(ctx context.Context, groupID string, on bool) error {
+	dm.mu.RLock()
+	idx := slices.IndexFunc(dm.groups, func(g Group) bool { return g.ID == groupID })
+	var members []string
+	if idx >= 0 {
+		members = dm.groups[idx].Devices
+	}
+	dm.mu.RUnlock()
+
+	if idx < 0 {
+		return fmt.Errorf("group %s not found", groupID)
+	}
+
+	dm.logger.Info("Sending group power command", "group_id", groupID, "on", on, "members", len(members))
+
+	var errs []error
+	for _, id := range members {
+		if err := dm.SetPower(ctx, id, on); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
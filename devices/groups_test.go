@@ -0,0 +1,59 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestValidateGroups(t *testing.T) {
+	devices := []Device{
+		{ID: "lamp", Type: DeviceTypeLightbulb},
+		{ID: "plug", Type: DeviceTypeOutlet},
+		{ID: "temp", Type: DeviceTypeClimateSensor},
+	}
+
+	tests := []struct {
+		name    string
+		groups  []Group
+		wantErr bool
+	}{
+		{"valid", []Group{{ID: "lounge", Name: "Lounge", Devices: []string{"lamp", "plug"}}}, false},
+		{"missing name", []Group{{ID: "lounge", Devices: []string{"lamp"}}}, true},
+		{"duplicate", []Group{{ID: "a", Name: "A", Devices: []string{"lamp"}}, {ID: "a", Name: "B", Devices: []string{"plug"}}}, true},
+		{"empty", []Group{{ID: "a", Name: "A"}}, true},
+		{"unknown member", []Group{{ID: "a", Name: "A", Devices: []string{"nope"}}}, true},
+		{"sensor member", []Group{{ID: "a", Name: "A", Devices: []string{"temp"}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateGroups(&Config{Devices: devices, Groups: tt.groups})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateGroups() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetGroupPower(t *testing.T) {
+	dm, _ := newTestManager(t, []Device{
+		{ID: "lamp", Name: "Lamp", Type: DeviceTypeLightbulb},
+		{ID: "valve", Name: "Valve", Type: DeviceTypeSwitch},
+	}, nil, nil)
+	dm.SetGroups([]Group{{ID: "all", Name: "All", Devices: []string{"valve", "lamp"}}})
+
+	ctx := context.Background()
+	if err := dm.SetGroupPower(ctx, "all", true); err != nil {
+		t.Fatalf("SetGroupPower: %v", err)
+	}
+	if err := dm.SetGroupPower(ctx, "missing", true); err == nil {
+		t.Error("unknown group accepted")
+	}
+
+	// A failing member is reported without stopping the others.
+	dm.lockouts["valve"] = Lockout{Sensor: "leak"}
+	if err := dm.SetGroupPower(ctx, "all", true); !errors.Is(err, ErrValveLocked) {
+		t.Errorf("SetGroupPower with locked member: err = %v, want ErrValveLocked", err)
+	}
+}
@@ -0,0 +1,179 @@
+package devices
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// commandConfirmTimeout is how long a device has to report after a
+	// command before the command counts as failed.
+	commandConfirmTimeout = 10 * time.Second
+	// minReportInterval is the floor for a device's expected report
+	// interval, so devices that only report on change are not penalised.
+	minReportInterval = time.Hour
+	// failureWeight is how quickly the command failure rate follows new
+	// outcomes (EWMA weight of the latest command).
+	failureWeight = 0.2
+	// intervalWeight is the EWMA weight of the latest report interval.
+	intervalWeight = 0.2
+)
+
+// Health is a 0-100 score summarising how well a device is doing, with the
+// issues that lowered it.
+type Health struct {
+	Score  int
+	Issues []string
+}
+
+// Level buckets the score for display: good, fair or poor.
+func (h Health) Level() string {
+	switch {
+	case h.Score >= 80:
+		return "good"
+	case h.Score >= 50:
+		return "fair"
+	default:
+		return "poor"
+	}
+}
+
+type deviceHealth struct {
+	lastReport   time.Time
+	interval     time.Duration // EWMA of the time between reports
+	failureRate  float64       // EWMA of failed commands, 0-1
+	pendingSince time.Time     // first unconfirmed command
+}
+
+// HealthTracker records report timing and command outcomes per device for
+// the health score.
+type HealthTracker struct {
+	mu      sync.Mutex
+	devices map[string]*deviceHealth
+}
+
+// NewHealthTracker creates an empty tracker.
+func NewHealthTracker() *HealthTracker {
+	return &HealthTracker{devices: make(map[string]*deviceHealth)}
+}
+
+func (t *HealthTracker) device(deviceID string) *deviceHealth {
+	d, ok := t.devices[deviceID]
+	if !ok {
+		d = &deviceHealth{}
+		t.devices[deviceID] = d
+	}
+	return d
+}
+
+// settle counts an unconfirmed command as failed once its timeout passes.
+func (d *deviceHealth) settle(now time.Time) {
+	if !d.pendingSince.IsZero() && now.Sub(d.pendingSince) >= commandConfirmTimeout {
+		d.recordCommand(false)
+		d.pendingSince = time.Time{}
+	}
+}
+
+func (d *deviceHealth) recordCommand(ok bool) {
+	outcome := 0.0
+	if !ok {
+		outcome = 1
+	}
+	d.failureRate = (1-failureWeight)*d.failureRate + failureWeight*outcome
+}
+
+// ObserveReport records that the device reported at the given time. A
+// report confirms any pending command.
+func (t *HealthTracker) ObserveReport(deviceID string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	d := t.device(deviceID)
+	d.settle(at)
+	if !d.pendingSince.IsZero() {
+		d.recordCommand(true)
+		d.pendingSince = time.Time{}
+	}
+
+	if !d.lastReport.IsZero() && at.After(d.lastReport) {
+		gap := at.Sub(d.lastReport)
+		if d.interval == 0 {
+			d.interval = gap
+		} else {
+			d.interval = time.Duration((1-intervalWeight)*float64(d.interval) + intervalWeight*float64(gap))
+		}
+	}
+	d.lastReport = at
+}
+
+// ObserveCommand records a command sent to the device. Commands that could
+// not be sent fail immediately; sent commands succeed once the device
+// reports within commandConfirmTimeout.
+func (t *HealthTracker) ObserveCommand(deviceID string, sent bool, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	d := t.device(deviceID)
+	d.settle(now)
+	if !sent {
+		d.recordCommand(false)
+		return
+	}
+	if d.pendingSince.IsZero() {
+		d.pendingSince = now
+	}
+}
+
+// Score computes the health of a device from its state and history.
+func (t *HealthTracker) Score(deviceID string, state State, now time.Time) Health {
+	t.mu.Lock()
+	d := t.device(deviceID)
+	d.settle(now)
+	interval, failureRate := d.interval, d.failureRate
+	t.mu.Unlock()
+
+	h := Health{Score: 100}
+	penalise := func(points int, issue string) {
+		h.Score -= points
+		h.Issues = append(h.Issues, issue)
+	}
+
+	switch LinkQualityLevel(state.LinkQuality) {
+	case "weak":
+		penalise(25, "weak link")
+	case "fair":
+		penalise(10, "fair link")
+	}
+
+	if state.LastSeen.IsZero() {
+		penalise(50, "never seen")
+	} else {
+		expected := max(3*interval, minReportInterval)
+		switch age := now.Sub(state.LastSeen); {
+		case age > 24*time.Hour:
+			penalise(40, "not seen for a day")
+		case age > expected:
+			penalise(20, "reports overdue")
+		}
+	}
+
+	if state.Battery != nil {
+		switch {
+		case *state.Battery < 10:
+			penalise(30, "battery critical")
+		case *state.Battery < LowBatteryLevel:
+			penalise(15, "battery low")
+		}
+	}
+
+	if len(state.Anomalies) > 0 {
+		penalise(20, "anomalous readings")
+	}
+
+	if failureRate >= 0.05 {
+		penalise(int(failureRate*40+0.5), "commands failing")
+	}
+
+	h.Score = max(h.Score, 0)
+	return h
+}
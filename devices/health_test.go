@@ -0,0 +1,72 @@
+package devices
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHealthScore(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	low := 8
+
+	tests := []struct {
+		name      string
+		state     State
+		wantScore int
+		wantIssue string
+	}{
+		{"healthy", State{LinkQuality: 150, LastSeen: now.Add(-time.Minute)}, 100, ""},
+		{"never seen", State{}, 50, "never seen"},
+		{"weak link", State{LinkQuality: 20, LastSeen: now}, 75, "weak link"},
+		{"overdue", State{LinkQuality: 150, LastSeen: now.Add(-2 * time.Hour)}, 80, "reports overdue"},
+		{"gone", State{LinkQuality: 150, LastSeen: now.Add(-48 * time.Hour)}, 60, "not seen for a day"},
+		{"battery", State{LinkQuality: 150, LastSeen: now, Battery: &low}, 70, "battery critical"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHealthTracker().Score("dev", tt.state, now)
+			if h.Score != tt.wantScore {
+				t.Errorf("Score = %d, want %d (issues %v)", h.Score, tt.wantScore, h.Issues)
+			}
+			if tt.wantIssue != "" && !slices.Contains(h.Issues, tt.wantIssue) {
+				t.Errorf("Issues = %v, want %q", h.Issues, tt.wantIssue)
+			}
+		})
+	}
+}
+
+func TestHealthCommandFailures(t *testing.T) {
+	tracker := NewHealthTracker()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	state := State{LinkQuality: 150, LastSeen: now}
+
+	// Confirmed commands do not lower the score.
+	tracker.ObserveCommand("dev", true, now)
+	tracker.ObserveReport("dev", now.Add(time.Second))
+	if h := tracker.Score("dev", state, now.Add(time.Minute)); h.Score != 100 {
+		t.Fatalf("Score after confirmed command = %d, want 100", h.Score)
+	}
+
+	// Commands the device never answers count as failures once the
+	// confirmation timeout passes.
+	for i := range 5 {
+		at := now.Add(time.Duration(i) * time.Minute)
+		tracker.ObserveCommand("dev", true, at)
+		tracker.Score("dev", state, at.Add(commandConfirmTimeout))
+	}
+
+	h := tracker.Score("dev", state, now.Add(time.Hour))
+	if h.Score >= 100 || !slices.Contains(h.Issues, "commands failing") {
+		t.Errorf("Score after unanswered commands = %d %v, want commands failing", h.Score, h.Issues)
+	}
+}
+
+func TestHealthLevel(t *testing.T) {
+	for score, want := range map[int]string{100: "good", 80: "good", 79: "fair", 50: "fair", 49: "poor"} {
+		if got := (Health{Score: score}).Level(); got != want {
+			t.Errorf("Level(%d) = %q, want %q", score, got, want)
+		}
+	}
+}
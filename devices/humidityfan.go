@@ -0,0 +1,218 @@
+package devices
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Defaults of a humidity fan rule.
+const (
+	DefaultHumidityRise        = 10.0
+	DefaultHumidityBaseline    = 60 // minutes
+	DefaultHumidityFanRuntime  = 60 // minutes
+	humidityFanMinBaselineSize = 2  // readings before the baseline is trusted
+)
+
+// HumidityFan is the built-in bathroom fan rule: the fan is switched on
+// when humidity rises a set amount above its recent baseline, as after a
+// shower, and off when it falls back. The baseline is the lowest reading
+// over the baseline window and is held while the fan runs.
+type HumidityFan struct {
+	// Sensor is a device reporting humidity.
+	Sensor string `json:"sensor"`
+	// Fan is a fan, switch or outlet device.
+	Fan string `json:"fan"`
+
+	// Rise is the percentage points above the baseline that start the fan.
+	// The fan stops when humidity is back within half of it. Defaults to
+	// DefaultHumidityRise.
+	Rise float64 `json:"rise,omitempty"`
+	// BaselineMinutes is the window the baseline is taken over. Defaults
+	// to DefaultHumidityBaseline.
+	BaselineMinutes int `json:"baseline_minutes,omitempty"`
+	// MaxRuntimeMinutes stops the fan after running this long, even if
+	// humidity has not fallen; it does not start again until it has.
+	// Defaults to DefaultHumidityFanRuntime.
+	MaxRuntimeMinutes int `json:"max_runtime_minutes,omitempty"`
+}
+
+func (h HumidityFan) rise() float64 {
+	if h.Rise == 0 {
+		return DefaultHumidityRise
+	}
+	return h.Rise
+}
+
+func (h HumidityFan) baselineWindow() time.Duration {
+	if h.BaselineMinutes == 0 {
+		return DefaultHumidityBaseline * time.Minute
+	}
+	return time.Duration(h.BaselineMinutes) * time.Minute
+}
+
+func (h HumidityFan) maxRuntime() time.Duration {
+	if h.MaxRuntimeMinutes == 0 {
+		return DefaultHumidityFanRuntime * time.Minute
+	}
+	return time.Duration(h.MaxRuntimeMinutes) * time.Minute
+}
+
+func validateHumidityFans(cfg *Config) error {
+	byID := devicesByID(cfg)
+	for i, h := range cfg.HumidityFans {
+		if d, ok := byID[h.Sensor]; !ok || !d.Features.Humidity {
+			return fmt.Errorf("humidity_fans %d: sensor %q is not a configured humidity sensor", i, h.Sensor)
+		}
+		if d, ok := byID[h.Fan]; !ok || !isPowerTarget(d.Type) || d.Type == DeviceTypeLightbulb {
+			return fmt.Errorf("humidity_fans %d: fan %q is not a configured fan, switch or outlet", i, h.Fan)
+		}
+		if h.Rise < 0 || h.Rise > 100 {
+			return fmt.Errorf("humidity_fans %d: rise %g out of range 0-100", i, h.Rise)
+		}
+		if h.BaselineMinutes < 0 || h.MaxRuntimeMinutes < 0 {
+			return fmt.Errorf("humidity_fans %d: minutes cannot be negative", i)
+		}
+	}
+	return nil
+}
+
+// humidityFan is a humidity fan rule and its state.
+type humidityFan struct {
+	HumidityFan
+
+	readings  []humidityReading // within the baseline window
+	running   bool              // switched on by the rule
+	exhausted bool              // stopped at the max runtime, until humidity falls
+	baseline  float64           // held while running or exhausted
+	timer     *time.Timer       // max runtime
+}
+
+type humidityReading struct {
+	at    time.Time
+	value float64
+}
+
+// SetHumidityFans replaces the humidity fan rules. Unchanged rules keep
+// their baseline and whether they are running.
+func (dm *Manager) SetHumidityFans(rules []HumidityFan) {
+	dm.humidityMu.Lock()
+	defer dm.humidityMu.Unlock()
+
+	next := make([]*humidityFan, 0, len(rules))
+	kept := make(map[*humidityFan]bool)
+	for _, rule := range rules {
+		var fan *humidityFan
+		for _, old := range dm.humidityFans {
+			if !kept[old] && reflect.DeepEqual(old.HumidityFan, rule) {
+				fan = old
+				break
+			}
+		}
+		if fan == nil {
+			fan = &humidityFan{HumidityFan: rule}
+		}
+		kept[fan] = true
+		next = append(next, fan)
+	}
+	for _, old := range dm.humidityFans {
+		if !kept[old] && old.timer != nil {
+			old.timer.Stop()
+		}
+	}
+	dm.humidityFans = next
+}
+
+// checkHumidityFans runs the rules of a sensor on a humidity reading.
+func (dm *Manager) checkHumidityFans(sensorID string, humidity float64, now time.Time) {
+	dm.humidityMu.Lock()
+	var cmds []CommandEvent
+	for _, fan := range dm.humidityFans {
+		if fan.Sensor != sensorID {
+			continue
+		}
+		if on, ok := dm.observeHumidity(fan, humidity, now); ok {
+			cmds = append(cmds, CommandEvent{DeviceID: fan.Fan, On: &on})
+		}
+	}
+	dm.humidityMu.Unlock()
+
+	for _, cmd := range cmds {
+		if !dm.tryQueueCommand(cmd) {
+			dm.logger.Warn("Command queue full, dropping humidity fan command", "fan", cmd.DeviceID)
+		}
+	}
+}
+
+// observeHumidity records a reading and reports whether the fan must be
+// switched, and to what. Callers must hold dm.humidityMu.
+func (dm *Manager) observeHumidity(fan *humidityFan, humidity float64, now time.Time) (on, ok bool) {
+	baseline, known := fan.baseline, true
+	if !fan.running && !fan.exhausted {
+		baseline, known = fan.lowest()
+	}
+
+	fan.readings = append(fan.readings, humidityReading{at: now, value: humidity})
+	cutoff := now.Add(-fan.baselineWindow())
+	for len(fan.readings) > 0 && fan.readings[0].at.Before(cutoff) {
+		fan.readings = fan.readings[1:]
+	}
+	if !known {
+		return false, false
+	}
+
+	settled := humidity <= baseline+fan.rise()/2
+	switch {
+	case fan.exhausted:
+		fan.exhausted = !settled
+	case fan.running && settled:
+		fan.running = false
+		if fan.timer != nil {
+			fan.timer.Stop()
+		}
+		dm.logger.Info("Humidity back to baseline, stopping fan", "sensor_id", fan.Sensor, "fan", fan.Fan, "humidity", humidity, "baseline", baseline)
+		return false, true
+	case !fan.running && humidity >= baseline+fan.rise():
+		fan.running = true
+		fan.baseline = baseline
+		var timer *time.Timer
+		timer = time.AfterFunc(fan.maxRuntime(), func() { dm.expireHumidityFan(fan, timer) })
+		fan.timer = timer
+		dm.logger.Info("Humidity rising, starting fan", "sensor_id", fan.Sensor, "fan", fan.Fan, "humidity", humidity, "baseline", baseline)
+		return true, true
+	}
+	return false, false
+}
+
+// lowest returns the lowest reading in the baseline window, once there
+// are enough readings to trust it.
+func (fan *humidityFan) lowest() (float64, bool) {
+	if len(fan.readings) < humidityFanMinBaselineSize {
+		return 0, false
+	}
+	low := fan.readings[0].value
+	for _, r := range fan.readings[1:] {
+		low = min(low, r.value)
+	}
+	return low, true
+}
+
+// expireHumidityFan stops a fan that reached its max runtime.
+func (dm *Manager) expireHumidityFan(fan *humidityFan, timer *time.Timer) {
+	dm.humidityMu.Lock()
+	current := fan.running && fan.timer == timer
+	if current {
+		fan.running = false
+		fan.exhausted = true
+	}
+	dm.humidityMu.Unlock()
+	if !current {
+		return
+	}
+
+	dm.logger.Warn("Humidity fan reached its max runtime, stopping it", "sensor_id", fan.Sensor, "fan", fan.Fan, "max_runtime", fan.maxRuntime())
+	off := false
+	if !dm.tryQueueCommand(CommandEvent{DeviceID: fan.Fan, On: &off}) {
+		dm.logger.Warn("Command queue full, dropping humidity fan command", "fan", fan.Fan)
+	}
+}
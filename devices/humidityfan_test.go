@@ -0,0 +1,107 @@
+package devices
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHumidityFan(t *testing.T) {
+	configs := []Device{
+		{ID: "bath", Name: "Bath", Type: DeviceTypeClimateSensor, Features: DeviceFeatures{Humidity: true}},
+		{ID: "fan", Name: "Fan", Type: DeviceTypeSwitch},
+	}
+	commands := make(chan CommandEvent, 10)
+	dm, _ := newTestManager(t, configs, commands, nil)
+	dm.SetHumidityFans([]HumidityFan{{Sensor: "bath", Fan: "fan", MaxRuntimeMinutes: 30}})
+
+	drain := func() []bool {
+		var got []bool
+		for {
+			select {
+			case cmd := <-commands:
+				got = append(got, *cmd.On)
+			default:
+				return got
+			}
+		}
+	}
+
+	start := time.Now()
+	readings := []struct {
+		minute   int
+		humidity float64
+		want     []bool
+	}{
+		{0, 55, nil},
+		{5, 52, nil},
+		{10, 60, nil},          // 8 above the baseline of 52
+		{12, 75, []bool{true}}, // shower
+		{20, 80, nil},
+		{40, 60, nil},           // still above 52+5
+		{50, 56, []bool{false}}, // back within half the rise
+		{55, 56, nil},
+	}
+	for _, r := range readings {
+		dm.checkHumidityFans("bath", r.humidity, start.Add(time.Duration(r.minute)*time.Minute))
+		if got := drain(); len(got) != len(r.want) || (len(got) > 0 && got[0] != r.want[0]) {
+			t.Errorf("minute %d at %g%%: commands %v, want %v", r.minute, r.humidity, got, r.want)
+		}
+	}
+
+	// A fan stopped at its max runtime stays off until humidity falls.
+	dm.checkHumidityFans("bath", 80, start.Add(60*time.Minute))
+	if got := drain(); len(got) != 1 || !got[0] {
+		t.Fatalf("second shower: commands %v, want the fan on", got)
+	}
+	fan := dm.humidityFans[0]
+	dm.expireHumidityFan(fan, fan.timer)
+	if got := drain(); len(got) != 1 || got[0] {
+		t.Errorf("max runtime: commands %v, want the fan off", got)
+	}
+	dm.checkHumidityFans("bath", 82, start.Add(95*time.Minute))
+	dm.checkHumidityFans("bath", 54, start.Add(120*time.Minute))
+	if got := drain(); len(got) != 0 {
+		t.Errorf("after max runtime: commands %v, want none", got)
+	}
+	dm.checkHumidityFans("bath", 75, start.Add(125*time.Minute))
+	if got := drain(); len(got) != 1 || !got[0] {
+		t.Errorf("after humidity fell: commands %v, want the fan on again", got)
+	}
+
+	// Reloading an unchanged rule keeps it running.
+	dm.SetHumidityFans([]HumidityFan{{Sensor: "bath", Fan: "fan", MaxRuntimeMinutes: 30}})
+	if !dm.humidityFans[0].running {
+		t.Error("reloading the rule lost its state")
+	}
+	dm.SetHumidityFans(nil)
+}
+
+func TestValidateHumidityFans(t *testing.T) {
+	devices := []Device{
+		{ID: "bath", Type: DeviceTypeClimateSensor, Features: DeviceFeatures{Humidity: true}},
+		{ID: "temp", Type: DeviceTypeClimateSensor, Features: DeviceFeatures{Temperature: true}},
+		{ID: "fan", Type: DeviceTypeFan},
+		{ID: "lamp", Type: DeviceTypeLightbulb},
+	}
+
+	tests := []struct {
+		name    string
+		rule    HumidityFan
+		wantErr bool
+	}{
+		{"fan", HumidityFan{Sensor: "bath", Fan: "fan"}, false},
+		{"no humidity", HumidityFan{Sensor: "temp", Fan: "fan"}, true},
+		{"light", HumidityFan{Sensor: "bath", Fan: "lamp"}, true},
+		{"unknown fan", HumidityFan{Sensor: "bath", Fan: "attic"}, true},
+		{"rise", HumidityFan{Sensor: "bath", Fan: "fan", Rise: 120}, true},
+		{"negative runtime", HumidityFan{Sensor: "bath", Fan: "fan", MaxRuntimeMinutes: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateHumidityFans(&Config{Devices: devices, HumidityFans: []HumidityFan{tt.rule}})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateHumidityFans() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
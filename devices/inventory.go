@@ -0,0 +1,219 @@
+package devices
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// LowBatteryLevel is the battery level below which the health score and
+// the inventory count a battery as low.
+const LowBatteryLevel = 25
+
+// Battery is the battery a device takes: Count cells of Type.
+type Battery struct {
+	Type  string
+	Count int
+}
+
+// ParseBattery parses a battery as written in the devices config: a type
+// such as "CR2032", optionally prefixed with a count, e.g. "2x AAA".
+func ParseBattery(s string) (Battery, error) {
+	s = strings.TrimSpace(s)
+	b := Battery{Type: s, Count: 1}
+	if count, rest, ok := strings.Cut(s, "x"); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(count)); err == nil {
+			if n < 1 {
+				return Battery{}, fmt.Errorf("battery %q: count must be at least 1", s)
+			}
+			b = Battery{Type: strings.TrimSpace(rest), Count: n}
+		}
+	}
+	if b.Type == "" || strings.ContainsAny(b.Type, " \t") {
+		return Battery{}, fmt.Errorf("battery %q: want a type such as CR2032 or 2x AAA", s)
+	}
+	return b, nil
+}
+
+func (b Battery) String() string {
+	if b.Count > 1 {
+		return fmt.Sprintf("%dx %s", b.Count, b.Type)
+	}
+	return b.Type
+}
+
+// modelBatteries holds the battery of common battery powered zigbee2mqtt
+// models. Others need battery_type in the devices config.
+var modelBatteries = map[string]Battery{
+	"WSDCGQ01LM":   {Type: "CR2032", Count: 1}, // Xiaomi temperature and humidity sensor
+	"WSDCGQ11LM":   {Type: "CR2032", Count: 1}, // Aqara temperature and humidity sensor
+	"MCCGQ01LM":    {Type: "CR1632", Count: 1}, // Xiaomi door and window sensor
+	"MCCGQ11LM":    {Type: "CR1632", Count: 1}, // Aqara door and window sensor
+	"RTCGQ11LM":    {Type: "CR2450", Count: 1}, // Aqara motion sensor
+	"SJCGQ11LM":    {Type: "CR2032", Count: 1}, // Aqara water leak sensor
+	"WXKG01LM":     {Type: "CR2032", Count: 1}, // Xiaomi wireless switch
+	"WXKG11LM":     {Type: "CR2032", Count: 1}, // Aqara wireless mini switch
+	"MFKZQ01LM":    {Type: "CR2450", Count: 1}, // Aqara cube
+	"E1743":        {Type: "CR2032", Count: 1}, // IKEA TRÅDFRI on/off switch
+	"E1524/E1810":  {Type: "CR2032", Count: 1}, // IKEA TRÅDFRI remote
+	"E1525/E1745":  {Type: "CR2032", Count: 2}, // IKEA TRÅDFRI motion sensor
+	"E2001/E2002":  {Type: "AAA", Count: 2},    // IKEA STYRBAR remote
+	"324131092621": {Type: "CR2450", Count: 1}, // Philips Hue dimmer switch
+	"929002398602": {Type: "CR2032", Count: 1}, // Philips Hue dimmer switch v2
+	"9290012607":   {Type: "AAA", Count: 2},    // Philips Hue motion sensor
+	"SNZB-01":      {Type: "CR2450", Count: 1}, // SONOFF wireless button
+	"SNZB-02":      {Type: "CR2450", Count: 1}, // SONOFF temperature and humidity sensor
+	"SNZB-03":      {Type: "CR2450", Count: 1}, // SONOFF motion sensor
+	"SNZB-04":      {Type: "CR2032", Count: 1}, // SONOFF door and window sensor
+}
+
+// BatteryForModel returns the known battery of a zigbee2mqtt model.
+func BatteryForModel(model string) (Battery, bool) {
+	b, ok := modelBatteries[model]
+	return b, ok
+}
+
+// Inventory lists the devices by model, with the batteries they take.
+type Inventory struct {
+	Models    []InventoryModel `json:"models"`
+	Batteries []BatteryStock   `json:"batteries"`
+	// Unknown counts battery powered devices whose battery is not
+	// known; set battery_type on them.
+	Unknown int `json:"unknown_batteries"`
+}
+
+// InventoryModel is the devices of one model. Model is empty for devices
+// zigbee2mqtt has not reported.
+type InventoryModel struct {
+	Model       string            `json:"model"`
+	Vendor      string            `json:"vendor,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Devices     []InventoryDevice `json:"devices"`
+}
+
+// InventoryDevice is a device in the inventory. Battery is empty for mains
+// powered devices and unknown batteries.
+type InventoryDevice struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Room         string `json:"room,omitempty"`
+	Location     string `json:"location,omitempty"`
+	PowerSource  string `json:"power_source,omitempty"`
+	Battery      string `json:"battery,omitempty"`
+	BatteryLevel *int   `json:"battery_level,omitempty"`
+}
+
+// BatteryStock totals one battery type: the devices taking it, the cells
+// they hold, and how many of those devices are low.
+type BatteryStock struct {
+	Type    string `json:"type"`
+	Devices int    `json:"devices"`
+	Cells   int    `json:"cells"`
+	Low     int    `json:"low"`
+}
+
+// SetBridgeDevices records the zigbee2mqtt device list, for the models in
+// the inventory.
+func (dm *Manager) SetBridgeDevices(list []Z2MDevice) {
+	byName := make(map[string]Z2MDevice, len(list))
+	for _, z := range list {
+		byName[z.FriendlyName] = z
+	}
+
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.bridgeDevices = byName
+}
+
+// Inventory groups the devices by model. The battery of a device is its
+// battery_type, or that of its model when known.
+func (dm *Manager) Inventory() Inventory {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+
+	models := make(map[string]*InventoryModel)
+	stock := make(map[string]*BatteryStock)
+	var inv Inventory
+	for id, info := range dm.deviceInfos() {
+		device := info.Config
+		z := dm.bridgeDevices[device.Topic]
+
+		var level *int
+		if state, ok := dm.states[id]; ok && state.Battery != nil {
+			level = Ptr(*state.Battery)
+		}
+		item := InventoryDevice{
+			ID:           id,
+			Name:         device.Name,
+			Room:         device.Room,
+			Location:     device.Location,
+			PowerSource:  z.PowerSource,
+			BatteryLevel: level,
+		}
+
+		var model string
+		if z.Definition != nil {
+			model = z.Definition.Model
+		}
+		battery, known := BatteryForModel(model)
+		if device.BatteryType != "" {
+			// Validated when the config was loaded.
+			battery, _ = ParseBattery(device.BatteryType)
+			known = true
+		}
+		powered := device.Features.Battery || z.PowerSource == "Battery" || level != nil
+		switch {
+		case known:
+			item.Battery = battery.String()
+			s := stock[battery.Type]
+			if s == nil {
+				s = &BatteryStock{Type: battery.Type}
+				stock[battery.Type] = s
+			}
+			s.Devices++
+			s.Cells += battery.Count
+			if level != nil && *level < LowBatteryLevel {
+				s.Low++
+			}
+		case powered:
+			inv.Unknown++
+		}
+
+		m := models[model]
+		if m == nil {
+			m = &InventoryModel{Model: model}
+			if z.Definition != nil {
+				m.Vendor = z.Definition.Vendor
+				m.Description = z.Definition.Description
+			}
+			models[model] = m
+		}
+		m.Devices = append(m.Devices, item)
+	}
+
+	for _, m := range models {
+		slices.SortFunc(m.Devices, func(a, b InventoryDevice) int {
+			return cmp.Or(strings.Compare(a.Name, b.Name), strings.Compare(a.ID, b.ID))
+		})
+		inv.Models = append(inv.Models, *m)
+	}
+	slices.SortFunc(inv.Models, func(a, b InventoryModel) int {
+		// Unreported devices go last.
+		if (a.Model == "") != (b.Model == "") {
+			if a.Model == "" {
+				return 1
+			}
+			return -1
+		}
+		return cmp.Or(strings.Compare(a.Vendor, b.Vendor), strings.Compare(a.Model, b.Model))
+	})
+	for _, s := range stock {
+		inv.Batteries = append(inv.Batteries, *s)
+	}
+	slices.SortFunc(inv.Batteries, func(a, b BatteryStock) int {
+		return strings.Compare(a.Type, b.Type)
+	})
+	return inv
+}
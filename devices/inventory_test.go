@@ -0,0 +1,74 @@
+package devices
+
+import (
+	"testing"
+)
+
+func TestParseBattery(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Battery
+		wantErr bool
+	}{
+		{"CR2032", Battery{Type: "CR2032", Count: 1}, false},
+		{"2x AAA", Battery{Type: "AAA", Count: 2}, false},
+		{" 3 x AA ", Battery{Type: "AA", Count: 3}, false},
+		{"0x AAA", Battery{}, true},
+		{"", Battery{}, true},
+		{"two AAA", Battery{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseBattery(tt.in)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseBattery(%q) = %+v, %v; want %+v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInventory(t *testing.T) {
+	dm, _ := newTestManager(t, []Device{
+		{ID: "hall", Name: "Hall", Topic: "hall", Type: DeviceTypeClimateSensor, Features: DeviceFeatures{Battery: true}},
+		{ID: "bath", Name: "Bath", Topic: "bath", Type: DeviceTypeClimateSensor, Features: DeviceFeatures{Battery: true}},
+		{ID: "remote", Name: "Remote", Topic: "remote", Type: DeviceTypeButton, BatteryType: "2x AAA"},
+		{ID: "door", Name: "Door", Topic: "door", Type: DeviceTypeContactSensor, Features: DeviceFeatures{Battery: true}},
+		{ID: "plug", Name: "Plug", Topic: "plug", Type: DeviceTypeOutlet},
+	}, nil, nil)
+	aqara := &Z2MDefinition{Model: "WSDCGQ11LM", Vendor: "Aqara", Description: "Temperature and humidity sensor"}
+	dm.SetBridgeDevices([]Z2MDevice{
+		{FriendlyName: "hall", PowerSource: "Battery", Definition: aqara},
+		{FriendlyName: "bath", PowerSource: "Battery", Definition: aqara},
+		{FriendlyName: "remote", PowerSource: "Battery", Definition: &Z2MDefinition{Model: "E2001/E2002", Vendor: "IKEA"}},
+		{FriendlyName: "door", PowerSource: "Battery", Definition: &Z2MDefinition{Model: "TS0203", Vendor: "Tuya"}},
+	})
+	dm.states["hall"].Battery = Ptr(12)
+
+	inv := dm.Inventory()
+
+	want := []BatteryStock{
+		{Type: "AAA", Devices: 1, Cells: 2},
+		{Type: "CR2032", Devices: 2, Cells: 2, Low: 1},
+	}
+	if len(inv.Batteries) != len(want) || inv.Batteries[0] != want[0] || inv.Batteries[1] != want[1] {
+		t.Errorf("Batteries = %+v, want %+v", inv.Batteries, want)
+	}
+	if inv.Unknown != 1 {
+		t.Errorf("Unknown = %d, want 1 (the Tuya door sensor)", inv.Unknown)
+	}
+
+	var models []string
+	for _, m := range inv.Models {
+		models = append(models, m.Model)
+	}
+	if len(models) != 4 || models[0] != "WSDCGQ11LM" || models[1] != "E2001/E2002" || models[3] != "" {
+		t.Errorf("models = %q, want Aqara, IKEA, Tuya, then unreported", models)
+	}
+	if hall := inv.Models[0].Devices[1]; hall.ID != "hall" || hall.Battery != "CR2032" || hall.BatteryLevel == nil || *hall.BatteryLevel != 12 {
+		t.Errorf("hall = %+v", hall)
+	}
+	if remote := inv.Models[1].Devices[0]; remote.Battery != "2x AAA" {
+		t.Errorf("remote battery = %q, want 2x AAA", remote.Battery)
+	}
+}
@@ -0,0 +1,118 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+// ErrValveLocked is returned when opening a valve that was closed by a leak
+// and has not been acknowledged.
+var ErrValveLocked = errors.New("valve was closed by a leak and must be acknowledged before reopening")
+
+// Lockout records why a shutoff valve is held closed.
+type Lockout struct {
+	Sensor string    // leak sensor that closed the valve
+	Since  time.Time // when the leak was detected
+}
+
+// validateShutoffValves checks that leak sensors only name switch or
+// outlet devices (how zigbee2mqtt exposes most water valves) as valves.
+func validateShutoffValves(cfg *Config) error {
+	byID := make(map[string]Device, len(cfg.Devices))
+	for _, d := range cfg.Devices {
+		byID[d.ID] = d
+	}
+
+	for _, device := range cfg.Devices {
+		if len(device.ShutoffValves) == 0 {
+			continue
+		}
+		if device.Type != DeviceTypeLeakSensor {
+			return fmt.Errorf("device %s: shutoff_valves is only supported on leak sensors", device.ID)
+		}
+		for _, id := range device.ShutoffValves {
+			valve, ok := byID[id]
+			if !ok {
+				return fmt.Errorf("device %s: shutoff valve %q is not a configured device", device.ID, id)
+			}
+			if valve.Type != DeviceTypeSwitch && valve.Type != DeviceTypeOutlet {
+				return fmt.Errorf("device %s: shutoff valve %s must be a switch or outlet", device.ID, id)
+			}
+		}
+	}
+
+	return nil
+}
+
+// handleLeak closes the valves paired with a leak sensor and locks them
+// until the leak is acknowledged.
+func (dm *Manager) handleLeak(ctx context.Context, sensorID string) {
+	info, ok := dm.deviceInfos()[sensorID]
+	if !ok || len(info.Config.ShutoffValves) == 0 {
+		return
+	}
+
+	now := dm.Now()
+	dm.mu.Lock()
+	for _, valveID := range info.Config.ShutoffValves {
+		if _, locked := dm.lockouts[valveID]; !locked {
+			dm.lockouts[valveID] = Lockout{Sensor: sensorID, Since: now}
+		}
+	}
+	dm.mu.Unlock()
+
+	for _, valveID := range info.Config.ShutoffValves {
+		dm.logger.Warn("Leak detected, closing valve",
+			"sensor_id", sensorID,
+			"valve_id", valveID,
+		)
+
+		message := fmt.Sprintf("Leak detected by %s, closed %s", info.Config.Name, dm.deviceInfos()[valveID].Config.Name)
+		if err := dm.SetPower(ctx, valveID, false); err != nil {
+			dm.logger.Error("Failed to close valve", "valve_id", valveID, "error", err)
+			message = fmt.Sprintf("Leak detected by %s, failed to close %s: %v", info.Config.Name, dm.deviceInfos()[valveID].Config.Name, err)
+		}
+
+		dm.publishLeakAlert(valveID, true, dm.testLabel(sensorID, message))
+	}
+}
+
+// AcknowledgeLeak releases a valve locked by a leak so it can be opened
+// again. It fails while the sensor still reports water.
+func (dm *Manager) AcknowledgeLeak(ctx context.Context, valveID string) error {
+	dm.mu.Lock()
+	lockout, ok := dm.lockouts[valveID]
+	if !ok {
+		dm.mu.Unlock()
+		return fmt.Errorf("valve %s is not locked", valveID)
+	}
+	if sensor := dm.states[lockout.Sensor]; sensor != nil && sensor.WaterLeak != nil && *sensor.WaterLeak {
+		dm.mu.Unlock()
+		return fmt.Errorf("%s still reports a leak", lockout.Sensor)
+	}
+	delete(dm.lockouts, valveID)
+	dm.mu.Unlock()
+
+	dm.logger.Info("Leak acknowledged, valve unlocked", "valve_id", valveID, "sensor_id", lockout.Sensor)
+	dm.publishLeakAlert(valveID, false, "Leak acknowledged, valve may be reopened")
+	return nil
+}
+
+func (dm *Manager) publishLeakAlert(valveID string, active bool, message string) {
+	if dm.eventBus == nil || dm.stateEventClient == nil {
+		return
+	}
+
+	dm.publishAlert(events.AlertEvent{
+		Timestamp: dm.Now(),
+		DeviceID:  valveID,
+		Name:      dm.deviceInfos()[valveID].Config.Name,
+		Kind:      events.AlertKindLeak,
+		Active:    active,
+		Message:   message,
+	})
+}
@@ -0,0 +1,66 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestValidateShutoffValves(t *testing.T) {
+	devices := []Device{
+		{ID: "leak", Type: DeviceTypeLeakSensor, ShutoffValves: []string{"valve"}},
+		{ID: "valve", Type: DeviceTypeSwitch},
+		{ID: "lamp", Type: DeviceTypeLightbulb},
+	}
+	if err := validateShutoffValves(&Config{Devices: devices}); err != nil {
+		t.Errorf("valid pairing rejected: %v", err)
+	}
+
+	devices[0].ShutoffValves = []string{"lamp"}
+	if err := validateShutoffValves(&Config{Devices: devices}); err == nil {
+		t.Error("lightbulb accepted as a valve")
+	}
+
+	devices[0].ShutoffValves = []string{"missing"}
+	if err := validateShutoffValves(&Config{Devices: devices}); err == nil {
+		t.Error("unknown valve accepted")
+	}
+}
+
+func TestLeakShutoffLockout(t *testing.T) {
+	dm, _ := newTestManager(t, []Device{
+		{ID: "leak", Name: "Leak", Type: DeviceTypeLeakSensor, ShutoffValves: []string{"valve"}},
+		{ID: "valve", Name: "Valve", Type: DeviceTypeSwitch},
+	}, nil, nil)
+
+	ctx := context.Background()
+	wet := true
+	dm.states["leak"].WaterLeak = &wet
+	dm.handleLeak(ctx, "leak")
+
+	if _, state, _ := dm.Device("valve"); state.Lockout == nil || state.Lockout.Sensor != "leak" {
+		t.Fatalf("valve lockout = %+v, want locked by leak", state.Lockout)
+	}
+	if err := dm.SetPower(ctx, "valve", true); !errors.Is(err, ErrValveLocked) {
+		t.Errorf("opening locked valve: err = %v, want ErrValveLocked", err)
+	}
+	if err := dm.SetPower(ctx, "valve", false); err != nil {
+		t.Errorf("closing locked valve: %v", err)
+	}
+
+	if err := dm.AcknowledgeLeak(ctx, "valve"); err == nil {
+		t.Error("acknowledged while the sensor still reports a leak")
+	}
+
+	dry := false
+	dm.states["leak"].WaterLeak = &dry
+	if err := dm.AcknowledgeLeak(ctx, "valve"); err != nil {
+		t.Fatalf("AcknowledgeLeak: %v", err)
+	}
+	if err := dm.SetPower(ctx, "valve", true); err != nil {
+		t.Errorf("opening acknowledged valve: %v", err)
+	}
+	if err := dm.AcknowledgeLeak(ctx, "valve"); err == nil {
+		t.Error("acknowledging an unlocked valve succeeded")
+	}
+}
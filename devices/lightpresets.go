@@ -0,0 +1,158 @@
+package devices
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// DefaultLightPresets are the bands used when light presets are enabled
+// without listing any.
+var DefaultLightPresets = []LightPreset{
+	{Name: "morning", From: "06:00", Brightness: 40, Kelvin: 2700},
+	{Name: "day", From: "09:00", Brightness: 100, Kelvin: 4000},
+	{Name: "night", From: "21:00", Brightness: 10, Kelvin: 2200},
+}
+
+// LightPresets sets the brightness and color temperature lights turn on
+// at, by time of day. They apply when this bridge turns an off light on;
+// changes made while a light is on are left alone.
+type LightPresets struct {
+	// Bands apply to every light. Empty uses DefaultLightPresets.
+	Bands []LightPreset `json:"bands,omitempty"`
+
+	// Rooms replaces the bands for lights in a room. An empty list turns
+	// presets off in that room.
+	Rooms map[string][]LightPreset `json:"rooms,omitempty"`
+}
+
+// LightPreset is a time band of LightPresets. It lasts from its From time
+// until the From of the next band, wrapping around midnight.
+type LightPreset struct {
+	Name string `json:"name,omitempty"`
+	From string `json:"from"` // local time, "HH:MM"
+
+	// Brightness in percent and color temperature in kelvin. 0 leaves the
+	// light's value as it is.
+	Brightness int `json:"brightness,omitempty"`
+	Kelvin     int `json:"kelvin,omitempty"`
+}
+
+func validateLightPresets(cfg *Config) error {
+	lp := cfg.LightPresets
+	if lp == nil {
+		return nil
+	}
+	if err := validateLightPresetBands(lp.Bands); err != nil {
+		return fmt.Errorf("light_presets: %w", err)
+	}
+	for room, bands := range lp.Rooms {
+		if !slices.ContainsFunc(cfg.Devices, func(d Device) bool { return d.Room == room && d.Type == DeviceTypeLightbulb }) {
+			return fmt.Errorf("light_presets: room %q has no lights", room)
+		}
+		if err := validateLightPresetBands(bands); err != nil {
+			return fmt.Errorf("light_presets: room %s: %w", room, err)
+		}
+	}
+	return nil
+}
+
+func validateLightPresetBands(bands []LightPreset) error {
+	seen := make(map[int]bool, len(bands))
+	for _, b := range bands {
+		from, err := parseClock(b.From)
+		if err != nil {
+			return err
+		}
+		if seen[from] {
+			return fmt.Errorf("two bands start at %s", b.From)
+		}
+		seen[from] = true
+
+		if b.Brightness < 0 || b.Brightness > 100 {
+			return fmt.Errorf("band %s: brightness %d out of range 0-100", b.From, b.Brightness)
+		}
+		if b.Kelvin != 0 && (b.Kelvin < 1000 || b.Kelvin > 10000) {
+			return fmt.Errorf("band %s: kelvin %d out of range 1000-10000", b.From, b.Kelvin)
+		}
+	}
+	return nil
+}
+
+// SetLightPresets sets the light presets. Nil disables them.
+func (dm *Manager) SetLightPresets(lp *LightPresets) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.lightPresets = lp
+}
+
+// lightPreset returns the band a light turned on at now gets, if any.
+func (dm *Manager) lightPreset(device Device, now time.Time) (LightPreset, bool) {
+	dm.mu.RLock()
+	lp := dm.lightPresets
+	dm.mu.RUnlock()
+
+	if lp == nil || device.Type != DeviceTypeLightbulb {
+		return LightPreset{}, false
+	}
+	bands := lp.Bands
+	if len(bands) == 0 {
+		bands = DefaultLightPresets
+	}
+	if room, ok := lp.Rooms[device.Room]; ok && device.Room != "" {
+		bands = room
+	}
+	return presetAt(bands, now)
+}
+
+// presetAt returns the band in effect at now: the one that started last,
+// or yesterday's last band before the first starts.
+func presetAt(bands []LightPreset, now time.Time) (LightPreset, bool) {
+	minute := now.Hour()*60 + now.Minute()
+
+	var current, last LightPreset
+	currentFrom, lastFrom := -1, -1
+	for _, b := range bands {
+		from, err := parseClock(b.From)
+		if err != nil {
+			continue
+		}
+		if from <= minute && from > currentFrom {
+			current, currentFrom = b, from
+		}
+		if from > lastFrom {
+			last, lastFrom = b, from
+		}
+	}
+	switch {
+	case currentFrom >= 0:
+		return current, true
+	case lastFrom >= 0:
+		return last, true
+	}
+	return LightPreset{}, false
+}
+
+// presetPayload adds the preset of a light being turned on at now to its
+// power command. Lights already on keep their settings.
+func (dm *Manager) presetPayload(device Device, state State, now time.Time, payload map[string]any) {
+	if state.On != nil && *state.On {
+		return
+	}
+	preset, ok := dm.lightPreset(device, now)
+	if !ok {
+		return
+	}
+
+	if preset.Brightness > 0 && device.Features.Brightness {
+		payload["brightness"] = HAPBrightnessToZ2M(preset.Brightness)
+	}
+	if preset.Kelvin > 0 && device.Features.ColorTemperature {
+		mireds := 1_000_000 / preset.Kelvin
+		if r := device.ColorTempRange; r != nil {
+			mireds = max(r.Min, min(r.Max, mireds))
+		}
+		payload["color_temp"] = mireds
+	}
+	dm.logger.Info("Applying light preset", "device_id", device.ID, "preset", preset.Name, "from", preset.From)
+}
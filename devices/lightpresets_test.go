@@ -0,0 +1,97 @@
+package devices
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPresetAt(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 6, 21, hour, minute, 0, 0, time.Local)
+	}
+	tests := []struct {
+		now  time.Time
+		want string
+	}{
+		{at(5, 59), "night"},
+		{at(6, 0), "morning"},
+		{at(12, 0), "day"},
+		{at(21, 0), "night"},
+		{at(23, 59), "night"},
+	}
+	for _, tt := range tests {
+		if got, ok := presetAt(DefaultLightPresets, tt.now); !ok || got.Name != tt.want {
+			t.Errorf("presetAt(%s) = %q, want %q", tt.now.Format("15:04"), got.Name, tt.want)
+		}
+	}
+	if _, ok := presetAt(nil, at(12, 0)); ok {
+		t.Error("presetAt without bands found one")
+	}
+}
+
+func TestPresetPayload(t *testing.T) {
+	living := Device{
+		ID: "living", Type: DeviceTypeLightbulb, Room: "Living room",
+		Features:       DeviceFeatures{Brightness: true, ColorTemperature: true},
+		ColorTempRange: &ColorTempRange{Min: 250, Max: 454},
+	}
+	bedroom := Device{ID: "bedroom", Type: DeviceTypeLightbulb, Room: "Bedroom", Features: DeviceFeatures{Brightness: true}}
+	dm, _ := newTestManager(t, []Device{living, bedroom}, nil, nil)
+	dm.SetLightPresets(&LightPresets{Rooms: map[string][]LightPreset{"Bedroom": {}}})
+
+	morning := time.Date(2024, 6, 21, 7, 0, 0, 0, time.Local)
+	payload := map[string]any{}
+	dm.presetPayload(living, State{}, morning, payload)
+	if payload["brightness"] != HAPBrightnessToZ2M(40) || payload["color_temp"] != 370 {
+		t.Errorf("morning payload = %v, want 40%% at 370 mireds", payload)
+	}
+
+	// Clamped to the light's range.
+	payload = map[string]any{}
+	dm.presetPayload(living, State{}, morning.Add(14*time.Hour), payload)
+	if payload["color_temp"] != 454 {
+		t.Errorf("night color_temp = %v, want the light's 454", payload["color_temp"])
+	}
+
+	payload = map[string]any{}
+	dm.presetPayload(living, State{On: Ptr(true)}, morning, payload)
+	if len(payload) != 0 {
+		t.Errorf("light already on got %v", payload)
+	}
+	dm.presetPayload(bedroom, State{}, morning, payload)
+	if len(payload) != 0 {
+		t.Errorf("room with presets off got %v", payload)
+	}
+
+	dm.SetLightPresets(nil)
+	dm.presetPayload(living, State{}, morning, payload)
+	if len(payload) != 0 {
+		t.Errorf("presets disabled got %v", payload)
+	}
+}
+
+func TestValidateLightPresets(t *testing.T) {
+	devices := []Device{{ID: "lamp", Type: DeviceTypeLightbulb, Room: "Hall"}, {ID: "plug", Type: DeviceTypeOutlet, Room: "Office"}}
+
+	tests := []struct {
+		name    string
+		presets LightPresets
+		wantErr bool
+	}{
+		{"defaults", LightPresets{}, false},
+		{"room", LightPresets{Rooms: map[string][]LightPreset{"Hall": {{From: "07:00", Brightness: 60}}}}, false},
+		{"room without lights", LightPresets{Rooms: map[string][]LightPreset{"Office": nil}}, true},
+		{"bad time", LightPresets{Bands: []LightPreset{{From: "7am"}}}, true},
+		{"same start", LightPresets{Bands: []LightPreset{{From: "07:00"}, {From: "07:00"}}}, true},
+		{"brightness", LightPresets{Bands: []LightPreset{{From: "07:00", Brightness: 120}}}, true},
+		{"kelvin", LightPresets{Bands: []LightPreset{{From: "07:00", Kelvin: 270}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateLightPresets(&Config{Devices: devices, LightPresets: &tt.presets})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateLightPresets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package devices
+
+import (
+	"sync"
+	"time"
+)
+
+// LinkQualityLevel buckets a Zigbee link quality (0-255) for display.
+func LinkQualityLevel(lq int) string {
+	switch {
+	case lq <= 0:
+		return "unknown"
+	case lq < 50:
+		return "weak"
+	case lq < 100:
+		return "fair"
+	default:
+		return "good"
+	}
+}
+
+// LinkQualityTransition describes a change in a device's weak-link alert.
+type LinkQualityTransition struct {
+	DeviceID string
+	Active   bool // true when the alert fires, false when it clears
+	Value    int
+	Since    time.Time
+}
+
+// LinkQualityMonitor raises an alert when a device's link quality stays
+// below a threshold for longer than a window.
+type LinkQualityMonitor struct {
+	threshold int
+	window    time.Duration
+
+	mu       sync.Mutex
+	lowSince map[string]time.Time
+	alerting map[string]bool
+}
+
+// NewLinkQualityMonitor creates a monitor. A threshold of 0 disables it.
+func NewLinkQualityMonitor(threshold int, window time.Duration) *LinkQualityMonitor {
+	return &LinkQualityMonitor{
+		threshold: threshold,
+		window:    window,
+		lowSince:  make(map[string]time.Time),
+		alerting:  make(map[string]bool),
+	}
+}
+
+// Observe records a link quality sample and returns a transition when the
+// alert state changes.
+func (m *LinkQualityMonitor) Observe(deviceID string, lq int, now time.Time) (LinkQualityTransition, bool) {
+	if m == nil || m.threshold <= 0 || lq <= 0 {
+		return LinkQualityTransition{}, false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if lq >= m.threshold {
+		delete(m.lowSince, deviceID)
+		if m.alerting[deviceID] {
+			delete(m.alerting, deviceID)
+			return LinkQualityTransition{DeviceID: deviceID, Active: false, Value: lq, Since: now}, true
+		}
+		return LinkQualityTransition{}, false
+	}
+
+	since, ok := m.lowSince[deviceID]
+	if !ok {
+		since = now
+		m.lowSince[deviceID] = now
+	}
+
+	if !m.alerting[deviceID] && now.Sub(since) >= m.window {
+		m.alerting[deviceID] = true
+		return LinkQualityTransition{DeviceID: deviceID, Active: true, Value: lq, Since: since}, true
+	}
+
+	return LinkQualityTransition{}, false
+}
+
+// Threshold returns the configured alert threshold.
+func (m *LinkQualityMonitor) Threshold() int {
+	if m == nil {
+		return 0
+	}
+	return m.threshold
+}
@@ -0,0 +1,81 @@
+package devices
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLinkQualityLevel(t *testing.T) {
+	tests := []struct {
+		lq   int
+		want string
+	}{
+		{0, "unknown"},
+		{12, "weak"},
+		{49, "weak"},
+		{50, "fair"},
+		{99, "fair"},
+		{100, "good"},
+		{255, "good"},
+	}
+
+	for _, tt := range tests {
+		if got := LinkQualityLevel(tt.lq); got != tt.want {
+			t.Errorf("LinkQualityLevel(%d) = %q, want %q", tt.lq, got, tt.want)
+		}
+	}
+}
+
+func TestLinkQualityMonitor(t *testing.T) {
+	m := NewLinkQualityMonitor(30, 5*time.Minute)
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, changed := m.Observe("dev", 10, start); changed {
+		t.Fatal("alert should not fire before window elapses")
+	}
+	if _, changed := m.Observe("dev", 12, start.Add(4*time.Minute)); changed {
+		t.Fatal("alert should not fire before window elapses")
+	}
+
+	tr, changed := m.Observe("dev", 15, start.Add(5*time.Minute))
+	if !changed || !tr.Active {
+		t.Fatalf("expected alert to fire, got %+v changed=%v", tr, changed)
+	}
+	if !tr.Since.Equal(start) {
+		t.Errorf("Since = %v, want %v", tr.Since, start)
+	}
+
+	if _, changed := m.Observe("dev", 11, start.Add(6*time.Minute)); changed {
+		t.Fatal("alert should only fire once")
+	}
+
+	tr, changed = m.Observe("dev", 80, start.Add(7*time.Minute))
+	if !changed || tr.Active {
+		t.Fatalf("expected alert to clear, got %+v changed=%v", tr, changed)
+	}
+}
+
+func TestLinkQualityMonitorRecoversBeforeWindow(t *testing.T) {
+	m := NewLinkQualityMonitor(30, 5*time.Minute)
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	m.Observe("dev", 10, start)
+	if _, changed := m.Observe("dev", 90, start.Add(time.Minute)); changed {
+		t.Fatal("recovery without alert should not produce a transition")
+	}
+	if _, changed := m.Observe("dev", 10, start.Add(5*time.Minute)); changed {
+		t.Fatal("low window should restart after recovery")
+	}
+}
+
+func TestLinkQualityMonitorDisabled(t *testing.T) {
+	var nilMonitor *LinkQualityMonitor
+	if _, changed := nilMonitor.Observe("dev", 1, time.Now()); changed {
+		t.Error("nil monitor should never alert")
+	}
+
+	m := NewLinkQualityMonitor(0, 0)
+	if _, changed := m.Observe("dev", 1, time.Now()); changed {
+		t.Error("zero threshold should disable alerts")
+	}
+}
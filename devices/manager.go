@@ -5,17 +5,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/kradalby/z2m-homekit/events"
-	mqtt "github.com/mochi-mqtt/server/v2"
 	"tailscale.com/util/eventbus"
 )
 
 // Manager manages all Zigbee device state.
 type Manager struct {
-	devices          map[string]*Info
+	devices          atomic.Pointer[map[string]*Info]
 	states           map[string]*State
 	mu               sync.RWMutex
 	commands         chan CommandEvent
@@ -24,8 +27,70 @@ type Manager struct {
 	stateSubscriber  *eventbus.Subscriber[StateChangedEvent]
 	eventBus         *events.Bus
 	stateEventClient *eventbus.Client
-	mqttServer       *mqtt.Server
-	logger           *slog.Logger
+	mqttServer       Publisher
+	linkQuality      *LinkQualityMonitor
+	pressure         *PressureHistory
+	health           *HealthTracker
+	anomalies        *AnomalyDetector
+	lockouts         map[string]Lockout
+	smokeResponse    *SmokeResponse
+	acks             map[string]AlertAck
+	alertSilence     time.Duration
+
+	nightMode         *NightMode
+	nightActive       bool
+	nightOverride     *bool
+	nightOverrideFrom bool // scheduled state when the override was made
+	nightHooks        []func(active bool)
+
+	otaHooks []func(FirmwareUpdateResult)
+
+	permitJoinUntil time.Time // zero while the network is closed
+	joinHooks       []func(friendlyName, ieeeAddress string)
+
+	groups []Group
+
+	bridgeDevices map[string]Z2MDevice // by friendly name, for the inventory
+
+	schedules       []Schedule
+	location        *Location
+	scheduleChecked time.Time // schedules due up to here have run
+
+	humidityMu   sync.Mutex
+	humidityFans []*humidityFan
+
+	scenes      []Scene
+	savedScenes []Scene
+	sceneFile   string     // where saved scenes are kept; empty disables saving
+	sceneMu     sync.Mutex // keeps the commands of a scene together
+
+	lightPresets *LightPresets
+
+	disabled     map[string]time.Time // disabled devices, with when
+	disabledFile string               // where they are kept; empty keeps them in memory
+
+	z2mOffline bool
+	queued     map[string]*commandQueue
+	flushing   bool          // held commands are being sent
+	z2mSeen    chan struct{} // closed on the first online report
+	z2mOnce    sync.Once
+
+	commandLog *CommandLog
+
+	sirenTimers map[string]*time.Timer // warnings still sounding
+	testFires   map[string]*TestFire   // running test-fires, by sensor
+
+	calibrations map[string]*Calibration // latest calibration step, by cover
+
+	clock Clock
+
+	logger *slog.Logger
+}
+
+// Publisher sends MQTT messages. The embedded broker (*mqtt.Server) and
+// the client for an external broker both satisfy it.
+type Publisher interface {
+	Publish(topic string, payload []byte, retain bool, qos byte) error
 }
 
 // Info holds the configuration for a device.
@@ -38,7 +103,7 @@ func NewManager(
 	deviceConfigs []Device,
 	commands chan CommandEvent,
 	bus *events.Bus,
-	mqttServer *mqtt.Server,
+	mqttServer Publisher,
 	logger *slog.Logger,
 ) (*Manager, error) {
 	client, err := bus.Client(events.ClientDeviceManager)
@@ -47,7 +112,6 @@ func NewManager(
 	}
 
 	dm := &Manager{
-		devices:          make(map[string]*Info),
 		states:           make(map[string]*State),
 		commands:         commands,
 		statePublisher:   eventbus.Publish[StateChangedEvent](client),
@@ -56,55 +120,118 @@ func NewManager(
 		eventBus:         bus,
 		stateEventClient: client,
 		mqttServer:       mqttServer,
+		pressure:         NewPressureHistory(),
+		health:           NewHealthTracker(),
+		anomalies:        NewAnomalyDetector(),
+		lockouts:         make(map[string]Lockout),
+		acks:             make(map[string]AlertAck),
+		z2mSeen:          make(chan struct{}),
+		sirenTimers:      make(map[string]*time.Timer),
+		testFires:        make(map[string]*TestFire),
+		calibrations:     make(map[string]*Calibration),
+		clock:            WallClock{},
 		logger:           logger,
 	}
 
+	infos := make(map[string]*Info, len(deviceConfigs))
 	for _, deviceConfig := range deviceConfigs {
-		dm.devices[deviceConfig.ID] = &Info{
+		infos[deviceConfig.ID] = &Info{
 			Config: deviceConfig,
 		}
+		dm.states[deviceConfig.ID] = newState(deviceConfig, dm.Now())
+	}
+	dm.devices.Store(&infos)
 
-		dm.states[deviceConfig.ID] = &State{
-			ID:          deviceConfig.ID,
-			Name:        deviceConfig.Name,
-			LastUpdated: time.Now(),
-			LastSeen:    time.Time{},
-		}
+	for _, deviceConfig := range deviceConfigs {
+		dm.initDevice(deviceConfig)
+	}
 
-		dm.publishStateUpdate("initial", deviceConfig.ID, *dm.states[deviceConfig.ID])
+	return dm, nil
+}
 
-		logger.Info("Initialized device",
-			"id", deviceConfig.ID,
-			"name", deviceConfig.Name,
-			"type", deviceConfig.Type,
-			"topic", deviceConfig.Topic,
-		)
+// newState returns the state of a device that has not reported yet.
+func newState(device Device, now time.Time) *State {
+	return &State{
+		ID:          device.ID,
+		Name:        device.Name,
+		LastUpdated: now,
+		LastSeen:    time.Time{},
 	}
+}
 
-	return dm, nil
+// initDevice announces a newly managed device's empty state.
+func (dm *Manager) initDevice(device Device) {
+	dm.mu.RLock()
+	state := *dm.states[device.ID]
+	dm.mu.RUnlock()
+	dm.publishStateUpdate("initial", device.ID, state)
+
+	dm.logger.Info("Initialized device",
+		"id", device.ID,
+		"name", device.Name,
+		"type", device.Type,
+		"topic", device.Topic,
+	)
+}
+
+// deviceInfos returns the managed devices. SetDevices replaces the map
+// rather than modifying it, so it can be read without holding mu.
+func (dm *Manager) deviceInfos() map[string]*Info {
+	return *dm.devices.Load()
+}
+
+// SetLinkQualityAlert enables alerts for devices whose link quality stays
+// below threshold for longer than window. A threshold of 0 disables alerts.
+func (dm *Manager) SetLinkQualityAlert(threshold int, window time.Duration) {
+	dm.linkQuality = NewLinkQualityMonitor(threshold, window)
 }
 
 // SetPower sets the power state of a device via MQTT.
 func (dm *Manager) SetPower(ctx context.Context, deviceID string, on bool) error {
-	info, exists := dm.devices[deviceID]
+	info, exists := dm.deviceInfos()[deviceID]
 	if !exists {
 		return fmt.Errorf("device %s not found", deviceID)
 	}
 
 	topic := fmt.Sprintf("zigbee2mqtt/%s/set", info.Config.Topic)
-	payload := map[string]string{"state": BoolToZ2MState(on)}
+	payload := map[string]any{"state": BoolToZ2MState(on)}
+	if on {
+		_, state, _ := dm.Device(deviceID)
+		dm.presetPayload(info.Config, state, dm.Now(), payload)
+
+		if limit := dm.nightBrightnessCap(deviceID); limit > 0 {
+			// Turn lights on at no more than the night mode cap, rather
+			// than at whatever brightness they had during the day.
+			brightness := state.Brightness
+			if preset, ok := payload["brightness"].(int); ok {
+				brightness = &preset
+			}
+			if brightness == nil || Z2MBrightnessToHAP(*brightness) > limit {
+				payload["brightness"] = HAPBrightnessToZ2M(limit)
+			}
+		}
+	}
 	data, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal command: %w", err)
 	}
 
+	if on {
+		dm.mu.RLock()
+		_, locked := dm.lockouts[deviceID]
+		dm.mu.RUnlock()
+		if locked {
+			return ErrValveLocked
+		}
+	}
+
 	dm.logger.Info("Sending power command",
 		"device_id", deviceID,
 		"topic", topic,
 		"on", on,
 	)
 
-	if err := dm.mqttServer.Publish(topic, data, false, 0); err != nil {
+	if err := dm.publishCommand(deviceID, topic, data); err != nil {
 		dm.errorPublisher.Publish(ErrorEvent{
 			DeviceID: deviceID,
 			Error:    fmt.Errorf("failed to publish power command: %w", err),
@@ -117,11 +244,20 @@ func (dm *Manager) SetPower(ctx context.Context, deviceID string, on bool) error
 
 // SetBrightness sets the brightness of a light via MQTT.
 func (dm *Manager) SetBrightness(ctx context.Context, deviceID string, brightness int) error {
-	info, exists := dm.devices[deviceID]
+	info, exists := dm.deviceInfos()[deviceID]
 	if !exists {
 		return fmt.Errorf("device %s not found", deviceID)
 	}
 
+	if limit := dm.nightBrightnessCap(deviceID); limit > 0 && brightness > limit {
+		dm.logger.Info("Capping brightness for night mode",
+			"device_id", deviceID,
+			"requested", brightness,
+			"cap", limit,
+		)
+		brightness = limit
+	}
+
 	topic := fmt.Sprintf("zigbee2mqtt/%s/set", info.Config.Topic)
 	// Convert HAP brightness (0-100) to Z2M brightness (0-254)
 	z2mBrightness := HAPBrightnessToZ2M(brightness)
@@ -140,16 +276,65 @@ func (dm *Manager) SetBrightness(ctx context.Context, deviceID string, brightnes
 		"brightness_z2m", z2mBrightness,
 	)
 
-	if err := dm.mqttServer.Publish(topic, data, false, 0); err != nil {
+	if err := dm.publishCommand(deviceID, topic, data); err != nil {
 		return fmt.Errorf("failed to publish brightness command: %w", err)
 	}
 
 	return nil
 }
 
+// StartDimming starts a smooth brightness change on a light using
+// zigbee2mqtt's brightness_move. The light keeps moving until StopDimming
+// is called or it reaches its minimum or maximum. A move would run past the
+// night mode cap, so dimming up a capped light sets it to the cap instead.
+func (dm *Manager) StartDimming(ctx context.Context, deviceID string, up bool) error {
+	if limit := dm.nightBrightnessCap(deviceID); up && limit > 0 {
+		return dm.SetBrightness(ctx, deviceID, limit)
+	}
+
+	rate := DimRate
+	if !up {
+		rate = -rate
+	}
+	return dm.publishDim(deviceID, rate)
+}
+
+// StopDimming stops a brightness change started by StartDimming.
+func (dm *Manager) StopDimming(ctx context.Context, deviceID string) error {
+	return dm.publishDim(deviceID, "stop")
+}
+
+func (dm *Manager) publishDim(deviceID string, move any) error {
+	info, exists := dm.deviceInfos()[deviceID]
+	if !exists {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+
+	topic := fmt.Sprintf("zigbee2mqtt/%s/set", info.Config.Topic)
+	payload := map[string]any{
+		"brightness_move": move,
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal command: %w", err)
+	}
+
+	dm.logger.Info("Sending dimming command",
+		"device_id", deviceID,
+		"topic", topic,
+		"brightness_move", move,
+	)
+
+	if err := dm.publishCommand(deviceID, topic, data); err != nil {
+		return fmt.Errorf("failed to publish dimming command: %w", err)
+	}
+
+	return nil
+}
+
 // SetColor sets the color of a light via MQTT.
 func (dm *Manager) SetColor(ctx context.Context, deviceID string, hue, saturation float64) error {
-	info, exists := dm.devices[deviceID]
+	info, exists := dm.deviceInfos()[deviceID]
 	if !exists {
 		return fmt.Errorf("device %s not found", deviceID)
 	}
@@ -173,7 +358,7 @@ func (dm *Manager) SetColor(ctx context.Context, deviceID string, hue, saturatio
 		"saturation", saturation,
 	)
 
-	if err := dm.mqttServer.Publish(topic, data, false, 0); err != nil {
+	if err := dm.publishCommand(deviceID, topic, data); err != nil {
 		return fmt.Errorf("failed to publish color command: %w", err)
 	}
 
@@ -182,7 +367,7 @@ func (dm *Manager) SetColor(ctx context.Context, deviceID string, hue, saturatio
 
 // SetColorTemp sets the color temperature of a light via MQTT.
 func (dm *Manager) SetColorTemp(ctx context.Context, deviceID string, colorTemp int) error {
-	info, exists := dm.devices[deviceID]
+	info, exists := dm.deviceInfos()[deviceID]
 	if !exists {
 		return fmt.Errorf("device %s not found", deviceID)
 	}
@@ -202,13 +387,52 @@ func (dm *Manager) SetColorTemp(ctx context.Context, deviceID string, colorTemp
 		"color_temp", colorTemp,
 	)
 
-	if err := dm.mqttServer.Publish(topic, data, false, 0); err != nil {
+	if err := dm.publishCommand(deviceID, topic, data); err != nil {
 		return fmt.Errorf("failed to publish color temp command: %w", err)
 	}
 
 	return nil
 }
 
+// SetFanSpeed sets the speed of a fan via MQTT. Devices with fan_mode presets
+// receive the nearest preset, others receive a numeric fan_speed.
+func (dm *Manager) SetFanSpeed(ctx context.Context, deviceID string, speed int) error {
+	info, exists := dm.deviceInfos()[deviceID]
+	if !exists {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+
+	speed = ClampPercentage(speed)
+	topic := fmt.Sprintf("zigbee2mqtt/%s/set", info.Config.Topic)
+	payload := map[string]interface{}{}
+	if info.Config.UsesFanModes() {
+		mode := NearestFanMode(info.Config.FanModes(), speed)
+		if mode == "" {
+			return fmt.Errorf("device %s has no usable fan modes", deviceID)
+		}
+		payload["fan_mode"] = mode
+	} else {
+		payload["fan_speed"] = speed
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal command: %w", err)
+	}
+
+	dm.logger.Info("Sending fan speed command",
+		"device_id", deviceID,
+		"topic", topic,
+		"speed", speed,
+		"payload", string(data),
+	)
+
+	if err := dm.publishCommand(deviceID, topic, data); err != nil {
+		return fmt.Errorf("failed to publish fan speed command: %w", err)
+	}
+
+	return nil
+}
+
 // ProcessCommands handles command events from HAP/Web.
 func (dm *Manager) ProcessCommands(ctx context.Context) {
 	for {
@@ -221,7 +445,43 @@ func (dm *Manager) ProcessCommands(ctx context.Context) {
 	}
 }
 
+// SubmitCommand queues a command to be applied in order with HAP and web
+// commands. It does not block; ErrCommandQueueFull is returned if the
+// queue is full.
+func (dm *Manager) SubmitCommand(cmd CommandEvent) error {
+	if _, ok := dm.deviceInfos()[cmd.DeviceID]; !ok {
+		return fmt.Errorf("device %s not found", cmd.DeviceID)
+	}
+	if dm.DeviceDisabled(cmd.DeviceID) {
+		return ErrDeviceDisabled
+	}
+
+	if !dm.tryQueueCommand(cmd) {
+		return ErrCommandQueueFull
+	}
+	return nil
+}
+
+// tryQueueCommand logs and queues cmd without blocking, reporting false
+// if the queue is full.
+func (dm *Manager) tryQueueCommand(cmd CommandEvent) bool {
+	cmd = dm.logCommand(cmd)
+	select {
+	case dm.commands <- cmd:
+		return true
+	default:
+		dm.commandDone(cmd)
+		return false
+	}
+}
+
 func (dm *Manager) processCommand(ctx context.Context, cmd CommandEvent) {
+	defer func() {
+		if !dm.holdLogged(cmd) {
+			dm.commandDone(cmd)
+		}
+	}()
+
 	if cmd.On != nil {
 		if err := dm.SetPower(ctx, cmd.DeviceID, *cmd.On); err != nil {
 			dm.logger.Error("Failed to process power command",
@@ -238,6 +498,60 @@ func (dm *Manager) processCommand(ctx context.Context, cmd CommandEvent) {
 			)
 		}
 	}
+	if cmd.Dim != nil {
+		var err error
+		if *cmd.Dim == 0 {
+			err = dm.StopDimming(ctx, cmd.DeviceID)
+		} else {
+			err = dm.StartDimming(ctx, cmd.DeviceID, *cmd.Dim > 0)
+		}
+		if err != nil {
+			dm.logger.Error("Failed to process dimming command",
+				"device_id", cmd.DeviceID,
+				"error", err,
+			)
+		}
+	}
+	if cmd.FanSpeed != nil {
+		if err := dm.SetFanSpeed(ctx, cmd.DeviceID, *cmd.FanSpeed); err != nil {
+			dm.logger.Error("Failed to process fan speed command",
+				"device_id", cmd.DeviceID,
+				"error", err,
+			)
+		}
+	}
+	if cmd.Position != nil {
+		if err := dm.SetCoverPosition(ctx, cmd.DeviceID, *cmd.Position); err != nil {
+			dm.logger.Error("Failed to process cover position command",
+				"device_id", cmd.DeviceID,
+				"error", err,
+			)
+		}
+	}
+	if cmd.Tilt != nil {
+		if err := dm.SetCoverTilt(ctx, cmd.DeviceID, *cmd.Tilt); err != nil {
+			dm.logger.Error("Failed to process cover tilt command",
+				"device_id", cmd.DeviceID,
+				"error", err,
+			)
+		}
+	}
+	if cmd.ArmMode != nil {
+		if err := dm.SetArmMode(ctx, cmd.DeviceID, *cmd.ArmMode); err != nil {
+			dm.logger.Error("Failed to process arm mode command",
+				"device_id", cmd.DeviceID,
+				"error", err,
+			)
+		}
+	}
+	if cmd.Siren != nil {
+		if err := dm.SetSiren(ctx, cmd.DeviceID, *cmd.Siren); err != nil {
+			dm.logger.Error("Failed to process siren command",
+				"device_id", cmd.DeviceID,
+				"error", err,
+			)
+		}
+	}
 	if cmd.Hue != nil && cmd.Saturation != nil {
 		if err := dm.SetColor(ctx, cmd.DeviceID, *cmd.Hue, *cmd.Saturation); err != nil {
 			dm.logger.Error("Failed to process color command",
@@ -261,72 +575,142 @@ func (dm *Manager) ProcessStateEvents(ctx context.Context) {
 	for {
 		select {
 		case event := <-dm.stateSubscriber.Events():
-			dm.mu.Lock()
-			state, exists := dm.states[event.DeviceID]
-			if !exists {
-				dm.mu.Unlock()
-				dm.logger.Warn("Received state event for unknown device", "device_id", event.DeviceID)
-				continue
-			}
+			dm.ApplyStateChange(ctx, event)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ApplyStateChange merges a state change into the device's state and
+// publishes the result, raising any alerts it causes. ProcessStateEvents
+// calls it for each event from the bus; event replay calls it directly.
+func (dm *Manager) ApplyStateChange(ctx context.Context, event StateChangedEvent) {
+	dm.mu.Lock()
+	state, exists := dm.states[event.DeviceID]
+	if !exists {
+		dm.mu.Unlock()
+		dm.logger.Warn("Received state event for unknown device", "device_id", event.DeviceID)
+		return
+	}
+	if _, disabled := dm.disabled[event.DeviceID]; disabled {
+		dm.mu.Unlock()
+		dm.logger.Debug("Ignoring state event for disabled device", "device_id", event.DeviceID)
+		return
+	}
 
-			if len(event.UpdatedFields) > 0 {
-				// Selective update based on what changed
-				for _, field := range event.UpdatedFields {
-					switch field {
-					case "On":
-						state.On = event.State.On
-					case "Brightness":
-						state.Brightness = event.State.Brightness
-					case "Hue":
-						state.Hue = event.State.Hue
-					case "Saturation":
-						state.Saturation = event.State.Saturation
-					case "ColorTemp":
-						state.ColorTemp = event.State.ColorTemp
-					case "Temperature":
-						state.Temperature = event.State.Temperature
-					case "Humidity":
-						state.Humidity = event.State.Humidity
-					case "Battery":
-						state.Battery = event.State.Battery
-					case "Occupancy":
-						state.Occupancy = event.State.Occupancy
-					case "Illuminance":
-						state.Illuminance = event.State.Illuminance
-					case "Pressure":
-						state.Pressure = event.State.Pressure
-					case "Contact":
-						state.Contact = event.State.Contact
-					case "WaterLeak":
-						state.WaterLeak = event.State.WaterLeak
-					case "Smoke":
-						state.Smoke = event.State.Smoke
-					case "Tamper":
-						state.Tamper = event.State.Tamper
-					case "FanSpeed":
-						state.FanSpeed = event.State.FanSpeed
-					case "LinkQuality":
-						state.LinkQuality = event.State.LinkQuality
-					case "LastSeen":
-						state.LastSeen = event.State.LastSeen
-					case "LastUpdated":
-						state.LastUpdated = event.State.LastUpdated
+	hadAnomalies := len(state.Anomalies) > 0
+	var warnings []ClimateWarning
+	var humidity *float64 // an accepted humidity reading
+	before := *state
+	if len(event.UpdatedFields) > 0 {
+		// Selective update based on what changed
+		for _, field := range event.UpdatedFields {
+			switch field {
+			case "On":
+				state.On = event.State.On
+			case "Brightness":
+				state.Brightness = event.State.Brightness
+			case "Hue":
+				state.Hue = event.State.Hue
+			case "Saturation":
+				state.Saturation = event.State.Saturation
+			case "ColorTemp":
+				state.ColorTemp = event.State.ColorTemp
+			case "Temperature":
+				if dm.acceptReading(state, field, event.State.Temperature) {
+					state.Temperature = event.State.Temperature
+					if state.Temperature != nil {
+						warnings = evaluateClimate(dm.deviceInfos()[event.DeviceID].Config, state, *state.Temperature)
 					}
 				}
+			case "Humidity":
+				if dm.acceptReading(state, field, event.State.Humidity) {
+					state.Humidity = event.State.Humidity
+					humidity = state.Humidity
+				}
+			case "Battery":
+				state.Battery = event.State.Battery
+			case "Occupancy":
+				state.Occupancy = event.State.Occupancy
+			case "Illuminance":
+				state.Illuminance = event.State.Illuminance
+			case "Pressure":
+				if dm.acceptReading(state, field, event.State.Pressure) {
+					state.Pressure = event.State.Pressure
+					dm.observePressure(state)
+				}
+			case "Contact":
+				state.Contact = event.State.Contact
+			case "WaterLeak":
+				state.WaterLeak = event.State.WaterLeak
+			case "Smoke":
+				state.Smoke = event.State.Smoke
+			case "Tamper":
+				state.Tamper = event.State.Tamper
+			case "Power":
+				state.Power = event.State.Power
+			case "Voltage":
+				state.Voltage = event.State.Voltage
+			case "Current":
+				state.Current = event.State.Current
+			case "Energy":
+				state.Energy = event.State.Energy
+			case "FanSpeed":
+				state.FanSpeed = event.State.FanSpeed
+			case "Position":
+				state.Position = event.State.Position
+			case "Tilt":
+				state.Tilt = event.State.Tilt
+			case "Calibrating":
+				state.Calibrating = event.State.Calibrating
+			case "TravelTime":
+				state.TravelTime = event.State.TravelTime
+			case "MotorReversed":
+				state.MotorReversed = event.State.MotorReversed
+			case "ArmMode":
+				state.ArmMode = event.State.ArmMode
+			case "Siren":
+				state.Siren = event.State.Siren
+			case "Update":
+				// A requested update shows until zigbee2mqtt starts it
+				// or answers the request.
+				if !state.Update.InProgress() || event.State.Update.InProgress() {
+					state.Update = event.State.Update
+				}
+			case "LinkQuality":
+				state.LinkQuality = event.State.LinkQuality
+			case "LastSeen":
+				state.LastSeen = event.State.LastSeen
+				dm.health.ObserveReport(event.DeviceID, state.LastSeen)
+			case "LastUpdated":
+				state.LastUpdated = event.State.LastUpdated
 			}
+		}
+	}
 
-			stateCopy := *state
-			dm.mu.Unlock()
-
-			dm.logger.Debug("Merged state from eventbus",
-				"device_id", event.DeviceID,
-				"updated_fields", event.UpdatedFields,
-			)
-			dm.publishStateUpdate("eventbus", event.DeviceID, stateCopy)
+	dm.confirmCalibration(event.DeviceID, *state)
+	if !event.testFire {
+		dm.observeRealAlarm(event)
+	}
+	stateCopy := *state
+	dm.mu.Unlock()
 
-		case <-ctx.Done():
-			return
-		}
+	dm.logger.Debug("Merged state from eventbus",
+		"device_id", event.DeviceID,
+		"updated_fields", event.UpdatedFields,
+	)
+	dm.publishStateUpdate("eventbus", event.DeviceID, stateCopy)
+	dm.checkLinkQuality(event.DeviceID, stateCopy)
+	if hasAnomalies := len(stateCopy.Anomalies) > 0; hasAnomalies != hadAnomalies {
+		dm.publishAnomalyAlert(stateCopy)
+	}
+	for _, w := range warnings {
+		dm.publishClimateAlert(stateCopy, w)
+	}
+	dm.checkSensorAlert(ctx, event.DeviceID, before, stateCopy)
+	if humidity != nil {
+		dm.checkHumidityFans(event.DeviceID, *humidity, dm.Now())
 	}
 }
 
@@ -341,28 +725,43 @@ func (dm *Manager) Snapshot() map[string]struct {
 	result := make(map[string]struct {
 		Device Device
 		State  State
-	}, len(dm.devices))
+	}, len(dm.deviceInfos()))
 
-	for id, info := range dm.devices {
+	now := dm.Now()
+	for id, info := range dm.deviceInfos() {
 		state := dm.states[id]
+		stateCopy := *state
+		stateCopy.Health = dm.health.Score(id, stateCopy, now)
+		stateCopy.Lockout = dm.lockout(id)
+		stateCopy.Ack = dm.alertAck(id, now)
+		stateCopy.TestFire = dm.testFire(id)
+		stateCopy.Calibration = dm.coverCalibration(id, now)
+		stateCopy.Disabled = dm.disabledSince(id)
 		result[id] = struct {
 			Device Device
 			State  State
 		}{
 			Device: info.Config,
-			State:  *state,
+			State:  stateCopy,
 		}
 	}
 
 	return result
 }
 
+// DeviceCount returns the number of managed devices.
+func (dm *Manager) DeviceCount() int {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	return len(dm.deviceInfos())
+}
+
 // Device returns the device info and state for the given ID.
 func (dm *Manager) Device(deviceID string) (Device, State, bool) {
 	dm.mu.RLock()
 	defer dm.mu.RUnlock()
 
-	info, ok := dm.devices[deviceID]
+	info, ok := dm.deviceInfos()[deviceID]
 	if !ok {
 		return Device{}, State{}, false
 	}
@@ -372,7 +771,14 @@ func (dm *Manager) Device(deviceID string) (Device, State, bool) {
 		return Device{}, State{}, false
 	}
 
-	return info.Config, *state, true
+	stateCopy := *state
+	stateCopy.Health = dm.health.Score(deviceID, stateCopy, dm.Now())
+	stateCopy.Lockout = dm.lockout(deviceID)
+	stateCopy.Ack = dm.alertAck(deviceID, dm.Now())
+	stateCopy.TestFire = dm.testFire(deviceID)
+	stateCopy.Calibration = dm.coverCalibration(deviceID, dm.Now())
+	stateCopy.Disabled = dm.disabledSince(deviceID)
+	return info.Config, stateCopy, true
 }
 
 // DeviceByTopic returns the device info for the given topic.
@@ -380,7 +786,7 @@ func (dm *Manager) DeviceByTopic(topic string) (Device, bool) {
 	dm.mu.RLock()
 	defer dm.mu.RUnlock()
 
-	for _, info := range dm.devices {
+	for _, info := range dm.deviceInfos() {
 		if info.Config.Topic == topic {
 			return info.Config, true
 		}
@@ -389,18 +795,61 @@ func (dm *Manager) DeviceByTopic(topic string) (Device, bool) {
 	return Device{}, false
 }
 
+// HandleDeviceLeft reports that a device left the Zigbee network, so
+// consumers drop what they hold for it until it reports again.
+func (dm *Manager) HandleDeviceLeft(deviceID string) {
+	device, _, ok := dm.Device(deviceID)
+	if !ok {
+		return
+	}
+
+	dm.logger.Info("Device left the Zigbee network", "device_id", deviceID)
+	dm.publishRegistryChange(deviceID, device.Name, events.DeviceRegistryRemoved, "")
+}
+
 func (dm *Manager) publishStateUpdate(source, deviceID string, state State) {
 	if dm.eventBus == nil || dm.stateEventClient == nil {
 		return
 	}
 
-	info, ok := dm.devices[deviceID]
+	dm.eventBus.PublishStateUpdate(dm.stateEventClient, dm.stateUpdateEvent(source, deviceID, state))
+}
+
+// StateUpdate returns the device's current state in the normalized form
+// published on the eventbus.
+func (dm *Manager) StateUpdate(deviceID string) (events.StateUpdateEvent, bool) {
+	dm.mu.RLock()
+	state, ok := dm.states[deviceID]
+	var stateCopy State
+	if ok {
+		stateCopy = *state
+	}
+	dm.mu.RUnlock()
+	if !ok {
+		return events.StateUpdateEvent{}, false
+	}
+	return dm.stateUpdateEvent("snapshot", deviceID, stateCopy), true
+}
+
+// stateUpdateEvent converts a device state to the normalized event form.
+func (dm *Manager) stateUpdateEvent(source, deviceID string, state State) events.StateUpdateEvent {
+	info, ok := dm.deviceInfos()[deviceID]
 	name := deviceID
 	if ok {
 		name = info.Config.Name
 	}
 
-	connectionState, connectionNote := connectionStatus(state.LastSeen)
+	connectionState, connectionNote := ConnectionStatus(state.LastSeen, dm.Now())
+
+	dm.mu.RLock()
+	acknowledged := dm.alertAck(deviceID, dm.Now()) != nil
+	if dm.z2mOffline {
+		connectionState, connectionNote = "disconnected", "zigbee2mqtt is offline"
+	}
+	if _, disabled := dm.disabled[deviceID]; disabled {
+		connectionState, connectionNote = "disconnected", "Disabled"
+	}
+	dm.mu.RUnlock()
 
 	// Convert brightness to HAP scale for events
 	var brightnessHAP *int
@@ -409,45 +858,263 @@ func (dm *Manager) publishStateUpdate(source, deviceID string, state State) {
 		brightnessHAP = &b
 	}
 
-	dm.eventBus.PublishStateUpdate(dm.stateEventClient, events.StateUpdateEvent{
-		Timestamp:       time.Now(),
-		Source:          source,
-		DeviceID:        deviceID,
-		Name:            name,
-		On:              state.On,
-		Brightness:      brightnessHAP,
-		Hue:             state.Hue,
-		Saturation:      state.Saturation,
-		ColorTemp:       state.ColorTemp,
-		Temperature:     state.Temperature,
-		Humidity:        state.Humidity,
-		Battery:         state.Battery,
-		Occupancy:       state.Occupancy,
-		Illuminance:     state.Illuminance,
-		Pressure:        state.Pressure,
-		Contact:         state.Contact,
-		WaterLeak:       state.WaterLeak,
-		Smoke:           state.Smoke,
-		Tamper:          state.Tamper,
-		FanSpeed:        state.FanSpeed,
-		LinkQuality:     state.LinkQuality,
-		LastSeen:        state.LastSeen,
-		LastUpdated:     state.LastUpdated,
-		ConnectionState: connectionState,
-		ConnectionNote:  connectionNote,
+	var updateState string
+	var updateProgress *float64
+	var updateRemaining *int
+	if u := state.Update; u != nil {
+		updateState, updateProgress, updateRemaining = u.State, u.Progress, u.Remaining
+	}
+
+	return events.StateUpdateEvent{
+		Timestamp:         dm.Now(),
+		Source:            source,
+		DeviceID:          deviceID,
+		Name:              name,
+		On:                state.On,
+		Brightness:        brightnessHAP,
+		Hue:               state.Hue,
+		Saturation:        state.Saturation,
+		ColorTemp:         state.ColorTemp,
+		Temperature:       state.Temperature,
+		Humidity:          state.Humidity,
+		Battery:           state.Battery,
+		Occupancy:         state.Occupancy,
+		Illuminance:       state.Illuminance,
+		Pressure:          state.Pressure,
+		PressureTrend:     string(state.PressureTrend),
+		PressureChange:    state.PressureChange,
+		Forecast:          state.PressureForecast,
+		FrostWarning:      state.FrostWarning,
+		HeatWarning:       state.HeatWarning,
+		AlertAcknowledged: acknowledged,
+		Contact:           state.Contact,
+		WaterLeak:         state.WaterLeak,
+		Smoke:             state.Smoke,
+		Tamper:            state.Tamper,
+		Power:             state.Power,
+		Voltage:           state.Voltage,
+		Current:           state.Current,
+		Energy:            state.Energy,
+		FanSpeed:          state.FanSpeed,
+		Position:          state.Position,
+		Tilt:              state.Tilt,
+		Calibrating:       state.Calibrating,
+		TravelTime:        state.TravelTime,
+		MotorReversed:     state.MotorReversed,
+		ArmMode:           armMode(state.ArmMode),
+		Siren:             state.Siren,
+		UpdateState:       updateState,
+		UpdateProgress:    updateProgress,
+		UpdateRemaining:   updateRemaining,
+		LinkQuality:       state.LinkQuality,
+		LastSeen:          state.LastSeen,
+		LastUpdated:       state.LastUpdated,
+		ConnectionState:   connectionState,
+		ConnectionNote:    connectionNote,
+	}
+}
+
+// publishAlert emits an alert. Non-critical alerts are marked silenced
+// while night mode is on, so they are tracked but not announced.
+func (dm *Manager) publishAlert(event events.AlertEvent) {
+	if event.Active && !criticalAlert(event.Kind) && dm.NightModeActive() {
+		event.Silenced = true
+	}
+	dm.eventBus.PublishAlert(dm.stateEventClient, event)
+}
+
+// lockout returns the valve lockout for a device, if any. Callers must hold
+// dm.mu.
+func (dm *Manager) lockout(deviceID string) *Lockout {
+	l, ok := dm.lockouts[deviceID]
+	if !ok {
+		return nil
+	}
+	return &l
+}
+
+// publishCommand sends a command to a device's set topic and records it
+// for the device's health score.
+func (dm *Manager) publishCommand(deviceID, topic string, data []byte) error {
+	if dm.DeviceDisabled(deviceID) {
+		return ErrDeviceDisabled
+	}
+	if queued, err := dm.queueCommand(deviceID, topic, data); queued {
+		return err
+	}
+	return dm.sendCommand(deviceID, topic, data)
+}
+
+// sendCommand publishes a command to zigbee2mqtt, bypassing the queue of
+// commands held while it is offline.
+func (dm *Manager) sendCommand(deviceID, topic string, data []byte) error {
+	err := dm.mqttServer.Publish(topic, data, false, 0)
+	dm.health.ObserveCommand(deviceID, err == nil, dm.Now())
+	return err
+}
+
+// acceptReading checks a sensor reading for anomalies and records the
+// result on the state. Anomalous readings are rejected so the last good
+// value stays in place. Callers must hold dm.mu.
+func (dm *Manager) acceptReading(state *State, field string, value *float64) bool {
+	if value == nil {
+		return true
+	}
+
+	reason := dm.anomalies.Check(state.ID, field, *value)
+	if _, flagged := state.Anomalies[field]; reason == "" && !flagged {
+		return true
+	}
+
+	// Copy on write: snapshots share the map with the stored state.
+	anomalies := maps.Clone(state.Anomalies)
+	if anomalies == nil {
+		anomalies = make(map[string]string)
+	}
+	if reason == "" {
+		delete(anomalies, field)
+	} else {
+		anomalies[field] = reason
+		dm.logger.Warn("Rejected anomalous sensor reading",
+			"device_id", state.ID,
+			"field", field,
+			"value", *value,
+			"reason", reason,
+		)
+	}
+	if len(anomalies) == 0 {
+		anomalies = nil
+	}
+	state.Anomalies = anomalies
+
+	return reason == ""
+}
+
+func (dm *Manager) publishAnomalyAlert(state State) {
+	if dm.eventBus == nil || dm.stateEventClient == nil {
+		return
+	}
+
+	message := "Sensor readings back to normal"
+	if len(state.Anomalies) > 0 {
+		reasons := slices.Sorted(maps.Values(state.Anomalies))
+		message = strings.Join(reasons, "; ")
+	}
+
+	dm.publishAlert(events.AlertEvent{
+		Timestamp: dm.Now(),
+		DeviceID:  state.ID,
+		Name:      state.Name,
+		Kind:      events.AlertKindAnomaly,
+		Active:    len(state.Anomalies) > 0,
+		Message:   message,
+	})
+}
+
+func (dm *Manager) publishClimateAlert(state State, w ClimateWarning) {
+	kind := events.AlertKindFrost
+	message := fmt.Sprintf("Temperature %.1f °C below %.1f °C", w.Temperature, w.Threshold)
+	if w.Kind == "heat" {
+		kind = events.AlertKindHeat
+		message = fmt.Sprintf("Temperature %.1f °C above %.1f °C", w.Temperature, w.Threshold)
+	}
+	if !w.Active {
+		message = fmt.Sprintf("Temperature back to %.1f °C", w.Temperature)
+	}
+
+	dm.logger.Info("Climate warning changed",
+		"device_id", state.ID,
+		"kind", w.Kind,
+		"active", w.Active,
+		"temperature", w.Temperature,
+		"threshold", w.Threshold,
+	)
+
+	if dm.eventBus == nil || dm.stateEventClient == nil {
+		return
+	}
+
+	dm.publishAlert(events.AlertEvent{
+		Timestamp: dm.Now(),
+		DeviceID:  state.ID,
+		Name:      state.Name,
+		Kind:      kind,
+		Active:    w.Active,
+		Message:   message,
+	})
+}
+
+// observePressure updates the pressure trend and forecast from a new
+// reading. Callers must hold dm.mu.
+func (dm *Manager) observePressure(state *State) {
+	if state.Pressure == nil {
+		return
+	}
+
+	report, ok := dm.pressure.Observe(state.ID, *state.Pressure, dm.Now())
+	if !ok {
+		return
+	}
+
+	state.PressureTrend = report.Trend
+	state.PressureChange = &report.Change
+	state.PressureForecast = report.Forecast
+}
+
+func (dm *Manager) checkLinkQuality(deviceID string, state State) {
+	transition, changed := dm.linkQuality.Observe(deviceID, state.LinkQuality, dm.Now())
+	if !changed || dm.eventBus == nil || dm.stateEventClient == nil {
+		return
+	}
+
+	var message string
+	if transition.Active {
+		message = fmt.Sprintf("Link quality %d below %d since %s",
+			transition.Value, dm.linkQuality.Threshold(), transition.Since.Format(time.RFC3339))
+		dm.logger.Warn("Weak link quality",
+			"device_id", deviceID,
+			"link_quality", transition.Value,
+			"threshold", dm.linkQuality.Threshold(),
+			"since", transition.Since,
+		)
+	} else {
+		message = fmt.Sprintf("Link quality recovered to %d", transition.Value)
+		dm.logger.Info("Link quality recovered",
+			"device_id", deviceID,
+			"link_quality", transition.Value,
+		)
+	}
+
+	dm.publishAlert(events.AlertEvent{
+		Timestamp: dm.Now(),
+		DeviceID:  deviceID,
+		Name:      state.Name,
+		Kind:      events.AlertKindLinkQuality,
+		Active:    transition.Active,
+		Message:   message,
 	})
 }
 
-func connectionStatus(lastSeen time.Time) (string, string) {
+// Devices count as connected while seen within ConnectedWithin, stale
+// while seen within StaleWithin, and disconnected after.
+const (
+	ConnectedWithin = 30 * time.Second
+	StaleWithin     = 60 * time.Second
+)
+
+// ConnectionStatus returns a device's connection state ("connected",
+// "stale" or "disconnected") at now, given when it was last seen, with a
+// note for display.
+func ConnectionStatus(lastSeen, now time.Time) (string, string) {
 	if lastSeen.IsZero() {
 		return "disconnected", "Never seen"
 	}
 
-	since := time.Since(lastSeen)
+	since := now.Sub(lastSeen)
 	switch {
-	case since < 30*time.Second:
+	case since < ConnectedWithin:
 		return "connected", fmt.Sprintf("Last seen: %s ago", since.Round(time.Second))
-	case since < 60*time.Second:
+	case since < StaleWithin:
 		return "stale", fmt.Sprintf("Last seen: %s ago", since.Round(time.Second))
 	default:
 		return "disconnected", fmt.Sprintf("Last seen: %s ago", since.Round(time.Second))
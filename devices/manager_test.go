@@ -0,0 +1,43 @@
+package devices
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+// newTestManager returns a manager of configs on a fresh event bus, and
+// the bus. Commands go to pub, or to an embedded broker when pub is nil.
+func newTestManager(t *testing.T, configs []Device, commands chan CommandEvent, pub Publisher) (*Manager, *events.Bus) {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	bus, err := events.New(logger)
+	if err != nil {
+		t.Fatalf("events.New: %v", err)
+	}
+	t.Cleanup(func() { _ = bus.Close() })
+
+	if pub == nil {
+		pub = newTestBroker(t)
+	}
+	dm, err := NewManager(configs, commands, bus, pub, logger)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	return dm, bus
+}
+
+// newTestBroker returns an embedded broker, for tests subscribing to the
+// commands a manager sends.
+func newTestBroker(t *testing.T) *mqtt.Server {
+	t.Helper()
+
+	server := mqtt.New(&mqtt.Options{InlineClient: true, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	t.Cleanup(func() { _ = server.Close() })
+	return server
+}
@@ -0,0 +1,221 @@
+package devices
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+// nightModeCheckInterval is how often the night mode schedule is evaluated.
+const nightModeCheckInterval = 30 * time.Second
+
+// NightMode changes how the bridge behaves at night. It is switched by its
+// schedule, from HomeKit or from the web UI; a manual switch lasts until the
+// next scheduled change.
+type NightMode struct {
+	// Start and End are local times ("22:30", "06:30") between which night
+	// mode is on. Leave both empty to only switch it manually.
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+
+	// MaxBrightness caps the brightness in percent of the selected lights
+	// while night mode is on. 0 disables the cap.
+	MaxBrightness int `json:"max_brightness,omitempty"`
+	// Lights are the lightbulbs the cap applies to. Empty means all.
+	Lights []string `json:"lights,omitempty"`
+}
+
+// parseClock parses "15:04" into minutes after midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func validateNightMode(cfg *Config) error {
+	nm := cfg.NightMode
+	if nm == nil {
+		return nil
+	}
+
+	if (nm.Start == "") != (nm.End == "") {
+		return fmt.Errorf("night_mode: start and end must be set together")
+	}
+	if nm.Start != "" {
+		if _, err := parseClock(nm.Start); err != nil {
+			return fmt.Errorf("night_mode: start: %w", err)
+		}
+		if _, err := parseClock(nm.End); err != nil {
+			return fmt.Errorf("night_mode: end: %w", err)
+		}
+	}
+	if nm.MaxBrightness < 0 || nm.MaxBrightness > 100 {
+		return fmt.Errorf("night_mode: max_brightness %d out of range 0-100", nm.MaxBrightness)
+	}
+
+	for _, id := range nm.Lights {
+		if !slices.ContainsFunc(cfg.Devices, func(d Device) bool { return d.ID == id && d.Type == DeviceTypeLightbulb }) {
+			return fmt.Errorf("night_mode: light %q is not a configured lightbulb", id)
+		}
+	}
+
+	return nil
+}
+
+// scheduled reports whether the schedule puts night mode on at now. Windows
+// may wrap midnight.
+func (nm *NightMode) scheduled(now time.Time) (on, ok bool) {
+	if nm.Start == "" {
+		return false, false
+	}
+	start, _ := parseClock(nm.Start)
+	end, _ := parseClock(nm.End)
+	minute := now.Hour()*60 + now.Minute()
+
+	if start <= end {
+		return minute >= start && minute < end, true
+	}
+	return minute >= start || minute < end, true
+}
+
+// SetNightModeConfig enables night mode. nil disables it.
+func (dm *Manager) SetNightModeConfig(nm *NightMode) {
+	dm.mu.Lock()
+	dm.nightMode = nm
+	dm.nightOverride = nil
+	dm.nightActive = false
+	dm.mu.Unlock()
+
+	dm.evaluateNightMode(dm.Now())
+}
+
+// NightModeConfigured reports whether night mode is available.
+func (dm *Manager) NightModeConfigured() bool {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	return dm.nightMode != nil
+}
+
+// NightModeActive reports whether night mode is currently on.
+func (dm *Manager) NightModeActive() bool {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	return dm.nightActive
+}
+
+// OnNightModeChange registers a function called whenever night mode is
+// switched on or off, e.g. to update the HomeKit switch.
+func (dm *Manager) OnNightModeChange(fn func(active bool)) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.nightHooks = append(dm.nightHooks, fn)
+}
+
+// SetNightMode switches night mode manually. The choice holds until the
+// schedule next changes.
+func (dm *Manager) SetNightMode(on bool) error {
+	return dm.setNightMode(on, dm.Now())
+}
+
+func (dm *Manager) setNightMode(on bool, now time.Time) error {
+	dm.mu.Lock()
+	if dm.nightMode == nil {
+		dm.mu.Unlock()
+		return fmt.Errorf("night mode is not configured")
+	}
+	scheduled, _ := dm.nightMode.scheduled(now)
+	dm.nightOverride = &on
+	dm.nightOverrideFrom = scheduled
+	dm.mu.Unlock()
+
+	dm.logger.Info("Night mode switched manually", "on", on)
+	dm.evaluateNightMode(now)
+	return nil
+}
+
+// RunNightMode follows the night mode schedule until ctx is done.
+func (dm *Manager) RunNightMode(ctx context.Context) {
+	ticker := time.NewTicker(nightModeCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			dm.evaluateNightMode(dm.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// evaluateNightMode applies the schedule and any manual override, and runs
+// the hooks if night mode changed.
+func (dm *Manager) evaluateNightMode(now time.Time) {
+	dm.mu.Lock()
+	if dm.nightMode == nil {
+		dm.mu.Unlock()
+		return
+	}
+
+	active, scheduled := dm.nightActive, false
+	if on, ok := dm.nightMode.scheduled(now); ok {
+		scheduled = on
+		active = on
+	}
+	if dm.nightOverride != nil {
+		// A manual switch lasts until the schedule moves on.
+		if on, ok := dm.nightMode.scheduled(now); ok && on != dm.nightOverrideFrom {
+			dm.nightOverride = nil
+		} else {
+			active = *dm.nightOverride
+		}
+	}
+
+	changed := active != dm.nightActive
+	dm.nightActive = active
+	hooks := slices.Clone(dm.nightHooks)
+	dm.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	dm.logger.Info("Night mode changed", "active", active, "scheduled", scheduled)
+	for _, fn := range hooks {
+		fn(active)
+	}
+}
+
+// nightBrightnessCap returns the brightness cap in percent for a light, or
+// 0 when none applies.
+func (dm *Manager) nightBrightnessCap(deviceID string) int {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+
+	nm := dm.nightMode
+	if nm == nil || !dm.nightActive || nm.MaxBrightness == 0 {
+		return 0
+	}
+	if dm.deviceInfos()[deviceID].Config.Type != DeviceTypeLightbulb {
+		return 0
+	}
+	if len(nm.Lights) > 0 && !slices.Contains(nm.Lights, deviceID) {
+		return 0
+	}
+	return nm.MaxBrightness
+}
+
+// criticalAlert reports whether an alert kind is still reported while night
+// mode silences notifications.
+func criticalAlert(kind events.AlertKind) bool {
+	switch kind {
+	case events.AlertKindLeak, events.AlertKindSmoke, events.AlertKindContact:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package devices
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+func TestValidateNightMode(t *testing.T) {
+	devices := []Device{
+		{ID: "lamp", Type: DeviceTypeLightbulb},
+		{ID: "plug", Type: DeviceTypeOutlet},
+	}
+
+	tests := []struct {
+		name    string
+		nm      *NightMode
+		wantErr bool
+	}{
+		{"unset", nil, false},
+		{"manual only", &NightMode{MaxBrightness: 20}, false},
+		{"schedule", &NightMode{Start: "22:30", End: "06:30", Lights: []string{"lamp"}}, false},
+		{"start without end", &NightMode{Start: "22:30"}, true},
+		{"bad time", &NightMode{Start: "25:00", End: "06:00"}, true},
+		{"cap range", &NightMode{MaxBrightness: 120}, true},
+		{"outlet light", &NightMode{Lights: []string{"plug"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateNightMode(&Config{Devices: devices, NightMode: tt.nm})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateNightMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNightModeSchedule(t *testing.T) {
+	nm := &NightMode{Start: "22:00", End: "06:30"}
+	at := func(h, m int) time.Time { return time.Date(2024, 1, 1, h, m, 0, 0, time.Local) }
+
+	for _, tt := range []struct {
+		at   time.Time
+		want bool
+	}{
+		{at(21, 59), false},
+		{at(22, 0), true},
+		{at(2, 0), true},
+		{at(6, 29), true},
+		{at(6, 30), false},
+		{at(12, 0), false},
+	} {
+		if got, _ := nm.scheduled(tt.at); got != tt.want {
+			t.Errorf("scheduled(%s) = %v, want %v", tt.at.Format("15:04"), got, tt.want)
+		}
+	}
+
+	if _, ok := (&NightMode{}).scheduled(at(23, 0)); ok {
+		t.Error("manual-only night mode reported a schedule")
+	}
+}
+
+func TestNightModeOverrideAndCap(t *testing.T) {
+	dm, _ := newTestManager(t, []Device{
+		{ID: "bedroom", Name: "Bedroom", Type: DeviceTypeLightbulb},
+		{ID: "hall", Name: "Hall", Type: DeviceTypeLightbulb},
+	}, nil, nil)
+
+	var changes []bool
+	dm.OnNightModeChange(func(active bool) { changes = append(changes, active) })
+	dm.SetNightModeConfig(&NightMode{Start: "22:00", End: "06:00", MaxBrightness: 15, Lights: []string{"bedroom"}})
+
+	at := func(h int) time.Time { return time.Date(2024, 1, 1, h, 0, 0, 0, time.Local) }
+
+	// Start from daytime regardless of when the test runs.
+	dm.evaluateNightMode(at(12))
+	changes = nil
+
+	dm.evaluateNightMode(at(23))
+	if !dm.NightModeActive() {
+		t.Fatal("night mode off during scheduled window")
+	}
+	if got := dm.nightBrightnessCap("bedroom"); got != 15 {
+		t.Errorf("bedroom cap = %d, want 15", got)
+	}
+	if got := dm.nightBrightnessCap("hall"); got != 0 {
+		t.Errorf("hall cap = %d, want none", got)
+	}
+
+	// A manual switch holds through the window and ends at its close.
+	if err := dm.setNightMode(false, at(23)); err != nil {
+		t.Fatalf("setNightMode: %v", err)
+	}
+	dm.evaluateNightMode(at(2))
+	if dm.NightModeActive() {
+		t.Error("manual off did not hold within the window")
+	}
+	dm.evaluateNightMode(at(7))
+	dm.evaluateNightMode(at(22))
+	if !dm.NightModeActive() {
+		t.Error("schedule did not resume after the manual switch")
+	}
+
+	want := []bool{true, false, true}
+	if len(changes) != len(want) {
+		t.Fatalf("hook calls = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("hook calls = %v, want %v", changes, want)
+			break
+		}
+	}
+
+	if !criticalAlert(events.AlertKindSmoke) || criticalAlert(events.AlertKindLinkQuality) {
+		t.Error("smoke must stay critical and link quality must not")
+	}
+}
+
+func TestNightModeCapsDimming(t *testing.T) {
+	pub := &recordingPublisher{}
+	dm, _ := newTestManager(t, []Device{{ID: "bedroom", Name: "Bedroom", Topic: "bedroom", Type: DeviceTypeLightbulb}}, nil, pub)
+	dm.SetNightModeConfig(&NightMode{MaxBrightness: 15})
+	if err := dm.SetNightMode(true); err != nil {
+		t.Fatalf("SetNightMode: %v", err)
+	}
+
+	ctx := context.Background()
+	for _, up := range []bool{true, false} {
+		if err := dm.StartDimming(ctx, "bedroom", up); err != nil {
+			t.Fatalf("StartDimming(up=%v): %v", up, err)
+		}
+	}
+
+	want := []string{
+		fmt.Sprintf(`zigbee2mqtt/bedroom/set {"brightness":%d}`, HAPBrightnessToZ2M(15)),
+		fmt.Sprintf(`zigbee2mqtt/bedroom/set {"brightness_move":%d}`, -DimRate),
+	}
+	if len(pub.messages) != len(want) || pub.messages[0] != want[0] || pub.messages[1] != want[1] {
+		t.Errorf("published %q, want %q", pub.messages, want)
+	}
+}
@@ -0,0 +1,191 @@
+package devices
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// OTAUpdateTopic is where zigbee2mqtt takes requests to update a device's
+// firmware over the air.
+const OTAUpdateTopic = "zigbee2mqtt/bridge/request/device/ota_update/update"
+
+// OTAUpdateResponseTopic is where zigbee2mqtt answers an update request,
+// once the update has finished or failed.
+const OTAUpdateResponseTopic = "zigbee2mqtt/bridge/response/device/ota_update/update"
+
+// ErrUpdateInProgress is returned when a firmware update is requested for
+// a device already updating.
+var ErrUpdateInProgress = errors.New("firmware update already in progress")
+
+// Firmware update states. All but UpdateRequested are reported by
+// zigbee2mqtt in a device's update field; UpdateRequested lasts from
+// asking for an update until zigbee2mqtt reports progress.
+const (
+	UpdateIdle      = "idle"
+	UpdateAvailable = "available"
+	UpdateScheduled = "scheduled"
+	UpdateRequested = "requested"
+	UpdateUpdating  = "updating"
+)
+
+// FirmwareUpdate is a device's OTA firmware update state.
+type FirmwareUpdate struct {
+	State     string
+	Progress  *float64 // percent, while updating
+	Remaining *int     // seconds, while updating
+}
+
+// InProgress reports whether an update has been requested and not yet
+// finished.
+func (u *FirmwareUpdate) InProgress() bool {
+	return u != nil && (u.State == UpdateRequested || u.State == UpdateUpdating)
+}
+
+// FirmwareUpdateResult is how a firmware update ended.
+type FirmwareUpdateResult struct {
+	DeviceID string
+	Name     string
+	From, To string // software build IDs, when zigbee2mqtt reports them
+	Err      error  // nil when the update succeeded
+}
+
+// UpdateFirmware asks zigbee2mqtt to update a device's firmware. It
+// returns once the request is sent; progress is reported in the device's
+// state and the result to the OnFirmwareUpdate hooks.
+func (dm *Manager) UpdateFirmware(deviceID string) error {
+	info, ok := dm.deviceInfos()[deviceID]
+	if !ok {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+
+	data, err := json.Marshal(map[string]string{"id": info.Config.Topic})
+	if err != nil {
+		return err
+	}
+
+	dm.mu.Lock()
+	state := dm.states[deviceID]
+	if _, disabled := dm.disabled[deviceID]; disabled {
+		dm.mu.Unlock()
+		return ErrDeviceDisabled
+	}
+	if dm.z2mOffline {
+		dm.mu.Unlock()
+		return ErrZ2MOffline
+	}
+	if state.Update.InProgress() {
+		dm.mu.Unlock()
+		return ErrUpdateInProgress
+	}
+	previous := state.Update
+	state.Update = &FirmwareUpdate{State: UpdateRequested}
+	stateCopy := *state
+	dm.mu.Unlock()
+
+	if err := dm.mqttServer.Publish(OTAUpdateTopic, data, false, 0); err != nil {
+		dm.mu.Lock()
+		state.Update = previous
+		dm.mu.Unlock()
+		return fmt.Errorf("failed to request firmware update: %w", err)
+	}
+
+	dm.logger.Info("Firmware update requested", "device_id", deviceID)
+	dm.publishStateUpdate("ota", deviceID, stateCopy)
+	return nil
+}
+
+// OnFirmwareUpdate registers a function called when a firmware update
+// finishes or fails, e.g. to log it.
+func (dm *Manager) OnFirmwareUpdate(fn func(FirmwareUpdateResult)) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.otaHooks = append(dm.otaHooks, fn)
+}
+
+// HandleFirmwareUpdateResponse handles zigbee2mqtt's answer to an update
+// request, published on OTAUpdateResponseTopic.
+func (dm *Manager) HandleFirmwareUpdateResponse(payload []byte) {
+	var resp struct {
+		Data struct {
+			ID   string           `json:"id"`
+			From *firmwareVersion `json:"from"`
+			To   *firmwareVersion `json:"to"`
+		} `json:"data"`
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}
+	if err := json.Unmarshal(payload, &resp); err != nil {
+		dm.logger.Debug("Failed to parse firmware update response", "error", err)
+		return
+	}
+
+	deviceID, ok := dm.firmwareUpdateDevice(resp.Data.ID)
+	if !ok {
+		dm.logger.Debug("Firmware update response for unknown device", "id", resp.Data.ID)
+		return
+	}
+
+	result := FirmwareUpdateResult{DeviceID: deviceID, Name: dm.deviceInfos()[deviceID].Config.Name}
+	if resp.Data.From != nil {
+		result.From = resp.Data.From.SoftwareBuildID
+	}
+	if resp.Data.To != nil {
+		result.To = resp.Data.To.SoftwareBuildID
+	}
+	if resp.Status != "ok" {
+		result.Err = errors.New(resp.Error)
+		if resp.Error == "" {
+			result.Err = errors.New("update failed")
+		}
+	}
+
+	dm.mu.Lock()
+	state := dm.states[deviceID]
+	state.Update = &FirmwareUpdate{State: UpdateIdle}
+	if result.Err != nil {
+		// The update is still there to try again.
+		state.Update.State = UpdateAvailable
+	}
+	stateCopy := *state
+	hooks := slices.Clone(dm.otaHooks)
+	dm.mu.Unlock()
+
+	if result.Err != nil {
+		dm.logger.Warn("Firmware update failed", "device_id", deviceID, "error", result.Err)
+	} else {
+		dm.logger.Info("Firmware updated", "device_id", deviceID, "from", result.From, "to", result.To)
+	}
+	dm.publishStateUpdate("ota", deviceID, stateCopy)
+	for _, fn := range hooks {
+		fn(result)
+	}
+}
+
+// firmwareVersion is a device's firmware in an update response.
+type firmwareVersion struct {
+	SoftwareBuildID string `json:"software_build_id"`
+}
+
+// firmwareUpdateDevice returns the device an update response is for. Some
+// zigbee2mqtt versions leave the ID out of failures; those go to the
+// device updating, when only one is.
+func (dm *Manager) firmwareUpdateDevice(id string) (string, bool) {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+
+	var updating []string
+	for deviceID, info := range dm.deviceInfos() {
+		if id != "" && (info.Config.Topic == id || info.Config.ID == id) {
+			return deviceID, true
+		}
+		if dm.states[deviceID].Update.InProgress() {
+			updating = append(updating, deviceID)
+		}
+	}
+	if id == "" && len(updating) == 1 {
+		return updating[0], true
+	}
+	return "", false
+}
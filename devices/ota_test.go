@@ -0,0 +1,97 @@
+package devices
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+func TestUpdateFirmware(t *testing.T) {
+	server := newTestBroker(t)
+
+	var mu sync.Mutex
+	var sent []string
+	err := server.Subscribe(OTAUpdateTopic, 1, func(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+		mu.Lock()
+		sent = append(sent, string(pk.Payload))
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	dm, _ := newTestManager(t, []Device{
+		{ID: "lamp", Name: "Lamp", Topic: "Living room/Lamp", Type: DeviceTypeLightbulb},
+		{ID: "plug", Name: "Plug", Topic: "plug", Type: DeviceTypeOutlet},
+	}, nil, server)
+	var results []FirmwareUpdateResult
+	dm.OnFirmwareUpdate(func(r FirmwareUpdateResult) { results = append(results, r) })
+
+	update := func(deviceID string, u FirmwareUpdate) {
+		dm.ApplyStateChange(t.Context(), StateChangedEvent{DeviceID: deviceID, State: State{Update: &u}, UpdatedFields: []string{"Update"}})
+	}
+	updateState := func(deviceID string) string {
+		_, state, _ := dm.Device(deviceID)
+		if state.Update == nil {
+			return ""
+		}
+		return state.Update.State
+	}
+
+	update("lamp", FirmwareUpdate{State: UpdateAvailable})
+	if err := dm.UpdateFirmware("lamp"); err != nil {
+		t.Fatalf("UpdateFirmware: %v", err)
+	}
+	if err := dm.UpdateFirmware("lamp"); !errors.Is(err, ErrUpdateInProgress) {
+		t.Errorf("second UpdateFirmware = %v, want ErrUpdateInProgress", err)
+	}
+	mu.Lock()
+	if len(sent) != 1 || sent[0] != `{"id":"Living room/Lamp"}` {
+		t.Errorf("update requests = %v", sent)
+	}
+	mu.Unlock()
+
+	// A report from before the update starts does not hide the request.
+	update("lamp", FirmwareUpdate{State: UpdateAvailable})
+	if got := updateState("lamp"); got != UpdateRequested {
+		t.Errorf("update state = %q, want requested", got)
+	}
+	update("lamp", FirmwareUpdate{State: UpdateUpdating, Progress: Ptr(42.5), Remaining: Ptr(300)})
+	if ev, _ := dm.StateUpdate("lamp"); ev.UpdateState != UpdateUpdating || ev.UpdateProgress == nil || *ev.UpdateProgress != 42.5 {
+		t.Errorf("state update = %q %v, want updating at 42.5%%", ev.UpdateState, ev.UpdateProgress)
+	}
+
+	dm.HandleFirmwareUpdateResponse([]byte(`{"data":{"id":"Living room/Lamp","from":{"software_build_id":"1.0"},"to":{"software_build_id":"1.1"}},"status":"ok"}`))
+	if got := updateState("lamp"); got != UpdateIdle {
+		t.Errorf("update state after success = %q, want idle", got)
+	}
+	if len(results) != 1 || results[0].DeviceID != "lamp" || results[0].Err != nil || results[0].From != "1.0" || results[0].To != "1.1" {
+		t.Errorf("results = %+v", results)
+	}
+
+	// Failures without an ID go to the only device updating.
+	if err := dm.UpdateFirmware("plug"); err != nil {
+		t.Fatalf("UpdateFirmware: %v", err)
+	}
+	dm.HandleFirmwareUpdateResponse([]byte(`{"data":{},"status":"error","error":"Update of 'plug' failed (timeout)"}`))
+	if got := updateState("plug"); got != UpdateAvailable {
+		t.Errorf("update state after failure = %q, want available", got)
+	}
+	if len(results) != 2 || results[1].DeviceID != "plug" || results[1].Err == nil {
+		t.Errorf("results = %+v", results)
+	}
+
+	if err := dm.SetDeviceDisabled("plug", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.UpdateFirmware("plug"); !errors.Is(err, ErrDeviceDisabled) {
+		t.Errorf("UpdateFirmware on a disabled device = %v, want ErrDeviceDisabled", err)
+	}
+	dm.SetZ2MOnline(false)
+	if err := dm.UpdateFirmware("lamp"); !errors.Is(err, ErrZ2MOffline) {
+		t.Errorf("UpdateFirmware while zigbee2mqtt is offline = %v, want ErrZ2MOffline", err)
+	}
+}
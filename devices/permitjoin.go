@@ -0,0 +1,76 @@
+package devices
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// PermitJoinTopic is where zigbee2mqtt takes requests to open the network
+// for new devices to join.
+const PermitJoinTopic = "zigbee2mqtt/bridge/request/permit_join"
+
+// MaxPermitJoin is the longest zigbee2mqtt opens the network for on one
+// request.
+const MaxPermitJoin = 254 * time.Second
+
+// PermitJoin opens the Zigbee network for new devices for d, or closes it
+// when d is 0.
+func (dm *Manager) PermitJoin(d time.Duration) error {
+	if d < 0 || d > MaxPermitJoin {
+		return fmt.Errorf("permit join time %s out of range 0-%s", d, MaxPermitJoin)
+	}
+	if !dm.Z2MOnline() {
+		return ErrZ2MOffline
+	}
+
+	seconds := int(d / time.Second)
+	// value is for zigbee2mqtt 1.x, which otherwise ignores time.
+	data, err := json.Marshal(map[string]any{"value": seconds > 0, "time": seconds})
+	if err != nil {
+		return err
+	}
+	if err := dm.mqttServer.Publish(PermitJoinTopic, data, false, 0); err != nil {
+		return fmt.Errorf("failed to publish permit join: %w", err)
+	}
+
+	dm.mu.Lock()
+	dm.permitJoinUntil = time.Time{}
+	if seconds > 0 {
+		dm.permitJoinUntil = dm.Now().Add(time.Duration(seconds) * time.Second)
+	}
+	dm.mu.Unlock()
+
+	dm.logger.Info("Permit join requested", "duration", d)
+	return nil
+}
+
+// PermitJoinRemaining returns how much longer the network is open for new
+// devices, 0 when it is closed.
+func (dm *Manager) PermitJoinRemaining() time.Duration {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	return max(0, dm.permitJoinUntil.Sub(dm.Now()))
+}
+
+// OnDeviceJoined registers a function called with the friendly name and
+// IEEE address of each device joining the network.
+func (dm *Manager) OnDeviceJoined(fn func(friendlyName, ieeeAddress string)) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.joinHooks = append(dm.joinHooks, fn)
+}
+
+// HandleDeviceJoined reports a device joining the Zigbee network, from a
+// zigbee2mqtt/bridge/event device_joined message.
+func (dm *Manager) HandleDeviceJoined(friendlyName, ieeeAddress string) {
+	dm.mu.RLock()
+	hooks := slices.Clone(dm.joinHooks)
+	dm.mu.RUnlock()
+
+	dm.logger.Info("Device joined the Zigbee network", "friendly_name", friendlyName, "ieee_address", ieeeAddress)
+	for _, fn := range hooks {
+		fn(friendlyName, ieeeAddress)
+	}
+}
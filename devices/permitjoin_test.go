@@ -0,0 +1,70 @@
+package devices
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+func TestPermitJoin(t *testing.T) {
+	server := newTestBroker(t)
+
+	var mu sync.Mutex
+	var sent []string
+	err := server.Subscribe(PermitJoinTopic, 1, func(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+		mu.Lock()
+		sent = append(sent, string(pk.Payload))
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	dm, _ := newTestManager(t, []Device{{ID: "plug", Name: "Plug", Topic: "plug", Type: DeviceTypeOutlet}}, nil, server)
+
+	if err := dm.PermitJoin(2 * time.Minute); err != nil {
+		t.Fatalf("PermitJoin: %v", err)
+	}
+	if got := dm.PermitJoinRemaining(); got <= 119*time.Second || got > 2*time.Minute {
+		t.Errorf("PermitJoinRemaining() = %s, want about 2m", got)
+	}
+	// The window runs on the manager's clock.
+	clock := NewSimClock()
+	dm.SetClock(clock)
+	clock.Warp(time.Minute)
+	if got := dm.PermitJoinRemaining(); got <= 59*time.Second || got > time.Minute {
+		t.Errorf("PermitJoinRemaining() a simulated minute later = %s, want about 1m", got)
+	}
+	if err := dm.PermitJoin(0); err != nil {
+		t.Fatalf("PermitJoin(0): %v", err)
+	}
+	if got := dm.PermitJoinRemaining(); got != 0 {
+		t.Errorf("PermitJoinRemaining() after closing = %s", got)
+	}
+	if err := dm.PermitJoin(5 * time.Minute); err == nil {
+		t.Error("PermitJoin beyond 254s succeeded")
+	}
+
+	mu.Lock()
+	want := []string{`{"time":120,"value":true}`, `{"time":0,"value":false}`}
+	if len(sent) != len(want) || sent[0] != want[0] || sent[1] != want[1] {
+		t.Errorf("permit join requests = %v, want %v", sent, want)
+	}
+	mu.Unlock()
+
+	dm.SetZ2MOnline(false)
+	if err := dm.PermitJoin(time.Minute); !errors.Is(err, ErrZ2MOffline) {
+		t.Errorf("PermitJoin while zigbee2mqtt is offline = %v, want ErrZ2MOffline", err)
+	}
+
+	var joined []string
+	dm.OnDeviceJoined(func(name, ieee string) { joined = append(joined, name+" "+ieee) })
+	dm.HandleDeviceJoined("new-plug", "0x00158d0009")
+	if len(joined) != 1 || joined[0] != "new-plug 0x00158d0009" {
+		t.Errorf("joined = %v", joined)
+	}
+}
@@ -0,0 +1,145 @@
+package devices
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// PressureTrend is the barometric tendency over the last three hours.
+type PressureTrend string
+
+const (
+	PressureTrendUnknown PressureTrend = ""
+	PressureTrendRising  PressureTrend = "rising"
+	PressureTrendFalling PressureTrend = "falling"
+	PressureTrendSteady  PressureTrend = "steady"
+)
+
+const (
+	// pressureWindow is the standard period for barometric tendency.
+	pressureWindow = 3 * time.Hour
+	// pressureMinSpan is how much history is needed before a trend is
+	// reported. Shorter spans are extrapolated to three hours.
+	pressureMinSpan = time.Hour
+	// pressureSteadyBand is the three hour change in hPa below which
+	// pressure is considered steady.
+	pressureSteadyBand = 1.0
+	// pressureRapidChange is the three hour change in hPa that marks a
+	// rapid rise or fall.
+	pressureRapidChange = 3.5
+	// pressureSampleInterval is the least time between recorded samples,
+	// which bounds the history of chatty sensors.
+	pressureSampleInterval = 5 * time.Minute
+)
+
+// PressureReport summarises a device's recent pressure history.
+type PressureReport struct {
+	Trend    PressureTrend
+	Change   float64 // hPa per three hours
+	Forecast string
+}
+
+type pressureSample struct {
+	at    time.Time
+	value float64
+}
+
+// PressureHistory keeps recent pressure readings per device to derive a
+// trend and a simple forecast.
+type PressureHistory struct {
+	mu      sync.Mutex
+	samples map[string][]pressureSample
+}
+
+// NewPressureHistory creates an empty history.
+func NewPressureHistory() *PressureHistory {
+	return &PressureHistory{samples: make(map[string][]pressureSample)}
+}
+
+// Observe takes a reading in hPa, changed or not, and returns the updated
+// report. Readings are recorded at most every pressureSampleInterval; the
+// others only update the report. ok is false until enough history has
+// been collected.
+func (h *PressureHistory) Observe(deviceID string, hPa float64, now time.Time) (PressureReport, bool) {
+	if math.IsNaN(hPa) || math.IsInf(hPa, 0) {
+		return PressureReport{}, false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	samples := h.samples[deviceID]
+	if n := len(samples); n == 0 || now.Sub(samples[n-1].at) >= pressureSampleInterval {
+		samples = append(samples, pressureSample{at: now, value: hPa})
+	}
+	cutoff := now.Add(-pressureWindow)
+	drop := 0
+	for drop < len(samples)-1 && samples[drop].at.Before(cutoff) {
+		drop++
+	}
+	samples = samples[drop:]
+	h.samples[deviceID] = samples
+
+	oldest := samples[0]
+	span := now.Sub(oldest.at)
+	if span < pressureMinSpan {
+		return PressureReport{}, false
+	}
+
+	change := (hPa - oldest.value) * float64(pressureWindow) / float64(span)
+	return PressureReport{
+		Trend:    pressureTrend(change),
+		Change:   math.Round(change*10) / 10,
+		Forecast: pressureForecast(hPa, change),
+	}, true
+}
+
+func pressureTrend(change float64) PressureTrend {
+	switch {
+	case change >= pressureSteadyBand:
+		return PressureTrendRising
+	case change <= -pressureSteadyBand:
+		return PressureTrendFalling
+	default:
+		return PressureTrendSteady
+	}
+}
+
+// pressureForecast gives a short outlook from the current pressure and its
+// three hour change, along the lines of a classic barometer dial.
+func pressureForecast(hPa, change float64) string {
+	switch {
+	case change <= -pressureRapidChange:
+		return "Stormy"
+	case change <= -pressureSteadyBand:
+		if hPa < 1005 {
+			return "Rain likely"
+		}
+		return "Becoming unsettled"
+	case change >= pressureRapidChange:
+		return "Clearing, windy"
+	case change >= pressureSteadyBand:
+		return "Improving"
+	case hPa >= 1022:
+		return "Fair"
+	case hPa < 1000:
+		return "Unsettled"
+	default:
+		return "No change"
+	}
+}
+
+// Symbol returns an arrow for the trend, for compact display.
+func (t PressureTrend) Symbol() string {
+	switch t {
+	case PressureTrendRising:
+		return "↑"
+	case PressureTrendFalling:
+		return "↓"
+	case PressureTrendSteady:
+		return "→"
+	default:
+		return ""
+	}
+}
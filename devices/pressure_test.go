@@ -0,0 +1,102 @@
+package devices
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPressureHistory(t *testing.T) {
+	h := NewPressureHistory()
+	start := time.Date(2025, 1, 1, 6, 0, 0, 0, time.UTC)
+
+	if _, ok := h.Observe("dev", 1015, start); ok {
+		t.Fatal("report before any history")
+	}
+	if _, ok := h.Observe("dev", 1014, start.Add(30*time.Minute)); ok {
+		t.Fatal("report before an hour of history")
+	}
+
+	report, ok := h.Observe("dev", 1013, start.Add(time.Hour))
+	if !ok {
+		t.Fatal("no report after an hour of history")
+	}
+	// 2 hPa in one hour extrapolates to 6 hPa over three.
+	if report.Trend != PressureTrendFalling || report.Change != -6 || report.Forecast != "Stormy" {
+		t.Errorf("report = %+v, want rapid fall", report)
+	}
+
+	// Readings older than three hours are dropped, leaving the 1013 hPa
+	// sample as the baseline.
+	report, _ = h.Observe("dev", 1013.3, start.Add(4*time.Hour))
+	if report.Trend != PressureTrendSteady || report.Forecast != "No change" {
+		t.Errorf("report = %+v, want steady", report)
+	}
+
+	if _, ok := h.Observe("other", 1000, start); ok {
+		t.Error("history leaked between devices")
+	}
+}
+
+func TestPressureHistorySampleInterval(t *testing.T) {
+	h := NewPressureHistory()
+	start := time.Date(2025, 1, 1, 6, 0, 0, 0, time.UTC)
+
+	// A sensor reporting the same pressure every minute.
+	var report PressureReport
+	var ok bool
+	for i := range 90 {
+		report, ok = h.Observe("dev", 1013, start.Add(time.Duration(i)*time.Minute))
+	}
+	if !ok || report.Trend != PressureTrendSteady {
+		t.Errorf("report = %+v, ok=%v; want steady", report, ok)
+	}
+	if n := len(h.samples["dev"]); n != 18 {
+		t.Errorf("recorded %d samples over 90 minutes, want one per %s (18)", n, pressureSampleInterval)
+	}
+}
+
+func TestManagerPressureUsesClock(t *testing.T) {
+	dm, _ := newTestManager(t, []Device{{ID: "climate", Name: "Climate", Type: DeviceTypeClimateSensor}}, nil, nil)
+	clock := NewSimClock()
+	dm.SetClock(clock)
+
+	// Unchanged reports an hour apart on the simulated clock are enough
+	// for a trend.
+	for range 2 {
+		hPa := 1013.0
+		dm.ApplyStateChange(context.Background(), StateChangedEvent{
+			DeviceID:      "climate",
+			State:         State{Pressure: &hPa},
+			UpdatedFields: []string{"Pressure"},
+		})
+		clock.Warp(time.Hour)
+	}
+
+	_, state, _ := dm.Device("climate")
+	if state.PressureTrend != PressureTrendSteady {
+		t.Errorf("trend = %q, want steady", state.PressureTrend)
+	}
+}
+
+func TestPressureForecast(t *testing.T) {
+	tests := []struct {
+		hPa, change float64
+		want        string
+	}{
+		{1010, -4, "Stormy"},
+		{1000, -2, "Rain likely"},
+		{1015, -2, "Becoming unsettled"},
+		{1010, 4, "Clearing, windy"},
+		{1010, 2, "Improving"},
+		{1025, 0, "Fair"},
+		{995, 0, "Unsettled"},
+		{1012, 0.5, "No change"},
+	}
+
+	for _, tt := range tests {
+		if got := pressureForecast(tt.hPa, tt.change); got != tt.want {
+			t.Errorf("pressureForecast(%v, %v) = %q, want %q", tt.hPa, tt.change, got, tt.want)
+		}
+	}
+}
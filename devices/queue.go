@@ -0,0 +1,269 @@
+package devices
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+const (
+	// CommandQueueLimit bounds how many fields are held per device while
+	// zigbee2mqtt is offline. Once full, the oldest field is dropped.
+	CommandQueueLimit = 16
+
+	// CommandQueueMaxAge drops held commands that would be surprising to
+	// apply late, e.g. a light switched on during a long outage.
+	CommandQueueMaxAge = 5 * time.Minute
+)
+
+// ErrZ2MOffline is returned for commands that cannot be held until
+// zigbee2mqtt returns, such as dimming.
+var ErrZ2MOffline = errors.New("zigbee2mqtt is offline")
+
+// ErrCommandQueueFull is returned when a command cannot be queued because
+// commands are arriving faster than they are applied.
+var ErrCommandQueueFull = errors.New("command queue full")
+
+// transientCommands are not held while zigbee2mqtt is offline; replaying a
+// dimming move minutes later would leave the light moving unexpectedly.
+var transientCommands = []string{"brightness_move"}
+
+// queuedField is a single held command field.
+type queuedField struct {
+	value json.RawMessage
+	at    time.Time
+}
+
+// commandQueue holds a device's commands while zigbee2mqtt is offline.
+// Fields are merged so the latest value for each wins.
+type commandQueue struct {
+	topic  string
+	fields map[string]queuedField
+	seqs   []uint64 // logged commands held, completed once flushed
+}
+
+func (q *commandQueue) add(payload map[string]json.RawMessage, now time.Time) {
+	for field, value := range payload {
+		q.fields[field] = queuedField{value: value, at: now}
+	}
+	for len(q.fields) > CommandQueueLimit {
+		oldest := slices.MinFunc(slices.Collect(maps.Keys(q.fields)), func(a, b string) int {
+			return q.fields[a].at.Compare(q.fields[b].at)
+		})
+		delete(q.fields, oldest)
+	}
+}
+
+// payload returns the fields held no longer than CommandQueueMaxAge.
+func (q *commandQueue) payload(now time.Time) map[string]json.RawMessage {
+	payload := make(map[string]json.RawMessage, len(q.fields))
+	for field, f := range q.fields {
+		if now.Sub(f.at) <= CommandQueueMaxAge {
+			payload[field] = f.value
+		}
+	}
+	return payload
+}
+
+// Z2MOnline reports whether zigbee2mqtt is available. It is assumed online
+// until zigbee2mqtt reports otherwise.
+func (dm *Manager) Z2MOnline() bool {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	return !dm.z2mOffline
+}
+
+// PendingCommands returns how many command fields are held for a device
+// while zigbee2mqtt is offline.
+func (dm *Manager) PendingCommands(deviceID string) int {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	if q, ok := dm.queued[deviceID]; ok {
+		return len(q.fields)
+	}
+	return 0
+}
+
+// SetZ2MOnline records zigbee2mqtt's availability, as reported on
+// zigbee2mqtt/bridge/state. While it is offline every device is reported
+// disconnected. Commands held while it was offline are sent when it
+// returns, from a goroutine of their own: this is called from the
+// broker's publish hook, which must not publish.
+func (dm *Manager) SetZ2MOnline(online bool) {
+	if online {
+		dm.z2mOnce.Do(func() { close(dm.z2mSeen) })
+	}
+
+	dm.mu.Lock()
+	if dm.z2mOffline == !online {
+		dm.mu.Unlock()
+		return
+	}
+	dm.z2mOffline = !online
+	queued := len(dm.queued)
+	flush := online && queued > 0 && !dm.flushing
+	if flush {
+		dm.flushing = true
+	}
+	dm.mu.Unlock()
+
+	if !online {
+		dm.logger.Warn("zigbee2mqtt is offline, holding commands")
+		dm.publishAvailability("z2m_offline")
+		return
+	}
+
+	dm.logger.Info("zigbee2mqtt is online", "queued_devices", queued)
+	if flush {
+		go dm.flushHeld()
+	}
+	dm.publishAvailability("z2m_online")
+}
+
+// flushHeld sends the commands held while zigbee2mqtt was offline. New
+// commands keep being held until it is done, so they cannot be overtaken
+// by older ones. It stops early if zigbee2mqtt goes offline again.
+func (dm *Manager) flushHeld() {
+	for {
+		dm.mu.Lock()
+		queued := dm.queued
+		if dm.z2mOffline || len(queued) == 0 {
+			dm.flushing = false
+			dm.mu.Unlock()
+			return
+		}
+		dm.queued = nil
+		dm.mu.Unlock()
+
+		dm.flushQueued(queued, dm.Now())
+	}
+}
+
+// publishAvailability publishes every device's state so consumers see
+// zigbee2mqtt going away or returning at once, rather than as each
+// device's last seen time ages.
+func (dm *Manager) publishAvailability(source string) {
+	dm.mu.RLock()
+	states := make(map[string]State, len(dm.states))
+	for id, state := range dm.states {
+		states[id] = *state
+	}
+	dm.mu.RUnlock()
+
+	for _, deviceID := range slices.Sorted(maps.Keys(states)) {
+		dm.publishStateUpdate(source, deviceID, states[deviceID])
+	}
+}
+
+func (dm *Manager) flushQueued(queued map[string]*commandQueue, now time.Time) {
+	for _, deviceID := range slices.Sorted(maps.Keys(queued)) {
+		q := queued[deviceID]
+		payload := q.payload(now)
+		if dropped := len(q.fields) - len(payload); dropped > 0 {
+			dm.logger.Warn("Dropping stale queued commands",
+				"device_id", deviceID,
+				"dropped", dropped,
+			)
+		}
+		if len(payload) == 0 {
+			dm.queuedDone(q)
+			continue
+		}
+
+		data, err := json.Marshal(payload)
+		if err != nil {
+			dm.logger.Error("Failed to marshal queued commands", "device_id", deviceID, "error", err)
+			continue
+		}
+
+		dm.logger.Info("Sending queued commands",
+			"device_id", deviceID,
+			"topic", q.topic,
+			"fields", slices.Sorted(maps.Keys(payload)),
+		)
+		err = ErrDeviceDisabled
+		if !dm.DeviceDisabled(deviceID) {
+			err = dm.sendCommand(deviceID, q.topic, data)
+		}
+		if err != nil {
+			dm.errorPublisher.Publish(ErrorEvent{
+				DeviceID: deviceID,
+				Error:    fmt.Errorf("failed to publish queued commands: %w", err),
+			})
+		}
+		dm.queuedDone(q)
+	}
+}
+
+// queuedDone marks the logged commands held in q as completed.
+func (dm *Manager) queuedDone(q *commandQueue) {
+	for _, seq := range q.seqs {
+		dm.commandDone(CommandEvent{seq: seq})
+	}
+}
+
+// holdLogged keeps a logged command pending in the command log while it is
+// held for zigbee2mqtt, so a crash during an outage does not lose it. It
+// reports false if the command was not held.
+func (dm *Manager) holdLogged(cmd CommandEvent) bool {
+	if cmd.seq == 0 {
+		return false
+	}
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	q, ok := dm.queued[cmd.DeviceID]
+	if !dm.holding() || !ok {
+		return false
+	}
+	q.seqs = append(q.seqs, cmd.seq)
+	return true
+}
+
+// holding reports whether commands are held rather than sent: while
+// zigbee2mqtt is offline, and while the commands held meanwhile are being
+// sent. Callers must hold dm.mu.
+func (dm *Manager) holding() bool {
+	return dm.z2mOffline || dm.flushing
+}
+
+// queueCommand holds a command while zigbee2mqtt is offline or held
+// commands are being sent. It reports false if the command should be sent
+// now.
+func (dm *Manager) queueCommand(deviceID, topic string, data []byte) (bool, error) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	if !dm.holding() {
+		return false, nil
+	}
+
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return true, fmt.Errorf("failed to queue command: %w", err)
+	}
+	for _, field := range transientCommands {
+		if _, ok := payload[field]; ok {
+			return true, ErrZ2MOffline
+		}
+	}
+
+	if dm.queued == nil {
+		dm.queued = make(map[string]*commandQueue)
+	}
+	q, ok := dm.queued[deviceID]
+	if !ok {
+		q = &commandQueue{topic: topic, fields: make(map[string]queuedField)}
+		dm.queued[deviceID] = q
+	}
+	q.add(payload, dm.Now())
+
+	dm.logger.Info("Queued command while zigbee2mqtt is offline",
+		"device_id", deviceID,
+		"pending", len(q.fields),
+	)
+	return true, nil
+}
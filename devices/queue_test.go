@@ -0,0 +1,157 @@
+package devices
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"tailscale.com/util/eventbus"
+)
+
+func TestCommandQueueAdd(t *testing.T) {
+	start := time.Now()
+	q := &commandQueue{fields: make(map[string]queuedField)}
+
+	q.add(map[string]json.RawMessage{"state": json.RawMessage(`"ON"`)}, start)
+	q.add(map[string]json.RawMessage{"state": json.RawMessage(`"OFF"`), "brightness": json.RawMessage(`10`)}, start.Add(time.Second))
+	if got := string(q.fields["state"].value); got != `"OFF"` {
+		t.Errorf("state = %s, want latest OFF", got)
+	}
+
+	for i := range CommandQueueLimit {
+		q.add(map[string]json.RawMessage{string(rune('a' + i)): json.RawMessage(`1`)}, start.Add(time.Duration(i+2)*time.Second))
+	}
+	if len(q.fields) != CommandQueueLimit {
+		t.Errorf("queue holds %d fields, want %d", len(q.fields), CommandQueueLimit)
+	}
+	if _, ok := q.fields["state"]; ok {
+		t.Error("oldest field should have been dropped")
+	}
+
+	if got := q.payload(start.Add(CommandQueueMaxAge + 3*time.Second)); len(got) != CommandQueueLimit-1 {
+		t.Errorf("payload after max age has %d fields, want %d", len(got), CommandQueueLimit-1)
+	}
+}
+
+func TestOfflineCommandQueue(t *testing.T) {
+	server := newTestBroker(t)
+
+	var mu sync.Mutex
+	var sent []map[string]any
+	err := server.Subscribe("zigbee2mqtt/+/set", 1, func(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+		var msg map[string]any
+		_ = json.Unmarshal(pk.Payload, &msg)
+		mu.Lock()
+		sent = append(sent, msg)
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	dm, _ := newTestManager(t, []Device{
+		{ID: "lamp", Name: "Lamp", Topic: "lamp", Type: DeviceTypeLightbulb},
+	}, nil, server)
+
+	ctx := context.Background()
+	dm.SetZ2MOnline(false)
+	if err := dm.SetPower(ctx, "lamp", true); err != nil {
+		t.Fatalf("SetPower while offline: %v", err)
+	}
+	if err := dm.SetBrightness(ctx, "lamp", 50); err != nil {
+		t.Fatalf("SetBrightness while offline: %v", err)
+	}
+	if err := dm.SetPower(ctx, "lamp", false); err != nil {
+		t.Fatalf("SetPower while offline: %v", err)
+	}
+	if err := dm.StartDimming(ctx, "lamp", true); !errors.Is(err, ErrZ2MOffline) {
+		t.Errorf("dimming while offline: err = %v, want ErrZ2MOffline", err)
+	}
+	if n := dm.PendingCommands("lamp"); n != 2 {
+		t.Errorf("PendingCommands = %d, want 2", n)
+	}
+
+	mu.Lock()
+	if len(sent) != 0 {
+		t.Errorf("sent %d commands while offline", len(sent))
+	}
+	mu.Unlock()
+
+	// The flush runs in the background; a command sent meanwhile is held
+	// with the rest rather than overtaken by them.
+	dm.SetZ2MOnline(true)
+	if err := dm.SetPower(ctx, "lamp", true); err != nil {
+		t.Fatalf("SetPower while flushing: %v", err)
+	}
+
+	flushing := func() bool {
+		dm.mu.RLock()
+		defer dm.mu.RUnlock()
+		return dm.flushing
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for flushing() {
+		if time.Now().After(deadline) {
+			t.Fatal("held commands still being sent")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := dm.PendingCommands("lamp"); n != 0 {
+		t.Errorf("PendingCommands after flush = %d", n)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) == 0 || len(sent) > 2 {
+		t.Fatalf("sent %d commands on flush, want the merged command and at most the new one", len(sent))
+	}
+	if sent[0]["brightness"] != float64(HAPBrightnessToZ2M(50)) {
+		t.Errorf("flushed command = %v, want the held brightness", sent[0])
+	}
+	if last := sent[len(sent)-1]; last["state"] != "ON" {
+		t.Errorf("last command = %v, want the lamp switched on last", last)
+	}
+}
+
+func TestZ2MOfflineSoonAfterReport(t *testing.T) {
+	dm, bus := newTestManager(t, []Device{{ID: "leak", Name: "Leak", Topic: "leak", Type: DeviceTypeLeakSensor}}, nil, nil)
+	bus.SetLivenessEvents(true)
+
+	observer, err := bus.Client(events.ClientMetrics)
+	if err != nil {
+		t.Fatalf("Client: %v", err)
+	}
+	updates := eventbus.Subscribe[events.StateUpdateEvent](observer)
+
+	dry := false
+	dm.ApplyStateChange(context.Background(), StateChangedEvent{
+		DeviceID:      "leak",
+		State:         State{WaterLeak: &dry, LastSeen: dm.Now()},
+		UpdatedFields: []string{"WaterLeak", "LastSeen"},
+	})
+	for evt := range updates.Events() {
+		if evt.Source != "initial" {
+			if evt.ConnectionState != "connected" {
+				t.Fatalf("report = %+v, want connected", evt)
+			}
+			break
+		}
+	}
+
+	// Well within DeviceSeenInterval of the report.
+	dm.SetZ2MOnline(false)
+	select {
+	case evt := <-updates.Events():
+		if evt.DeviceID != "leak" || evt.ConnectionState != "disconnected" {
+			t.Errorf("update = %+v, want the sensor disconnected", evt)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("zigbee2mqtt going offline did not take the sensor offline")
+	}
+}
@@ -0,0 +1,130 @@
+package devices
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+// DeviceChanges lists the devices SetDevices added, removed, renamed and
+// otherwise reconfigured, by ID.
+type DeviceChanges struct {
+	Added   []string
+	Removed []string
+	Renamed []string
+	Updated []string
+}
+
+// Empty reports whether nothing changed.
+func (c DeviceChanges) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Renamed) == 0 && len(c.Updated) == 0
+}
+
+// String summarises the changes, e.g. "added lamp; removed plug, sensor".
+func (c DeviceChanges) String() string {
+	if c.Empty() {
+		return "no device changes"
+	}
+	var parts []string
+	for _, kind := range []struct {
+		verb string
+		ids  []string
+	}{
+		{"added", c.Added},
+		{"removed", c.Removed},
+		{"renamed", c.Renamed},
+		{"updated", c.Updated},
+	} {
+		if len(kind.ids) > 0 {
+			parts = append(parts, kind.verb+" "+strings.Join(kind.ids, ", "))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// SetDevices replaces the managed devices while the bridge runs, e.g. when
+// the device config changes or a new Zigbee device is discovered. Devices
+// that remain keep their state. A registry event is published for every
+// device added, removed or renamed.
+func (dm *Manager) SetDevices(configs []Device) DeviceChanges {
+	var changes DeviceChanges
+	previous := make(map[string]Device)
+
+	dm.mu.Lock()
+	old := dm.deviceInfos()
+	infos := make(map[string]*Info, len(configs))
+	for _, device := range configs {
+		infos[device.ID] = &Info{Config: device}
+
+		prev, ok := old[device.ID]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, device.ID)
+			dm.states[device.ID] = newState(device, dm.Now())
+		case prev.Config.Name != device.Name:
+			changes.Renamed = append(changes.Renamed, device.ID)
+			previous[device.ID] = prev.Config
+			dm.states[device.ID].Name = device.Name
+		case !reflect.DeepEqual(prev.Config, device):
+			changes.Updated = append(changes.Updated, device.ID)
+		}
+	}
+	for id, info := range old {
+		if _, ok := infos[id]; ok {
+			continue
+		}
+		changes.Removed = append(changes.Removed, id)
+		previous[id] = info.Config
+		delete(dm.states, id)
+		delete(dm.queued, id)
+		delete(dm.lockouts, id)
+		delete(dm.acks, id)
+		if t, ok := dm.sirenTimers[id]; ok {
+			t.Stop()
+			delete(dm.sirenTimers, id)
+		}
+	}
+	dm.devices.Store(&infos)
+	dm.mu.Unlock()
+
+	slices.Sort(changes.Removed)
+
+	for _, device := range configs {
+		if slices.Contains(changes.Added, device.ID) {
+			dm.initDevice(device)
+			dm.publishRegistryChange(device.ID, device.Name, events.DeviceRegistryAdded, "")
+		}
+	}
+	for _, id := range changes.Renamed {
+		dm.logger.Info("Device renamed", "id", id, "from", previous[id].Name, "to", infos[id].Config.Name)
+		dm.publishRegistryChange(id, infos[id].Config.Name, events.DeviceRegistryRenamed, previous[id].Name)
+		dm.mu.RLock()
+		state := *dm.states[id]
+		dm.mu.RUnlock()
+		dm.publishStateUpdate("renamed", id, state)
+	}
+	for _, id := range changes.Removed {
+		dm.logger.Info("Removed device", "id", id, "name", previous[id].Name)
+		dm.publishRegistryChange(id, previous[id].Name, events.DeviceRegistryRemoved, "")
+	}
+	for _, id := range changes.Updated {
+		dm.logger.Info("Reconfigured device", "id", id, "name", infos[id].Config.Name)
+	}
+
+	return changes
+}
+
+func (dm *Manager) publishRegistryChange(deviceID, name string, change events.DeviceRegistryChange, previousName string) {
+	if dm.eventBus == nil || dm.stateEventClient == nil {
+		return
+	}
+	dm.eventBus.PublishDeviceRegistry(dm.stateEventClient, events.DeviceRegistryEvent{
+		Timestamp:    dm.Now(),
+		DeviceID:     deviceID,
+		Name:         name,
+		Change:       change,
+		PreviousName: previousName,
+	})
+}
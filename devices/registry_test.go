@@ -0,0 +1,77 @@
+package devices
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+	"tailscale.com/util/eventbus"
+)
+
+func TestSetDevices(t *testing.T) {
+	plug := Device{ID: "plug", Name: "Plug", Topic: "plug", Type: DeviceTypeOutlet}
+	lamp := Device{ID: "lamp", Name: "Lamp", Topic: "lamp", Type: DeviceTypeLightbulb}
+	sensor := Device{ID: "sensor", Name: "Sensor", Topic: "sensor", Type: DeviceTypeClimateSensor}
+
+	dm, bus := newTestManager(t, []Device{plug, lamp}, make(chan CommandEvent, 1), nil)
+
+	observer, err := bus.Client(events.ClientMetrics)
+	if err != nil {
+		t.Fatalf("bus.Client: %v", err)
+	}
+	registry := eventbus.Subscribe[events.DeviceRegistryEvent](observer)
+
+	on := true
+	dm.ApplyStateChange(t.Context(), StateChangedEvent{DeviceID: "plug", State: State{On: &on}, UpdatedFields: []string{"On"}})
+
+	renamed := plug
+	renamed.Name = "Kettle"
+	dimmable := lamp
+	dimmable.Features.Brightness = true
+	changes := dm.SetDevices([]Device{renamed, dimmable, sensor})
+
+	want := DeviceChanges{Added: []string{"sensor"}, Renamed: []string{"plug"}, Updated: []string{"lamp"}}
+	if !slices.Equal(changes.Added, want.Added) || !slices.Equal(changes.Renamed, want.Renamed) ||
+		!slices.Equal(changes.Updated, want.Updated) || len(changes.Removed) != 0 {
+		t.Errorf("changes = %+v, want %+v", changes, want)
+	}
+
+	if got := changes.String(); got != "added sensor; renamed plug; updated lamp" {
+		t.Errorf("changes.String() = %q", got)
+	}
+
+	device, state, ok := dm.Device("plug")
+	if !ok || device.Name != "Kettle" || state.Name != "Kettle" || state.On == nil || !*state.On {
+		t.Errorf("renamed plug = %+v, %+v, want renamed with its state kept", device, state)
+	}
+	if _, ok := dm.DeviceByTopic("sensor"); !ok {
+		t.Error("added sensor not found by topic")
+	}
+
+	changes = dm.SetDevices([]Device{sensor})
+	if !slices.Equal(changes.Removed, []string{"lamp", "plug"}) || len(changes.Added) != 0 {
+		t.Errorf("changes = %+v, want lamp and plug removed", changes)
+	}
+	if _, _, ok := dm.Device("plug"); ok {
+		t.Error("removed plug still managed")
+	}
+	if changes := dm.SetDevices([]Device{sensor}); !changes.Empty() {
+		t.Errorf("unchanged devices reported %+v", changes)
+	}
+
+	var got []string
+	timeout := time.After(time.Second)
+	for len(got) < 4 {
+		select {
+		case evt := <-registry.Events():
+			got = append(got, string(evt.Change)+":"+evt.DeviceID+":"+evt.PreviousName)
+		case <-timeout:
+			t.Fatalf("registry events = %v, want 4", got)
+		}
+	}
+	wantEvents := []string{"added:sensor:", "renamed:plug:Plug", "removed:lamp:", "removed:plug:"}
+	if !slices.Equal(got, wantEvents) {
+		t.Errorf("registry events = %v, want %v", got, wantEvents)
+	}
+}
@@ -0,0 +1,117 @@
+package devices
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Remote is a remote or controller whose buttons and actions are known, so
+// a button device needs only the remote's name instead of a buttons list.
+// The remotes report presses and battery in separate messages; a device
+// with a remote always has a battery. Action bindings of a device with a
+// remote must use actions the remote reports.
+type Remote string
+
+const (
+	// RemoteStyrbar is the IKEA STYRBAR remote, E2001, E2002 and E2313.
+	RemoteStyrbar Remote = "styrbar"
+	// RemoteTradfri is the round five button IKEA TRÅDFRI remote, E1524
+	// and E1810.
+	RemoteTradfri Remote = "tradfri_remote"
+	// RemoteTradfriOnOff is the two button IKEA TRÅDFRI on/off switch,
+	// E1743.
+	RemoteTradfriOnOff Remote = "tradfri_on_off"
+	// RemoteAqaraCube is the Aqara cube, MFKZQ01LM and the T1 Pro
+	// CTP-R01. Each gesture is a button; flipping by 90 degrees is its
+	// single and by 180 its double press.
+	RemoteAqaraCube Remote = "aqara_cube"
+)
+
+// remotes holds the buttons of each known remote, the actions it reports
+// besides its presses and releases, and the zigbee2mqtt models it is
+// discovered from. Holding a button reports a long press; the dimming
+// buttons of the on/off switch and STYRBAR share one release.
+var remotes = map[Remote]struct {
+	buttons []Button
+	extra   []string
+	models  []string
+}{
+	RemoteStyrbar: {
+		buttons: []Button{
+			{Name: "On", Single: "on", Long: "brightness_move_up", Release: "brightness_stop"},
+			{Name: "Off", Single: "off", Long: "brightness_move_down", Release: "brightness_stop"},
+			{Name: "Left", Single: "arrow_left_click", Long: "arrow_left_hold", Release: "arrow_left_release"},
+			{Name: "Right", Single: "arrow_right_click", Long: "arrow_right_hold", Release: "arrow_right_release"},
+		},
+		models: []string{"E2001/E2002", "E2001", "E2002", "E2313"},
+	},
+	RemoteTradfri: {
+		buttons: []Button{
+			{Name: "Toggle", Single: "toggle", Long: "toggle_hold"},
+			{Name: "Brighter", Single: "brightness_up_click", Long: "brightness_up_hold", Release: "brightness_up_release"},
+			{Name: "Dimmer", Single: "brightness_down_click", Long: "brightness_down_hold", Release: "brightness_down_release"},
+			{Name: "Left", Single: "arrow_left_click", Long: "arrow_left_hold", Release: "arrow_left_release"},
+			{Name: "Right", Single: "arrow_right_click", Long: "arrow_right_hold", Release: "arrow_right_release"},
+		},
+		models: []string{"E1524/E1810", "E1524", "E1810"},
+	},
+	RemoteTradfriOnOff: {
+		buttons: []Button{
+			{Name: "On", Single: "on", Long: "brightness_move_up", Release: "brightness_stop"},
+			{Name: "Off", Single: "off", Long: "brightness_move_down", Release: "brightness_stop"},
+		},
+		models: []string{"E1743"},
+	},
+	RemoteAqaraCube: {
+		buttons: []Button{
+			{Name: "Shake", Single: "shake"},
+			{Name: "Flip", Single: "flip90", Double: "flip180"},
+			{Name: "Slide", Single: "slide"},
+			{Name: "Tap", Single: "tap"},
+			{Name: "Rotate right", Single: "rotate_right"},
+			{Name: "Rotate left", Single: "rotate_left"},
+			{Name: "Fall", Single: "fall"},
+		},
+		// The T1 Pro also reports being thrown, lifted and held, set down
+		// on a side, and left alone for a minute.
+		extra:  []string{"wakeup", "throw", "hold", "side_up", "1_min_inactivity"},
+		models: []string{"MFKZQ01LM", "CTP-R01"},
+	},
+}
+
+// RemoteForModel returns the known remote of a zigbee2mqtt model.
+func RemoteForModel(model string) (Remote, bool) {
+	for r, remote := range remotes {
+		if slices.Contains(remote.models, model) {
+			return r, true
+		}
+	}
+	return "", false
+}
+
+// reports reports whether the remote reports action.
+func (r Remote) reports(action string) bool {
+	remote := remotes[r]
+	if slices.Contains(remote.extra, action) {
+		return true
+	}
+	return slices.ContainsFunc(remote.buttons, func(b Button) bool {
+		return slices.Contains([]string{b.Single, b.Double, b.Long, b.Release}, action)
+	})
+}
+
+func (d Device) validateRemote() error {
+	if d.Remote == "" {
+		return nil
+	}
+	if _, ok := remotes[d.Remote]; !ok {
+		return fmt.Errorf("device %s: unknown remote %q", d.ID, d.Remote)
+	}
+	if d.Type != DeviceTypeButton {
+		return fmt.Errorf("device %s: remote is only supported for button devices", d.ID)
+	}
+	if len(d.Buttons) > 0 {
+		return fmt.Errorf("device %s: remote and buttons cannot both be set", d.ID)
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package devices
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ErrSceneNotFound is returned for an unknown scene.
+var ErrSceneNotFound = errors.New("scene not found")
+
+// Scene is a named set of device states recalled together, e.g. "Movie"
+// dimming the living room lights and switching off the kitchen. Scenes
+// come from the devices config or are saved from the web UI.
+type Scene struct {
+	ID     string       `json:"id"`
+	Name   string       `json:"name"`
+	States []SceneState `json:"states"`
+
+	// HomeKit exposes the scene as a switch that recalls it. The switch
+	// turns itself off again, like a HomeKit scene button. Only scenes in
+	// the devices config can be exposed.
+	HomeKit bool `json:"homekit,omitempty"`
+
+	// Saved marks scenes saved from the web UI, which can be deleted there.
+	Saved bool `json:"saved,omitempty"`
+}
+
+// SceneState is the state a scene sets a device to. Values left unset are
+// not changed.
+type SceneState struct {
+	Device     string `json:"device"`
+	On         *bool  `json:"on,omitempty"`
+	Brightness *int   `json:"brightness,omitempty"` // 0-100
+	ColorTemp  *int   `json:"color_temp,omitempty"` // mireds
+	FanSpeed   *int   `json:"fan_speed,omitempty"`  // 0-100
+	Position   *int   `json:"position,omitempty"`   // 0-100, 0 = closed
+}
+
+// command returns the command setting a device to the state.
+func (s SceneState) command() CommandEvent {
+	return CommandEvent{
+		DeviceID:   s.Device,
+		On:         s.On,
+		Brightness: s.Brightness,
+		ColorTemp:  s.ColorTemp,
+		FanSpeed:   s.FanSpeed,
+		Position:   s.Position,
+	}
+}
+
+// validate checks that the state suits its device.
+func (s SceneState) validate(byID map[string]Device) error {
+	d, ok := byID[s.Device]
+	if !ok {
+		return fmt.Errorf("unknown device %q", s.Device)
+	}
+	if s.On == nil && s.Brightness == nil && s.ColorTemp == nil && s.FanSpeed == nil && s.Position == nil {
+		return fmt.Errorf("%s: no state set", s.Device)
+	}
+	if s.On != nil && !isPowerTarget(d.Type) {
+		return fmt.Errorf("%s cannot be switched on or off", s.Device)
+	}
+	if s.Brightness != nil && (d.Type != DeviceTypeLightbulb || *s.Brightness < 0 || *s.Brightness > 100) {
+		return fmt.Errorf("%s: brightness needs a lightbulb and 0-100", s.Device)
+	}
+	if s.ColorTemp != nil && (d.Type != DeviceTypeLightbulb || !d.Features.ColorTemperature) {
+		return fmt.Errorf("%s: color_temp needs a light with color_temperature", s.Device)
+	}
+	if s.FanSpeed != nil && (d.Type != DeviceTypeFan || *s.FanSpeed < 0 || *s.FanSpeed > 100) {
+		return fmt.Errorf("%s: fan_speed needs a fan and 0-100", s.Device)
+	}
+	if s.Position != nil && (d.Type != DeviceTypeCover || *s.Position < 0 || *s.Position > 100) {
+		return fmt.Errorf("%s: position needs a cover and 0-100", s.Device)
+	}
+	return nil
+}
+
+func validateScenes(cfg *Config) error {
+	byID := devicesByID(cfg)
+	seen := make(map[string]bool, len(cfg.Scenes))
+	for _, s := range cfg.Scenes {
+		if s.ID == "" || s.Name == "" {
+			return fmt.Errorf("scenes: id and name are required")
+		}
+		if seen[s.ID] {
+			return fmt.Errorf("scenes: duplicate scene id %q", s.ID)
+		}
+		seen[s.ID] = true
+
+		if len(s.States) == 0 {
+			return fmt.Errorf("scene %s: states is empty", s.ID)
+		}
+		for _, state := range s.States {
+			if err := state.validate(byID); err != nil {
+				return fmt.Errorf("scene %s: %w", s.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// SetScenes sets the scenes of the devices config.
+func (dm *Manager) SetScenes(scenes []Scene) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.scenes = slices.Clone(scenes)
+}
+
+// SetSceneFile keeps scenes saved from the web UI in path, loading those
+// saved before. Without it scenes cannot be saved.
+func (dm *Manager) SetSceneFile(path string) error {
+	saved, err := loadScenes(path)
+	if err != nil {
+		return err
+	}
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.sceneFile = path
+	dm.savedScenes = saved
+	return nil
+}
+
+// CanSaveScenes reports whether scenes can be saved from the web UI.
+func (dm *Manager) CanSaveScenes() bool {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	return dm.sceneFile != ""
+}
+
+// Scenes returns the configured scenes followed by the saved ones.
+func (dm *Manager) Scenes() []Scene {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	return append(slices.Clone(dm.scenes), dm.savedScenes...)
+}
+
+// scene returns a scene by ID. Callers must hold dm.mu.
+func (dm *Manager) scene(sceneID string) (Scene, bool) {
+	for _, s := range append(slices.Clone(dm.scenes), dm.savedScenes...) {
+		if s.ID == sceneID {
+			return s, true
+		}
+	}
+	return Scene{}, false
+}
+
+// RecallScene sets every device of a scene to its state. The scene is
+// checked against the current devices first, so it is sent whole or not at
+// all, and its commands are queued back to back.
+func (dm *Manager) RecallScene(sceneID string) error {
+	dm.mu.RLock()
+	scene, ok := dm.scene(sceneID)
+	var missing []string
+	for _, s := range scene.States {
+		if _, exists := dm.deviceInfos()[s.Device]; !exists {
+			missing = append(missing, s.Device)
+		}
+	}
+	dm.mu.RUnlock()
+
+	if !ok {
+		return ErrSceneNotFound
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("scene %s: devices no longer configured: %s", sceneID, strings.Join(missing, ", "))
+	}
+
+	dm.logger.Info("Recalling scene", "scene_id", sceneID, "devices", len(scene.States))
+	dm.sceneMu.Lock()
+	defer dm.sceneMu.Unlock()
+	for _, s := range scene.States {
+		dm.QueueCommand(s.command())
+	}
+	return nil
+}
+
+var sceneIDUnsafe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// SaveScene saves the current state of devices as a new scene.
+func (dm *Manager) SaveScene(name string, deviceIDs []string) (Scene, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Scene{}, fmt.Errorf("a scene needs a name")
+	}
+	if len(deviceIDs) == 0 {
+		return Scene{}, fmt.Errorf("a scene needs at least one device")
+	}
+
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	if dm.sceneFile == "" {
+		return Scene{}, fmt.Errorf("saving scenes is disabled")
+	}
+
+	scene := Scene{Name: name, Saved: true}
+	for _, id := range deviceIDs {
+		info, ok := dm.deviceInfos()[id]
+		if !ok {
+			return Scene{}, fmt.Errorf("unknown device %q", id)
+		}
+		state, ok := captureSceneState(info.Config, *dm.states[id])
+		if !ok {
+			return Scene{}, fmt.Errorf("%s has no state a scene can restore", info.Config.Name)
+		}
+		scene.States = append(scene.States, state)
+	}
+
+	base := strings.Trim(sceneIDUnsafe.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if base == "" {
+		base = "scene"
+	}
+	scene.ID = base
+	for i := 2; ; i++ {
+		if _, taken := dm.scene(scene.ID); !taken {
+			break
+		}
+		scene.ID = fmt.Sprintf("%s-%d", base, i)
+	}
+
+	saved := append(slices.Clone(dm.savedScenes), scene)
+	if err := saveScenes(dm.sceneFile, saved); err != nil {
+		return Scene{}, err
+	}
+	dm.savedScenes = saved
+	dm.logger.Info("Saved scene", "scene_id", scene.ID, "devices", len(scene.States))
+	return scene, nil
+}
+
+// DeleteScene deletes a scene saved from the web UI.
+func (dm *Manager) DeleteScene(sceneID string) error {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	i := slices.IndexFunc(dm.savedScenes, func(s Scene) bool { return s.ID == sceneID })
+	if i < 0 {
+		return ErrSceneNotFound
+	}
+	saved := slices.Delete(slices.Clone(dm.savedScenes), i, i+1)
+	if err := saveScenes(dm.sceneFile, saved); err != nil {
+		return err
+	}
+	dm.savedScenes = saved
+	return nil
+}
+
+// captureSceneState returns the current state of a device as a scene
+// state. ok is false when nothing about the device can be restored.
+func captureSceneState(d Device, state State) (SceneState, bool) {
+	s := SceneState{Device: d.ID}
+	if isPowerTarget(d.Type) && state.On != nil {
+		s.On = Ptr(*state.On)
+	}
+	switch d.Type {
+	case DeviceTypeLightbulb:
+		if state.On != nil && *state.On {
+			if d.Features.Brightness && state.Brightness != nil {
+				s.Brightness = Ptr(Z2MBrightnessToHAP(*state.Brightness))
+			}
+			if d.Features.ColorTemperature && state.ColorTemp != nil {
+				s.ColorTemp = Ptr(*state.ColorTemp)
+			}
+		}
+	case DeviceTypeFan:
+		if state.FanSpeed != nil && state.On != nil && *state.On {
+			s.FanSpeed = Ptr(*state.FanSpeed)
+		}
+	case DeviceTypeCover:
+		if state.Position != nil {
+			s.Position = Ptr(*state.Position)
+		}
+	}
+	ok := s.On != nil || s.Position != nil
+	return s, ok
+}
+
+// loadScenes reads scenes saved by saveScenes. A missing file means none
+// have been saved.
+func loadScenes(path string) ([]Scene, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read saved scenes: %w", err)
+	}
+
+	var scenes []Scene
+	if err := json.Unmarshal(data, &scenes); err != nil {
+		return nil, fmt.Errorf("failed to parse saved scenes: %w", err)
+	}
+	for i := range scenes {
+		scenes[i].Saved = true
+		scenes[i].HomeKit = false
+	}
+	return scenes, nil
+}
+
+// saveScenes writes the saved scenes to path atomically.
+func saveScenes(path string, scenes []Scene) error {
+	data, err := json.MarshalIndent(scenes, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create scenes directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write saved scenes: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write saved scenes: %w", err)
+	}
+	return nil
+}
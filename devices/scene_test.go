@@ -0,0 +1,131 @@
+package devices
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateScenes(t *testing.T) {
+	devices := []Device{
+		{ID: "lamp", Type: DeviceTypeLightbulb, Features: DeviceFeatures{Brightness: true}},
+		{ID: "plug", Type: DeviceTypeOutlet},
+		{ID: "blind", Type: DeviceTypeCover},
+	}
+	movie := []SceneState{{Device: "lamp", On: Ptr(true), Brightness: Ptr(20)}, {Device: "blind", Position: Ptr(0)}}
+
+	tests := []struct {
+		name    string
+		scenes  []Scene
+		wantErr bool
+	}{
+		{"movie", []Scene{{ID: "movie", Name: "Movie", States: movie}}, false},
+		{"no name", []Scene{{ID: "movie", States: movie}}, true},
+		{"duplicate", []Scene{{ID: "movie", Name: "Movie", States: movie}, {ID: "movie", Name: "Again", States: movie}}, true},
+		{"no states", []Scene{{ID: "movie", Name: "Movie"}}, true},
+		{"empty state", []Scene{{ID: "movie", Name: "Movie", States: []SceneState{{Device: "plug"}}}}, true},
+		{"unknown device", []Scene{{ID: "movie", Name: "Movie", States: []SceneState{{Device: "tv", On: Ptr(true)}}}}, true},
+		{"dim outlet", []Scene{{ID: "movie", Name: "Movie", States: []SceneState{{Device: "plug", Brightness: Ptr(50)}}}}, true},
+		{"color temp without feature", []Scene{{ID: "movie", Name: "Movie", States: []SceneState{{Device: "lamp", ColorTemp: Ptr(300)}}}}, true},
+		{"cover power", []Scene{{ID: "movie", Name: "Movie", States: []SceneState{{Device: "blind", On: Ptr(true)}}}}, true},
+		{"position out of range", []Scene{{ID: "movie", Name: "Movie", States: []SceneState{{Device: "blind", Position: Ptr(120)}}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateScenes(&Config{Devices: devices, Scenes: tt.scenes})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateScenes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScenes(t *testing.T) {
+	configs := []Device{
+		{ID: "lamp", Name: "Lamp", Type: DeviceTypeLightbulb, Features: DeviceFeatures{Brightness: true}},
+		{ID: "plug", Name: "Plug", Type: DeviceTypeOutlet},
+		{ID: "sensor", Name: "Sensor", Type: DeviceTypeClimateSensor},
+	}
+	commands := make(chan CommandEvent, 10)
+	dm, _ := newTestManager(t, configs, commands, nil)
+	dm.SetScenes([]Scene{{ID: "off", Name: "All off", States: []SceneState{
+		{Device: "lamp", On: Ptr(false)},
+		{Device: "plug", On: Ptr(false)},
+	}}})
+
+	drain := func() []CommandEvent {
+		var got []CommandEvent
+		for {
+			select {
+			case cmd := <-commands:
+				got = append(got, cmd)
+			default:
+				return got
+			}
+		}
+	}
+
+	if err := dm.RecallScene("off"); err != nil {
+		t.Fatalf("RecallScene: %v", err)
+	}
+	if got := drain(); len(got) != 2 || got[0].DeviceID != "lamp" || *got[1].On {
+		t.Errorf("recall sent %+v, want lamp and plug off", got)
+	}
+	if err := dm.RecallScene("party"); !errors.Is(err, ErrSceneNotFound) {
+		t.Errorf("RecallScene(party) = %v, want ErrSceneNotFound", err)
+	}
+
+	if _, err := dm.SaveScene("Evening", []string{"lamp"}); err == nil {
+		t.Error("saved a scene without a scene file")
+	}
+
+	path := filepath.Join(t.TempDir(), "scenes.json")
+	if err := dm.SetSceneFile(path); err != nil {
+		t.Fatalf("SetSceneFile: %v", err)
+	}
+	dm.ApplyStateChange(t.Context(), StateChangedEvent{
+		DeviceID:      "lamp",
+		State:         State{On: Ptr(true), Brightness: Ptr(127)},
+		UpdatedFields: []string{"On", "Brightness"},
+	})
+
+	if _, err := dm.SaveScene("Evening", []string{"sensor"}); err == nil {
+		t.Error("saved a scene of a sensor")
+	}
+	scene, err := dm.SaveScene("Evening", []string{"lamp"})
+	if err != nil {
+		t.Fatalf("SaveScene: %v", err)
+	}
+	if scene.ID != "evening" || *scene.States[0].Brightness != Z2MBrightnessToHAP(127) {
+		t.Errorf("saved %+v, want evening with the lamp at half brightness", scene)
+	}
+	if again, _ := dm.SaveScene("Evening", []string{"lamp"}); again.ID != "evening-2" {
+		t.Errorf("second save got id %q, want evening-2", again.ID)
+	}
+
+	// Saved scenes outlive the manager.
+	saved, err := loadScenes(path)
+	if err != nil || len(saved) != 2 || !saved[0].Saved {
+		t.Fatalf("loadScenes = %+v, %v, want both saved scenes", saved, err)
+	}
+
+	if err := dm.DeleteScene("off"); !errors.Is(err, ErrSceneNotFound) {
+		t.Errorf("deleted a configured scene: %v", err)
+	}
+	if err := dm.DeleteScene("evening-2"); err != nil {
+		t.Fatalf("DeleteScene: %v", err)
+	}
+	if got := len(dm.Scenes()); got != 2 {
+		t.Errorf("%d scenes after deleting, want 2", got)
+	}
+
+	// A scene whose device is gone is not sent at all.
+	dm.SetDevices(configs[1:])
+	drain()
+	if err := dm.RecallScene("off"); err == nil {
+		t.Error("recalled a scene with a removed device")
+	}
+	if got := drain(); len(got) != 0 {
+		t.Errorf("partial recall sent %+v", got)
+	}
+}
@@ -0,0 +1,232 @@
+package devices
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// scheduleCheckInterval is how often schedules are checked for times that
+// have passed.
+const scheduleCheckInterval = 30 * time.Second
+
+// Schedule runs commands on devices at a time of day, e.g. switching an
+// outlet off at 23:00 or dimming the hallway at sunset.
+type Schedule struct {
+	// Name identifies the schedule in logs.
+	Name string `json:"name,omitempty"`
+
+	// At is a local time ("23:00"), or "sunrise" or "sunset" with an
+	// optional offset ("sunset-30m", "sunrise+1h"). Sun times need the
+	// location.
+	At string `json:"at"`
+
+	// Days limits the schedule to days of the week ("mon" to "sun").
+	// Empty runs it every day.
+	Days []string `json:"days,omitempty"`
+
+	// Actions are the commands run, as bound to device actions.
+	Actions []ActionBinding `json:"actions"`
+}
+
+// scheduleTime is a parsed Schedule.At.
+type scheduleTime struct {
+	sun    string        // "sunrise" or "sunset"; empty for a clock time
+	clock  int           // minutes after midnight
+	offset time.Duration // from the sun time
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseScheduleTime(s string) (scheduleTime, error) {
+	for _, sun := range []string{"sunrise", "sunset"} {
+		rest, ok := strings.CutPrefix(s, sun)
+		if !ok {
+			continue
+		}
+		st := scheduleTime{sun: sun}
+		if rest == "" {
+			return st, nil
+		}
+		if rest[0] != '+' && rest[0] != '-' {
+			return scheduleTime{}, fmt.Errorf("invalid time %q, want %s+1h or %s-30m", s, sun, sun)
+		}
+		offset, err := time.ParseDuration(rest)
+		if err != nil {
+			return scheduleTime{}, fmt.Errorf("invalid offset in %q: %w", s, err)
+		}
+		st.offset = offset
+		return st, nil
+	}
+
+	clock, err := parseClock(s)
+	if err != nil {
+		return scheduleTime{}, err
+	}
+	return scheduleTime{clock: clock}, nil
+}
+
+// on returns when the time falls on the day of date, in date's location.
+// ok is false for a sun time on a day the sun does not rise or set.
+func (st scheduleTime) on(date time.Time, loc *Location) (time.Time, bool) {
+	y, m, d := date.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, date.Location())
+	if st.sun == "" {
+		// The wall clock time, which is not the time since midnight on
+		// days the clocks change.
+		return time.Date(y, m, d, st.clock/60, st.clock%60, 0, 0, date.Location()), true
+	}
+	if loc == nil {
+		return time.Time{}, false
+	}
+	sunrise, sunset, ok := loc.sunTimes(midnight)
+	if !ok {
+		return time.Time{}, false
+	}
+	if st.sun == "sunrise" {
+		return sunrise.Add(st.offset), true
+	}
+	return sunset.Add(st.offset), true
+}
+
+// runsOn reports whether the schedule runs on a day of the week.
+func (s Schedule) runsOn(day time.Weekday) bool {
+	return len(s.Days) == 0 || slices.ContainsFunc(s.Days, func(d string) bool { return weekdays[d] == day })
+}
+
+// name returns the schedule's name for logs.
+func (s Schedule) name() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.At
+}
+
+func validateSchedules(cfg *Config) error {
+	if cfg.Location != nil {
+		if err := cfg.Location.validate(); err != nil {
+			return err
+		}
+	}
+
+	byID := devicesByID(cfg)
+	for i, s := range cfg.Schedules {
+		st, err := parseScheduleTime(s.At)
+		if err != nil {
+			return fmt.Errorf("schedule %d: %w", i, err)
+		}
+		if st.sun != "" && cfg.Location == nil {
+			return fmt.Errorf("schedule %d: %s needs a location", i, st.sun)
+		}
+		for _, day := range s.Days {
+			if _, ok := weekdays[day]; !ok {
+				return fmt.Errorf("schedule %d: invalid day %q, want mon to sun", i, day)
+			}
+		}
+		if len(s.Actions) == 0 {
+			return fmt.Errorf("schedule %d: no actions", i)
+		}
+		for _, b := range s.Actions {
+			if err := b.validate(byID); err != nil {
+				return fmt.Errorf("schedule %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// SetSchedules replaces the schedules and the location sun times are
+// calculated for. Times already passed are not run.
+func (dm *Manager) SetSchedules(schedules []Schedule, loc *Location) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	dm.schedules = schedules
+	dm.location = loc
+	if dm.scheduleChecked.IsZero() {
+		dm.scheduleChecked = dm.Now()
+	}
+}
+
+// RunSchedules runs the schedules until ctx is done.
+func (dm *Manager) RunSchedules(ctx context.Context) {
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			dm.runSchedules(dm.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runSchedules runs the schedules whose time passed since the last check.
+// After the clock is set back nothing runs until it catches up.
+func (dm *Manager) runSchedules(now time.Time) {
+	dm.mu.Lock()
+	schedules, loc, last := dm.schedules, dm.location, dm.scheduleChecked
+	if now.After(last) {
+		dm.scheduleChecked = now
+	}
+	dm.mu.Unlock()
+
+	if last.IsZero() || !now.After(last) {
+		return
+	}
+
+	days := []time.Time{last}
+	if y, m, d := now.Date(); !sameDay(last, now) {
+		days = append(days, time.Date(y, m, d, 0, 0, 0, 0, now.Location()))
+	}
+
+	for _, s := range schedules {
+		st, err := parseScheduleTime(s.At)
+		if err != nil {
+			continue
+		}
+		for _, day := range days {
+			at, ok := st.on(day, loc)
+			if !ok || !at.After(last) || at.After(now) || !s.runsOn(at.Weekday()) {
+				continue
+			}
+			dm.runSchedule(s, at)
+		}
+	}
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// runSchedule queues the commands of a schedule due at at.
+func (dm *Manager) runSchedule(s Schedule, at time.Time) {
+	for _, b := range s.Actions {
+		cmd, ok := dm.resolveAction(b)
+		if !ok {
+			continue
+		}
+
+		dm.logger.Info("Running schedule",
+			"schedule", s.name(),
+			"due", at.Format(time.TimeOnly),
+			"target", b.Target,
+			"command", b.Command,
+		)
+		if !dm.tryQueueCommand(cmd) {
+			dm.logger.Warn("Command queue full, dropping scheduled command",
+				"schedule", s.name(),
+				"target", b.Target,
+			)
+		}
+	}
+}
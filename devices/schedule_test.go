@@ -0,0 +1,161 @@
+package devices
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // Europe/Oslo for the DST tests
+)
+
+func TestSunTimes(t *testing.T) {
+	london := &Location{Latitude: 51.5074, Longitude: -0.1278}
+	sunrise, sunset, ok := london.sunTimes(time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC))
+	if !ok {
+		t.Fatal("no sunrise in London in June")
+	}
+	near := func(got time.Time, want time.Time) bool {
+		return got.Sub(want).Abs() <= 2*time.Minute
+	}
+	if want := time.Date(2024, 6, 21, 3, 43, 0, 0, time.UTC); !near(sunrise, want) {
+		t.Errorf("sunrise = %v, want about %v", sunrise, want)
+	}
+	if want := time.Date(2024, 6, 21, 20, 21, 0, 0, time.UTC); !near(sunset, want) {
+		t.Errorf("sunset = %v, want about %v", sunset, want)
+	}
+
+	tromso := &Location{Latitude: 69.65, Longitude: 18.96}
+	if _, _, ok := tromso.sunTimes(time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC)); ok {
+		t.Error("the sun set in Tromsø at midsummer")
+	}
+}
+
+func TestValidateSchedules(t *testing.T) {
+	devices := []Device{{ID: "plug", Type: DeviceTypeOutlet}, {ID: "hall", Type: DeviceTypeLightbulb}}
+	off := []ActionBinding{{Target: "plug", Command: ActionCommandOff}}
+	home := &Location{Latitude: 59.9, Longitude: 10.7}
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		location *Location
+		wantErr  bool
+	}{
+		{"clock", Schedule{At: "23:00", Actions: off}, nil, false},
+		{"sunset dim", Schedule{At: "sunset-30m", Actions: []ActionBinding{{Target: "hall", Command: ActionCommandBrightness, Brightness: 20}}}, home, false},
+		{"weekdays", Schedule{At: "07:00", Days: []string{"mon", "fri"}, Actions: off}, nil, false},
+		{"sun without location", Schedule{At: "sunrise", Actions: off}, nil, true},
+		{"bad offset", Schedule{At: "sunset30m", Actions: off}, home, true},
+		{"bad time", Schedule{At: "25:00", Actions: off}, nil, true},
+		{"bad day", Schedule{At: "07:00", Days: []string{"monday"}, Actions: off}, nil, true},
+		{"no actions", Schedule{At: "07:00"}, nil, true},
+		{"dim outlet", Schedule{At: "07:00", Actions: []ActionBinding{{Target: "plug", Command: ActionCommandDimUp}}}, nil, true},
+		{"bad latitude", Schedule{At: "07:00", Actions: off}, &Location{Latitude: 91}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Devices: devices, Schedules: []Schedule{tt.schedule}, Location: tt.location}
+			err := validateSchedules(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateSchedules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunSchedules(t *testing.T) {
+	commands := make(chan CommandEvent, 10)
+	dm, _ := newTestManager(t, []Device{{ID: "plug", Name: "Plug", Type: DeviceTypeOutlet}}, commands, nil)
+	dm.SetSchedules([]Schedule{
+		{At: "23:00", Actions: []ActionBinding{{Target: "plug", Command: ActionCommandOff}}},
+		{At: "00:00", Days: []string{"sun"}, Actions: []ActionBinding{{Target: "plug", Command: ActionCommandOn}}},
+	}, nil)
+
+	drain := func() []bool {
+		var got []bool
+		for {
+			select {
+			case cmd := <-commands:
+				got = append(got, *cmd.On)
+			default:
+				return got
+			}
+		}
+	}
+
+	// Friday 2024-06-21.
+	friday := func(hour, minute, second int) time.Time {
+		return time.Date(2024, 6, 21, hour, minute, second, 0, time.Local)
+	}
+	dm.scheduleChecked = friday(22, 59, 40)
+
+	dm.runSchedules(friday(22, 59, 50))
+	if got := drain(); len(got) != 0 {
+		t.Errorf("ran %v before 23:00", got)
+	}
+	dm.runSchedules(friday(23, 0, 10))
+	if got := drain(); len(got) != 1 || got[0] {
+		t.Errorf("ran %v at 23:00, want the plug off", got)
+	}
+	dm.runSchedules(friday(23, 0, 40))
+	if got := drain(); len(got) != 0 {
+		t.Errorf("ran %v again", got)
+	}
+
+	// Saturday midnight is not a Sunday; a clock set back runs nothing.
+	dm.runSchedules(friday(24, 0, 10))
+	if got := drain(); len(got) != 0 {
+		t.Errorf("ran %v on Saturday", got)
+	}
+	dm.runSchedules(friday(22, 0, 0))
+	if got := drain(); len(got) != 0 {
+		t.Errorf("ran %v after the clock was set back", got)
+	}
+}
+
+func TestScheduleTimeAcrossDST(t *testing.T) {
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+	st, err := parseScheduleTime("23:00")
+	if err != nil {
+		t.Fatalf("parseScheduleTime: %v", err)
+	}
+
+	// Both Sundays the clocks change in 2026, spring forward and fall back.
+	for _, day := range []time.Time{
+		time.Date(2026, 3, 29, 12, 0, 0, 0, oslo),
+		time.Date(2026, 10, 25, 12, 0, 0, 0, oslo),
+	} {
+		at, _ := st.on(day, nil)
+		if want := time.Date(day.Year(), day.Month(), day.Day(), 23, 0, 0, 0, oslo); !at.Equal(want) {
+			t.Errorf("23:00 on %s = %s, want %s", day.Format("2006-01-02"), at, want)
+		}
+	}
+
+	commands := make(chan CommandEvent, 10)
+	dm, _ := newTestManager(t, []Device{{ID: "plug", Name: "Plug", Type: DeviceTypeOutlet}}, commands, nil)
+	dm.SetSchedules([]Schedule{
+		{At: "23:00", Days: []string{"sun"}, Actions: []ActionBinding{{Target: "plug", Command: ActionCommandOff}}},
+	}, nil)
+
+	for _, day := range []time.Time{
+		time.Date(2026, 3, 29, 0, 0, 0, 0, oslo),
+		time.Date(2026, 10, 25, 0, 0, 0, 0, oslo),
+	} {
+		at := func(hour, minute, second int) time.Time {
+			return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, second, 0, oslo)
+		}
+		dm.scheduleChecked = at(22, 59, 40)
+		dm.runSchedules(at(22, 59, 50))
+		if len(commands) != 0 {
+			t.Errorf("%s: ran before 23:00", day.Format("2006-01-02"))
+		}
+		dm.runSchedules(at(23, 0, 10))
+		select {
+		case <-commands:
+		default:
+			t.Errorf("%s: did not run at 23:00 on the Sunday the clocks change", day.Format("2006-01-02"))
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package devices
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ArmMode is the arm state of a security system, named as HomeKit names
+// them.
+type ArmMode string
+
+const (
+	ArmModeStay     ArmMode = "stay"
+	ArmModeAway     ArmMode = "away"
+	ArmModeNight    ArmMode = "night"
+	ArmModeDisarmed ArmMode = "disarmed"
+)
+
+// z2mArmModes maps arm modes to zigbee2mqtt's keypad arm_mode values,
+// which keypads also report as actions when a code is entered.
+var z2mArmModes = map[ArmMode]string{
+	ArmModeStay:     "arm_day_zones",
+	ArmModeAway:     "arm_all_zones",
+	ArmModeNight:    "arm_night_zones",
+	ArmModeDisarmed: "disarm",
+}
+
+// ParseArmMode parses an arm mode name.
+func ParseArmMode(s string) (ArmMode, error) {
+	mode := ArmMode(s)
+	if _, ok := z2mArmModes[mode]; !ok {
+		return "", fmt.Errorf("invalid arm mode %q, want stay, away, night or disarmed", s)
+	}
+	return mode, nil
+}
+
+// ArmModeFromAction returns the arm mode a keypad action asks for.
+func ArmModeFromAction(action string) (ArmMode, bool) {
+	for mode, z2m := range z2mArmModes {
+		if z2m == action {
+			return mode, true
+		}
+	}
+	return "", false
+}
+
+// SirenDuration is how long a siren sounds when triggered through the
+// warning command, after which it is reported silent again.
+const SirenDuration = 5 * time.Minute
+
+// SetArmMode arms or disarms a security system. The bridge keeps the arm
+// state; keypads are told the new mode so their indicators follow.
+// Disarming also silences the siren.
+func (dm *Manager) SetArmMode(ctx context.Context, deviceID string, mode ArmMode) error {
+	info, exists := dm.deviceInfos()[deviceID]
+	if !exists {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+	if info.Config.Type != DeviceTypeSecuritySystem {
+		return fmt.Errorf("device %s is not a security system", deviceID)
+	}
+	if _, err := ParseArmMode(string(mode)); err != nil {
+		return err
+	}
+
+	dm.logger.Info("Setting arm mode", "device_id", deviceID, "mode", mode)
+
+	if info.Config.Features.ArmMode {
+		topic := fmt.Sprintf("zigbee2mqtt/%s/set", info.Config.Topic)
+		data, err := json.Marshal(map[string]any{"arm_mode": map[string]string{"mode": z2mArmModes[mode]}})
+		if err != nil {
+			return fmt.Errorf("failed to marshal command: %w", err)
+		}
+		if err := dm.publishCommand(deviceID, topic, data); err != nil {
+			return fmt.Errorf("failed to publish arm mode command: %w", err)
+		}
+	}
+
+	dm.ApplyStateChange(ctx, StateChangedEvent{
+		DeviceID:      deviceID,
+		State:         State{ArmMode: &mode},
+		UpdatedFields: []string{"ArmMode"},
+	})
+
+	if mode == ArmModeDisarmed && (info.Config.Features.Siren || info.Config.Features.Alarm) {
+		if _, state, ok := dm.Device(deviceID); ok && state.SirenSounding() {
+			return dm.SetSiren(ctx, deviceID, false)
+		}
+	}
+	return nil
+}
+
+// SetSiren sounds or silences a security system's siren. Sirens with an
+// alarm switch are switched; others get a warning, which sounds for
+// SirenDuration unless stopped.
+func (dm *Manager) SetSiren(ctx context.Context, deviceID string, on bool) error {
+	info, exists := dm.deviceInfos()[deviceID]
+	if !exists {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+	if info.Config.Type != DeviceTypeSecuritySystem || !(info.Config.Features.Siren || info.Config.Features.Alarm) {
+		return fmt.Errorf("device %s has no siren", deviceID)
+	}
+
+	var payload map[string]any
+	switch {
+	case info.Config.Features.Alarm:
+		payload = map[string]any{"alarm": on}
+	case on:
+		payload = map[string]any{"warning": map[string]any{
+			"mode":     "emergency",
+			"level":    "very_high",
+			"strobe":   true,
+			"duration": int(SirenDuration / time.Second),
+		}}
+	default:
+		payload = map[string]any{"warning": map[string]any{"mode": "stop"}}
+	}
+
+	topic := fmt.Sprintf("zigbee2mqtt/%s/set", info.Config.Topic)
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal command: %w", err)
+	}
+
+	dm.logger.Info("Sending siren command",
+		"device_id", deviceID,
+		"topic", topic,
+		"on", on,
+	)
+
+	if err := dm.publishCommand(deviceID, topic, data); err != nil {
+		return fmt.Errorf("failed to publish siren command: %w", err)
+	}
+
+	// Sirens with an alarm switch report it; a warning is not reported,
+	// so record it here and clear it when the warning runs out.
+	if !info.Config.Features.Alarm {
+		dm.ApplyStateChange(ctx, StateChangedEvent{
+			DeviceID:      deviceID,
+			State:         State{Siren: &on},
+			UpdatedFields: []string{"Siren"},
+		})
+		dm.scheduleSirenTimeout(deviceID, on)
+	}
+	return nil
+}
+
+// scheduleSirenTimeout reports the siren silent once a warning has run
+// for SirenDuration. A new warning restarts the wait.
+func (dm *Manager) scheduleSirenTimeout(deviceID string, on bool) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	if t, ok := dm.sirenTimers[deviceID]; ok {
+		t.Stop()
+		delete(dm.sirenTimers, deviceID)
+	}
+	if !on {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(SirenDuration, func() {
+		dm.mu.Lock()
+		current := dm.sirenTimers[deviceID] == timer
+		if current {
+			delete(dm.sirenTimers, deviceID)
+		}
+		dm.mu.Unlock()
+		if !current {
+			return
+		}
+
+		off := false
+		dm.ApplyStateChange(context.Background(), StateChangedEvent{
+			DeviceID:      deviceID,
+			State:         State{Siren: &off},
+			UpdatedFields: []string{"Siren"},
+		})
+	})
+	dm.sirenTimers[deviceID] = timer
+}
+
+// armMode returns mode's name, or "" when the arm state is unknown.
+func armMode(mode *ArmMode) string {
+	if mode == nil {
+		return ""
+	}
+	return string(*mode)
+}
+
+// SirenSounding reports whether a security system's siren is on.
+func (s State) SirenSounding() bool {
+	return s.Siren != nil && *s.Siren
+}
@@ -0,0 +1,92 @@
+package devices
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+func TestArmModeFromAction(t *testing.T) {
+	tests := []struct {
+		action string
+		mode   ArmMode
+		ok     bool
+	}{
+		{"arm_all_zones", ArmModeAway, true},
+		{"arm_day_zones", ArmModeStay, true},
+		{"arm_night_zones", ArmModeNight, true},
+		{"disarm", ArmModeDisarmed, true},
+		{"panic", "", false},
+	}
+
+	for _, tt := range tests {
+		mode, ok := ArmModeFromAction(tt.action)
+		if mode != tt.mode || ok != tt.ok {
+			t.Errorf("ArmModeFromAction(%q) = %q, %v, want %q, %v", tt.action, mode, ok, tt.mode, tt.ok)
+		}
+	}
+
+	if _, err := ParseArmMode("armed"); err == nil {
+		t.Error("ParseArmMode(armed) should fail")
+	}
+}
+
+func TestSecuritySystemCommands(t *testing.T) {
+	server := newTestBroker(t)
+
+	var mu sync.Mutex
+	sent := make(map[string][]string)
+	err := server.Subscribe("zigbee2mqtt/+/set", 1, func(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+		mu.Lock()
+		sent[pk.TopicName] = append(sent[pk.TopicName], string(pk.Payload))
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	dm, _ := newTestManager(t, []Device{
+		{ID: "siren", Name: "Siren", Topic: "siren", Type: DeviceTypeSecuritySystem, Features: DeviceFeatures{Siren: true}},
+		{ID: "keypad", Name: "Keypad", Topic: "keypad", Type: DeviceTypeSecuritySystem, Features: DeviceFeatures{ArmMode: true}},
+	}, nil, server)
+
+	ctx := context.Background()
+	if err := dm.SetArmMode(ctx, "keypad", ArmModeNight); err != nil {
+		t.Fatalf("SetArmMode: %v", err)
+	}
+	if err := dm.SetSiren(ctx, "siren", true); err != nil {
+		t.Fatalf("SetSiren: %v", err)
+	}
+	if _, state, _ := dm.Device("siren"); !state.SirenSounding() {
+		t.Error("siren not reported sounding after a warning")
+	}
+	if err := dm.SetSiren(ctx, "keypad", true); err == nil {
+		t.Error("SetSiren on a keypad without a siren should fail")
+	}
+
+	// Disarming silences the siren.
+	if err := dm.SetArmMode(ctx, "siren", ArmModeDisarmed); err != nil {
+		t.Fatalf("SetArmMode: %v", err)
+	}
+	_, state, _ := dm.Device("siren")
+	if state.SirenSounding() || state.ArmMode == nil || *state.ArmMode != ArmModeDisarmed {
+		t.Errorf("siren state = %v, arm mode %v after disarming", state.Siren, state.ArmMode)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := sent["zigbee2mqtt/keypad/set"]; len(got) != 1 || got[0] != `{"arm_mode":{"mode":"arm_night_zones"}}` {
+		t.Errorf("keypad commands = %v", got)
+	}
+	siren := sent["zigbee2mqtt/siren/set"]
+	want := []string{
+		`{"warning":{"duration":300,"level":"very_high","mode":"emergency","strobe":true}}`,
+		`{"warning":{"mode":"stop"}}`,
+	}
+	if len(siren) != len(want) || siren[0] != want[0] || siren[1] != want[1] {
+		t.Errorf("siren commands = %v, want %v", siren, want)
+	}
+}
@@ -0,0 +1,135 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrNoSmokeResponse is returned by SmokeDrill when no response plan is
+// configured.
+var ErrNoSmokeResponse = errors.New("no smoke_response configured")
+
+// SmokeResponse is the built-in safety rule run when any smoke sensor
+// detects smoke.
+type SmokeResponse struct {
+	// Lights are switched on at full brightness. Empty means every
+	// lightbulb.
+	Lights []string `json:"lights,omitempty"`
+	// Sirens are switch or outlet devices (e.g. siren relays) switched on.
+	Sirens []string `json:"sirens,omitempty"`
+}
+
+func validateSmokeResponse(cfg *Config) error {
+	if cfg.SmokeResponse == nil {
+		return nil
+	}
+
+	byID := make(map[string]Device, len(cfg.Devices))
+	for _, d := range cfg.Devices {
+		byID[d.ID] = d
+	}
+
+	for _, id := range cfg.SmokeResponse.Lights {
+		if d, ok := byID[id]; !ok || d.Type != DeviceTypeLightbulb {
+			return fmt.Errorf("smoke_response: light %q is not a configured lightbulb", id)
+		}
+	}
+	for _, id := range cfg.SmokeResponse.Sirens {
+		if d, ok := byID[id]; !ok || (d.Type != DeviceTypeSwitch && d.Type != DeviceTypeOutlet) {
+			return fmt.Errorf("smoke_response: siren %q is not a configured switch or outlet", id)
+		}
+	}
+
+	return nil
+}
+
+// SetSmokeResponse enables the smoke response plan. nil disables it.
+func (dm *Manager) SetSmokeResponse(plan *SmokeResponse) {
+	dm.smokeResponse = plan
+}
+
+// smokeSteps lists the commands of the response plan in a stable order.
+func (dm *Manager) smokeSteps() []CommandEvent {
+	plan := dm.smokeResponse
+	if plan == nil {
+		return nil
+	}
+
+	lights := plan.Lights
+	if len(lights) == 0 {
+		for id, info := range dm.deviceInfos() {
+			if info.Config.Type == DeviceTypeLightbulb {
+				lights = append(lights, id)
+			}
+		}
+		sort.Strings(lights)
+	}
+
+	on, full := true, 100
+	var steps []CommandEvent
+	for _, id := range plan.Sirens {
+		steps = append(steps, CommandEvent{DeviceID: id, On: &on})
+	}
+	for _, id := range lights {
+		cmd := CommandEvent{DeviceID: id, On: &on}
+		if dm.deviceInfos()[id].Config.Features.Brightness {
+			cmd.Brightness = &full
+		}
+		steps = append(steps, cmd)
+	}
+	return steps
+}
+
+func describeStep(dm *Manager, cmd CommandEvent) string {
+	name := dm.deviceInfos()[cmd.DeviceID].Config.Name
+	if cmd.Brightness != nil {
+		return fmt.Sprintf("%s on at %d%%", name, *cmd.Brightness)
+	}
+	return name + " on"
+}
+
+// runSmokeResponse executes the plan and returns a description of each
+// step. With live false nothing is sent (a dry-run drill).
+func (dm *Manager) runSmokeResponse(ctx context.Context, live bool) []string {
+	var report []string
+	for _, cmd := range dm.smokeSteps() {
+		step := describeStep(dm, cmd)
+		if live {
+			if err := dm.SetPower(ctx, cmd.DeviceID, true); err != nil {
+				step += fmt.Sprintf(" (failed: %v)", err)
+			} else if cmd.Brightness != nil {
+				if err := dm.SetBrightness(ctx, cmd.DeviceID, *cmd.Brightness); err != nil {
+					step += fmt.Sprintf(" (brightness failed: %v)", err)
+				}
+			}
+		}
+		report = append(report, step)
+	}
+	return report
+}
+
+// handleSmoke runs the response plan when a smoke sensor starts detecting
+// smoke. It reports how many devices were activated and whether a plan is
+// configured.
+func (dm *Manager) handleSmoke(ctx context.Context, sensorID string) (int, bool) {
+	if dm.smokeResponse == nil {
+		return 0, false
+	}
+
+	dm.logger.Warn("Smoke detected, running response plan", "sensor_id", sensorID)
+	return len(dm.runSmokeResponse(ctx, true)), true
+}
+
+// SmokeDrill runs the smoke response plan as a drill. A dry run only
+// reports what would be done; a live drill sends the commands. Drills are
+// reported in the event log but do not raise a smoke alert.
+func (dm *Manager) SmokeDrill(ctx context.Context, live bool) ([]string, error) {
+	if dm.smokeResponse == nil {
+		return nil, ErrNoSmokeResponse
+	}
+
+	dm.logger.Info("Running smoke drill", "live", live)
+	return dm.runSmokeResponse(ctx, live), nil
+}
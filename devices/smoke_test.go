@@ -0,0 +1,71 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestValidateSmokeResponse(t *testing.T) {
+	devices := []Device{
+		{ID: "smoke", Type: DeviceTypeSmokeSensor},
+		{ID: "siren", Type: DeviceTypeSwitch},
+		{ID: "lamp", Type: DeviceTypeLightbulb},
+	}
+
+	tests := []struct {
+		name    string
+		plan    *SmokeResponse
+		wantErr bool
+	}{
+		{"unset", nil, false},
+		{"all lights", &SmokeResponse{Sirens: []string{"siren"}}, false},
+		{"named light", &SmokeResponse{Lights: []string{"lamp"}}, false},
+		{"siren is a light", &SmokeResponse{Sirens: []string{"lamp"}}, true},
+		{"light is a switch", &SmokeResponse{Lights: []string{"siren"}}, true},
+		{"unknown siren", &SmokeResponse{Sirens: []string{"missing"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSmokeResponse(&Config{Devices: devices, SmokeResponse: tt.plan})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateSmokeResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSmokeDrill(t *testing.T) {
+	dm, _ := newTestManager(t, []Device{
+		{ID: "smoke", Name: "Smoke", Type: DeviceTypeSmokeSensor},
+		{ID: "siren", Name: "Siren", Type: DeviceTypeSwitch},
+		{ID: "hall", Name: "Hall", Type: DeviceTypeLightbulb, Features: DeviceFeatures{Brightness: true}},
+		{ID: "porch", Name: "Porch", Type: DeviceTypeLightbulb},
+	}, nil, nil)
+
+	ctx := context.Background()
+	if _, err := dm.SmokeDrill(ctx, false); !errors.Is(err, ErrNoSmokeResponse) {
+		t.Fatalf("drill without plan: err = %v, want ErrNoSmokeResponse", err)
+	}
+
+	dm.SetSmokeResponse(&SmokeResponse{Sirens: []string{"siren"}})
+
+	steps, err := dm.SmokeDrill(ctx, false)
+	if err != nil {
+		t.Fatalf("SmokeDrill: %v", err)
+	}
+	want := []string{"Siren on", "Hall on at 100%", "Porch on"}
+	if !slices.Equal(steps, want) {
+		t.Errorf("dry run steps = %q, want %q", steps, want)
+	}
+
+	steps, err = dm.SmokeDrill(ctx, true)
+	if err != nil {
+		t.Fatalf("live SmokeDrill: %v", err)
+	}
+	if !slices.Equal(steps, want) {
+		t.Errorf("live drill steps = %q, want %q", steps, want)
+	}
+}
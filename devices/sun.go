@@ -0,0 +1,58 @@
+package devices
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Location is where the bridge is, for sunrise and sunset schedules.
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"` // east is positive
+}
+
+func (l *Location) validate() error {
+	if l.Latitude < -90 || l.Latitude > 90 {
+		return fmt.Errorf("location: latitude %g out of range -90 to 90", l.Latitude)
+	}
+	if l.Longitude < -180 || l.Longitude > 180 {
+		return fmt.Errorf("location: longitude %g out of range -180 to 180", l.Longitude)
+	}
+	return nil
+}
+
+// j2000 is the Julian epoch the sunrise equation counts days from.
+var j2000 = time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// sunTimes returns sunrise and sunset at l on the calendar day of date,
+// using the sunrise equation with atmospheric refraction, accurate to a
+// minute or two away from the poles. ok is false when the sun does not
+// rise or set that day.
+func (l *Location) sunTimes(date time.Time) (sunrise, sunset time.Time, ok bool) {
+	const rad = math.Pi / 180
+
+	y, m, d := date.Date()
+	n := math.Round(time.Date(y, m, d, 12, 0, 0, 0, time.UTC).Sub(j2000).Hours() / 24)
+
+	// Mean solar noon, solar mean anomaly, equation of the center and
+	// ecliptic longitude, in days and degrees.
+	noon := n - l.Longitude/360
+	anomaly := math.Mod(357.5291+0.98560028*noon, 360)
+	center := 1.9148*math.Sin(anomaly*rad) + 0.0200*math.Sin(2*anomaly*rad) + 0.0003*math.Sin(3*anomaly*rad)
+	ecliptic := math.Mod(anomaly+center+180+102.9372, 360)
+	transit := noon + 0.0053*math.Sin(anomaly*rad) - 0.0069*math.Sin(2*ecliptic*rad)
+
+	declination := math.Asin(math.Sin(ecliptic*rad) * math.Sin(23.4397*rad))
+	cosHourAngle := (math.Sin(-0.833*rad) - math.Sin(l.Latitude*rad)*math.Sin(declination)) /
+		(math.Cos(l.Latitude*rad) * math.Cos(declination))
+	if cosHourAngle < -1 || cosHourAngle > 1 {
+		return time.Time{}, time.Time{}, false
+	}
+	hourAngle := math.Acos(cosHourAngle) / rad
+
+	at := func(days float64) time.Time {
+		return j2000.Add(time.Duration(days * 24 * float64(time.Hour))).In(date.Location()).Truncate(time.Second)
+	}
+	return at(transit - hourAngle/360), at(transit + hourAngle/360), true
+}
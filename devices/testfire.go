@@ -0,0 +1,265 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+const (
+	// DefaultTestFireDuration is how long a test-fire lasts when no
+	// duration is given.
+	DefaultTestFireDuration = 30 * time.Second
+
+	// MaxTestFireDuration bounds a test-fire, so a forgotten test resets
+	// itself.
+	MaxTestFireDuration = 5 * time.Minute
+
+	// testFireChirp is how long the sirens sound during a test-fire.
+	testFireChirp = 2 * time.Second
+
+	// testFireLabel prefixes the alerts raised by a test-fire.
+	testFireLabel = "TEST: "
+)
+
+var (
+	// ErrTestFireRunning is returned when a sensor is already being
+	// test-fired.
+	ErrTestFireRunning = errors.New("a test-fire of this sensor is already running")
+
+	// ErrSensorAlarm is returned when test-firing a sensor that is raising
+	// a real alert.
+	ErrSensorAlarm = errors.New("sensor is raising a real alert")
+)
+
+// TestFire is a running test-fire of a sensor.
+type TestFire struct {
+	SensorID string           `json:"sensor_id"`
+	Kind     events.AlertKind `json:"kind"`
+	By       string           `json:"by"`
+	Started  time.Time        `json:"started"`
+	Until    time.Time        `json:"until"`
+	// Sirens are the security system sirens chirped.
+	Sirens []string `json:"sirens,omitempty"`
+
+	// restore holds the power of the response plan's devices before the
+	// test, and lockouts the valves it locked.
+	restore  map[string]bool
+	lockouts []string
+	// realAlarms are the sensors of the same kind that reported a real
+	// alarm while the test ran.
+	realAlarms []string
+}
+
+// TestFire exercises a leak, smoke or contact sensor's alert end to end
+// without a real trigger: it reports the alarm as if the sensor had, which
+// runs the response plan, raises the alert (labelled as a test) and shows
+// the sensor triggered in HomeKit, and chirps the security system sirens.
+// After d (DefaultTestFireDuration when zero, at most MaxTestFireDuration)
+// the sensor is reset, valves it locked are released and the plan's
+// devices are switched back, unless a real alarm of the same kind came in
+// meanwhile: the response then stays in place, as does the sensor's state
+// if it was the one that alarmed.
+func (dm *Manager) TestFire(ctx context.Context, sensorID string, d time.Duration, by string) (TestFire, error) {
+	info, ok := dm.deviceInfos()[sensorID]
+	if !ok {
+		return TestFire{}, fmt.Errorf("device %s not found", sensorID)
+	}
+	kind, ok := sensorAlertKind(info.Config)
+	if !ok {
+		return TestFire{}, fmt.Errorf("device %s does not raise alerts", sensorID)
+	}
+	switch {
+	case d == 0:
+		d = DefaultTestFireDuration
+	case d < 0 || d > MaxTestFireDuration:
+		return TestFire{}, fmt.Errorf("duration must be between 0 and %s", MaxTestFireDuration)
+	}
+
+	var targets []string
+	switch kind {
+	case events.AlertKindLeak:
+		targets = info.Config.ShutoffValves
+	case events.AlertKindSmoke:
+		for _, cmd := range dm.smokeSteps() {
+			targets = append(targets, cmd.DeviceID)
+		}
+	}
+	var sirens []string
+	for id, other := range dm.deviceInfos() {
+		if other.Config.Type == DeviceTypeSecuritySystem && (other.Config.Features.Siren || other.Config.Features.Alarm) {
+			sirens = append(sirens, id)
+		}
+	}
+
+	now := dm.Now()
+	dm.mu.Lock()
+	if _, running := dm.testFires[sensorID]; running {
+		dm.mu.Unlock()
+		return TestFire{}, ErrTestFireRunning
+	}
+	if sensorAlarm(kind, *dm.states[sensorID]) {
+		dm.mu.Unlock()
+		return TestFire{}, ErrSensorAlarm
+	}
+	test := &TestFire{
+		SensorID: sensorID,
+		Kind:     kind,
+		By:       by,
+		Started:  now,
+		Until:    now.Add(d),
+		Sirens:   sirens,
+		restore:  make(map[string]bool),
+	}
+	for _, id := range targets {
+		if state := dm.states[id]; state != nil && state.On != nil {
+			test.restore[id] = *state.On
+		}
+		if _, locked := dm.lockouts[id]; kind == events.AlertKindLeak && !locked {
+			test.lockouts = append(test.lockouts, id)
+		}
+	}
+	dm.testFires[sensorID] = test
+	dm.mu.Unlock()
+
+	dm.logger.Warn("Test-firing sensor",
+		"sensor_id", sensorID,
+		"kind", kind,
+		"by", by,
+		"duration", d,
+	)
+
+	dm.ApplyStateChange(ctx, sensorAlarmChange(sensorID, kind, true))
+
+	for _, id := range sirens {
+		if err := dm.SetSiren(ctx, id, true); err != nil {
+			dm.logger.Warn("Failed to chirp siren", "device_id", id, "error", err)
+		}
+	}
+	time.AfterFunc(testFireChirp, func() {
+		for _, id := range sirens {
+			if err := dm.SetSiren(context.Background(), id, false); err != nil {
+				dm.logger.Warn("Failed to silence siren", "device_id", id, "error", err)
+			}
+		}
+	})
+
+	time.AfterFunc(d, func() { dm.endTestFire(context.Background(), test) })
+
+	return *test, nil
+}
+
+// endTestFire resets the sensor of a test-fire and undoes its response.
+func (dm *Manager) endTestFire(ctx context.Context, test *TestFire) {
+	dm.mu.RLock()
+	realAlarms := slices.Clone(test.realAlarms)
+	dm.mu.RUnlock()
+	if len(realAlarms) > 0 {
+		dm.logger.Warn("Real alarm during test-fire, leaving the response in place",
+			"sensor_id", test.SensorID,
+			"alarms", realAlarms,
+		)
+	}
+
+	if !slices.Contains(realAlarms, test.SensorID) {
+		dm.ApplyStateChange(ctx, sensorAlarmChange(test.SensorID, test.Kind, false))
+	}
+
+	if len(realAlarms) == 0 {
+		for _, valveID := range test.lockouts {
+			dm.mu.Lock()
+			lockout, ok := dm.lockouts[valveID]
+			if ok && lockout.Sensor == test.SensorID {
+				delete(dm.lockouts, valveID)
+			}
+			dm.mu.Unlock()
+			if ok && lockout.Sensor == test.SensorID {
+				dm.publishLeakAlert(valveID, false, testFireLabel+"test ended, valve released")
+			}
+		}
+
+		for id, on := range test.restore {
+			if err := dm.SetPower(ctx, id, on); err != nil {
+				dm.logger.Warn("Failed to restore device after test-fire", "device_id", id, "error", err)
+			}
+		}
+	}
+
+	dm.mu.Lock()
+	delete(dm.testFires, test.SensorID)
+	dm.mu.Unlock()
+
+	dm.logger.Info("Test-fire ended", "sensor_id", test.SensorID)
+	if _, state, ok := dm.Device(test.SensorID); ok {
+		dm.publishStateUpdate("testfire", test.SensorID, state)
+	}
+}
+
+// observeRealAlarm records a sensor's reported alarm with the running
+// test-fires of its kind. Callers must hold dm.mu.
+func (dm *Manager) observeRealAlarm(event StateChangedEvent) {
+	if len(dm.testFires) == 0 {
+		return
+	}
+	kind, ok := sensorAlertKind(dm.deviceInfos()[event.DeviceID].Config)
+	if !ok || !sensorAlarm(kind, event.State) {
+		return
+	}
+	for _, test := range dm.testFires {
+		if test.Kind == kind && !slices.Contains(test.realAlarms, event.DeviceID) {
+			test.realAlarms = append(test.realAlarms, event.DeviceID)
+			dm.logger.Warn("Real alarm during test-fire",
+				"sensor_id", test.SensorID,
+				"alarm_sensor_id", event.DeviceID,
+			)
+		}
+	}
+}
+
+// testFire returns the running test-fire of a sensor, if any. Callers must
+// hold dm.mu.
+func (dm *Manager) testFire(sensorID string) *TestFire {
+	test, ok := dm.testFires[sensorID]
+	if !ok {
+		return nil
+	}
+	copied := *test
+	return &copied
+}
+
+// testLabel prefixes message with the test label while the sensor is
+// being test-fired and has not reported a real alarm.
+func (dm *Manager) testLabel(sensorID, message string) string {
+	dm.mu.RLock()
+	test, testing := dm.testFires[sensorID]
+	testing = testing && !slices.Contains(test.realAlarms, sensorID)
+	dm.mu.RUnlock()
+	if testing {
+		return testFireLabel + message
+	}
+	return message
+}
+
+// sensorAlarmChange returns the state change a test-fire reports to raise
+// or clear a sensor's alarm condition.
+func sensorAlarmChange(sensorID string, kind events.AlertKind, alarm bool) StateChangedEvent {
+	event := StateChangedEvent{DeviceID: sensorID, testFire: true}
+	switch kind {
+	case events.AlertKindLeak:
+		event.State.WaterLeak = &alarm
+		event.UpdatedFields = []string{"WaterLeak"}
+	case events.AlertKindSmoke:
+		event.State.Smoke = &alarm
+		event.UpdatedFields = []string{"Smoke"}
+	case events.AlertKindContact:
+		// zigbee2mqtt reports contact=false when the contact is open.
+		closed := !alarm
+		event.State.Contact = &closed
+		event.UpdatedFields = []string{"Contact"}
+	}
+	return event
+}
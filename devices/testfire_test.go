@@ -0,0 +1,120 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+func TestTestFire(t *testing.T) {
+	dm, bus := newTestManager(t, []Device{
+		{ID: "leak", Name: "Leak", Type: DeviceTypeLeakSensor, ShutoffValves: []string{"valve"}},
+		{ID: "kitchen", Name: "Kitchen", Type: DeviceTypeLeakSensor},
+		{ID: "valve", Name: "Valve", Type: DeviceTypeSwitch},
+	}, nil, nil)
+
+	ctx := context.Background()
+	if _, err := dm.TestFire(ctx, "valve", 0, "alice"); err == nil {
+		t.Error("test-fired a switch")
+	}
+	if _, err := dm.TestFire(ctx, "leak", time.Hour, "alice"); err == nil {
+		t.Error("test-fired beyond MaxTestFireDuration")
+	}
+
+	wet := true
+	dm.states["kitchen"].WaterLeak = &wet
+	if _, err := dm.TestFire(ctx, "kitchen", 0, "alice"); !errors.Is(err, ErrSensorAlarm) {
+		t.Errorf("test-firing a wet sensor: err = %v, want ErrSensorAlarm", err)
+	}
+
+	alerts := bus.Stats().Alerts
+	test, err := dm.TestFire(ctx, "leak", 50*time.Millisecond, "alice")
+	if err != nil {
+		t.Fatalf("TestFire: %v", err)
+	}
+	if test.Kind != events.AlertKindLeak || test.By != "alice" {
+		t.Errorf("test = %+v, want leak by alice", test)
+	}
+	if _, err := dm.TestFire(ctx, "leak", 0, "bob"); !errors.Is(err, ErrTestFireRunning) {
+		t.Errorf("second test-fire: err = %v, want ErrTestFireRunning", err)
+	}
+
+	_, state, _ := dm.Device("leak")
+	if state.WaterLeak == nil || !*state.WaterLeak || state.TestFire == nil {
+		t.Errorf("sensor state = %+v, want leak under test", state)
+	}
+	if _, valve, _ := dm.Device("valve"); valve.Lockout == nil {
+		t.Error("valve not locked by the test-fire")
+	}
+	if got := bus.Stats().Alerts; got <= alerts {
+		t.Errorf("no alerts published (%d, want more than %d)", got, alerts)
+	}
+	if got := dm.testLabel("leak", "Water leak detected"); got != "TEST: Water leak detected" {
+		t.Errorf("testLabel = %q", got)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, state, _ = dm.Device("leak")
+		if state.TestFire == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("test-fire did not reset")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if state.WaterLeak == nil || *state.WaterLeak {
+		t.Errorf("sensor leak = %v after reset, want false", state.WaterLeak)
+	}
+	if _, valve, _ := dm.Device("valve"); valve.Lockout != nil {
+		t.Errorf("valve lockout = %+v after reset, want released", valve.Lockout)
+	}
+}
+
+func TestTestFireRealAlarm(t *testing.T) {
+	dm, _ := newTestManager(t, []Device{
+		{ID: "leak", Name: "Leak", Type: DeviceTypeLeakSensor, ShutoffValves: []string{"valve"}},
+		{ID: "valve", Name: "Valve", Type: DeviceTypeSwitch},
+	}, nil, nil)
+
+	waitForReset := func(sensorID string) State {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			_, state, _ := dm.Device(sensorID)
+			if state.TestFire == nil {
+				return state
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("test-fire did not end")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	ctx := context.Background()
+	if _, err := dm.TestFire(ctx, "leak", 50*time.Millisecond, "alice"); err != nil {
+		t.Fatalf("TestFire: %v", err)
+	}
+	wet := true
+	dm.ApplyStateChange(ctx, StateChangedEvent{
+		DeviceID:      "leak",
+		State:         State{WaterLeak: &wet},
+		UpdatedFields: []string{"WaterLeak"},
+	})
+	if got := dm.testLabel("leak", "Water leak detected"); got != "Water leak detected" {
+		t.Errorf("testLabel after a real alarm = %q, want it unlabelled", got)
+	}
+
+	state := waitForReset("leak")
+	if state.WaterLeak == nil || !*state.WaterLeak {
+		t.Errorf("sensor leak = %v after the test, want the real alarm kept", state.WaterLeak)
+	}
+	if _, valve, _ := dm.Device("valve"); valve.Lockout == nil {
+		t.Error("valve released after a real alarm during the test")
+	}
+}
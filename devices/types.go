@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/tailscale/hujson"
@@ -22,6 +23,21 @@ const (
 	DeviceTypeOutlet          DeviceType = "outlet"
 	DeviceTypeSwitch          DeviceType = "switch"
 	DeviceTypeFan             DeviceType = "fan"
+	DeviceTypeCover           DeviceType = "cover"
+	DeviceTypeButton          DeviceType = "button"
+	DeviceTypeSecuritySystem  DeviceType = "security_system"
+	DeviceTypeDoorbell        DeviceType = "doorbell"
+)
+
+// Presentation controls which HomeKit service a relay-style device is
+// exposed as.
+type Presentation string
+
+const (
+	PresentationSwitch    Presentation = "switch"
+	PresentationOutlet    Presentation = "outlet"
+	PresentationFan       Presentation = "fan"
+	PresentationLightbulb Presentation = "lightbulb"
 )
 
 // DeviceFeatures indicates optional features of a device.
@@ -33,20 +49,32 @@ type DeviceFeatures struct {
 	Occupancy   bool `json:"occupancy,omitempty"`
 	Illuminance bool `json:"illuminance,omitempty"`
 	Pressure    bool `json:"pressure,omitempty"`
-	Contact     bool `json:"contact,omitempty"`     // Door/window contact
-	WaterLeak   bool `json:"water_leak,omitempty"`  // Water leak detection
-	Smoke       bool `json:"smoke,omitempty"`       // Smoke detection
-	Tamper      bool `json:"tamper,omitempty"`      // Tamper detection
+	Contact     bool `json:"contact,omitempty"`    // Door/window contact
+	WaterLeak   bool `json:"water_leak,omitempty"` // Water leak detection
+	Smoke       bool `json:"smoke,omitempty"`      // Smoke detection
+	Tamper      bool `json:"tamper,omitempty"`     // Tamper detection
 
 	// Lights
 	Brightness       bool `json:"brightness,omitempty"`
 	Color            bool `json:"color,omitempty"`             // HSV color
 	ColorTemperature bool `json:"color_temperature,omitempty"` // CT in mireds
 
+	// Outlets
+	Power bool `json:"power,omitempty"` // Power metering (W)
+
 	// Fans
 	Speed     bool `json:"speed,omitempty"`     // Fan speed (0-100)
 	Direction bool `json:"direction,omitempty"` // Rotation direction
 	Swing     bool `json:"swing,omitempty"`     // Oscillation/swing mode
+
+	// Covers
+	Position bool `json:"position,omitempty"` // Position (0-100)
+	Tilt     bool `json:"tilt,omitempty"`     // Slat tilt (0-100)
+
+	// Security systems
+	Siren   bool `json:"siren,omitempty"`    // Siren sounded with a warning
+	Alarm   bool `json:"alarm,omitempty"`    // Siren switched with alarm on/off
+	ArmMode bool `json:"arm_mode,omitempty"` // Keypad taking arm_mode
 }
 
 // Device describes a single Zigbee device.
@@ -58,20 +86,160 @@ type Device struct {
 	Features DeviceFeatures `json:"features,omitempty"`
 	HomeKit  *bool          `json:"homekit,omitempty"` // default true
 	Web      *bool          `json:"web,omitempty"`     // default true
+
+	// Hidden keeps internal or virtual devices off the dashboard, kiosk and
+	// widgets. Unlike web:false they stay listed and controllable on /all,
+	// and automations such as groups and response plans still drive them.
+	Hidden bool `json:"hidden,omitempty"`
+
+	// FrostBelow and HeatAbove raise a warning when a climate sensor's
+	// temperature in °C drops below or rises above the value, e.g. a
+	// greenhouse below 2 or an attic above 45. Each warning is also
+	// exposed to HomeKit as a contact sensor that opens while it is active.
+	FrostBelow *float64 `json:"frost_below,omitempty"`
+	HeatAbove  *float64 `json:"heat_above,omitempty"`
+
+	// ShutoffValves lists switch or outlet devices controlling water valves
+	// that a leak sensor closes when it detects water. Closed valves stay
+	// locked until the leak is acknowledged.
+	ShutoffValves []string `json:"shutoff_valves,omitempty"`
+
+	// SortWeight orders the dashboard in custom order; lower weights come
+	// first and ties are ordered by ID. Users can rearrange further by
+	// dragging cards.
+	SortWeight int `json:"sort_weight,omitempty"`
+
+	// Room groups devices for the kiosk view (/kiosk?room=...).
+	Room string `json:"room,omitempty"`
+
+	// Tags label the device for filtering. Devices tagged "guest" are shown
+	// on the guest dashboard; climate sensors tagged "outdoor" feed the
+	// weather widget rather than the indoor summary.
+	Tags []string `json:"tags,omitempty"`
+
+	// Notes, Location and PurchaseDate document the device, e.g. to keep
+	// an inventory of where each sensor physically is. They are shown in
+	// the web UI and matched by its search. PurchaseDate is YYYY-MM-DD.
+	Notes        string `json:"notes,omitempty"`
+	Location     string `json:"location,omitempty"`
+	PurchaseDate string `json:"purchase_date,omitempty"`
+
+	// BatteryType is the battery the device takes, e.g. "CR2032" or
+	// "2x AAA", for the inventory. Known models default to theirs.
+	BatteryType string `json:"battery_type,omitempty"`
+
+	// AlertOnOpen raises an alert when a contact sensor opens, e.g. for a
+	// door that should stay shut. Like leak and smoke alerts it can be
+	// acknowledged to silence repeats.
+	AlertOnOpen bool `json:"alert_on_open,omitempty"`
+
+	// Units overrides the units the device reports sensor values in.
+	Units Units `json:"units,omitempty"`
+
+	// ExposeTo limits the device to the named HomeKit bridges, e.g. to keep
+	// locks and security sensors off a guest-facing bridge. Empty exposes
+	// the device on every bridge.
+	ExposeTo []string `json:"expose_to,omitempty"`
+
+	// Presentation overrides the HomeKit service for switch and outlet
+	// devices (switch, outlet, fan or lightbulb). Defaults to the
+	// category, then the device type.
+	Presentation Presentation `json:"presentation,omitempty"`
+
+	// Category overrides the HomeKit accessory category. Defaults to the
+	// device type's category.
+	Category Category `json:"category,omitempty"`
+
+	// InUseThreshold is the power draw in watts above which a metering
+	// outlet is reported as in use. Defaults to DefaultInUseThreshold.
+	InUseThreshold *float64 `json:"in_use_threshold,omitempty"`
+
+	// ColorTempRange limits the color temperature HomeKit offers a light to
+	// what it supports. Discovered lights take it from zigbee2mqtt;
+	// without it HomeKit's default 140 to 500 mireds is used.
+	ColorTempRange *ColorTempRange `json:"color_temp_range,omitempty"`
+
+	// FanModeNames lists the fan_mode presets the device accepts. When set,
+	// speed commands are rounded to the nearest preset instead of being sent
+	// as a numeric fan_speed.
+	FanModeNames []string `json:"fan_modes,omitempty"`
+	// FanModeMap overrides the default fan_mode to percentage table, e.g.
+	// {"1": 25, "2": 50, "3": 75, "4": 100, "smart": -1}. A negative value
+	// marks a mode that is not a fixed speed.
+	FanModeMap map[string]int `json:"fan_mode_map,omitempty"`
+
+	// Actions binds zigbee2mqtt actions reported by this device, such as a
+	// remote's "double" or "brightness_move_up", to commands on other
+	// devices.
+	Actions map[string][]ActionBinding `json:"actions,omitempty"`
+
+	// Buttons lists the buttons of a button device and the actions each
+	// reports, exposed to HomeKit as programmable switches. Without it a
+	// button device has one button reporting single, double and hold.
+	// A doorbell has at most one button, whose single press rings.
+	Buttons []Button `json:"buttons,omitempty"`
+
+	// Remote names a known remote, such as "styrbar", whose buttons are
+	// used instead of a buttons list. See Remote.
+	Remote Remote `json:"remote,omitempty"`
 }
 
 // Config defines the device configuration file structure.
 type Config struct {
 	Devices []Device `json:"devices"`
+
+	// SmokeResponse switches on sirens and lights when any smoke sensor
+	// detects smoke. Unset disables it.
+	SmokeResponse *SmokeResponse `json:"smoke_response,omitempty"`
+
+	// NightMode caps light brightness and silences non-critical alerts at
+	// night. Unset disables it.
+	NightMode *NightMode `json:"night_mode,omitempty"`
+
+	// Groups are shown in the web UI as single cards with a master toggle.
+	Groups []Group `json:"groups,omitempty"`
+
+	// Schedules run device commands at times of day.
+	Schedules []Schedule `json:"schedules,omitempty"`
+
+	// Location is where the bridge is, for sunrise and sunset schedules.
+	Location *Location `json:"location,omitempty"`
+
+	// HumidityFans run fans while humidity is raised, e.g. after a shower.
+	HumidityFans []HumidityFan `json:"humidity_fans,omitempty"`
+
+	// Scenes are named device states recalled together.
+	Scenes []Scene `json:"scenes,omitempty"`
+
+	// LightPresets set the brightness and color temperature lights turn
+	// on at by time of day. Unset disables them.
+	LightPresets *LightPresets `json:"light_presets,omitempty"`
 }
 
 // LoadConfig reads and validates the HuJSON device configuration file.
 func LoadConfig(path string) (*Config, error) {
+	return loadConfig(path, nil, false)
+}
+
+// LoadConfigWithDiscovered is LoadConfig with the devices discovered from
+// zigbee2mqtt added after the configured ones, which take precedence. The
+// file may list no devices of its own.
+func LoadConfigWithDiscovered(path string, discovered []Device) (*Config, error) {
+	return loadConfig(path, discovered, true)
+}
+
+func loadConfig(path string, discovered []Device, discovery bool) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read devices config file: %w", err)
 	}
+	return ParseConfig(data, discovered, discovery)
+}
 
+// ParseConfig parses and validates a HuJSON device configuration, with
+// the discovered devices added as LoadConfigWithDiscovered when discovery
+// is set.
+func ParseConfig(data []byte, discovered []Device, discovery bool) (*Config, error) {
 	standardized, err := hujson.Standardize(data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to standardize HuJSON: %w", err)
@@ -82,7 +250,8 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal devices config: %w", err)
 	}
 
-	if len(cfg.Devices) == 0 {
+	cfg.Devices = MergeDiscovered(cfg.Devices, discovered)
+	if len(cfg.Devices) == 0 && !discovery {
 		return nil, fmt.Errorf("no devices configured")
 	}
 
@@ -109,6 +278,42 @@ func LoadConfig(path string) (*Config, error) {
 		}
 		seenIDs[device.ID] = struct{}{}
 
+		if err := validatePresentation(device); err != nil {
+			return nil, err
+		}
+		if err := validateCategory(device); err != nil {
+			return nil, err
+		}
+		if err := validateExposeTo(device); err != nil {
+			return nil, err
+		}
+		if err := validatePurchaseDate(device); err != nil {
+			return nil, err
+		}
+		if device.BatteryType != "" {
+			if _, err := ParseBattery(device.BatteryType); err != nil {
+				return nil, fmt.Errorf("device %s: %w", device.ID, err)
+			}
+		}
+		if err := device.Units.validate(device.ID); err != nil {
+			return nil, err
+		}
+		if err := validateClimateThresholds(device); err != nil {
+			return nil, err
+		}
+		if err := validateColorTempRange(device); err != nil {
+			return nil, err
+		}
+		if err := device.validateFanModes(); err != nil {
+			return nil, err
+		}
+		if err := device.validateButtons(); err != nil {
+			return nil, err
+		}
+		if err := device.validateRemote(); err != nil {
+			return nil, err
+		}
+
 		// Set defaults for HomeKit and Web if not specified
 		if cfg.Devices[i].HomeKit == nil {
 			defaultTrue := true
@@ -118,6 +323,37 @@ func LoadConfig(path string) (*Config, error) {
 			defaultTrue := true
 			cfg.Devices[i].Web = &defaultTrue
 		}
+		if device.Remote != "" {
+			cfg.Devices[i].Features.Battery = true
+		}
+	}
+
+	if err := validateActions(&cfg); err != nil {
+		return nil, err
+	}
+	if err := validateShutoffValves(&cfg); err != nil {
+		return nil, err
+	}
+	if err := validateSmokeResponse(&cfg); err != nil {
+		return nil, err
+	}
+	if err := validateNightMode(&cfg); err != nil {
+		return nil, err
+	}
+	if err := validateGroups(&cfg); err != nil {
+		return nil, err
+	}
+	if err := validateSchedules(&cfg); err != nil {
+		return nil, err
+	}
+	if err := validateHumidityFans(&cfg); err != nil {
+		return nil, err
+	}
+	if err := validateScenes(&cfg); err != nil {
+		return nil, err
+	}
+	if err := validateLightPresets(&cfg); err != nil {
+		return nil, err
 	}
 
 	return &cfg, nil
@@ -127,13 +363,109 @@ func isValidDeviceType(t DeviceType) bool {
 	switch t {
 	case DeviceTypeClimateSensor, DeviceTypeOccupancySensor,
 		DeviceTypeContactSensor, DeviceTypeLeakSensor, DeviceTypeSmokeSensor,
-		DeviceTypeLightbulb, DeviceTypeOutlet, DeviceTypeSwitch, DeviceTypeFan:
+		DeviceTypeLightbulb, DeviceTypeOutlet, DeviceTypeSwitch, DeviceTypeFan,
+		DeviceTypeCover, DeviceTypeSecuritySystem, DeviceTypeButton,
+		DeviceTypeDoorbell:
 		return true
 	default:
 		return false
 	}
 }
 
+func validatePresentation(device Device) error {
+	if device.Presentation == "" {
+		return nil
+	}
+	if device.Type != DeviceTypeSwitch && device.Type != DeviceTypeOutlet {
+		return fmt.Errorf("device %s: presentation is only supported for switch and outlet devices", device.ID)
+	}
+	switch device.Presentation {
+	case PresentationSwitch, PresentationOutlet, PresentationFan, PresentationLightbulb:
+		return nil
+	default:
+		return fmt.Errorf("device %s has invalid presentation %q", device.ID, device.Presentation)
+	}
+}
+
+func validateExposeTo(device Device) error {
+	seen := make(map[string]struct{}, len(device.ExposeTo))
+	for _, bridge := range device.ExposeTo {
+		if bridge == "" {
+			return fmt.Errorf("device %s: expose_to contains an empty bridge name", device.ID)
+		}
+		if _, ok := seen[bridge]; ok {
+			return fmt.Errorf("device %s: expose_to lists bridge %q twice", device.ID, bridge)
+		}
+		seen[bridge] = struct{}{}
+	}
+	return nil
+}
+
+// purchaseDateLayout is the format of a device's purchase date.
+const purchaseDateLayout = "2006-01-02"
+
+func validatePurchaseDate(device Device) error {
+	if device.PurchaseDate == "" {
+		return nil
+	}
+	if _, err := time.Parse(purchaseDateLayout, device.PurchaseDate); err != nil {
+		return fmt.Errorf("device %s: purchase_date %q is not YYYY-MM-DD", device.ID, device.PurchaseDate)
+	}
+	return nil
+}
+
+// ExposedOn reports whether the device is published on the named HomeKit
+// bridge.
+func (d Device) ExposedOn(bridge string) bool {
+	if d.HomeKit != nil && !*d.HomeKit {
+		return false
+	}
+	if len(d.ExposeTo) == 0 {
+		return true
+	}
+	return slices.Contains(d.ExposeTo, bridge)
+}
+
+// HomeKitPresentation returns the HomeKit service a switch or outlet device
+// is exposed as.
+func (d Device) HomeKitPresentation() Presentation {
+	if d.Presentation != "" {
+		return d.Presentation
+	}
+	if p, ok := categoryPresentation(d.Category); ok {
+		return p
+	}
+	if d.Type == DeviceTypeSwitch {
+		return PresentationSwitch
+	}
+	return PresentationOutlet
+}
+
+// DefaultInUseThreshold is the power draw (W) above which a metering outlet
+// is considered in use.
+const DefaultInUseThreshold = 1.0
+
+// OutletInUse derives the HomeKit OutletInUse value. Metering devices are in
+// use when power draw exceeds the threshold; others mirror the on state.
+// ok is false when the relevant value is not available.
+func (d Device) OutletInUse(on *bool, power *float64) (inUse bool, ok bool) {
+	if d.Features.Power {
+		if power == nil {
+			return false, false
+		}
+		threshold := DefaultInUseThreshold
+		if d.InUseThreshold != nil {
+			threshold = *d.InUseThreshold
+		}
+		return *power > threshold, true
+	}
+
+	if on == nil {
+		return false, false
+	}
+	return *on, true
+}
+
 // State represents the runtime state of a device.
 type State struct {
 	ID   string
@@ -151,6 +483,42 @@ type State struct {
 	Smoke       *bool // true = smoke detected
 	Tamper      *bool // true = tampered
 
+	// Derived from recent pressure readings
+	PressureTrend    PressureTrend
+	PressureChange   *float64 // hPa per three hours
+	PressureForecast string
+
+	// Lockout is set while a shutoff valve is held closed after a leak.
+	// Like Health it is filled in when the state is read.
+	Lockout *Lockout
+
+	// Ack is set while an acknowledged alert is silenced. Like Health it
+	// is filled in when the state is read.
+	Ack *AlertAck
+
+	// TestFire is set while the sensor is being test-fired. Like Health it
+	// is filled in when the state is read.
+	TestFire *TestFire
+
+	// Calibration is the latest calibration step sent to a cover. Like
+	// Health it is filled in when the state is read.
+	Calibration *Calibration
+
+	// Disabled is when the device was disabled, nil while it is enabled.
+	// Like Health it is filled in when the state is read.
+	Disabled *time.Time
+
+	// Frost and heat warnings, nil unless configured
+	FrostWarning *bool
+	HeatWarning  *bool
+
+	// Anomalies maps sensor fields whose latest reading was rejected to
+	// the reason. The field keeps its last good value.
+	Anomalies map[string]string
+
+	// Health is computed when the state is read and is not stored.
+	Health Health
+
 	// Light values
 	On         *bool
 	Brightness *int     // 0-254 (Z2M scale, convert to 0-100 for HAP)
@@ -158,11 +526,31 @@ type State struct {
 	Saturation *float64 // 0-100
 	ColorTemp  *int     // mireds
 
+	// Outlet values
+	Power   *float64 // watts
+	Voltage *float64 // volts
+	Current *float64 // amperes
+	Energy  *float64 // kWh, as counted by the device
+
 	// Fan values
 	FanSpeed     *int  // 0-100 (percentage)
 	FanDirection *bool // true = forward, false = reverse
 	FanSwing     *bool // true = oscillating
 
+	// Cover values
+	Position      *int     // 0-100, 0 = closed
+	Tilt          *int     // 0-100
+	Calibrating   *bool    // true = learning its travel time
+	TravelTime    *float64 // seconds end to end, as calibrated
+	MotorReversed *bool    // true = motor direction reversed
+
+	// Security system values
+	ArmMode *ArmMode
+	Siren   *bool // true = sounding
+
+	// Firmware update, nil until the device reports one
+	Update *FirmwareUpdate
+
 	// Connectivity
 	LinkQuality int
 	LastUpdated time.Time
@@ -174,6 +562,10 @@ type StateChangedEvent struct {
 	DeviceID      string
 	State         State
 	UpdatedFields []string
+
+	// testFire marks the alarm a test-fire reports for a sensor, as
+	// opposed to one the sensor reported.
+	testFire bool
 }
 
 // CommandEvent requests a device command.
@@ -184,8 +576,21 @@ type CommandEvent struct {
 	Hue        *float64 // 0-360
 	Saturation *float64 // 0-100
 	ColorTemp  *int     // mireds
+	FanSpeed   *int     // 0-100 (percentage)
+	Position   *int     // 0-100, 0 = closed
+	Tilt       *int     // 0-100
+	ArmMode    *ArmMode
+	Siren      *bool
+	Dim        *int // >0 starts dimming up, <0 down, 0 stops
+
+	seq uint64 // command log sequence, 0 if not logged
 }
 
+// DimRate is the brightness_move rate, in zigbee2mqtt brightness steps per
+// second, used for press-and-hold dimming. A full sweep takes about six
+// seconds.
+const DimRate = 40
+
 // ErrorEvent is emitted when a device encounters an error.
 type ErrorEvent struct {
 	DeviceID string
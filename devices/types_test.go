@@ -116,3 +116,180 @@ func abs(x int) int {
 	}
 	return x
 }
+
+func TestHomeKitPresentation(t *testing.T) {
+	tests := []struct {
+		name   string
+		device Device
+		want   Presentation
+	}{
+		{"switch default", Device{Type: DeviceTypeSwitch}, PresentationSwitch},
+		{"outlet default", Device{Type: DeviceTypeOutlet}, PresentationOutlet},
+		{"switch as outlet", Device{Type: DeviceTypeSwitch, Presentation: PresentationOutlet}, PresentationOutlet},
+		{"switch as fan", Device{Type: DeviceTypeSwitch, Presentation: PresentationFan}, PresentationFan},
+		{"outlet in lightbulb category", Device{Type: DeviceTypeOutlet, Category: CategoryLightbulb}, PresentationLightbulb},
+		{"presentation wins over category", Device{Type: DeviceTypeOutlet, Category: CategoryLightbulb, Presentation: PresentationSwitch}, PresentationSwitch},
+		{"category without a service", Device{Type: DeviceTypeOutlet, Category: CategorySprinkler}, PresentationOutlet},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.device.HomeKitPresentation(); got != tt.want {
+				t.Errorf("HomeKitPresentation() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePresentation(t *testing.T) {
+	tests := []struct {
+		name    string
+		device  Device
+		wantErr bool
+	}{
+		{"unset", Device{ID: "a", Type: DeviceTypeLightbulb}, false},
+		{"switch as fan", Device{ID: "a", Type: DeviceTypeSwitch, Presentation: PresentationFan}, false},
+		{"invalid value", Device{ID: "a", Type: DeviceTypeSwitch, Presentation: "lamp"}, true},
+		{"unsupported type", Device{ID: "a", Type: DeviceTypeLightbulb, Presentation: PresentationSwitch}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePresentation(tt.device)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validatePresentation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateCategory(t *testing.T) {
+	tests := []struct {
+		name    string
+		device  Device
+		wantErr bool
+	}{
+		{"unset", Device{ID: "a", Type: DeviceTypeOutlet}, false},
+		{"outlet as lightbulb", Device{ID: "a", Type: DeviceTypeOutlet, Category: CategoryLightbulb}, false},
+		{"sensor as window", Device{ID: "a", Type: DeviceTypeContactSensor, Category: CategoryWindow}, false},
+		{"invalid value", Device{ID: "a", Type: DeviceTypeOutlet, Category: "lamp"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCategory(tt.device)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateCategory() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateColorTempRange(t *testing.T) {
+	lamp := Device{ID: "a", Type: DeviceTypeLightbulb, Features: DeviceFeatures{ColorTemperature: true}}
+	dimmer := Device{ID: "a", Type: DeviceTypeLightbulb, Features: DeviceFeatures{Brightness: true}}
+	tests := []struct {
+		name    string
+		device  Device
+		r       *ColorTempRange
+		wantErr bool
+	}{
+		{"unset", lamp, nil, false},
+		{"valid", lamp, &ColorTempRange{Min: 153, Max: 454}, false},
+		{"inverted", lamp, &ColorTempRange{Min: 454, Max: 153}, true},
+		{"zero min", lamp, &ColorTempRange{Max: 454}, true},
+		{"no color temperature", dimmer, &ColorTempRange{Min: 153, Max: 454}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.device.ColorTempRange = tt.r
+			err := validateColorTempRange(tt.device)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateColorTempRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExposedOn(t *testing.T) {
+	off := false
+	tests := []struct {
+		name   string
+		device Device
+		bridge string
+		want   bool
+	}{
+		{"default", Device{}, "main", true},
+		{"homekit disabled", Device{HomeKit: &off}, "main", false},
+		{"listed", Device{ExposeTo: []string{"main", "guest"}}, "guest", true},
+		{"not listed", Device{ExposeTo: []string{"main"}}, "guest", false},
+		{"homekit disabled wins", Device{HomeKit: &off, ExposeTo: []string{"main"}}, "main", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.device.ExposedOn(tt.bridge); got != tt.want {
+				t.Errorf("ExposedOn(%q) = %v, want %v", tt.bridge, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateExposeTo(t *testing.T) {
+	if err := validateExposeTo(Device{ID: "a", ExposeTo: []string{"main", "guest"}}); err != nil {
+		t.Errorf("valid expose_to rejected: %v", err)
+	}
+	if err := validateExposeTo(Device{ID: "a", ExposeTo: []string{""}}); err == nil {
+		t.Error("empty bridge name accepted")
+	}
+	if err := validateExposeTo(Device{ID: "a", ExposeTo: []string{"main", "main"}}); err == nil {
+		t.Error("duplicate bridge name accepted")
+	}
+}
+
+func TestValidatePurchaseDate(t *testing.T) {
+	for _, date := range []string{"", "2024-03-17"} {
+		if err := validatePurchaseDate(Device{ID: "a", PurchaseDate: date}); err != nil {
+			t.Errorf("purchase date %q rejected: %v", date, err)
+		}
+	}
+	for _, date := range []string{"17/03/2024", "2024-13-01"} {
+		if err := validatePurchaseDate(Device{ID: "a", PurchaseDate: date}); err == nil {
+			t.Errorf("purchase date %q accepted", date)
+		}
+	}
+}
+
+func TestOutletInUse(t *testing.T) {
+	metering := Device{Features: DeviceFeatures{Power: true}}
+	custom := Device{Features: DeviceFeatures{Power: true}, InUseThreshold: Ptr(10.0)}
+	plain := Device{}
+
+	tests := []struct {
+		name      string
+		device    Device
+		on        *bool
+		power     *float64
+		wantInUse bool
+		wantOK    bool
+	}{
+		{"metering above default", metering, Ptr(true), Ptr(5.0), true, true},
+		{"metering standby draw", metering, Ptr(true), Ptr(0.4), false, true},
+		{"metering no power yet", metering, Ptr(true), nil, false, false},
+		{"custom threshold below", custom, Ptr(true), Ptr(5.0), false, true},
+		{"custom threshold above", custom, Ptr(true), Ptr(25.0), true, true},
+		{"plain mirrors on", plain, Ptr(true), nil, true, true},
+		{"plain off", plain, Ptr(false), Ptr(50.0), false, true},
+		{"plain unknown", plain, nil, nil, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inUse, ok := tt.device.OutletInUse(tt.on, tt.power)
+			if inUse != tt.wantInUse || ok != tt.wantOK {
+				t.Errorf("OutletInUse() = (%v, %v), want (%v, %v)", inUse, ok, tt.wantInUse, tt.wantOK)
+			}
+		})
+	}
+}
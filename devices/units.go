@@ -0,0 +1,76 @@
+package devices
+
+import (
+	"fmt"
+	"math"
+)
+
+// Units annotates the units a device reports in when they differ from
+// zigbee2mqtt's usual °C, hPa and lux. Readings are converted on ingestion
+// so every surface (HomeKit, web, metrics) sees normalized values.
+type Units struct {
+	Temperature string `json:"temperature,omitempty"` // C (default), F or K
+	Pressure    string `json:"pressure,omitempty"`    // hPa (default), Pa, kPa, mbar, inHg or mmHg
+	Illuminance string `json:"illuminance,omitempty"` // lux (default) or raw
+}
+
+// hPa per unit for the supported pressure units.
+var pressureUnits = map[string]float64{
+	"":     1,
+	"hPa":  1,
+	"mbar": 1,
+	"Pa":   0.01,
+	"kPa":  10,
+	"inHg": 33.8639,
+	"mmHg": 1.33322,
+}
+
+func (u Units) validate(deviceID string) error {
+	switch u.Temperature {
+	case "", "C", "F", "K":
+	default:
+		return fmt.Errorf("device %s has invalid temperature unit %q", deviceID, u.Temperature)
+	}
+	if _, ok := pressureUnits[u.Pressure]; !ok {
+		return fmt.Errorf("device %s has invalid pressure unit %q", deviceID, u.Pressure)
+	}
+	switch u.Illuminance {
+	case "", "lux", "raw":
+	default:
+		return fmt.Errorf("device %s has invalid illuminance unit %q", deviceID, u.Illuminance)
+	}
+	return nil
+}
+
+// TemperatureC converts a reported temperature to °C.
+func (u Units) TemperatureC(v float64) float64 {
+	switch u.Temperature {
+	case "F":
+		return (v - 32) * 5 / 9
+	case "K":
+		return v - 273.15
+	default:
+		return v
+	}
+}
+
+// PressureHPa converts a reported pressure to hPa.
+func (u Units) PressureHPa(v float64) float64 {
+	factor, ok := pressureUnits[u.Pressure]
+	if !ok {
+		return v
+	}
+	return v * factor
+}
+
+// IlluminanceLux converts a reported illuminance to lux. Raw values use the
+// logarithmic scale of the Zigbee illuminance measurement cluster.
+func (u Units) IlluminanceLux(v float64) float64 {
+	if u.Illuminance != "raw" {
+		return v
+	}
+	if v <= 0 {
+		return 0
+	}
+	return math.Round(math.Pow(10, (v-1)/10000))
+}
@@ -0,0 +1,56 @@
+package devices
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUnitsConversion(t *testing.T) {
+	near := func(a, b float64) bool { return math.Abs(a-b) < 0.01 }
+
+	if got := (Units{Temperature: "F"}).TemperatureC(212); !near(got, 100) {
+		t.Errorf("212°F = %v°C, want 100", got)
+	}
+	if got := (Units{Temperature: "K"}).TemperatureC(273.15); !near(got, 0) {
+		t.Errorf("273.15K = %v°C, want 0", got)
+	}
+	if got := (Units{}).TemperatureC(21.5); got != 21.5 {
+		t.Errorf("default temperature = %v, want unchanged", got)
+	}
+
+	if got := (Units{Pressure: "kPa"}).PressureHPa(101.3); !near(got, 1013) {
+		t.Errorf("101.3 kPa = %v hPa, want 1013", got)
+	}
+	if got := (Units{Pressure: "Pa"}).PressureHPa(101300); !near(got, 1013) {
+		t.Errorf("101300 Pa = %v hPa, want 1013", got)
+	}
+	if got := (Units{Pressure: "inHg"}).PressureHPa(29.92); math.Abs(got-1013.2) > 0.1 {
+		t.Errorf("29.92 inHg = %v hPa, want ~1013.2", got)
+	}
+
+	if got := (Units{Illuminance: "raw"}).IlluminanceLux(30001); got != 1000 {
+		t.Errorf("raw 30001 = %v lux, want 1000", got)
+	}
+	if got := (Units{Illuminance: "raw"}).IlluminanceLux(0); got != 0 {
+		t.Errorf("raw 0 = %v lux, want 0", got)
+	}
+	if got := (Units{}).IlluminanceLux(350); got != 350 {
+		t.Errorf("default illuminance = %v, want unchanged", got)
+	}
+}
+
+func TestUnitsValidate(t *testing.T) {
+	valid := []Units{{}, {Temperature: "F", Pressure: "kPa", Illuminance: "raw"}, {Pressure: "mmHg"}}
+	for _, u := range valid {
+		if err := u.validate("dev"); err != nil {
+			t.Errorf("validate(%+v) = %v, want nil", u, err)
+		}
+	}
+
+	invalid := []Units{{Temperature: "R"}, {Pressure: "psi"}, {Illuminance: "fc"}}
+	for _, u := range invalid {
+		if err := u.validate("dev"); err == nil {
+			t.Errorf("validate(%+v) accepted invalid unit", u)
+		}
+	}
+}
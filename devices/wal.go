@@ -0,0 +1,339 @@
+package devices
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// CommandReplayWait is how long replay of logged commands waits for
+	// zigbee2mqtt to report online after a restart before sending anyway.
+	CommandReplayWait = time.Minute
+
+	// commandLogCompactEvery rewrites the log without completed commands
+	// after this many completions, keeping it small.
+	commandLogCompactEvery = 256
+)
+
+// commandRecord is one line of the command log: a command being accepted,
+// or the completion of an earlier one.
+type commandRecord struct {
+	Seq  uint64        `json:"seq"`
+	Done bool          `json:"done,omitempty"`
+	At   time.Time     `json:"at,omitzero"`
+	Cmd  *CommandEvent `json:"cmd,omitempty"`
+}
+
+// CommandLog is a write-ahead log of queued commands. Commands are synced
+// to disk before they are queued and marked done once they have been
+// published, so a crash in between does not lose them: they are replayed
+// on the next start.
+type CommandLog struct {
+	mu      sync.Mutex
+	path    string
+	f       *os.File
+	next    uint64
+	pending map[uint64]commandRecord
+	done    int
+}
+
+// OpenCommandLog opens or creates the command log at path, loading the
+// commands that were not completed by the previous run.
+func OpenCommandLog(path string) (*CommandLog, error) {
+	l := &CommandLog{path: path, next: 1, pending: make(map[uint64]commandRecord)}
+
+	f, err := os.Open(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to open command log: %w", err)
+	default:
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var rec commandRecord
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				// A torn final line from a crash mid-write; the
+				// command was never acknowledged as queued.
+				continue
+			}
+			if rec.Done {
+				delete(l.pending, rec.Seq)
+			} else if rec.Cmd != nil {
+				l.pending[rec.Seq] = rec
+			}
+			l.next = max(l.next, rec.Seq+1)
+		}
+		err := scanner.Err()
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read command log: %w", err)
+		}
+	}
+
+	if err := l.compact(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// compact rewrites the log with only the pending commands. Callers must
+// hold l.mu or own l exclusively.
+func (l *CommandLog) compact() error {
+	tmp := l.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write command log: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	for _, seq := range slices.Sorted(maps.Keys(l.pending)) {
+		if err := writeRecord(w, l.pending[seq]); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write command log: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to sync command log: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write command log: %w", err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return fmt.Errorf("failed to replace command log: %w", err)
+	}
+
+	if l.f != nil {
+		_ = l.f.Close()
+	}
+	l.f, err = os.OpenFile(l.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open command log: %w", err)
+	}
+	l.done = 0
+	return nil
+}
+
+func writeRecord(w interface{ Write([]byte) (int, error) }, rec commandRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode command log record: %w", err)
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write command log: %w", err)
+	}
+	return nil
+}
+
+// Append logs a command and syncs it to disk, returning its sequence
+// number for Done.
+func (l *CommandLog) Append(cmd CommandEvent, now time.Time) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rec := commandRecord{Seq: l.next, At: now, Cmd: &cmd}
+	if err := writeRecord(l.f, rec); err != nil {
+		return 0, err
+	}
+	if err := l.f.Sync(); err != nil {
+		return 0, fmt.Errorf("failed to sync command log: %w", err)
+	}
+	l.next++
+	l.pending[rec.Seq] = rec
+	return rec.Seq, nil
+}
+
+// Done marks a logged command as completed. Completions are not synced;
+// losing one only means an idempotent command is sent again.
+func (l *CommandLog) Done(seq uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.pending[seq]; !ok {
+		return nil
+	}
+	delete(l.pending, seq)
+	if err := writeRecord(l.f, commandRecord{Seq: seq, Done: true}); err != nil {
+		return err
+	}
+
+	l.done++
+	if l.done >= commandLogCompactEvery {
+		return l.compact()
+	}
+	return nil
+}
+
+// Pending returns the number of logged commands not yet completed.
+func (l *CommandLog) Pending() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.pending)
+}
+
+// Close closes the log file.
+func (l *CommandLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// replayable returns the pending commands merged per device, latest value
+// per field winning, skipping commands older than CommandQueueMaxAge. It
+// also returns the sequence numbers the merged commands replace.
+func (l *CommandLog) replayable(now time.Time) ([]CommandEvent, []uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	merged := make(map[string]*CommandEvent)
+	var order []string
+	var seqs []uint64
+	for _, seq := range slices.Sorted(maps.Keys(l.pending)) {
+		rec := l.pending[seq]
+		seqs = append(seqs, seq)
+		if now.Sub(rec.At) > CommandQueueMaxAge {
+			continue
+		}
+
+		cmd := rec.Cmd
+		m, ok := merged[cmd.DeviceID]
+		if !ok {
+			m = &CommandEvent{DeviceID: cmd.DeviceID}
+			merged[cmd.DeviceID] = m
+			order = append(order, cmd.DeviceID)
+		}
+		m.merge(*cmd)
+	}
+
+	cmds := make([]CommandEvent, 0, len(order))
+	for _, id := range order {
+		cmds = append(cmds, *merged[id])
+	}
+	return cmds, seqs
+}
+
+// merge overlays the fields set in other onto c.
+func (c *CommandEvent) merge(other CommandEvent) {
+	if other.On != nil {
+		c.On = other.On
+	}
+	if other.Brightness != nil {
+		c.Brightness = other.Brightness
+	}
+	if other.Hue != nil && other.Saturation != nil {
+		c.Hue, c.Saturation = other.Hue, other.Saturation
+	}
+	if other.ColorTemp != nil {
+		c.ColorTemp = other.ColorTemp
+	}
+	if other.FanSpeed != nil {
+		c.FanSpeed = other.FanSpeed
+	}
+	if other.Position != nil {
+		c.Position = other.Position
+	}
+	if other.Tilt != nil {
+		c.Tilt = other.Tilt
+	}
+	if other.ArmMode != nil {
+		c.ArmMode = other.ArmMode
+	}
+	if other.Siren != nil {
+		c.Siren = other.Siren
+	}
+}
+
+// SetCommandLog makes the manager log queued commands to l so they
+// survive a crash. Commands left pending by the previous run are sent by
+// ReplayCommandLog.
+func (dm *Manager) SetCommandLog(l *CommandLog) {
+	dm.commandLog = l
+}
+
+// logCommand records cmd in the command log before it is queued.
+// Dimming is not logged, as replaying a move later would leave the light
+// moving unexpectedly.
+func (dm *Manager) logCommand(cmd CommandEvent) CommandEvent {
+	if dm.commandLog == nil || cmd.Dim != nil {
+		return cmd
+	}
+	seq, err := dm.commandLog.Append(cmd, dm.Now())
+	if err != nil {
+		dm.logger.Error("Failed to log command", "device_id", cmd.DeviceID, "error", err)
+		return cmd
+	}
+	cmd.seq = seq
+	return cmd
+}
+
+// commandDone marks a logged command as completed, whether it was sent
+// or failed; failures are reported, not retried.
+func (dm *Manager) commandDone(cmd CommandEvent) {
+	if dm.commandLog == nil || cmd.seq == 0 {
+		return
+	}
+	if err := dm.commandLog.Done(cmd.seq); err != nil {
+		dm.logger.Warn("Failed to complete logged command", "device_id", cmd.DeviceID, "error", err)
+	}
+}
+
+// QueueCommand logs cmd and queues it, blocking until there is room.
+// HomeKit writes use this so a busy queue delays rather than drops them.
+func (dm *Manager) QueueCommand(cmd CommandEvent) {
+	dm.commands <- dm.logCommand(cmd)
+}
+
+// ReplayCommandLog sends the commands the previous run accepted but never
+// published. It waits for zigbee2mqtt to report online, or at most
+// CommandReplayWait, so the commands are not published before
+// zigbee2mqtt is subscribed.
+func (dm *Manager) ReplayCommandLog(ctx context.Context) {
+	if dm.commandLog == nil || dm.commandLog.Pending() == 0 {
+		return
+	}
+
+	select {
+	case <-dm.z2mSeen:
+	case <-time.After(CommandReplayWait):
+		dm.logger.Warn("zigbee2mqtt has not reported online, replaying logged commands anyway")
+	case <-ctx.Done():
+		return
+	}
+
+	cmds, replaced := dm.commandLog.replayable(dm.Now())
+	dm.logger.Info("Replaying commands from before restart",
+		"logged", len(replaced),
+		"commands", len(cmds),
+	)
+	for _, cmd := range cmds {
+		dm.logger.Info("Replaying command", "device_id", cmd.DeviceID)
+		cmd = dm.logCommand(cmd)
+		select {
+		case dm.commands <- cmd:
+		case <-ctx.Done():
+			return
+		}
+	}
+	for _, seq := range replaced {
+		if err := dm.commandLog.Done(seq); err != nil {
+			dm.logger.Warn("Failed to complete replayed command", "error", err)
+		}
+	}
+}
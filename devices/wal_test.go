@@ -0,0 +1,153 @@
+package devices
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCommandLogReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.wal")
+	now := time.Now()
+
+	l, err := OpenCommandLog(path)
+	if err != nil {
+		t.Fatalf("OpenCommandLog: %v", err)
+	}
+	done, _ := l.Append(CommandEvent{DeviceID: "lamp", On: Ptr(true)}, now)
+	_, _ = l.Append(CommandEvent{DeviceID: "oven", On: Ptr(true)}, now)
+	_, _ = l.Append(CommandEvent{DeviceID: "oven", On: Ptr(false), Brightness: Ptr(10)}, now)
+	_, _ = l.Append(CommandEvent{DeviceID: "old", On: Ptr(true)}, now.Add(-2*CommandQueueMaxAge))
+	if err := l.Done(done); err != nil {
+		t.Fatalf("Done: %v", err)
+	}
+	_ = l.Close()
+
+	// Simulate a crash mid-write.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	_, _ = f.WriteString(`{"seq":9,"cmd":{"Devi`)
+	_ = f.Close()
+
+	l, err = OpenCommandLog(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer l.Close()
+	if got := l.Pending(); got != 3 {
+		t.Fatalf("Pending = %d, want 3", got)
+	}
+
+	cmds, replaced := l.replayable(now)
+	if len(replaced) != 3 {
+		t.Errorf("replaced %d commands, want 3", len(replaced))
+	}
+	if len(cmds) != 1 || cmds[0].DeviceID != "oven" {
+		t.Fatalf("replay = %+v, want the oven only", cmds)
+	}
+	if *cmds[0].On || *cmds[0].Brightness != 10 {
+		t.Errorf("replay = on %v brightness %v, want latest off 10", *cmds[0].On, *cmds[0].Brightness)
+	}
+
+	seq, err := l.Append(CommandEvent{DeviceID: "lamp", On: Ptr(true)}, now)
+	if err != nil || seq <= 4 {
+		t.Errorf("Append after reopen = %d, %v; want a fresh sequence", seq, err)
+	}
+}
+
+func TestManagerCommandLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.wal")
+	l, err := OpenCommandLog(path)
+	if err != nil {
+		t.Fatalf("OpenCommandLog: %v", err)
+	}
+	_, _ = l.Append(CommandEvent{DeviceID: "oven", On: Ptr(false)}, time.Now())
+
+	commands := make(chan CommandEvent, 10)
+	dm, _ := newTestManager(t, []Device{{ID: "oven", Name: "Oven", Topic: "oven", Type: DeviceTypeOutlet}}, commands, nil)
+	dm.SetCommandLog(l)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	replayed := make(chan struct{})
+	go func() {
+		dm.ReplayCommandLog(ctx)
+		close(replayed)
+	}()
+	dm.SetZ2MOnline(true)
+	<-replayed
+
+	select {
+	case cmd := <-commands:
+		if cmd.DeviceID != "oven" || cmd.On == nil || *cmd.On {
+			t.Fatalf("replayed %+v, want oven off", cmd)
+		}
+		if got := l.Pending(); got != 1 {
+			t.Errorf("Pending while queued = %d, want 1", got)
+		}
+		dm.processCommand(ctx, cmd)
+	default:
+		t.Fatal("nothing replayed")
+	}
+	if got := l.Pending(); got != 0 {
+		t.Errorf("Pending after processing = %d, want 0", got)
+	}
+
+	if err := dm.SubmitCommand(CommandEvent{DeviceID: "oven", On: Ptr(true)}); err != nil {
+		t.Fatalf("SubmitCommand: %v", err)
+	}
+	if got := l.Pending(); got != 1 {
+		t.Errorf("Pending after submit = %d, want 1", got)
+	}
+	dm.processCommand(ctx, <-commands)
+	if got := l.Pending(); got != 0 {
+		t.Errorf("Pending after processing submit = %d, want 0", got)
+	}
+}
+
+func TestManagerCommandLogOffline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.wal")
+	l, err := OpenCommandLog(path)
+	if err != nil {
+		t.Fatalf("OpenCommandLog: %v", err)
+	}
+	defer l.Close()
+
+	commands := make(chan CommandEvent, 10)
+	dm, _ := newTestManager(t, []Device{{ID: "oven", Name: "Oven", Topic: "oven", Type: DeviceTypeOutlet}}, commands, nil)
+	dm.SetCommandLog(l)
+	dm.SetZ2MOnline(false)
+
+	if err := dm.SubmitCommand(CommandEvent{DeviceID: "oven", On: Ptr(false)}); err != nil {
+		t.Fatalf("SubmitCommand: %v", err)
+	}
+	dm.processCommand(context.Background(), <-commands)
+	if got := dm.PendingCommands("oven"); got != 1 {
+		t.Fatalf("PendingCommands = %d, want 1 held for zigbee2mqtt", got)
+	}
+	if got := l.Pending(); got != 1 {
+		t.Fatalf("Pending while held = %d, want 1", got)
+	}
+
+	// A crash during the outage replays the held command.
+	replay, err := OpenCommandLog(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	cmds, _ := replay.replayable(time.Now())
+	_ = replay.Close()
+	if len(cmds) != 1 || cmds[0].DeviceID != "oven" || cmds[0].On == nil || *cmds[0].On {
+		t.Fatalf("replay = %+v, want the oven off", cmds)
+	}
+
+	dm.SetZ2MOnline(true)
+	deadline := time.Now().Add(5 * time.Second)
+	for l.Pending() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Pending after flush = %d, want 0", l.Pending())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,215 @@
+package z2mhomekit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kradalby/z2m-homekit/devices"
+	"github.com/kradalby/z2m-homekit/events"
+	"github.com/kradalby/z2m-homekit/tokens"
+)
+
+// DeviceResponse describes a device in the JSON API. State is the latest
+// normalized state, as streamed on /events, and is unset until the device
+// has reported.
+type DeviceResponse struct {
+	ID           string                   `json:"id"`
+	Name         string                   `json:"name"`
+	Type         devices.DeviceType       `json:"type"`
+	Room         string                   `json:"room,omitempty"`
+	Tags         []string                 `json:"tags,omitempty"`
+	Hidden       bool                     `json:"hidden,omitempty"`
+	Notes        string                   `json:"notes,omitempty"`
+	Location     string                   `json:"location,omitempty"`
+	PurchaseDate string                   `json:"purchase_date,omitempty"`
+	Features     devices.DeviceFeatures   `json:"features"`
+	State        *events.StateUpdateEvent `json:"state,omitempty"`
+}
+
+func (ws *WebServer) deviceResponse(device devices.Device) DeviceResponse {
+	resp := DeviceResponse{
+		ID:           device.ID,
+		Name:         device.Name,
+		Type:         device.Type,
+		Room:         device.Room,
+		Tags:         device.Tags,
+		Hidden:       device.Hidden,
+		Features:     device.Features,
+		Notes:        device.Notes,
+		Location:     device.Location,
+		PurchaseDate: device.PurchaseDate,
+	}
+
+	ws.stateMu.RLock()
+	if evt, ok := ws.currentState[device.ID]; ok {
+		resp.State = &evt
+	}
+	ws.stateMu.RUnlock()
+
+	return resp
+}
+
+// HandleDevicesAPI lists the devices available on the web, sorted by ID,
+// only those matching q when it is set.
+func (ws *WebServer) HandleDevicesAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	list := []DeviceResponse{}
+	for _, entry := range ws.deviceProvider.Snapshot() {
+		if webEnabled(entry.Device) && deviceMatches(entry.Device, query) {
+			list = append(list, ws.deviceResponse(entry.Device))
+		}
+	}
+	slices.SortFunc(list, func(a, b DeviceResponse) int { return strings.Compare(a.ID, b.ID) })
+
+	ws.writeJSON(w, list)
+}
+
+// deviceAPI serves /api/v1/devices/<id> with the read scope and the
+// commands under it, /api/v1/devices/<id>/{power,brightness,color,position,
+// arm,siren}, with the control scope.
+func (ws *WebServer) deviceAPI() http.HandlerFunc {
+	read := ws.requireScope(tokens.ScopeRead, ws.HandleDeviceAPI)
+	control := ws.requireScope(tokens.ScopeControl, ws.HandleDeviceCommandAPI)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			control(w, r)
+			return
+		}
+		read(w, r)
+	}
+}
+
+// HandleDeviceAPI returns a single device.
+func (ws *WebServer) HandleDeviceAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deviceID := strings.TrimPrefix(r.URL.Path, "/api/v1/devices/")
+	device, _, exists := ws.deviceProvider.Device(deviceID)
+	if !exists || !webEnabled(device) {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	ws.writeJSON(w, ws.deviceResponse(device))
+}
+
+// HandleDeviceCommandAPI switches a device (power, on=true|false), sets its
+// brightness (brightness, brightness=0-100) or its color (color, hue and
+// saturation or color_temp), moves a cover (position, position=0-100), arms
+// a security system (arm, mode=stay|away|night|disarmed) or sounds its
+// siren (siren, on=true|false). It replies 204 once the command is sent; the resulting state arrives on
+// /events.
+func (ws *WebServer) HandleDeviceCommandAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deviceID, command, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/v1/devices/"), "/")
+	device, _, exists := ws.deviceProvider.Device(deviceID)
+	if !exists || !webEnabled(device) {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	var msg mqttCommand
+	var err error
+	switch command {
+	case "power":
+		msg.On, err = formValue(r, "on", strconv.ParseBool)
+	case "brightness":
+		msg.Brightness, err = formValue(r, "brightness", strconv.Atoi)
+	case "position":
+		msg.Position, err = formValue(r, "position", strconv.Atoi)
+	case "arm":
+		msg.ArmMode, err = formValue(r, "mode", func(s string) (string, error) { return s, nil })
+	case "siren":
+		msg.Siren, err = formValue(r, "on", strconv.ParseBool)
+	case "color":
+		if r.FormValue("color_temp") != "" {
+			msg.ColorTemp, err = formValue(r, "color_temp", strconv.Atoi)
+			break
+		}
+		parseFloat := func(s string) (float64, error) { return strconv.ParseFloat(s, 64) }
+		if msg.Hue, err = formValue(r, "hue", parseFloat); err == nil {
+			msg.Saturation, err = formValue(r, "saturation", parseFloat)
+		}
+	default:
+		http.Error(w, "Unknown command", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cmd, err := msg.command(device)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	switch {
+	case cmd.On != nil:
+		err = ws.controller.SetPower(ctx, deviceID, *cmd.On)
+	case cmd.Brightness != nil:
+		err = ws.controller.SetBrightness(ctx, deviceID, *cmd.Brightness)
+	case cmd.Position != nil:
+		err = ws.controller.SetCoverPosition(ctx, deviceID, *cmd.Position)
+	case cmd.ArmMode != nil:
+		err = ws.controller.SetArmMode(ctx, deviceID, *cmd.ArmMode)
+	case cmd.Siren != nil:
+		err = ws.controller.SetSiren(ctx, deviceID, *cmd.Siren)
+	case cmd.ColorTemp != nil:
+		err = ws.controller.SetColorTemp(ctx, deviceID, *cmd.ColorTemp)
+	default:
+		err = ws.controller.SetColor(ctx, deviceID, *cmd.Hue, *cmd.Saturation)
+	}
+	if err != nil {
+		if errors.Is(err, devices.ErrValveLocked) || errors.Is(err, devices.ErrDeviceDisabled) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		ws.logger.Error("Failed to send API command", "device_id", deviceID, "command", command, "error", err)
+		http.Error(w, "Failed to send command", http.StatusInternalServerError)
+		return
+	}
+
+	ws.LogEvent(fmt.Sprintf("API: %s %s by %s", command, deviceID, requestActor(r)))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// formValue parses a required form field.
+func formValue[T any](r *http.Request, name string, parse func(string) (T, error)) (*T, error) {
+	raw := r.FormValue(name)
+	if raw == "" {
+		return nil, fmt.Errorf("%s is required", name)
+	}
+	v, err := parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %q", name, raw)
+	}
+	return &v, nil
+}
+
+func (ws *WebServer) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		ws.logger.Error("Failed to write JSON response", slog.Any("error", err))
+	}
+}
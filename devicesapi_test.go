@@ -0,0 +1,83 @@
+package z2mhomekit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/client"
+	"github.com/kradalby/z2m-homekit/devices"
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+func TestDevicesAPIWithClient(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	controller := &fakeController{}
+	ws.controller = controller
+	ws.deviceProvider = fakeDeviceProvider{
+		"lamp":  {Device: devices.Device{ID: "lamp", Name: "Lamp", Type: devices.DeviceTypeLightbulb, Features: devices.DeviceFeatures{Brightness: true, Color: true}}},
+		"leak":  {Device: devices.Device{ID: "leak", Name: "Leak", Type: devices.DeviceTypeLeakSensor}},
+		"attic": {Device: devices.Device{ID: "attic", Name: "Attic", Type: devices.DeviceTypeOutlet, Web: devices.Ptr(false)}},
+	}
+	ws.currentState["lamp"] = events.StateUpdateEvent{DeviceID: "lamp", On: devices.Ptr(true), Brightness: devices.Ptr(40)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/devices", ws.HandleDevicesAPI)
+	mux.HandleFunc("/api/v1/devices/", ws.deviceAPI())
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	c, err := client.New(srv.URL, client.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	list, err := c.ListDevices(ctx)
+	if err != nil {
+		t.Fatalf("ListDevices: %v", err)
+	}
+	var ids []string
+	for _, d := range list {
+		ids = append(ids, d.ID)
+	}
+	if !slices.Equal(ids, []string{"lamp", "leak"}) {
+		t.Fatalf("devices = %v, want lamp, leak", ids)
+	}
+	if s := list[0].State; s == nil || *s.Brightness != 40 || !list[0].Features.Color {
+		t.Errorf("lamp = %+v, want state and features", list[0])
+	}
+	if list[1].State != nil {
+		t.Errorf("leak has state before reporting: %+v", list[1].State)
+	}
+
+	if _, err := c.Device(ctx, "attic"); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("Device(attic) error = %v, want not found", err)
+	}
+
+	for _, err := range []error{
+		c.SetPower(ctx, "lamp", false),
+		c.SetBrightness(ctx, "lamp", 60),
+		c.SetColor(ctx, "lamp", 120, 50),
+		c.SetColorTemp(ctx, "lamp", 300),
+	} {
+		if err != nil {
+			t.Fatalf("command: %v", err)
+		}
+	}
+	want := []string{"power lamp false", "brightness lamp 60", "color lamp 120 50", "color_temp lamp 300"}
+	if !slices.Equal(controller.calls, want) {
+		t.Errorf("calls = %v, want %v", controller.calls, want)
+	}
+
+	var apiErr *client.Error
+	if err := c.SetBrightness(ctx, "lamp", 150); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("out of range brightness error = %v, want 400", err)
+	}
+	if err := c.SetPower(ctx, "leak", true); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("switching a sensor error = %v, want 400", err)
+	}
+}
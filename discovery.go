@@ -0,0 +1,69 @@
+package z2mhomekit
+
+import (
+	"log/slog"
+	"reflect"
+	"sync"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+// BridgeDevicesTopic is where zigbee2mqtt publishes its device list.
+const BridgeDevicesTopic = "zigbee2mqtt/bridge/devices"
+
+// DeviceDiscovery keeps the discovered devices file in line with the
+// device list zigbee2mqtt publishes. A changed list is saved and onChange
+// is called to apply it to the bridge.
+type DeviceDiscovery struct {
+	path     string
+	onChange func()
+	logger   *slog.Logger
+
+	mu    sync.Mutex
+	known []devices.Device
+}
+
+// NewDeviceDiscovery returns a discovery that saves to path. known is the
+// list the running bridge was started with.
+func NewDeviceDiscovery(path string, known []devices.Device, onChange func(), logger *slog.Logger) *DeviceDiscovery {
+	return &DeviceDiscovery{
+		path:     path,
+		onChange: onChange,
+		logger:   logger,
+		known:    known,
+	}
+}
+
+// HandleBridgeDevices processes a zigbee2mqtt/bridge/devices payload. It
+// reports whether the discovered devices changed.
+func (d *DeviceDiscovery) HandleBridgeDevices(payload []byte) bool {
+	list, err := devices.ParseBridgeDevices(payload)
+	if err != nil {
+		d.logger.Warn("Failed to parse zigbee2mqtt device list", "error", err)
+		return false
+	}
+	discovered := devices.DiscoverDevices(list)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(discovered) == len(d.known) && (len(discovered) == 0 || reflect.DeepEqual(discovered, d.known)) {
+		return false
+	}
+
+	if err := devices.SaveDiscovered(d.path, discovered); err != nil {
+		d.logger.Error("Failed to save discovered devices", "error", err)
+		return false
+	}
+	d.known = discovered
+
+	d.logger.Info("Discovered devices changed",
+		"devices", len(discovered),
+		"reported", len(list),
+		"path", d.path,
+	)
+	if d.onChange != nil {
+		d.onChange()
+	}
+	return true
+}
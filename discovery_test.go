@@ -0,0 +1,52 @@
+package z2mhomekit
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+func TestDeviceDiscoveryReloadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "discovered.json")
+	changes := 0
+	d := NewDeviceDiscovery(path, nil, func() { changes++ }, testLogger())
+
+	plug := `{"ieee_address": "0x1", "friendly_name": "desk-plug", "type": "Router", "supported": true,
+	  "definition": {"model": "ZNCZ04LM", "vendor": "Aqara", "exposes": [{"type": "switch", "features": [{"type": "binary", "name": "state", "property": "state"}]}]}}`
+	motion := `{"ieee_address": "0x2", "friendly_name": "hall-motion", "type": "EndDevice", "supported": true,
+	  "definition": {"model": "RTCGQ11LM", "vendor": "Aqara", "exposes": [{"type": "binary", "name": "occupancy", "property": "occupancy"}]}}`
+
+	if d.HandleBridgeDevices([]byte(`[]`)) {
+		t.Error("empty list reported as a change with nothing known")
+	}
+	if !d.HandleBridgeDevices([]byte(`[` + plug + `]`)) {
+		t.Fatal("new device not reported as a change")
+	}
+	if d.HandleBridgeDevices([]byte(`[` + plug + `]`)) {
+		t.Error("unchanged list reported as a change")
+	}
+	if !d.HandleBridgeDevices([]byte(`[` + plug + `,` + motion + `]`)) {
+		t.Error("paired device not reported as a change")
+	}
+	if d.HandleBridgeDevices([]byte(`not json`)) {
+		t.Error("invalid payload reported as a change")
+	}
+	if changes != 2 {
+		t.Errorf("onChange called %d times, want 2", changes)
+	}
+
+	saved, err := devices.LoadDiscovered(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 2 || saved[0].ID != "desk-plug" || saved[1].ID != "hall-motion" {
+		t.Errorf("saved = %+v, want desk-plug and hall-motion", saved)
+	}
+
+	// A bridge restarted with the saved list does not reload again.
+	restarted := NewDeviceDiscovery(path, saved, func() { t.Error("reload after restart") }, testLogger())
+	if restarted.HandleBridgeDevices([]byte(`[` + plug + `,` + motion + `]`)) {
+		t.Error("saved list reported as a change after restart")
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"tailscale.com/util/eventbus"
 )
@@ -18,6 +21,9 @@ const (
 	ClientWeb           ClientName = "web"
 	ClientMQTT          ClientName = "mqtt"
 	ClientMetrics       ClientName = "metrics"
+	ClientMirror        ClientName = "mirror"
+	ClientConfig        ClientName = "config"
+	ClientHistory       ClientName = "history"
 )
 
 // Bus wraps tailscale's eventbus and provides helpers for publishing state updates.
@@ -27,10 +33,45 @@ type Bus struct {
 	logger  *slog.Logger
 	ctx     context.Context
 	cancel  context.CancelFunc
+	now     func() time.Time
 
-	lastStates map[string]StateUpdateEvent
-	stateMu    sync.Mutex
-	mu         sync.RWMutex
+	lastStates     map[string]lastState
+	stateTTL       time.Duration
+	livenessEvents bool
+	connections    *ConnectionMachine
+	statusClients  map[string]*eventbus.Client // last publisher per component
+	statusHooks    []func(ConnectionStatusEvent)
+	stateMu        sync.Mutex
+	mu             sync.RWMutex
+
+	publishers  map[publisherKey]any // *eventbus.Publisher[T]
+	publisherMu sync.Mutex
+
+	stateUpdates       atomic.Uint64
+	duplicatesSkipped  atomic.Uint64
+	commands           atomic.Uint64
+	connectionStatuses atomic.Uint64
+	alerts             atomic.Uint64
+	actions            atomic.Uint64
+	devicesSeen        atomic.Uint64
+	registryChanges    atomic.Uint64
+}
+
+// DeviceSeenInterval is the most often a DeviceSeenEvent is published for
+// a device whose state is unchanged.
+const DeviceSeenInterval = 10 * time.Second
+
+// Stats counts the events published through the bus helpers.
+type Stats struct {
+	StateUpdates       uint64 `json:"state_updates"`
+	DuplicatesSkipped  uint64 `json:"duplicates_skipped"`
+	Commands           uint64 `json:"commands"`
+	ConnectionStatuses uint64 `json:"connection_statuses"`
+	Alerts             uint64 `json:"alerts"`
+	Actions            uint64 `json:"actions"`
+	DevicesSeen        uint64 `json:"devices_seen"`
+	RegistryChanges    uint64 `json:"registry_changes"`
+	TrackedDevices     int    `json:"tracked_devices"`
 }
 
 // New constructs a new bus with the known clients registered.
@@ -42,12 +83,16 @@ func New(logger *slog.Logger) (*Bus, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	b := &Bus{
-		bus:        eventbus.New(),
-		clients:    make(map[ClientName]*eventbus.Client),
-		logger:     logger,
-		ctx:        ctx,
-		cancel:     cancel,
-		lastStates: make(map[string]StateUpdateEvent),
+		bus:           eventbus.New(),
+		clients:       make(map[ClientName]*eventbus.Client),
+		logger:        logger,
+		ctx:           ctx,
+		cancel:        cancel,
+		now:           time.Now,
+		lastStates:    make(map[string]lastState),
+		connections:   NewConnectionMachine(ConnectionDebounce),
+		statusClients: make(map[string]*eventbus.Client),
+		publishers:    make(map[publisherKey]any),
 	}
 
 	for _, name := range []ClientName{
@@ -56,10 +101,15 @@ func New(logger *slog.Logger) (*Bus, error) {
 		ClientWeb,
 		ClientMQTT,
 		ClientMetrics,
+		ClientMirror,
+		ClientConfig,
+		ClientHistory,
 	} {
 		b.clients[name] = b.bus.Client(string(name))
 	}
 
+	go b.publishDueStatuses(ConnectionDebounce / 4)
+
 	logger.Info("eventbus initialized",
 		slog.Int("client_count", len(b.clients)),
 	)
@@ -67,6 +117,57 @@ func New(logger *slog.Logger) (*Bus, error) {
 	return b, nil
 }
 
+// lastState is the last state published for a device, used to drop
+// duplicates.
+type lastState struct {
+	event     StateUpdateEvent
+	published time.Time
+	seen      time.Time
+}
+
+// SetStateTTL bounds how long the last published state of a device is kept
+// for deduplication. Entries older than ttl are evicted, so a device that
+// stops reporting does not hold memory, and its next update is always
+// published. Zero, the default, keeps entries until ForgetDevice.
+func (b *Bus) SetStateTTL(ttl time.Duration) {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	b.stateTTL = ttl
+}
+
+// SetLivenessEvents sets whether a state update that only changes
+// liveness (link quality, last seen, connection state) is published as a
+// DeviceSeenEvent, at most every DeviceSeenInterval, rather than as a
+// StateUpdateEvent. Consumers such as HAP then only see real state changes.
+func (b *Bus) SetLivenessEvents(enabled bool) {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	b.livenessEvents = enabled
+}
+
+// ForgetDevice drops the last published state of a device, for devices
+// removed from the configuration.
+func (b *Bus) ForgetDevice(deviceID string) {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	delete(b.lastStates, deviceID)
+}
+
+// pruneStates evicts last states older than the state TTL.
+func (b *Bus) pruneStates(now time.Time) {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+
+	if b.stateTTL <= 0 {
+		return
+	}
+	for id, last := range b.lastStates {
+		if now.Sub(last.published) >= b.stateTTL {
+			delete(b.lastStates, id)
+		}
+	}
+}
+
 // Client returns the named eventbus client.
 func (b *Bus) Client(name ClientName) (*eventbus.Client, error) {
 	b.mu.RLock()
@@ -85,25 +186,49 @@ func (b *Bus) PublishStateUpdate(client *eventbus.Client, event StateUpdateEvent
 	b.stateMu.Lock()
 	defer b.stateMu.Unlock()
 
+	now := b.now()
 	last, ok := b.lastStates[event.DeviceID]
-	if ok && event.Equals(last) {
+	if ok && b.stateTTL > 0 && now.Sub(last.published) >= b.stateTTL {
+		ok = false
+	}
+	if ok && event.Equals(last.event) {
+		b.duplicatesSkipped.Add(1)
 		b.logger.Debug("skipping duplicate state update",
 			slog.String("device_id", event.DeviceID),
 			slog.String("source", event.Source),
 		)
 		return
 	}
+	if ok && b.livenessEvents && event.SameState(last.event) {
+		last.event = event
+		if now.Sub(last.seen) >= DeviceSeenInterval {
+			last.seen = now
+			b.publishDeviceSeen(client, event.Seen())
+		} else {
+			b.duplicatesSkipped.Add(1)
+		}
+		b.lastStates[event.DeviceID] = last
+		return
+	}
 
 	b.logger.Debug("publishing state update",
 		slog.String("device_id", event.DeviceID),
 		slog.String("source", event.Source),
 	)
 
-	publisher := eventbus.Publish[StateUpdateEvent](client)
-	defer publisher.Close()
-	publisher.Publish(event)
+	publisherFor[StateUpdateEvent](b, client).Publish(event)
 
-	b.lastStates[event.DeviceID] = event
+	b.lastStates[event.DeviceID] = lastState{event: event, published: now, seen: now}
+	b.stateUpdates.Add(1)
+}
+
+func (b *Bus) publishDeviceSeen(client *eventbus.Client, event DeviceSeenEvent) {
+	b.logger.Debug("publishing device seen",
+		slog.String("device_id", event.DeviceID),
+	)
+
+	publisherFor[DeviceSeenEvent](b, client).Publish(event)
+	b.devicesSeen.Add(1)
 }
 
 // PublishCommand emits a command event for metrics/debug consumers.
@@ -114,21 +239,164 @@ func (b *Bus) PublishCommand(client *eventbus.Client, event CommandEvent) {
 		slog.String("command_type", string(event.CommandType)),
 	)
 
-	publisher := eventbus.Publish[CommandEvent](client)
-	defer publisher.Close()
-	publisher.Publish(event)
+	publisherFor[CommandEvent](b, client).Publish(event)
+	b.commands.Add(1)
 }
 
-// PublishConnectionStatus emits lifecycle updates for components (web, hap, mqtt, etc.).
+// PublishConnectionStatus emits lifecycle updates for components (web, hap,
+// mqtt, etc.). Updates pass through the connection state machine, which
+// drops repeats and invalid transitions and holds back reconnecting until
+// it has lasted ConnectionDebounce.
 func (b *Bus) PublishConnectionStatus(client *eventbus.Client, event ConnectionStatusEvent) {
+	b.stateMu.Lock()
+	b.statusClients[event.Component] = client
+	b.stateMu.Unlock()
+
+	publish, err := b.connections.Transition(event)
+	if err != nil {
+		b.logger.Warn("dropping connection status", slog.Any("error", err))
+		return
+	}
+	for _, evt := range publish {
+		b.publishConnectionStatus(client, evt)
+	}
+}
+
+func (b *Bus) publishConnectionStatus(client *eventbus.Client, event ConnectionStatusEvent) {
 	b.logger.Debug("publishing connection status",
 		slog.String("component", event.Component),
 		slog.String("status", string(event.Status)),
+		slog.Int("reconnects", event.Reconnects),
 	)
 
-	publisher := eventbus.Publish[ConnectionStatusEvent](client)
-	defer publisher.Close()
-	publisher.Publish(event)
+	b.stateMu.Lock()
+	hooks := b.statusHooks
+	b.stateMu.Unlock()
+
+	for _, fn := range hooks {
+		fn(event)
+	}
+
+	publisherFor[ConnectionStatusEvent](b, client).Publish(event)
+	b.connectionStatuses.Add(1)
+}
+
+// publishDueStatuses publishes reconnecting statuses once their debounce
+// has elapsed, and evicts expired last states.
+func (b *Bus) publishDueStatuses(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, evt := range b.connections.Due(now) {
+				b.stateMu.Lock()
+				client := b.statusClients[evt.Component]
+				b.stateMu.Unlock()
+				b.publishConnectionStatus(client, evt)
+			}
+			b.pruneStates(now)
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
+
+// OnConnectionStatus registers fn to be called with every connection
+// status published through the bus.
+func (b *Bus) OnConnectionStatus(fn func(ConnectionStatusEvent)) {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	b.statusHooks = append(b.statusHooks, fn)
+}
+
+// PublishAlert emits an alert raised or cleared for a device.
+func (b *Bus) PublishAlert(client *eventbus.Client, event AlertEvent) {
+	b.logger.Debug("publishing alert",
+		slog.String("device_id", event.DeviceID),
+		slog.String("kind", string(event.Kind)),
+		slog.Bool("active", event.Active),
+	)
+
+	publisherFor[AlertEvent](b, client).Publish(event)
+	b.alerts.Add(1)
+}
+
+// PublishAction emits an action reported by a device.
+func (b *Bus) PublishAction(client *eventbus.Client, event ActionEvent) {
+	b.logger.Debug("publishing action",
+		slog.String("device_id", event.DeviceID),
+		slog.String("action", event.Action),
+	)
+
+	publisherFor[ActionEvent](b, client).Publish(event)
+	b.actions.Add(1)
+}
+
+// PublishDeviceRegistry emits a device registry change. The last state of
+// a removed device is forgotten, so it is published again if the device
+// comes back.
+func (b *Bus) PublishDeviceRegistry(client *eventbus.Client, event DeviceRegistryEvent) {
+	b.logger.Debug("publishing device registry change",
+		slog.String("device_id", event.DeviceID),
+		slog.String("change", string(event.Change)),
+	)
+
+	if event.Change == DeviceRegistryRemoved {
+		b.ForgetDevice(event.DeviceID)
+	}
+
+	publisherFor[DeviceRegistryEvent](b, client).Publish(event)
+	b.registryChanges.Add(1)
+}
+
+type publisherKey struct {
+	client *eventbus.Client
+	event  reflect.Type
+}
+
+// publisherFor returns the publisher for events of type T on client,
+// creating it on first use. Publishers are kept for the life of the bus;
+// closing the client closes them.
+func publisherFor[T any](b *Bus, client *eventbus.Client) *eventbus.Publisher[T] {
+	key := publisherKey{client: client, event: reflect.TypeFor[T]()}
+
+	b.publisherMu.Lock()
+	defer b.publisherMu.Unlock()
+
+	if p, ok := b.publishers[key]; ok {
+		return p.(*eventbus.Publisher[T])
+	}
+	p := eventbus.Publish[T](client)
+	b.publishers[key] = p
+	return p
+}
+
+// ConnectionStatuses returns the last status published by each component, so
+// subscribers created later can start from the current state.
+func (b *Bus) ConnectionStatuses() []ConnectionStatusEvent {
+	return b.connections.Statuses()
+}
+
+// Stats returns the publish counters and the number of devices with a
+// known last state.
+func (b *Bus) Stats() Stats {
+	b.stateMu.Lock()
+	tracked := len(b.lastStates)
+	b.stateMu.Unlock()
+
+	return Stats{
+		StateUpdates:       b.stateUpdates.Load(),
+		DuplicatesSkipped:  b.duplicatesSkipped.Load(),
+		Commands:           b.commands.Load(),
+		ConnectionStatuses: b.connectionStatuses.Load(),
+		Alerts:             b.alerts.Load(),
+		Actions:            b.actions.Load(),
+		DevicesSeen:        b.devicesSeen.Load(),
+		RegistryChanges:    b.registryChanges.Load(),
+		TrackedDevices:     tracked,
+	}
 }
 
 // Close shuts down the event bus and releases clients.
@@ -4,6 +4,9 @@ import (
 	"log/slog"
 	"os"
 	"testing"
+	"time"
+
+	"tailscale.com/util/eventbus"
 )
 
 func testLogger() *slog.Logger {
@@ -85,6 +88,43 @@ func TestBusClientUnknown(t *testing.T) {
 	}
 }
 
+func TestBusStats(t *testing.T) {
+	bus, err := New(testLogger())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer func() { _ = bus.Close() }()
+
+	client, err := bus.Client(ClientDeviceManager)
+	if err != nil {
+		t.Fatalf("Client() error = %v", err)
+	}
+
+	bus.PublishStateUpdate(client, StateUpdateEvent{DeviceID: "a", Name: "A"})
+	bus.PublishStateUpdate(client, StateUpdateEvent{DeviceID: "a", Name: "A"})
+	bus.PublishStateUpdate(client, StateUpdateEvent{DeviceID: "b", Name: "B"})
+	bus.PublishConnectionStatus(client, ConnectionStatusEvent{Component: "mqtt", Status: ConnectionStatusConnected})
+
+	stats := bus.Stats()
+	if stats.StateUpdates != 2 {
+		t.Errorf("StateUpdates = %d, want 2", stats.StateUpdates)
+	}
+	if stats.DuplicatesSkipped != 1 {
+		t.Errorf("DuplicatesSkipped = %d, want 1", stats.DuplicatesSkipped)
+	}
+	if stats.ConnectionStatuses != 1 {
+		t.Errorf("ConnectionStatuses = %d, want 1", stats.ConnectionStatuses)
+	}
+	if stats.TrackedDevices != 2 {
+		t.Errorf("TrackedDevices = %d, want 2", stats.TrackedDevices)
+	}
+
+	statuses := bus.ConnectionStatuses()
+	if len(statuses) != 1 || statuses[0].Component != "mqtt" {
+		t.Errorf("ConnectionStatuses() = %+v, want the mqtt status", statuses)
+	}
+}
+
 func TestStateUpdateEventEquals(t *testing.T) {
 	temp1 := 22.5
 	temp2 := 23.0
@@ -130,3 +170,259 @@ func TestStateUpdateEventEquals(t *testing.T) {
 		})
 	}
 }
+
+func TestPublishersReused(t *testing.T) {
+	bus, err := New(testLogger())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer func() { _ = bus.Close() }()
+
+	client, err := bus.Client(ClientHAP)
+	if err != nil {
+		t.Fatalf("Client() error = %v", err)
+	}
+	observer, err := bus.Client(ClientMetrics)
+	if err != nil {
+		t.Fatalf("Client() error = %v", err)
+	}
+	commands := eventbus.Subscribe[CommandEvent](observer)
+
+	for _, id := range []string{"a", "b", "c"} {
+		bus.PublishCommand(client, CommandEvent{DeviceID: id, CommandType: CommandTypeSetPower})
+	}
+	for _, want := range []string{"a", "b", "c"} {
+		select {
+		case evt := <-commands.Events():
+			if evt.DeviceID != want {
+				t.Errorf("DeviceID = %q, want %q", evt.DeviceID, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("command for %q not delivered", want)
+		}
+	}
+
+	bus.publisherMu.Lock()
+	publishers := len(bus.publishers)
+	bus.publisherMu.Unlock()
+	if publishers != 1 {
+		t.Errorf("publishers = %d, want 1 reused", publishers)
+	}
+}
+
+func BenchmarkPublisher(b *testing.B) {
+	bus, err := New(testLogger())
+	if err != nil {
+		b.Fatalf("New() error = %v", err)
+	}
+	defer func() { _ = bus.Close() }()
+
+	client, err := bus.Client(ClientHAP)
+	if err != nil {
+		b.Fatalf("Client() error = %v", err)
+	}
+	observer, err := bus.Client(ClientMetrics)
+	if err != nil {
+		b.Fatalf("Client() error = %v", err)
+	}
+	commands := eventbus.Subscribe[CommandEvent](observer)
+	go func() {
+		for {
+			select {
+			case <-commands.Events():
+			case <-commands.Done():
+				return
+			}
+		}
+	}()
+
+	event := CommandEvent{DeviceID: "lamp", CommandType: CommandTypeSetPower}
+
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			publisherFor[CommandEvent](bus, client).Publish(event)
+		}
+	})
+
+	// per-call is how the helpers published before publishers were cached.
+	b.Run("per-call", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			publisher := eventbus.Publish[CommandEvent](client)
+			publisher.Publish(event)
+			publisher.Close()
+		}
+	})
+}
+
+func TestLastStateEviction(t *testing.T) {
+	bus, err := New(testLogger())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer func() { _ = bus.Close() }()
+
+	client, err := bus.Client(ClientDeviceManager)
+	if err != nil {
+		t.Fatalf("Client() error = %v", err)
+	}
+
+	bus.PublishStateUpdate(client, StateUpdateEvent{DeviceID: "a", Name: "A"})
+	bus.PublishStateUpdate(client, StateUpdateEvent{DeviceID: "b", Name: "B"})
+
+	bus.ForgetDevice("a")
+	if got := bus.Stats().TrackedDevices; got != 1 {
+		t.Fatalf("TrackedDevices = %d after ForgetDevice, want 1", got)
+	}
+	bus.PublishStateUpdate(client, StateUpdateEvent{DeviceID: "a", Name: "A"})
+	if got := bus.Stats().StateUpdates; got != 3 {
+		t.Errorf("StateUpdates = %d, want the forgotten device published again", got)
+	}
+
+	// Without a TTL entries are kept.
+	bus.pruneStates(time.Now().Add(24 * time.Hour))
+	if got := bus.Stats().TrackedDevices; got != 2 {
+		t.Fatalf("TrackedDevices = %d without TTL, want 2", got)
+	}
+
+	bus.SetStateTTL(time.Minute)
+	bus.pruneStates(time.Now().Add(30 * time.Second))
+	if got := bus.Stats().TrackedDevices; got != 2 {
+		t.Fatalf("TrackedDevices = %d before TTL, want 2", got)
+	}
+	bus.pruneStates(time.Now().Add(time.Minute))
+	if got := bus.Stats().TrackedDevices; got != 0 {
+		t.Errorf("TrackedDevices = %d after TTL, want 0", got)
+	}
+}
+
+func TestLivenessEventsPublishDeviceSeen(t *testing.T) {
+	bus, err := New(testLogger())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer func() { _ = bus.Close() }()
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	bus.now = func() time.Time { return now }
+	bus.SetLivenessEvents(true)
+
+	client, err := bus.Client(ClientDeviceManager)
+	if err != nil {
+		t.Fatalf("Client() error = %v", err)
+	}
+	observer, err := bus.Client(ClientMetrics)
+	if err != nil {
+		t.Fatalf("Client() error = %v", err)
+	}
+	seen := eventbus.Subscribe[DeviceSeenEvent](observer)
+
+	temp := 21.0
+	linkQuality := 120
+	report := func() {
+		reading := temp
+		bus.PublishStateUpdate(client, StateUpdateEvent{DeviceID: "a", Name: "A", Temperature: &reading, LinkQuality: linkQuality, LastSeen: now, LastUpdated: now})
+	}
+
+	report()
+	for range 4 {
+		now = now.Add(2 * time.Second)
+		linkQuality--
+		report()
+	}
+	stats := bus.Stats()
+	if stats.StateUpdates != 1 || stats.DuplicatesSkipped != 4 || stats.DevicesSeen != 0 {
+		t.Fatalf("stats = %+v, want 1 update, 4 skipped and no device seen within the interval", stats)
+	}
+
+	now = now.Add(2 * time.Second)
+	report()
+	if got := bus.Stats().DevicesSeen; got != 1 {
+		t.Fatalf("DevicesSeen = %d after DeviceSeenInterval, want 1", got)
+	}
+	select {
+	case evt := <-seen.Events():
+		if evt.DeviceID != "a" || !evt.LastSeen.Equal(now) || evt.LinkQuality != linkQuality {
+			t.Errorf("device seen = %+v, want device a last seen %s with link quality %d", evt, now, linkQuality)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("device seen not delivered")
+	}
+
+	temp = 22
+	report()
+	if got := bus.Stats().StateUpdates; got != 2 {
+		t.Errorf("StateUpdates = %d after a state change, want 2", got)
+	}
+
+	bus.SetLivenessEvents(false)
+	now = now.Add(time.Second)
+	report()
+	if got := bus.Stats().StateUpdates; got != 3 {
+		t.Errorf("StateUpdates = %d for a liveness change with liveness events off, want 3", got)
+	}
+}
+
+func TestLivenessEventsPublishConnectionChange(t *testing.T) {
+	bus, err := New(testLogger())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer func() { _ = bus.Close() }()
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	bus.now = func() time.Time { return now }
+	bus.SetLivenessEvents(true)
+
+	client, err := bus.Client(ClientDeviceManager)
+	if err != nil {
+		t.Fatalf("Client() error = %v", err)
+	}
+	observer, err := bus.Client(ClientMetrics)
+	if err != nil {
+		t.Fatalf("Client() error = %v", err)
+	}
+	updates := eventbus.Subscribe[StateUpdateEvent](observer)
+
+	temp := 21.0
+	bus.PublishStateUpdate(client, StateUpdateEvent{DeviceID: "a", Temperature: &temp, LastSeen: now, ConnectionState: "connected"})
+	<-updates.Events()
+
+	// zigbee2mqtt going offline within DeviceSeenInterval of the last
+	// report still takes the device offline.
+	now = now.Add(2 * time.Second)
+	bus.PublishStateUpdate(client, StateUpdateEvent{DeviceID: "a", Temperature: &temp, LastSeen: now.Add(-2 * time.Second), ConnectionState: "disconnected", ConnectionNote: "zigbee2mqtt is offline"})
+	select {
+	case evt := <-updates.Events():
+		if evt.ConnectionState != "disconnected" {
+			t.Errorf("update = %+v, want disconnected", evt)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection change not published")
+	}
+	if stats := bus.Stats(); stats.StateUpdates != 2 || stats.DuplicatesSkipped != 0 {
+		t.Errorf("stats = %+v, want 2 updates and none skipped", stats)
+	}
+}
+
+func TestStateUpdateEventWithSeen(t *testing.T) {
+	on := true
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	state := StateUpdateEvent{DeviceID: "lamp", Name: "Lamp", On: &on, LinkQuality: 80, LastSeen: at, ConnectionState: "connected"}
+	seen := DeviceSeenEvent{DeviceID: "lamp", LinkQuality: 60, LastSeen: at.Add(time.Minute), LastUpdated: at.Add(time.Minute), ConnectionState: "connected", ConnectionNote: "Last seen: 0s ago"}
+
+	merged := state.WithSeen(seen)
+	if !merged.SameState(state) {
+		t.Errorf("WithSeen changed the state: %+v", merged)
+	}
+	if merged.Equals(state) {
+		t.Error("WithSeen did not change liveness")
+	}
+	got := merged.Seen()
+	got.DeviceID, got.Timestamp = seen.DeviceID, seen.Timestamp
+	got.Name = seen.Name
+	if got != seen {
+		t.Errorf("Seen() = %+v, want %+v", got, seen)
+	}
+}
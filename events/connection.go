@@ -0,0 +1,167 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ConnectionDebounce is how long a component may report reconnecting
+// before it is published. A component that recovers within it only
+// counts a reconnect, so brief blips do not flap the UI and alerts.
+const ConnectionDebounce = 2 * time.Second
+
+// ErrInvalidTransition is returned for a status change the connection
+// state machine does not allow.
+var ErrInvalidTransition = errors.New("invalid connection status transition")
+
+// connectionTransitions lists the statuses each status may move to. The
+// empty status is a component that has not reported yet.
+var connectionTransitions = map[ConnectionStatus][]ConnectionStatus{
+	"": {
+		ConnectionStatusConnecting, ConnectionStatusConnected,
+		ConnectionStatusDisconnected, ConnectionStatusFailed,
+	},
+	ConnectionStatusDisconnected: {
+		ConnectionStatusConnecting, ConnectionStatusConnected,
+		ConnectionStatusReconnecting, ConnectionStatusFailed,
+	},
+	ConnectionStatusConnecting: {
+		ConnectionStatusConnected, ConnectionStatusDisconnected,
+		ConnectionStatusReconnecting, ConnectionStatusFailed,
+	},
+	ConnectionStatusConnected: {
+		ConnectionStatusDisconnected, ConnectionStatusReconnecting, ConnectionStatusFailed,
+	},
+	ConnectionStatusReconnecting: {
+		ConnectionStatusConnecting, ConnectionStatusConnected,
+		ConnectionStatusDisconnected, ConnectionStatusFailed,
+	},
+	ConnectionStatusFailed: {
+		ConnectionStatusConnecting, ConnectionStatusConnected,
+		ConnectionStatusReconnecting, ConnectionStatusDisconnected,
+	},
+}
+
+// ConnectionMachine tracks the connection status of every component. It
+// is the single source of truth for component status: it rejects invalid
+// transitions, drops repeats, debounces reconnecting and counts
+// reconnects. It does no I/O; Transition and Due return the events to
+// publish.
+type ConnectionMachine struct {
+	mu         sync.Mutex
+	debounce   time.Duration
+	components map[string]*componentConnection
+}
+
+type componentConnection struct {
+	// current is the last published status.
+	current ConnectionStatusEvent
+	// pending is a reconnecting status held back until the debounce
+	// elapses.
+	pending *ConnectionStatusEvent
+	// connected counts transitions into connected, the first one
+	// excluded from Reconnects.
+	connected int
+}
+
+// NewConnectionMachine returns a machine that holds reconnecting for
+// debounce before publishing it. Zero publishes it immediately.
+func NewConnectionMachine(debounce time.Duration) *ConnectionMachine {
+	return &ConnectionMachine{
+		debounce:   debounce,
+		components: make(map[string]*componentConnection),
+	}
+}
+
+// Transition applies a status reported by a component and returns the
+// events to publish, which may be none. The events carry the component's
+// reconnect count.
+func (m *ConnectionMachine) Transition(evt ConnectionStatusEvent) ([]ConnectionStatusEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.components[evt.Component]
+	if !ok {
+		c = &componentConnection{}
+		m.components[evt.Component] = c
+	}
+
+	last := c.current
+	if c.pending != nil {
+		last = *c.pending
+	}
+	from := last.Status
+	if evt.Status == from {
+		if evt.Attempt == last.Attempt && (evt.Error == "" || evt.Error == last.Error) && evt.Detail == last.Detail {
+			return nil, nil
+		}
+	} else if !slices.Contains(connectionTransitions[from], evt.Status) {
+		return nil, fmt.Errorf("%w: %s from %q to %q", ErrInvalidTransition, evt.Component, from, evt.Status)
+	}
+
+	if evt.Status == ConnectionStatusConnected && from != ConnectionStatusConnected {
+		c.connected++
+	}
+	evt.Reconnects = max(c.connected-1, 0)
+
+	switch {
+	case evt.Status == ConnectionStatusReconnecting && c.pending == nil &&
+		c.current.Status == ConnectionStatusConnected && m.debounce > 0:
+		c.pending = &evt
+		return nil, nil
+	case evt.Status == ConnectionStatusReconnecting && c.pending != nil:
+		// Keep the original time so the debounce is not extended.
+		evt.Timestamp = c.pending.Timestamp
+		c.pending = &evt
+		return nil, nil
+	case evt.Status == ConnectionStatusConnected && c.pending != nil:
+		// Recovered within the debounce: count the reconnect but
+		// publish nothing, the component never looked down.
+		c.pending = nil
+		c.current.Reconnects = evt.Reconnects
+		return nil, nil
+	}
+
+	c.pending = nil
+	c.current = evt
+	return []ConnectionStatusEvent{evt}, nil
+}
+
+// Due returns the held reconnecting statuses whose debounce has elapsed
+// by now, marking them published.
+func (m *ConnectionMachine) Due(now time.Time) []ConnectionStatusEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []ConnectionStatusEvent
+	for _, c := range m.components {
+		if c.pending == nil || now.Sub(c.pending.Timestamp) < m.debounce {
+			continue
+		}
+		c.current = *c.pending
+		c.pending = nil
+		due = append(due, c.current)
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Component < due[j].Component })
+	return due
+}
+
+// Statuses returns the last published status of each component, sorted
+// by component.
+func (m *ConnectionMachine) Statuses() []ConnectionStatusEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]ConnectionStatusEvent, 0, len(m.components))
+	for _, c := range m.components {
+		if c.current.Status != "" {
+			statuses = append(statuses, c.current)
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Component < statuses[j].Component })
+	return statuses
+}
@@ -0,0 +1,251 @@
+package events
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var connectionEpoch = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+type connectionStep struct {
+	status  ConnectionStatus
+	err     string
+	attempt int
+	detail  string
+	// after is the offset from connectionEpoch the status is reported at.
+	after time.Duration
+	// due, when set, runs Due at after instead of reporting a status.
+	due bool
+
+	// want is the statuses published by the step.
+	want    []ConnectionStatus
+	wantErr error
+	// wantReconnects is the reconnect count on the last published event.
+	wantReconnects int
+}
+
+func TestConnectionMachine(t *testing.T) {
+	tests := []struct {
+		name     string
+		debounce time.Duration
+		steps    []connectionStep
+		// final is the status Statuses reports after the last step.
+		final ConnectionStatus
+	}{
+		{
+			name: "startup",
+			steps: []connectionStep{
+				{status: ConnectionStatusConnecting, want: []ConnectionStatus{ConnectionStatusConnecting}},
+				{status: ConnectionStatusConnected, want: []ConnectionStatus{ConnectionStatusConnected}},
+			},
+			final: ConnectionStatusConnected,
+		},
+		{
+			name: "repeat is dropped",
+			steps: []connectionStep{
+				{status: ConnectionStatusConnected, want: []ConnectionStatus{ConnectionStatusConnected}},
+				{status: ConnectionStatusConnected},
+			},
+			final: ConnectionStatusConnected,
+		},
+		{
+			name: "repeat with new error is published",
+			steps: []connectionStep{
+				{status: ConnectionStatusFailed, err: "dial", want: []ConnectionStatus{ConnectionStatusFailed}},
+				{status: ConnectionStatusFailed, err: "dial"},
+				{status: ConnectionStatusFailed, err: "refused", want: []ConnectionStatus{ConnectionStatusFailed}},
+			},
+			final: ConnectionStatusFailed,
+		},
+		{
+			name: "repeat with new detail is published without a reconnect",
+			steps: []connectionStep{
+				{status: ConnectionStatusConnected, detail: "loaded", want: []ConnectionStatus{ConnectionStatusConnected}},
+				{status: ConnectionStatusConnected, detail: "loaded"},
+				{status: ConnectionStatusConnected, detail: "added lamp", want: []ConnectionStatus{ConnectionStatusConnected}},
+			},
+			final: ConnectionStatusConnected,
+		},
+		{
+			name: "connected cannot go back to connecting",
+			steps: []connectionStep{
+				{status: ConnectionStatusConnected, want: []ConnectionStatus{ConnectionStatusConnected}},
+				{status: ConnectionStatusConnecting, wantErr: ErrInvalidTransition},
+			},
+			final: ConnectionStatusConnected,
+		},
+		{
+			name: "failed first attempt retries",
+			steps: []connectionStep{
+				{status: ConnectionStatusConnecting, want: []ConnectionStatus{ConnectionStatusConnecting}},
+				{status: ConnectionStatusReconnecting, err: "address in use", attempt: 1, want: []ConnectionStatus{ConnectionStatusReconnecting}},
+				{status: ConnectionStatusConnected, want: []ConnectionStatus{ConnectionStatusConnected}},
+			},
+			final: ConnectionStatusConnected,
+		},
+		{
+			name: "each reconnect attempt is published",
+			steps: []connectionStep{
+				{status: ConnectionStatusConnected, want: []ConnectionStatus{ConnectionStatusConnected}},
+				{status: ConnectionStatusReconnecting, err: "refused", attempt: 1, want: []ConnectionStatus{ConnectionStatusReconnecting}},
+				{status: ConnectionStatusReconnecting, err: "refused", attempt: 1},
+				{status: ConnectionStatusReconnecting, err: "refused", attempt: 2, want: []ConnectionStatus{ConnectionStatusReconnecting}},
+				{status: ConnectionStatusConnected, want: []ConnectionStatus{ConnectionStatusConnected}, wantReconnects: 1},
+			},
+			final: ConnectionStatusConnected,
+		},
+		{
+			name: "first report cannot be reconnecting",
+			steps: []connectionStep{
+				{status: ConnectionStatusReconnecting, wantErr: ErrInvalidTransition},
+			},
+		},
+		{
+			name: "reconnect without debounce",
+			steps: []connectionStep{
+				{status: ConnectionStatusConnected, want: []ConnectionStatus{ConnectionStatusConnected}},
+				{status: ConnectionStatusReconnecting, want: []ConnectionStatus{ConnectionStatusReconnecting}},
+				{status: ConnectionStatusConnected, want: []ConnectionStatus{ConnectionStatusConnected}, wantReconnects: 1},
+			},
+			final: ConnectionStatusConnected,
+		},
+		{
+			name:     "blip within debounce publishes nothing",
+			debounce: 2 * time.Second,
+			steps: []connectionStep{
+				{status: ConnectionStatusConnected, want: []ConnectionStatus{ConnectionStatusConnected}},
+				{status: ConnectionStatusReconnecting, after: time.Second},
+				{after: 2 * time.Second, due: true},
+				{status: ConnectionStatusConnected, after: 2500 * time.Millisecond},
+				{after: 10 * time.Second, due: true},
+			},
+			final: ConnectionStatusConnected,
+		},
+		{
+			name:     "reconnecting past debounce is published by Due",
+			debounce: 2 * time.Second,
+			steps: []connectionStep{
+				{status: ConnectionStatusConnected, want: []ConnectionStatus{ConnectionStatusConnected}},
+				{status: ConnectionStatusReconnecting, after: time.Second},
+				// A repeat does not extend the debounce.
+				{status: ConnectionStatusReconnecting, after: 2 * time.Second},
+				{after: 3 * time.Second, due: true, want: []ConnectionStatus{ConnectionStatusReconnecting}},
+				{after: 4 * time.Second, due: true},
+				{status: ConnectionStatusConnected, after: 5 * time.Second, want: []ConnectionStatus{ConnectionStatusConnected}, wantReconnects: 1},
+			},
+			final: ConnectionStatusConnected,
+		},
+		{
+			name:     "failure during debounce is published immediately",
+			debounce: 2 * time.Second,
+			steps: []connectionStep{
+				{status: ConnectionStatusConnected, want: []ConnectionStatus{ConnectionStatusConnected}},
+				{status: ConnectionStatusReconnecting, after: time.Second},
+				{status: ConnectionStatusFailed, after: 1500 * time.Millisecond, want: []ConnectionStatus{ConnectionStatusFailed}},
+				{after: 10 * time.Second, due: true},
+			},
+			final: ConnectionStatusFailed,
+		},
+		{
+			name:     "reconnects accumulate across blips",
+			debounce: 2 * time.Second,
+			steps: []connectionStep{
+				{status: ConnectionStatusConnected, want: []ConnectionStatus{ConnectionStatusConnected}},
+				{status: ConnectionStatusReconnecting, after: time.Second},
+				{status: ConnectionStatusConnected, after: 2 * time.Second},
+				{status: ConnectionStatusReconnecting, after: 3 * time.Second},
+				{status: ConnectionStatusConnected, after: 4 * time.Second},
+				{status: ConnectionStatusDisconnected, after: 5 * time.Second, want: []ConnectionStatus{ConnectionStatusDisconnected}, wantReconnects: 2},
+				{status: ConnectionStatusConnected, after: 6 * time.Second, want: []ConnectionStatus{ConnectionStatusConnected}, wantReconnects: 3},
+			},
+			final: ConnectionStatusConnected,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewConnectionMachine(tt.debounce)
+
+			for i, step := range tt.steps {
+				now := connectionEpoch.Add(step.after)
+
+				var got []ConnectionStatusEvent
+				if step.due {
+					got = m.Due(now)
+				} else {
+					var err error
+					got, err = m.Transition(ConnectionStatusEvent{
+						Component: "mqtt",
+						Status:    step.status,
+						Error:     step.err,
+						Attempt:   step.attempt,
+						Detail:    step.detail,
+						Timestamp: now,
+					})
+					if !errors.Is(err, step.wantErr) {
+						t.Fatalf("step %d: Transition(%s) error = %v, want %v", i, step.status, err, step.wantErr)
+					}
+				}
+
+				if len(got) != len(step.want) {
+					t.Fatalf("step %d: published %v, want %v", i, got, step.want)
+				}
+				for j, evt := range got {
+					if evt.Status != step.want[j] {
+						t.Errorf("step %d: published[%d] = %s, want %s", i, j, evt.Status, step.want[j])
+					}
+				}
+				if len(got) > 0 && got[len(got)-1].Reconnects != step.wantReconnects {
+					t.Errorf("step %d: Reconnects = %d, want %d", i, got[len(got)-1].Reconnects, step.wantReconnects)
+				}
+			}
+
+			statuses := m.Statuses()
+			if tt.final == "" {
+				if len(statuses) != 0 {
+					t.Errorf("Statuses() = %v, want none", statuses)
+				}
+				return
+			}
+			if len(statuses) != 1 || statuses[0].Status != tt.final {
+				t.Errorf("Statuses() = %v, want %s", statuses, tt.final)
+			}
+		})
+	}
+}
+
+func TestConnectionTransitionsComplete(t *testing.T) {
+	statuses := []ConnectionStatus{
+		ConnectionStatusDisconnected,
+		ConnectionStatusConnecting,
+		ConnectionStatusConnected,
+		ConnectionStatusReconnecting,
+		ConnectionStatusFailed,
+	}
+	for _, status := range statuses {
+		if _, ok := connectionTransitions[status]; !ok {
+			t.Errorf("connectionTransitions has no entry for %s", status)
+		}
+	}
+}
+
+func TestConnectionMachineStatusesSorted(t *testing.T) {
+	m := NewConnectionMachine(0)
+	for _, component := range []string{"web", "hap", "mqtt"} {
+		if _, err := m.Transition(ConnectionStatusEvent{Component: component, Status: ConnectionStatusConnected}); err != nil {
+			t.Fatalf("Transition(%s) error = %v", component, err)
+		}
+	}
+
+	statuses := m.Statuses()
+	want := []string{"hap", "mqtt", "web"}
+	if len(statuses) != len(want) {
+		t.Fatalf("Statuses() = %v, want %v", statuses, want)
+	}
+	for i, status := range statuses {
+		if status.Component != want[i] {
+			t.Errorf("Statuses()[%d] = %s, want %s", i, status.Component, want[i])
+		}
+	}
+}
@@ -5,6 +5,9 @@ import (
 )
 
 // StateUpdateEvent carries device state for SSE subscribers and HAP updates.
+// It is published when the state changes; a report that only changes
+// liveness (link quality, last seen, connection state) is published as a
+// DeviceSeenEvent instead when liveness events are enabled on the bus.
 type StateUpdateEvent struct {
 	Timestamp time.Time `json:"timestamp"`
 	Source    string    `json:"source"`
@@ -18,10 +21,22 @@ type StateUpdateEvent struct {
 	Occupancy   *bool    `json:"occupancy,omitempty"`
 	Illuminance *int     `json:"illuminance,omitempty"`
 	Pressure    *float64 `json:"pressure,omitempty"`
-	Contact     *bool    `json:"contact,omitempty"`     // true = closed, false = open
-	WaterLeak   *bool    `json:"water_leak,omitempty"`  // true = leak detected
-	Smoke       *bool    `json:"smoke,omitempty"`       // true = smoke detected
-	Tamper      *bool    `json:"tamper,omitempty"`      // true = tampered
+	Contact     *bool    `json:"contact,omitempty"`    // true = closed, false = open
+	WaterLeak   *bool    `json:"water_leak,omitempty"` // true = leak detected
+	Smoke       *bool    `json:"smoke,omitempty"`      // true = smoke detected
+	Tamper      *bool    `json:"tamper,omitempty"`     // true = tampered
+
+	// Derived from recent pressure readings
+	PressureTrend  string   `json:"pressure_trend,omitempty"`  // rising, falling or steady
+	PressureChange *float64 `json:"pressure_change,omitempty"` // hPa per three hours
+	Forecast       string   `json:"forecast,omitempty"`
+
+	// Climate thresholds, unset unless configured
+	FrostWarning *bool `json:"frost_warning,omitempty"`
+	HeatWarning  *bool `json:"heat_warning,omitempty"`
+
+	// Set while an acknowledged leak, smoke or contact alert is silenced
+	AlertAcknowledged bool `json:"alert_acknowledged,omitempty"`
 
 	// Light values
 	On         *bool    `json:"on,omitempty"`
@@ -30,9 +45,31 @@ type StateUpdateEvent struct {
 	Saturation *float64 `json:"saturation,omitempty"` // 0-100
 	ColorTemp  *int     `json:"color_temp,omitempty"` // mireds
 
+	// Outlet values
+	Power   *float64 `json:"power,omitempty"`   // watts
+	Voltage *float64 `json:"voltage,omitempty"` // volts
+	Current *float64 `json:"current,omitempty"` // amperes
+	Energy  *float64 `json:"energy,omitempty"`  // kWh
+
 	// Fan values
 	FanSpeed *int `json:"fan_speed,omitempty"` // 0-100 (percentage)
 
+	// Cover values
+	Position      *int     `json:"position,omitempty"`       // 0-100, 0 = closed
+	Tilt          *int     `json:"tilt,omitempty"`           // 0-100
+	Calibrating   *bool    `json:"calibrating,omitempty"`    // true = learning its travel time
+	TravelTime    *float64 `json:"travel_time,omitempty"`    // seconds end to end
+	MotorReversed *bool    `json:"motor_reversed,omitempty"` // true = direction reversed
+
+	// Security system values
+	ArmMode string `json:"arm_mode,omitempty"` // stay, away, night or disarmed
+	Siren   *bool  `json:"siren,omitempty"`    // true = sounding
+
+	// Firmware update
+	UpdateState     string   `json:"update_state,omitempty"`     // idle, available, scheduled, requested or updating
+	UpdateProgress  *float64 `json:"update_progress,omitempty"`  // percent, while updating
+	UpdateRemaining *int     `json:"update_remaining,omitempty"` // seconds, while updating
+
 	// Connectivity
 	LinkQuality     int       `json:"link_quality"`
 	LastSeen        time.Time `json:"last_seen"`
@@ -49,6 +86,11 @@ const (
 	CommandTypeSetBrightness CommandType = "set_brightness"
 	CommandTypeSetColor      CommandType = "set_color"
 	CommandTypeSetColorTemp  CommandType = "set_color_temp"
+	CommandTypeSetFanSpeed   CommandType = "set_fan_speed"
+	CommandTypeSetPosition   CommandType = "set_position"
+	CommandTypeSetTilt       CommandType = "set_tilt"
+	CommandTypeSetArmMode    CommandType = "set_arm_mode"
+	CommandTypeSetSiren      CommandType = "set_siren"
 )
 
 // CommandEvent captures requested control actions for a device.
@@ -64,11 +106,28 @@ type CommandEvent struct {
 	Hue        *float64 `json:"hue,omitempty"`
 	Saturation *float64 `json:"saturation,omitempty"`
 	ColorTemp  *int     `json:"color_temp,omitempty"`
+	FanSpeed   *int     `json:"fan_speed,omitempty"` // 0-100 (percentage)
+	Position   *int     `json:"position,omitempty"`  // 0-100, 0 = closed
+	Tilt       *int     `json:"tilt,omitempty"`      // 0-100
+	ArmMode    string   `json:"arm_mode,omitempty"`
+	Siren      *bool    `json:"siren,omitempty"`
 }
 
 // Equals determines whether two events carry the same logical state (ignoring timestamp/source).
 func (e StateUpdateEvent) Equals(other StateUpdateEvent) bool {
+	return e.SameState(other) &&
+		e.LinkQuality == other.LinkQuality &&
+		e.LastSeen.Equal(other.LastSeen) &&
+		e.LastUpdated.Equal(other.LastUpdated) &&
+		e.ConnectionNote == other.ConnectionNote
+}
+
+// SameState is Equals without the liveness fields, which change on every
+// report even when the state does not. A change of connection state, such
+// as devices going unavailable with zigbee2mqtt, is a change of state.
+func (e StateUpdateEvent) SameState(other StateUpdateEvent) bool {
 	return e.DeviceID == other.DeviceID &&
+		e.ConnectionState == other.ConnectionState &&
 		e.Name == other.Name &&
 		ptrBoolEqual(e.On, other.On) &&
 		ptrIntEqual(e.Brightness, other.Brightness) &&
@@ -81,16 +140,31 @@ func (e StateUpdateEvent) Equals(other StateUpdateEvent) bool {
 		ptrBoolEqual(e.Occupancy, other.Occupancy) &&
 		ptrIntEqual(e.Illuminance, other.Illuminance) &&
 		ptrFloatEqual(e.Pressure, other.Pressure) &&
+		e.PressureTrend == other.PressureTrend &&
+		ptrFloatEqual(e.PressureChange, other.PressureChange) &&
+		e.Forecast == other.Forecast &&
+		ptrBoolEqual(e.FrostWarning, other.FrostWarning) &&
+		ptrBoolEqual(e.HeatWarning, other.HeatWarning) &&
+		e.AlertAcknowledged == other.AlertAcknowledged &&
 		ptrBoolEqual(e.Contact, other.Contact) &&
 		ptrBoolEqual(e.WaterLeak, other.WaterLeak) &&
 		ptrBoolEqual(e.Smoke, other.Smoke) &&
 		ptrBoolEqual(e.Tamper, other.Tamper) &&
+		ptrFloatEqual(e.Power, other.Power) &&
+		ptrFloatEqual(e.Voltage, other.Voltage) &&
+		ptrFloatEqual(e.Current, other.Current) &&
+		ptrFloatEqual(e.Energy, other.Energy) &&
 		ptrIntEqual(e.FanSpeed, other.FanSpeed) &&
-		e.LinkQuality == other.LinkQuality &&
-		e.LastSeen.Equal(other.LastSeen) &&
-		e.LastUpdated.Equal(other.LastUpdated) &&
-		e.ConnectionState == other.ConnectionState &&
-		e.ConnectionNote == other.ConnectionNote
+		ptrIntEqual(e.Position, other.Position) &&
+		ptrIntEqual(e.Tilt, other.Tilt) &&
+		ptrBoolEqual(e.Calibrating, other.Calibrating) &&
+		ptrFloatEqual(e.TravelTime, other.TravelTime) &&
+		ptrBoolEqual(e.MotorReversed, other.MotorReversed) &&
+		e.ArmMode == other.ArmMode &&
+		ptrBoolEqual(e.Siren, other.Siren) &&
+		e.UpdateState == other.UpdateState &&
+		ptrFloatEqual(e.UpdateProgress, other.UpdateProgress) &&
+		ptrIntEqual(e.UpdateRemaining, other.UpdateRemaining)
 }
 
 func ptrBoolEqual(a, b *bool) bool {
@@ -128,6 +202,44 @@ func ptrFloatEqual(a, b *float64) bool {
 	return diff < eps
 }
 
+// DeviceSeenEvent carries the liveness of a device whose state is
+// unchanged. It is published at most once per DeviceSeenInterval per
+// device, in place of the state updates that only changed liveness.
+type DeviceSeenEvent struct {
+	Timestamp       time.Time `json:"timestamp"`
+	DeviceID        string    `json:"device_id"`
+	Name            string    `json:"name"`
+	LinkQuality     int       `json:"link_quality"`
+	LastSeen        time.Time `json:"last_seen"`
+	LastUpdated     time.Time `json:"last_updated"`
+	ConnectionState string    `json:"connection_state"`
+	ConnectionNote  string    `json:"connection_note"`
+}
+
+// Seen returns the liveness of e.
+func (e StateUpdateEvent) Seen() DeviceSeenEvent {
+	return DeviceSeenEvent{
+		Timestamp:       e.Timestamp,
+		DeviceID:        e.DeviceID,
+		Name:            e.Name,
+		LinkQuality:     e.LinkQuality,
+		LastSeen:        e.LastSeen,
+		LastUpdated:     e.LastUpdated,
+		ConnectionState: e.ConnectionState,
+		ConnectionNote:  e.ConnectionNote,
+	}
+}
+
+// WithSeen returns e with its liveness replaced by seen.
+func (e StateUpdateEvent) WithSeen(seen DeviceSeenEvent) StateUpdateEvent {
+	e.LinkQuality = seen.LinkQuality
+	e.LastSeen = seen.LastSeen
+	e.LastUpdated = seen.LastUpdated
+	e.ConnectionState = seen.ConnectionState
+	e.ConnectionNote = seen.ConnectionNote
+	return e
+}
+
 // ConnectionStatusEvent conveys component lifecycle information (web, HAP, MQTT, etc.).
 type ConnectionStatusEvent struct {
 	Timestamp  time.Time        `json:"timestamp"`
@@ -135,6 +247,13 @@ type ConnectionStatusEvent struct {
 	Status     ConnectionStatus `json:"status"`
 	Error      string           `json:"error"`
 	Reconnects int              `json:"reconnects"`
+	// Attempt and NextRetry are set on reconnecting events: the number
+	// of failed attempts in a row and when the next one starts.
+	Attempt   int       `json:"attempt,omitempty"`
+	NextRetry time.Time `json:"next_retry,omitzero"`
+	// Detail describes what a connected component last did, e.g. what a
+	// devices config reload changed.
+	Detail string `json:"detail,omitempty"`
 }
 
 // ConnectionStatus represents lifecycle state for a component.
@@ -147,3 +266,68 @@ const (
 	ConnectionStatusReconnecting ConnectionStatus = "reconnecting"
 	ConnectionStatusFailed       ConnectionStatus = "failed"
 )
+
+// AlertKind identifies the condition behind an alert.
+type AlertKind string
+
+const (
+	AlertKindLinkQuality AlertKind = "link_quality"
+	AlertKindAnomaly     AlertKind = "anomaly"
+	AlertKindFrost       AlertKind = "frost"
+	AlertKindHeat        AlertKind = "heat"
+	AlertKindLeak        AlertKind = "leak"
+	AlertKindSmoke       AlertKind = "smoke"
+	AlertKindContact     AlertKind = "contact"
+)
+
+// AlertEvent signals a device condition that needs attention. Active is false
+// when a previously raised alert clears.
+type AlertEvent struct {
+	Timestamp time.Time `json:"timestamp"`
+	DeviceID  string    `json:"device_id"`
+	Name      string    `json:"name"`
+	Kind      AlertKind `json:"kind"`
+	Active    bool      `json:"active"`
+	Message   string    `json:"message"`
+
+	// AcknowledgedBy is set on the event recording an acknowledgement.
+	AcknowledgedBy string `json:"acknowledged_by,omitempty"`
+
+	// Silenced is set on non-critical alerts raised during night mode.
+	// They still count as active but are not announced.
+	Silenced bool `json:"silenced,omitempty"`
+}
+
+// ActionEvent is emitted when a device reports a zigbee2mqtt action, such as
+// a remote's "single", "double" or "brightness_move_up". It is the trigger
+// point for action bindings and future rules.
+type ActionEvent struct {
+	Timestamp time.Time `json:"timestamp"`
+	DeviceID  string    `json:"device_id"`
+	Name      string    `json:"name"`
+	Action    string    `json:"action"`
+}
+
+// DeviceRegistryChange is how a device changed in the device registry.
+type DeviceRegistryChange string
+
+const (
+	DeviceRegistryAdded   DeviceRegistryChange = "added"
+	DeviceRegistryRenamed DeviceRegistryChange = "renamed"
+	// DeviceRegistryRemoved is also published when a device leaves the
+	// Zigbee network, as it reports nothing more until it rejoins.
+	DeviceRegistryRemoved DeviceRegistryChange = "removed"
+)
+
+// DeviceRegistryEvent is emitted when a device is added, renamed or
+// removed while the bridge runs, so consumers holding per-device data can
+// drop what is stale.
+type DeviceRegistryEvent struct {
+	Timestamp time.Time            `json:"timestamp"`
+	DeviceID  string               `json:"device_id"`
+	Name      string               `json:"name"`
+	Change    DeviceRegistryChange `json:"change"`
+
+	// PreviousName is set on renamed events.
+	PreviousName string `json:"previous_name,omitempty"`
+}
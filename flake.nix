@@ -17,6 +17,11 @@
 
           buildGoModule = pkgs.buildGoModule.override { go = pkgs.go_1_25; };
 
+          # The release in VERSION with the commit as build metadata, which
+          # HomeKit's firmware revision drops. A dirty tree has no rev.
+          commit = self.rev or self.dirtyRev or "dirty";
+          version = "${lib.fileContents ./VERSION}+${self.shortRev or self.dirtyShortRev or "dirty"}";
+
         in
         {
           # Development shell
@@ -45,7 +50,7 @@
           # Package definition
           packages.default = buildGoModule {
             pname = "z2m-homekit";
-            version = self.rev or "dev";
+            inherit version;
 
             src = ./.;
             subPackages = [ "cmd/z2m-homekit" ];
@@ -54,7 +59,9 @@
             ldflags = [
               "-s"
               "-w"
-              "-X github.com/kradalby/z2m-homekit.version=${self.rev or "dev"}"
+              "-X github.com/kradalby/z2m-homekit.version=${version}"
+              "-X github.com/kradalby/z2m-homekit.commit=${commit}"
+              "-X github.com/kradalby/z2m-homekit.buildDate=${self.lastModifiedDate}"
             ];
 
             meta = with pkgs.lib; {
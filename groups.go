@@ -0,0 +1,141 @@
+package z2mhomekit
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/chasefleming/elem-go"
+	"github.com/chasefleming/elem-go/attrs"
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+// groupPower counts how many members of a group are on.
+func groupPower(g devices.Group, snapshot map[string]struct {
+	Device devices.Device
+	State  devices.State
+},
+) (on, total int) {
+	for _, id := range g.Devices {
+		item, ok := snapshot[id]
+		if !ok {
+			continue
+		}
+		total++
+		if item.State.On != nil && *item.State.On {
+			on++
+		}
+	}
+	return on, total
+}
+
+// renderGroupCard renders a UI group as one card with its aggregate state
+// and a master toggle. Any member on counts as on, so the toggle turns the
+// whole group off.
+func renderGroupCard(g devices.Group, snapshot map[string]struct {
+	Device devices.Device
+	State  devices.State
+},
+) elem.Node {
+	on, total := groupPower(g, snapshot)
+
+	status, statusClass := "All off", "off"
+	switch {
+	case on == total && total > 0:
+		status, statusClass = "All on", "on"
+	case on > 0:
+		status, statusClass = fmt.Sprintf("%d of %d on", on, total), "on"
+	}
+
+	buttonClass, buttonText, buttonAction := "on", "Turn On", "on"
+	if on > 0 {
+		buttonClass, buttonText, buttonAction = "off", "Turn Off", "off"
+	}
+
+	var members []elem.Node
+	for _, id := range g.Devices {
+		item, ok := snapshot[id]
+		if !ok {
+			continue
+		}
+		class := "group-member"
+		if item.State.On != nil && *item.State.On {
+			class += " on"
+		}
+		members = append(members, elem.Span(attrs.Props{attrs.Class: class, "data-member-id": id}, elem.Text(item.Device.Name)))
+	}
+
+	return elem.Div(attrs.Props{attrs.ID: "group-" + g.ID, attrs.Class: "device group " + statusClass, "data-group-id": g.ID},
+		elem.Div(attrs.Props{attrs.Class: "device-header"},
+			elem.Div(attrs.Props{attrs.Class: "device-icon"}, elem.Text("🗂️")),
+			elem.Div(attrs.Props{attrs.Class: "device-info"},
+				elem.Div(attrs.Props{attrs.Class: "device-name"}, elem.Text(g.Name)),
+				elem.Div(attrs.Props{attrs.Class: "device-status", "data-role": "group-status"}, elem.Text(status)),
+			),
+		),
+		elem.Div(attrs.Props{attrs.Class: "group-members"}, members...),
+		elem.Form(attrs.Props{
+			"hx-post":   "/group/toggle/" + g.ID,
+			"hx-target": "#group-" + g.ID,
+			"hx-swap":   "outerHTML",
+		},
+			elem.Input(attrs.Props{attrs.Type: "hidden", attrs.Name: "action", attrs.Value: buttonAction, "data-role": "action-input"}),
+			elem.Button(attrs.Props{attrs.Type: "submit", attrs.Class: buttonClass, "data-role": "toggle-button"}, elem.Text(buttonText)),
+		),
+	)
+}
+
+// HandleGroupToggle switches all members of a UI group on or off.
+func (ws *WebServer) HandleGroupToggle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	groupID := strings.TrimPrefix(r.URL.Path, "/group/toggle/")
+	groups := ws.deviceProvider.Groups()
+	idx := slices.IndexFunc(groups, func(g devices.Group) bool { return g.ID == groupID })
+	if idx < 0 {
+		http.Error(w, "Group not found", http.StatusNotFound)
+		return
+	}
+	group := groups[idx]
+
+	on := r.FormValue("action") == "on"
+	if err := ws.controller.SetGroupPower(r.Context(), groupID, on); err != nil {
+		// Some members may still have switched; report and show the
+		// current state.
+		ws.logger.Error("Group command partly failed", "group_id", groupID, "error", err)
+		ws.LogEvent(fmt.Sprintf("Web UI: Group %s -> %v failed for some devices: %v", group.Name, on, err))
+	} else {
+		ws.LogEvent(fmt.Sprintf("Web UI: Group %s -> %v", group.Name, on))
+	}
+
+	if r.Header.Get("HX-Request") != "true" {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	// Render the requested state rather than the current one, which does
+	// not reflect the members' reports yet.
+	members := make(map[string]struct {
+		Device devices.Device
+		State  devices.State
+	}, len(group.Devices))
+	for _, id := range group.Devices {
+		if device, state, ok := ws.deviceProvider.Device(id); ok {
+			state.On = devices.Ptr(on)
+			members[id] = struct {
+				Device devices.Device
+				State  devices.State
+			}{device, state}
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if _, err := fmt.Fprint(w, renderGroupCard(group, members).Render()); err != nil {
+		ws.logger.Error("Failed to write response", slog.Any("error", err))
+	}
+}
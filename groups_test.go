@@ -0,0 +1,74 @@
+package z2mhomekit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+type groupProvider struct {
+	fakeDeviceProvider
+	groups []devices.Group
+}
+
+func (p groupProvider) Groups() []devices.Group { return p.groups }
+
+func TestRenderGroupCard(t *testing.T) {
+	group := devices.Group{ID: "lounge", Name: "Lounge lights", Devices: []string{"a", "b", "c"}}
+	snapshot := fakeDeviceProvider{
+		"a": {Device: devices.Device{Name: "A"}, State: devices.State{On: devices.Ptr(true)}},
+		"b": {Device: devices.Device{Name: "B"}, State: devices.State{On: devices.Ptr(false)}},
+		"c": {Device: devices.Device{Name: "C"}},
+	}.Snapshot()
+
+	html := renderGroupCard(group, snapshot).Render()
+	if !strings.Contains(html, "1 of 3 on") || !strings.Contains(html, "Turn Off") {
+		t.Errorf("partly lit group rendered as %s", html)
+	}
+
+	snapshot["b"] = struct {
+		Device devices.Device
+		State  devices.State
+	}{devices.Device{Name: "B"}, devices.State{On: devices.Ptr(true)}}
+	snapshot["c"] = snapshot["b"]
+	if html := renderGroupCard(group, snapshot).Render(); !strings.Contains(html, "All on") {
+		t.Errorf("lit group rendered as %s", html)
+	}
+}
+
+func TestHandleGroupToggle(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ctrl := &fakeController{}
+	ws.controller = ctrl
+	ws.deviceProvider = groupProvider{
+		fakeDeviceProvider: fakeDeviceProvider{
+			"a": {Device: devices.Device{ID: "a", Name: "A", Type: devices.DeviceTypeLightbulb}},
+			"b": {Device: devices.Device{ID: "b", Name: "B", Type: devices.DeviceTypeLightbulb}},
+		},
+		groups: []devices.Group{{ID: "lounge", Name: "Lounge", Devices: []string{"a", "b"}}},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/group/toggle/lounge", strings.NewReader("action=on"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("HX-Request", "true")
+	rec := httptest.NewRecorder()
+	ws.HandleGroupToggle(rec, req)
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "All on") {
+		t.Errorf("group toggle = %d %s", rec.Code, rec.Body)
+	}
+	if want := []string{"group lounge true"}; !slices.Equal(ctrl.calls, want) {
+		t.Errorf("controller calls = %v, want %v", ctrl.calls, want)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/group/toggle/missing", nil)
+	rec = httptest.NewRecorder()
+	ws.HandleGroupToggle(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown group = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,227 @@
+package z2mhomekit
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chasefleming/elem-go"
+	"github.com/chasefleming/elem-go/attrs"
+	"github.com/kradalby/z2m-homekit/devices"
+	"github.com/kradalby/z2m-homekit/tokens"
+)
+
+const (
+	// GuestTag marks devices shown on the guest dashboard.
+	GuestTag = "guest"
+
+	guestCookie = "z2mh_guest"
+	// guestCommandInterval and guestCommandBurst limit how fast a guest
+	// token may send commands: a burst, then one per interval.
+	guestCommandInterval = time.Second
+	guestCommandBurst    = 5
+)
+
+var guestCommandLimit = rateLimit{interval: guestCommandInterval, burst: guestCommandBurst}
+
+// guestToken authenticates a guest request from its cookie. Guest access
+// always needs a token, even while the API is still open.
+func (ws *WebServer) guestToken(r *http.Request) (tokens.Token, error) {
+	if ws.tokenStore == nil {
+		return tokens.Token{}, tokens.ErrInvalidToken
+	}
+	cookie, err := r.Cookie(guestCookie)
+	if err != nil {
+		return tokens.Token{}, tokens.ErrInvalidToken
+	}
+	return ws.tokenStore.Authenticate(cookie.Value, tokens.ScopeGuest)
+}
+
+// guestDevices returns the IDs of devices tagged for guests, sorted by name.
+func (ws *WebServer) guestDevices() []string {
+	snapshot := ws.deviceProvider.Snapshot()
+	var ids []string
+	for id, item := range snapshot {
+		if slices.Contains(item.Device.Tags, GuestTag) {
+			ids = append(ids, id)
+		}
+	}
+	slices.SortFunc(ids, func(a, b string) int {
+		return strings.Compare(snapshot[a].Device.Name, snapshot[b].Device.Name)
+	})
+	return ids
+}
+
+// HandleGuest serves the guest dashboard. Opening /guest?token=<secret>
+// stores the token in a cookie so the link can be shared with visitors.
+func (ws *WebServer) HandleGuest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if secret := r.URL.Query().Get("token"); secret != "" {
+		if ws.tokenStore == nil {
+			http.Error(w, "Guest access is not enabled", http.StatusNotFound)
+			return
+		}
+		token, err := ws.tokenStore.Authenticate(secret, tokens.ScopeGuest)
+		if err != nil {
+			http.Error(w, "Invalid guest link", http.StatusUnauthorized)
+			return
+		}
+
+		cookie := &http.Cookie{
+			Name:     guestCookie,
+			Value:    secret,
+			Path:     "/guest",
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		}
+		if !token.ExpiresAt.IsZero() {
+			cookie.Expires = token.ExpiresAt
+		}
+		http.SetCookie(w, cookie)
+		http.Redirect(w, r, "/guest", http.StatusSeeOther)
+		return
+	}
+
+	if _, err := ws.guestToken(r); err != nil {
+		http.Error(w, "Guest link required", http.StatusUnauthorized)
+		return
+	}
+
+	var cards []elem.Node
+	for _, id := range ws.guestDevices() {
+		device, state, ok := ws.deviceProvider.Device(id)
+		if !ok {
+			continue
+		}
+		cards = append(cards, ws.renderGuestDevice(device, state))
+	}
+	if len(cards) == 0 {
+		cards = append(cards, elem.P(attrs.Props{}, elem.Text("No devices are shared with guests.")))
+	}
+
+	content := elem.Div(attrs.Props{attrs.Class: "guest"},
+		elem.H1(attrs.Props{}, elem.Text("Welcome")),
+		elem.Div(attrs.Props{attrs.Class: "devices-grid"}, cards...),
+	)
+
+	page := elem.Html(attrs.Props{},
+		elem.Head(attrs.Props{},
+			elem.Meta(attrs.Props{attrs.Charset: "utf-8"}),
+			elem.Meta(attrs.Props{attrs.Name: "viewport", attrs.Content: "width=device-width, initial-scale=1"}),
+			elem.Title(attrs.Props{}, elem.Text("Guest controls")),
+			elem.Style(attrs.Props{}, elem.Text(cssContent)),
+		),
+		elem.Body(attrs.Props{}, content),
+	)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := fmt.Fprint(w, page.Render()); err != nil {
+		ws.logger.Error("Failed to write guest response", slog.Any("error", err))
+	}
+}
+
+// renderGuestDevice renders a plain card with on/off and brightness controls
+// that work without JavaScript.
+func (ws *WebServer) renderGuestDevice(device devices.Device, state devices.State) elem.Node {
+	status := "Off"
+	if state.On != nil && *state.On {
+		status = "On"
+	}
+
+	children := []elem.Node{
+		elem.Div(attrs.Props{attrs.Class: "device-header"},
+			elem.Div(attrs.Props{attrs.Class: "device-icon"}, elem.Text(ws.getDeviceIcon(device.Type))),
+			elem.Div(attrs.Props{attrs.Class: "device-info"},
+				elem.Div(attrs.Props{attrs.Class: "device-name"}, elem.Text(device.Name)),
+				elem.Div(attrs.Props{attrs.Class: "device-status"}, elem.Text(status)),
+			),
+		),
+	}
+
+	switch device.Type {
+	case devices.DeviceTypeLightbulb, devices.DeviceTypeOutlet, devices.DeviceTypeSwitch, devices.DeviceTypeFan:
+		children = append(children, elem.Form(attrs.Props{attrs.Method: "post", attrs.Action: "/guest/control/" + device.ID, attrs.Class: "guest-controls"},
+			elem.Button(attrs.Props{attrs.Type: "submit", attrs.Name: "action", attrs.Value: "on"}, elem.Text("On")),
+			elem.Button(attrs.Props{attrs.Type: "submit", attrs.Name: "action", attrs.Value: "off"}, elem.Text("Off")),
+		))
+	}
+
+	if device.Type == devices.DeviceTypeLightbulb && device.Features.Brightness {
+		var buttons []elem.Node
+		for _, level := range []int{10, 50, 100} {
+			buttons = append(buttons, elem.Button(attrs.Props{attrs.Type: "submit", attrs.Name: "brightness", attrs.Value: fmt.Sprint(level)},
+				elem.Text(fmt.Sprintf("%d%%", level)),
+			))
+		}
+		children = append(children, elem.Form(attrs.Props{attrs.Method: "post", attrs.Action: "/guest/control/" + device.ID, attrs.Class: "guest-controls"}, buttons...))
+	}
+
+	return elem.Div(attrs.Props{attrs.Class: "device"}, children...)
+}
+
+// HandleGuestControl applies a guest's on/off or brightness command to a
+// device tagged for guests. Commands are rate limited per token.
+func (ws *WebServer) HandleGuestControl(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, err := ws.guestToken(r)
+	if err != nil {
+		http.Error(w, "Guest link required", http.StatusUnauthorized)
+		return
+	}
+
+	deviceID := strings.TrimPrefix(r.URL.Path, "/guest/control/")
+	device, _, ok := ws.deviceProvider.Device(deviceID)
+	if !ok || !slices.Contains(device.Tags, GuestTag) {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	if !ws.guests.allow(token.ID, guestCommandLimit, time.Now()) {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Too many requests, slow down", http.StatusTooManyRequests)
+		return
+	}
+
+	switch {
+	case r.FormValue("action") == "on" || r.FormValue("action") == "off":
+		on := r.FormValue("action") == "on"
+		err = ws.controller.SetPower(r.Context(), deviceID, on)
+		ws.LogEvent(fmt.Sprintf("Guest %q: %s -> %v", token.Name, device.Name, on))
+	case r.FormValue("brightness") != "" && device.Features.Brightness:
+		level, convErr := strconv.Atoi(r.FormValue("brightness"))
+		if convErr != nil || level < 0 || level > 100 {
+			http.Error(w, "Invalid brightness", http.StatusBadRequest)
+			return
+		}
+		err = ws.controller.SetBrightness(r.Context(), deviceID, level)
+		ws.LogEvent(fmt.Sprintf("Guest %q: %s brightness -> %d%%", token.Name, device.Name, level))
+	default:
+		http.Error(w, "Unsupported command", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		if errors.Is(err, devices.ErrValveLocked) || errors.Is(err, devices.ErrDeviceDisabled) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		ws.logger.Error("Guest command failed", "device_id", deviceID, "error", err)
+		http.Error(w, "Command failed", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/guest", http.StatusSeeOther)
+}
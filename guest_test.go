@@ -0,0 +1,107 @@
+package z2mhomekit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/devices"
+	"github.com/kradalby/z2m-homekit/tokens"
+)
+
+func TestGuestDashboard(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	store, err := tokens.Open(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws.SetTokenStore(store)
+	ctrl := &fakeController{}
+	ws.controller = ctrl
+	ws.deviceProvider = fakeDeviceProvider{
+		"guest-lamp": {Device: devices.Device{ID: "guest-lamp", Name: "Guest Lamp", Type: devices.DeviceTypeLightbulb, Tags: []string{"guest"}, Features: devices.DeviceFeatures{Brightness: true}}},
+		"office":     {Device: devices.Device{ID: "office", Name: "Office", Type: devices.DeviceTypeLightbulb}},
+	}
+
+	_, guestSecret, err := store.Create("visitors", []tokens.Scope{tokens.ScopeGuest}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, controlSecret, err := store.Create("ci", []tokens.Scope{tokens.ScopeControl}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	ws.HandleGuest(rec, httptest.NewRequest(http.MethodGet, "/guest?token="+controlSecret, nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("control token on guest link = %d, want 401", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	ws.HandleGuest(rec, httptest.NewRequest(http.MethodGet, "/guest?token="+guestSecret, nil))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("guest link = %d, want 303", rec.Code)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != guestCookie || !cookies[0].HttpOnly {
+		t.Fatalf("guest cookies = %+v", cookies)
+	}
+
+	get := func(c *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/guest", nil)
+		if c != nil {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		ws.HandleGuest(rec, req)
+		return rec
+	}
+	if rec := get(nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("guest page without cookie = %d, want 401", rec.Code)
+	}
+	rec = get(cookies[0])
+	if rec.Code != http.StatusOK {
+		t.Fatalf("guest page = %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "Guest Lamp") || strings.Contains(body, "Office") {
+		t.Error("guest page must show tagged devices only")
+	}
+	if strings.Contains(body, "/tokens") || strings.Contains(body, "/debug") {
+		t.Error("guest page links to admin pages")
+	}
+
+	control := func(id string, form url.Values) int {
+		req := httptest.NewRequest(http.MethodPost, "/guest/control/"+id, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookies[0])
+		rec := httptest.NewRecorder()
+		ws.HandleGuestControl(rec, req)
+		return rec.Code
+	}
+
+	if code := control("office", url.Values{"action": {"on"}}); code != http.StatusNotFound {
+		t.Errorf("untagged device = %d, want 404", code)
+	}
+	if code := control("guest-lamp", url.Values{"brightness": {"50"}}); code != http.StatusSeeOther {
+		t.Errorf("guest brightness = %d, want 303", code)
+	}
+
+	limited := false
+	for range guestCommandBurst + 1 {
+		if control("guest-lamp", url.Values{"action": {"on"}}) == http.StatusTooManyRequests {
+			limited = true
+			break
+		}
+	}
+	if !limited {
+		t.Error("guest commands were not rate limited")
+	}
+	if ctrl.calls[0] != "brightness guest-lamp 50" || ctrl.calls[1] != "power guest-lamp true" {
+		t.Errorf("controller calls = %v", ctrl.calls)
+	}
+}
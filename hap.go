@@ -4,6 +4,10 @@ import (
 	"context"
 	"hash/fnv"
 	"log/slog"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -25,6 +29,7 @@ func hashString(s string) uint64 {
 // AccessoryInfo holds an accessory and its type-specific data
 type AccessoryInfo struct {
 	Accessory  *accessory.A
+	Device     devices.Device
 	DeviceType devices.DeviceType
 	DeviceID   string
 
@@ -37,6 +42,10 @@ type AccessoryInfo struct {
 	Leak        *service.LeakSensor
 	Smoke       *service.SmokeSensor
 
+	// Frost/heat warnings as contact sensors (open = warning active)
+	FrostWarning *service.ContactSensor
+	HeatWarning  *service.ContactSensor
+
 	// Lights
 	Lightbulb        *service.Lightbulb
 	Brightness       *characteristic.Brightness
@@ -46,32 +55,131 @@ type AccessoryInfo struct {
 
 	// Outlets/Switches
 	Outlet *service.Outlet
+	Switch *service.Switch
 
 	// Fans
 	Fan         *service.Fan
 	FanRotation *characteristic.RotationSpeed
+
+	// Covers
+	Cover       *service.WindowCovering
+	CurrentTilt *characteristic.CurrentHorizontalTiltAngle
+	TargetTilt  *characteristic.TargetHorizontalTiltAngle
+
+	// Buttons, in the order of the device's button list
+	Buttons []*service.StatelessProgrammableSwitch
+	// held marks buttons held since their long press, until released.
+	// Only the action loop uses it.
+	held []bool
+
+	// Doorbells
+	Doorbell *service.Doorbell
+
+	// Security systems
+	Security *service.SecuritySystem
+	Siren    *service.Switch
+
+	// Diagnostics
+	Diagnostics *DiagnosticsService
+
+	// sent holds the value last set on each characteristic by UpdateState
+	sentMu sync.Mutex
+	sent   map[*characteristic.C]sentValue
+}
+
+// sentValue is a value UpdateState set and the value it was stored as
+// after hap converted and clamped it.
+type sentValue struct {
+	req    any
+	stored any
+}
+
+// hapFloatEpsilon is how far a float value must move before it is set
+// again; smaller changes are below what HomeKit displays.
+const hapFloatEpsilon = 0.01
+
+// set sets v on c unless it matches the value last set there. Floats match
+// within hapFloatEpsilon. A value changed since, e.g. by a controller, is
+// always overwritten. It reports whether the value was set.
+func (a *AccessoryInfo) set(c *characteristic.C, v any) bool {
+	a.sentMu.Lock()
+	defer a.sentMu.Unlock()
+
+	if last, ok := a.sent[c]; ok && c.Value() == last.stored && sameHAPValue(last.req, v) {
+		return false
+	}
+	c.SetValueRequest(v, nil)
+	if a.sent == nil {
+		a.sent = make(map[*characteristic.C]sentValue)
+	}
+	a.sent[c] = sentValue{req: v, stored: c.Value()}
+	return true
+}
+
+func sameHAPValue(a, b any) bool {
+	af, aok := a.(float64)
+	bf, bok := b.(float64)
+	if aok && bok {
+		return math.Abs(af-bf) < hapFloatEpsilon
+	}
+	return a == b
 }
 
 // HAPManager manages HomeKit accessories and their state synchronization
 type HAPManager struct {
-	bridge          *accessory.Bridge
-	accessories     map[string]*AccessoryInfo
-	accessoryOrder  []string
-	commands        chan devices.CommandEvent
-	deviceManager   *devices.Manager
-	stateSubscriber *eventbus.Subscriber[events.StateUpdateEvent]
-	eventBus        *events.Bus
-	eventClient     *eventbus.Client
-	logger          *slog.Logger
+	bridgeName string
+
+	// mu guards the accessories, which SetDevices replaces while the
+	// bridge runs.
+	mu             sync.RWMutex
+	bridgeInfo     BridgeInfo
+	bridge         *accessory.Bridge
+	accessories    map[string]*AccessoryInfo
+	accessoryOrder []string
+	exposed        []devices.Device // devices the accessories were built for
+
+	// changed is signalled when the accessories are rebuilt, so the HAP
+	// server is restarted with them.
+	changed chan struct{}
+
+	commands         chan devices.CommandEvent
+	deviceManager    *devices.Manager
+	stateSubscriber  *eventbus.Subscriber[events.StateUpdateEvent]
+	actionSubscriber *eventbus.Subscriber[events.ActionEvent]
+	eventBus         *events.Bus
+	eventClient      *eventbus.Client
+	logger           *slog.Logger
+
+	// Night mode switch, nil unless night mode is configured
+	nightMode *accessory.Switch
+
+	// Switches recalling the scenes exposed to HomeKit
+	scenes        []devices.Scene
+	sceneSwitches []*accessory.Switch
 
 	// Runtime info
-	server *hap.Server
+	server atomic.Pointer[hap.Server]
 	store  hap.Store
 
+	// accessoryDB caches the /accessories response
+	accessoryDB accessoryDB
+
+	// updates applies state updates in per-device order
+	updates *updateDispatcher
+
 	// Stats
 	incomingCommands atomic.Uint64
 	outgoingUpdates  atomic.Uint64
+	rejectedWrites   atomic.Uint64
+	throttledWrites  atomic.Uint64
 	lastActivity     atomic.Int64
+	writeMetrics     writeMetrics // nil when not exported
+	throttle         commandThrottle
+
+	// MQTT receipt to HAP characteristic update latency, in nanoseconds
+	updateLatencyCount atomic.Uint64
+	updateLatencyTotal atomic.Int64
+	updateLatencyMax   atomic.Int64
 }
 
 // NewHAPManager creates a new HAP manager with accessories for all devices
@@ -88,42 +196,217 @@ func NewHAPManager(
 		panic(err)
 	}
 
-	// Create bridge accessory
-	bridge := accessory.NewBridge(accessory.Info{
-		Name:         bridgeName,
-		Manufacturer: "z2m-homekit",
-		Model:        "Bridge",
-		SerialNumber: "Z2MB001",
-	})
-
 	hm := &HAPManager{
-		bridge:          bridge,
-		accessories:     make(map[string]*AccessoryInfo),
-		accessoryOrder:  make([]string, 0, len(deviceConfigs)),
-		commands:        commands,
-		deviceManager:   deviceManager,
-		stateSubscriber: eventbus.Subscribe[events.StateUpdateEvent](client),
-		eventBus:        bus,
-		eventClient:     client,
-		logger:          logger,
-	}
-
-	// Create accessory for each device
-	for _, device := range deviceConfigs {
-		// Skip devices that are not enabled for HomeKit
-		if device.HomeKit != nil && !*device.HomeKit {
-			logger.Info("Skipping device for HomeKit", "device_id", device.ID, "name", device.Name)
+		bridgeName:       bridgeName,
+		bridgeInfo:       defaultBridgeInfo,
+		changed:          make(chan struct{}, 1),
+		commands:         commands,
+		deviceManager:    deviceManager,
+		stateSubscriber:  eventbus.Subscribe[events.StateUpdateEvent](client),
+		actionSubscriber: eventbus.Subscribe[events.ActionEvent](client),
+		eventBus:         bus,
+		eventClient:      client,
+		logger:           logger,
+	}
+	hm.updates = newUpdateDispatcher(hapUpdateWorkers, hm.UpdateState)
+
+	hm.build(hm.exposedDevices(deviceConfigs))
+
+	if deviceManager != nil && deviceManager.NightModeConfigured() {
+		deviceManager.OnNightModeChange(func(active bool) {
+			hm.mu.RLock()
+			sw := hm.nightMode
+			hm.mu.RUnlock()
+			sw.Switch.On.SetValue(active)
+		})
+	}
+
+	return hm
+}
+
+// exposedDevices returns the devices of configs exposed on this bridge.
+func (hm *HAPManager) exposedDevices(configs []devices.Device) []devices.Device {
+	var exposed []devices.Device
+	for _, device := range configs {
+		// Skip devices that are not enabled for HomeKit or not exposed on
+		// this bridge
+		if !device.ExposedOn(hm.bridgeName) {
+			hm.logger.Info("Skipping device for HomeKit", "device_id", device.ID, "name", device.Name, "bridge", hm.bridgeName)
 			continue
 		}
+		exposed = append(exposed, device)
+	}
+	return exposed
+}
+
+// build creates the bridge accessory and an accessory for each device,
+// replacing any built before. A HAP server registers notification
+// handlers on the accessories it serves that cannot be removed, so a new
+// server needs new accessories.
+func (hm *HAPManager) build(exposed []devices.Device) {
+	hm.mu.RLock()
+	info := hm.bridgeInfo
+	hm.mu.RUnlock()
+	bridge := accessory.NewBridge(accessory.Info{
+		Name:         hm.bridgeName,
+		Manufacturer: info.Manufacturer,
+		Model:        info.Model,
+		SerialNumber: info.SerialNumber,
+		Firmware:     firmwareRevision(version),
+	})
 
+	accessories := make(map[string]*AccessoryInfo, len(exposed))
+	order := make([]string, 0, len(exposed))
+	for _, device := range exposed {
 		accInfo := hm.createAccessory(device)
 		if accInfo != nil {
-			hm.accessories[device.ID] = accInfo
-			hm.accessoryOrder = append(hm.accessoryOrder, device.ID)
+			accessories[device.ID] = accInfo
+			order = append(order, device.ID)
 		}
 	}
 
-	return hm
+	var nightMode *accessory.Switch
+	if hm.deviceManager != nil && hm.deviceManager.NightModeConfigured() {
+		nightMode = hm.createNightModeSwitch()
+	}
+
+	scenes := hm.homeKitScenes()
+	sceneSwitches := make([]*accessory.Switch, 0, len(scenes))
+	for _, scene := range scenes {
+		sceneSwitches = append(sceneSwitches, hm.createSceneSwitch(scene))
+	}
+
+	hm.mu.Lock()
+	hm.bridge = bridge
+	hm.accessories = accessories
+	hm.accessoryOrder = order
+	hm.nightMode = nightMode
+	hm.scenes = scenes
+	hm.sceneSwitches = sceneSwitches
+	hm.exposed = exposed
+	hm.mu.Unlock()
+}
+
+// accessory returns the accessory of a device.
+func (hm *HAPManager) accessory(deviceID string) (*AccessoryInfo, bool) {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+	accInfo, ok := hm.accessories[deviceID]
+	return accInfo, ok
+}
+
+// accessoryInfos returns the device accessories in bridge order.
+func (hm *HAPManager) accessoryInfos() []*AccessoryInfo {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+	infos := make([]*AccessoryInfo, 0, len(hm.accessoryOrder))
+	for _, deviceID := range hm.accessoryOrder {
+		if accInfo, ok := hm.accessories[deviceID]; ok && accInfo.Accessory != nil {
+			infos = append(infos, accInfo)
+		}
+	}
+	return infos
+}
+
+// createNightModeSwitch exposes night mode as a switch so it can be driven
+// from HomeKit scenes and automations.
+func (hm *HAPManager) createNightModeSwitch() *accessory.Switch {
+	sw := accessory.NewSwitch(accessory.Info{
+		Name:         "Night Mode",
+		Manufacturer: "z2m-homekit",
+		Model:        "Night Mode",
+		SerialNumber: "night_mode",
+		Firmware:     firmwareRevision(version),
+	})
+	sw.Id = hashString("night_mode")
+	sw.Switch.On.SetValue(hm.deviceManager.NightModeActive())
+
+	sw.Switch.On.OnValueRemoteUpdate(func(on bool) {
+		hm.logger.Info("HomeKit night mode command received", "on", on)
+		hm.incomingCommands.Add(1)
+		hm.lastActivity.Store(time.Now().Unix())
+
+		if err := hm.deviceManager.SetNightMode(on); err != nil {
+			hm.logger.Error("Failed to set night mode", "error", err)
+		}
+	})
+
+	return sw
+}
+
+// sceneSwitchReset is how long a scene switch stays on after recalling
+// its scene.
+const sceneSwitchReset = time.Second
+
+// homeKitScenes returns the scenes exposed to HomeKit, with only what
+// their switches are built from.
+func (hm *HAPManager) homeKitScenes() []devices.Scene {
+	if hm.deviceManager == nil {
+		return nil
+	}
+	var scenes []devices.Scene
+	for _, s := range hm.deviceManager.Scenes() {
+		if s.HomeKit {
+			scenes = append(scenes, devices.Scene{ID: s.ID, Name: s.Name, HomeKit: true})
+		}
+	}
+	return scenes
+}
+
+// createSceneSwitch exposes a scene as a switch that recalls it and then
+// turns itself off, so it can be used like a scene button.
+func (hm *HAPManager) createSceneSwitch(scene devices.Scene) *accessory.Switch {
+	sw := accessory.NewSwitch(accessory.Info{
+		Name:         scene.Name,
+		Manufacturer: "z2m-homekit",
+		Model:        "Scene",
+		SerialNumber: "scene_" + scene.ID,
+		Firmware:     firmwareRevision(version),
+	})
+	sw.Id = hashString("scene_" + scene.ID)
+
+	sw.Switch.On.OnValueRemoteUpdate(func(on bool) {
+		if !on {
+			return
+		}
+		hm.logger.Info("HomeKit scene recall received", "scene_id", scene.ID)
+		hm.incomingCommands.Add(1)
+		hm.lastActivity.Store(time.Now().Unix())
+
+		if err := hm.deviceManager.RecallScene(scene.ID); err != nil {
+			hm.logger.Error("Failed to recall scene", "scene_id", scene.ID, "error", err)
+		}
+		time.AfterFunc(sceneSwitchReset, func() { sw.Switch.On.SetValue(false) })
+	})
+
+	return sw
+}
+
+// accessoryCategories maps configured categories to HAP accessory types.
+var accessoryCategories = map[devices.Category]byte{
+	devices.CategoryOther:              accessory.TypeOther,
+	devices.CategoryFan:                accessory.TypeFan,
+	devices.CategoryGarageDoor:         accessory.TypeGarageDoorOpener,
+	devices.CategoryLightbulb:          accessory.TypeLightbulb,
+	devices.CategoryDoorLock:           accessory.TypeDoorLock,
+	devices.CategoryOutlet:             accessory.TypeOutlet,
+	devices.CategorySwitch:             accessory.TypeSwitch,
+	devices.CategoryThermostat:         accessory.TypeThermostat,
+	devices.CategorySensor:             accessory.TypeSensor,
+	devices.CategorySecuritySystem:     accessory.TypeSecuritySystem,
+	devices.CategoryDoor:               accessory.TypeDoor,
+	devices.CategoryWindow:             accessory.TypeWindow,
+	devices.CategoryWindowCovering:     accessory.TypeWindowCovering,
+	devices.CategoryProgrammableSwitch: accessory.TypeProgrammableSwitch,
+	devices.CategoryVideoDoorbell:      accessory.TypeVideoDoorbell,
+	devices.CategoryAirPurifier:        accessory.TypeAirPurifier,
+	devices.CategoryHeater:             accessory.TypeHeater,
+	devices.CategoryAirConditioner:     accessory.TypeAirConditioner,
+	devices.CategoryHumidifier:         accessory.TypeHumidifier,
+	devices.CategoryDehumidifier:       accessory.TypeDehumidifier,
+	devices.CategorySprinkler:          accessory.TypeSprinkler,
+	devices.CategoryFaucet:             accessory.TypeFaucet,
+	devices.CategoryShowerSystem:       accessory.TypeShowerSystem,
 }
 
 func (hm *HAPManager) createAccessory(device devices.Device) *AccessoryInfo {
@@ -135,6 +418,7 @@ func (hm *HAPManager) createAccessory(device devices.Device) *AccessoryInfo {
 	}
 
 	accInfo := &AccessoryInfo{
+		Device:     device,
 		DeviceType: device.Type,
 		DeviceID:   device.ID,
 	}
@@ -153,15 +437,48 @@ func (hm *HAPManager) createAccessory(device devices.Device) *AccessoryInfo {
 	case devices.DeviceTypeLightbulb:
 		accInfo.Accessory = hm.createLightbulb(info, device, accInfo)
 	case devices.DeviceTypeOutlet, devices.DeviceTypeSwitch:
-		accInfo.Accessory = hm.createOutlet(info, device, accInfo)
+		switch device.HomeKitPresentation() {
+		case devices.PresentationSwitch:
+			accInfo.Accessory = hm.createSwitch(info, device, accInfo)
+		case devices.PresentationFan:
+			accInfo.Accessory = hm.createFan(info, device, accInfo)
+		case devices.PresentationLightbulb:
+			accInfo.Accessory = hm.createLightbulb(info, device, accInfo)
+		default:
+			accInfo.Accessory = hm.createOutlet(info, device, accInfo)
+		}
 	case devices.DeviceTypeFan:
 		accInfo.Accessory = hm.createFan(info, device, accInfo)
+	case devices.DeviceTypeCover:
+		accInfo.Accessory = hm.createCover(info, device, accInfo)
+	case devices.DeviceTypeButton:
+		accInfo.Accessory = hm.createButton(info, device, accInfo)
+	case devices.DeviceTypeSecuritySystem:
+		accInfo.Accessory = hm.createSecuritySystem(info, device, accInfo)
+	case devices.DeviceTypeDoorbell:
+		accInfo.Accessory = hm.createDoorbell(info, device, accInfo)
 	default:
 		hm.logger.Warn("Unknown device type", "device_id", device.ID, "type", device.Type)
 		return nil
 	}
 
 	if accInfo.Accessory != nil {
+		nameServices(accInfo.Accessory, device.Name)
+
+		diagnostics := NewDiagnosticsService()
+		if raisesAlerts(device) {
+			diagnostics.AddAlertAcknowledged()
+		}
+		accInfo.Accessory.AddS(diagnostics.S)
+		accInfo.Diagnostics = diagnostics
+		hm.failWhileUnavailable(accInfo.Accessory, device.ID)
+		hm.limitWrites(accInfo.Accessory, device.ID)
+		hm.validateWrites(accInfo.Accessory, device.ID)
+
+		if device.Category != "" {
+			accInfo.Accessory.Type = accessoryCategories[device.Category]
+		}
+
 		accInfo.Accessory.Id = hashString(device.ID)
 		hm.logger.Info("Created HomeKit accessory",
 			"device_id", device.ID,
@@ -174,6 +491,36 @@ func (hm *HAPManager) createAccessory(device devices.Device) *AccessoryInfo {
 	return accInfo
 }
 
+// failWhileUnavailable makes reads fail while zigbee2mqtt is offline or
+// the device is disabled, so HomeKit shows the accessory as "No Response"
+// rather than its last known state. Accessory information stays readable
+// so it can still be identified. Writes are not refused here; the device
+// manager holds them until zigbee2mqtt returns, or refuses them for a
+// disabled device.
+func (hm *HAPManager) failWhileUnavailable(a *accessory.A, deviceID string) {
+	if hm.deviceManager == nil {
+		return
+	}
+
+	for _, s := range a.Ss {
+		if s.Type == service.TypeAccessoryInformation {
+			continue
+		}
+		for _, c := range s.Cs {
+			next := c.ValueRequestFunc
+			c.ValueRequestFunc = func(r *http.Request) (any, int) {
+				if !hm.deviceManager.Z2MOnline() || hm.deviceManager.DeviceDisabled(deviceID) {
+					return nil, hap.JsonStatusServiceCommunicationFailure
+				}
+				if next != nil {
+					return next(r)
+				}
+				return c.Value(), hap.JsonStatusSuccess
+			}
+		}
+	}
+}
+
 func (hm *HAPManager) createClimateSensor(info accessory.Info, device devices.Device, accInfo *AccessoryInfo) *accessory.A {
 	a := accessory.New(info, accessory.TypeSensor)
 
@@ -198,9 +545,91 @@ func (hm *HAPManager) createClimateSensor(info accessory.Info, device devices.De
 		accInfo.Battery = battery
 	}
 
+	if device.FrostBelow != nil {
+		accInfo.FrostWarning = newWarningSensor(device.Name + " Frost")
+		a.AddS(accInfo.FrostWarning.S)
+	}
+	if device.HeatAbove != nil {
+		accInfo.HeatWarning = newWarningSensor(device.Name + " Heat")
+		a.AddS(accInfo.HeatWarning.S)
+	}
+
 	return a
 }
 
+// serviceLabels are the spoken names of services, appended to the device
+// name when an accessory has several, e.g. "Kitchen Temperature".
+var serviceLabels = map[string]string{
+	service.TypeContactSensor:               "Contact",
+	service.TypeDoorbell:                    "Doorbell",
+	service.TypeFan:                         "Fan",
+	service.TypeHumiditySensor:              "Humidity",
+	service.TypeLeakSensor:                  "Leak",
+	service.TypeLightbulb:                   "Light",
+	service.TypeOccupancySensor:             "Occupancy",
+	service.TypeOutlet:                      "Outlet",
+	service.TypeSecuritySystem:              "Security",
+	service.TypeSmokeSensor:                 "Smoke",
+	service.TypeStatelessProgrammableSwitch: "Button",
+	service.TypeSwitch:                      "Switch",
+	service.TypeTemperatureSensor:           "Temperature",
+	service.TypeWindowCovering:              "Window Covering",
+}
+
+// nameServices names each service of an accessory with several, so the
+// Home app and Siri tell them apart instead of repeating the accessory
+// name. Services already named, like buttons and warning sensors, get
+// the device name in front unless they carry it. Both Name and
+// ConfiguredName are set, as newer Home apps show the latter.
+func nameServices(a *accessory.A, deviceName string) {
+	var named []*service.S
+	for _, s := range a.Ss {
+		if _, ok := serviceLabels[s.Type]; ok {
+			named = append(named, s)
+		}
+	}
+	if len(named) < 2 {
+		return
+	}
+
+	for _, s := range named {
+		var nameC *characteristic.C
+		for _, c := range s.Cs {
+			if c.Type == characteristic.TypeName {
+				nameC = c
+			}
+		}
+
+		label := serviceLabels[s.Type]
+		if nameC != nil {
+			label, _ = nameC.Value().(string)
+		} else {
+			n := characteristic.NewName()
+			nameC = n.C
+			s.AddC(nameC)
+		}
+		if !strings.HasPrefix(label, deviceName) {
+			label = deviceName + " " + label
+		}
+		nameC.SetValueRequest(label, nil)
+
+		configured := characteristic.NewConfiguredName()
+		configured.SetValue(label)
+		s.AddC(configured.C)
+	}
+}
+
+// newWarningSensor creates a named contact sensor that starts closed (no
+// warning).
+func newWarningSensor(name string) *service.ContactSensor {
+	s := service.NewContactSensor()
+	n := characteristic.NewName()
+	n.SetValue(name)
+	s.AddC(n.C)
+	s.ContactSensorState.SetValue(characteristic.ContactSensorStateContactDetected)
+	return s
+}
+
 func (hm *HAPManager) createOccupancySensor(info accessory.Info, device devices.Device, accInfo *AccessoryInfo) *accessory.A {
 	a := accessory.New(info, accessory.TypeSensor)
 
@@ -284,11 +713,11 @@ func (hm *HAPManager) createFan(info accessory.Info, device devices.Device, accI
 		hm.incomingCommands.Add(1)
 		hm.lastActivity.Store(time.Now().Unix())
 
-		hm.commands <- devices.CommandEvent{
+		hm.sendCommand(devices.CommandEvent{
 			DeviceID: deviceID,
 			On:       devices.Ptr(on),
-		}
-		hm.publishCommand(deviceID, events.CommandTypeSetPower, devices.Ptr(on), nil, nil, nil, nil)
+		})
+		hm.publishCommand(events.CommandEvent{DeviceID: deviceID, CommandType: events.CommandTypeSetPower, On: devices.Ptr(on)})
 	})
 
 	// Add rotation speed if speed feature enabled
@@ -303,14 +732,266 @@ func (hm *HAPManager) createFan(info accessory.Info, device devices.Device, accI
 			hm.incomingCommands.Add(1)
 			hm.lastActivity.Store(time.Now().Unix())
 
-			hm.commands <- devices.CommandEvent{
-				DeviceID:   deviceID,
-				Brightness: devices.Ptr(speed), // Reuse brightness field for fan speed
+			hm.sendCommand(devices.CommandEvent{
+				DeviceID: deviceID,
+				FanSpeed: devices.Ptr(speed),
+			})
+			hm.publishCommand(events.CommandEvent{DeviceID: deviceID, CommandType: events.CommandTypeSetFanSpeed, FanSpeed: devices.Ptr(speed)})
+		})
+	}
+
+	return a
+}
+
+func (hm *HAPManager) createCover(info accessory.Info, device devices.Device, accInfo *AccessoryInfo) *accessory.A {
+	a := accessory.New(info, accessory.TypeWindowCovering)
+
+	cover := service.NewWindowCovering()
+	cover.PositionState.SetValue(characteristic.PositionStateStopped)
+	a.AddS(cover.S)
+	accInfo.Cover = cover
+
+	deviceID := device.ID
+
+	cover.TargetPosition.OnValueRemoteUpdate(func(position int) {
+		hm.logger.Info("HomeKit cover position command received", "device_id", deviceID, "position", position)
+		hm.incomingCommands.Add(1)
+		hm.lastActivity.Store(time.Now().Unix())
+
+		hm.sendCommand(devices.CommandEvent{
+			DeviceID: deviceID,
+			Position: devices.Ptr(position),
+		})
+		hm.publishCommand(events.CommandEvent{DeviceID: deviceID, CommandType: events.CommandTypeSetPosition, Position: devices.Ptr(position)})
+	})
+
+	// Add slat tilt if tilt feature enabled
+	if device.Features.Tilt {
+		currentTilt := characteristic.NewCurrentHorizontalTiltAngle()
+		targetTilt := characteristic.NewTargetHorizontalTiltAngle()
+		cover.AddC(currentTilt.C)
+		cover.AddC(targetTilt.C)
+		accInfo.CurrentTilt = currentTilt
+		accInfo.TargetTilt = targetTilt
+
+		targetTilt.OnValueRemoteUpdate(func(angle int) {
+			tilt := devices.TiltFromAngle(angle)
+			hm.logger.Info("HomeKit cover tilt command received", "device_id", deviceID, "angle", angle, "tilt", tilt)
+			hm.incomingCommands.Add(1)
+			hm.lastActivity.Store(time.Now().Unix())
+
+			hm.sendCommand(devices.CommandEvent{
+				DeviceID: deviceID,
+				Tilt:     devices.Ptr(tilt),
+			})
+			hm.publishCommand(events.CommandEvent{DeviceID: deviceID, CommandType: events.CommandTypeSetTilt, Tilt: devices.Ptr(tilt)})
+		})
+	}
+
+	// Add battery service if feature enabled
+	if device.Features.Battery {
+		battery := service.NewBatteryService()
+		a.AddS(battery.S)
+		accInfo.Battery = battery
+	}
+
+	return a
+}
+
+// createButton exposes each button of a remote as a stateless
+// programmable switch, so HomeKit automations can react to presses.
+func (hm *HAPManager) createButton(info accessory.Info, device devices.Device, accInfo *AccessoryInfo) *accessory.A {
+	a := accessory.New(info, accessory.TypeProgrammableSwitch)
+
+	buttons := device.ButtonList()
+	for i, b := range buttons {
+		sw := service.NewStatelessProgrammableSwitch()
+		for _, press := range b.Presses() {
+			sw.ProgrammableSwitchEvent.ValidVals = append(sw.ProgrammableSwitchEvent.ValidVals, int(press))
+		}
+
+		// Several buttons are told apart by their label index.
+		if len(buttons) > 1 {
+			name := characteristic.NewName()
+			name.SetValue(b.Name)
+			sw.AddC(name.C)
+
+			index := characteristic.NewServiceLabelIndex()
+			index.SetValue(i + 1)
+			sw.AddC(index.C)
+		}
+
+		a.AddS(sw.S)
+		accInfo.Buttons = append(accInfo.Buttons, sw)
+	}
+	accInfo.held = make([]bool, len(buttons))
+
+	if len(buttons) > 1 {
+		label := service.NewServiceLabel()
+		label.ServiceLabelNamespace.SetValue(characteristic.ServiceLabelNamespaceArabicNumerals)
+		a.AddS(label.S)
+	}
+
+	// Add battery service if feature enabled
+	if device.Features.Battery {
+		battery := service.NewBatteryService()
+		a.AddS(battery.S)
+		accInfo.Battery = battery
+	}
+
+	return a
+}
+
+// createDoorbell exposes a doorbell button as a HomeKit doorbell, so a
+// single press plays the doorbell chime on HomePods. HomeKit has no
+// category for a doorbell without a camera; the video doorbell category is
+// what HomeKit shows doorbells as.
+func (hm *HAPManager) createDoorbell(info accessory.Info, device devices.Device, accInfo *AccessoryInfo) *accessory.A {
+	a := accessory.New(info, accessory.TypeVideoDoorbell)
+
+	doorbell := service.NewDoorbell()
+	doorbell.Primary = true
+	for _, press := range device.ButtonList()[0].Presses() {
+		doorbell.ProgrammableSwitchEvent.ValidVals = append(doorbell.ProgrammableSwitchEvent.ValidVals, int(press))
+	}
+	a.AddS(doorbell.S)
+	accInfo.Doorbell = doorbell
+
+	// Add battery service if feature enabled
+	if device.Features.Battery {
+		battery := service.NewBatteryService()
+		a.AddS(battery.S)
+		accInfo.Battery = battery
+	}
+
+	return a
+}
+
+// pressButton reports an action of a button or doorbell device to
+// HomeKit as a press.
+func (hm *HAPManager) pressButton(event events.ActionEvent) {
+	accInfo, ok := hm.accessory(event.DeviceID)
+	if !ok || (len(accInfo.Buttons) == 0 && accInfo.Doorbell == nil) {
+		return
+	}
+
+	for _, i := range accInfo.Device.ButtonRelease(event.Action) {
+		if i < len(accInfo.held) {
+			accInfo.held[i] = false
+		}
+	}
+
+	index, press, ok := accInfo.Device.ButtonPress(event.Action)
+	if !ok {
+		return
+	}
+
+	// A button with a release is held until it is released; remotes
+	// repeating the hold action while held report one long press.
+	if press == devices.ButtonPressLong && index < len(accInfo.held) && accInfo.Device.ButtonList()[index].Release != "" {
+		if accInfo.held[index] {
+			return
+		}
+		accInfo.held[index] = true
+	}
+
+	hm.logger.Debug("HomeKit button press", "device_id", event.DeviceID, "action", event.Action, "button", index, "press", press)
+	switch {
+	case accInfo.Doorbell != nil:
+		accInfo.Doorbell.ProgrammableSwitchEvent.SetValue(int(press))
+	case index < len(accInfo.Buttons):
+		accInfo.Buttons[index].ProgrammableSwitchEvent.SetValue(int(press))
+	default:
+		return
+	}
+	hm.outgoingUpdates.Add(1)
+	hm.lastActivity.Store(time.Now().Unix())
+}
+
+// securityTargetStates maps arm modes to SecuritySystemTargetState values.
+var securityTargetStates = map[devices.ArmMode]int{
+	devices.ArmModeStay:     characteristic.SecuritySystemTargetStateStayArm,
+	devices.ArmModeAway:     characteristic.SecuritySystemTargetStateAwayArm,
+	devices.ArmModeNight:    characteristic.SecuritySystemTargetStateNightArm,
+	devices.ArmModeDisarmed: characteristic.SecuritySystemTargetStateDisarm,
+}
+
+// securityCurrentState returns the SecuritySystemCurrentState for an arm
+// mode, or alarm triggered while the siren sounds. The current and target
+// values share numbering for the arm modes.
+func securityCurrentState(mode devices.ArmMode, siren bool) int {
+	if siren {
+		return characteristic.SecuritySystemCurrentStateAlarmTriggered
+	}
+	if state, ok := securityTargetStates[mode]; ok {
+		return state
+	}
+	return characteristic.SecuritySystemCurrentStateDisarmed
+}
+
+func (hm *HAPManager) createSecuritySystem(info accessory.Info, device devices.Device, accInfo *AccessoryInfo) *accessory.A {
+	a := accessory.New(info, accessory.TypeSecuritySystem)
+
+	security := service.NewSecuritySystem()
+	security.SecuritySystemCurrentState.SetValue(characteristic.SecuritySystemCurrentStateDisarmed)
+	security.SecuritySystemTargetState.SetValue(characteristic.SecuritySystemTargetStateDisarm)
+	a.AddS(security.S)
+	accInfo.Security = security
+
+	deviceID := device.ID
+
+	security.SecuritySystemTargetState.OnValueRemoteUpdate(func(target int) {
+		var mode devices.ArmMode
+		for m, v := range securityTargetStates {
+			if v == target {
+				mode = m
 			}
-			hm.publishCommand(deviceID, events.CommandTypeSetBrightness, nil, devices.Ptr(speed), nil, nil, nil)
+		}
+		if mode == "" {
+			hm.logger.Warn("Invalid HomeKit security system target", "device_id", deviceID, "target", target)
+			return
+		}
+
+		hm.logger.Info("HomeKit arm mode command received", "device_id", deviceID, "mode", mode)
+		hm.incomingCommands.Add(1)
+		hm.lastActivity.Store(time.Now().Unix())
+
+		hm.sendCommand(devices.CommandEvent{
+			DeviceID: deviceID,
+			ArmMode:  devices.Ptr(mode),
+		})
+		hm.publishCommand(events.CommandEvent{DeviceID: deviceID, CommandType: events.CommandTypeSetArmMode, ArmMode: string(mode)})
+	})
+
+	// HomeKit cannot trigger a security system, so the siren is a switch
+	if device.Features.Siren || device.Features.Alarm {
+		siren := service.NewSwitch()
+		name := characteristic.NewName()
+		name.SetValue("Siren")
+		siren.AddC(name.C)
+		a.AddS(siren.S)
+		accInfo.Siren = siren
+
+		siren.On.OnValueRemoteUpdate(func(on bool) {
+			hm.logger.Info("HomeKit siren command received", "device_id", deviceID, "on", on)
+			hm.incomingCommands.Add(1)
+			hm.lastActivity.Store(time.Now().Unix())
+
+			hm.sendCommand(devices.CommandEvent{
+				DeviceID: deviceID,
+				Siren:    devices.Ptr(on),
+			})
+			hm.publishCommand(events.CommandEvent{DeviceID: deviceID, CommandType: events.CommandTypeSetSiren, Siren: devices.Ptr(on)})
 		})
 	}
 
+	// Add battery service if feature enabled
+	if device.Features.Battery {
+		battery := service.NewBatteryService()
+		a.AddS(battery.S)
+		accInfo.Battery = battery
+	}
+
 	return a
 }
 
@@ -329,11 +1010,11 @@ func (hm *HAPManager) createLightbulb(info accessory.Info, device devices.Device
 		hm.incomingCommands.Add(1)
 		hm.lastActivity.Store(time.Now().Unix())
 
-		hm.commands <- devices.CommandEvent{
+		hm.sendCommand(devices.CommandEvent{
 			DeviceID: deviceID,
 			On:       devices.Ptr(on),
-		}
-		hm.publishCommand(deviceID, events.CommandTypeSetPower, devices.Ptr(on), nil, nil, nil, nil)
+		})
+		hm.publishCommand(events.CommandEvent{DeviceID: deviceID, CommandType: events.CommandTypeSetPower, On: devices.Ptr(on)})
 	})
 
 	// Add brightness if feature enabled
@@ -347,11 +1028,11 @@ func (hm *HAPManager) createLightbulb(info accessory.Info, device devices.Device
 			hm.incomingCommands.Add(1)
 			hm.lastActivity.Store(time.Now().Unix())
 
-			hm.commands <- devices.CommandEvent{
+			hm.sendCommand(devices.CommandEvent{
 				DeviceID:   deviceID,
 				Brightness: devices.Ptr(value),
-			}
-			hm.publishCommand(deviceID, events.CommandTypeSetBrightness, nil, devices.Ptr(value), nil, nil, nil)
+			})
+			hm.publishCommand(events.CommandEvent{DeviceID: deviceID, CommandType: events.CommandTypeSetBrightness, Brightness: devices.Ptr(value)})
 		})
 	}
 
@@ -371,12 +1052,12 @@ func (hm *HAPManager) createLightbulb(info accessory.Info, device devices.Device
 
 			// Get current saturation
 			currentSat := saturation.Value()
-			hm.commands <- devices.CommandEvent{
+			hm.sendCommand(devices.CommandEvent{
 				DeviceID:   deviceID,
 				Hue:        devices.Ptr(value),
 				Saturation: devices.Ptr(currentSat),
-			}
-			hm.publishCommand(deviceID, events.CommandTypeSetColor, nil, nil, devices.Ptr(value), devices.Ptr(currentSat), nil)
+			})
+			hm.publishCommand(events.CommandEvent{DeviceID: deviceID, CommandType: events.CommandTypeSetColor, Hue: devices.Ptr(value), Saturation: devices.Ptr(currentSat)})
 		})
 
 		saturation.OnValueRemoteUpdate(func(value float64) {
@@ -386,18 +1067,23 @@ func (hm *HAPManager) createLightbulb(info accessory.Info, device devices.Device
 
 			// Get current hue
 			currentHue := hue.Value()
-			hm.commands <- devices.CommandEvent{
+			hm.sendCommand(devices.CommandEvent{
 				DeviceID:   deviceID,
 				Hue:        devices.Ptr(currentHue),
 				Saturation: devices.Ptr(value),
-			}
-			hm.publishCommand(deviceID, events.CommandTypeSetColor, nil, nil, devices.Ptr(currentHue), devices.Ptr(value), nil)
+			})
+			hm.publishCommand(events.CommandEvent{DeviceID: deviceID, CommandType: events.CommandTypeSetColor, Hue: devices.Ptr(currentHue), Saturation: devices.Ptr(value)})
 		})
 	}
 
 	// Add color temperature if feature enabled
 	if device.Features.ColorTemperature {
 		colorTemp := characteristic.NewColorTemperature()
+		if r := device.ColorTempRange; r != nil {
+			colorTemp.SetMinValue(r.Min)
+			colorTemp.SetMaxValue(r.Max)
+			colorTemp.SetValue(r.Min)
+		}
 		lightbulb.AddC(colorTemp.C)
 		accInfo.ColorTemperature = colorTemp
 
@@ -406,11 +1092,11 @@ func (hm *HAPManager) createLightbulb(info accessory.Info, device devices.Device
 			hm.incomingCommands.Add(1)
 			hm.lastActivity.Store(time.Now().Unix())
 
-			hm.commands <- devices.CommandEvent{
+			hm.sendCommand(devices.CommandEvent{
 				DeviceID:  deviceID,
 				ColorTemp: devices.Ptr(value),
-			}
-			hm.publishCommand(deviceID, events.CommandTypeSetColorTemp, nil, nil, nil, nil, devices.Ptr(value))
+			})
+			hm.publishCommand(events.CommandEvent{DeviceID: deviceID, CommandType: events.CommandTypeSetColorTemp, ColorTemp: devices.Ptr(value)})
 		})
 	}
 
@@ -428,35 +1114,61 @@ func (hm *HAPManager) createOutlet(info accessory.Info, device devices.Device, a
 		hm.incomingCommands.Add(1)
 		hm.lastActivity.Store(time.Now().Unix())
 
-		hm.commands <- devices.CommandEvent{
+		hm.sendCommand(devices.CommandEvent{
 			DeviceID: deviceID,
 			On:       devices.Ptr(on),
-		}
-		hm.publishCommand(deviceID, events.CommandTypeSetPower, devices.Ptr(on), nil, nil, nil, nil)
+		})
+		hm.publishCommand(events.CommandEvent{DeviceID: deviceID, CommandType: events.CommandTypeSetPower, On: devices.Ptr(on)})
 	})
 
 	return outlet.A
 }
 
+func (hm *HAPManager) createSwitch(info accessory.Info, device devices.Device, accInfo *AccessoryInfo) *accessory.A {
+	sw := accessory.NewSwitch(info)
+	accInfo.Switch = sw.Switch
+
+	deviceID := device.ID
+
+	sw.Switch.On.OnValueRemoteUpdate(func(on bool) {
+		hm.logger.Info("HomeKit switch command received", "device_id", deviceID, "on", on)
+		hm.incomingCommands.Add(1)
+		hm.lastActivity.Store(time.Now().Unix())
+
+		hm.sendCommand(devices.CommandEvent{
+			DeviceID: deviceID,
+			On:       devices.Ptr(on),
+		})
+		hm.publishCommand(events.CommandEvent{DeviceID: deviceID, CommandType: events.CommandTypeSetPower, On: devices.Ptr(on)})
+	})
+
+	return sw.A
+}
+
 // GetAccessories returns all accessories for the HAP server
 func (hm *HAPManager) GetAccessories() []*accessory.A {
 	var accessories []*accessory.A
+	hm.mu.RLock()
 	accessories = append(accessories, hm.bridge.A)
-	for _, deviceID := range hm.accessoryOrder {
-		accInfo, ok := hm.accessories[deviceID]
-		if !ok || accInfo.Accessory == nil {
-			continue
-		}
+	nightMode := hm.nightMode
+	sceneSwitches := hm.sceneSwitches
+	hm.mu.RUnlock()
+	for _, accInfo := range hm.accessoryInfos() {
 		accessories = append(accessories, accInfo.Accessory)
 	}
+	if nightMode != nil {
+		accessories = append(accessories, nightMode.A)
+	}
+	for _, sw := range sceneSwitches {
+		accessories = append(accessories, sw.A)
+	}
 	return accessories
 }
 
-// UpdateState updates the HomeKit state for a device
-//
-//nolint:errcheck // HAP characteristic SetValue errors are not actionable here
+// UpdateState updates the HomeKit state for a device. Values that have not
+// changed are not set again, so controllers are only notified of changes.
 func (hm *HAPManager) UpdateState(event events.StateUpdateEvent) {
-	accInfo, exists := hm.accessories[event.DeviceID]
+	accInfo, exists := hm.accessory(event.DeviceID)
 	if !exists {
 		hm.logger.Debug("Accessory not found for device", "device_id", event.DeviceID)
 		return
@@ -464,11 +1176,11 @@ func (hm *HAPManager) UpdateState(event events.StateUpdateEvent) {
 
 	// Update sensor values
 	if accInfo.Temperature != nil && event.Temperature != nil {
-		accInfo.Temperature.CurrentTemperature.SetValue(*event.Temperature)
+		accInfo.set(accInfo.Temperature.CurrentTemperature.C, *event.Temperature)
 	}
 
 	if accInfo.Humidity != nil && event.Humidity != nil {
-		accInfo.Humidity.CurrentRelativeHumidity.SetValue(*event.Humidity)
+		accInfo.set(accInfo.Humidity.CurrentRelativeHumidity.C, *event.Humidity)
 	}
 
 	if accInfo.Occupancy != nil && event.Occupancy != nil {
@@ -476,17 +1188,17 @@ func (hm *HAPManager) UpdateState(event events.StateUpdateEvent) {
 		if *event.Occupancy {
 			val = 1
 		}
-		accInfo.Occupancy.OccupancyDetected.SetValue(val)
+		accInfo.set(accInfo.Occupancy.OccupancyDetected.C, val)
 	}
 
 	if accInfo.Battery != nil && event.Battery != nil {
-		accInfo.Battery.BatteryLevel.SetValue(*event.Battery)
+		accInfo.set(accInfo.Battery.BatteryLevel.C, *event.Battery)
 		// Set low battery status
 		lowBattery := 0
 		if *event.Battery < 20 {
 			lowBattery = 1
 		}
-		accInfo.Battery.StatusLowBattery.SetValue(lowBattery)
+		accInfo.set(accInfo.Battery.StatusLowBattery.C, lowBattery)
 	}
 
 	// Update contact sensor (door/window)
@@ -497,7 +1209,25 @@ func (hm *HAPManager) UpdateState(event events.StateUpdateEvent) {
 		if *event.Contact {
 			val = 0 // Closed (detected)
 		}
-		accInfo.Contact.ContactSensorState.SetValue(val)
+		accInfo.set(accInfo.Contact.ContactSensorState.C, val)
+	}
+
+	// Update frost/heat warnings: open (not detected) while active
+	for _, w := range []struct {
+		sensor *service.ContactSensor
+		active *bool
+	}{
+		{accInfo.FrostWarning, event.FrostWarning},
+		{accInfo.HeatWarning, event.HeatWarning},
+	} {
+		if w.sensor == nil || w.active == nil {
+			continue
+		}
+		val := characteristic.ContactSensorStateContactDetected
+		if *w.active {
+			val = characteristic.ContactSensorStateContactNotDetected
+		}
+		accInfo.set(w.sensor.ContactSensorState.C, val)
 	}
 
 	// Update leak sensor
@@ -507,7 +1237,7 @@ func (hm *HAPManager) UpdateState(event events.StateUpdateEvent) {
 		if *event.WaterLeak {
 			val = 1
 		}
-		accInfo.Leak.LeakDetected.SetValue(val)
+		accInfo.set(accInfo.Leak.LeakDetected.C, val)
 	}
 
 	// Update smoke sensor
@@ -517,47 +1247,98 @@ func (hm *HAPManager) UpdateState(event events.StateUpdateEvent) {
 		if *event.Smoke {
 			val = 1
 		}
-		accInfo.Smoke.SmokeDetected.SetValue(val)
+		accInfo.set(accInfo.Smoke.SmokeDetected.C, val)
 	}
 
 	// Update light values
 	if accInfo.Lightbulb != nil && event.On != nil {
-		accInfo.Lightbulb.On.SetValue(*event.On)
+		accInfo.set(accInfo.Lightbulb.On.C, *event.On)
 	}
 
 	// Update outlet values
 	if accInfo.Outlet != nil && event.On != nil {
-		accInfo.Outlet.On.SetValue(*event.On)
+		accInfo.set(accInfo.Outlet.On.C, *event.On)
+	}
+
+	if accInfo.Outlet != nil {
+		if inUse, ok := accInfo.Device.OutletInUse(event.On, event.Power); ok {
+			accInfo.set(accInfo.Outlet.OutletInUse.C, inUse)
+		}
+	}
+
+	if accInfo.Switch != nil && event.On != nil {
+		accInfo.set(accInfo.Switch.On.C, *event.On)
 	}
 
 	if accInfo.Brightness != nil && event.Brightness != nil {
-		accInfo.Brightness.SetValue(*event.Brightness)
+		accInfo.set(accInfo.Brightness.C, *event.Brightness)
 	}
 
 	if accInfo.Hue != nil && event.Hue != nil {
-		accInfo.Hue.SetValue(*event.Hue)
+		accInfo.set(accInfo.Hue.C, *event.Hue)
 	}
 
 	if accInfo.Saturation != nil && event.Saturation != nil {
-		accInfo.Saturation.SetValue(*event.Saturation)
+		accInfo.set(accInfo.Saturation.C, *event.Saturation)
 	}
 
 	if accInfo.ColorTemperature != nil && event.ColorTemp != nil {
-		accInfo.ColorTemperature.SetValue(devices.ClampColorTemp(*event.ColorTemp))
+		accInfo.set(accInfo.ColorTemperature.C, devices.ClampColorTemp(*event.ColorTemp))
 	}
 
 	// Update fan values
 	if accInfo.Fan != nil && event.On != nil {
-		accInfo.Fan.On.SetValue(*event.On)
+		accInfo.set(accInfo.Fan.On.C, *event.On)
 	}
 
 	if accInfo.FanRotation != nil && event.FanSpeed != nil {
-		accInfo.FanRotation.SetValue(float64(*event.FanSpeed))
+		accInfo.set(accInfo.FanRotation.C, float64(*event.FanSpeed))
+	}
+
+	// Update cover values. zigbee2mqtt reports the position as the cover
+	// moves, so the target follows it and the cover reads as stopped.
+	if accInfo.Cover != nil && event.Position != nil {
+		accInfo.set(accInfo.Cover.CurrentPosition.C, *event.Position)
+		accInfo.set(accInfo.Cover.TargetPosition.C, *event.Position)
+	}
+
+	// Update security system values. The bridge keeps the arm mode, so the
+	// target follows it too.
+	if accInfo.Security != nil && (event.ArmMode != "" || event.Siren != nil) {
+		mode := devices.ArmMode(event.ArmMode)
+		if target, ok := securityTargetStates[mode]; ok {
+			accInfo.set(accInfo.Security.SecuritySystemTargetState.C, target)
+		}
+		accInfo.set(accInfo.Security.SecuritySystemCurrentState.C, securityCurrentState(mode, event.Siren != nil && *event.Siren))
+	}
+
+	if accInfo.Siren != nil && event.Siren != nil {
+		accInfo.set(accInfo.Siren.On.C, *event.Siren)
+	}
+
+	if accInfo.CurrentTilt != nil && event.Tilt != nil {
+		angle := devices.TiltAngle(*event.Tilt)
+		accInfo.set(accInfo.CurrentTilt.C, angle)
+		accInfo.set(accInfo.TargetTilt.C, angle)
+	}
+
+	if accInfo.Diagnostics != nil && event.LinkQuality > 0 {
+		accInfo.set(accInfo.Diagnostics.LinkQuality.C, event.LinkQuality)
+	}
+
+	if accInfo.Diagnostics != nil && accInfo.Diagnostics.AlertAcknowledged != nil {
+		accInfo.set(accInfo.Diagnostics.AlertAcknowledged.C, event.AlertAcknowledged)
 	}
 
 	hm.outgoingUpdates.Add(1)
 	hm.lastActivity.Store(time.Now().Unix())
 
+	// LastSeen is stamped when the MQTT message is parsed, so this covers
+	// the full MQTT to HAP path for updates reported by zigbee2mqtt.
+	if event.Source == "eventbus" && !event.LastSeen.IsZero() {
+		hm.observeUpdateLatency(time.Since(event.LastSeen))
+	}
+
 	hm.logger.Debug("Updated HomeKit state",
 		"device_id", event.DeviceID,
 	)
@@ -568,54 +1349,78 @@ func (hm *HAPManager) Start(ctx context.Context) {
 	go hm.ProcessStateChanges(ctx)
 }
 
-// Close releases subscriptions.
+// Close releases subscriptions and waits for queued updates to be
+// applied.
 func (hm *HAPManager) Close() {
 	hm.stateSubscriber.Close()
+	hm.actionSubscriber.Close()
+	hm.updates.wait()
 }
 
+// SetServer attaches the HAP server, serving /accessories from the
+// attribute database cache, which is built now so the first controller to
+// connect does not wait for it.
 func (hm *HAPManager) SetServer(s *hap.Server) {
-	hm.server = s
+	hm.server.Store(s)
+	s.ServeMux().HandleFunc("/accessories", hm.handleAccessories)
+	hm.warmAccessoryDB()
 }
 
 func (hm *HAPManager) SetStore(s hap.Store) {
 	hm.store = s
 }
 
+// Paired reports whether at least one controller is paired with the bridge.
+func (hm *HAPManager) Paired() bool {
+	s := hm.server.Load()
+	return s != nil && s.IsPaired()
+}
+
 func (hm *HAPManager) ProcessStateChanges(ctx context.Context) {
 	for {
 		select {
 		case event := <-hm.stateSubscriber.Events():
 			hm.logger.Debug("Received state update event", "device_id", event.DeviceID)
-			hm.UpdateState(event)
+			if !hm.updates.dispatch(event) {
+				hm.logger.Debug("HomeKit updates falling behind, dropped oldest", "device_id", event.DeviceID)
+			}
+		case event := <-hm.actionSubscriber.Events():
+			hm.pressButton(event)
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func (hm *HAPManager) publishCommand(
-	deviceID string,
-	cmdType events.CommandType,
-	on *bool,
-	brightness *int,
-	hue, saturation *float64,
-	colorTemp *int,
-) {
+// sendCommand queues a HomeKit write for the device manager, logging it
+// first so it survives a crash before it reaches zigbee2mqtt.
+func (hm *HAPManager) sendCommand(cmd devices.CommandEvent) {
+	if hm.deviceManager != nil {
+		hm.deviceManager.QueueCommand(cmd)
+		return
+	}
+	hm.commands <- cmd
+}
+
+func (hm *HAPManager) publishCommand(event events.CommandEvent) {
 	if hm.eventBus == nil || hm.eventClient == nil {
 		return
 	}
 
-	hm.eventBus.PublishCommand(hm.eventClient, events.CommandEvent{
-		Timestamp:   time.Now(),
-		Source:      "homekit",
-		DeviceID:    deviceID,
-		CommandType: cmdType,
-		On:          on,
-		Brightness:  brightness,
-		Hue:         hue,
-		Saturation:  saturation,
-		ColorTemp:   colorTemp,
-	})
+	event.Timestamp = time.Now()
+	event.Source = "homekit"
+	hm.eventBus.PublishCommand(hm.eventClient, event)
+}
+
+func (hm *HAPManager) observeUpdateLatency(d time.Duration) {
+	hm.updateLatencyCount.Add(1)
+	hm.updateLatencyTotal.Add(int64(d))
+	for {
+		current := hm.updateLatencyMax.Load()
+		if int64(d) <= current || hm.updateLatencyMax.CompareAndSwap(current, int64(d)) {
+			return
+		}
+	}
 }
 
 // Stats returns HAP manager statistics
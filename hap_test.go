@@ -0,0 +1,476 @@
+package z2mhomekit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+	"github.com/kradalby/z2m-homekit/devices"
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+func TestAccessoriesNotRespondingWhileZ2MOffline(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	configs := []devices.Device{{ID: "lamp", Name: "Lamp", Topic: "lamp", Type: devices.DeviceTypeLightbulb}}
+	dm := newTestDeviceManager(t, bus, configs, nil)
+	hm := NewHAPManager(configs, "Test Bridge", nil, dm, bus, logger)
+	lamp := hm.accessories["lamp"]
+	on := lamp.Lightbulb.On
+	req := httptest.NewRequest("GET", "/characteristics", nil)
+
+	if _, status := on.ValueRequest(req); status != hap.JsonStatusSuccess {
+		t.Fatalf("online read status = %d", status)
+	}
+
+	dm.SetZ2MOnline(false)
+	if _, status := on.ValueRequest(req); status != hap.JsonStatusServiceCommunicationFailure {
+		t.Errorf("offline read status = %d, want communication failure", status)
+	}
+	for _, s := range lamp.Accessory.Ss {
+		if s.Type != service.TypeAccessoryInformation {
+			continue
+		}
+		for _, c := range s.Cs {
+			if !c.IsReadable() {
+				continue
+			}
+			if _, status := c.ValueRequest(req); status != hap.JsonStatusSuccess {
+				t.Errorf("accessory information read status = %d while offline", status)
+			}
+		}
+	}
+
+	dm.SetZ2MOnline(true)
+	if _, status := on.ValueRequest(req); status != hap.JsonStatusSuccess {
+		t.Errorf("read status after recovery = %d", status)
+	}
+}
+
+func TestUpdateStateSkipsUnchangedValues(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	configs := []devices.Device{
+		{ID: "lamp", Name: "Lamp", Topic: "lamp", Type: devices.DeviceTypeLightbulb},
+		{ID: "climate", Name: "Climate", Topic: "climate", Type: devices.DeviceTypeClimateSensor, Features: devices.DeviceFeatures{Temperature: true}},
+	}
+	hm := NewHAPManager(configs, "Test Bridge", nil, nil, bus, logger)
+	lamp := hm.accessories["lamp"]
+	climate := hm.accessories["climate"]
+
+	var onUpdates, tempUpdates int
+	lamp.Lightbulb.On.OnCValueUpdate(func(*characteristic.C, any, any, *http.Request) { onUpdates++ })
+	climate.Temperature.CurrentTemperature.OnCValueUpdate(func(*characteristic.C, any, any, *http.Request) { tempUpdates++ })
+
+	on := true
+	temp := 21.5
+	update := func() {
+		hm.UpdateState(events.StateUpdateEvent{DeviceID: "lamp", On: &on})
+		hm.UpdateState(events.StateUpdateEvent{DeviceID: "climate", Temperature: &temp})
+	}
+
+	update()
+	if onUpdates != 1 || tempUpdates != 1 {
+		t.Fatalf("updates = %d/%d after first state, want 1/1", onUpdates, tempUpdates)
+	}
+
+	temp = 21.504
+	update()
+	if onUpdates != 1 || tempUpdates != 1 {
+		t.Errorf("updates = %d/%d after unchanged state, want 1/1", onUpdates, tempUpdates)
+	}
+	if got := climate.Temperature.CurrentTemperature.Value(); got != 21.5 {
+		t.Errorf("temperature = %v, want 21.5 kept", got)
+	}
+
+	temp = 22
+	update()
+	if tempUpdates != 2 {
+		t.Errorf("temperature updates = %d after change, want 2", tempUpdates)
+	}
+
+	// A controller turning the lamp off must not hide the next report.
+	lamp.Lightbulb.On.SetValue(false)
+	update()
+	if !lamp.Lightbulb.On.Value() {
+		t.Error("on = false, want the reported state set again")
+	}
+}
+
+func TestUpdateStateCover(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	configs := []devices.Device{{
+		ID: "blind", Name: "Blind", Topic: "blind", Type: devices.DeviceTypeCover,
+		Features: devices.DeviceFeatures{Position: true, Tilt: true},
+	}}
+	hm := NewHAPManager(configs, "Test Bridge", nil, nil, bus, logger)
+	blind := hm.accessories["blind"]
+	if blind.Cover == nil || blind.CurrentTilt == nil {
+		t.Fatal("cover accessory missing window covering or tilt")
+	}
+
+	hm.UpdateState(events.StateUpdateEvent{DeviceID: "blind", Position: devices.Ptr(40), Tilt: devices.Ptr(75)})
+
+	if got := blind.Cover.CurrentPosition.Value(); got != 40 {
+		t.Errorf("current position = %d, want 40", got)
+	}
+	if got := blind.Cover.TargetPosition.Value(); got != 40 {
+		t.Errorf("target position = %d, want 40", got)
+	}
+	if got := blind.Cover.PositionState.Value(); got != characteristic.PositionStateStopped {
+		t.Errorf("position state = %d, want stopped", got)
+	}
+	if got := blind.CurrentTilt.Value(); got != 45 {
+		t.Errorf("tilt angle = %d, want 45", got)
+	}
+}
+
+func TestCategoryOverride(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	configs := []devices.Device{
+		{ID: "lamp", Name: "Lamp", Topic: "lamp", Type: devices.DeviceTypeOutlet, Category: devices.CategoryLightbulb},
+		{ID: "window", Name: "Window", Topic: "window", Type: devices.DeviceTypeContactSensor, Category: devices.CategoryWindow},
+	}
+	hm := NewHAPManager(configs, "Test Bridge", nil, nil, bus, logger)
+
+	lamp := hm.accessories["lamp"]
+	if lamp.Lightbulb == nil || lamp.Outlet != nil {
+		t.Fatal("outlet in the lightbulb category not exposed as a lightbulb")
+	}
+	if lamp.Accessory.Type != accessory.TypeLightbulb {
+		t.Errorf("lamp category = %d, want lightbulb", lamp.Accessory.Type)
+	}
+	hm.UpdateState(events.StateUpdateEvent{DeviceID: "lamp", On: devices.Ptr(true)})
+	if !lamp.Lightbulb.On.Value() {
+		t.Error("lamp not switched on")
+	}
+
+	window := hm.accessories["window"]
+	if window.Contact == nil || window.Accessory.Type != accessory.TypeWindow {
+		t.Errorf("window = contact %v, category %d, want a contact sensor in the window category", window.Contact != nil, window.Accessory.Type)
+	}
+
+	for _, c := range devices.Categories {
+		if _, ok := accessoryCategories[c]; !ok {
+			t.Errorf("category %q has no accessory type", c)
+		}
+	}
+}
+
+func TestServiceNames(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	configs := []devices.Device{
+		{
+			ID: "kitchen", Name: "Kitchen", Topic: "kitchen", Type: devices.DeviceTypeClimateSensor,
+			Features:   devices.DeviceFeatures{Temperature: true, Humidity: true, Battery: true},
+			FrostBelow: devices.Ptr(2.0),
+		},
+		{ID: "plug", Name: "Plug", Topic: "plug", Type: devices.DeviceTypeOutlet},
+		{
+			ID: "alarm", Name: "Alarm", Topic: "alarm", Type: devices.DeviceTypeSecuritySystem,
+			Features: devices.DeviceFeatures{Siren: true},
+		},
+	}
+	hm := NewHAPManager(configs, "Test Bridge", nil, nil, bus, logger)
+
+	names := func(id string) map[string][]string {
+		accInfo, _ := hm.accessory(id)
+		got := make(map[string][]string)
+		for _, s := range accInfo.Accessory.Ss {
+			for _, c := range s.Cs {
+				if c.Type == characteristic.TypeName || c.Type == characteristic.TypeConfiguredName {
+					got[s.Type] = append(got[s.Type], c.Value().(string))
+				}
+			}
+		}
+		return got
+	}
+
+	tests := []struct {
+		device, service string
+		want            []string
+	}{
+		{"kitchen", service.TypeTemperatureSensor, []string{"Kitchen Temperature", "Kitchen Temperature"}},
+		{"kitchen", service.TypeHumiditySensor, []string{"Kitchen Humidity", "Kitchen Humidity"}},
+		{"kitchen", service.TypeBatteryService, nil},
+		{"plug", service.TypeOutlet, nil},
+		{"alarm", service.TypeSecuritySystem, []string{"Alarm Security", "Alarm Security"}},
+		{"alarm", service.TypeSwitch, []string{"Alarm Siren", "Alarm Siren"}},
+	}
+	for _, tt := range tests {
+		if got := names(tt.device)[tt.service]; !slices.Equal(got, tt.want) {
+			t.Errorf("%s service %s names = %v, want %v", tt.device, tt.service, got, tt.want)
+		}
+	}
+
+	// The frost warning sensor already carries the device name.
+	if got := names("kitchen")[service.TypeContactSensor]; !slices.Equal(got, []string{"Kitchen Frost", "Kitchen Frost"}) {
+		t.Errorf("frost warning names = %v, want Kitchen Frost", got)
+	}
+}
+
+func TestButtonPressReachesHomeKit(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	configs := []devices.Device{{
+		ID: "remote", Name: "Remote", Topic: "remote", Type: devices.DeviceTypeButton,
+		Buttons: []devices.Button{
+			{Name: "On", Single: "on", Long: "brightness_move_up"},
+			{Name: "Off", Single: "off", Long: "brightness_move_down"},
+		},
+	}}
+	hm := NewHAPManager(configs, "Test Bridge", nil, nil, bus, logger)
+	remote := hm.accessories["remote"]
+	if len(remote.Buttons) != 2 {
+		t.Fatalf("buttons = %d, want 2", len(remote.Buttons))
+	}
+	if got := remote.Buttons[1].ProgrammableSwitchEvent.ValidVals; len(got) != 2 || got[0] != 0 || got[1] != 2 {
+		t.Errorf("valid presses = %v, want single and long", got)
+	}
+
+	var presses []string
+	for i, b := range remote.Buttons {
+		b.ProgrammableSwitchEvent.OnCValueUpdate(func(_ *characteristic.C, v, _ any, _ *http.Request) {
+			presses = append(presses, fmt.Sprintf("%d:%v", i, v))
+		})
+	}
+
+	for _, action := range []string{"off", "off", "brightness_move_up", "brightness_stop"} {
+		hm.pressButton(events.ActionEvent{DeviceID: "remote", Action: action})
+	}
+
+	want := []string{"1:0", "1:0", "0:2"}
+	if !slices.Equal(presses, want) {
+		t.Errorf("presses = %v, want %v", presses, want)
+	}
+}
+
+func TestButtonRemoteHold(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	configs := []devices.Device{{
+		ID: "styrbar", Name: "STYRBAR", Topic: "styrbar", Type: devices.DeviceTypeButton,
+		Remote: devices.RemoteStyrbar, Features: devices.DeviceFeatures{Battery: true},
+	}}
+	hm := NewHAPManager(configs, "Test Bridge", nil, nil, bus, logger)
+	remote := hm.accessories["styrbar"]
+	if len(remote.Buttons) != 4 || remote.Battery == nil {
+		t.Fatalf("buttons = %d, battery = %v, want 4 buttons and a battery", len(remote.Buttons), remote.Battery != nil)
+	}
+
+	var presses []string
+	for i, b := range remote.Buttons {
+		b.ProgrammableSwitchEvent.OnCValueUpdate(func(_ *characteristic.C, v, _ any, _ *http.Request) {
+			presses = append(presses, fmt.Sprintf("%d:%v", i, v))
+		})
+	}
+
+	// A repeated hold is one long press; after the release the next hold
+	// is a new one. brightness_stop releases both dimming buttons.
+	for _, action := range []string{
+		"arrow_left_hold", "arrow_left_hold", "arrow_left_release", "arrow_left_hold",
+		"brightness_move_up", "brightness_stop", "brightness_move_up", "on",
+	} {
+		hm.pressButton(events.ActionEvent{DeviceID: "styrbar", Action: action})
+	}
+
+	want := []string{"2:2", "2:2", "0:2", "0:2", "0:0"}
+	if !slices.Equal(presses, want) {
+		t.Errorf("presses = %v, want %v", presses, want)
+	}
+}
+
+func TestUpdateStateSecuritySystem(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	configs := []devices.Device{{
+		ID: "siren", Name: "Siren", Topic: "siren", Type: devices.DeviceTypeSecuritySystem,
+		Features: devices.DeviceFeatures{Siren: true},
+	}}
+	hm := NewHAPManager(configs, "Test Bridge", nil, nil, bus, logger)
+	siren := hm.accessories["siren"]
+	if siren.Security == nil || siren.Siren == nil {
+		t.Fatal("security system accessory missing security system or siren switch")
+	}
+	if got := siren.Security.SecuritySystemCurrentState.Value(); got != characteristic.SecuritySystemCurrentStateDisarmed {
+		t.Errorf("initial current state = %d, want disarmed", got)
+	}
+
+	hm.UpdateState(events.StateUpdateEvent{DeviceID: "siren", ArmMode: "night", Siren: devices.Ptr(false)})
+	if got := siren.Security.SecuritySystemCurrentState.Value(); got != characteristic.SecuritySystemCurrentStateNightArm {
+		t.Errorf("current state = %d, want night arm", got)
+	}
+	if got := siren.Security.SecuritySystemTargetState.Value(); got != characteristic.SecuritySystemTargetStateNightArm {
+		t.Errorf("target state = %d, want night arm", got)
+	}
+
+	hm.UpdateState(events.StateUpdateEvent{DeviceID: "siren", ArmMode: "night", Siren: devices.Ptr(true)})
+	if got := siren.Security.SecuritySystemCurrentState.Value(); got != characteristic.SecuritySystemCurrentStateAlarmTriggered {
+		t.Errorf("current state = %d, want alarm triggered", got)
+	}
+	if !siren.Siren.On.Value() {
+		t.Error("siren switch off while sounding")
+	}
+}
+
+func TestDoorbellRings(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	configs := []devices.Device{{
+		ID: "door", Name: "Front Door", Topic: "door", Type: devices.DeviceTypeDoorbell,
+		Buttons: []devices.Button{{Name: "Bell", Single: "ring"}},
+	}}
+	hm := NewHAPManager(configs, "Test Bridge", nil, nil, bus, logger)
+	door := hm.accessories["door"]
+	if door.Doorbell == nil || !door.Doorbell.Primary {
+		t.Fatal("doorbell accessory missing a primary doorbell service")
+	}
+	if door.Accessory.Type != accessory.TypeVideoDoorbell {
+		t.Errorf("accessory category = %d, want doorbell", door.Accessory.Type)
+	}
+
+	var rings []any
+	door.Doorbell.ProgrammableSwitchEvent.OnCValueUpdate(func(_ *characteristic.C, v, _ any, _ *http.Request) {
+		rings = append(rings, v)
+	})
+	for _, action := range []string{"ring", "release", "ring"} {
+		hm.pressButton(events.ActionEvent{DeviceID: "door", Action: action})
+	}
+	if len(rings) != 2 || rings[0] != characteristic.ProgrammableSwitchEventSinglePress {
+		t.Errorf("rings = %v, want two single presses", rings)
+	}
+}
+
+type countingWriteMetrics map[string]int
+
+func (m countingWriteMetrics) RejectHAPWrite(characteristic string) { m[characteristic]++ }
+func (m countingWriteMetrics) ThrottleHAPWrite(deviceID string)     { m[deviceID]++ }
+
+func TestWriteValidation(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	configs := []devices.Device{{
+		ID: "lamp", Name: "Lamp", Topic: "lamp", Type: devices.DeviceTypeLightbulb,
+		Features:       devices.DeviceFeatures{Brightness: true, Color: true, ColorTemperature: true},
+		ColorTempRange: &devices.ColorTempRange{Min: 250, Max: 454},
+	}}
+	commands := make(chan devices.CommandEvent, 8)
+	hm := NewHAPManager(configs, "Test Bridge", commands, nil, bus, logger)
+	rejected := countingWriteMetrics{}
+	hm.SetWriteMetrics(rejected)
+	lamp := hm.accessories["lamp"]
+	req := httptest.NewRequest(http.MethodPut, "/characteristics", nil)
+
+	tests := []struct {
+		name       string
+		c          *characteristic.C
+		value      any
+		wantStatus int
+		want       any // value sent to the device, nil when refused
+	}{
+		{"brightness", lamp.Brightness.C, 40, hap.JsonStatusSuccess, 40},
+		{"brightness clamped", lamp.Brightness.C, 250, hap.JsonStatusSuccess, 100},
+		{"mireds clamped to the light", lamp.ColorTemperature.C, 500, hap.JsonStatusSuccess, 454},
+		{"mireds below the light", lamp.ColorTemperature.C, 153, hap.JsonStatusSuccess, 250},
+		{"hue", lamp.Hue.C, 120.0, hap.JsonStatusSuccess, 120.0},
+		{"hue clamped", lamp.Hue.C, 400.0, hap.JsonStatusSuccess, 360.0},
+		{"hue not a number", lamp.Hue.C, "NaN", hap.JsonStatusInvalidValueInRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, status := tt.c.SetValueRequest(tt.value, req); status != tt.wantStatus {
+				t.Fatalf("write status = %d, want %d", status, tt.wantStatus)
+			}
+			if tt.want == nil {
+				select {
+				case cmd := <-commands:
+					t.Errorf("refused write sent %+v", cmd)
+				default:
+				}
+				return
+			}
+			cmd := <-commands
+			var got any
+			switch {
+			case cmd.Brightness != nil:
+				got = *cmd.Brightness
+			case cmd.ColorTemp != nil:
+				got = *cmd.ColorTemp
+			case cmd.Hue != nil:
+				got = *cmd.Hue
+			}
+			if got != tt.want {
+				t.Errorf("command value = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := lamp.ColorTemperature.MinValue(); got != 250 {
+		t.Errorf("color temperature min = %d, want the light's 250", got)
+	}
+	if hm.rejectedWrites.Load() != 1 || rejected["Hue"] != 1 {
+		t.Errorf("rejected writes = %d, metrics %v, want one hue write", hm.rejectedWrites.Load(), rejected)
+	}
+}
+
+func TestCommandRateLimit(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	configs := []devices.Device{
+		{ID: "relay", Name: "Relay", Topic: "relay", Type: devices.DeviceTypeSwitch},
+		{ID: "plug", Name: "Plug", Topic: "plug", Type: devices.DeviceTypeOutlet},
+	}
+	commands := make(chan devices.CommandEvent, 16)
+	hm := NewHAPManager(configs, "Test Bridge", commands, nil, bus, logger)
+	throttled := countingWriteMetrics{}
+	hm.SetWriteMetrics(throttled)
+	hm.SetCommandLimit(time.Hour, 3)
+	req := httptest.NewRequest(http.MethodPut, "/characteristics", nil)
+
+	// A runaway automation toggling the relay gets its burst through.
+	relay := hm.accessories["relay"].Switch.On
+	var statuses []int
+	for range 5 {
+		_, status := relay.SetValueRequest(!relay.Value(), req)
+		statuses = append(statuses, status)
+	}
+	busy := hap.JsonStatusResourceBusy
+	if want := []int{0, 0, 0, busy, busy}; !slices.Equal(statuses, want) {
+		t.Errorf("write statuses = %v, want %v", statuses, want)
+	}
+	if len(commands) != 3 {
+		t.Errorf("sent %d commands, want the burst of 3", len(commands))
+	}
+	if !relay.Value() {
+		t.Error("refused writes changed the characteristic")
+	}
+
+	// Other devices have their own bucket.
+	if _, status := hm.accessories["plug"].Outlet.On.SetValueRequest(true, req); status != hap.JsonStatusSuccess {
+		t.Errorf("plug write status = %d", status)
+	}
+	if hm.throttledWrites.Load() != 2 || throttled["relay"] != 2 {
+		t.Errorf("throttled writes = %d, metrics %v, want 2 for relay", hm.throttledWrites.Load(), throttled)
+	}
+}
@@ -0,0 +1,164 @@
+package z2mhomekit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+)
+
+// accessoryDB caches the attribute database the Home app fetches from
+// /accessories on connect. hap marshals every service and characteristic
+// for each request, which is slow with many accessories. The cache keeps
+// the JSON around the characteristic values and only marshals the values
+// per request. The accessories only change with a new server, which
+// rebuilds it.
+type accessoryDB struct {
+	mu sync.Mutex
+	// chunks is the static JSON between values: chunks[i] precedes
+	// values[i] and the last chunk closes the document.
+	chunks [][]byte
+	values []*characteristic.C
+}
+
+// invalidate drops the cached layout, so the next render rebuilds it.
+func (db *accessoryDB) invalidate() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.chunks = nil
+	db.values = nil
+}
+
+// build caches the layout of the /accessories response for as. IDs must
+// already be assigned, which hap.NewServer does.
+func (db *accessoryDB) build(as []*accessory.A) error {
+	body, err := json.Marshal(accessoriesPayload{as})
+	if err != nil {
+		return err
+	}
+
+	// Readable characteristics carry their value and appear in document
+	// order. "value" is only ever a characteristic key, and a quote inside
+	// a string is escaped, so each match is the next value.
+	var (
+		chunks [][]byte
+		values []*characteristic.C
+		rest   = body
+	)
+	key := []byte(`"value":`)
+	for _, a := range as {
+		for _, s := range a.Ss {
+			for _, c := range s.Cs {
+				if !c.IsReadable() {
+					continue
+				}
+				i := bytes.Index(rest, key)
+				if i < 0 {
+					return fmt.Errorf("accessory db: no value for characteristic %d", c.Id)
+				}
+				i += len(key)
+				dec := json.NewDecoder(bytes.NewReader(rest[i:]))
+				var raw json.RawMessage
+				if err := dec.Decode(&raw); err != nil {
+					return fmt.Errorf("accessory db: characteristic %d: %w", c.Id, err)
+				}
+				chunks = append(chunks, rest[:i])
+				values = append(values, c)
+				rest = rest[i+int(dec.InputOffset()):]
+			}
+		}
+	}
+	if bytes.Contains(rest, key) {
+		return fmt.Errorf("accessory db: unmatched value in response")
+	}
+	chunks = append(chunks, rest)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.chunks = chunks
+	db.values = values
+	return nil
+}
+
+// render returns the /accessories response with the current values,
+// rebuilding the layout from as first if it was invalidated. If the
+// layout cannot be cached the response is marshalled in full.
+func (db *accessoryDB) render(as func() []*accessory.A) ([]byte, error) {
+	db.mu.Lock()
+	built := db.chunks != nil
+	db.mu.Unlock()
+	if !built {
+		list := as()
+		if err := db.build(list); err != nil {
+			return json.Marshal(accessoriesPayload{list})
+		}
+	}
+
+	db.mu.Lock()
+	chunks, values := db.chunks, db.values
+	db.mu.Unlock()
+
+	var buf bytes.Buffer
+	for i, c := range values {
+		buf.Write(chunks[i])
+		// Matches characteristic.C.MarshalJSON, which falls back to the
+		// stored value when the read is refused.
+		v, status := c.ValueRequest(nil)
+		if status != 0 {
+			v = c.Value()
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	}
+	buf.Write(chunks[len(chunks)-1])
+	return buf.Bytes(), nil
+}
+
+type accessoriesPayload struct {
+	Accessories []*accessory.A `json:"accessories"`
+}
+
+// handleAccessories serves /accessories from the attribute database
+// cache in place of hap's handler.
+func (hm *HAPManager) handleAccessories(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", hap.HTTPContentTypeHAPJson)
+	if !hm.server.Load().IsAuthorized(r) {
+		hm.logger.Info("Unauthorized accessories request", "remote", r.RemoteAddr)
+		_ = hap.JsonError(w, hap.JsonStatusInsufficientPrivileges)
+		return
+	}
+
+	body, err := hm.accessoryDB.render(hm.GetAccessories)
+	if err != nil {
+		hm.logger.Error("Failed to render accessories", "error", err)
+		_ = hap.JsonError(w, hap.JsonStatusResourceBusy)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if _, err := hap.NewChunkedWriter(w, 2048).Write(body); err != nil {
+		hm.logger.Debug("Failed to write accessories", "error", err)
+	}
+}
+
+// warmAccessoryDB builds the attribute database cache ahead of the first
+// controller connecting.
+func (hm *HAPManager) warmAccessoryDB() {
+	if err := hm.accessoryDB.build(hm.GetAccessories()); err != nil {
+		hm.logger.Warn("Failed to build accessory cache", "error", err)
+		hm.accessoryDB.invalidate()
+	}
+}
@@ -0,0 +1,103 @@
+package z2mhomekit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/brutella/hap"
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+func TestAccessoryDBMatchesHAP(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	configs := []devices.Device{
+		{ID: "lamp", Name: "Lamp", Topic: "lamp", Type: devices.DeviceTypeLightbulb, Features: devices.DeviceFeatures{Brightness: true, Color: true}},
+		{ID: "climate", Name: "Climate \"value\": 1", Topic: "climate", Type: devices.DeviceTypeClimateSensor, Features: devices.DeviceFeatures{Temperature: true, Humidity: true, Battery: true}},
+		{ID: "plug", Name: "Plug", Topic: "plug", Type: devices.DeviceTypeOutlet},
+	}
+	dm := newTestDeviceManager(t, bus, configs, nil)
+	hm := NewHAPManager(configs, "Test Bridge", nil, dm, bus, logger)
+	accessories := hm.GetAccessories()
+	server, err := hap.NewServer(hap.NewMemStore(), accessories[0], accessories[1:]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hm.SetServer(server)
+	if len(hm.accessoryDB.values) == 0 {
+		t.Fatal("accessory cache not warmed by SetServer")
+	}
+
+	assertMatches := func(t *testing.T) {
+		t.Helper()
+		got, err := hm.accessoryDB.render(hm.GetAccessories)
+		if err != nil {
+			t.Fatalf("render() error = %v", err)
+		}
+		want, err := json.Marshal(accessoriesPayload{hm.GetAccessories()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var gotDoc, wantDoc any
+		if err := json.Unmarshal(got, &gotDoc); err != nil {
+			t.Fatalf("render() is not JSON: %v\n%s", err, got)
+		}
+		if err := json.Unmarshal(want, &wantDoc); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(gotDoc, wantDoc) {
+			t.Errorf("render() =\n%s\nwant\n%s", got, want)
+		}
+	}
+
+	t.Run("warm", assertMatches)
+
+	lamp := hm.accessories["lamp"]
+	lamp.Lightbulb.On.SetValue(true)
+	lamp.Brightness.SetValue(42)
+	hm.accessories["climate"].Temperature.CurrentTemperature.SetValue(21.5)
+	t.Run("after value changes", assertMatches)
+
+	dm.SetZ2MOnline(false)
+	t.Run("z2m offline", assertMatches)
+	dm.SetZ2MOnline(true)
+
+	hm.accessoryDB.invalidate()
+	t.Run("rebuilt after invalidate", assertMatches)
+}
+
+func TestHandleAccessoriesRequiresPairing(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	configs := []devices.Device{{ID: "plug", Name: "Plug", Topic: "plug", Type: devices.DeviceTypeOutlet}}
+	hm := NewHAPManager(configs, "Test Bridge", nil, nil, bus, logger)
+	accessories := hm.GetAccessories()
+	server, err := hap.NewServer(hap.NewMemStore(), accessories[0], accessories[1:]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hm.SetServer(server)
+
+	rec := httptest.NewRecorder()
+	server.ServeMux().(http.Handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/accessories", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	var body struct {
+		Status int `json:"status"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Status != hap.JsonStatusInsufficientPrivileges {
+		t.Errorf("status = %d, want insufficient privileges", body.Status)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != hap.HTTPContentTypeHAPJson {
+		t.Errorf("Content-Type = %q, want %q", ct, hap.HTTPContentTypeHAPJson)
+	}
+}
@@ -0,0 +1,73 @@
+package z2mhomekit
+
+import (
+	"reflect"
+	"slices"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+// SetDevices updates the accessories to configs, and the scene switches to
+// the manager's scenes, while the bridge runs. It reports whether the accessories were rebuilt, in which case the HAP
+// server must be restarted with them; AccessoriesChanged is signalled.
+// The new server announces a bumped configuration number, so paired
+// controllers fetch the new accessories without being re-paired.
+func (hm *HAPManager) SetDevices(configs []devices.Device) bool {
+	exposed := hm.exposedDevices(configs)
+
+	hm.mu.RLock()
+	current, currentScenes := hm.exposed, hm.scenes
+	hm.mu.RUnlock()
+
+	if reflect.DeepEqual(exposed, current) && reflect.DeepEqual(hm.homeKitScenes(), currentScenes) {
+		return false
+	}
+
+	hm.build(exposed)
+	hm.accessoryDB.invalidate()
+
+	// The new accessories start empty; bring them up to date.
+	if hm.deviceManager != nil {
+		for _, accInfo := range hm.accessoryInfos() {
+			if update, ok := hm.deviceManager.StateUpdate(accInfo.DeviceID); ok {
+				hm.UpdateState(update)
+			}
+		}
+	}
+
+	hm.logger.Info("Rebuilt HomeKit accessories", "accessories", len(hm.accessoryInfos()))
+	select {
+	case hm.changed <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// AddAccessory adds or replaces the accessory of a device, as SetDevices.
+func (hm *HAPManager) AddAccessory(device devices.Device) bool {
+	hm.mu.RLock()
+	configs := slices.Clone(hm.exposed)
+	hm.mu.RUnlock()
+
+	i := slices.IndexFunc(configs, func(d devices.Device) bool { return d.ID == device.ID })
+	if i < 0 {
+		configs = append(configs, device)
+	} else {
+		configs[i] = device
+	}
+	return hm.SetDevices(configs)
+}
+
+// RemoveAccessory removes the accessory of a device, as SetDevices.
+func (hm *HAPManager) RemoveAccessory(deviceID string) bool {
+	hm.mu.RLock()
+	configs := slices.DeleteFunc(slices.Clone(hm.exposed), func(d devices.Device) bool { return d.ID == deviceID })
+	hm.mu.RUnlock()
+	return hm.SetDevices(configs)
+}
+
+// AccessoriesChanged is signalled when SetDevices rebuilds the
+// accessories.
+func (hm *HAPManager) AccessoriesChanged() <-chan struct{} {
+	return hm.changed
+}
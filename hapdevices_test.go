@@ -0,0 +1,64 @@
+package z2mhomekit
+
+import (
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+func TestHAPSetDevices(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	plug := devices.Device{ID: "plug", Name: "Plug", Topic: "plug", Type: devices.DeviceTypeOutlet}
+	sensor := devices.Device{ID: "sensor", Name: "Sensor", Topic: "sensor", Type: devices.DeviceTypeClimateSensor}
+	hidden := devices.Device{ID: "hidden", Name: "Hidden", Topic: "hidden", Type: devices.DeviceTypeOutlet, ExposeTo: []string{"Other Bridge"}}
+
+	dm := newTestDeviceManager(t, bus, []devices.Device{plug, sensor}, nil)
+	on := true
+	dm.ApplyStateChange(t.Context(), devices.StateChangedEvent{DeviceID: "plug", State: devices.State{On: &on}, UpdatedFields: []string{"On"}})
+
+	hm := NewHAPManager([]devices.Device{plug}, "Test Bridge", nil, dm, bus, logger)
+	ids := func() []string {
+		var ids []string
+		for _, accInfo := range hm.accessoryInfos() {
+			ids = append(ids, accInfo.DeviceID)
+		}
+		return ids
+	}
+
+	if hm.SetDevices([]devices.Device{plug, hidden}) {
+		t.Error("adding a device not exposed on the bridge rebuilt the accessories")
+	}
+
+	if !hm.AddAccessory(sensor) {
+		t.Fatal("AddAccessory did not rebuild the accessories")
+	}
+	select {
+	case <-hm.AccessoriesChanged():
+	default:
+		t.Error("AccessoriesChanged not signalled")
+	}
+	if got := ids(); len(got) != 2 || got[0] != "plug" || got[1] != "sensor" {
+		t.Errorf("accessories = %v, want plug and sensor", got)
+	}
+	if got := len(hm.GetAccessories()); got != 3 {
+		t.Errorf("GetAccessories returned %d, want bridge, plug and sensor", got)
+	}
+
+	// The rebuilt accessories carry the current state.
+	accInfo, _ := hm.accessory("plug")
+	if !accInfo.Outlet.On.Value() {
+		t.Error("rebuilt plug accessory lost its state")
+	}
+
+	if hm.AddAccessory(sensor) {
+		t.Error("adding an unchanged device rebuilt the accessories")
+	}
+	if !hm.RemoveAccessory("plug") {
+		t.Fatal("RemoveAccessory did not rebuild the accessories")
+	}
+	if got := ids(); len(got) != 1 || got[0] != "sensor" {
+		t.Errorf("accessories = %v, want sensor", got)
+	}
+}
@@ -0,0 +1,67 @@
+package z2mhomekit
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+
+	"github.com/brutella/hap"
+)
+
+// BridgeInfo is the accessory information of the bridge, shown in the
+// Home app's bridge settings. Distinct serial numbers tell several
+// bridges on one network apart.
+type BridgeInfo struct {
+	Manufacturer string
+	Model        string
+	SerialNumber string
+}
+
+var defaultBridgeInfo = BridgeInfo{
+	Manufacturer: "z2m-homekit",
+	Model:        "Bridge",
+	SerialNumber: "Z2MB001",
+}
+
+// SetBridgeInfo sets the accessory information of the bridge. Empty fields
+// are left as they are.
+func (hm *HAPManager) SetBridgeInfo(info BridgeInfo) {
+	hm.mu.Lock()
+	if info.Manufacturer != "" {
+		hm.bridgeInfo.Manufacturer = info.Manufacturer
+	}
+	if info.Model != "" {
+		hm.bridgeInfo.Model = info.Model
+	}
+	if info.SerialNumber != "" {
+		hm.bridgeInfo.SerialNumber = info.SerialNumber
+	}
+	info = hm.bridgeInfo
+	bridge := hm.bridge
+	hm.mu.Unlock()
+
+	bridge.Info.Manufacturer.SetValue(info.Manufacturer)
+	bridge.Info.Model.SetValue(info.Model)
+	bridge.Info.SerialNumber.SetValue(info.SerialNumber)
+	hm.accessoryDB.invalidate()
+}
+
+// storeSerial returns a serial number derived from the bridge's HAP
+// identity in store, e.g. "Z2MB-3FA2B1C4D5E6". A bridge that has never run
+// gets its identity now, in the form hap would give it, so the serial is
+// the same from the first start on.
+func storeSerial(store hap.Store) (string, error) {
+	// hap makes a new identity whenever it cannot read one, as here.
+	id, err := store.Get("uuid")
+	if err != nil || len(id) == 0 {
+		var b [6]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return "", err
+		}
+		id = fmt.Appendf(nil, "%02X:%02X:%02X:%02X:%02X:%02X", b[0], b[1], b[2], b[3], b[4], b[5])
+		if err := store.Set("uuid", id); err != nil {
+			return "", fmt.Errorf("failed to store HAP identity: %w", err)
+		}
+	}
+	return "Z2MB-" + strings.ReplaceAll(string(id), ":", ""), nil
+}
@@ -0,0 +1,53 @@
+package z2mhomekit
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/brutella/hap"
+)
+
+func TestStoreSerial(t *testing.T) {
+	store := hap.NewMemStore()
+	serial, err := storeSerial(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^Z2MB-[0-9A-F]{12}$`).MatchString(serial) {
+		t.Errorf("serial = %q, want Z2MB- and the identity's 12 hex digits", serial)
+	}
+
+	// The identity is stored for the server to use.
+	if id, err := store.Get("uuid"); err != nil || strings.ReplaceAll(string(id), ":", "") != serial[len("Z2MB-"):] {
+		t.Errorf("stored identity = %q, %v, want the serial's", id, err)
+	}
+	again, err := storeSerial(store)
+	if err != nil || again != serial {
+		t.Errorf("second serial = %q, %v, want %q", again, err, serial)
+	}
+	if other, _ := storeSerial(hap.NewMemStore()); other == serial {
+		t.Error("two stores share a serial")
+	}
+}
+
+func TestSetBridgeInfo(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	hm := NewHAPManager(nil, "Test Bridge", nil, nil, bus, logger)
+	hm.SetBridgeInfo(BridgeInfo{Model: "Attic", SerialNumber: "Z2MB-ATTIC"})
+
+	check := func() {
+		t.Helper()
+		info := hm.GetAccessories()[0].Info
+		if info.Manufacturer.Value() != "z2m-homekit" || info.Model.Value() != "Attic" || info.SerialNumber.Value() != "Z2MB-ATTIC" {
+			t.Errorf("bridge info = %s %s %s", info.Manufacturer.Value(), info.Model.Value(), info.SerialNumber.Value())
+		}
+	}
+	check()
+
+	// Rebuilt accessories keep it.
+	hm.build(nil)
+	check()
+}
@@ -0,0 +1,99 @@
+package z2mhomekit
+
+import (
+	"sync"
+
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+const (
+	// hapQueueDepth bounds the updates waiting for one device. Each update
+	// carries the device's full state, so a device that falls behind drops
+	// its oldest pending update rather than holding up the dispatcher.
+	hapQueueDepth = 8
+
+	// hapUpdateWorkers bounds how many devices are updated at once. Each
+	// update notifies every subscribed controller, so the bound also caps
+	// the notifications written concurrently.
+	hapUpdateWorkers = 8
+)
+
+// updateDispatcher applies state updates through per-device queues. A
+// device's updates are applied one at a time in order, while different
+// devices are updated concurrently, so a device whose notifications are
+// slow to write does not delay the others.
+type updateDispatcher struct {
+	apply func(events.StateUpdateEvent)
+	slots chan struct{}
+
+	mu     sync.Mutex
+	queues map[string]*deviceQueue
+	wg     sync.WaitGroup
+}
+
+type deviceQueue struct {
+	pending []events.StateUpdateEvent
+	// running is set while a goroutine drains the queue.
+	running bool
+}
+
+func newUpdateDispatcher(workers int, apply func(events.StateUpdateEvent)) *updateDispatcher {
+	return &updateDispatcher{
+		apply:  apply,
+		slots:  make(chan struct{}, workers),
+		queues: make(map[string]*deviceQueue),
+	}
+}
+
+// dispatch queues evt behind the device's pending updates without
+// blocking. It reports false if the oldest pending update was dropped to
+// make room.
+func (d *updateDispatcher) dispatch(evt events.StateUpdateEvent) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	q, ok := d.queues[evt.DeviceID]
+	if !ok {
+		q = &deviceQueue{}
+		d.queues[evt.DeviceID] = q
+	}
+
+	kept := true
+	if len(q.pending) >= hapQueueDepth {
+		q.pending = q.pending[1:]
+		kept = false
+	}
+	q.pending = append(q.pending, evt)
+
+	if !q.running {
+		q.running = true
+		d.wg.Add(1)
+		go d.drain(q)
+	}
+	return kept
+}
+
+// drain applies q's updates until it is empty.
+func (d *updateDispatcher) drain(q *deviceQueue) {
+	defer d.wg.Done()
+	for {
+		d.mu.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			d.mu.Unlock()
+			return
+		}
+		evt := q.pending[0]
+		q.pending = q.pending[1:]
+		d.mu.Unlock()
+
+		d.slots <- struct{}{}
+		d.apply(evt)
+		<-d.slots
+	}
+}
+
+// wait blocks until every queued update has been applied.
+func (d *updateDispatcher) wait() {
+	d.wg.Wait()
+}
@@ -0,0 +1,107 @@
+package z2mhomekit
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+func TestUpdateDispatcherSlowDeviceDoesNotBlockOthers(t *testing.T) {
+	release := make(chan struct{})
+	fastApplied := make(chan struct{}, 1)
+	d := newUpdateDispatcher(hapUpdateWorkers, func(evt events.StateUpdateEvent) {
+		switch evt.DeviceID {
+		case "slow":
+			<-release
+		case "fast":
+			fastApplied <- struct{}{}
+		}
+	})
+
+	d.dispatch(events.StateUpdateEvent{DeviceID: "slow"})
+	d.dispatch(events.StateUpdateEvent{DeviceID: "fast"})
+
+	select {
+	case <-fastApplied:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fast device update waited for the slow device")
+	}
+
+	close(release)
+	d.wait()
+}
+
+func TestUpdateDispatcherKeepsDeviceOrder(t *testing.T) {
+	var mu sync.Mutex
+	applied := make(map[string][]int)
+	d := newUpdateDispatcher(hapUpdateWorkers, func(evt events.StateUpdateEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		applied[evt.DeviceID] = append(applied[evt.DeviceID], evt.LinkQuality)
+	})
+
+	devices := []string{"a", "b", "c", "d"}
+	for seq := range hapQueueDepth {
+		for _, id := range devices {
+			d.dispatch(events.StateUpdateEvent{DeviceID: id, LinkQuality: seq})
+		}
+	}
+	d.wait()
+
+	for _, id := range devices {
+		got := applied[id]
+		if len(got) != hapQueueDepth {
+			t.Fatalf("%s: applied %d updates, want %d", id, len(got), hapQueueDepth)
+		}
+		for i, seq := range got {
+			if seq != i {
+				t.Fatalf("%s: applied %v, want in dispatch order", id, got)
+			}
+		}
+	}
+}
+
+func TestUpdateDispatcherDropsOldestWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var applied []int
+	d := newUpdateDispatcher(1, func(evt events.StateUpdateEvent) {
+		if evt.LinkQuality == 0 {
+			close(started)
+			<-release
+		}
+		applied = append(applied, evt.LinkQuality)
+	})
+
+	d.dispatch(events.StateUpdateEvent{DeviceID: "lamp", LinkQuality: 0})
+	<-started
+
+	dropped := 0
+	for seq := 1; seq <= hapQueueDepth+2; seq++ {
+		if !d.dispatch(events.StateUpdateEvent{DeviceID: "lamp", LinkQuality: seq}) {
+			dropped++
+		}
+	}
+	if dropped != 2 {
+		t.Errorf("dropped %d updates, want 2", dropped)
+	}
+
+	close(release)
+	d.wait()
+
+	// The update in flight completes, then the newest hapQueueDepth.
+	want := []int{0}
+	for seq := 3; seq <= hapQueueDepth+2; seq++ {
+		want = append(want, seq)
+	}
+	if len(applied) != len(want) {
+		t.Fatalf("applied %v, want %v", applied, want)
+	}
+	for i := range want {
+		if applied[i] != want[i] {
+			t.Fatalf("applied %v, want %v", applied, want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package z2mhomekit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+)
+
+// writeMetrics counts HomeKit writes refused before they became commands.
+type writeMetrics interface {
+	RejectHAPWrite(characteristic string)
+	ThrottleHAPWrite(deviceID string)
+}
+
+// commandThrottle rate limits HomeKit commands per device, so a runaway
+// automation cannot toggle a relay many times a second.
+type commandThrottle struct {
+	limit   rateLimit // interval 0 disables
+	buckets tokenBuckets
+
+	mu      sync.Mutex
+	dropped map[string]int // writes refused per device since the last allowed
+}
+
+// SetWriteMetrics exports refused writes to m.
+func (hm *HAPManager) SetWriteMetrics(m writeMetrics) {
+	hm.writeMetrics = m
+}
+
+// SetCommandLimit limits HomeKit commands to each device to a burst, then
+// one per interval. Interval 0 disables the limit.
+func (hm *HAPManager) SetCommandLimit(interval time.Duration, burst int) {
+	hm.throttle.limit = rateLimit{interval: interval, burst: burst}
+}
+
+// limitWrites refuses writes to a device's characteristics beyond the
+// command limit as busy, before they become commands. Writes that do not
+// change a value never reach it.
+func (hm *HAPManager) limitWrites(a *accessory.A, deviceID string) {
+	for _, s := range a.Ss {
+		if s.Type == service.TypeAccessoryInformation {
+			continue
+		}
+		for _, c := range s.Cs {
+			if !c.IsWritable() || c.Format == characteristic.FormatString {
+				continue
+			}
+			next := c.SetValueRequestFunc
+			c.SetValueRequestFunc = func(v any, r *http.Request) (any, int) {
+				if !hm.allowCommand(deviceID, c) {
+					return nil, hap.JsonStatusResourceBusy
+				}
+				if next != nil {
+					return next(v, r)
+				}
+				return nil, hap.JsonStatusSuccess
+			}
+		}
+	}
+}
+
+// allowCommand takes a token for a command to deviceID. Throttling is
+// logged when it starts and ends rather than for every refused write.
+func (hm *HAPManager) allowCommand(deviceID string, c *characteristic.C) bool {
+	t := &hm.throttle
+	if t.limit.interval <= 0 {
+		return true
+	}
+	allowed := t.buckets.allow(deviceID, t.limit, time.Now())
+
+	t.mu.Lock()
+	dropped := t.dropped[deviceID]
+	if allowed {
+		delete(t.dropped, deviceID)
+	} else {
+		if t.dropped == nil {
+			t.dropped = make(map[string]int)
+		}
+		t.dropped[deviceID]++
+	}
+	t.mu.Unlock()
+
+	switch {
+	case !allowed:
+		hm.throttledWrites.Add(1)
+		if hm.writeMetrics != nil {
+			hm.writeMetrics.ThrottleHAPWrite(deviceID)
+		}
+		if dropped == 0 {
+			hm.logger.Warn("Throttling HomeKit commands",
+				"device_id", deviceID,
+				"characteristic", nameOr(characteristicNames[c.Type], nameOr(c.Description, c.Type)),
+				"interval", t.limit.interval,
+				"burst", t.limit.burst,
+			)
+		}
+	case dropped > 0:
+		hm.logger.Info("HomeKit commands no longer throttled", "device_id", deviceID, "refused", dropped)
+	}
+	return allowed
+}
+
+// validateWrites refuses writes from controllers that no device could act
+// on, before they reach MQTT. hap has converted a written value to the
+// characteristic's format and clamped it to the advertised bounds by the
+// time it gets here, so out of range brightness, hue and mireds arrive
+// clamped; the color temperature bounds are narrowed to the light's own
+// range for that. What is left are values clamping cannot fix, such as a
+// hue written as "NaN". They are answered with HAP's invalid value status
+// and counted.
+func (hm *HAPManager) validateWrites(a *accessory.A, deviceID string) {
+	for _, s := range a.Ss {
+		if s.Type == service.TypeAccessoryInformation {
+			continue
+		}
+		for _, c := range s.Cs {
+			if !c.IsWritable() || (c.Format == characteristic.FormatBool || c.Format == characteristic.FormatString) {
+				continue
+			}
+			next := c.SetValueRequestFunc
+			c.SetValueRequestFunc = func(v any, r *http.Request) (any, int) {
+				if err := checkWrite(c, v); err != nil {
+					hm.rejectWrite(deviceID, c, v, err)
+					return nil, hap.JsonStatusInvalidValueInRequest
+				}
+				if next != nil {
+					return next(v, r)
+				}
+				return nil, hap.JsonStatusSuccess
+			}
+		}
+	}
+}
+
+// checkWrite reports why v cannot be written to c.
+func checkWrite(c *characteristic.C, v any) error {
+	switch v := v.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("%v is not a number", v)
+		}
+		lo, loOK := c.MinVal.(float64)
+		hi, hiOK := c.MaxVal.(float64)
+		if (loOK && v < lo) || (hiOK && v > hi) {
+			return fmt.Errorf("%v is outside %v to %v", v, c.MinVal, c.MaxVal)
+		}
+	case int:
+		lo, loOK := c.MinVal.(int)
+		hi, hiOK := c.MaxVal.(int)
+		if (loOK && v < lo) || (hiOK && v > hi) {
+			return fmt.Errorf("%d is outside %v to %v", v, c.MinVal, c.MaxVal)
+		}
+	}
+	return nil
+}
+
+func (hm *HAPManager) rejectWrite(deviceID string, c *characteristic.C, v any, err error) {
+	name := nameOr(characteristicNames[c.Type], nameOr(c.Description, c.Type))
+	hm.rejectedWrites.Add(1)
+	hm.lastActivity.Store(time.Now().Unix())
+	hm.logger.Warn("Rejected HomeKit write", "device_id", deviceID, "characteristic", name, "value", v, "error", err)
+	if hm.writeMetrics != nil {
+		hm.writeMetrics.RejectHAPWrite(name)
+	}
+}
@@ -0,0 +1,48 @@
+package z2mhomekit
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/devices"
+	"github.com/kradalby/z2m-homekit/events"
+	mqtt "github.com/mochi-mqtt/server/v2"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// newTestBus returns an event bus closed when the test ends.
+func newTestBus(t testing.TB) *events.Bus {
+	t.Helper()
+
+	bus, err := events.New(testLogger())
+	if err != nil {
+		t.Fatalf("events.New: %v", err)
+	}
+	t.Cleanup(func() { _ = bus.Close() })
+	return bus
+}
+
+// newTestDeviceManager returns a manager of configs on bus. Commands go
+// to an embedded broker.
+func newTestDeviceManager(t testing.TB, bus *events.Bus, configs []devices.Device, commands chan devices.CommandEvent) *devices.Manager {
+	t.Helper()
+
+	dm, err := devices.NewManager(configs, commands, bus, newTestBroker(t), testLogger())
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	return dm
+}
+
+// newTestBroker returns an embedded broker closed when the test ends.
+func newTestBroker(t testing.TB) *mqtt.Server {
+	t.Helper()
+
+	server := mqtt.New(&mqtt.Options{InlineClient: true, Logger: testLogger()})
+	t.Cleanup(func() { _ = server.Close() })
+	return server
+}
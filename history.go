@@ -0,0 +1,464 @@
+package z2mhomekit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+	"tailscale.com/util/eventbus"
+)
+
+const (
+	// historyHeartbeat is how often an unchanged value is recorded again,
+	// so a steady sensor still has points across a graph.
+	historyHeartbeat = 15 * time.Minute
+
+	// historyDayLayout names the history files, one per UTC day.
+	historyDayLayout = "2006-01-02"
+
+	// historyCompactAfter is how long after it ends a day is compacted to
+	// one value per device, metric and historyCompactBucket.
+	historyCompactAfter  = 48 * time.Hour
+	historyCompactBucket = time.Hour
+)
+
+// historyMetrics are the recorded values; on is 1 or 0.
+var historyMetrics = []string{"temperature", "humidity", "power", "on"}
+
+// historyRecord is one recorded value of a device.
+type historyRecord struct {
+	At       time.Time `json:"at"`
+	DeviceID string    `json:"device_id"`
+	Metric   string    `json:"metric"`
+	Value    float64   `json:"value"`
+}
+
+// HistorySample is a value at a point in time.
+type HistorySample struct {
+	At    time.Time `json:"at"`
+	Value float64   `json:"value"`
+}
+
+// History records device temperature, humidity, power and on/off state as
+// JSON lines in one file per day, compacts days past historyCompactAfter
+// and deletes days past the retention. A value is recorded when it
+// changes, and again every historyHeartbeat while it does not. Like the
+// event journal, writes are not synced.
+type History struct {
+	dir        string
+	retention  time.Duration
+	subscriber *eventbus.Subscriber[events.StateUpdateEvent]
+	seen       *eventbus.Subscriber[events.DeviceSeenEvent]
+	logger     *slog.Logger
+
+	mu     sync.Mutex
+	f      *os.File
+	day    string                   // day of f
+	last   map[string]historyRecord // last recorded per device and metric
+	closed bool
+	// compacted is the days compacted since the history was opened.
+	compacted map[string]bool
+}
+
+// NewHistory opens the history in dir, recording state updates from bus
+// once Run is called.
+func NewHistory(dir string, retention time.Duration, bus *events.Bus, logger *slog.Logger) (*History, error) {
+	client, err := bus.Client(events.ClientHistory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history eventbus client: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	h := &History{
+		dir:        dir,
+		retention:  retention,
+		subscriber: eventbus.Subscribe[events.StateUpdateEvent](client),
+		seen:       eventbus.Subscribe[events.DeviceSeenEvent](client),
+		logger:     logger.With(slog.String("component", string(events.ClientHistory))),
+		last:       make(map[string]historyRecord),
+		compacted:  make(map[string]bool),
+	}
+	h.prune(time.Now())
+	h.compact(time.Now())
+	return h, nil
+}
+
+// Run records state updates until ctx is cancelled. With liveness events
+// on the bus, unchanged reports arrive as DeviceSeenEvent, which records
+// the heartbeats of steady values.
+func (h *History) Run(ctx context.Context) {
+	for {
+		select {
+		case event := <-h.subscriber.Events():
+			if err := h.Record(event); err != nil {
+				h.logger.Warn("Failed to record history", "device_id", event.DeviceID, "error", err)
+			}
+		case event := <-h.seen.Events():
+			if err := h.RecordSeen(event); err != nil {
+				h.logger.Warn("Failed to record history", "device_id", event.DeviceID, "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// historyValues returns the recorded values of a state update.
+func historyValues(event events.StateUpdateEvent) map[string]float64 {
+	values := make(map[string]float64)
+	if event.Temperature != nil {
+		values["temperature"] = *event.Temperature
+	}
+	if event.Humidity != nil {
+		values["humidity"] = *event.Humidity
+	}
+	if event.Power != nil {
+		values["power"] = *event.Power
+	}
+	if event.On != nil {
+		values["on"] = 0
+		if *event.On {
+			values["on"] = 1
+		}
+	}
+	return values
+}
+
+// Record appends the values of a state update that changed or are due a
+// heartbeat.
+func (h *History) Record(event events.StateUpdateEvent) error {
+	at := event.Timestamp
+	if at.IsZero() {
+		at = time.Now()
+	}
+	return h.record(event.DeviceID, at, historyValues(event))
+}
+
+// RecordSeen records the last values of a device whose state is unchanged
+// again when they are due a heartbeat.
+func (h *History) RecordSeen(event events.DeviceSeenEvent) error {
+	at := event.Timestamp
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	values := make(map[string]float64)
+	h.mu.Lock()
+	for _, metric := range historyMetrics {
+		if last, ok := h.last[event.DeviceID+"/"+metric]; ok {
+			values[metric] = last.Value
+		}
+	}
+	h.mu.Unlock()
+
+	return h.record(event.DeviceID, at, values)
+}
+
+// record appends the values of a device that changed or are due a
+// heartbeat.
+func (h *History) record(deviceID string, at time.Time, values map[string]float64) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var buf []byte
+	var recorded []historyRecord
+	for _, metric := range historyMetrics {
+		value, ok := values[metric]
+		if !ok {
+			continue
+		}
+		key := deviceID + "/" + metric
+		if last, ok := h.last[key]; ok && last.Value == value && at.Sub(last.At) < historyHeartbeat {
+			continue
+		}
+		rec := historyRecord{At: at.UTC(), DeviceID: deviceID, Metric: metric, Value: value}
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("failed to encode history record: %w", err)
+		}
+		buf = append(append(buf, data...), '\n')
+		recorded = append(recorded, rec)
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+	if h.closed {
+		return os.ErrClosed
+	}
+
+	if err := h.openDay(at); err != nil {
+		return err
+	}
+	if _, err := h.f.Write(buf); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	for _, rec := range recorded {
+		h.last[rec.DeviceID+"/"+rec.Metric] = rec
+	}
+	return nil
+}
+
+// openDay opens the file of the day at falls on, pruning and compacting
+// old days when the day changes. Callers must hold h.mu.
+func (h *History) openDay(at time.Time) error {
+	day := at.UTC().Format(historyDayLayout)
+	if h.f != nil && h.day == day {
+		return nil
+	}
+	if h.f != nil {
+		_ = h.f.Close()
+		h.f = nil
+		h.prune(at)
+		h.compact(at)
+	}
+	f, err := os.OpenFile(h.path(day), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	h.f, h.day = f, day
+	return nil
+}
+
+func (h *History) path(day string) string {
+	return filepath.Join(h.dir, day+".jsonl")
+}
+
+// prune deletes the days that ended more than the retention before now.
+func (h *History) prune(now time.Time) {
+	entries, err := os.ReadDir(h.dir)
+	if err != nil {
+		h.logger.Warn("Failed to list history", "error", err)
+		return
+	}
+	for _, e := range entries {
+		day, ok := strings.CutSuffix(e.Name(), ".jsonl")
+		if !ok {
+			continue
+		}
+		start, err := time.Parse(historyDayLayout, day)
+		if err != nil || now.Sub(start.Add(24*time.Hour)) <= h.retention {
+			continue
+		}
+		if err := os.Remove(filepath.Join(h.dir, e.Name())); err != nil {
+			h.logger.Warn("Failed to delete old history", "file", e.Name(), "error", err)
+			continue
+		}
+		delete(h.compacted, day)
+	}
+}
+
+// compact compacts the days that ended more than historyCompactAfter
+// before now. Callers must hold h.mu, or be NewHistory.
+func (h *History) compact(now time.Time) {
+	entries, err := os.ReadDir(h.dir)
+	if err != nil {
+		h.logger.Warn("Failed to list history", "error", err)
+		return
+	}
+	for _, e := range entries {
+		day, ok := strings.CutSuffix(e.Name(), ".jsonl")
+		if !ok || h.compacted[day] {
+			continue
+		}
+		start, err := time.Parse(historyDayLayout, day)
+		if err != nil || now.Sub(start.Add(24*time.Hour)) <= historyCompactAfter {
+			continue
+		}
+		if err := h.compactDay(day); err != nil {
+			h.logger.Warn("Failed to compact history", "file", e.Name(), "error", err)
+			continue
+		}
+		h.compacted[day] = true
+	}
+}
+
+// compactDay rewrites a day keeping the last value per device, metric and
+// historyCompactBucket, and every change of on/off state. Lines that fail
+// to parse are dropped.
+func (h *History) compactDay(day string) error {
+	data, err := os.ReadFile(h.path(day))
+	if err != nil {
+		return err
+	}
+
+	var kept []historyRecord
+	lines := 0
+	latest := make(map[string]int) // index in kept per device and metric
+	for line := range strings.Lines(string(data)) {
+		lines++
+		var rec historyRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			continue
+		}
+		key := rec.DeviceID + "/" + rec.Metric
+		if i, ok := latest[key]; ok && kept[i].At.Truncate(historyCompactBucket).Equal(rec.At.Truncate(historyCompactBucket)) {
+			switch {
+			case rec.Metric != "on":
+				kept[i] = rec
+				continue
+			case kept[i].Value == rec.Value:
+				continue
+			}
+		}
+		latest[key] = len(kept)
+		kept = append(kept, rec)
+	}
+	if len(kept) == lines {
+		return nil
+	}
+
+	var buf []byte
+	for _, rec := range kept {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("failed to encode history record: %w", err)
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	tmp := h.path(day) + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, h.path(day)); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	h.logger.Info("Compacted history", "day", day, "records", lines, "kept", len(kept))
+	return nil
+}
+
+// Query returns the samples of deviceID between from and to by metric,
+// oldest first. An empty metric returns every metric. Lines that fail to
+// parse, such as a torn final line after a crash, are skipped.
+func (h *History) Query(deviceID, metric string, from, to time.Time) (map[string][]HistorySample, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	series := make(map[string][]HistorySample)
+	for day := from.UTC().Truncate(24 * time.Hour); !day.After(to); day = day.Add(24 * time.Hour) {
+		f, err := os.Open(h.path(day.Format(historyDayLayout)))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history: %w", err)
+		}
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var rec historyRecord
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				continue
+			}
+			if rec.DeviceID != deviceID || (metric != "" && rec.Metric != metric) || rec.At.Before(from) || rec.At.After(to) {
+				continue
+			}
+			series[rec.Metric] = append(series[rec.Metric], HistorySample{At: rec.At, Value: rec.Value})
+		}
+		err = scanner.Err()
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history: %w", err)
+		}
+	}
+	for _, samples := range series {
+		sort.SliceStable(samples, func(i, j int) bool { return samples[i].At.Before(samples[j].At) })
+	}
+	return series, nil
+}
+
+// Close closes the current history file.
+func (h *History) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	if h.f == nil {
+		return nil
+	}
+	err := h.f.Close()
+	h.f = nil
+	return err
+}
+
+// historyDefaultWindow is how far back the history API looks by default.
+const historyDefaultWindow = 24 * time.Hour
+
+// HistoryResponse is a device's recorded values by metric.
+type HistoryResponse struct {
+	DeviceID string                     `json:"device_id"`
+	From     time.Time                  `json:"from"`
+	To       time.Time                  `json:"to"`
+	Series   map[string][]HistorySample `json:"series"`
+}
+
+// SetHistory enables the history API.
+func (ws *WebServer) SetHistory(h *History) {
+	ws.history = h
+}
+
+// HandleHistory returns the recorded values of a device between since and
+// until, by default the last day.
+func (ws *WebServer) HandleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ws.history == nil {
+		http.Error(w, "History is disabled", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	device, _, exists := ws.deviceProvider.Device(q.Get("device"))
+	if !exists {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+	metric := q.Get("metric")
+	if metric != "" && !slices.Contains(historyMetrics, metric) {
+		http.Error(w, fmt.Sprintf("metric must be one of %s", strings.Join(historyMetrics, ", ")), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	from, to := now.Add(-historyDefaultWindow), now
+	var err error
+	if raw := q.Get("since"); raw != "" {
+		if from, err = parseSince(raw, now); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if raw := q.Get("until"); raw != "" {
+		if to, err = parseSince(raw, now); err != nil {
+			http.Error(w, strings.Replace(err.Error(), "since", "until", 1), http.StatusBadRequest)
+			return
+		}
+	}
+
+	series, err := ws.history.Query(device.ID, metric, from, to)
+	if err != nil {
+		ws.logger.Error("Failed to read history", "error", err)
+		http.Error(w, "Failed to read history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(HistoryResponse{DeviceID: device.ID, From: from, To: to, Series: series})
+}
@@ -0,0 +1,241 @@
+package z2mhomekit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/devices"
+	"github.com/kradalby/z2m-homekit/events"
+	"tailscale.com/util/eventbus"
+)
+
+func newTestHistory(t *testing.T, dir string) *History {
+	t.Helper()
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	h, err := NewHistory(dir, 48*time.Hour, bus, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = h.Close() })
+	return h
+}
+
+func TestHistory(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, time.Now().UTC().Add(-96*time.Hour).Format(historyDayLayout)+".jsonl")
+	if err := os.WriteFile(old, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	h := newTestHistory(t, dir)
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("history past the retention was not deleted")
+	}
+
+	// Updates straddle midnight, so they land in two files.
+	start := time.Now().UTC().Truncate(24 * time.Hour).Add(-time.Minute)
+	temp := func(v float64) *float64 { return &v }
+	on, off := true, false
+	updates := []events.StateUpdateEvent{
+		{Timestamp: start, DeviceID: "kitchen", Temperature: temp(21), Humidity: temp(40)},
+		{Timestamp: start.Add(30 * time.Second), DeviceID: "kitchen", Temperature: temp(21.5), Humidity: temp(40)},
+		{Timestamp: start.Add(time.Minute), DeviceID: "kitchen", Temperature: temp(21.5), Humidity: temp(40)},
+		{Timestamp: start.Add(20 * time.Minute), DeviceID: "kitchen", Temperature: temp(21.5), Humidity: temp(40)},
+		{Timestamp: start.Add(2 * time.Minute), DeviceID: "plug", On: &on, Power: temp(3)},
+		{Timestamp: start.Add(3 * time.Minute), DeviceID: "plug", On: &off, Power: temp(3)},
+	}
+	for _, u := range updates {
+		if err := h.Record(u); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+
+	series, err := h.Query("kitchen", "", start.Add(-time.Hour), start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Unchanged values are only recorded again after the heartbeat.
+	if got := series["temperature"]; len(got) != 3 || got[0].Value != 21 || got[1].Value != 21.5 {
+		t.Errorf("temperature = %+v, want 21, 21.5 and a heartbeat", got)
+	}
+	if got := series["humidity"]; len(got) != 2 {
+		t.Errorf("humidity = %+v, want the first value and a heartbeat", got)
+	}
+
+	series, err = h.Query("plug", "on", start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := series["on"]; len(series) != 1 || len(got) != 2 || got[0].Value != 1 || got[1].Value != 0 {
+		t.Errorf("plug on = %+v, want on then off", series)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("history files = %d, want one per day", len(entries))
+	}
+}
+
+func TestHistoryCompaction(t *testing.T) {
+	dir := t.TempDir()
+	writeDay := func(start time.Time, records []historyRecord) string {
+		t.Helper()
+		var data []byte
+		for _, rec := range records {
+			line, err := json.Marshal(rec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data = append(append(data, line...), '\n')
+		}
+		path := filepath.Join(dir, start.Format(historyDayLayout)+".jsonl")
+		if err := os.WriteFile(path, append(data, "torn"...), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// Two hours of a reading a minute, and a plug switched on and off
+	// within the hour.
+	old := time.Now().UTC().Truncate(24 * time.Hour).Add(-72 * time.Hour)
+	var records []historyRecord
+	for i := range 120 {
+		records = append(records, historyRecord{At: old.Add(time.Duration(i) * time.Minute), DeviceID: "kitchen", Metric: "temperature", Value: float64(i)})
+	}
+	for i, value := range []float64{1, 1, 0, 0} {
+		records = append(records, historyRecord{At: old.Add(time.Duration(i) * 10 * time.Minute), DeviceID: "plug", Metric: "on", Value: value})
+	}
+	writeDay(old, records)
+	recent := time.Now().UTC().Truncate(24 * time.Hour)
+	var recentRecords []historyRecord
+	for _, rec := range records[:10] {
+		rec.At = rec.At.Add(recent.Sub(old))
+		recentRecords = append(recentRecords, rec)
+	}
+	recentPath := writeDay(recent, recentRecords)
+
+	h, err := NewHistory(dir, 720*time.Hour, newTestBus(t), testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = h.Close() })
+
+	series, err := h.Query("kitchen", "temperature", old, old.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := series["temperature"]; len(got) != 2 || got[0].Value != 59 || got[1].Value != 119 {
+		t.Errorf("compacted temperature = %+v, want the last value of each hour", got)
+	}
+	series, err = h.Query("plug", "on", old, old.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := series["on"]; len(got) != 2 || got[0].Value != 1 || got[1].Value != 0 {
+		t.Errorf("compacted on = %+v, want on then off", got)
+	}
+
+	series, err = h.Query("kitchen", "temperature", recent, recent.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := series["temperature"]; len(got) != 10 {
+		t.Errorf("recent temperature = %d samples, want all 10", len(got))
+	}
+	if data, err := os.ReadFile(recentPath); err != nil || !strings.HasSuffix(string(data), "torn") {
+		t.Error("a recent day was rewritten")
+	}
+}
+
+func TestHandleHistory(t *testing.T) {
+	h := newTestHistory(t, t.TempDir())
+	temp := 19.5
+	if err := h.Record(events.StateUpdateEvent{Timestamp: time.Now().Add(-time.Hour), DeviceID: "kitchen", Temperature: &temp}); err != nil {
+		t.Fatal(err)
+	}
+
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ws.deviceProvider = fakeDeviceProvider{
+		"kitchen": {Device: devices.Device{ID: "kitchen", Name: "Kitchen", Topic: "kitchen", Type: devices.DeviceTypeClimateSensor}},
+	}
+	ws.SetHistory(h)
+
+	rec := httptest.NewRecorder()
+	ws.HandleHistory(rec, httptest.NewRequest("GET", "/api/v1/history?device=kitchen&metric=temperature", nil))
+	if rec.Code != 200 {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp HistoryResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Series["temperature"]; len(got) != 1 || got[0].Value != temp {
+		t.Errorf("series = %+v, want the recorded temperature", resp.Series)
+	}
+
+	for query, want := range map[string]int{
+		"device=kitchen&metric=pressure": 400,
+		"device=kitchen&since=yesterday": 400,
+		"device=kitchen&until=soon":      400,
+		"device=attic":                   404,
+		"device=kitchen&since=30m":       200,
+	} {
+		rec := httptest.NewRecorder()
+		ws.HandleHistory(rec, httptest.NewRequest("GET", "/api/v1/history?"+query, nil))
+		if rec.Code != want {
+			t.Errorf("%s: status = %d, want %d", query, rec.Code, want)
+		}
+	}
+}
+
+func TestHistoryHeartbeatFromDeviceSeen(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+	bus.SetLivenessEvents(true)
+
+	h, err := NewHistory(t.TempDir(), 48*time.Hour, bus, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = h.Close() })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Run(ctx)
+
+	client, err := bus.Client(events.ClientDeviceManager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := eventbus.Publish[events.DeviceSeenEvent](client)
+
+	// A steady sensor reports once, then only its liveness.
+	start := time.Now().UTC().Add(-time.Hour)
+	temp := 21.5
+	bus.PublishStateUpdate(client, events.StateUpdateEvent{Timestamp: start, DeviceID: "kitchen", Temperature: &temp})
+	seen.Publish(events.DeviceSeenEvent{Timestamp: start.Add(5 * time.Minute), DeviceID: "kitchen"})
+	seen.Publish(events.DeviceSeenEvent{Timestamp: start.Add(16 * time.Minute), DeviceID: "kitchen"})
+	seen.Publish(events.DeviceSeenEvent{Timestamp: start.Add(20 * time.Minute), DeviceID: "kitchen"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		series, err := h.Query("kitchen", "temperature", start.Add(-time.Minute), start.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := series["temperature"]
+		if len(got) == 2 && got[1].At.Equal(start.Add(16*time.Minute)) && got[1].Value == temp {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("temperature = %+v, want the report and a heartbeat at 16m", got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
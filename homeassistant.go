@@ -0,0 +1,338 @@
+package z2mhomekit
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+// haEntity is a Home Assistant MQTT entity mirroring part of a device.
+type haEntity struct {
+	component string // light, switch, fan, cover, sensor or binary_sensor
+	object    string // unique within the device, e.g. "light" or "temperature"
+	label     string // name after the device's; empty for its main entity
+	fields    []haField
+}
+
+// haField is an entity option. A list keeps the options in the order
+// they are written.
+type haField struct {
+	key   string
+	value any
+}
+
+type haSensor struct {
+	enabled     bool
+	object      string
+	label       string
+	template    string
+	deviceClass string
+	unit        string
+}
+
+// haComponents is the order entities are written in.
+var haComponents = []string{"light", "switch", "fan", "cover", "sensor", "binary_sensor"}
+
+type haExportOptions struct {
+	devicesPath string
+	format      string
+	out         string
+	prefix      string
+}
+
+// ExportHomeAssistant implements the export-homeassistant subcommand and
+// returns the process exit code.
+func ExportHomeAssistant(args []string) int {
+	fs := flag.NewFlagSet("export-homeassistant", flag.ContinueOnError)
+	opts := haExportOptions{}
+	fs.StringVar(&opts.devicesPath, "devices", envOr("Z2M_HOMEKIT_DEVICES_CONFIG", "./devices.hujson"), "path to devices.hujson")
+	fs.StringVar(&opts.format, "format", "yaml", "yaml for configuration.yaml, or discovery for discovery payloads")
+	fs.StringVar(&opts.out, "out", "", "file for yaml, stdout if empty; directory for discovery")
+	fs.StringVar(&opts.prefix, "prefix", "homeassistant", "Home Assistant discovery prefix")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: z2m-homekit export-homeassistant [flags]\n\n")
+		fmt.Fprintf(fs.Output(), "Writes Home Assistant MQTT entities for the configured devices, reading\n")
+		fmt.Fprintf(fs.Output(), "and commanding the same zigbee2mqtt topics, as configuration.yaml or as\n")
+		fmt.Fprintf(fs.Output(), "discovery payloads to publish retained.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if opts.format != "yaml" && opts.format != "discovery" {
+		fmt.Fprintf(os.Stderr, "export-homeassistant: unknown format %q\n", opts.format)
+		return 2
+	}
+	if opts.format == "discovery" && opts.out == "" {
+		fmt.Fprintf(os.Stderr, "export-homeassistant: discovery needs -out\n")
+		return 2
+	}
+
+	if err := exportHomeAssistant(os.Stdout, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "export-homeassistant: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func exportHomeAssistant(out io.Writer, opts haExportOptions) error {
+	deviceCfg, err := devices.LoadConfig(opts.devicesPath)
+	if err != nil {
+		return err
+	}
+
+	if opts.format == "discovery" {
+		n, err := writeHADiscovery(opts.out, opts.prefix, deviceCfg.Devices)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "wrote %d discovery payloads to %s; publish each retained to its path\n", n, opts.out)
+		return nil
+	}
+
+	var buf bytes.Buffer
+	writeHAYAML(&buf, deviceCfg.Devices)
+	if opts.out == "" {
+		_, err := out.Write(buf.Bytes())
+		return err
+	}
+	return os.WriteFile(opts.out, buf.Bytes(), 0o644)
+}
+
+// writeHAYAML writes the entities of every device under the mqtt key of
+// configuration.yaml. Values are written as JSON, which YAML reads as
+// quoted strings and flow lists.
+func writeHAYAML(w io.Writer, configured []devices.Device) {
+	byComponent := make(map[string][]haEntity)
+	fmt.Fprintf(w, "# Home Assistant MQTT entities exported by z2m-homekit.\n")
+	for _, d := range configured {
+		entities := haEntities(d)
+		if !slices.ContainsFunc(entities, func(e haEntity) bool { return e.label == "" }) {
+			fmt.Fprintf(w, "# Not exported: %s (%s), other than its sensors\n", d.ID, d.Type)
+		}
+		for _, e := range entities {
+			e.fields = append(haCommonFields(d, e, d.Name+haLabelSuffix(e)), e.fields...)
+			byComponent[e.component] = append(byComponent[e.component], e)
+		}
+	}
+
+	fmt.Fprintf(w, "mqtt:\n")
+	for _, component := range haComponents {
+		entities := byComponent[component]
+		if len(entities) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "  %s:\n", component)
+		for _, e := range entities {
+			for i, f := range e.fields {
+				marker := "    "
+				if i == 0 {
+					marker = "  - "
+				}
+				fmt.Fprintf(w, "  %s%s: %s\n", marker, f.key, haJSON(f.value))
+			}
+		}
+	}
+}
+
+// writeHADiscovery writes each entity's discovery payload to
+// <dir>/<prefix>/<component>/<node>/<object>/config, the topic it is
+// published on, and returns how many it wrote.
+func writeHADiscovery(dir, prefix string, configured []devices.Device) (int, error) {
+	n := 0
+	for _, d := range configured {
+		node := haNodeID(d)
+		for _, e := range haEntities(d) {
+			var name any
+			if e.label != "" {
+				name = e.label
+			}
+			fields := append(haCommonFields(d, e, name), e.fields...)
+			fields = append(fields, haField{"device", map[string]any{
+				"identifiers": []string{node},
+				"name":        d.Name,
+			}})
+
+			var payload bytes.Buffer
+			payload.WriteByte('{')
+			for i, f := range fields {
+				if i > 0 {
+					payload.WriteByte(',')
+				}
+				fmt.Fprintf(&payload, "%s:%s", haJSON(f.key), haJSON(f.value))
+			}
+			payload.WriteString("}\n")
+
+			path := filepath.Join(dir, prefix, e.component, node, e.object, "config")
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return n, err
+			}
+			if err := os.WriteFile(path, payload.Bytes(), 0o644); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+func haNodeID(d devices.Device) string {
+	return "z2m_homekit_" + d.ID
+}
+
+func haLabelSuffix(e haEntity) string {
+	if e.label == "" {
+		return ""
+	}
+	return " " + e.label
+}
+
+func haCommonFields(d devices.Device, e haEntity, name any) []haField {
+	return []haField{
+		{"name", name},
+		{"unique_id", haNodeID(d) + "_" + e.object},
+		{"state_topic", "zigbee2mqtt/" + d.Topic},
+	}
+}
+
+// haJSON encodes a value without escaping HTML, so templates stay
+// readable.
+func haJSON(v any) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "null"
+	}
+	return string(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
+
+// haEntities returns the Home Assistant entities for a device: its main
+// entity, if it has one Home Assistant can command, and a sensor for
+// each reading. Remotes and security systems only get their sensors.
+func haEntities(d devices.Device) []haEntity {
+	set := "zigbee2mqtt/" + d.Topic + "/set"
+	f := d.Features
+
+	var entities []haEntity
+	switch d.Type {
+	case devices.DeviceTypeLightbulb:
+		modes := []string{}
+		if f.ColorTemperature {
+			modes = append(modes, "color_temp")
+		}
+		if f.Color {
+			modes = append(modes, "xy")
+		}
+		if len(modes) == 0 && f.Brightness {
+			modes = append(modes, "brightness")
+		}
+		if len(modes) == 0 {
+			modes = append(modes, "onoff")
+		}
+		fields := []haField{
+			{"schema", "json"},
+			{"command_topic", set},
+			{"supported_color_modes", modes},
+		}
+		if f.Brightness {
+			fields = append(fields, haField{"brightness", true}, haField{"brightness_scale", 254})
+		}
+		if r := d.ColorTempRange; r != nil && f.ColorTemperature {
+			fields = append(fields, haField{"min_mireds", r.Min}, haField{"max_mireds", r.Max})
+		}
+		entities = append(entities, haEntity{component: "light", object: "light", fields: fields})
+	case devices.DeviceTypeOutlet, devices.DeviceTypeSwitch:
+		entities = append(entities, haEntity{component: "switch", object: "switch", fields: []haField{
+			{"command_topic", set + "/state"},
+			{"value_template", "{{ value_json.state }}"},
+		}})
+	case devices.DeviceTypeFan:
+		entities = append(entities, haEntity{component: "fan", object: "fan", fields: []haField{
+			{"command_topic", set + "/state"},
+			{"state_value_template", "{{ value_json.state }}"},
+		}})
+	case devices.DeviceTypeCover:
+		fields := []haField{
+			{"command_topic", set + "/state"},
+			{"value_template", "{{ value_json.state }}"},
+			{"state_open", "OPEN"},
+			{"state_closed", "CLOSE"},
+		}
+		if f.Position {
+			fields = append(fields,
+				haField{"position_topic", "zigbee2mqtt/" + d.Topic},
+				haField{"position_template", "{{ value_json.position }}"},
+				haField{"set_position_topic", set + "/position"},
+			)
+		}
+		entities = append(entities, haEntity{component: "cover", object: "cover", fields: fields})
+	}
+
+	temperatureUnit := "°C"
+	switch d.Units.Temperature {
+	case "F":
+		temperatureUnit = "°F"
+	case "K":
+		temperatureUnit = "K"
+	}
+	pressureUnit := d.Units.Pressure
+	if pressureUnit == "" {
+		pressureUnit = "hPa"
+	}
+	illuminance := "{{ value_json.illuminance_lux if value_json.illuminance_lux is defined else value_json.illuminance }}"
+	if d.Units.Illuminance == "raw" {
+		illuminance = "{{ (10 ** ((value_json.illuminance - 1) / 10000)) | round }}"
+	}
+
+	for _, s := range []haSensor{
+		{f.Temperature, "temperature", "Temperature", "{{ value_json.temperature }}", "temperature", temperatureUnit},
+		{f.Humidity, "humidity", "Humidity", "{{ value_json.humidity }}", "humidity", "%"},
+		{f.Pressure, "pressure", "Pressure", "{{ value_json.pressure }}", "pressure", pressureUnit},
+		{f.Illuminance, "illuminance", "Illuminance", illuminance, "illuminance", "lx"},
+		{f.Power, "power", "Power", "{{ value_json.power }}", "power", "W"},
+		{f.Power, "energy", "Energy", "{{ value_json.energy }}", "energy", "kWh"},
+		{f.Battery, "battery", "Battery", "{{ value_json.battery }}", "battery", "%"},
+	} {
+		if !s.enabled {
+			continue
+		}
+		stateClass := "measurement"
+		if s.object == "energy" {
+			stateClass = "total_increasing"
+		}
+		entities = append(entities, haEntity{component: "sensor", object: s.object, label: s.label, fields: []haField{
+			{"value_template", s.template},
+			{"device_class", s.deviceClass},
+			{"unit_of_measurement", s.unit},
+			{"state_class", stateClass},
+		}})
+	}
+
+	// Binary sensors are on for the problem or presence; a closed contact
+	// reports contact true, so a door is on when it is false.
+	for _, s := range []haSensor{
+		{f.Occupancy, "occupancy", "Occupancy", "{{ 'ON' if value_json.occupancy else 'OFF' }}", "occupancy", ""},
+		{f.Contact, "contact", "Door", "{{ 'OFF' if value_json.contact else 'ON' }}", "door", ""},
+		{f.WaterLeak, "water_leak", "Leak", "{{ 'ON' if value_json.water_leak else 'OFF' }}", "moisture", ""},
+		{f.Smoke, "smoke", "Smoke", "{{ 'ON' if value_json.smoke else 'OFF' }}", "smoke", ""},
+		{f.Tamper, "tamper", "Tamper", "{{ 'ON' if value_json.tamper else 'OFF' }}", "tamper", ""},
+	} {
+		if !s.enabled {
+			continue
+		}
+		entities = append(entities, haEntity{component: "binary_sensor", object: s.object, label: s.label, fields: []haField{
+			{"value_template", s.template},
+			{"device_class", s.deviceClass},
+		}})
+	}
+
+	return entities
+}
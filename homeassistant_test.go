@@ -0,0 +1,92 @@
+package z2mhomekit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const haDevicesConfig = `{
+  "devices": [
+    {"id": "lamp", "name": "Lamp", "topic": "Living room/Lamp", "type": "lightbulb",
+     "features": {"brightness": true, "color_temperature": true}, "color_temp_range": {"min": 250, "max": 454}},
+    {"id": "kitchen", "name": "Kitchen", "topic": "kitchen", "type": "climate_sensor",
+     "features": {"temperature": true, "humidity": true, "battery": true}, "units": {"temperature": "F"}},
+    {"id": "door", "name": "Door", "topic": "door", "type": "contact_sensor", "features": {"contact": true}},
+    {"id": "remote", "name": "Remote", "topic": "remote", "type": "button", "remote": "tradfri_remote"},
+  ],
+}`
+
+func TestExportHomeAssistantYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.hujson")
+	if err := os.WriteFile(path, []byte(haDevicesConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := exportHomeAssistant(&out, haExportOptions{devicesPath: path, format: "yaml"}); err != nil {
+		t.Fatalf("exportHomeAssistant: %v", err)
+	}
+	yaml := out.String()
+
+	for _, want := range []string{
+		"mqtt:\n  light:\n    - name: \"Lamp\"\n      unique_id: \"z2m_homekit_lamp_light\"\n      state_topic: \"zigbee2mqtt/Living room/Lamp\"\n",
+		`      command_topic: "zigbee2mqtt/Living room/Lamp/set"`,
+		`      supported_color_modes: ["color_temp"]`,
+		`      max_mireds: 454`,
+		`    - name: "Kitchen Temperature"`,
+		`      unit_of_measurement: "°F"`,
+		`      value_template: "{{ 'OFF' if value_json.contact else 'ON' }}"`,
+		`# Not exported: remote (button), other than its sensors`,
+	} {
+		if !strings.Contains(yaml, want) {
+			t.Errorf("YAML lacks %q:\n%s", want, yaml)
+		}
+	}
+}
+
+func TestExportHomeAssistantDiscovery(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "devices.hujson")
+	if err := os.WriteFile(path, []byte(haDevicesConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "discovery")
+	if err := exportHomeAssistant(io.Discard, haExportOptions{devicesPath: path, format: "discovery", out: out, prefix: "homeassistant"}); err != nil {
+		t.Fatalf("exportHomeAssistant: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(out, "homeassistant", "sensor", "z2m_homekit_kitchen", "humidity", "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload struct {
+		Name       string `json:"name"`
+		UniqueID   string `json:"unique_id"`
+		StateTopic string `json:"state_topic"`
+		Device     struct {
+			Identifiers []string `json:"identifiers"`
+			Name        string   `json:"name"`
+		} `json:"device"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		t.Fatalf("decode: %v\n%s", err, data)
+	}
+	if payload.Name != "Humidity" || payload.UniqueID != "z2m_homekit_kitchen_humidity" || payload.StateTopic != "zigbee2mqtt/kitchen" || payload.Device.Name != "Kitchen" {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	// The main entity is named after the device.
+	data, err = os.ReadFile(filepath.Join(out, "homeassistant", "light", "z2m_homekit_lamp", "light", "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(`{"name":null,`)) {
+		t.Errorf("light payload = %s", data)
+	}
+}
@@ -0,0 +1,241 @@
+package z2mhomekit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+// homebridgeConfig is the part of a Homebridge config.json the import
+// reads: the homebridge-z2m platform.
+type homebridgeConfig struct {
+	Platforms []homebridgePlatform `json:"platforms"`
+}
+
+type homebridgePlatform struct {
+	Platform string             `json:"platform"`
+	Defaults homebridgeDevice   `json:"defaults"`
+	Devices  []homebridgeDevice `json:"devices"`
+}
+
+// homebridgeDevice is a homebridge-z2m device entry, or its defaults.
+type homebridgeDevice struct {
+	ID           string                     `json:"id"` // friendly name or IEEE address
+	Exclude      *bool                      `json:"exclude"`
+	ExcludedKeys []string                   `json:"excluded_keys"`
+	IncludedKeys []string                   `json:"included_keys"`
+	Converters   map[string]json.RawMessage `json:"converters"`
+}
+
+// homebridgeFeatures maps the keys homebridge-z2m can exclude to the
+// device features they turn off.
+var homebridgeFeatures = map[string]func(f *devices.DeviceFeatures){
+	"brightness":      func(f *devices.DeviceFeatures) { f.Brightness = false },
+	"color_temp":      func(f *devices.DeviceFeatures) { f.ColorTemperature = false },
+	"color":           func(f *devices.DeviceFeatures) { f.Color = false },
+	"color_hs":        func(f *devices.DeviceFeatures) { f.Color = false },
+	"color_xy":        func(f *devices.DeviceFeatures) { f.Color = false },
+	"power":           func(f *devices.DeviceFeatures) { f.Power = false },
+	"temperature":     func(f *devices.DeviceFeatures) { f.Temperature = false },
+	"humidity":        func(f *devices.DeviceFeatures) { f.Humidity = false },
+	"pressure":        func(f *devices.DeviceFeatures) { f.Pressure = false },
+	"occupancy":       func(f *devices.DeviceFeatures) { f.Occupancy = false },
+	"illuminance":     func(f *devices.DeviceFeatures) { f.Illuminance = false },
+	"illuminance_lux": func(f *devices.DeviceFeatures) { f.Illuminance = false },
+	"contact":         func(f *devices.DeviceFeatures) { f.Contact = false },
+	"water_leak":      func(f *devices.DeviceFeatures) { f.WaterLeak = false },
+	"smoke":           func(f *devices.DeviceFeatures) { f.Smoke = false },
+	"tamper":          func(f *devices.DeviceFeatures) { f.Tamper = false },
+	"battery":         func(f *devices.DeviceFeatures) { f.Battery = false },
+	"position":        func(f *devices.DeviceFeatures) { f.Position = false },
+	"tilt":            func(f *devices.DeviceFeatures) { f.Tilt = false },
+}
+
+type importOptions struct {
+	homebridge    string
+	bridgeDevices string
+	out           string
+	force         bool
+}
+
+// Import implements the import subcommand and returns the process exit
+// code.
+func Import(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	opts := importOptions{}
+	fs.StringVar(&opts.homebridge, "homebridge", "", "Homebridge config.json with the homebridge-z2m platform")
+	fs.StringVar(&opts.bridgeDevices, "bridge-devices", "", "zigbee2mqtt/bridge/devices payload, for the device types")
+	fs.StringVar(&opts.out, "out", "", "devices.hujson to write; stdout if empty")
+	fs.BoolVar(&opts.force, "force", false, "overwrite an existing -out file")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: z2m-homekit import -homebridge config.json -bridge-devices devices.json [flags]\n\n")
+		fmt.Fprintf(fs.Output(), "Converts a homebridge-z2m configuration into a devices.hujson. Homebridge\n")
+		fmt.Fprintf(fs.Output(), "reads device types from zigbee2mqtt, so save its device list first, e.g.\n")
+		fmt.Fprintf(fs.Output(), "  mosquitto_sub -t zigbee2mqtt/bridge/devices -C 1 > devices.json\n\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if opts.homebridge == "" || opts.bridgeDevices == "" {
+		fs.Usage()
+		return 2
+	}
+
+	if err := runImport(os.Stdout, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "import: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runImport(out io.Writer, opts importOptions) error {
+	data, err := os.ReadFile(opts.homebridge)
+	if err != nil {
+		return err
+	}
+	var hb homebridgeConfig
+	if err := json.Unmarshal(data, &hb); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", opts.homebridge, err)
+	}
+	i := slices.IndexFunc(hb.Platforms, func(p homebridgePlatform) bool { return p.Platform == "zigbee2mqtt" })
+	if i < 0 {
+		return fmt.Errorf("%s has no zigbee2mqtt platform", opts.homebridge)
+	}
+	platform := hb.Platforms[i]
+
+	data, err = os.ReadFile(opts.bridgeDevices)
+	if err != nil {
+		return err
+	}
+	list, err := devices.ParseBridgeDevices(data)
+	if err != nil {
+		return err
+	}
+
+	imported, skipped := importHomebridge(platform, list)
+	if len(imported) == 0 {
+		return errors.New("no devices to import")
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Imported from %s by z2m-homekit import.\n", filepath.Base(opts.homebridge))
+	for _, s := range skipped {
+		fmt.Fprintf(&buf, "// Not imported: %s\n", s)
+	}
+	cfg, err := json.MarshalIndent(devices.Config{Devices: imported}, "", "  ")
+	if err != nil {
+		return err
+	}
+	buf.Write(cfg)
+	buf.WriteByte('\n')
+
+	if opts.out == "" {
+		_, err := out.Write(buf.Bytes())
+		return err
+	}
+	if _, err := os.Stat(opts.out); err == nil && !opts.force {
+		return fmt.Errorf("%s exists, use -force to overwrite it", opts.out)
+	}
+	if err := os.WriteFile(opts.out, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	if _, err := devices.LoadConfig(opts.out); err != nil {
+		return fmt.Errorf("wrote %s, but it does not load: %w", opts.out, err)
+	}
+	fmt.Fprintf(out, "wrote %s with %d devices\n", opts.out, len(imported))
+	return nil
+}
+
+// importHomebridge maps the zigbee2mqtt devices to device configuration
+// with the homebridge-z2m settings applied: devices excluded from
+// Homebridge are kept off HomeKit, excluded keys turn features off and
+// switch converters choose the presentation. skipped describes what could
+// not be imported.
+func importHomebridge(platform homebridgePlatform, list []devices.Z2MDevice) (imported []devices.Device, skipped []string) {
+	matched := make(map[string]bool)
+	ids := make(map[string]bool)
+	for _, z := range list {
+		if z.Type == "Coordinator" {
+			continue
+		}
+
+		entry := platform.Defaults
+		if i := slices.IndexFunc(platform.Devices, func(d homebridgeDevice) bool {
+			return d.ID == z.FriendlyName || d.ID == z.IEEEAddress
+		}); i >= 0 {
+			entry = mergeHomebridgeDevice(platform.Defaults, platform.Devices[i])
+			matched[platform.Devices[i].ID] = true
+		}
+
+		device, ok := devices.DiscoverDevice(z)
+		if !ok {
+			skipped = append(skipped, fmt.Sprintf("%s: nothing HomeKit can show", z.FriendlyName))
+			continue
+		}
+
+		for id, n := device.ID, 2; ids[device.ID]; n++ {
+			device.ID = fmt.Sprintf("%s-%d", id, n)
+		}
+		ids[device.ID] = true
+
+		if entry.Exclude != nil && *entry.Exclude {
+			device.HomeKit = devices.Ptr(false)
+		}
+		for _, key := range entry.ExcludedKeys {
+			if off, ok := homebridgeFeatures[key]; ok && !slices.Contains(entry.IncludedKeys, key) {
+				off(&device.Features)
+			}
+		}
+		if device.Type == devices.DeviceTypeSwitch || device.Type == devices.DeviceTypeOutlet {
+			var sw struct {
+				Type devices.Presentation `json:"type"`
+			}
+			if raw, ok := entry.Converters["switch"]; ok && json.Unmarshal(raw, &sw) == nil {
+				switch sw.Type {
+				case devices.PresentationSwitch, devices.PresentationOutlet:
+					device.Presentation = sw.Type
+				}
+			}
+		}
+
+		imported = append(imported, device)
+	}
+
+	for _, d := range platform.Devices {
+		if !matched[d.ID] {
+			skipped = append(skipped, fmt.Sprintf("%s: not in the zigbee2mqtt device list", d.ID))
+		}
+	}
+	return imported, skipped
+}
+
+// mergeHomebridgeDevice applies a device entry over the platform defaults,
+// as homebridge-z2m does: set values replace the defaults.
+func mergeHomebridgeDevice(defaults, d homebridgeDevice) homebridgeDevice {
+	merged := defaults
+	merged.ID = d.ID
+	if d.Exclude != nil {
+		merged.Exclude = d.Exclude
+	}
+	if d.ExcludedKeys != nil {
+		merged.ExcludedKeys = d.ExcludedKeys
+	}
+	if d.IncludedKeys != nil {
+		merged.IncludedKeys = d.IncludedKeys
+	}
+	if d.Converters != nil {
+		merged.Converters = d.Converters
+	}
+	return merged
+}
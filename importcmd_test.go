@@ -0,0 +1,132 @@
+package z2mhomekit
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+const homebridgeSample = `{
+  "bridge": {"name": "Homebridge"},
+  "platforms": [
+    {"platform": "Config"},
+    {
+      "platform": "zigbee2mqtt",
+      "mqtt": {"server": "mqtt://localhost:1883", "base_topic": "zigbee2mqtt"},
+      "defaults": {"excluded_keys": ["battery"]},
+      "devices": [
+        {"id": "Living room/Lamp", "excluded_keys": ["color_xy"]},
+        {"id": "0x00158d0003", "converters": {"switch": {"type": "outlet"}}},
+        {"id": "hall-motion", "exclude": true},
+        {"id": "garage-door"}
+      ]
+    }
+  ]
+}`
+
+const importBridgeDevices = `[
+  {"ieee_address": "0x00124b0001", "friendly_name": "Coordinator", "type": "Coordinator", "supported": false, "definition": null},
+  {"ieee_address": "0x00158d0001", "friendly_name": "Kitchen Aqara", "type": "EndDevice", "supported": true,
+   "definition": {"model": "WSDCGQ11LM", "vendor": "Aqara", "exposes": [
+     {"type": "numeric", "name": "temperature", "property": "temperature"},
+     {"type": "numeric", "name": "battery", "property": "battery"}
+   ]}},
+  {"ieee_address": "0x00158d0002", "friendly_name": "Living room/Lamp", "type": "Router", "supported": true,
+   "definition": {"model": "LED1836G9", "vendor": "IKEA", "exposes": [
+     {"type": "light", "features": [
+       {"type": "binary", "name": "state", "property": "state"},
+       {"type": "numeric", "name": "brightness", "property": "brightness"},
+       {"type": "composite", "name": "color_xy", "property": "color"}
+     ]}
+   ]}},
+  {"ieee_address": "0x00158d0003", "friendly_name": "desk-plug", "type": "Router", "supported": true,
+   "definition": {"model": "ZNCZ03LM", "vendor": "Aqara", "exposes": [
+     {"type": "switch", "features": [{"type": "binary", "name": "state", "property": "state"}]}
+   ]}},
+  {"ieee_address": "0x00158d0004", "friendly_name": "hall-motion", "type": "EndDevice", "supported": true,
+   "definition": {"model": "RTCGQ11LM", "vendor": "Aqara", "exposes": [
+     {"type": "binary", "name": "occupancy", "property": "occupancy"}
+   ]}},
+  {"ieee_address": "0x00158d0005", "friendly_name": "hall/motion", "type": "EndDevice", "supported": true,
+   "definition": {"model": "RTCGQ11LM", "vendor": "Aqara", "exposes": [
+     {"type": "binary", "name": "occupancy", "property": "occupancy"}
+   ]}}
+]`
+
+func TestRunImport(t *testing.T) {
+	dir := t.TempDir()
+	opts := importOptions{
+		homebridge:    filepath.Join(dir, "config.json"),
+		bridgeDevices: filepath.Join(dir, "devices.json"),
+		out:           filepath.Join(dir, "devices.hujson"),
+	}
+	if err := os.WriteFile(opts.homebridge, []byte(homebridgeSample), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(opts.bridgeDevices, []byte(importBridgeDevices), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runImport(io.Discard, opts); err != nil {
+		t.Fatalf("runImport: %v", err)
+	}
+
+	data, err := os.ReadFile(opts.out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "// Not imported: garage-door: not in the zigbee2mqtt device list") {
+		t.Errorf("output does not note garage-door:\n%s", data)
+	}
+
+	cfg, err := devices.LoadConfig(opts.out)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	got := make(map[string]devices.Device)
+	for _, d := range cfg.Devices {
+		got[d.ID] = d
+	}
+	if len(got) != 5 {
+		t.Fatalf("imported %d devices, want 5: %v", len(got), cfg.Devices)
+	}
+
+	if d := got["kitchen-aqara"]; !d.Features.Temperature || d.Features.Battery {
+		t.Errorf("kitchen-aqara features = %+v, want temperature without the default-excluded battery", d.Features)
+	}
+	if d := got["living-room-lamp"]; !d.Features.Brightness || d.Features.Color {
+		t.Errorf("living-room-lamp features = %+v, want brightness without color", d.Features)
+	}
+	if d := got["desk-plug"]; d.Presentation != devices.PresentationOutlet {
+		t.Errorf("desk-plug presentation = %q, want outlet", d.Presentation)
+	}
+	if d := got["hall-motion"]; d.HomeKit == nil || *d.HomeKit {
+		t.Errorf("excluded hall-motion is in HomeKit")
+	}
+	if d, ok := got["hall-motion-2"]; !ok || d.Topic != "hall/motion" {
+		t.Errorf("clashing ID not made unique: %v", cfg.Devices)
+	}
+
+	if err := runImport(io.Discard, opts); err == nil || !strings.Contains(err.Error(), "-force") {
+		t.Errorf("second import error = %v, want one about -force", err)
+	}
+	opts.force = true
+	if err := runImport(io.Discard, opts); err != nil {
+		t.Errorf("import with -force: %v", err)
+	}
+}
+
+func TestRunImportNoPlatform(t *testing.T) {
+	dir := t.TempDir()
+	opts := importOptions{homebridge: filepath.Join(dir, "config.json"), bridgeDevices: filepath.Join(dir, "devices.json")}
+	if err := os.WriteFile(opts.homebridge, []byte(`{"platforms": [{"platform": "Config"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := runImport(io.Discard, opts); err == nil {
+		t.Error("runImport without a zigbee2mqtt platform succeeded")
+	}
+}
@@ -0,0 +1,188 @@
+package z2mhomekit
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+//go:embed assets/docker-compose.yml
+var composeSample string
+
+//go:embed assets/devices.example.hujson
+var devicesSample string
+
+const envFileName = "z2m-homekit.env"
+
+// HomeKit rejects setup codes that are all the same digit or the two obvious
+// sequences.
+var trivialPins = map[string]bool{
+	"00000000": true, "11111111": true, "22222222": true, "33333333": true,
+	"44444444": true, "55555555": true, "66666666": true, "77777777": true,
+	"88888888": true, "99999999": true, "12345678": true, "87654321": true,
+}
+
+type initOptions struct {
+	dir   string
+	force bool
+}
+
+// Init implements the init subcommand and returns the process exit code.
+func Init(args []string) int {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	opts := initOptions{}
+	fs.StringVar(&opts.dir, "dir", ".", "directory to set up")
+	fs.BoolVar(&opts.force, "force", false, "overwrite existing devices.hujson and env file")
+	compose := fs.Bool("compose", false, "print a docker-compose.yml for running z2m-homekit with zigbee2mqtt and exit")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: z2m-homekit init [flags]\n\n")
+		fmt.Fprintf(fs.Output(), "Creates the data directories, an example devices.hujson and an env file\n")
+		fmt.Fprintf(fs.Output(), "with a random HomeKit PIN.\n\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *compose {
+		fmt.Print(composeSample)
+		return 0
+	}
+
+	if err := runInit(os.Stdout, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "init: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+func runInit(out io.Writer, opts initOptions) error {
+	dir, err := filepath.Abs(opts.dir)
+	if err != nil {
+		return err
+	}
+
+	hapDir := filepath.Join(dir, "data", "hap")
+	tsDir := filepath.Join(dir, "data", "tailscale")
+	for _, d := range []string{hapDir, tsDir} {
+		if err := os.MkdirAll(d, 0o700); err != nil {
+			return fmt.Errorf("failed to create %s: %w", d, err)
+		}
+		fmt.Fprintf(out, "created   %s\n", d)
+	}
+
+	devicesPath := filepath.Join(dir, "devices.hujson")
+	if _, err := writeInitFile(out, devicesPath, devicesSample, 0o644, opts.force); err != nil {
+		return err
+	}
+
+	pin, err := generatePin()
+	if err != nil {
+		return fmt.Errorf("failed to generate HAP PIN: %w", err)
+	}
+
+	envPath := filepath.Join(dir, envFileName)
+	written, err := writeInitFile(out, envPath, envTemplate(pin, hapDir, tsDir, devicesPath), 0o600, opts.force)
+	if err != nil {
+		return err
+	}
+
+	if _, err := devices.LoadConfig(devicesPath); err != nil {
+		return fmt.Errorf("%s is not a valid devices configuration: %w", devicesPath, err)
+	}
+
+	fmt.Fprintln(out)
+	if written {
+		fmt.Fprintf(out, "HomeKit PIN: %s-%s\n\n", pin[:4], pin[4:])
+	}
+	fmt.Fprintf(out, "Next steps:\n")
+	fmt.Fprintf(out, "  1. Edit %s to match your zigbee2mqtt devices.\n", devicesPath)
+	fmt.Fprintf(out, "  2. Point zigbee2mqtt's mqtt.server at mqtt://<this host>:1883.\n")
+	fmt.Fprintf(out, "  3. Start the bridge:\n")
+	fmt.Fprintf(out, "       set -a; . %s; set +a; z2m-homekit\n", envPath)
+	fmt.Fprintf(out, "     or with Docker: z2m-homekit init -compose > docker-compose.yml\n")
+	fmt.Fprintf(out, "  4. In the Home app, add an accessory and scan the QR code or enter the PIN.\n")
+
+	return nil
+}
+
+// writeInitFile writes content to path unless it exists and force is
+// unset. It reports whether the file was written.
+func writeInitFile(out io.Writer, path, content string, perm os.FileMode, force bool) (bool, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(path, flags, perm)
+	if errors.Is(err, fs.ErrExist) {
+		fmt.Fprintf(out, "kept      %s (exists, use -force to overwrite)\n", path)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+
+	if _, err := f.WriteString(content); err != nil {
+		_ = f.Close()
+		return false, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	fmt.Fprintf(out, "wrote     %s\n", path)
+	return true, nil
+}
+
+// generatePin returns a random 8 digit HomeKit setup code.
+func generatePin() (string, error) {
+	for {
+		n, err := rand.Int(rand.Reader, big.NewInt(100_000_000))
+		if err != nil {
+			return "", err
+		}
+		pin := fmt.Sprintf("%08d", n.Int64())
+		if !trivialPins[pin] {
+			return pin, nil
+		}
+	}
+}
+
+func envTemplate(pin, hapDir, tsDir, devicesPath string) string {
+	var b strings.Builder
+	b.WriteString("# z2m-homekit configuration, generated by z2m-homekit init.\n")
+	b.WriteString("# Load with: set -a; . ./" + envFileName + "; set +a\n\n")
+	fmt.Fprintf(&b, "Z2M_HOMEKIT_HAP_PIN=%s\n", pin)
+	fmt.Fprintf(&b, "Z2M_HOMEKIT_HAP_STORAGE_PATH=%s\n", hapDir)
+	fmt.Fprintf(&b, "Z2M_HOMEKIT_DEVICES_CONFIG=%s\n", devicesPath)
+	fmt.Fprintf(&b, "Z2M_HOMEKIT_TS_STATE_DIR=%s\n", tsDir)
+	b.WriteString("Z2M_HOMEKIT_BRIDGE_NAME=z2m-homekit\n\n")
+	b.WriteString("# Listener ports\n")
+	b.WriteString("#Z2M_HOMEKIT_HAP_PORT=51826\n")
+	b.WriteString("#Z2M_HOMEKIT_WEB_PORT=8081\n")
+	b.WriteString("#Z2M_HOMEKIT_MQTT_PORT=1883\n\n")
+	b.WriteString("# Logging: debug, info, warn, error / json, console\n")
+	b.WriteString("Z2M_HOMEKIT_LOG_LEVEL=info\n")
+	b.WriteString("Z2M_HOMEKIT_LOG_FORMAT=console\n\n")
+	b.WriteString("# Expose the web UI on your tailnet\n")
+	b.WriteString("#Z2M_HOMEKIT_TS_HOSTNAME=z2m-homekit\n")
+	b.WriteString("#Z2M_HOMEKIT_TS_AUTHKEY=tskey-auth-...\n\n")
+	b.WriteString("# Store secrets encrypted: z2m-homekit secrets keygen -key secrets.key,\n")
+	b.WriteString("# then use the output of z2m-homekit secrets encrypt as the value.\n")
+	b.WriteString("#Z2M_HOMEKIT_SECRETS_KEY_FILE=/path/to/secrets.key\n")
+	return b.String()
+}
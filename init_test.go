@@ -0,0 +1,58 @@
+package z2mhomekit
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGeneratePin(t *testing.T) {
+	for range 100 {
+		pin, err := generatePin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pin) != 8 || strings.Trim(pin, "0123456789") != "" {
+			t.Fatalf("generatePin() = %q, want 8 digits", pin)
+		}
+		if trivialPins[pin] {
+			t.Fatalf("generatePin() = %q, a trivial PIN", pin)
+		}
+	}
+}
+
+func TestRunInit(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := runInit(io.Discard, initOptions{dir: dir}); err != nil {
+		t.Fatalf("runInit: %v", err)
+	}
+
+	for _, d := range []string{"data/hap", "data/tailscale"} {
+		if info, err := os.Stat(filepath.Join(dir, d)); err != nil || !info.IsDir() {
+			t.Errorf("%s not created: %v", d, err)
+		}
+	}
+
+	env, err := os.ReadFile(filepath.Join(dir, envFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(env), "Z2M_HOMEKIT_HAP_PIN=") {
+		t.Errorf("env file has no PIN:\n%s", env)
+	}
+
+	// A second run keeps the existing PIN unless forced.
+	if err := runInit(io.Discard, initOptions{dir: dir}); err != nil {
+		t.Fatalf("second runInit: %v", err)
+	}
+	again, err := os.ReadFile(filepath.Join(dir, envFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(env) {
+		t.Error("second run overwrote the env file without -force")
+	}
+}
@@ -0,0 +1,225 @@
+//go:build !race
+
+// The race detector flags an unsynchronised read/write of the session in
+// brutella/hap's encrypted conn, which every HAP request hits. Run these
+// tests without -race until that is fixed upstream.
+
+// Package integration runs the full bridge against an in-memory
+// configuration and drives it through the embedded MQTT broker and a HAP
+// client, the same way zigbee2mqtt and the Home app would.
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/prometheus/client_golang/prometheus"
+
+	z2mhomekit "github.com/kradalby/z2m-homekit"
+	appconfig "github.com/kradalby/z2m-homekit/config"
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+var testDevices = []devices.Device{
+	{
+		ID:    "office-climate",
+		Name:  "Office Climate",
+		Topic: "office-climate",
+		Type:  devices.DeviceTypeClimateSensor,
+		Features: devices.DeviceFeatures{
+			Temperature: true,
+			Humidity:    true,
+		},
+	},
+	{
+		ID:    "desk-plug",
+		Name:  "Desk Plug",
+		Topic: "desk-plug",
+		Type:  devices.DeviceTypeOutlet,
+	},
+}
+
+type harness struct {
+	bridge  *z2mhomekit.Bridge
+	client  *hapClient
+	ctrl    *controller
+	store   hap.Store
+	hapAddr string
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("reserve port: %v", err)
+	}
+	defer ln.Close()
+
+	return ln.Addr().String()
+}
+
+func startBridge(t *testing.T) *harness {
+	t.Helper()
+
+	cfg := &appconfig.Config{
+		HAPPin:     "00102003",
+		BridgeName: "integration",
+		LogLevel:   "error",
+		LogFormat:  "text",
+	}
+	hapAddr := freeAddr(t)
+	cfg.SetListenerAddrsForTesting(hapAddr, freeAddr(t), freeAddr(t))
+
+	store := hap.NewMemStore()
+	ctrl := newController(t, store)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	bridge, err := z2mhomekit.NewBridge(cfg, &devices.Config{Devices: testDevices}, logger, z2mhomekit.BridgeOptions{
+		HAPStore:   store,
+		Registerer: prometheus.NewRegistry(),
+		DisableWeb: true,
+	})
+	if err != nil {
+		t.Fatalf("NewBridge: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := bridge.Start(ctx); err != nil {
+		cancel()
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		bridge.Close()
+	})
+
+	return &harness{
+		bridge:  bridge,
+		client:  ctrl.dial(t, hapAddr),
+		ctrl:    ctrl,
+		store:   store,
+		hapAddr: hapAddr,
+	}
+}
+
+func (h *harness) publish(t *testing.T, topic string, payload any) {
+	t.Helper()
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.bridge.MQTTServer().Publish(topic, b, false, 0); err != nil {
+		t.Fatalf("publish %s: %v", topic, err)
+	}
+}
+
+// subscribe collects messages published on the filter.
+func (h *harness) subscribe(t *testing.T, filter string) <-chan packets.Packet {
+	t.Helper()
+
+	ch := make(chan packets.Packet, 16)
+	err := h.bridge.MQTTServer().Subscribe(filter, 1, func(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+		select {
+		case ch <- pk:
+		default:
+		}
+	})
+	if err != nil {
+		t.Fatalf("subscribe %s: %v", filter, err)
+	}
+
+	return ch
+}
+
+func TestSensorStateReachesHomeKit(t *testing.T) {
+	h := startBridge(t)
+
+	tempAid, tempIid := h.client.characteristicID("Office Climate", service.TypeTemperatureSensor, characteristic.TypeCurrentTemperature)
+	humAid, humIid := h.client.characteristicID("Office Climate", service.TypeHumiditySensor, characteristic.TypeCurrentRelativeHumidity)
+
+	h.publish(t, "zigbee2mqtt/office-climate", map[string]any{
+		"temperature": 21.5,
+		"humidity":    48,
+		"linkquality": 120,
+	})
+
+	h.client.eventually(tempAid, tempIid, "21.5")
+	h.client.eventually(humAid, humIid, "48")
+}
+
+func TestToggleFromHomeKit(t *testing.T) {
+	h := startBridge(t)
+
+	sets := h.subscribe(t, "zigbee2mqtt/desk-plug/set")
+	aid, iid := h.client.characteristicID("Desk Plug", service.TypeOutlet, characteristic.TypeOn)
+
+	h.client.setValue(aid, iid, true)
+
+	select {
+	case pk := <-sets:
+		var cmd map[string]any
+		if err := json.Unmarshal(pk.Payload, &cmd); err != nil {
+			t.Fatalf("decode set payload %q: %v", pk.Payload, err)
+		}
+		if cmd["state"] != "ON" {
+			t.Fatalf("set payload = %s, want state ON", pk.Payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no command published to zigbee2mqtt/desk-plug/set")
+	}
+
+	// zigbee2mqtt confirms the new state; HomeKit follows it.
+	h.publish(t, "zigbee2mqtt/desk-plug", map[string]any{"state": "OFF"})
+	h.client.eventually(aid, iid, "false")
+
+	h.publish(t, "zigbee2mqtt/desk-plug", map[string]any{"state": "ON"})
+	h.client.eventually(aid, iid, "true")
+}
+
+func TestDeviceAddedAtRuntime(t *testing.T) {
+	h := startBridge(t)
+
+	version, err := h.store.Get("version")
+	if err != nil {
+		t.Fatalf("get configuration number: %v", err)
+	}
+
+	lamp := devices.Device{ID: "hall-lamp", Name: "Hall Lamp", Topic: "hall-lamp", Type: devices.DeviceTypeLightbulb}
+	changes := h.bridge.UpdateDevices(append(slices.Clone(testDevices), lamp))
+	if len(changes.Added) != 1 || changes.Added[0] != "hall-lamp" {
+		t.Fatalf("changes = %+v, want hall-lamp added", changes)
+	}
+
+	// The HAP server restarts with a new configuration number, which
+	// tells paired controllers to fetch the accessories again.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		next, err := h.store.Get("version")
+		if err == nil && string(next) != string(version) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("configuration number still %s", version)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	client := h.ctrl.dial(t, h.hapAddr)
+	aid, iid := client.characteristicID("Hall Lamp", service.TypeLightbulb, characteristic.TypeOn)
+
+	h.publish(t, "zigbee2mqtt/hall-lamp", map[string]any{"state": "ON"})
+	client.eventually(aid, iid, "true")
+}
@@ -0,0 +1,504 @@
+//go:build !race
+
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/chacha20poly1305"
+	"github.com/brutella/hap/curve25519"
+	"github.com/brutella/hap/hkdf"
+	"github.com/brutella/hap/tlv8"
+)
+
+const controllerID = "integration-controller"
+
+// controller is a HomeKit controller identity that is pre-paired with the
+// bridge by seeding its long-term public key into the HAP store. This skips
+// SRP pair-setup; every connection still runs pair-verify.
+type controller struct {
+	public  ed25519.PublicKey
+	private ed25519.PrivateKey
+}
+
+func newController(t *testing.T, store hap.Store) *controller {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate controller key: %v", err)
+	}
+
+	pairing, err := json.Marshal(hap.Pairing{
+		Name:       controllerID,
+		PublicKey:  pub,
+		Permission: hap.PermissionAdmin,
+	})
+	if err != nil {
+		t.Fatalf("marshal pairing: %v", err)
+	}
+
+	// Same key layout as hap's storer.
+	key := hex.EncodeToString([]byte(controllerID)) + ".pairing"
+	if err := store.Set(key, pairing); err != nil {
+		t.Fatalf("seed pairing: %v", err)
+	}
+
+	return &controller{public: pub, private: priv}
+}
+
+// hapClient speaks HAP over a single verified, encrypted connection.
+type hapClient struct {
+	t    *testing.T
+	conn net.Conn
+	mu   sync.Mutex
+	r    *bufio.Reader
+	sc   *secureConn
+}
+
+// dial connects to the bridge, retrying until the HAP server is listening.
+func (c *controller) dial(t *testing.T, addr string) *hapClient {
+	t.Helper()
+
+	var conn net.Conn
+	var err error
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		conn, err = net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("dial HAP server %s: %v", addr, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	client := &hapClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+	t.Cleanup(func() { conn.Close() })
+
+	if err := client.pairVerify(c); err != nil {
+		t.Fatalf("pair-verify: %v", err)
+	}
+
+	return client
+}
+
+func (hc *hapClient) pairVerify(c *controller) error {
+	clientPublic, clientPrivate := curve25519.GenerateKeyPair()
+
+	m1, err := tlv8.Marshal(struct {
+		Method    byte   `tlv8:"0"`
+		PublicKey []byte `tlv8:"3"`
+		State     byte   `tlv8:"6"`
+	}{
+		Method:    hap.MethodPair,
+		PublicKey: clientPublic[:],
+		State:     hap.M1,
+	})
+	if err != nil {
+		return err
+	}
+
+	body, err := hc.postTLV8("/pair-verify", m1)
+	if err != nil {
+		return err
+	}
+
+	var m2 struct {
+		PublicKey     []byte `tlv8:"3,optional"`
+		EncryptedData []byte `tlv8:"5,optional"`
+		State         byte   `tlv8:"6,optional"`
+		Error         byte   `tlv8:"7,optional"`
+	}
+	if err := tlv8.Unmarshal(body, &m2); err != nil {
+		return fmt.Errorf("decode M2: %w", err)
+	}
+	if m2.Error != 0 {
+		return fmt.Errorf("M2 error %d", m2.Error)
+	}
+
+	var accessoryPublic [32]byte
+	copy(accessoryPublic[:], m2.PublicKey)
+	shared := curve25519.SharedSecret(clientPrivate, accessoryPublic)
+
+	encKey, err := hkdf.Sha512(shared[:], []byte("Pair-Verify-Encrypt-Salt"), []byte("Pair-Verify-Encrypt-Info"))
+	if err != nil {
+		return err
+	}
+
+	var material []byte
+	material = append(material, clientPublic[:]...)
+	material = append(material, []byte(controllerID)...)
+	material = append(material, accessoryPublic[:]...)
+
+	sub, err := tlv8.Marshal(struct {
+		Identifier string `tlv8:"1"`
+		Signature  []byte `tlv8:"10"`
+	}{
+		Identifier: controllerID,
+		Signature:  ed25519.Sign(c.private, material),
+	})
+	if err != nil {
+		return err
+	}
+
+	encrypted, mac, err := chacha20poly1305.EncryptAndSeal(encKey[:], []byte("PV-Msg03"), sub, nil)
+	if err != nil {
+		return err
+	}
+
+	m3, err := tlv8.Marshal(struct {
+		Method        byte   `tlv8:"0"`
+		EncryptedData []byte `tlv8:"5"`
+		State         byte   `tlv8:"6"`
+	}{
+		Method:        hap.MethodPair,
+		EncryptedData: append(encrypted, mac[:]...),
+		State:         hap.M3,
+	})
+	if err != nil {
+		return err
+	}
+
+	body, err = hc.postTLV8("/pair-verify", m3)
+	if err != nil {
+		return err
+	}
+
+	var m4 struct {
+		State byte `tlv8:"6,optional"`
+		Error byte `tlv8:"7,optional"`
+	}
+	if err := tlv8.Unmarshal(body, &m4); err != nil {
+		return fmt.Errorf("decode M4: %w", err)
+	}
+	if m4.Error != 0 {
+		return fmt.Errorf("M4 error %d", m4.Error)
+	}
+
+	sc, err := newSecureConn(hc.conn, shared)
+	if err != nil {
+		return err
+	}
+	hc.sc = sc
+	hc.r = bufio.NewReader(sc)
+
+	return nil
+}
+
+func (hc *hapClient) postTLV8(path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, "http://bridge"+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/pairing+tlv8")
+
+	resp, err := hc.roundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (hc *hapClient) roundTrip(req *http.Request) ([]byte, error) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	var w io.Writer = hc.conn
+	if hc.sc != nil {
+		w = hc.sc
+	}
+
+	// Buffer the request so it is sent as a single encrypted frame.
+	var buf bytes.Buffer
+	if err := req.Write(&buf); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	if err := hc.conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(hc.r, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		return body, fmt.Errorf("%s %s: status %d: %s", req.Method, req.URL.Path, resp.StatusCode, body)
+	}
+
+	return body, nil
+}
+
+type hapAccessory struct {
+	Aid      uint64 `json:"aid"`
+	Services []struct {
+		Iid             uint64 `json:"iid"`
+		Type            string `json:"type"`
+		Characteristics []struct {
+			Iid   uint64          `json:"iid"`
+			Type  string          `json:"type"`
+			Value json.RawMessage `json:"value"`
+		} `json:"characteristics"`
+	} `json:"services"`
+}
+
+// characteristicID locates the characteristic of the given service and
+// characteristic type on the accessory named name.
+func (hc *hapClient) characteristicID(name, serviceType, charType string) (aid, iid uint64) {
+	hc.t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, "http://bridge/accessories", nil)
+	if err != nil {
+		hc.t.Fatal(err)
+	}
+	body, err := hc.roundTrip(req)
+	if err != nil {
+		hc.t.Fatalf("get accessories: %v", err)
+	}
+
+	var resp struct {
+		Accessories []hapAccessory `json:"accessories"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		hc.t.Fatalf("decode accessories: %v", err)
+	}
+
+	for _, a := range resp.Accessories {
+		if accessoryName(a) != name {
+			continue
+		}
+		for _, s := range a.Services {
+			if s.Type != serviceType {
+				continue
+			}
+			for _, c := range s.Characteristics {
+				if c.Type == charType {
+					return a.Aid, c.Iid
+				}
+			}
+		}
+	}
+
+	hc.t.Fatalf("characteristic %s/%s not found on accessory %q", serviceType, charType, name)
+	return 0, 0
+}
+
+func accessoryName(a hapAccessory) string {
+	for _, s := range a.Services {
+		if s.Type != "3E" { // AccessoryInformation
+			continue
+		}
+		for _, c := range s.Characteristics {
+			if c.Type == "23" { // Name
+				var name string
+				_ = json.Unmarshal(c.Value, &name)
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// value reads a single characteristic value.
+func (hc *hapClient) value(aid, iid uint64) json.RawMessage {
+	hc.t.Helper()
+
+	url := fmt.Sprintf("http://bridge/characteristics?id=%d.%d", aid, iid)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		hc.t.Fatal(err)
+	}
+	body, err := hc.roundTrip(req)
+	if err != nil {
+		hc.t.Fatalf("get characteristic %d.%d: %v", aid, iid, err)
+	}
+
+	var resp struct {
+		Characteristics []struct {
+			Value json.RawMessage `json:"value"`
+		} `json:"characteristics"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		hc.t.Fatalf("decode characteristics: %v", err)
+	}
+	if len(resp.Characteristics) != 1 {
+		hc.t.Fatalf("expected 1 characteristic, got %d", len(resp.Characteristics))
+	}
+
+	return resp.Characteristics[0].Value
+}
+
+// setValue writes a single characteristic value, as the Home app would.
+func (hc *hapClient) setValue(aid, iid uint64, value any) {
+	hc.t.Helper()
+
+	payload, err := json.Marshal(map[string]any{
+		"characteristics": []map[string]any{
+			{"aid": aid, "iid": iid, "value": value},
+		},
+	})
+	if err != nil {
+		hc.t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, "http://bridge/characteristics", bytes.NewReader(payload))
+	if err != nil {
+		hc.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/hap+json")
+
+	if _, err := hc.roundTrip(req); err != nil {
+		hc.t.Fatalf("put characteristic %d.%d: %v", aid, iid, err)
+	}
+}
+
+// eventually polls a characteristic until it matches want.
+func (hc *hapClient) eventually(aid, iid uint64, want string) {
+	hc.t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	var got json.RawMessage
+	for time.Now().Before(deadline) {
+		got = hc.value(aid, iid)
+		if strings.TrimSpace(string(got)) == want {
+			return
+		}
+		time.Sleep(25 * time.Millisecond)
+	}
+	hc.t.Fatalf("characteristic %d.%d = %s, want %s", aid, iid, got, want)
+}
+
+// secureConn implements HAP's encrypted framing on top of a verified
+// connection: [length (2 bytes LE)] [ciphertext] [poly1305 tag (16 bytes)].
+type secureConn struct {
+	net.Conn
+
+	encryptKey   [32]byte
+	decryptKey   [32]byte
+	encryptCount uint64
+	decryptCount uint64
+
+	raw     *bufio.Reader
+	pending bytes.Buffer
+}
+
+const maxFrameLength = 0x400
+
+func newSecureConn(conn net.Conn, shared [32]byte) (*secureConn, error) {
+	salt := []byte("Control-Salt")
+
+	// The controller's write key is the accessory's read key and vice versa.
+	encryptKey, err := hkdf.Sha512(shared[:], salt, []byte("Control-Write-Encryption-Key"))
+	if err != nil {
+		return nil, err
+	}
+	decryptKey, err := hkdf.Sha512(shared[:], salt, []byte("Control-Read-Encryption-Key"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &secureConn{
+		Conn:       conn,
+		encryptKey: encryptKey,
+		decryptKey: decryptKey,
+		raw:        bufio.NewReader(conn),
+	}, nil
+}
+
+func (sc *secureConn) Write(b []byte) (int, error) {
+	var out bytes.Buffer
+	for rest := b; len(rest) > 0; {
+		n := min(len(rest), maxFrameLength)
+		chunk := rest[:n]
+		rest = rest[n:]
+
+		var nonce [8]byte
+		binary.LittleEndian.PutUint64(nonce[:], sc.encryptCount)
+		sc.encryptCount++
+
+		length := make([]byte, 2)
+		binary.LittleEndian.PutUint16(length, uint16(n))
+
+		encrypted, mac, err := chacha20poly1305.EncryptAndSeal(sc.encryptKey[:], nonce[:], chunk, length)
+		if err != nil {
+			return 0, err
+		}
+		out.Write(length)
+		out.Write(encrypted)
+		out.Write(mac[:])
+	}
+
+	if _, err := sc.Conn.Write(out.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (sc *secureConn) Read(b []byte) (int, error) {
+	if sc.pending.Len() == 0 {
+		if err := sc.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	return sc.pending.Read(b)
+}
+
+func (sc *secureConn) readFrame() error {
+	var length uint16
+	if err := binary.Read(sc.raw, binary.LittleEndian, &length); err != nil {
+		return err
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(sc.raw, data); err != nil {
+		return err
+	}
+
+	var mac [16]byte
+	if _, err := io.ReadFull(sc.raw, mac[:]); err != nil {
+		return err
+	}
+
+	var nonce [8]byte
+	binary.LittleEndian.PutUint64(nonce[:], sc.decryptCount)
+	sc.decryptCount++
+
+	lengthBytes := make([]byte, 2)
+	binary.LittleEndian.PutUint16(lengthBytes, length)
+
+	decrypted, err := chacha20poly1305.DecryptAndVerify(sc.decryptKey[:], nonce[:], data, mac, lengthBytes)
+	if err != nil {
+		return fmt.Errorf("decrypt frame: %w", err)
+	}
+
+	sc.pending.Write(decrypted)
+	return nil
+}
@@ -0,0 +1,176 @@
+package z2mhomekit
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/chasefleming/elem-go"
+	"github.com/chasefleming/elem-go/attrs"
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+// inventoryColumns are the columns of the CSV export, one row per device.
+var inventoryColumns = []string{"vendor", "model", "description", "id", "name", "room", "location", "power_source", "battery", "battery_level"}
+
+// SetInventory enables the device inventory.
+func (ws *WebServer) SetInventory(inventory func() devices.Inventory) {
+	ws.inventory = inventory
+}
+
+// HandleInventory serves the device inventory by model with the batteries
+// to stock, as a page or, with format=csv, a spreadsheet.
+func (ws *WebServer) HandleInventory(w http.ResponseWriter, r *http.Request) {
+	inv, ok := ws.readInventory(w, r)
+	if !ok {
+		return
+	}
+
+	content := elem.Div(attrs.Props{attrs.Class: "inventory"},
+		elem.H1(attrs.Props{}, elem.Text("Inventory")),
+		elem.P(attrs.Props{},
+			elem.A(attrs.Props{attrs.Href: "/inventory?format=csv"}, elem.Text("Download CSV")),
+			elem.Text(" · "),
+			elem.A(attrs.Props{attrs.Href: "/"}, elem.Text("Back to dashboard")),
+		),
+		elem.H2(attrs.Props{}, elem.Text("Batteries")),
+		renderBatteryStock(inv),
+		elem.H2(attrs.Props{}, elem.Text("Devices by model")),
+		elem.Div(attrs.Props{}, elem.TransformEach(inv.Models, renderInventoryModel)...),
+	)
+
+	w.Header().Set("Content-Type", "text/html")
+	if _, err := fmt.Fprint(w, ws.renderPage("z2m-homekit · inventory", content)); err != nil {
+		ws.logger.Error("Failed to write response", slog.Any("error", err))
+	}
+}
+
+// HandleInventoryAPI returns the device inventory as JSON or, with
+// format=csv, CSV.
+func (ws *WebServer) HandleInventoryAPI(w http.ResponseWriter, r *http.Request) {
+	inv, ok := ws.readInventory(w, r)
+	if !ok {
+		return
+	}
+	ws.writeJSON(w, inv)
+}
+
+// readInventory checks an inventory request and serves the CSV export
+// when asked for. ok is false when the response has been written.
+func (ws *WebServer) readInventory(w http.ResponseWriter, r *http.Request) (devices.Inventory, bool) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return devices.Inventory{}, false
+	}
+	if ws.inventory == nil {
+		http.Error(w, "Inventory not available", http.StatusNotFound)
+		return devices.Inventory{}, false
+	}
+
+	inv := ws.inventory()
+	switch r.URL.Query().Get("format") {
+	case "":
+		return inv, true
+	case "csv":
+		ws.writeInventoryCSV(w, inv)
+		return devices.Inventory{}, false
+	default:
+		http.Error(w, "format must be csv", http.StatusBadRequest)
+		return devices.Inventory{}, false
+	}
+}
+
+func (ws *WebServer) writeInventoryCSV(w http.ResponseWriter, inv devices.Inventory) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="inventory.csv"`)
+
+	cw := csv.NewWriter(w)
+	_ = cw.Write(inventoryColumns)
+	for _, m := range inv.Models {
+		for _, d := range m.Devices {
+			level := ""
+			if d.BatteryLevel != nil {
+				level = strconv.Itoa(*d.BatteryLevel)
+			}
+			_ = cw.Write([]string{m.Vendor, m.Model, m.Description, d.ID, d.Name, d.Room, d.Location, d.PowerSource, d.Battery, level})
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		ws.logger.Error("Failed to write inventory", slog.Any("error", err))
+	}
+}
+
+func renderBatteryStock(inv devices.Inventory) elem.Node {
+	rows := []elem.Node{
+		elem.Tr(attrs.Props{},
+			elem.Th(attrs.Props{}, elem.Text("Battery")),
+			elem.Th(attrs.Props{}, elem.Text("Devices")),
+			elem.Th(attrs.Props{}, elem.Text("Cells")),
+			elem.Th(attrs.Props{}, elem.Text(fmt.Sprintf("Below %d%%", devices.LowBatteryLevel))),
+		),
+	}
+	for _, s := range inv.Batteries {
+		rows = append(rows, elem.Tr(attrs.Props{},
+			elem.Td(attrs.Props{}, elem.Text(s.Type)),
+			elem.Td(attrs.Props{}, elem.Text(strconv.Itoa(s.Devices))),
+			elem.Td(attrs.Props{}, elem.Text(strconv.Itoa(s.Cells))),
+			elem.Td(attrs.Props{}, elem.Text(strconv.Itoa(s.Low))),
+		))
+	}
+
+	nodes := []elem.Node{elem.Table(attrs.Props{attrs.Class: "inventory-table"}, rows...)}
+	if inv.Unknown > 0 {
+		nodes = append(nodes, elem.P(attrs.Props{attrs.Class: "inventory-unknown"},
+			elem.Text(fmt.Sprintf("%d battery powered devices of unknown battery type; set battery_type in the devices config.", inv.Unknown)),
+		))
+	}
+	return elem.Div(attrs.Props{}, nodes...)
+}
+
+func renderInventoryModel(m devices.InventoryModel) elem.Node {
+	title := "Not reported by zigbee2mqtt"
+	if m.Model != "" {
+		title = m.Vendor + " " + m.Model
+		if m.Description != "" {
+			title += " · " + m.Description
+		}
+	}
+
+	rows := []elem.Node{
+		elem.Tr(attrs.Props{},
+			elem.Th(attrs.Props{}, elem.Text("Device")),
+			elem.Th(attrs.Props{}, elem.Text("Room")),
+			elem.Th(attrs.Props{}, elem.Text("Location")),
+			elem.Th(attrs.Props{}, elem.Text("Battery")),
+			elem.Th(attrs.Props{}, elem.Text("Level")),
+		),
+	}
+	for _, d := range m.Devices {
+		battery := d.Battery
+		if battery == "" {
+			battery = d.PowerSource
+		}
+		level, class := "", ""
+		if d.BatteryLevel != nil {
+			level = fmt.Sprintf("%d%%", *d.BatteryLevel)
+			if *d.BatteryLevel < devices.LowBatteryLevel {
+				class = "battery-low"
+			}
+		}
+		rows = append(rows, elem.Tr(attrs.Props{},
+			elem.Td(attrs.Props{}, elem.Text(d.Name)),
+			elem.Td(attrs.Props{}, elem.Text(d.Room)),
+			elem.Td(attrs.Props{}, elem.Text(d.Location)),
+			elem.Td(attrs.Props{}, elem.Text(battery)),
+			elem.Td(attrs.Props{attrs.Class: class}, elem.Text(level)),
+		))
+	}
+
+	return elem.Div(attrs.Props{attrs.Class: "inventory-model"},
+		elem.H3(attrs.Props{}, elem.Text(fmt.Sprintf("%s (%d)", title, len(m.Devices)))),
+		elem.Table(attrs.Props{attrs.Class: "inventory-table"}, rows...),
+	)
+}
@@ -0,0 +1,62 @@
+package z2mhomekit
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+func TestHandleInventory(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+
+	get := func(handler http.HandlerFunc, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	if rec := get(ws.HandleInventory, "/inventory"); rec.Code != http.StatusNotFound {
+		t.Errorf("status without an inventory = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	ws.SetInventory(func() devices.Inventory {
+		return devices.Inventory{
+			Models: []devices.InventoryModel{{
+				Model: "WSDCGQ11LM", Vendor: "Aqara",
+				Devices: []devices.InventoryDevice{{ID: "hall", Name: "Hall", Battery: "CR2032", BatteryLevel: devices.Ptr(12)}},
+			}},
+			Batteries: []devices.BatteryStock{{Type: "CR2032", Devices: 1, Cells: 1, Low: 1}},
+		}
+	})
+
+	rec := get(ws.HandleInventory, "/inventory")
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, "Aqara WSDCGQ11LM (1)") || !strings.Contains(body, `class="battery-low"`) {
+		t.Errorf("page = %d\n%s", rec.Code, body)
+	}
+
+	rec = get(ws.HandleInventoryAPI, "/api/v1/inventory")
+	var inv devices.Inventory
+	if err := json.NewDecoder(rec.Body).Decode(&inv); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(inv.Batteries) != 1 || inv.Batteries[0].Low != 1 {
+		t.Errorf("inventory = %+v", inv)
+	}
+
+	rec = get(ws.HandleInventoryAPI, "/api/v1/inventory?format=csv")
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	if len(records) != 2 || records[1][1] != "WSDCGQ11LM" || records[1][8] != "CR2032" || records[1][9] != "12" {
+		t.Errorf("csv = %q", records)
+	}
+
+	if rec := get(ws.HandleInventoryAPI, "/api/v1/inventory?format=xml"); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid format status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,143 @@
+package z2mhomekit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// eventJournalMaxBytes is the size at which the event journal is rotated.
+// One rotated file is kept, so the journal uses at most twice this.
+const eventJournalMaxBytes = 8 << 20
+
+// journalRecord is a device message as received from zigbee2mqtt.
+type journalRecord struct {
+	At       time.Time       `json:"at"`
+	DeviceID string          `json:"device_id"`
+	Topic    string          `json:"topic"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// EventJournal persists the device messages received from zigbee2mqtt as
+// JSON lines, so a bad sequence of state transitions can be replayed
+// later. Writes are not synced; losing the last few messages in a crash is
+// acceptable for a debugging aid.
+type EventJournal struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	size int64
+}
+
+// OpenEventJournal opens or creates the journal at path.
+func OpenEventJournal(path string) (*EventJournal, error) {
+	j := &EventJournal{path: path}
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *EventJournal) open() error {
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open event journal: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to open event journal: %w", err)
+	}
+	j.f, j.size = f, info.Size()
+	return nil
+}
+
+// Record appends a device message, rotating the journal when it is full.
+func (j *EventJournal) Record(rec journalRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal record: %w", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f == nil {
+		return os.ErrClosed
+	}
+	if j.size+int64(len(data))+1 > eventJournalMaxBytes {
+		if err := j.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := j.f.Write(append(data, '\n'))
+	j.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write event journal: %w", err)
+	}
+	return nil
+}
+
+// rotate moves the journal to path.1. Callers must hold j.mu.
+func (j *EventJournal) rotate() error {
+	_ = j.f.Close()
+	if err := os.Rename(j.path, j.path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate event journal: %w", err)
+	}
+	return j.open()
+}
+
+// Read returns the journalled messages for deviceID received at or after
+// since, oldest first. Lines that fail to parse, such as a torn final
+// line after a crash, are skipped.
+func (j *EventJournal) Read(deviceID string, since time.Time) ([]journalRecord, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var recs []journalRecord
+	for _, path := range []string{j.path + ".1", j.path} {
+		f, err := os.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read event journal: %w", err)
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var rec journalRecord
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				continue
+			}
+			if rec.DeviceID == deviceID && !rec.At.Before(since) {
+				recs = append(recs, rec)
+			}
+		}
+		err = scanner.Err()
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read event journal: %w", err)
+		}
+	}
+	return recs, nil
+}
+
+// Close closes the journal.
+func (j *EventJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f == nil {
+		return nil
+	}
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
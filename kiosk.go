@@ -0,0 +1,176 @@
+package z2mhomekit
+
+import (
+	_ "embed"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/chasefleming/elem-go"
+	"github.com/chasefleming/elem-go/attrs"
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+//go:embed assets/kiosk.css
+var kioskCSS string
+
+//go:embed assets/kiosk.js
+var kioskJS string
+
+// Kiosk widgets, chosen with ?widgets=clock,climate,lights.
+const (
+	kioskWidgetClock   = "clock"
+	kioskWidgetClimate = "climate"
+	kioskWidgetLights  = "lights"
+)
+
+var defaultKioskWidgets = []string{kioskWidgetClock, kioskWidgetClimate}
+
+// kioskWidgets parses the widgets query parameter, keeping known widgets
+// in the given order.
+func kioskWidgets(param string) []string {
+	if param == "" {
+		return defaultKioskWidgets
+	}
+
+	var widgets []string
+	for w := range strings.SplitSeq(param, ",") {
+		w = strings.TrimSpace(w)
+		switch w {
+		case kioskWidgetClock, kioskWidgetClimate, kioskWidgetLights:
+			if !slices.Contains(widgets, w) {
+				widgets = append(widgets, w)
+			}
+		}
+	}
+	return widgets
+}
+
+func isControllable(t devices.DeviceType) bool {
+	switch t {
+	case devices.DeviceTypeLightbulb, devices.DeviceTypeOutlet, devices.DeviceTypeSwitch, devices.DeviceTypeFan:
+		return true
+	}
+	return false
+}
+
+// HandleKiosk renders a full-screen panel for a wall-mounted tablet: large
+// toggle tiles for the room's devices and a row of widgets, updated over
+// SSE. ?room= limits it to one room, ?widgets= picks the widgets.
+func (ws *WebServer) HandleKiosk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	room := r.URL.Query().Get("room")
+	snapshot := ws.deviceProvider.Snapshot()
+
+	var tiles, climate []elem.Node
+	for _, id := range sortedDeviceIDs(snapshot, sortByName, "") {
+		item := snapshot[id]
+		if !onDashboard(item.Device) {
+			continue
+		}
+		if room != "" && !strings.EqualFold(item.Device.Room, room) {
+			continue
+		}
+
+		switch {
+		case isControllable(item.Device.Type):
+			tiles = append(tiles, renderKioskTile(id, item.Device, item.State))
+		case item.Device.Type == devices.DeviceTypeClimateSensor:
+			climate = append(climate, renderKioskClimate(id, item.Device, item.State))
+		}
+	}
+
+	var widgets []elem.Node
+	for _, name := range kioskWidgets(r.URL.Query().Get("widgets")) {
+		switch name {
+		case kioskWidgetClock:
+			widgets = append(widgets, elem.Div(attrs.Props{attrs.Class: "kiosk-widget kiosk-clock", "data-role": "clock"}))
+		case kioskWidgetClimate:
+			if len(climate) > 0 {
+				widgets = append(widgets, elem.Div(attrs.Props{attrs.Class: "kiosk-widget kiosk-climate"},
+					append([]elem.Node{
+						elem.Div(attrs.Props{attrs.Class: "kiosk-average", "data-role": "climate-average"}),
+					}, climate...)...,
+				))
+			}
+		case kioskWidgetLights:
+			widgets = append(widgets, elem.Div(attrs.Props{attrs.Class: "kiosk-widget", "data-role": "lights-on"}))
+		}
+	}
+
+	title := "Home"
+	if room != "" {
+		title = room
+	}
+	if len(tiles) == 0 && len(climate) == 0 {
+		tiles = append(tiles, elem.Div(attrs.Props{attrs.Class: "kiosk-empty"}, elem.Text("No devices in "+title)))
+	}
+
+	page := elem.Html(attrs.Props{},
+		elem.Head(attrs.Props{},
+			elem.Meta(attrs.Props{attrs.Charset: "utf-8"}),
+			elem.Meta(attrs.Props{attrs.Name: "viewport", attrs.Content: "width=device-width, initial-scale=1, user-scalable=no"}),
+			elem.Meta(attrs.Props{attrs.Name: "apple-mobile-web-app-capable", attrs.Content: "yes"}),
+			elem.Title(attrs.Props{}, elem.Text(title)),
+			elem.Style(attrs.Props{}, elem.Text(kioskCSS)),
+		),
+		elem.Body(attrs.Props{attrs.Class: "kiosk"},
+			elem.Div(attrs.Props{attrs.ID: "kiosk"},
+				elem.Div(attrs.Props{attrs.Class: "kiosk-widgets"}, widgets...),
+				elem.Div(attrs.Props{attrs.Class: "kiosk-tiles"}, tiles...),
+			),
+			elem.Script(attrs.Props{}, elem.Raw(kioskJS)),
+		),
+	)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := fmt.Fprint(w, page.Render()); err != nil {
+		ws.logger.Error("Failed to write kiosk response", slog.Any("error", err))
+	}
+}
+
+func renderKioskTile(id string, device devices.Device, state devices.State) elem.Node {
+	on := state.On != nil && *state.On
+	class := "kiosk-tile"
+	if on {
+		class += " on"
+	}
+
+	return elem.Button(attrs.Props{
+		attrs.Class:      class,
+		attrs.Type:       "button",
+		"data-device-id": id,
+		"data-light":     fmt.Sprint(device.Type == devices.DeviceTypeLightbulb),
+	},
+		elem.Div(attrs.Props{attrs.Class: "kiosk-tile-name"}, elem.Text(device.Name)),
+		elem.Div(attrs.Props{attrs.Class: "kiosk-tile-state", "data-role": "tile-state"}, elem.Text(onOffText(on))),
+	)
+}
+
+func onOffText(on bool) string {
+	if on {
+		return "On"
+	}
+	return "Off"
+}
+
+func renderKioskClimate(id string, device devices.Device, state devices.State) elem.Node {
+	props := attrs.Props{attrs.Class: "kiosk-sensor", "data-climate-id": id}
+	if state.Temperature != nil {
+		props["data-temperature"] = fmt.Sprintf("%.1f", *state.Temperature)
+	}
+	if state.Humidity != nil {
+		props["data-humidity"] = fmt.Sprintf("%.0f", *state.Humidity)
+	}
+
+	return elem.Div(props,
+		elem.Span(attrs.Props{}, elem.Text(device.Name)),
+		elem.Span(attrs.Props{"data-role": "sensor-value"}),
+	)
+}
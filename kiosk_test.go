@@ -0,0 +1,58 @@
+package z2mhomekit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+func TestKioskWidgets(t *testing.T) {
+	tests := []struct {
+		param string
+		want  []string
+	}{
+		{"", defaultKioskWidgets},
+		{"lights,clock", []string{"lights", "clock"}},
+		{"clock, bogus,clock", []string{"clock"}},
+		{"bogus", nil},
+	}
+	for _, tt := range tests {
+		if got := kioskWidgets(tt.param); !slices.Equal(got, tt.want) {
+			t.Errorf("kioskWidgets(%q) = %v, want %v", tt.param, got, tt.want)
+		}
+	}
+}
+
+func TestHandleKiosk(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	temp := 21.5
+	ws.deviceProvider = fakeDeviceProvider{
+		"lounge-lamp": {Device: devices.Device{ID: "lounge-lamp", Name: "Lounge Lamp", Type: devices.DeviceTypeLightbulb, Room: "Lounge"}, State: devices.State{On: devices.Ptr(true)}},
+		"lounge-temp": {Device: devices.Device{ID: "lounge-temp", Name: "Lounge Temp", Type: devices.DeviceTypeClimateSensor, Room: "Lounge"}, State: devices.State{Temperature: &temp}},
+		"porch":       {Device: devices.Device{ID: "porch", Name: "Porch Light", Type: devices.DeviceTypeLightbulb, Room: "Outside"}},
+	}
+
+	rec := httptest.NewRecorder()
+	ws.HandleKiosk(rec, httptest.NewRequest(http.MethodGet, "/kiosk?room=lounge&widgets=climate,lights", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("kiosk = %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+	if !strings.Contains(body, "Lounge Lamp") || strings.Contains(body, "Porch Light") {
+		t.Error("kiosk must show the requested room only")
+	}
+	if !strings.Contains(body, `data-temperature="21.5"`) {
+		t.Error("climate widget missing the room's temperature")
+	}
+	if !strings.Contains(body, `<div class="kiosk-widget" data-role="lights-on">`) || strings.Contains(body, "kiosk-widget kiosk-clock") {
+		t.Error("kiosk did not honour the widgets parameter")
+	}
+	if strings.Contains(body, "footer") {
+		t.Error("kiosk must render without page chrome")
+	}
+}
@@ -0,0 +1,155 @@
+package z2mhomekit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+// Shutdown reasons recorded for the previous run.
+const (
+	ShutdownSignal = "signal"
+	ShutdownPanic  = "panic"
+	ShutdownError  = "error"
+	// ShutdownUnclean means the process went away without recording a
+	// reason: it was killed, crashed outside the main goroutine or the
+	// machine lost power.
+	ShutdownUnclean = "unclean"
+)
+
+// Shutdown describes how a run of the bridge ended.
+type Shutdown struct {
+	Reason string    `json:"reason"`
+	Detail string    `json:"detail,omitempty"`
+	At     time.Time `json:"at,omitzero"`
+}
+
+// lifecycleFile is persisted between runs. Running stays true while the
+// process is up, so finding it set on startup means the last run ended
+// without recording a shutdown.
+type lifecycleFile struct {
+	Running   bool      `json:"running"`
+	StartedAt time.Time `json:"started_at"`
+	Last      *Shutdown `json:"last_shutdown,omitempty"`
+}
+
+// Lifecycle tracks the previous shutdown and how often components have
+// restarted within this process, e.g. on configuration reload.
+type Lifecycle struct {
+	mu        sync.Mutex
+	path      string
+	previous  *Shutdown
+	connected map[string]int
+}
+
+// lifecycle is process wide so counts survive in-process bridge restarts.
+var lifecycle = &Lifecycle{connected: make(map[string]int)}
+
+// Start loads the previous run's shutdown from path and marks this run
+// as running.
+func (l *Lifecycle) Start(path string, now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.path = path
+	l.previous = nil
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("failed to read lifecycle file: %w", err)
+	default:
+		var prev lifecycleFile
+		if err := json.Unmarshal(data, &prev); err != nil {
+			return fmt.Errorf("failed to parse lifecycle file %s: %w", path, err)
+		}
+		if prev.Running {
+			l.previous = &Shutdown{Reason: ShutdownUnclean, Detail: fmt.Sprintf("run started %s did not shut down", prev.StartedAt.Format(time.RFC3339))}
+		} else {
+			l.previous = prev.Last
+		}
+	}
+
+	return l.write(lifecycleFile{Running: true, StartedAt: now, Last: l.previous})
+}
+
+// Stop records why the process is exiting.
+func (l *Lifecycle) Stop(reason, detail string, now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.path == "" {
+		return nil
+	}
+	return l.write(lifecycleFile{Last: &Shutdown{Reason: reason, Detail: detail, At: now}})
+}
+
+func (l *Lifecycle) write(f lifecycleFile) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write lifecycle file: %w", err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return fmt.Errorf("failed to write lifecycle file %s: %w", filepath.Base(l.path), err)
+	}
+	return nil
+}
+
+// PreviousShutdown returns how the last run ended, or nil on first start.
+func (l *Lifecycle) PreviousShutdown() *Shutdown {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.previous
+}
+
+// RestartCause describes why this run started.
+func (l *Lifecycle) RestartCause() string {
+	prev := l.PreviousShutdown()
+	if prev == nil {
+		return "first start"
+	}
+	switch prev.Reason {
+	case ShutdownSignal:
+		return "restart after " + prev.Detail
+	case ShutdownPanic, ShutdownError, ShutdownUnclean:
+		// Nothing restarts the bridge after a failure but its
+		// supervisor (systemd, Docker, Kubernetes).
+		return "supervisor restart after " + prev.Reason
+	}
+	return "restart after " + prev.Reason
+}
+
+// ObserveStatus counts component connections so restarts can be reported.
+func (l *Lifecycle) ObserveStatus(evt events.ConnectionStatusEvent) {
+	if evt.Status != events.ConnectionStatusConnected {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.connected[evt.Component]++
+}
+
+// ComponentRestarts returns how often each component has come up again
+// after its first start in this process.
+func (l *Lifecycle) ComponentRestarts() map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	restarts := make(map[string]int, len(l.connected))
+	for component, n := range l.connected {
+		restarts[component] = n - 1
+	}
+	return restarts
+}
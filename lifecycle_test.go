@@ -0,0 +1,63 @@
+package z2mhomekit
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+func TestLifecycleRestartCause(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lifecycle.json")
+	now := time.Now()
+
+	l := &Lifecycle{connected: make(map[string]int)}
+	if err := l.Start(path, now); err != nil {
+		t.Fatal(err)
+	}
+	if got := l.RestartCause(); got != "first start" {
+		t.Errorf("RestartCause = %q on first start", got)
+	}
+
+	// The process disappears without recording a shutdown.
+	l = &Lifecycle{connected: make(map[string]int)}
+	if err := l.Start(path, now); err != nil {
+		t.Fatal(err)
+	}
+	if prev := l.PreviousShutdown(); prev == nil || prev.Reason != ShutdownUnclean {
+		t.Errorf("PreviousShutdown = %+v, want unclean", prev)
+	}
+	if got := l.RestartCause(); got != "supervisor restart after unclean" {
+		t.Errorf("RestartCause = %q", got)
+	}
+
+	if err := l.Stop(ShutdownSignal, "SIGTERM", now); err != nil {
+		t.Fatal(err)
+	}
+	l = &Lifecycle{connected: make(map[string]int)}
+	if err := l.Start(path, now); err != nil {
+		t.Fatal(err)
+	}
+	if got := l.RestartCause(); got != "restart after SIGTERM" {
+		t.Errorf("RestartCause = %q", got)
+	}
+}
+
+func TestLifecycleComponentRestarts(t *testing.T) {
+	l := &Lifecycle{connected: make(map[string]int)}
+	for _, status := range []events.ConnectionStatus{
+		events.ConnectionStatusConnecting,
+		events.ConnectionStatusConnected,
+		events.ConnectionStatusDisconnected,
+		events.ConnectionStatusConnected,
+	} {
+		l.ObserveStatus(events.ConnectionStatusEvent{Component: "hap", Status: status})
+	}
+	l.ObserveStatus(events.ConnectionStatusEvent{Component: "web", Status: events.ConnectionStatusConnected})
+
+	restarts := l.ComponentRestarts()
+	if restarts["hap"] != 1 || restarts["web"] != 0 {
+		t.Errorf("ComponentRestarts = %v, want hap 1 and web 0", restarts)
+	}
+}
@@ -0,0 +1,408 @@
+package z2mhomekit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+// loadTestOptions configures a load test run.
+type loadTestOptions struct {
+	mqttAddr string
+	webURL   string
+	devices  int
+	rate     float64
+	duration time.Duration
+	prefix   string
+	budget   time.Duration
+}
+
+// LoadTest is the entry point for `z2m-homekit loadtest`. It simulates
+// climate sensors reporting through the MQTT broker of a running instance
+// and reports MQTT→SSE and MQTT→HAP latency. It returns the process exit
+// code; a p95 SSE latency above -budget is a failure.
+func LoadTest(args []string) int {
+	fs := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	opts := loadTestOptions{}
+	fs.StringVar(&opts.mqttAddr, "mqtt", "127.0.0.1:1883", "MQTT broker address of the instance under test")
+	fs.StringVar(&opts.webURL, "web", "http://127.0.0.1:8081", "web UI base URL of the instance under test")
+	fs.IntVar(&opts.devices, "devices", 50, "number of simulated devices")
+	fs.Float64Var(&opts.rate, "rate", 1, "messages per second per device")
+	fs.DurationVar(&opts.duration, "duration", 30*time.Second, "how long to publish")
+	fs.StringVar(&opts.prefix, "prefix", "loadtest", "topic and ID prefix of the simulated devices")
+	fs.DurationVar(&opts.budget, "budget", 250*time.Millisecond, "p95 MQTT→SSE latency budget (0 disables)")
+	printConfig := fs.Bool("print-config", false, "print a devices.hujson for the simulated devices and exit")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: z2m-homekit loadtest [flags]\n\n")
+		fmt.Fprintf(fs.Output(), "The instance under test must be configured with the simulated devices;\n")
+		fmt.Fprintf(fs.Output(), "generate them with -print-config.\n\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if opts.devices < 1 || opts.rate <= 0 {
+		fmt.Fprintln(os.Stderr, "loadtest: -devices and -rate must be positive")
+		return 2
+	}
+
+	if *printConfig {
+		fmt.Print(loadTestDevicesConfig(opts.prefix, opts.devices))
+		return 0
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	report, err := runLoadTest(ctx, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "loadtest: %v\n", err)
+		return 1
+	}
+
+	report.print(os.Stdout)
+
+	if opts.budget > 0 && report.sse.percentile(95) > opts.budget {
+		fmt.Fprintf(os.Stdout, "\nFAIL: p95 MQTT→SSE latency %s exceeds budget %s\n",
+			report.sse.percentile(95).Round(time.Microsecond), opts.budget)
+		return 1
+	}
+
+	return 0
+}
+
+func loadTestDeviceID(prefix string, i int) string {
+	return fmt.Sprintf("%s-%04d", prefix, i)
+}
+
+func loadTestDevicesConfig(prefix string, n int) string {
+	var b strings.Builder
+	b.WriteString("{\n  // Simulated devices for z2m-homekit loadtest\n  \"devices\": [\n")
+	for i := range n {
+		id := loadTestDeviceID(prefix, i)
+		fmt.Fprintf(&b, "    {\"id\": %q, \"name\": %q, \"topic\": %q, \"type\": \"climate_sensor\", \"features\": {\"temperature\": true}},\n",
+			id, "Load "+id, id)
+	}
+	b.WriteString("  ],\n}\n")
+	return b.String()
+}
+
+type latencySamples []time.Duration
+
+func (s latencySamples) percentile(p float64) time.Duration {
+	if len(s) == 0 {
+		return 0
+	}
+	sorted := append(latencySamples(nil), s...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(float64(len(sorted)-1) * p / 100)
+	return sorted[idx]
+}
+
+type loadTestReport struct {
+	published int
+	elapsed   time.Duration
+	sse       latencySamples
+	hapBefore StatsInfo
+	hapAfter  StatsInfo
+	hapErr    error
+}
+
+func (r loadTestReport) print(w io.Writer) {
+	fmt.Fprintf(w, "Published %d messages in %s (%.1f msg/s)\n",
+		r.published, r.elapsed.Round(time.Millisecond), float64(r.published)/r.elapsed.Seconds())
+
+	missed := r.published - len(r.sse)
+	fmt.Fprintf(w, "\nMQTT→SSE: %d received, %d missed\n", len(r.sse), missed)
+	if len(r.sse) > 0 {
+		fmt.Fprintf(w, "  p50 %s  p95 %s  p99 %s  max %s\n",
+			r.sse.percentile(50).Round(time.Microsecond),
+			r.sse.percentile(95).Round(time.Microsecond),
+			r.sse.percentile(99).Round(time.Microsecond),
+			r.sse.percentile(100).Round(time.Microsecond))
+	}
+
+	fmt.Fprintf(w, "\nMQTT→HAP:\n")
+	if r.hapErr != nil {
+		fmt.Fprintf(w, "  unavailable: %v\n", r.hapErr)
+		return
+	}
+	count := r.hapAfter.UpdateLatencyCount - r.hapBefore.UpdateLatencyCount
+	if count == 0 {
+		fmt.Fprintf(w, "  no updates observed\n")
+		return
+	}
+	totalMs := r.hapAfter.UpdateLatencyAvgMs*float64(r.hapAfter.UpdateLatencyCount) -
+		r.hapBefore.UpdateLatencyAvgMs*float64(r.hapBefore.UpdateLatencyCount)
+	fmt.Fprintf(w, "  %d updates  avg %.3fms  max %.3fms (since start)\n",
+		count, totalMs/float64(count), r.hapAfter.UpdateLatencyMaxMs)
+}
+
+type sentKey struct {
+	deviceID    string
+	temperature float64
+}
+
+func runLoadTest(ctx context.Context, opts loadTestOptions) (loadTestReport, error) {
+	var report loadTestReport
+
+	hapBefore, hapErr := fetchHAPStats(ctx, opts.webURL)
+
+	var mu sync.Mutex
+	sent := make(map[sentKey]time.Time)
+
+	sseCtx, stopSSE := context.WithCancel(ctx)
+	defer stopSSE()
+	sseReady := make(chan error, 1)
+	sseDone := make(chan struct{})
+	go func() {
+		defer close(sseDone)
+		err := streamSSE(sseCtx, opts.webURL, sseReady, func(evt events.StateUpdateEvent) {
+			if evt.Temperature == nil || !strings.HasPrefix(evt.DeviceID, opts.prefix+"-") {
+				return
+			}
+			now := time.Now()
+			key := sentKey{evt.DeviceID, *evt.Temperature}
+			mu.Lock()
+			defer mu.Unlock()
+			if at, ok := sent[key]; ok {
+				report.sse = append(report.sse, now.Sub(at))
+				delete(sent, key)
+			}
+		})
+		if err != nil && sseCtx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "loadtest: SSE stream ended: %v\n", err)
+		}
+	}()
+
+	if err := <-sseReady; err != nil {
+		return report, fmt.Errorf("connect to SSE: %w", err)
+	}
+
+	pub, err := dialMQTTPublisher(opts.mqttAddr, opts.prefix+"-publisher")
+	if err != nil {
+		return report, err
+	}
+	defer pub.Close()
+
+	interval := time.Duration(float64(time.Second) / (opts.rate * float64(opts.devices)))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	deadline := start.Add(opts.duration)
+	seq := 0
+
+publish:
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			break publish
+		case <-ticker.C:
+		}
+
+		id := loadTestDeviceID(opts.prefix, seq%opts.devices)
+		// Every message carries a distinct temperature so the SSE event it
+		// produces can be matched back to it.
+		temperature := float64(seq/opts.devices%10000) / 100
+		payload, err := json.Marshal(map[string]any{
+			"temperature": temperature,
+			"linkquality": 200,
+		})
+		if err != nil {
+			return report, err
+		}
+
+		mu.Lock()
+		sent[sentKey{id, temperature}] = time.Now()
+		mu.Unlock()
+
+		if err := pub.Publish("zigbee2mqtt/"+id, payload); err != nil {
+			return report, fmt.Errorf("publish: %w", err)
+		}
+		seq++
+	}
+	report.published = seq
+	report.elapsed = time.Since(start)
+
+	// Give in-flight events a moment to arrive.
+	select {
+	case <-time.After(2 * time.Second):
+	case <-ctx.Done():
+	}
+	stopSSE()
+	<-sseDone
+
+	report.hapBefore = hapBefore
+	report.hapAfter, err = fetchHAPStats(ctx, opts.webURL)
+	if hapErr != nil {
+		report.hapErr = hapErr
+	} else {
+		report.hapErr = err
+	}
+
+	return report, nil
+}
+
+// streamSSE reads state events from /events until ctx is cancelled. ready
+// receives the connection result once.
+func streamSSE(ctx context.Context, baseURL string, ready chan<- error, fn func(events.StateUpdateEvent)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/events", nil)
+	if err != nil {
+		ready <- err
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ready <- err
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("unexpected status %s", resp.Status)
+		ready <- err
+		return err
+	}
+	ready <- nil
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var evt events.StateUpdateEvent
+		if err := json.Unmarshal([]byte(data), &evt); err != nil {
+			continue
+		}
+		fn(evt)
+	}
+
+	return scanner.Err()
+}
+
+func fetchHAPStats(ctx context.Context, baseURL string) (StatsInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/debug/hap", nil)
+	if err != nil {
+		return StatsInfo{}, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return StatsInfo{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return StatsInfo{}, fmt.Errorf("/debug/hap: unexpected status %s", resp.Status)
+	}
+
+	var info HAPDebugInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return StatsInfo{}, fmt.Errorf("/debug/hap: %w", err)
+	}
+
+	return info.Stats, nil
+}
+
+// mqttPublisher is a minimal MQTT 3.1.1 QoS 0 publisher, enough to drive
+// the embedded broker without pulling in a client library.
+type mqttPublisher struct {
+	conn net.Conn
+	buf  bytes.Buffer
+}
+
+func dialMQTTPublisher(addr, clientID string) (*mqttPublisher, error) {
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("connect to MQTT broker: %w", err)
+	}
+
+	p := &mqttPublisher{conn: conn}
+
+	connect := packets.Packet{
+		FixedHeader:     packets.FixedHeader{Type: packets.Connect},
+		ProtocolVersion: 4,
+		Connect: packets.ConnectParams{
+			ProtocolName:     []byte("MQTT"),
+			Clean:            true,
+			Keepalive:        0,
+			ClientIdentifier: clientID,
+		},
+	}
+	if err := connect.ConnectEncode(&p.buf); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := p.flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// CONNACK: fixed header, flags, return code.
+	ack := make([]byte, 4)
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := io.ReadFull(conn, ack); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("read CONNACK: %w", err)
+	}
+	if ack[0]>>4 != packets.Connack || ack[3] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("MQTT connect refused (code %d)", ack[3])
+	}
+
+	return p, nil
+}
+
+// Publish sends a QoS 0 message.
+func (p *mqttPublisher) Publish(topic string, payload []byte) error {
+	pk := packets.Packet{
+		FixedHeader: packets.FixedHeader{Type: packets.Publish},
+		TopicName:   topic,
+		Payload:     payload,
+	}
+	if err := pk.PublishEncode(&p.buf); err != nil {
+		return err
+	}
+	return p.flush()
+}
+
+func (p *mqttPublisher) flush() error {
+	defer p.buf.Reset()
+	_, err := p.conn.Write(p.buf.Bytes())
+	return err
+}
+
+// Close disconnects from the broker.
+func (p *mqttPublisher) Close() error {
+	pk := packets.Packet{FixedHeader: packets.FixedHeader{Type: packets.Disconnect}}
+	if err := pk.DisconnectEncode(&p.buf); err == nil {
+		_ = p.flush()
+	}
+	return p.conn.Close()
+}
@@ -0,0 +1,45 @@
+package z2mhomekit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+func TestLoadTestDevicesConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.hujson")
+	if err := os.WriteFile(path, []byte(loadTestDevicesConfig("lt", 3)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := devices.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("generated config does not load: %v", err)
+	}
+	if len(cfg.Devices) != 3 {
+		t.Fatalf("got %d devices, want 3", len(cfg.Devices))
+	}
+	if got := cfg.Devices[2].Topic; got != "lt-0002" {
+		t.Errorf("topic = %q, want %q", got, "lt-0002")
+	}
+}
+
+func TestLatencyPercentile(t *testing.T) {
+	var s latencySamples
+	for i := 100; i >= 1; i-- {
+		s = append(s, time.Duration(i)*time.Millisecond)
+	}
+
+	if got := s.percentile(50); got != 50*time.Millisecond {
+		t.Errorf("p50 = %s, want 50ms", got)
+	}
+	if got := s.percentile(100); got != 100*time.Millisecond {
+		t.Errorf("p100 = %s, want 100ms", got)
+	}
+	if got := (latencySamples{}).percentile(95); got != 0 {
+		t.Errorf("empty p95 = %s, want 0", got)
+	}
+}
@@ -0,0 +1,188 @@
+package metrics
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/kradalby/z2m-homekit/events"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Options controls the cardinality of the per-device metrics. The zero
+// value exports every metric labelled with the device ID and name.
+type Options struct {
+	// DropName leaves the name label off per-device metrics, so renaming
+	// a device does not start new series.
+	DropName bool
+
+	// HashIDs replaces device IDs in labels with a short stable hash.
+	HashIDs bool
+
+	// Exclude lists per-device metrics not to export, each as "device",
+	// "device:metric" or "*:metric", e.g. "office-motion" or
+	// "*:illuminance". Metrics are the device_state metric label values,
+	// plus pressure_trend and last_seen.
+	Exclude []string
+}
+
+// ParseExclude splits a comma separated exclude list and checks each
+// entry.
+func ParseExclude(s string) ([]string, error) {
+	var exclude []string
+	for entry := range strings.SplitSeq(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		device, metric, hasMetric := strings.Cut(entry, ":")
+		if device == "" || (hasMetric && metric == "") || (device == "*" && !hasMetric) {
+			return nil, fmt.Errorf("invalid metrics exclude %q, want device, device:metric or *:metric", entry)
+		}
+		exclude = append(exclude, entry)
+	}
+	return exclude, nil
+}
+
+// deviceLabelNames returns the label names of a per-device metric with the
+// extra labels after the device labels.
+func (o Options) deviceLabelNames(extra ...string) []string {
+	names := []string{"device_id"}
+	if !o.DropName {
+		names = append(names, "name")
+	}
+	return append(names, extra...)
+}
+
+// deviceLabel returns the device_id label value for deviceID.
+func (c *Collector) deviceLabel(deviceID string) string {
+	if !c.opts.HashIDs {
+		return deviceID
+	}
+	h := fnv.New64a()
+	h.Write([]byte(deviceID))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// deviceLabels returns the label values of a per-device metric.
+func (c *Collector) deviceLabels(deviceID, name string, extra ...string) []string {
+	values := []string{c.deviceLabel(deviceID)}
+	if !c.opts.DropName {
+		values = append(values, name)
+	}
+	return append(values, extra...)
+}
+
+// exported reports whether metric is exported for deviceID. An empty
+// metric asks whether anything is exported for the device.
+func (c *Collector) exported(deviceID, metric string) bool {
+	for _, entry := range c.opts.Exclude {
+		device, excluded, hasMetric := strings.Cut(entry, ":")
+		if device != "*" && device != deviceID {
+			continue
+		}
+		if !hasMetric || excluded == metric {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Collector) setState(deviceID, name, metric string, value float64) {
+	if !c.exported(deviceID, metric) {
+		return
+	}
+	c.gauge(c.deviceState, deviceID, name, c.deviceLabels(deviceID, name, metric)).Set(value)
+}
+
+// labelDeleter is a metric vector series can be deleted from.
+type labelDeleter interface {
+	DeleteLabelValues(lvs ...string) bool
+}
+
+// seriesKey identifies a series written for a device.
+type seriesKey struct {
+	vec    labelDeleter
+	values string // label values joined by seriesSep
+}
+
+const seriesSep = "\xff"
+
+// gauge returns the series of vec with labels, tracking it for deviceID.
+func (c *Collector) gauge(vec *prometheus.GaugeVec, deviceID, name string, labels []string) prometheus.Gauge {
+	c.track(vec, deviceID, name, labels)
+	return vec.WithLabelValues(labels...)
+}
+
+// track records that the series of vec with labels belongs to deviceID
+// under name, so it can be deleted when the device is renamed or removed.
+// name is empty for series without a name label.
+func (c *Collector) track(vec labelDeleter, deviceID, name string, labels []string) {
+	if c.opts.DropName {
+		name = ""
+	}
+	key := seriesKey{vec: vec, values: strings.Join(labels, seriesSep)}
+
+	c.seriesMu.Lock()
+	defer c.seriesMu.Unlock()
+	series, ok := c.series[deviceID]
+	if !ok {
+		series = make(map[seriesKey]string)
+		c.series[deviceID] = series
+	}
+	series[key] = name
+}
+
+// observeName deletes the series written under a device's previous name
+// when it is renamed, so they do not linger until restart.
+func (c *Collector) observeName(deviceID, name string) {
+	if c.opts.DropName {
+		return
+	}
+
+	c.seriesMu.Lock()
+	defer c.seriesMu.Unlock()
+	if previous, ok := c.names[deviceID]; ok && previous == name {
+		return
+	}
+	c.names[deviceID] = name
+	c.deleteSeries(deviceID, func(seriesName string) bool {
+		return seriesName != "" && seriesName != name
+	})
+}
+
+// ForgetDevice deletes every series of a device, for devices removed from
+// the registry.
+func (c *Collector) ForgetDevice(deviceID string) {
+	c.seriesMu.Lock()
+	defer c.seriesMu.Unlock()
+	delete(c.names, deviceID)
+	c.deleteSeries(deviceID, func(string) bool { return true })
+	delete(c.series, deviceID)
+}
+
+// deleteSeries deletes the series of deviceID whose name matches. Callers
+// must hold c.seriesMu.
+func (c *Collector) deleteSeries(deviceID string, match func(name string) bool) {
+	for key, name := range c.series[deviceID] {
+		if !match(name) {
+			continue
+		}
+		key.vec.DeleteLabelValues(strings.Split(key.values, seriesSep)...)
+		delete(c.series[deviceID], key)
+	}
+}
+
+// observeRegistry drops the series a registry change made stale.
+func (c *Collector) observeRegistry(evt events.DeviceRegistryEvent) {
+	switch evt.Change {
+	case events.DeviceRegistryRemoved:
+		c.ForgetDevice(evt.DeviceID)
+	case events.DeviceRegistryRenamed:
+		name := evt.Name
+		if name == "" {
+			name = evt.DeviceID
+		}
+		c.observeName(evt.DeviceID, name)
+	}
+}
@@ -0,0 +1,218 @@
+package metrics
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// stateSeries returns the device_state series as label value lists.
+func stateSeries(t *testing.T, reg *prometheus.Registry) [][]string {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+	var series [][]string
+	for _, family := range families {
+		if family.GetName() != "z2m_homekit_device_state" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			var values []string
+			for _, l := range m.GetLabel() {
+				values = append(values, l.GetName()+"="+l.GetValue())
+			}
+			series = append(series, values)
+		}
+	}
+	return series
+}
+
+// deviceSeries returns the names of the metric families that still have
+// per-device series.
+func deviceSeries(t *testing.T, reg *prometheus.Registry) []string {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+	var names []string
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "device_id" {
+					names = append(names, family.GetName())
+				}
+			}
+		}
+	}
+	return names
+}
+
+func newTestCollector(t *testing.T, opts Options) (*Collector, *prometheus.Registry) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	bus, err := events.New(testLogger())
+	if err != nil {
+		t.Fatalf("failed to create bus: %v", err)
+	}
+	t.Cleanup(func() { _ = bus.Close() })
+
+	reg := prometheus.NewRegistry()
+	collector, err := NewCollectorWithOptions(ctx, testLogger(), bus, reg, opts)
+	if err != nil {
+		t.Fatalf("NewCollectorWithOptions() error = %v", err)
+	}
+	t.Cleanup(collector.Close)
+	return collector, reg
+}
+
+func TestCollectorCardinalityOptions(t *testing.T) {
+	temp := 21.0
+	humidity := 40.0
+	state := events.StateUpdateEvent{DeviceID: "kitchen", Name: "Kitchen", Temperature: &temp, Humidity: &humidity}
+
+	tests := []struct {
+		name string
+		opts Options
+		want [][]string
+	}{
+		{
+			name: "default",
+			want: [][]string{
+				{"device_id=kitchen", "metric=humidity", "name=Kitchen"},
+				{"device_id=kitchen", "metric=temperature", "name=Kitchen"},
+			},
+		},
+		{
+			name: "drop name",
+			opts: Options{DropName: true},
+			want: [][]string{
+				{"device_id=kitchen", "metric=humidity"},
+				{"device_id=kitchen", "metric=temperature"},
+			},
+		},
+		{
+			name: "hash IDs",
+			opts: Options{DropName: true, HashIDs: true},
+			want: [][]string{
+				{"device_id=857ba31dc6b8878f", "metric=humidity"},
+				{"device_id=857ba31dc6b8878f", "metric=temperature"},
+			},
+		},
+		{
+			name: "exclude metric",
+			opts: Options{DropName: true, Exclude: []string{"*:humidity"}},
+			want: [][]string{
+				{"device_id=kitchen", "metric=temperature"},
+			},
+		},
+		{
+			name: "exclude device",
+			opts: Options{Exclude: []string{"kitchen"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collector, reg := newTestCollector(t, tt.opts)
+			collector.observeState(state)
+			if got := stateSeries(t, reg); !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("series = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectorDropsStaleSeries(t *testing.T) {
+	collector, reg := newTestCollector(t, Options{})
+
+	temp := 21.0
+	collector.observeState(events.StateUpdateEvent{DeviceID: "kitchen", Name: "Kitchen", Temperature: &temp})
+	collector.observeState(events.StateUpdateEvent{DeviceID: "hall", Name: "Hall", Temperature: &temp})
+	collector.observeState(events.StateUpdateEvent{DeviceID: "kitchen", Name: "Kitchen Sensor", Temperature: &temp})
+
+	want := [][]string{
+		{"device_id=hall", "metric=temperature", "name=Hall"},
+		{"device_id=kitchen", "metric=temperature", "name=Kitchen Sensor"},
+	}
+	if got := stateSeries(t, reg); !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("series after rename = %v, want %v", got, want)
+	}
+
+	collector.ForgetDevice("kitchen")
+	want = want[:1]
+	if got := stateSeries(t, reg); !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("series after ForgetDevice = %v, want %v", got, want)
+	}
+}
+
+func TestParseExclude(t *testing.T) {
+	got, err := ParseExclude(" office-motion, *:illuminance ,kitchen:battery,")
+	if err != nil {
+		t.Fatalf("ParseExclude() error = %v", err)
+	}
+	if want := []string{"office-motion", "*:illuminance", "kitchen:battery"}; !slices.Equal(got, want) {
+		t.Errorf("ParseExclude() = %v, want %v", got, want)
+	}
+
+	for _, invalid := range []string{"*", ":battery", "kitchen:"} {
+		if _, err := ParseExclude(invalid); err == nil {
+			t.Errorf("ParseExclude(%q) succeeded, want error", invalid)
+		}
+	}
+}
+
+func TestCollectorDeletesSeriesOnRegistryChange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bus, err := events.New(testLogger())
+	if err != nil {
+		t.Fatalf("failed to create bus: %v", err)
+	}
+	defer func() { _ = bus.Close() }()
+
+	reg := prometheus.NewRegistry()
+	collector, err := NewCollector(ctx, testLogger(), bus, reg)
+	if err != nil {
+		t.Fatalf("NewCollector() error = %v", err)
+	}
+	defer collector.Close()
+
+	temp := 21.0
+	collector.observeState(events.StateUpdateEvent{DeviceID: "kitchen", Name: "Kitchen", Temperature: &temp})
+	collector.observeState(events.StateUpdateEvent{DeviceID: "hall", Name: "Hall", Temperature: &temp})
+	collector.observeAlert(events.AlertEvent{DeviceID: "kitchen", Kind: events.AlertKindFrost, Active: true})
+	collector.observeCommand(events.CommandEvent{DeviceID: "kitchen", Source: "web", CommandType: events.CommandTypeSetPower})
+
+	client, err := bus.Client(events.ClientDeviceManager)
+	if err != nil {
+		t.Fatalf("failed to get client: %v", err)
+	}
+	bus.PublishDeviceRegistry(client, events.DeviceRegistryEvent{
+		DeviceID: "hall", Name: "Hallway", PreviousName: "Hall", Change: events.DeviceRegistryRenamed,
+	})
+	bus.PublishDeviceRegistry(client, events.DeviceRegistryEvent{
+		DeviceID: "kitchen", Name: "Kitchen", Change: events.DeviceRegistryRemoved,
+	})
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		left := deviceSeries(t, reg)
+		if len(left) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("series left after registry changes: %v", left)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -2,9 +2,11 @@ package metrics
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"sync"
+	"time"
 
 	"github.com/kradalby/z2m-homekit/events"
 	"github.com/prometheus/client_golang/prometheus"
@@ -15,20 +17,49 @@ import (
 // Collector subscribes to eventbus updates and exposes Prometheus metrics.
 type Collector struct {
 	logger         *slog.Logger
+	reg            prometheus.Registerer
 	statusSub      *eventbus.Subscriber[events.ConnectionStatusEvent]
 	commandSub     *eventbus.Subscriber[events.CommandEvent]
 	stateSub       *eventbus.Subscriber[events.StateUpdateEvent]
+	alertSub       *eventbus.Subscriber[events.AlertEvent]
+	deviceSeenSub  *eventbus.Subscriber[events.DeviceSeenEvent]
+	registrySub    *eventbus.Subscriber[events.DeviceRegistryEvent]
 	statusGauge    *prometheus.GaugeVec
+	reconnects     *prometheus.GaugeVec
+	retryAttempt   *prometheus.GaugeVec
+	nextRetry      *prometheus.GaugeVec
 	commandCounter *prometheus.CounterVec
 	deviceState    *prometheus.GaugeVec
+	alertActive    *prometheus.GaugeVec
+	pressureTrend  *prometheus.GaugeVec
+	lastSeen       *prometheus.GaugeVec
+	dedupCache     prometheus.Collector
+	mqttMessages   *prometheus.HistogramVec
+	mqttRejected   *prometheus.CounterVec
+	hapRejected    *prometheus.CounterVec
+	hapThrottled   *prometheus.CounterVec
+	health         prometheus.Collector
+	lifecycle      prometheus.Collector
 	ctx            context.Context
 	cancel         context.CancelFunc
 	shutdownOnce   sync.Once
 	workers        sync.WaitGroup
+
+	opts Options
+	// Series written per device, deleted on rename and removal.
+	series   map[string]map[seriesKey]string // device ID -> series -> name label
+	names    map[string]string               // last name label per device
+	seriesMu sync.Mutex
 }
 
 // NewCollector wires eventbus subscribers into Prometheus metrics.
 func NewCollector(ctx context.Context, logger *slog.Logger, bus *events.Bus, reg prometheus.Registerer) (*Collector, error) {
+	return NewCollectorWithOptions(ctx, logger, bus, reg, Options{})
+}
+
+// NewCollectorWithOptions is NewCollector with the per-device metrics
+// shaped by opts.
+func NewCollectorWithOptions(ctx context.Context, logger *slog.Logger, bus *events.Bus, reg prometheus.Registerer, opts Options) (*Collector, error) {
 	if ctx == nil {
 		return nil, fmt.Errorf("context is required")
 	}
@@ -51,12 +82,30 @@ func NewCollector(ctx context.Context, logger *slog.Logger, bus *events.Bus, reg
 	statusSub := eventbus.Subscribe[events.ConnectionStatusEvent](client)
 	commandSub := eventbus.Subscribe[events.CommandEvent](client)
 	stateSub := eventbus.Subscribe[events.StateUpdateEvent](client)
+	alertSub := eventbus.Subscribe[events.AlertEvent](client)
+	deviceSeenSub := eventbus.Subscribe[events.DeviceSeenEvent](client)
+	registrySub := eventbus.Subscribe[events.DeviceRegistryEvent](client)
 
 	statusGauge := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
 		Name: "z2m_homekit_component_status",
 		Help: "Lifecycle state per component (1 when matching status, 0 otherwise)",
 	}, []string{"component", "status"})
 
+	reconnects := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "z2m_homekit_component_reconnects",
+		Help: "Times each component has reconnected since startup",
+	}, []string{"component"})
+
+	retryAttempt := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "z2m_homekit_component_reconnect_attempt",
+		Help: "Failed reconnect attempts in a row per component (0 when connected)",
+	}, []string{"component"})
+
+	nextRetry := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "z2m_homekit_component_next_retry_timestamp_seconds",
+		Help: "Unix time of the next reconnect attempt per component (0 when none is scheduled)",
+	}, []string{"component"})
+
 	commandCounter := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
 		Name: "z2m_homekit_command_total",
 		Help: "Total control commands by source and device",
@@ -65,30 +114,241 @@ func NewCollector(ctx context.Context, logger *slog.Logger, bus *events.Bus, reg
 	deviceState := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
 		Name: "z2m_homekit_device_state",
 		Help: "Device state values (temperature, humidity, battery, etc.)",
-	}, []string{"device_id", "name", "metric"})
+	}, opts.deviceLabelNames("metric"))
+
+	alertActive := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "z2m_homekit_alert_active",
+		Help: "Device alerts by kind (1 when active, 0 when cleared)",
+	}, []string{"device_id", "kind"})
+
+	pressureTrend := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "z2m_homekit_pressure_trend",
+		Help: "Barometric tendency over three hours per device (1 when matching trend, 0 otherwise)",
+	}, opts.deviceLabelNames("trend"))
+
+	lastSeen := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "z2m_homekit_device_last_seen_timestamp_seconds",
+		Help: "Unix time a device last reported to zigbee2mqtt",
+	}, opts.deviceLabelNames())
+
+	dedupCache := promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "z2m_homekit_state_dedup_entries",
+		Help: "Devices with a last state kept to drop duplicate updates",
+	}, func() float64 {
+		return float64(bus.Stats().TrackedDevices)
+	})
+
+	mqttMessages := promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "z2m_homekit_mqtt_message_duration_seconds",
+		Help:    "Time to handle an MQTT message, from parsing to publishing on the event bus, by topic kind",
+		Buckets: []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 1},
+	}, []string{"kind"})
+
+	mqttRejected := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "z2m_homekit_mqtt_rejected_total",
+		Help: "MQTT messages dropped unparsed by topic kind and reason (oversized or binary)",
+	}, []string{"kind", "reason"})
+
+	hapRejected := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "z2m_homekit_hap_rejected_writes_total",
+		Help: "HomeKit characteristic writes refused as invalid by characteristic",
+	}, []string{"characteristic"})
+
+	hapThrottled := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "z2m_homekit_hap_throttled_writes_total",
+		Help: "HomeKit characteristic writes refused by the per-device command rate limit",
+	}, []string{"device_id"})
 
 	c := &Collector{
 		logger:         logger,
+		reg:            reg,
 		statusSub:      statusSub,
 		commandSub:     commandSub,
 		stateSub:       stateSub,
+		alertSub:       alertSub,
+		deviceSeenSub:  deviceSeenSub,
+		registrySub:    registrySub,
 		statusGauge:    statusGauge,
+		reconnects:     reconnects,
+		retryAttempt:   retryAttempt,
+		nextRetry:      nextRetry,
 		commandCounter: commandCounter,
 		deviceState:    deviceState,
+		alertActive:    alertActive,
+		pressureTrend:  pressureTrend,
+		lastSeen:       lastSeen,
+		dedupCache:     dedupCache,
+		mqttMessages:   mqttMessages,
+		mqttRejected:   mqttRejected,
+		hapRejected:    hapRejected,
+		hapThrottled:   hapThrottled,
 		ctx:            collectorCtx,
 		cancel:         cancel,
+		opts:           opts,
+		series:         make(map[string]map[seriesKey]string),
+		names:          make(map[string]string),
 	}
 
-	c.workers.Add(3)
+	c.workers.Add(6)
 	go c.consumeStatuses()
 	go c.consumeCommands()
 	go c.consumeStates()
+	go c.consumeAlerts()
+	go c.consumeDevicesSeen()
+	go c.consumeRegistry()
 
 	logger.Info("metrics collector started")
 
 	return c, nil
 }
 
+// RegisterBuildInfo exports a constant z2m_homekit_build_info gauge labelled
+// with the binary's version information.
+func RegisterBuildInfo(reg prometheus.Registerer, version, commit, buildDate, goVersion string) {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	buildInfo := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "z2m_homekit_build_info",
+		Help: "Build information about the running binary (always 1)",
+	}, []string{"version", "commit", "build_date", "go_version"})
+	buildInfo.WithLabelValues(version, commit, buildDate, goVersion).Set(1)
+
+	// The binary does not change when the bridge is restarted in-process,
+	// so an existing registration is already correct.
+	if err := reg.Register(buildInfo); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if !errors.As(err, &are) {
+			panic(err)
+		}
+	}
+}
+
+// HealthSample is one device's health score for export.
+type HealthSample struct {
+	DeviceID string
+	Name     string
+	Score    int
+}
+
+// healthCollector computes health scores at scrape time, so a device that
+// stops reporting degrades without needing an event.
+type healthCollector struct {
+	desc   *prometheus.Desc
+	source func() []HealthSample
+}
+
+func (h *healthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- h.desc
+}
+
+func (h *healthCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range h.source() {
+		ch <- prometheus.MustNewConstMetric(h.desc, prometheus.GaugeValue, float64(s.Score), s.DeviceID, s.Name)
+	}
+}
+
+// SetHealthSource exports z2m_homekit_device_health from source, which is
+// called on every scrape.
+func (c *Collector) SetHealthSource(source func() []HealthSample) error {
+	health := &healthCollector{
+		desc: prometheus.NewDesc(
+			"z2m_homekit_device_health",
+			"Device health score (0-100) from link quality, report frequency, battery and command failures",
+			[]string{"device_id", "name"}, nil,
+		),
+		source: source,
+	}
+	if err := c.reg.Register(health); err != nil {
+		return fmt.Errorf("failed to register health metric: %w", err)
+	}
+	c.health = health
+	return nil
+}
+
+// LifecycleSample describes the process lifecycle for export.
+type LifecycleSample struct {
+	StartTime         time.Time
+	LastShutdown      string // reason the previous run ended, empty on first start
+	ComponentRestarts map[string]int
+}
+
+type lifecycleCollector struct {
+	uptime   *prometheus.Desc
+	shutdown *prometheus.Desc
+	restarts *prometheus.Desc
+	source   func() LifecycleSample
+}
+
+func (l *lifecycleCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- l.uptime
+	ch <- l.shutdown
+	ch <- l.restarts
+}
+
+func (l *lifecycleCollector) Collect(ch chan<- prometheus.Metric) {
+	s := l.source()
+	ch <- prometheus.MustNewConstMetric(l.uptime, prometheus.GaugeValue, time.Since(s.StartTime).Seconds())
+	if s.LastShutdown != "" {
+		ch <- prometheus.MustNewConstMetric(l.shutdown, prometheus.GaugeValue, 1, s.LastShutdown)
+	}
+	for component, n := range s.ComponentRestarts {
+		ch <- prometheus.MustNewConstMetric(l.restarts, prometheus.CounterValue, float64(n), component)
+	}
+}
+
+// SetLifecycleSource exports uptime, the previous shutdown reason and
+// component restart counts from source, which is called on every scrape.
+func (c *Collector) SetLifecycleSource(source func() LifecycleSample) error {
+	lifecycle := &lifecycleCollector{
+		uptime: prometheus.NewDesc(
+			"z2m_homekit_uptime_seconds",
+			"Seconds since the bridge process started",
+			nil, nil,
+		),
+		shutdown: prometheus.NewDesc(
+			"z2m_homekit_last_shutdown",
+			"Reason the previous run ended (signal, panic, error or unclean), 1 for the recorded reason",
+			[]string{"reason"}, nil,
+		),
+		restarts: prometheus.NewDesc(
+			"z2m_homekit_component_restarts_total",
+			"Times a component came up again within this process, e.g. on configuration reload",
+			[]string{"component"}, nil,
+		),
+		source: source,
+	}
+	if err := c.reg.Register(lifecycle); err != nil {
+		return fmt.Errorf("failed to register lifecycle metrics: %w", err)
+	}
+	c.lifecycle = lifecycle
+	return nil
+}
+
+// ObserveMQTTMessage records how long handling an MQTT message of kind
+// (device, bridge, command or other) took.
+func (c *Collector) ObserveMQTTMessage(kind string, elapsed time.Duration) {
+	c.mqttMessages.WithLabelValues(kind).Observe(elapsed.Seconds())
+}
+
+// RejectMQTTMessage counts an MQTT message of kind dropped for reason.
+func (c *Collector) RejectMQTTMessage(kind, reason string) {
+	c.mqttRejected.WithLabelValues(kind, reason).Inc()
+}
+
+// RejectHAPWrite counts a HomeKit write to characteristic refused as
+// invalid.
+func (c *Collector) RejectHAPWrite(characteristic string) {
+	c.hapRejected.WithLabelValues(characteristic).Inc()
+}
+
+// ThrottleHAPWrite counts a HomeKit write to deviceID refused by the
+// command rate limit.
+func (c *Collector) ThrottleHAPWrite(deviceID string) {
+	c.hapThrottled.WithLabelValues(deviceID).Inc()
+}
+
 // Close stops the collector and releases subscribers.
 func (c *Collector) Close() {
 	c.shutdownOnce.Do(func() {
@@ -102,7 +362,39 @@ func (c *Collector) Close() {
 		if c.stateSub != nil {
 			c.stateSub.Close()
 		}
+		if c.alertSub != nil {
+			c.alertSub.Close()
+		}
+		if c.deviceSeenSub != nil {
+			c.deviceSeenSub.Close()
+		}
+		if c.registrySub != nil {
+			c.registrySub.Close()
+		}
 		c.workers.Wait()
+
+		// Unregister so a new collector can be created on the same
+		// registerer when the bridge is restarted in-process.
+		c.reg.Unregister(c.statusGauge)
+		c.reg.Unregister(c.reconnects)
+		c.reg.Unregister(c.retryAttempt)
+		c.reg.Unregister(c.nextRetry)
+		c.reg.Unregister(c.commandCounter)
+		c.reg.Unregister(c.deviceState)
+		c.reg.Unregister(c.alertActive)
+		c.reg.Unregister(c.pressureTrend)
+		c.reg.Unregister(c.lastSeen)
+		c.reg.Unregister(c.dedupCache)
+		c.reg.Unregister(c.mqttMessages)
+		c.reg.Unregister(c.mqttRejected)
+		c.reg.Unregister(c.hapRejected)
+		c.reg.Unregister(c.hapThrottled)
+		if c.health != nil {
+			c.reg.Unregister(c.health)
+		}
+		if c.lifecycle != nil {
+			c.reg.Unregister(c.lifecycle)
+		}
 		c.logger.Info("metrics collector stopped")
 	})
 }
@@ -143,6 +435,42 @@ func (c *Collector) consumeStates() {
 	}
 }
 
+func (c *Collector) consumeAlerts() {
+	defer c.workers.Done()
+	for {
+		select {
+		case evt := <-c.alertSub.Events():
+			c.observeAlert(evt)
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Collector) consumeDevicesSeen() {
+	defer c.workers.Done()
+	for {
+		select {
+		case evt := <-c.deviceSeenSub.Events():
+			c.observeDeviceSeen(evt)
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Collector) consumeRegistry() {
+	defer c.workers.Done()
+	for {
+		select {
+		case evt := <-c.registrySub.Events():
+			c.observeRegistry(evt)
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
 func (c *Collector) observeStatus(evt events.ConnectionStatusEvent) {
 	for _, status := range []events.ConnectionStatus{
 		events.ConnectionStatusDisconnected,
@@ -157,6 +485,14 @@ func (c *Collector) observeStatus(evt events.ConnectionStatusEvent) {
 		}
 		c.statusGauge.WithLabelValues(evt.Component, string(status)).Set(value)
 	}
+
+	c.reconnects.WithLabelValues(evt.Component).Set(float64(evt.Reconnects))
+	c.retryAttempt.WithLabelValues(evt.Component).Set(float64(evt.Attempt))
+	next := 0.0
+	if !evt.NextRetry.IsZero() {
+		next = float64(evt.NextRetry.Unix())
+	}
+	c.nextRetry.WithLabelValues(evt.Component).Set(next)
 }
 
 func (c *Collector) observeCommand(evt events.CommandEvent) {
@@ -172,7 +508,12 @@ func (c *Collector) observeCommand(evt events.CommandEvent) {
 	if deviceID == "" {
 		deviceID = "unknown"
 	}
-	c.commandCounter.WithLabelValues(source, deviceID, commandType).Inc()
+	if !c.exported(deviceID, "") {
+		return
+	}
+	labels := []string{source, c.deviceLabel(deviceID), commandType}
+	c.track(c.commandCounter, deviceID, "", labels)
+	c.commandCounter.WithLabelValues(labels...).Inc()
 }
 
 func (c *Collector) observeState(evt events.StateUpdateEvent) {
@@ -181,89 +522,156 @@ func (c *Collector) observeState(evt events.StateUpdateEvent) {
 	if name == "" {
 		name = deviceID
 	}
+	if !c.exported(deviceID, "") {
+		return
+	}
+	c.observeName(deviceID, name)
 
 	// Temperature sensor
 	if evt.Temperature != nil {
-		c.deviceState.WithLabelValues(deviceID, name, "temperature").Set(*evt.Temperature)
+		c.setState(deviceID, name, "temperature", *evt.Temperature)
 	}
 
 	// Humidity sensor
 	if evt.Humidity != nil {
-		c.deviceState.WithLabelValues(deviceID, name, "humidity").Set(*evt.Humidity)
+		c.setState(deviceID, name, "humidity", *evt.Humidity)
 	}
 
 	// Battery level
 	if evt.Battery != nil {
-		c.deviceState.WithLabelValues(deviceID, name, "battery").Set(float64(*evt.Battery))
+		c.setState(deviceID, name, "battery", float64(*evt.Battery))
 	}
 
 	// Occupancy sensor (1 = occupied, 0 = clear)
 	if evt.Occupancy != nil {
-		val := 0.0
-		if *evt.Occupancy {
-			val = 1.0
-		}
-		c.deviceState.WithLabelValues(deviceID, name, "occupancy").Set(val)
+		c.setState(deviceID, name, "occupancy", boolValue(*evt.Occupancy))
 	}
 
 	// Illuminance
 	if evt.Illuminance != nil {
-		c.deviceState.WithLabelValues(deviceID, name, "illuminance").Set(float64(*evt.Illuminance))
+		c.setState(deviceID, name, "illuminance", float64(*evt.Illuminance))
 	}
 
 	// Pressure
 	if evt.Pressure != nil {
-		c.deviceState.WithLabelValues(deviceID, name, "pressure").Set(*evt.Pressure)
+		c.setState(deviceID, name, "pressure", *evt.Pressure)
+	}
+
+	// Pressure trend, derived from the last three hours of readings
+	if evt.PressureChange != nil {
+		c.setState(deviceID, name, "pressure_change", *evt.PressureChange)
+	}
+	if evt.PressureTrend != "" && c.exported(deviceID, "pressure_trend") {
+		for _, trend := range []string{"rising", "falling", "steady"} {
+			value := 0.0
+			if trend == evt.PressureTrend {
+				value = 1.0
+			}
+			c.gauge(c.pressureTrend, deviceID, name, c.deviceLabels(deviceID, name, trend)).Set(value)
+		}
 	}
 
 	// Contact sensor (1 = closed, 0 = open)
 	if evt.Contact != nil {
-		val := 0.0
-		if *evt.Contact {
-			val = 1.0
-		}
-		c.deviceState.WithLabelValues(deviceID, name, "contact").Set(val)
+		c.setState(deviceID, name, "contact", boolValue(*evt.Contact))
 	}
 
 	// Water leak sensor (1 = leak, 0 = no leak)
 	if evt.WaterLeak != nil {
-		val := 0.0
-		if *evt.WaterLeak {
-			val = 1.0
-		}
-		c.deviceState.WithLabelValues(deviceID, name, "water_leak").Set(val)
+		c.setState(deviceID, name, "water_leak", boolValue(*evt.WaterLeak))
 	}
 
 	// Smoke sensor (1 = smoke, 0 = clear)
 	if evt.Smoke != nil {
-		val := 0.0
-		if *evt.Smoke {
-			val = 1.0
-		}
-		c.deviceState.WithLabelValues(deviceID, name, "smoke").Set(val)
+		c.setState(deviceID, name, "smoke", boolValue(*evt.Smoke))
 	}
 
 	// Power state (1 = on, 0 = off)
 	if evt.On != nil {
-		val := 0.0
-		if *evt.On {
-			val = 1.0
-		}
-		c.deviceState.WithLabelValues(deviceID, name, "power").Set(val)
+		c.setState(deviceID, name, "power", boolValue(*evt.On))
+	}
+
+	// Power metering (W, V, A and kWh)
+	if evt.Power != nil {
+		c.setState(deviceID, name, "power_watts", *evt.Power)
+	}
+	if evt.Voltage != nil {
+		c.setState(deviceID, name, "voltage", *evt.Voltage)
+	}
+	if evt.Current != nil {
+		c.setState(deviceID, name, "current", *evt.Current)
+	}
+	if evt.Energy != nil {
+		c.setState(deviceID, name, "energy", *evt.Energy)
 	}
 
 	// Brightness (0-100)
 	if evt.Brightness != nil {
-		c.deviceState.WithLabelValues(deviceID, name, "brightness").Set(float64(*evt.Brightness))
+		c.setState(deviceID, name, "brightness", float64(*evt.Brightness))
 	}
 
 	// Fan speed (0-100)
 	if evt.FanSpeed != nil {
-		c.deviceState.WithLabelValues(deviceID, name, "fan_speed").Set(float64(*evt.FanSpeed))
+		c.setState(deviceID, name, "fan_speed", float64(*evt.FanSpeed))
+	}
+
+	// Cover position and tilt (0-100)
+	if evt.Position != nil {
+		c.setState(deviceID, name, "position", float64(*evt.Position))
+	}
+	if evt.Tilt != nil {
+		c.setState(deviceID, name, "tilt", float64(*evt.Tilt))
 	}
 
-	// Link quality
-	if evt.LinkQuality > 0 {
-		c.deviceState.WithLabelValues(deviceID, name, "link_quality").Set(float64(evt.LinkQuality))
+	// Security system (1 = armed in any mode, 1 = siren sounding)
+	if evt.ArmMode != "" {
+		c.setState(deviceID, name, "armed", boolValue(evt.ArmMode != "disarmed"))
+	}
+	if evt.Siren != nil {
+		c.setState(deviceID, name, "siren", boolValue(*evt.Siren))
+	}
+
+	c.observeLiveness(deviceID, name, evt.LinkQuality, evt.LastSeen)
+}
+
+// observeDeviceSeen keeps the liveness gauges current for devices whose
+// state is unchanged.
+func (c *Collector) observeDeviceSeen(evt events.DeviceSeenEvent) {
+	name := evt.Name
+	if name == "" {
+		name = evt.DeviceID
+	}
+	if !c.exported(evt.DeviceID, "") {
+		return
+	}
+	c.observeName(evt.DeviceID, name)
+	c.observeLiveness(evt.DeviceID, name, evt.LinkQuality, evt.LastSeen)
+}
+
+func (c *Collector) observeLiveness(deviceID, name string, linkQuality int, lastSeen time.Time) {
+	if linkQuality > 0 {
+		c.setState(deviceID, name, "link_quality", float64(linkQuality))
+	}
+	if !lastSeen.IsZero() && c.exported(deviceID, "last_seen") {
+		c.gauge(c.lastSeen, deviceID, name, c.deviceLabels(deviceID, name)).Set(float64(lastSeen.Unix()))
+	}
+}
+
+func boolValue(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+func (c *Collector) observeAlert(evt events.AlertEvent) {
+	val := 0.0
+	if evt.Active {
+		val = 1.0
+	}
+	if !c.exported(evt.DeviceID, "") {
+		return
 	}
+	labels := []string{c.deviceLabel(evt.DeviceID), string(evt.Kind)}
+	c.gauge(c.alertActive, evt.DeviceID, "", labels).Set(val)
 }
@@ -68,6 +68,28 @@ func TestNewCollectorSuccess(t *testing.T) {
 	collector.Close()
 }
 
+func TestNewCollectorAfterClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reg := prometheus.NewRegistry()
+	for i := 0; i < 2; i++ {
+		bus, err := events.New(testLogger())
+		if err != nil {
+			t.Fatalf("failed to create bus: %v", err)
+		}
+
+		collector, err := NewCollector(ctx, testLogger(), bus, reg)
+		if err != nil {
+			t.Fatalf("NewCollector() #%d error = %v", i, err)
+		}
+		RegisterBuildInfo(reg, "dev", "unknown", "unknown", "go")
+
+		collector.Close()
+		_ = bus.Close()
+	}
+}
+
 func TestCollectorObservesStatusEvents(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -154,6 +176,7 @@ func TestCollectorObservesStateEvents(t *testing.T) {
 		Temperature: &temp,
 		Humidity:    &humidity,
 		Battery:     &battery,
+		LastSeen:    time.Unix(1700000000, 0),
 	})
 
 	// Give collector time to process
@@ -167,6 +190,11 @@ func TestCollectorObservesStateEvents(t *testing.T) {
 
 	found := false
 	for _, family := range families {
+		if family.GetName() == "z2m_homekit_device_last_seen_timestamp_seconds" {
+			if got := family.GetMetric()[0].GetGauge().GetValue(); got != 1700000000 {
+				t.Errorf("last seen = %v, want 1700000000", got)
+			}
+		}
 		if family.GetName() == "z2m_homekit_device_state" {
 			found = true
 			// Check we have multiple metrics for different properties
@@ -181,3 +209,252 @@ func TestCollectorObservesStateEvents(t *testing.T) {
 		t.Error("expected z2m_homekit_device_state metric to be present")
 	}
 }
+
+func TestCollectorObservesPressureTrend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bus, err := events.New(testLogger())
+	if err != nil {
+		t.Fatalf("failed to create bus: %v", err)
+	}
+	defer func() { _ = bus.Close() }()
+
+	reg := prometheus.NewRegistry()
+	collector, err := NewCollector(ctx, testLogger(), bus, reg)
+	if err != nil {
+		t.Fatalf("NewCollector() error = %v", err)
+	}
+	defer collector.Close()
+
+	client, err := bus.Client(events.ClientMQTT)
+	if err != nil {
+		t.Fatalf("failed to get client: %v", err)
+	}
+
+	pressure := 1008.0
+	change := -2.4
+	bus.PublishStateUpdate(client, events.StateUpdateEvent{
+		Timestamp:      time.Now(),
+		DeviceID:       "weather",
+		Name:           "Weather",
+		Pressure:       &pressure,
+		PressureTrend:  "falling",
+		PressureChange: &change,
+	})
+
+	time.Sleep(50 * time.Millisecond)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	trends := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != "z2m_homekit_pressure_trend" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "trend" {
+					trends[label.GetValue()] = m.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+
+	if trends["falling"] != 1 || trends["rising"] != 0 || trends["steady"] != 0 {
+		t.Errorf("pressure trend gauges = %v, want only falling set", trends)
+	}
+}
+
+func TestCollectorObservesAlertEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bus, err := events.New(testLogger())
+	if err != nil {
+		t.Fatalf("failed to create bus: %v", err)
+	}
+	defer func() { _ = bus.Close() }()
+
+	reg := prometheus.NewRegistry()
+	collector, err := NewCollector(ctx, testLogger(), bus, reg)
+	if err != nil {
+		t.Fatalf("NewCollector() error = %v", err)
+	}
+	defer collector.Close()
+
+	client, err := bus.Client(events.ClientDeviceManager)
+	if err != nil {
+		t.Fatalf("failed to get client: %v", err)
+	}
+
+	bus.PublishAlert(client, events.AlertEvent{
+		Timestamp: time.Now(),
+		DeviceID:  "test-sensor",
+		Kind:      events.AlertKindLinkQuality,
+		Active:    true,
+	})
+
+	// Give collector time to process
+	time.Sleep(50 * time.Millisecond)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	found := false
+	for _, family := range families {
+		if family.GetName() == "z2m_homekit_alert_active" {
+			found = true
+			if got := family.GetMetric()[0].GetGauge().GetValue(); got != 1 {
+				t.Errorf("alert gauge = %v, want 1", got)
+			}
+			break
+		}
+	}
+
+	if !found {
+		t.Error("expected z2m_homekit_alert_active metric to be present")
+	}
+}
+
+func TestRegisterBuildInfo(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	RegisterBuildInfo(reg, "1.2.3", "abc123", "2024-01-01T00:00:00Z", "go1.25")
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != "z2m_homekit_build_info" {
+			continue
+		}
+		labels := map[string]string{}
+		for _, l := range family.GetMetric()[0].GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		if labels["version"] != "1.2.3" || labels["commit"] != "abc123" {
+			t.Errorf("build_info labels = %v", labels)
+		}
+		return
+	}
+
+	t.Error("expected z2m_homekit_build_info metric to be present")
+}
+
+func TestCollectorHealthSource(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bus, err := events.New(testLogger())
+	if err != nil {
+		t.Fatalf("failed to create bus: %v", err)
+	}
+	defer func() { _ = bus.Close() }()
+
+	reg := prometheus.NewRegistry()
+	collector, err := NewCollector(ctx, testLogger(), bus, reg)
+	if err != nil {
+		t.Fatalf("NewCollector() error = %v", err)
+	}
+
+	score := 90
+	if err := collector.SetHealthSource(func() []HealthSample {
+		return []HealthSample{{DeviceID: "lamp", Name: "Lamp", Score: score}}
+	}); err != nil {
+		t.Fatalf("SetHealthSource() error = %v", err)
+	}
+
+	// The score is read at scrape time.
+	score = 40
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	var got float64 = -1
+	for _, family := range families {
+		if family.GetName() == "z2m_homekit_device_health" {
+			got = family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	if got != 40 {
+		t.Errorf("z2m_homekit_device_health = %v, want 40", got)
+	}
+
+	collector.Close()
+	families, _ = reg.Gather()
+	for _, family := range families {
+		if family.GetName() == "z2m_homekit_device_health" {
+			t.Error("health metric still registered after Close")
+		}
+	}
+}
+
+func TestCollectorLifecycleSource(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bus, err := events.New(testLogger())
+	if err != nil {
+		t.Fatalf("failed to create bus: %v", err)
+	}
+	defer func() { _ = bus.Close() }()
+
+	reg := prometheus.NewRegistry()
+	collector, err := NewCollector(ctx, testLogger(), bus, reg)
+	if err != nil {
+		t.Fatalf("NewCollector() error = %v", err)
+	}
+	defer collector.Close()
+
+	if err := collector.SetLifecycleSource(func() LifecycleSample {
+		return LifecycleSample{
+			StartTime:         time.Now().Add(-time.Minute),
+			LastShutdown:      "panic",
+			ComponentRestarts: map[string]int{"hap": 2},
+		}
+	}); err != nil {
+		t.Fatalf("SetLifecycleSource() error = %v", err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	seen := map[string]*float64{}
+	for _, family := range families {
+		m := family.GetMetric()[0]
+		switch family.GetName() {
+		case "z2m_homekit_uptime_seconds":
+			v := m.GetGauge().GetValue()
+			seen[family.GetName()] = &v
+		case "z2m_homekit_last_shutdown":
+			if m.GetLabel()[0].GetValue() != "panic" {
+				t.Errorf("last shutdown reason = %q", m.GetLabel()[0].GetValue())
+			}
+			v := m.GetGauge().GetValue()
+			seen[family.GetName()] = &v
+		case "z2m_homekit_component_restarts_total":
+			v := m.GetCounter().GetValue()
+			seen[family.GetName()] = &v
+		}
+	}
+
+	if v := seen["z2m_homekit_uptime_seconds"]; v == nil || *v < 60 {
+		t.Errorf("uptime = %v, want at least 60s", v)
+	}
+	if v := seen["z2m_homekit_last_shutdown"]; v == nil || *v != 1 {
+		t.Errorf("last shutdown = %v", v)
+	}
+	if v := seen["z2m_homekit_component_restarts_total"]; v == nil || *v != 2 {
+		t.Errorf("component restarts = %v, want 2", v)
+	}
+}
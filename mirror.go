@@ -0,0 +1,63 @@
+package z2mhomekit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/kradalby/z2m-homekit/devices"
+	"github.com/kradalby/z2m-homekit/events"
+	"tailscale.com/util/eventbus"
+)
+
+// StateMirrorPrefix is the topic prefix normalized device state is
+// mirrored under, as z2m-homekit/state/<deviceID>.
+const StateMirrorPrefix = "z2m-homekit/state/"
+
+// StateMirror republishes normalized device state, after parsing and
+// scaling to HomeKit ranges, as retained JSON on the broker so
+// other systems can consume it without parsing zigbee2mqtt payloads.
+type StateMirror struct {
+	server     devices.Publisher
+	subscriber *eventbus.Subscriber[events.StateUpdateEvent]
+	logger     *slog.Logger
+}
+
+// NewStateMirror creates a mirror publishing to server.
+func NewStateMirror(bus *events.Bus, server devices.Publisher, logger *slog.Logger) (*StateMirror, error) {
+	client, err := bus.Client(events.ClientMirror)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mirror eventbus client: %w", err)
+	}
+
+	return &StateMirror{
+		server:     server,
+		subscriber: eventbus.Subscribe[events.StateUpdateEvent](client),
+		logger:     logger,
+	}, nil
+}
+
+// Run mirrors state updates until ctx is cancelled.
+func (m *StateMirror) Run(ctx context.Context) {
+	for {
+		select {
+		case event := <-m.subscriber.Events():
+			m.publish(event)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *StateMirror) publish(event events.StateUpdateEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		m.logger.Error("Failed to marshal mirrored state", "device_id", event.DeviceID, "error", err)
+		return
+	}
+
+	if err := m.server.Publish(StateMirrorPrefix+event.DeviceID, data, true, 0); err != nil {
+		m.logger.Warn("Failed to publish mirrored state", "device_id", event.DeviceID, "error", err)
+	}
+}
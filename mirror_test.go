@@ -0,0 +1,60 @@
+package z2mhomekit
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+func TestStateMirror(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	server := newTestBroker(t)
+
+	mirror, err := NewStateMirror(bus, server, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go mirror.Run(ctx)
+
+	received := make(chan packets.Packet, 1)
+	if err := server.Subscribe(StateMirrorPrefix+"#", 1, func(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+		received <- pk
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := bus.Client(events.ClientDeviceManager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	brightness := 50
+	bus.PublishStateUpdate(client, events.StateUpdateEvent{DeviceID: "lamp", Name: "Lamp", Brightness: &brightness})
+
+	select {
+	case pk := <-received:
+		if pk.TopicName != StateMirrorPrefix+"lamp" {
+			t.Errorf("topic = %q", pk.TopicName)
+		}
+		if !pk.FixedHeader.Retain {
+			t.Error("mirrored state should be retained")
+		}
+		var got events.StateUpdateEvent
+		if err := json.Unmarshal(pk.Payload, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Brightness == nil || *got.Brightness != 50 {
+			t.Errorf("mirrored brightness = %v, want HAP scale 50", got.Brightness)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("state was not mirrored")
+	}
+}
@@ -3,9 +3,12 @@ package z2mhomekit
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/kradalby/z2m-homekit/devices"
 	mqtt "github.com/mochi-mqtt/server/v2"
@@ -13,14 +16,56 @@ import (
 	"tailscale.com/util/eventbus"
 )
 
+// BridgeStateTopic is where zigbee2mqtt reports whether it is online. It
+// is also zigbee2mqtt's will, published by the broker when it goes away.
+const BridgeStateTopic = "zigbee2mqtt/bridge/state"
+
+// BridgeEventTopic is where zigbee2mqtt publishes devices joining and
+// leaving the network.
+const BridgeEventTopic = "zigbee2mqtt/bridge/event"
+
 // MQTTHook handles MQTT messages from zigbee2mqtt.
 type MQTTHook struct {
 	mqtt.HookBase
 	statePublisher *eventbus.Publisher[devices.StateChangedEvent]
 	deviceManager  *devices.Manager
+	clock          devices.Clock          // nil uses the wall clock
+	journal        *EventJournal          // nil when disabled
+	discovery      *DeviceDiscovery       // nil when disabled
+	timings        messageMetrics         // nil when not exported
+	slowMessage    time.Duration          // 0 disables the slow message log
+	maxPayload     int                    // 0 accepts any size
+	lastRejectLog  atomic.Int64           // unix nanos of the last rejection logged
+	z2mClient      atomic.Pointer[string] // client that last reported zigbee2mqtt online
 	logger         *slog.Logger
 }
 
+// messageMetrics records how long MQTT messages take to handle and which
+// are rejected.
+type messageMetrics interface {
+	ObserveMQTTMessage(kind string, elapsed time.Duration)
+	RejectMQTTMessage(kind, reason string)
+}
+
+const (
+	// slowMessageSnippet is how much of a slow message's payload is
+	// logged.
+	slowMessageSnippet = 256
+
+	// debugPayloadSnippet is how much of each payload is logged at debug.
+	debugPayloadSnippet = 512
+
+	// rejectLogInterval spaces out rejection warnings so a misbehaving
+	// client cannot flood the log; every rejection is still counted.
+	rejectLogInterval = 10 * time.Second
+)
+
+// Reasons a message is rejected before it is parsed.
+const (
+	rejectOversized = "oversized"
+	rejectBinary    = "binary"
+)
+
 // ID returns the hook identifier.
 func (h *MQTTHook) ID() string {
 	return "z2m-mqtt-hook"
@@ -33,6 +78,7 @@ func (h *MQTTHook) Provides(b byte) bool {
 		mqtt.OnDisconnect,
 		mqtt.OnPublish,
 		mqtt.OnPublished,
+		mqtt.OnWillSent,
 	}, []byte{b})
 }
 
@@ -43,35 +89,194 @@ func (h *MQTTHook) OnConnect(cl *mqtt.Client, pk packets.Packet) error {
 	return nil
 }
 
-// OnDisconnect is called when a client disconnects.
+// OnDisconnect is called when a client disconnects. zigbee2mqtt leaving
+// without a will or an offline report still takes its devices offline.
 func (h *MQTTHook) OnDisconnect(cl *mqtt.Client, err error, expire bool) {
 	clientID := cl.ID
 	h.logger.Info("MQTT client disconnected", "client_id", clientID, "error", err, "expire", expire)
+
+	// A reconnect under the same ID takes over the session, so zigbee2mqtt
+	// is still there.
+	if errors.Is(err, packets.ErrSessionTakenOver) {
+		return
+	}
+	if z2m := h.z2mClient.Load(); z2m != nil && *z2m == clientID && h.z2mClient.CompareAndSwap(z2m, nil) {
+		h.logger.Warn("zigbee2mqtt disconnected from the broker", "client_id", clientID)
+		h.deviceManager.SetZ2MOnline(false)
+	}
 }
 
 // OnPublish is called when a message is received from a client.
 func (h *MQTTHook) OnPublish(cl *mqtt.Client, pk packets.Packet) (packets.Packet, error) {
-	topic := pk.TopicName
-	payload := pk.Payload
+	if pk.TopicName == BridgeStateTopic {
+		// Messages injected by the broker itself come without a client.
+		if online, ok := parseBridgeState(pk.Payload); ok && online && cl != nil {
+			clientID := cl.ID
+			h.z2mClient.Store(&clientID)
+		}
+	}
+	h.HandleMessage(pk.TopicName, pk.Payload)
+	return pk, nil
+}
 
+// OnWillSent is called when the broker publishes a client's will. Wills
+// do not pass through OnPublish, so zigbee2mqtt's offline will is handled
+// here.
+func (h *MQTTHook) OnWillSent(cl *mqtt.Client, pk packets.Packet) {
+	h.logger.Info("MQTT will sent", "client_id", cl.ID, "topic", pk.TopicName)
+	h.HandleMessage(pk.TopicName, pk.Payload)
+}
+
+// HandleMessage processes a message published to topic, whether it came
+// through the embedded broker or a subscription on an external one. The
+// time taken is recorded, and messages slower than slowMessage are logged
+// to find parsers or devices that hold up the broker.
+func (h *MQTTHook) HandleMessage(topic string, payload []byte) {
+	kind := mqttTopicKind(topic)
+	if reason := h.rejectPayload(topic, kind, payload); reason != "" {
+		if h.timings != nil {
+			h.timings.RejectMQTTMessage(kind, reason)
+		}
+		h.logReject(topic, reason, payload)
+		return
+	}
+
+	start := time.Now()
+	h.handleMessage(topic, payload)
+	elapsed := time.Since(start)
+
+	if h.timings != nil {
+		h.timings.ObserveMQTTMessage(kind, elapsed)
+	}
+	if h.slowMessage > 0 && elapsed >= h.slowMessage {
+		h.logger.Warn("Slow MQTT message",
+			"topic", topic,
+			"duration", elapsed,
+			"size", len(payload),
+			"payload", payloadSnippet(payload, slowMessageSnippet),
+		)
+	}
+}
+
+// mqttTopicKind groups topics for the message timing histogram.
+func mqttTopicKind(topic string) string {
+	switch {
+	case strings.HasPrefix(topic, CommandTopicPrefix):
+		return "command"
+	case strings.HasPrefix(topic, "zigbee2mqtt/bridge/"):
+		return "bridge"
+	case strings.HasPrefix(topic, "zigbee2mqtt/"):
+		return "device"
+	default:
+		return "other"
+	}
+}
+
+// rejectPayload returns why a message on a device or command topic is
+// not worth parsing: larger than maxPayload, or not text. Bridge topics
+// are exempt from the size limit as zigbee2mqtt/bridge/devices grows with
+// the network; packet size limits still bound them.
+func (h *MQTTHook) rejectPayload(topic, kind string, payload []byte) string {
+	if kind == "other" {
+		return ""
+	}
+	if h.maxPayload > 0 && len(payload) > h.maxPayload && kind != "bridge" {
+		return rejectOversized
+	}
+	if !utf8.Valid(payload) {
+		return rejectBinary
+	}
+	return ""
+}
+
+// logReject warns about a rejected message, at most once per
+// rejectLogInterval.
+func (h *MQTTHook) logReject(topic, reason string, payload []byte) {
+	now := time.Now().UnixNano()
+	last := h.lastRejectLog.Load()
+	if now-last < int64(rejectLogInterval) || !h.lastRejectLog.CompareAndSwap(last, now) {
+		h.logger.Debug("Rejected MQTT message", "topic", topic, "reason", reason, "size", len(payload))
+		return
+	}
+	h.logger.Warn("Rejected MQTT message",
+		"topic", topic,
+		"reason", reason,
+		"size", len(payload),
+		"max_size", h.maxPayload,
+	)
+}
+
+// payloadSnippet returns at most n bytes of payload for logging, with
+// invalid UTF-8 replaced.
+func payloadSnippet(payload []byte, n int) string {
+	if len(payload) <= n {
+		return strings.ToValidUTF8(string(payload), "\uFFFD")
+	}
+	return strings.ToValidUTF8(string(payload[:n]), "\uFFFD") + "..."
+}
+
+func (h *MQTTHook) handleMessage(topic string, payload []byte) {
 	h.logger.Debug("MQTT message received",
 		"topic", topic,
-		"payload", string(payload),
+		"size", len(payload),
+		"payload", payloadSnippet(payload, debugPayloadSnippet),
 	)
 
+	if deviceID, ok := strings.CutPrefix(topic, CommandTopicPrefix); ok {
+		h.handleCommand(deviceID, payload)
+		return
+	}
+
 	// Skip processing for non-zigbee2mqtt topics
 	if !strings.HasPrefix(topic, "zigbee2mqtt/") {
-		return pk, nil
+		return
+	}
+
+	if topic == BridgeStateTopic {
+		if online, ok := parseBridgeState(payload); ok {
+			h.deviceManager.SetZ2MOnline(online)
+		}
+		return
+	}
+
+	if topic == BridgeDevicesTopic {
+		list, err := devices.ParseBridgeDevices(payload)
+		if err != nil {
+			h.logger.Warn("Failed to parse zigbee2mqtt device list", "error", err)
+			return
+		}
+		h.deviceManager.SetBridgeDevices(list)
+		if h.discovery != nil {
+			h.discovery.HandleBridgeDevices(payload)
+		}
+		return
+	}
+
+	if topic == devices.OTAUpdateResponseTopic {
+		h.deviceManager.HandleFirmwareUpdateResponse(payload)
+		return
+	}
+
+	if topic == BridgeEventTopic {
+		if friendlyName, ok := parseDeviceLeave(payload); ok {
+			if device, found := h.deviceManager.DeviceByTopic(friendlyName); found {
+				h.deviceManager.HandleDeviceLeft(device.ID)
+			}
+		}
+		if friendlyName, ieeeAddress, ok := parseDeviceJoined(payload); ok {
+			h.deviceManager.HandleDeviceJoined(friendlyName, ieeeAddress)
+		}
+		return
 	}
 
 	// Skip bridge topics
 	if strings.HasPrefix(topic, "zigbee2mqtt/bridge/") {
-		return pk, nil
+		return
 	}
 
 	// Skip set command topics (these are outgoing commands)
 	if strings.HasSuffix(topic, "/set") || strings.HasSuffix(topic, "/get") {
-		return pk, nil
+		return
 	}
 
 	// Extract device topic from path: zigbee2mqtt/<device-topic>
@@ -81,14 +286,21 @@ func (h *MQTTHook) OnPublish(cl *mqtt.Client, pk packets.Packet) (packets.Packet
 	device, found := h.deviceManager.DeviceByTopic(deviceTopic)
 	if !found {
 		h.logger.Debug("Received message for unknown device", "topic", deviceTopic)
-		return pk, nil
+		return
 	}
 
 	// Parse payload
 	var msg map[string]interface{}
 	if err := json.Unmarshal(payload, &msg); err != nil {
 		h.logger.Debug("Failed to parse MQTT payload", "error", err)
-		return pk, nil
+		return
+	}
+
+	if h.journal != nil {
+		rec := journalRecord{At: time.Now(), DeviceID: device.ID, Topic: topic, Payload: payload}
+		if err := h.journal.Record(rec); err != nil {
+			h.logger.Warn("Failed to journal MQTT message", "device_id", device.ID, "error", err)
+		}
 	}
 
 	// Create state update from message
@@ -107,11 +319,67 @@ func (h *MQTTHook) OnPublish(cl *mqtt.Client, pk packets.Packet) (packets.Packet
 		})
 	}
 
-	return pk, nil
+	if action, ok := msg["action"].(string); ok && action != "" {
+		h.deviceManager.HandleAction(device.ID, action)
+	}
+}
+
+// parseBridgeState parses zigbee2mqtt/bridge/state, which is either
+// {"state":"online"} or, from older zigbee2mqtt versions, a bare "online".
+func parseBridgeState(payload []byte) (online, ok bool) {
+	state := string(payload)
+	var msg struct {
+		State string `json:"state"`
+	}
+	if err := json.Unmarshal(payload, &msg); err == nil {
+		state = msg.State
+	}
+
+	switch state {
+	case "online":
+		return true, true
+	case "offline":
+		return false, true
+	}
+	return false, false
+}
+
+// parseDeviceLeave returns the friendly name of the device in a
+// zigbee2mqtt/bridge/event device_leave message.
+func parseDeviceLeave(payload []byte) (string, bool) {
+	var msg struct {
+		Type string `json:"type"`
+		Data struct {
+			FriendlyName string `json:"friendly_name"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &msg); err != nil || msg.Type != "device_leave" || msg.Data.FriendlyName == "" {
+		return "", false
+	}
+	return msg.Data.FriendlyName, true
+}
+
+// parseDeviceJoined returns the device a zigbee2mqtt/bridge/event
+// device_joined message reports.
+func parseDeviceJoined(payload []byte) (friendlyName, ieeeAddress string, ok bool) {
+	var msg struct {
+		Type string `json:"type"`
+		Data struct {
+			FriendlyName string `json:"friendly_name"`
+			IEEEAddress  string `json:"ieee_address"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &msg); err != nil || msg.Type != "device_joined" || msg.Data.IEEEAddress == "" {
+		return "", "", false
+	}
+	return msg.Data.FriendlyName, msg.Data.IEEEAddress, true
 }
 
 func (h *MQTTHook) parseZ2MMessage(device devices.Device, msg map[string]interface{}) (devices.State, []string) {
 	now := time.Now()
+	if h.clock != nil {
+		now = h.clock.Now()
+	}
 	state := devices.State{
 		ID:          device.ID,
 		Name:        device.Name,
@@ -128,6 +396,7 @@ func (h *MQTTHook) parseZ2MMessage(device devices.Device, msg map[string]interfa
 
 	// Parse sensor values
 	if temp, ok := msg["temperature"].(float64); ok {
+		temp = device.Units.TemperatureC(temp)
 		state.Temperature = &temp
 		fields = append(fields, "Temperature")
 	}
@@ -149,11 +418,11 @@ func (h *MQTTHook) parseZ2MMessage(device devices.Device, msg map[string]interfa
 	}
 
 	if illuminance, ok := msg["illuminance"].(float64); ok {
-		i := int(illuminance)
+		i := int(device.Units.IlluminanceLux(illuminance))
 		state.Illuminance = &i
 		fields = append(fields, "Illuminance")
 	}
-	// Also check illuminance_lux variant
+	// Also check illuminance_lux variant, which is always in lux
 	if illuminance, ok := msg["illuminance_lux"].(float64); ok {
 		i := int(illuminance)
 		state.Illuminance = &i
@@ -161,6 +430,7 @@ func (h *MQTTHook) parseZ2MMessage(device devices.Device, msg map[string]interfa
 	}
 
 	if pressure, ok := msg["pressure"].(float64); ok {
+		pressure = device.Units.PressureHPa(pressure)
 		state.Pressure = &pressure
 		fields = append(fields, "Pressure")
 	}
@@ -191,7 +461,8 @@ func (h *MQTTHook) parseZ2MMessage(device devices.Device, msg map[string]interfa
 	}
 
 	// Parse light values
-	if stateStr, ok := msg["state"].(string); ok {
+	// Covers report OPEN/CLOSE/STOP as state, which is not on/off
+	if stateStr, ok := msg["state"].(string); ok && device.Type != devices.DeviceTypeCover {
 		on := devices.Z2MStateToBool(stateStr)
 		state.On = &on
 		fields = append(fields, "On")
@@ -225,6 +496,27 @@ func (h *MQTTHook) parseZ2MMessage(device devices.Device, msg map[string]interfa
 		}
 	}
 
+	// Parse outlet power metering. Battery powered sensors report their
+	// battery voltage in mV, so only metering devices are read.
+	if device.Type == devices.DeviceTypeOutlet || device.Type == devices.DeviceTypeSwitch || device.Features.Power {
+		if power, ok := msg["power"].(float64); ok {
+			state.Power = &power
+			fields = append(fields, "Power")
+		}
+		if voltage, ok := msg["voltage"].(float64); ok {
+			state.Voltage = &voltage
+			fields = append(fields, "Voltage")
+		}
+		if current, ok := msg["current"].(float64); ok {
+			state.Current = &current
+			fields = append(fields, "Current")
+		}
+		if energy, ok := msg["energy"].(float64); ok {
+			state.Energy = &energy
+			fields = append(fields, "Energy")
+		}
+	}
+
 	// Parse fan values
 	// Z2M uses "fan_state" for on/off and "fan_mode" for speed
 	if fanState, ok := msg["fan_state"].(string); ok {
@@ -242,26 +534,64 @@ func (h *MQTTHook) parseZ2MMessage(device devices.Device, msg map[string]interfa
 
 	// Fan mode can indicate speed levels
 	if fanMode, ok := msg["fan_mode"].(string); ok {
-		// Convert common fan modes to percentage
-		var speed int
-		switch fanMode {
-		case "off":
-			speed = 0
-		case "low":
-			speed = 33
-		case "medium":
-			speed = 66
-		case "high":
-			speed = 100
-		case "auto":
-			speed = 50 // Default auto to medium
-		default:
-			speed = 50
-		}
+		speed := devices.FanModeToSpeed(device.FanModes(), fanMode)
 		state.FanSpeed = &speed
 		fields = append(fields, "FanSpeed")
 	}
 
+	// Parse cover values, 0-100 with 0 closed
+	if position, ok := msg["position"].(float64); ok {
+		p := devices.ClampPercentage(int(position))
+		state.Position = &p
+		fields = append(fields, "Position")
+	}
+
+	if tilt, ok := msg["tilt"].(float64); ok {
+		t := devices.ClampPercentage(int(tilt))
+		state.Tilt = &t
+		fields = append(fields, "Tilt")
+	}
+
+	// Parse cover motor calibration, as curtain and roller motors report it
+	if device.Type == devices.DeviceTypeCover {
+		if calibration, ok := msg["calibration"].(string); ok {
+			calibrating := devices.Z2MStateToBool(calibration)
+			state.Calibrating = &calibrating
+			fields = append(fields, "Calibrating")
+		}
+		if travel, ok := msg["calibration_time"].(float64); ok {
+			state.TravelTime = &travel
+			fields = append(fields, "TravelTime")
+		}
+		if reversal, ok := msg["motor_reversal"].(string); ok {
+			reversed := devices.Z2MStateToBool(reversal)
+			state.MotorReversed = &reversed
+			fields = append(fields, "MotorReversed")
+		}
+	}
+
+	// Parse security system values
+	if alarm, ok := msg["alarm"].(bool); ok {
+		state.Siren = &alarm
+		fields = append(fields, "Siren")
+	}
+
+	// Parse firmware update state and progress
+	if update, ok := msg["update"].(map[string]interface{}); ok {
+		if s, ok := update["state"].(string); ok {
+			u := devices.FirmwareUpdate{State: s}
+			if progress, ok := update["progress"].(float64); ok {
+				u.Progress = &progress
+			}
+			if remaining, ok := update["remaining"].(float64); ok {
+				r := int(remaining)
+				u.Remaining = &r
+			}
+			state.Update = &u
+			fields = append(fields, "Update")
+		}
+	}
+
 	// Always add connectivity fields
 	fields = append(fields, "LastSeen", "LastUpdated")
 
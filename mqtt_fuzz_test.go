@@ -0,0 +1,121 @@
+package z2mhomekit
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/devices"
+	"github.com/kradalby/z2m-homekit/events"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"tailscale.com/util/eventbus"
+)
+
+var fuzzPayloads = []string{
+	`{}`,
+	`{"temperature":21.5,"humidity":40,"battery":90,"linkquality":120}`,
+	`{"state":"ON","brightness":254,"color_temp":370,"color":{"hue":120,"saturation":80}}`,
+	`{"fan_state":"ON","fan_mode":"medium","fan_speed":66}`,
+	`{"occupancy":true,"illuminance":1e308,"illuminance_lux":-1e308}`,
+	`{"contact":false,"water_leak":true,"smoke":false,"tamper":true,"power":12.5}`,
+	`{"state":"ON","power":1200.5,"voltage":230.1,"current":5.22,"energy":"12.3"}`,
+	`{"temperature":"21.5","humidity":null,"state":1,"color":[1,2,3]}`,
+	`{"color":{"hue":{"nested":{"deep":true}}},"fan_mode":{"x":1}}`,
+	`{"battery":1e400}`,
+	`[1,2,3]`,
+	`null`,
+	`"string"`,
+	`{"state":"\xff\xfe"}`,
+	`{"state":"online"}`,
+	`online`,
+	`{"type":"device_leave","data":{"ieee_address":"0x1","friendly_name":"sensor"}}`,
+	`{`,
+}
+
+func newFuzzHook(t testing.TB) *MQTTHook {
+	t.Helper()
+
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	deviceConfigs := []devices.Device{
+		{ID: "sensor", Name: "Sensor", Topic: "sensor", Type: devices.DeviceTypeClimateSensor},
+		{ID: "fan", Name: "Fan", Topic: "room/fan", Type: devices.DeviceTypeFan, FanModeNames: []string{"low", "high"}},
+	}
+
+	commands := make(chan devices.CommandEvent, 1)
+	manager := newTestDeviceManager(t, bus, deviceConfigs, commands)
+
+	client, err := bus.Client(events.ClientMQTT)
+	if err != nil {
+		t.Fatalf("bus.Client: %v", err)
+	}
+
+	return &MQTTHook{
+		statePublisher: eventbus.Publish[devices.StateChangedEvent](client),
+		deviceManager:  manager,
+		logger:         logger,
+	}
+}
+
+func FuzzParseZ2MMessage(f *testing.F) {
+	for _, p := range fuzzPayloads {
+		f.Add([]byte(p))
+	}
+
+	hook := &MQTTHook{logger: testLogger()}
+	device := devices.Device{
+		ID:           "fan",
+		Name:         "Fan",
+		Type:         devices.DeviceTypeFan,
+		FanModeNames: []string{"low", "high"},
+	}
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		var msg map[string]interface{}
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			return
+		}
+
+		state, fields := hook.parseZ2MMessage(device, msg)
+		if state.ID != device.ID {
+			t.Fatalf("state.ID = %q, want %q", state.ID, device.ID)
+		}
+		if len(fields) < 2 {
+			t.Fatalf("fields = %v, want connectivity fields", fields)
+		}
+	})
+}
+
+func FuzzMQTTHookOnPublish(f *testing.F) {
+	topics := []string{
+		"zigbee2mqtt/sensor",
+		"zigbee2mqtt/room/fan",
+		"zigbee2mqtt/room/fan/set",
+		"zigbee2mqtt/bridge/state",
+		"zigbee2mqtt/bridge/event",
+		"zigbee2mqtt/",
+		"zigbee2mqtt",
+		"other/topic",
+		"zigbee2mqtt/\xff\xfe",
+		"",
+	}
+	for _, topic := range topics {
+		for _, p := range fuzzPayloads {
+			f.Add(topic, []byte(p))
+		}
+	}
+
+	hook := newFuzzHook(f)
+
+	f.Fuzz(func(t *testing.T, topic string, payload []byte) {
+		pk := packets.Packet{TopicName: topic, Payload: payload}
+
+		out, err := hook.OnPublish(nil, pk)
+		if err != nil {
+			t.Fatalf("OnPublish returned error: %v", err)
+		}
+		if out.TopicName != topic {
+			t.Fatalf("OnPublish rewrote topic %q to %q", topic, out.TopicName)
+		}
+	})
+}
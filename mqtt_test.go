@@ -0,0 +1,195 @@
+package z2mhomekit
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kradalby/z2m-homekit/devices"
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+type recordedTimings struct {
+	kinds    []string
+	rejected []string
+}
+
+func (r *recordedTimings) ObserveMQTTMessage(kind string, _ time.Duration) {
+	r.kinds = append(r.kinds, kind)
+}
+
+func (r *recordedTimings) RejectMQTTMessage(kind, reason string) {
+	r.rejected = append(r.rejected, kind+":"+reason)
+}
+
+func TestHandleMessageTimings(t *testing.T) {
+	hook := newFuzzHook(t)
+	timings := &recordedTimings{}
+	hook.timings = timings
+
+	var logs bytes.Buffer
+	hook.logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	hook.HandleMessage("zigbee2mqtt/sensor", []byte(`{"temperature":21.5}`))
+	hook.HandleMessage("zigbee2mqtt/bridge/state", []byte(`online`))
+	hook.HandleMessage(CommandTopicPrefix+"missing", []byte(`{"on":true}`))
+	hook.HandleMessage("homeassistant/status", []byte(`online`))
+
+	want := []string{"device", "bridge", "command", "other"}
+	if strings.Join(timings.kinds, ",") != strings.Join(want, ",") {
+		t.Errorf("observed kinds = %v, want %v", timings.kinds, want)
+	}
+	if strings.Contains(logs.String(), "Slow MQTT message") {
+		t.Error("slow message logged with the log disabled")
+	}
+
+	// Every message is slow with a 1ns threshold.
+	hook.slowMessage = time.Nanosecond
+	hook.HandleMessage("zigbee2mqtt/sensor", []byte(`{"temperature":`+strings.Repeat("1", 1000)+`}`))
+	out := logs.String()
+	if !strings.Contains(out, "Slow MQTT message") || !strings.Contains(out, "topic=zigbee2mqtt/sensor") {
+		t.Fatalf("slow message not logged: %s", out)
+	}
+	if strings.Contains(out, strings.Repeat("1", slowMessageSnippet)) {
+		t.Error("slow message log holds the whole payload")
+	}
+}
+
+func TestParsePowerMetering(t *testing.T) {
+	hook := &MQTTHook{logger: testLogger()}
+	device := devices.Device{ID: "plug", Name: "Plug", Type: devices.DeviceTypeOutlet, Features: devices.DeviceFeatures{Power: true}}
+
+	state, fields := hook.parseZ2MMessage(device, map[string]any{
+		"power":   1200.5,
+		"voltage": 230.1,
+		"current": 5.22,
+		"energy":  12.3,
+	})
+
+	for _, tt := range []struct {
+		field string
+		got   *float64
+		want  float64
+	}{
+		{"Power", state.Power, 1200.5},
+		{"Voltage", state.Voltage, 230.1},
+		{"Current", state.Current, 5.22},
+		{"Energy", state.Energy, 12.3},
+	} {
+		if tt.got == nil || *tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.field, tt.got, tt.want)
+		}
+		if !slices.Contains(fields, tt.field) {
+			t.Errorf("fields = %v, missing %s", fields, tt.field)
+		}
+	}
+
+	// Readings zigbee2mqtt did not send are left unset.
+	state, _ = hook.parseZ2MMessage(device, map[string]any{"power": 3.0})
+	if state.Voltage != nil || state.Current != nil || state.Energy != nil {
+		t.Errorf("unsent readings set: %+v", state)
+	}
+
+	// Battery sensors report their voltage in mV, which is not metering.
+	sensor := devices.Device{ID: "door", Name: "Door", Type: devices.DeviceTypeContactSensor}
+	state, fields = hook.parseZ2MMessage(sensor, map[string]any{"voltage": 3000.0, "battery": 90.0})
+	if state.Voltage != nil || slices.Contains(fields, "Voltage") {
+		t.Errorf("sensor voltage parsed as metering, fields %v", fields)
+	}
+}
+
+func TestHandleMessageRejectsPayloads(t *testing.T) {
+	hook := newFuzzHook(t)
+	timings := &recordedTimings{}
+	hook.timings = timings
+	hook.maxPayload = 64
+
+	var logs bytes.Buffer
+	hook.logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	big := []byte(`{"temperature":21.5,"note":"` + strings.Repeat("x", 100) + `"}`)
+	hook.HandleMessage("zigbee2mqtt/sensor", big)
+	hook.HandleMessage(CommandTopicPrefix+"fan", big)
+	hook.HandleMessage("zigbee2mqtt/sensor", []byte{0x7b, 0xff, 0xfe, 0x7d})
+	hook.HandleMessage("zigbee2mqtt/bridge/devices", append([]byte(`[`), append(bytes.Repeat([]byte(`{},`), 40), ']')...))
+	hook.HandleMessage("zigbee2mqtt/sensor", []byte(`{"temperature":21.5}`))
+
+	want := []string{"device:oversized", "command:oversized", "device:binary"}
+	if strings.Join(timings.rejected, ",") != strings.Join(want, ",") {
+		t.Errorf("rejected = %v, want %v", timings.rejected, want)
+	}
+	if strings.Join(timings.kinds, ",") != "bridge,device" {
+		t.Errorf("handled kinds = %v, want bridge and device", timings.kinds)
+	}
+	if n := strings.Count(logs.String(), "level=WARN msg=\"Rejected MQTT message\""); n != 1 {
+		t.Errorf("logged %d rejection warnings, want 1 within the interval", n)
+	}
+	if strings.Contains(logs.String(), strings.Repeat("x", 100)) {
+		t.Error("rejected payload logged")
+	}
+}
+
+func TestPayloadSnippet(t *testing.T) {
+	if got := payloadSnippet([]byte("short"), 10); got != "short" {
+		t.Errorf("payloadSnippet(short) = %q", got)
+	}
+	if got := payloadSnippet([]byte("0123456789abc"), 10); got != "0123456789..." {
+		t.Errorf("payloadSnippet(long) = %q", got)
+	}
+	// Cutting inside a multi-byte rune leaves valid UTF-8.
+	if got := payloadSnippet([]byte("ab\u00e9"), 3); !utf8.ValidString(got) {
+		t.Errorf("payloadSnippet split rune = %q", got)
+	}
+}
+
+func TestZ2MWillAndDisconnect(t *testing.T) {
+	hook := newFuzzHook(t)
+	dm := hook.deviceManager
+	z2m := &mqtt.Client{ID: "zigbee2mqtt"}
+	online := packets.Packet{TopicName: BridgeStateTopic, Payload: []byte(`{"state":"online"}`)}
+	offline := packets.Packet{TopicName: BridgeStateTopic, Payload: []byte(`{"state":"offline"}`)}
+
+	if _, err := hook.OnPublish(z2m, online); err != nil {
+		t.Fatal(err)
+	}
+
+	hook.OnWillSent(z2m, offline)
+	if dm.Z2MOnline() {
+		t.Fatal("zigbee2mqtt online after its offline will")
+	}
+	update, _ := dm.StateUpdate("sensor")
+	if update.ConnectionState != "disconnected" || update.ConnectionNote != "zigbee2mqtt is offline" {
+		t.Errorf("connection = %q (%q) while zigbee2mqtt is offline", update.ConnectionState, update.ConnectionNote)
+	}
+
+	if _, err := hook.OnPublish(z2m, online); err != nil {
+		t.Fatal(err)
+	}
+	if !dm.Z2MOnline() {
+		t.Fatal("zigbee2mqtt offline after reconnecting")
+	}
+
+	// Taking over the session is zigbee2mqtt reconnecting, not leaving.
+	hook.OnDisconnect(z2m, packets.ErrSessionTakenOver, false)
+	if !dm.Z2MOnline() {
+		t.Fatal("session takeover took zigbee2mqtt offline")
+	}
+
+	// Other clients leaving does not matter.
+	hook.OnDisconnect(&mqtt.Client{ID: "mqtt-explorer"}, io.EOF, false)
+	if !dm.Z2MOnline() {
+		t.Fatal("another client disconnecting took zigbee2mqtt offline")
+	}
+
+	// Without a will, zigbee2mqtt disconnecting still takes it offline.
+	hook.OnDisconnect(z2m, io.EOF, false)
+	if dm.Z2MOnline() {
+		t.Error("zigbee2mqtt online after disconnecting")
+	}
+}
@@ -0,0 +1,310 @@
+package z2mhomekit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+const (
+	mqttDialTimeout  = 10 * time.Second
+	mqttWriteTimeout = 10 * time.Second
+
+	// mqttMaxPacketSize bounds packets read from an external broker;
+	// zigbee2mqtt/bridge/devices is the largest message expected.
+	mqttMaxPacketSize = 16 << 20
+
+	// mqttProtocolVersion is MQTT 3.1.1.
+	mqttProtocolVersion = 4
+)
+
+// externalMQTTTopics are the filters subscribed to on an external broker.
+var externalMQTTTopics = []string{"zigbee2mqtt/#", CommandTopicPrefix + "#"}
+
+var errMQTTNotConnected = errors.New("not connected to MQTT broker")
+
+// ExternalMQTTOptions configures the connection to an external broker.
+type ExternalMQTTOptions struct {
+	Addr      string // host:port
+	ClientID  string
+	Username  string
+	Password  string
+	Keepalive time.Duration
+}
+
+// ExternalMQTT connects to an MQTT broker the bridge does not run, such as
+// the mosquitto instance zigbee2mqtt already talks to, in place of the
+// embedded broker. It speaks MQTT 3.1.1 at QoS 0: messages on the
+// zigbee2mqtt and command topics are handed to the same handling as the
+// embedded broker's hook, and commands and mirrored state are published
+// back to the broker.
+type ExternalMQTT struct {
+	opts   ExternalMQTTOptions
+	logger *slog.Logger
+
+	mu   sync.Mutex // guards conn and serializes writes to it
+	conn net.Conn   // nil while disconnected
+}
+
+// NewExternalMQTT returns a client for the broker in opts. Call Run to
+// connect.
+func NewExternalMQTT(opts ExternalMQTTOptions, logger *slog.Logger) *ExternalMQTT {
+	return &ExternalMQTT{
+		opts:   opts,
+		logger: logger,
+	}
+}
+
+// Run connects, subscribes and passes received messages to handle until
+// ctx is cancelled or the connection is lost. up is called once
+// subscribed. Run returns an error for a lost connection so a supervisor
+// can reconnect; rejected credentials are permanent.
+func (c *ExternalMQTT) Run(ctx context.Context, handle func(topic string, payload []byte), up func()) error {
+	dialer := net.Dialer{Timeout: mqttDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", c.opts.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MQTT broker %s: %w", c.opts.Addr, err)
+	}
+	defer conn.Close()
+
+	// Closing the connection unblocks the reads below.
+	stop := context.AfterFunc(ctx, func() { c.disconnect(conn) })
+	defer stop()
+
+	r := bufio.NewReader(conn)
+	if err := c.handshake(conn, r, handle); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+	}()
+
+	c.logger.Info("Connected to MQTT broker", "addr", c.opts.Addr, "client_id", c.opts.ClientID)
+	up()
+
+	done := make(chan struct{})
+	defer close(done)
+	go c.ping(conn, done)
+
+	for {
+		// The broker answers pings, so silence for longer than the
+		// keepalive means the connection is gone.
+		_ = conn.SetReadDeadline(time.Now().Add(c.opts.Keepalive * 3 / 2))
+		pk, err := readMQTTPacket(r)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("lost connection to MQTT broker %s: %w", c.opts.Addr, err)
+		}
+		if pk.FixedHeader.Type == packets.Publish {
+			handle(pk.TopicName, pk.Payload)
+		}
+	}
+}
+
+// Publish sends a message to the broker. Messages are sent at QoS 0
+// whatever qos asks for.
+func (c *ExternalMQTT) Publish(topic string, payload []byte, retain bool, qos byte) error {
+	pk := packets.Packet{
+		FixedHeader:     packets.FixedHeader{Type: packets.Publish, Retain: retain},
+		ProtocolVersion: mqttProtocolVersion,
+		TopicName:       topic,
+		Payload:         payload,
+	}
+	var buf bytes.Buffer
+	if err := pk.PublishEncode(&buf); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return errMQTTNotConnected
+	}
+	return writeMQTT(c.conn, buf.Bytes())
+}
+
+// Connected reports whether the client is connected and subscribed.
+func (c *ExternalMQTT) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
+}
+
+// handshake sends CONNECT and SUBSCRIBE and waits for the broker to
+// accept both.
+func (c *ExternalMQTT) handshake(conn net.Conn, r *bufio.Reader, handle func(topic string, payload []byte)) error {
+	_ = conn.SetReadDeadline(time.Now().Add(mqttDialTimeout))
+
+	connect := packets.Packet{
+		FixedHeader:     packets.FixedHeader{Type: packets.Connect},
+		ProtocolVersion: mqttProtocolVersion,
+		Connect: packets.ConnectParams{
+			ProtocolName:     []byte("MQTT"),
+			ClientIdentifier: c.opts.ClientID,
+			Keepalive:        uint16(c.opts.Keepalive / time.Second),
+			Clean:            true,
+			Username:         []byte(c.opts.Username),
+			UsernameFlag:     c.opts.Username != "",
+			Password:         []byte(c.opts.Password),
+			PasswordFlag:     c.opts.Password != "",
+		},
+	}
+	var buf bytes.Buffer
+	if err := connect.ConnectEncode(&buf); err != nil {
+		return err
+	}
+	if err := writeMQTT(conn, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to send MQTT connect: %w", err)
+	}
+
+	connack, err := readMQTTPacket(r)
+	if err != nil {
+		return fmt.Errorf("failed to read MQTT connack: %w", err)
+	}
+	if connack.FixedHeader.Type != packets.Connack {
+		return fmt.Errorf("MQTT broker sent %s instead of connack", packets.PacketNames[connack.FixedHeader.Type])
+	}
+	switch connack.ReasonCode {
+	case 0:
+	case 4, 5: // bad user name or password, not authorized
+		return permanent(fmt.Errorf("MQTT broker %s refused the connection: code %d", c.opts.Addr, connack.ReasonCode))
+	default:
+		return fmt.Errorf("MQTT broker %s refused the connection: code %d", c.opts.Addr, connack.ReasonCode)
+	}
+
+	subscribe := packets.Packet{
+		FixedHeader:     packets.FixedHeader{Type: packets.Subscribe, Qos: 1},
+		ProtocolVersion: mqttProtocolVersion,
+		PacketID:        1,
+	}
+	for _, filter := range externalMQTTTopics {
+		subscribe.Filters = append(subscribe.Filters, packets.Subscription{Filter: filter})
+	}
+	buf.Reset()
+	if err := subscribe.SubscribeEncode(&buf); err != nil {
+		return err
+	}
+	if err := writeMQTT(conn, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to send MQTT subscribe: %w", err)
+	}
+
+	for {
+		suback, err := readMQTTPacket(r)
+		if err != nil {
+			return fmt.Errorf("failed to read MQTT suback: %w", err)
+		}
+		// Retained messages may arrive before the suback.
+		if suback.FixedHeader.Type == packets.Publish {
+			handle(suback.TopicName, suback.Payload)
+			continue
+		}
+		if suback.FixedHeader.Type != packets.Suback {
+			continue
+		}
+		for i, code := range suback.ReasonCodes {
+			if code >= 0x80 && i < len(externalMQTTTopics) {
+				return permanent(fmt.Errorf("MQTT broker %s refused subscription to %s", c.opts.Addr, externalMQTTTopics[i]))
+			}
+		}
+		return nil
+	}
+}
+
+// ping sends PINGREQ every keepalive until done is closed.
+func (c *ExternalMQTT) ping(conn net.Conn, done <-chan struct{}) {
+	pingreq := packets.Packet{FixedHeader: packets.FixedHeader{Type: packets.Pingreq}}
+	var buf bytes.Buffer
+	_ = pingreq.PingreqEncode(&buf)
+
+	ticker := time.NewTicker(c.opts.Keepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			err := writeMQTT(conn, buf.Bytes())
+			c.mu.Unlock()
+			if err != nil {
+				// The read deadline notices the dead connection.
+				c.logger.Debug("Failed to ping MQTT broker", "error", err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// disconnect tells the broker the client is leaving and closes conn.
+func (c *ExternalMQTT) disconnect(conn net.Conn) {
+	pk := packets.Packet{FixedHeader: packets.FixedHeader{Type: packets.Disconnect}, ProtocolVersion: mqttProtocolVersion}
+	var buf bytes.Buffer
+	if err := pk.DisconnectEncode(&buf); err == nil {
+		c.mu.Lock()
+		_ = writeMQTT(conn, buf.Bytes())
+		c.mu.Unlock()
+	}
+	_ = conn.Close()
+}
+
+func writeMQTT(conn net.Conn, data []byte) error {
+	_ = conn.SetWriteDeadline(time.Now().Add(mqttWriteTimeout))
+	_, err := conn.Write(data)
+	return err
+}
+
+// readMQTTPacket reads one packet, decoding the packet types the client
+// expects from a broker.
+func readMQTTPacket(r *bufio.Reader) (packets.Packet, error) {
+	pk := packets.Packet{ProtocolVersion: mqttProtocolVersion}
+
+	hb, err := r.ReadByte()
+	if err != nil {
+		return pk, err
+	}
+	if err := pk.FixedHeader.Decode(hb); err != nil {
+		return pk, err
+	}
+	n, _, err := packets.DecodeLength(r)
+	if err != nil {
+		return pk, err
+	}
+	if n > mqttMaxPacketSize {
+		return pk, fmt.Errorf("MQTT packet of %d bytes exceeds %d", n, mqttMaxPacketSize)
+	}
+	pk.FixedHeader.Remaining = n
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return pk, err
+	}
+
+	switch pk.FixedHeader.Type {
+	case packets.Connack:
+		err = pk.ConnackDecode(buf)
+	case packets.Publish:
+		err = pk.PublishDecode(buf)
+	case packets.Suback:
+		err = pk.SubackDecode(buf)
+	}
+	return pk, err
+}
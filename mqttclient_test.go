@@ -0,0 +1,155 @@
+package z2mhomekit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+// startTestBroker runs a broker standing in for an external mosquitto. It
+// returns the broker, its address and a func stopping it.
+func startTestBroker(t *testing.T) (*mqtt.Server, string, func()) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	server := mqtt.New(&mqtt.Options{InlineClient: true, Logger: testLogger()})
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.AddListener(listeners.NewTCP(listeners.Config{ID: "tcp", Address: addr})); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	stop := sync.OnceFunc(func() { _ = server.Close() })
+	t.Cleanup(stop)
+	return server, addr, stop
+}
+
+func TestExternalMQTT(t *testing.T) {
+	server, addr, _ := startTestBroker(t)
+	if err := server.Publish("zigbee2mqtt/bridge/state", []byte(`{"state":"online"}`), true, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewExternalMQTT(ExternalMQTTOptions{Addr: addr, ClientID: "test", Keepalive: time.Minute}, testLogger())
+	if err := client.Publish("zigbee2mqtt/lamp/set", []byte(`{}`), false, 0); !errors.Is(err, errMQTTNotConnected) {
+		t.Errorf("Publish() before connecting = %v, want errMQTTNotConnected", err)
+	}
+
+	type message struct{ topic, payload string }
+	received := make(chan message, 10)
+	up := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Run(ctx, func(topic string, payload []byte) {
+			received <- message{topic, string(payload)}
+		}, func() { close(up) })
+	}()
+
+	select {
+	case <-up:
+	case err := <-done:
+		t.Fatalf("Run() = %v before connecting", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not connect")
+	}
+
+	next := func() message {
+		t.Helper()
+		select {
+		case m := <-received:
+			return m
+		case <-time.After(5 * time.Second):
+			t.Fatal("no message received")
+			return message{}
+		}
+	}
+	if m := next(); m.topic != "zigbee2mqtt/bridge/state" {
+		t.Errorf("first message = %+v, want the retained bridge state", m)
+	}
+
+	if err := server.Publish("other/topic", []byte("ignored"), false, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Publish("zigbee2mqtt/lamp", []byte(`{"state":"ON"}`), false, 0); err != nil {
+		t.Fatal(err)
+	}
+	if m := next(); m != (message{"zigbee2mqtt/lamp", `{"state":"ON"}`}) {
+		t.Errorf("message = %+v, want the lamp state", m)
+	}
+
+	published := make(chan packets.Packet, 1)
+	if err := server.Subscribe("zigbee2mqtt/+/set", 1, func(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+		published <- pk
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Publish("zigbee2mqtt/lamp/set", []byte(`{"state":"OFF"}`), false, 0); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	select {
+	case pk := <-published:
+		if string(pk.Payload) != `{"state":"OFF"}` {
+			t.Errorf("broker received %q", pk.Payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("broker did not receive the command")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Run() after cancel = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after cancel")
+	}
+	if client.Connected() {
+		t.Error("client still connected after Run returned")
+	}
+}
+
+func TestExternalMQTTConnectionLost(t *testing.T) {
+	_, addr, stopBroker := startTestBroker(t)
+
+	client := NewExternalMQTT(ExternalMQTTOptions{Addr: addr, ClientID: "test", Keepalive: time.Minute}, testLogger())
+	up := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Run(context.Background(), func(string, []byte) {}, func() { close(up) })
+	}()
+	select {
+	case <-up:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not connect")
+	}
+
+	stopBroker()
+	select {
+	case err := <-done:
+		var perm *permanentError
+		if err == nil || errors.As(err, &perm) {
+			t.Errorf("Run() after broker stopped = %v, want an error the supervisor retries", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after the broker stopped")
+	}
+}
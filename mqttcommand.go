@@ -0,0 +1,124 @@
+package z2mhomekit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+// CommandTopicPrefix is the topic prefix commands are accepted on, as
+// z2m-homekit/command/<deviceID>.
+const CommandTopicPrefix = "z2m-homekit/command/"
+
+// mqttCommand is the payload accepted on command topics. It uses the same
+// normalized schema as the mirrored state: brightness, saturation, fan
+// speed, and cover position are 0-100, hue 0-360 and color_temp in mireds.
+// arm_mode is stay, away, night or disarmed.
+type mqttCommand struct {
+	On         *bool    `json:"on"`
+	Brightness *int     `json:"brightness"`
+	Hue        *float64 `json:"hue"`
+	Saturation *float64 `json:"saturation"`
+	ColorTemp  *int     `json:"color_temp"`
+	FanSpeed   *int     `json:"fan_speed"`
+	Position   *int     `json:"position"`
+	ArmMode    *string  `json:"arm_mode"`
+	Siren      *bool    `json:"siren"`
+}
+
+// parseMQTTCommand turns a command payload into a command for device,
+// checking that the device supports what is asked of it.
+func parseMQTTCommand(device devices.Device, payload []byte) (devices.CommandEvent, error) {
+	var msg mqttCommand
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return devices.CommandEvent{}, fmt.Errorf("invalid command payload: %w", err)
+	}
+	return msg.command(device)
+}
+
+// command turns msg into a command for device, checking that the device
+// supports what is asked of it. The JSON API validates its requests the
+// same way.
+func (msg mqttCommand) command(device devices.Device) (devices.CommandEvent, error) {
+	cmd := devices.CommandEvent{
+		DeviceID:   device.ID,
+		On:         msg.On,
+		Brightness: msg.Brightness,
+		Hue:        msg.Hue,
+		Saturation: msg.Saturation,
+		ColorTemp:  msg.ColorTemp,
+		FanSpeed:   msg.FanSpeed,
+		Position:   msg.Position,
+		Siren:      msg.Siren,
+	}
+	if msg.ArmMode != nil {
+		mode, err := devices.ParseArmMode(*msg.ArmMode)
+		if err != nil {
+			return cmd, err
+		}
+		cmd.ArmMode = &mode
+	}
+
+	light := device.Type == devices.DeviceTypeLightbulb
+	switch {
+	case msg == (mqttCommand{}):
+		return cmd, errors.New("command sets nothing")
+	case msg.On != nil && !isControllable(device.Type):
+		return cmd, fmt.Errorf("%s devices cannot be switched", device.Type)
+	case (msg.Brightness != nil || msg.Hue != nil || msg.Saturation != nil || msg.ColorTemp != nil) && !light:
+		return cmd, errors.New("brightness and color are only supported on lights")
+	case msg.FanSpeed != nil && device.Type != devices.DeviceTypeFan:
+		return cmd, errors.New("fan_speed is only supported on fans")
+	case msg.Position != nil && device.Type != devices.DeviceTypeCover:
+		return cmd, errors.New("position is only supported on covers")
+	case msg.ArmMode != nil && device.Type != devices.DeviceTypeSecuritySystem:
+		return cmd, errors.New("arm_mode is only supported on security systems")
+	case msg.Siren != nil && !hasSiren(device):
+		return cmd, errors.New("siren is only supported on security systems with a siren")
+	case (msg.Hue == nil) != (msg.Saturation == nil):
+		return cmd, errors.New("hue and saturation must be set together")
+	case msg.Brightness != nil && (*msg.Brightness < 0 || *msg.Brightness > 100):
+		return cmd, fmt.Errorf("brightness must be between 0 and 100, got %d", *msg.Brightness)
+	case msg.Hue != nil && (*msg.Hue < 0 || *msg.Hue > 360):
+		return cmd, fmt.Errorf("hue must be between 0 and 360, got %g", *msg.Hue)
+	case msg.Saturation != nil && (*msg.Saturation < 0 || *msg.Saturation > 100):
+		return cmd, fmt.Errorf("saturation must be between 0 and 100, got %g", *msg.Saturation)
+	case msg.ColorTemp != nil && *msg.ColorTemp <= 0:
+		return cmd, fmt.Errorf("color_temp must be positive, got %d", *msg.ColorTemp)
+	case msg.FanSpeed != nil && (*msg.FanSpeed < 0 || *msg.FanSpeed > 100):
+		return cmd, fmt.Errorf("fan_speed must be between 0 and 100, got %d", *msg.FanSpeed)
+	case msg.Position != nil && (*msg.Position < 0 || *msg.Position > 100):
+		return cmd, fmt.Errorf("position must be between 0 and 100, got %d", *msg.Position)
+	}
+
+	return cmd, nil
+}
+
+// hasSiren reports whether device is a security system that can sound a
+// siren.
+func hasSiren(device devices.Device) bool {
+	return device.Type == devices.DeviceTypeSecuritySystem && (device.Features.Siren || device.Features.Alarm)
+}
+
+// handleCommand accepts a command published to z2m-homekit/command/<id>.
+func (h *MQTTHook) handleCommand(deviceID string, payload []byte) {
+	device, _, ok := h.deviceManager.Device(deviceID)
+	if !ok {
+		h.logger.Warn("MQTT command for unknown device", "device_id", deviceID)
+		return
+	}
+
+	cmd, err := parseMQTTCommand(device, payload)
+	if err != nil {
+		h.logger.Warn("Rejected MQTT command", "device_id", deviceID, "error", err)
+		return
+	}
+
+	if err := h.deviceManager.SubmitCommand(cmd); err != nil {
+		h.logger.Warn("Failed to queue MQTT command", "device_id", deviceID, "error", err)
+		return
+	}
+	h.logger.Info("MQTT command received", "device_id", deviceID)
+}
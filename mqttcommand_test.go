@@ -0,0 +1,87 @@
+package z2mhomekit
+
+import (
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/devices"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+func TestParseMQTTCommand(t *testing.T) {
+	lamp := devices.Device{ID: "lamp", Type: devices.DeviceTypeLightbulb}
+	plug := devices.Device{ID: "plug", Type: devices.DeviceTypeOutlet}
+	fan := devices.Device{ID: "fan", Type: devices.DeviceTypeFan}
+	sensor := devices.Device{ID: "temp", Type: devices.DeviceTypeClimateSensor}
+	blind := devices.Device{ID: "blind", Type: devices.DeviceTypeCover}
+	siren := devices.Device{ID: "siren", Type: devices.DeviceTypeSecuritySystem, Features: devices.DeviceFeatures{Siren: true}}
+	keypad := devices.Device{ID: "keypad", Type: devices.DeviceTypeSecuritySystem, Features: devices.DeviceFeatures{ArmMode: true}}
+
+	tests := []struct {
+		name    string
+		device  devices.Device
+		payload string
+		wantErr bool
+	}{
+		{"lamp on", lamp, `{"on":true}`, false},
+		{"lamp brightness", lamp, `{"brightness":40}`, false},
+		{"lamp color", lamp, `{"hue":120,"saturation":80}`, false},
+		{"lamp color temp", lamp, `{"color_temp":300}`, false},
+		{"plug off", plug, `{"on":false}`, false},
+		{"fan speed", fan, `{"fan_speed":50}`, false},
+		{"empty", lamp, `{}`, true},
+		{"not json", lamp, `on`, true},
+		{"switch sensor", sensor, `{"on":true}`, true},
+		{"dim plug", plug, `{"brightness":40}`, true},
+		{"hue only", lamp, `{"hue":120}`, true},
+		{"brightness range", lamp, `{"brightness":254}`, true},
+		{"fan speed on lamp", lamp, `{"fan_speed":50}`, true},
+		{"cover position", blind, `{"position":30}`, false},
+		{"position on lamp", lamp, `{"position":30}`, true},
+		{"position range", blind, `{"position":101}`, true},
+		{"arm keypad", keypad, `{"arm_mode":"away"}`, false},
+		{"invalid arm mode", keypad, `{"arm_mode":"armed"}`, true},
+		{"arm lamp", lamp, `{"arm_mode":"away"}`, true},
+		{"sound siren", siren, `{"siren":true}`, false},
+		{"siren on keypad", keypad, `{"siren":true}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := parseMQTTCommand(tt.device, []byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMQTTCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cmd.DeviceID != tt.device.ID {
+				t.Errorf("DeviceID = %q", cmd.DeviceID)
+			}
+		})
+	}
+}
+
+func TestMQTTHookCommandTopic(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	commands := make(chan devices.CommandEvent, 2)
+	manager := newTestDeviceManager(t, bus, []devices.Device{
+		{ID: "lamp", Name: "Lamp", Topic: "lamp", Type: devices.DeviceTypeLightbulb},
+	}, commands)
+	hook := &MQTTHook{deviceManager: manager, logger: logger}
+
+	for _, payload := range []string{`{"on":true,"brightness":30}`, `{"brightness":300}`} {
+		if _, err := hook.OnPublish(nil, packets.Packet{
+			TopicName: CommandTopicPrefix + "lamp",
+			Payload:   []byte(payload),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(commands) != 1 {
+		t.Fatalf("queued %d commands, want 1 valid command", len(commands))
+	}
+	cmd := <-commands
+	if cmd.DeviceID != "lamp" || cmd.On == nil || !*cmd.On || cmd.Brightness == nil || *cmd.Brightness != 30 {
+		t.Errorf("queued command = %+v", cmd)
+	}
+}
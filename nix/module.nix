@@ -207,6 +207,7 @@ in
             Z2M_HOMEKIT_LOG_FORMAT = cfg.log.format;
             Z2M_HOMEKIT_TS_HOSTNAME = cfg.tailscale.hostname;
             Z2M_HOMEKIT_TS_STATE_DIR = tailscaleDir;
+            Z2M_HOMEKIT_TOKENS_PATH = "${cfg.dataDir}/tokens.json";
           }
           // (optionalAttrs (cfg.bridgeName != null) {
             Z2M_HOMEKIT_BRIDGE_NAME = cfg.bridgeName;
@@ -0,0 +1,540 @@
+package z2mhomekit
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/chasefleming/elem-go"
+	"github.com/chasefleming/elem-go/attrs"
+	"github.com/kradalby/z2m-homekit/devices"
+	"github.com/kradalby/z2m-homekit/events"
+	"github.com/kradalby/z2m-homekit/tokens"
+)
+
+// swaggerUIVersion is the swagger-ui-dist release the docs page loads.
+const swaggerUIVersion = "5.17.14"
+
+// apiParam is a form field or path parameter of an API route.
+type apiParam struct {
+	Name        string
+	Type        string // OpenAPI type, e.g. string or boolean
+	Required    bool
+	Enum        []string
+	Description string
+}
+
+// apiRoute describes a JSON API route for the OpenAPI document. Response
+// is a value of the JSON response type, nil when the route returns no
+// body; Body is likewise the JSON request body type.
+type apiRoute struct {
+	Method      string
+	Path        string // OpenAPI form, e.g. /api/v1/alert/ack/{id}
+	Scope       tokens.Scope
+	Summary     string
+	Form        []apiParam
+	Query       []apiParam
+	Body        any
+	Response    any
+	Status      int
+	ContentType string // defaults to application/json
+	Errors      map[int]string
+}
+
+var deviceCommandErrors = map[int]string{
+	http.StatusBadRequest: "Invalid value, or not supported by the device",
+	http.StatusNotFound:   "Unknown device",
+	http.StatusConflict:   "Valve locked after a leak, or device disabled",
+}
+
+var deviceIDParam = apiParam{Name: "id", Type: "string", Required: true, Description: "Device ID"}
+
+// apiRoutes lists the JSON API. TestAPIRoutesDocumented checks it against
+// the routes registered in Bridge.registerWebRoutes.
+var apiRoutes = []apiRoute{
+	{
+		Method: http.MethodGet, Path: "/health",
+		Summary:  "Health summary",
+		Response: HealthResponse{},
+	},
+	{
+		Method: http.MethodGet, Path: "/events",
+		Summary:     "Stream device state updates as server-sent events. Each data line is a StateUpdate; send Last-Event-ID to resume.",
+		Response:    events.StateUpdateEvent{},
+		ContentType: "text/event-stream",
+	},
+	{
+		Method: http.MethodGet, Path: "/ws", Scope: tokens.ScopeControl,
+		Summary:     "WebSocket streaming device state like /events, as messages of type state. Send commands as {\"id\", \"device\", ...} with the fields of an MQTT command; each is answered with a message of type result. Browsers signed in to the web UI may connect without a token, from pages on this host only.",
+		Response:    WebSocketMessage{},
+		Status:      http.StatusSwitchingProtocols,
+		ContentType: "application/json",
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/status", Scope: tokens.ScopeRead,
+		Summary:  "Bridge status",
+		Response: BridgeStatus{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/devices", Scope: tokens.ScopeRead,
+		Summary:  "Devices available on the web, with their latest state",
+		Query:    []apiParam{{Name: "q", Type: "string", Description: "Only devices whose ID, name, room, tags, location, purchase date or notes contain this"}},
+		Response: []DeviceResponse{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/devices/{id}", Scope: tokens.ScopeRead,
+		Summary:  "A device and its latest state",
+		Response: DeviceResponse{},
+		Errors:   map[int]string{http.StatusNotFound: "Unknown device"},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/v1/devices/{id}/power", Scope: tokens.ScopeControl,
+		Summary: "Switch a device on or off",
+		Form:    []apiParam{{Name: "on", Type: "boolean", Required: true}},
+		Status:  http.StatusNoContent,
+		Errors:  deviceCommandErrors,
+	},
+	{
+		Method: http.MethodPost, Path: "/api/v1/devices/{id}/brightness", Scope: tokens.ScopeControl,
+		Summary: "Set a light's brightness",
+		Form:    []apiParam{{Name: "brightness", Type: "integer", Required: true, Description: "0-100"}},
+		Status:  http.StatusNoContent,
+		Errors:  deviceCommandErrors,
+	},
+	{
+		Method: http.MethodPost, Path: "/api/v1/devices/{id}/color", Scope: tokens.ScopeControl,
+		Summary: "Set a light's color, as hue and saturation or as a color temperature",
+		Form: []apiParam{
+			{Name: "hue", Type: "number", Description: "0-360, with saturation"},
+			{Name: "saturation", Type: "number", Description: "0-100, with hue"},
+			{Name: "color_temp", Type: "integer", Description: "Mireds, instead of hue and saturation"},
+		},
+		Status: http.StatusNoContent,
+		Errors: deviceCommandErrors,
+	},
+	{
+		Method: http.MethodPost, Path: "/api/v1/devices/{id}/position", Scope: tokens.ScopeControl,
+		Summary: "Move a cover",
+		Form:    []apiParam{{Name: "position", Type: "integer", Required: true, Description: "0 (closed) to 100 (open)"}},
+		Status:  http.StatusNoContent,
+		Errors:  deviceCommandErrors,
+	},
+	{
+		Method: http.MethodPost, Path: "/api/v1/devices/{id}/arm", Scope: tokens.ScopeControl,
+		Summary: "Arm or disarm a security system",
+		Form:    []apiParam{{Name: "mode", Type: "string", Required: true, Enum: []string{"stay", "away", "night", "disarmed"}}},
+		Status:  http.StatusNoContent,
+		Errors:  deviceCommandErrors,
+	},
+	{
+		Method: http.MethodPost, Path: "/api/v1/devices/{id}/siren", Scope: tokens.ScopeControl,
+		Summary: "Sound or silence a security system's siren",
+		Form:    []apiParam{{Name: "on", Type: "boolean", Required: true}},
+		Status:  http.StatusNoContent,
+		Errors:  deviceCommandErrors,
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/events/replay", Scope: tokens.ScopeRead,
+		Summary: "Journalled zigbee2mqtt messages for a device as NDJSON, optionally replayed through a test sink",
+		Query: []apiParam{
+			{Name: "device", Type: "string", Required: true, Description: "Device ID"},
+			{Name: "since", Type: "string", Description: "RFC 3339 time or duration back from now; defaults to 1h"},
+			{Name: "sink", Type: "string", Enum: []string{"test"}, Description: "test replays the messages and adds the resulting state"},
+		},
+		Response:    ReplayStep{},
+		ContentType: "application/x-ndjson",
+		Errors:      map[int]string{http.StatusBadRequest: "Invalid since or sink", http.StatusNotFound: "Unknown device or journal disabled"},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/history", Scope: tokens.ScopeRead,
+		Summary: "Recorded temperature, humidity, power and on/off values of a device",
+		Query: []apiParam{
+			{Name: "device", Type: "string", Required: true, Description: "Device ID"},
+			{Name: "metric", Type: "string", Enum: historyMetrics, Description: "Only this metric; defaults to all"},
+			{Name: "since", Type: "string", Description: "RFC 3339 time or duration back from now; defaults to 24h"},
+			{Name: "until", Type: "string", Description: "RFC 3339 time or duration back from now; defaults to now"},
+		},
+		Response: HistoryResponse{},
+		Errors:   map[int]string{http.StatusBadRequest: "Invalid metric, since or until", http.StatusNotFound: "Unknown device or history disabled"},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/scenes", Scope: tokens.ScopeRead,
+		Summary:  "Scenes from the devices config and saved from the web UI",
+		Response: []devices.Scene{},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/v1/scenes/{id}/recall", Scope: tokens.ScopeControl,
+		Summary: "Set every device of a scene to its saved state",
+		Status:  http.StatusNoContent,
+		Errors:  map[int]string{http.StatusNotFound: "Unknown scene", http.StatusConflict: "A device of the scene is no longer configured"},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/inventory", Scope: tokens.ScopeRead,
+		Summary:  "Devices by model with the battery each takes and its level, and the batteries in use by type. With format=csv, one CSV row per device.",
+		Query:    []apiParam{{Name: "format", Type: "string", Enum: []string{"csv"}, Description: "csv for a spreadsheet instead of JSON"}},
+		Response: devices.Inventory{},
+		Errors:   map[int]string{http.StatusBadRequest: "Invalid format"},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/capabilities", Scope: tokens.ScopeRead,
+		Summary:  "Exposed accessories and the operations for each device",
+		Response: Capabilities{},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/v1/config/apply", Scope: tokens.ScopeAdmin,
+		Summary:  "Replace the devices config, returning the devices added, removed and changed and the HomeKit impact. With dry_run nothing is applied.",
+		Query:    []apiParam{{Name: "dry_run", Type: "boolean", Description: "Only return what would change"}},
+		Body:     devices.Config{},
+		Response: ConfigPlanResponse{},
+		Errors:   map[int]string{http.StatusBadRequest: "Invalid devices config"},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/openapi.json", Scope: tokens.ScopeRead,
+		Summary:  "This document",
+		Response: map[string]any{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/nightmode", Scope: tokens.ScopeControl,
+		Summary:  "Night mode state",
+		Response: NightModeResponse{},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/v1/nightmode", Scope: tokens.ScopeControl,
+		Summary:  "Switch night mode until the schedule next changes",
+		Form:     []apiParam{{Name: "on", Type: "boolean", Required: true}},
+		Response: NightModeResponse{},
+		Errors:   map[int]string{http.StatusBadRequest: "Invalid on value", http.StatusConflict: "Night mode is not configured"},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/permitjoin", Scope: tokens.ScopeControl,
+		Summary:  "Whether the Zigbee network is open for new devices",
+		Response: PermitJoinResponse{},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/v1/permitjoin", Scope: tokens.ScopeControl,
+		Summary:  "Open the Zigbee network for new devices for seconds (up to 254), or close it with 0",
+		Form:     []apiParam{{Name: "seconds", Type: "integer", Required: true}},
+		Response: PermitJoinResponse{},
+		Errors:   map[int]string{http.StatusBadRequest: "Invalid seconds", http.StatusConflict: "zigbee2mqtt is offline"},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/v1/alert/ack/{id}", Scope: tokens.ScopeControl,
+		Summary:  "Acknowledge a sensor's active alert, silencing repeats",
+		Response: AlertAckResponse{},
+		Errors:   map[int]string{http.StatusNotFound: "Unknown device", http.StatusConflict: "No active alert"},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/v1/leak/ack/{id}", Scope: tokens.ScopeControl,
+		Summary: "Acknowledge a leak and unlock its shutoff valves",
+		Status:  http.StatusNoContent,
+		Errors:  map[int]string{http.StatusNotFound: "Unknown device", http.StatusConflict: "Leak still detected"},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/v1/disable/{id}", Scope: tokens.ScopeControl,
+		Summary: "Disable a device, refusing its commands and ignoring its reports, or enable it again",
+		Form:    []apiParam{{Name: "disabled", Type: "boolean", Required: true}},
+		Status:  http.StatusNoContent,
+		Errors:  map[int]string{http.StatusBadRequest: "Invalid disabled value", http.StatusNotFound: "Unknown device"},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/v1/ota/{id}", Scope: tokens.ScopeControl,
+		Summary: "Start an OTA firmware update of a device; progress is reported in its state updates",
+		Status:  http.StatusAccepted,
+		Errors:  map[int]string{http.StatusNotFound: "Unknown device", http.StatusConflict: "Device disabled, zigbee2mqtt offline or an update already running"},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/v1/smoke/drill", Scope: tokens.ScopeControl,
+		Summary:  "Run the smoke response plan as a drill",
+		Form:     []apiParam{{Name: "live", Type: "boolean", Description: "Send the commands rather than only reporting them"}},
+		Response: SmokeDrillResponse{},
+		Errors:   map[int]string{http.StatusConflict: "No smoke response configured"},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/v1/testfire/{id}", Scope: tokens.ScopeControl,
+		Summary:  "Test-fire a leak, smoke or contact sensor: run its alert and response plan, labelled as a test, and reset after the duration",
+		Form:     []apiParam{{Name: "duration", Type: "string", Description: "How long the test lasts, e.g. 30s (default) up to 5m"}},
+		Response: devices.TestFire{},
+		Errors:   map[int]string{http.StatusBadRequest: "Not an alerting sensor or invalid duration", http.StatusNotFound: "Unknown device", http.StatusConflict: "Test already running or sensor raising a real alert"},
+	},
+	{
+		Method: http.MethodPost, Path: "/api/v1/calibrate/{id}", Scope: tokens.ScopeControl,
+		Summary:  "Send a calibration step to a curtain or roller cover; it is confirmed once the cover reports the requested state",
+		Form:     []apiParam{{Name: "action", Type: "string", Required: true, Enum: []string{"reverse", "limit_open", "limit_close", "start", "stop"}, Description: "Calibration step; start and stop calibrate the travel time"}},
+		Response: devices.Calibration{},
+		Errors:   map[int]string{http.StatusBadRequest: "Not a cover or invalid action", http.StatusNotFound: "Unknown device"},
+	},
+}
+
+// openAPISpec generates the OpenAPI 3 document for routes.
+func openAPISpec(routes []apiRoute) map[string]any {
+	schemas := map[string]any{}
+	paths := map[string]map[string]any{}
+
+	for _, route := range routes {
+		op := map[string]any{
+			"summary":     route.Summary,
+			"operationId": operationID(route),
+		}
+
+		var params []map[string]any
+		if strings.Contains(route.Path, "{id}") {
+			params = append(params, map[string]any{
+				"name": deviceIDParam.Name, "in": "path", "required": true,
+				"description": deviceIDParam.Description,
+				"schema":      map[string]any{"type": deviceIDParam.Type},
+			})
+		}
+		for _, p := range route.Query {
+			schema := map[string]any{"type": p.Type}
+			if p.Enum != nil {
+				schema["enum"] = p.Enum
+			}
+			params = append(params, map[string]any{
+				"name": p.Name, "in": "query", "required": p.Required,
+				"description": p.Description, "schema": schema,
+			})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+
+		if len(route.Form) > 0 {
+			props := map[string]any{}
+			var required []string
+			for _, p := range route.Form {
+				schema := map[string]any{"type": p.Type}
+				if p.Enum != nil {
+					schema["enum"] = p.Enum
+				}
+				if p.Description != "" {
+					schema["description"] = p.Description
+				}
+				props[p.Name] = schema
+				if p.Required {
+					required = append(required, p.Name)
+				}
+			}
+			body := map[string]any{"type": "object", "properties": props}
+			if required != nil {
+				body["required"] = required
+			}
+			op["requestBody"] = map[string]any{
+				"required": required != nil,
+				"content": map[string]any{
+					"application/x-www-form-urlencoded": map[string]any{"schema": body},
+				},
+			}
+		}
+
+		if route.Body != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": jsonSchema(reflect.TypeOf(route.Body), schemas)},
+				},
+			}
+		}
+
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		ok := map[string]any{"description": http.StatusText(status)}
+		if route.Response != nil {
+			contentType := route.ContentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			ok["content"] = map[string]any{
+				contentType: map[string]any{"schema": jsonSchema(reflect.TypeOf(route.Response), schemas)},
+			}
+		}
+		responses := map[string]any{fmt.Sprint(status): ok}
+		for code, desc := range route.Errors {
+			responses[fmt.Sprint(code)] = map[string]any{"description": desc}
+		}
+		if route.Scope != "" {
+			op["security"] = []map[string][]string{{"bearerAuth": {}}}
+			op["description"] = fmt.Sprintf("Requires an API token with the %q scope once any token exists.", route.Scope)
+			responses["401"] = map[string]any{"description": "Missing or invalid API token"}
+			responses["403"] = map[string]any{"description": "API token lacks the scope"}
+		}
+		op["responses"] = responses
+
+		if paths[route.Path] == nil {
+			paths[route.Path] = map[string]any{}
+		}
+		paths[route.Path][strings.ToLower(route.Method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "z2m-homekit",
+			"version":     version,
+			"description": "JSON API of the z2m-homekit bridge.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// operationID derives an operation ID from a route, e.g. postAlertAck for
+// POST /api/v1/alert/ack/{id} and getDevicesByID for GET
+// /api/v1/devices/{id}.
+func operationID(route apiRoute) string {
+	id := strings.ToLower(route.Method)
+	path := strings.TrimPrefix(route.Path, "/api/v1")
+	for part := range strings.SplitSeq(path, "/") {
+		if part == "" || strings.HasPrefix(part, "{") {
+			continue
+		}
+		part = strings.TrimSuffix(part, ".json")
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	if strings.HasSuffix(path, "/{id}") && route.Method == http.MethodGet {
+		id += "ByID"
+	}
+	return id
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// jsonSchema returns the schema for t as encoding/json marshals it. Named
+// structs are added to schemas and referenced.
+func jsonSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return jsonSchema(t.Elem(), schemas)
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": jsonSchema(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchema(t.Elem(), schemas)}
+	case reflect.Struct:
+		name := schemaName(t)
+		if name == "" {
+			return structSchema(t, schemas)
+		}
+		if _, ok := schemas[name]; !ok {
+			schemas[name] = map[string]any{} // placeholder for recursive types
+			schemas[name] = structSchema(t, schemas)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+// schemaName names a struct's schema, dropping the Event and Response
+// suffixes that only matter on the Go side.
+func schemaName(t reflect.Type) string {
+	name := strings.TrimSuffix(t.Name(), "Response")
+	return strings.TrimSuffix(name, "Event")
+}
+
+func structSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	props := map[string]any{}
+	var required []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			embedded := structSchema(f.Type, schemas)
+			maps.Copy(props, embedded["properties"].(map[string]any))
+			if req, ok := embedded["required"].([]string); ok {
+				required = append(required, req...)
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = jsonSchema(f.Type, schemas)
+		if !strings.Contains(opts, "omit") && f.Type.Kind() != reflect.Pointer {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]any{"type": "object", "properties": props}
+	if required != nil {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// HandleOpenAPI serves the OpenAPI document for the JSON API.
+func (ws *WebServer) HandleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(openAPISpec(apiRoutes)); err != nil {
+		ws.logger.Error("Failed to encode OpenAPI document", "error", err)
+	}
+}
+
+// HandleAPIDocs renders Swagger UI for the JSON API. The document is
+// inlined so the page works before an API token is entered; use Authorize
+// to try requests with one.
+func (ws *WebServer) HandleAPIDocs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	spec, err := json.Marshal(openAPISpec(apiRoutes))
+	if err != nil {
+		http.Error(w, "Failed to generate OpenAPI document", http.StatusInternalServerError)
+		return
+	}
+
+	dist := "https://unpkg.com/swagger-ui-dist@" + swaggerUIVersion
+	page := elem.Html(attrs.Props{},
+		elem.Head(attrs.Props{},
+			elem.Meta(attrs.Props{attrs.Charset: "utf-8"}),
+			elem.Title(attrs.Props{}, elem.Text("z2m-homekit API")),
+			elem.Link(attrs.Props{attrs.Rel: "stylesheet", attrs.Href: dist + "/swagger-ui.css"}),
+		),
+		elem.Body(attrs.Props{},
+			elem.Div(attrs.Props{attrs.ID: "swagger-ui"}),
+			elem.Script(attrs.Props{attrs.Src: dist + "/swagger-ui-bundle.js"}),
+			elem.Script(attrs.Props{}, elem.Raw(
+				`SwaggerUIBundle({dom_id: "#swagger-ui", spec: `+string(spec)+`});`,
+			)),
+		),
+	)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := fmt.Fprint(w, page.Render()); err != nil {
+		ws.logger.Error("Failed to write API docs", "error", err)
+	}
+}
@@ -0,0 +1,115 @@
+package z2mhomekit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	appconfig "github.com/kradalby/z2m-homekit/config"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	spec := openAPISpec(apiRoutes)
+
+	paths := spec["paths"].(map[string]map[string]any)
+	for _, route := range apiRoutes {
+		if _, ok := paths[route.Path][strings.ToLower(route.Method)]; !ok {
+			t.Errorf("spec is missing %s %s", route.Method, route.Path)
+		}
+	}
+
+	ids := map[string]bool{}
+	for _, route := range apiRoutes {
+		id := operationID(route)
+		if ids[id] {
+			t.Errorf("duplicate operationId %s", id)
+		}
+		ids[id] = true
+	}
+
+	ack := paths["/api/v1/alert/ack/{id}"]["post"].(map[string]any)
+	if ack["operationId"] != "postAlertAck" {
+		t.Errorf("operationId = %v, want postAlertAck", ack["operationId"])
+	}
+	if _, ok := ack["security"]; !ok {
+		t.Error("scoped route has no security requirement")
+	}
+	if _, ok := paths["/health"]["get"].(map[string]any)["security"]; ok {
+		t.Error("/health should not require a token")
+	}
+
+	schemas := spec["components"].(map[string]any)["schemas"].(map[string]any)
+	for _, name := range []string{"BridgeStatus", "AlertAck", "StateUpdate", "AccessoryCapabilities"} {
+		if _, ok := schemas[name]; !ok {
+			t.Errorf("schemas missing %s", name)
+		}
+	}
+
+	ackSchema := schemas["AlertAck"].(map[string]any)["properties"].(map[string]any)
+	if got := ackSchema["acknowledged_at"].(map[string]any)["format"]; got != "date-time" {
+		t.Errorf("acknowledged_at format = %v, want date-time", got)
+	}
+
+	if _, err := json.Marshal(spec); err != nil {
+		t.Fatalf("spec does not marshal: %v", err)
+	}
+}
+
+func TestHandleAPIDocs(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+
+	rec := httptest.NewRecorder()
+	ws.HandleOpenAPI(rec, httptest.NewRequest("GET", "/api/v1/openapi.json", nil))
+	var spec map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if spec["openapi"] != "3.0.3" {
+		t.Errorf("openapi = %v", spec["openapi"])
+	}
+
+	rec = httptest.NewRecorder()
+	ws.HandleAPIDocs(rec, httptest.NewRequest("GET", "/api/docs", nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, "SwaggerUIBundle") || !strings.Contains(body, `"/api/v1/status"`) {
+		t.Errorf("docs page does not embed the spec: %s", body)
+	}
+}
+
+// routeRecorder records the patterns registered on it.
+type routeRecorder struct {
+	patterns []string
+	mux      *http.ServeMux
+}
+
+func (r *routeRecorder) Handle(pattern string, handler http.Handler) {
+	r.patterns = append(r.patterns, pattern)
+	r.mux.Handle(pattern, handler)
+}
+
+func TestAPIRoutesDocumented(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	b := &Bridge{cfg: &appconfig.Config{}}
+	routes := &routeRecorder{mux: http.NewServeMux()}
+	b.registerWebRoutes(ws, routes)
+
+	// Every documented path is served by a route other than the index.
+	documented := map[string]bool{}
+	for _, route := range apiRoutes {
+		path := strings.ReplaceAll(route.Path, "{id}", "x")
+		_, pattern := routes.mux.Handler(httptest.NewRequest(route.Method, path, nil))
+		if pattern == "" || pattern == "/" {
+			t.Errorf("%s %s is documented but not registered", route.Method, route.Path)
+		}
+		documented[pattern] = true
+	}
+
+	// Every API route serves a documented path.
+	for _, pattern := range routes.patterns {
+		if strings.HasPrefix(pattern, "/api/v1/") && !documented[pattern] {
+			t.Errorf("%s is registered but missing from apiRoutes", pattern)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package z2mhomekit
+
+import (
+	"encoding/base64"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// sortCookie remembers the dashboard sort mode.
+	sortCookie = "z2mh_sort"
+	// orderCookie holds the user's drag-and-drop device order.
+	orderCookie = "z2mh_order"
+
+	orderCookieMaxAge = 365 * 24 * time.Hour
+)
+
+func validSortMode(mode string) bool {
+	switch mode {
+	case sortByCustom, sortByID, sortByName, sortByLinkQuality, sortByHealth:
+		return true
+	}
+	return false
+}
+
+// resolveSortMode picks the sort mode from the query, remembering it in a
+// cookie, or falls back to the remembered mode and then custom order.
+func resolveSortMode(w http.ResponseWriter, r *http.Request) string {
+	if mode := r.URL.Query().Get("sort"); validSortMode(mode) {
+		http.SetCookie(w, &http.Cookie{
+			Name:     sortCookie,
+			Value:    mode,
+			Path:     "/",
+			MaxAge:   int(orderCookieMaxAge.Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		return mode
+	}
+	if c, err := r.Cookie(sortCookie); err == nil && validSortMode(c.Value) {
+		return c.Value
+	}
+	return sortByCustom
+}
+
+func encodeOrder(ids []string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(ids, "\n")))
+}
+
+// userOrder returns the device order saved by drag-and-drop, if any.
+func userOrder(r *http.Request) []string {
+	c, err := r.Cookie(orderCookie)
+	if err != nil {
+		return nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(c.Value)
+	if err != nil || len(raw) == 0 {
+		return nil
+	}
+	return strings.Split(string(raw), "\n")
+}
+
+// applyUserOrder moves the devices in order to the front, in that order.
+// The rest keep their relative order, so new devices appear after the
+// arranged ones.
+func applyUserOrder(ids, order []string) []string {
+	if len(order) == 0 {
+		return ids
+	}
+
+	rank := make(map[string]int, len(order))
+	for i, id := range order {
+		if _, dup := rank[id]; !dup {
+			rank[id] = i
+		}
+	}
+
+	sorted := slices.Clone(ids)
+	slices.SortStableFunc(sorted, func(a, b string) int {
+		ra, oka := rank[a]
+		rb, okb := rank[b]
+		switch {
+		case oka && okb:
+			return ra - rb
+		case oka:
+			return -1
+		case okb:
+			return 1
+		}
+		return 0
+	})
+	return sorted
+}
+
+// HandleOrder saves the dashboard device order from drag-and-drop in a
+// cookie. An empty order resets to the configured sort_weight order.
+func (ws *WebServer) HandleOrder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var ids []string
+	for id := range strings.SplitSeq(r.FormValue("order"), ",") {
+		if id == "" {
+			continue
+		}
+		if _, _, ok := ws.deviceProvider.Device(id); !ok {
+			http.Error(w, "Unknown device "+id, http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	cookie := &http.Cookie{
+		Name:     orderCookie,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if len(ids) == 0 {
+		cookie.MaxAge = -1
+	} else {
+		cookie.Value = encodeOrder(ids)
+		cookie.MaxAge = int(orderCookieMaxAge.Seconds())
+	}
+	http.SetCookie(w, cookie)
+
+	http.Redirect(w, r, "/?sort="+sortByCustom, http.StatusSeeOther)
+}
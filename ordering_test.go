@@ -0,0 +1,102 @@
+package z2mhomekit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+func TestCustomSortUsesWeight(t *testing.T) {
+	snapshot := fakeDeviceProvider{
+		"a": {Device: devices.Device{ID: "a", SortWeight: 10}},
+		"b": {Device: devices.Device{ID: "b"}},
+		"c": {Device: devices.Device{ID: "c", SortWeight: -1}},
+		"d": {Device: devices.Device{ID: "d"}},
+	}.Snapshot()
+
+	got := sortedDeviceIDs(snapshot, sortByCustom, "")
+	if want := []string{"c", "b", "d", "a"}; !slices.Equal(got, want) {
+		t.Errorf("custom order = %v, want %v", got, want)
+	}
+	if got := sortedDeviceIDs(snapshot, sortByID, ""); !slices.Equal(got, []string{"a", "b", "c", "d"}) {
+		t.Errorf("id order = %v", got)
+	}
+}
+
+func TestApplyUserOrder(t *testing.T) {
+	got := applyUserOrder([]string{"a", "b", "c", "d"}, []string{"c", "gone", "a"})
+	if want := []string{"c", "a", "b", "d"}; !slices.Equal(got, want) {
+		t.Errorf("applyUserOrder = %v, want %v", got, want)
+	}
+}
+
+func TestHandleOrder(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ws.controller = &fakeController{}
+	ws.deviceProvider = fakeDeviceProvider{
+		"a": {Device: devices.Device{ID: "a", Name: "Alpha"}},
+		"b": {Device: devices.Device{ID: "b", Name: "Bravo"}},
+	}
+
+	post := func(order string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/order", strings.NewReader("order="+order))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		ws.HandleOrder(rec, req)
+		return rec
+	}
+
+	if rec := post("a,missing"); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown device: status %d", rec.Code)
+	}
+
+	rec := post("b,a")
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("status %d", rec.Code)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != orderCookie {
+		t.Fatalf("cookies = %v", cookies)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookies[0])
+	if got := userOrder(req); !slices.Equal(got, []string{"b", "a"}) {
+		t.Errorf("userOrder = %v", got)
+	}
+	rec = httptest.NewRecorder()
+	ws.HandleIndex(rec, req)
+	body := rec.Body.String()
+	if strings.Index(body, "Bravo") > strings.Index(body, "Alpha") {
+		t.Error("saved order not applied to dashboard")
+	}
+	if !strings.Contains(body, "Reset order") {
+		t.Error("reset control missing")
+	}
+
+	if c := post("").Result().Cookies(); len(c) != 1 || c[0].MaxAge >= 0 {
+		t.Errorf("empty order should clear cookie, got %v", c)
+	}
+}
+
+func TestResolveSortModeRemembers(t *testing.T) {
+	rec := httptest.NewRecorder()
+	if mode := resolveSortMode(rec, httptest.NewRequest(http.MethodGet, "/?sort=name", nil)); mode != sortByName {
+		t.Fatalf("mode = %q", mode)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	if mode := resolveSortMode(httptest.NewRecorder(), req); mode != sortByName {
+		t.Errorf("remembered mode = %q", mode)
+	}
+	if mode := resolveSortMode(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?sort=bogus", nil)); mode != sortByCustom {
+		t.Errorf("default mode = %q", mode)
+	}
+}
@@ -0,0 +1,121 @@
+package z2mhomekit
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/chasefleming/elem-go"
+	"github.com/chasefleming/elem-go/attrs"
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+// HandleFirmwareUpdate starts an OTA firmware update of a device. It
+// serves both the web UI (/ota/{id}) and the API (/api/v1/ota/{id}),
+// which answers 202 as the update runs on after the request.
+func (ws *WebServer) HandleFirmwareUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deviceID := path.Base(r.URL.Path)
+	device, _, exists := ws.deviceProvider.Device(deviceID)
+	if !exists || !webEnabled(device) {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	if err := ws.controller.UpdateFirmware(deviceID); err != nil {
+		if errors.Is(err, devices.ErrDeviceDisabled) || errors.Is(err, devices.ErrZ2MOffline) || errors.Is(err, devices.ErrUpdateInProgress) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		ws.logger.Error("Failed to request firmware update", "device_id", deviceID, "error", err)
+		http.Error(w, "Failed to request firmware update", http.StatusInternalServerError)
+		return
+	}
+
+	ws.LogEvent(fmt.Sprintf("Firmware update of %s requested by %s", device.Name, requestActor(r)))
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/"):
+		w.WriteHeader(http.StatusAccepted)
+	case r.Header.Get("HX-Request") == "true":
+		device, state, _ := ws.deviceProvider.Device(deviceID)
+		w.Header().Set("Content-Type", "text/html")
+		if _, err := fmt.Fprint(w, ws.renderDeviceCard(deviceID, device, state).Render()); err != nil {
+			ws.logger.Error("Failed to write response", slog.Any("error", err))
+		}
+	default:
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// LogFirmwareUpdate records the end of a firmware update in the event
+// log.
+func (ws *WebServer) LogFirmwareUpdate(result devices.FirmwareUpdateResult) {
+	switch {
+	case result.Err != nil:
+		ws.LogEvent(fmt.Sprintf("Firmware update of %s failed: %v", result.Name, result.Err))
+	case result.From != "" && result.To != "":
+		ws.LogEvent(fmt.Sprintf("Firmware of %s updated from %s to %s", result.Name, result.From, result.To))
+	default:
+		ws.LogEvent(fmt.Sprintf("Firmware of %s updated", result.Name))
+	}
+}
+
+// renderFirmwareUpdate renders a device's firmware update: a button while
+// one is available and a progress bar while it runs. The script shows the
+// parts for the state in data-state as updates arrive, so all are always
+// rendered.
+func (ws *WebServer) renderFirmwareUpdate(deviceID string, state devices.State) elem.Node {
+	var update devices.FirmwareUpdate
+	if state.Update != nil {
+		update = *state.Update
+	}
+
+	progress := attrs.Props{"data-role": "update-progress", "max": "100"}
+	if update.Progress != nil {
+		progress[attrs.Value] = strconv.FormatFloat(*update.Progress, 'f', 0, 64)
+	}
+
+	return elem.Div(attrs.Props{attrs.Class: "firmware-update", "data-role": "firmware-update", "data-state": update.State},
+		elem.Form(attrs.Props{
+			"hx-post":   "/ota/" + deviceID,
+			"hx-target": "#device-" + deviceID,
+			"hx-swap":   "outerHTML",
+		},
+			elem.Button(attrs.Props{attrs.Type: "submit", "data-role": "update-button"}, elem.Text("Update firmware")),
+		),
+		elem.Progress(progress),
+		elem.Span(attrs.Props{"data-role": "update-text"}, elem.Text(firmwareUpdateText(update))),
+	)
+}
+
+// firmwareUpdateText describes a firmware update; assets/script.js
+// mirrors it for live updates.
+func firmwareUpdateText(u devices.FirmwareUpdate) string {
+	switch u.State {
+	case devices.UpdateAvailable:
+		return "Firmware update available"
+	case devices.UpdateScheduled:
+		return "Firmware update scheduled"
+	case devices.UpdateRequested:
+		return "Firmware update requested"
+	case devices.UpdateUpdating:
+		text := "Updating firmware"
+		if u.Progress != nil {
+			text += fmt.Sprintf(": %.0f%%", *u.Progress)
+		}
+		if u.Remaining != nil {
+			text += fmt.Sprintf(", %d min left", max(1, (*u.Remaining+59)/60))
+		}
+		return text
+	}
+	return ""
+}
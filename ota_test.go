@@ -0,0 +1,73 @@
+package z2mhomekit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+func TestHandleFirmwareUpdate(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ctrl := &fakeController{}
+	ws.controller = ctrl
+	ws.deviceProvider = fakeDeviceProvider{
+		"lamp": {Device: devices.Device{ID: "lamp", Name: "Lamp", Type: devices.DeviceTypeLightbulb}},
+	}
+
+	post := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		ws.HandleFirmwareUpdate(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		return rec
+	}
+
+	if rec := post("/api/v1/ota/lamp"); rec.Code != http.StatusAccepted {
+		t.Errorf("API status = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+	if rec := post("/ota/plug"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown device status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if len(ctrl.calls) != 1 || ctrl.calls[0] != "ota lamp" {
+		t.Errorf("calls = %v, want an update of the lamp", ctrl.calls)
+	}
+
+	ws.LogFirmwareUpdate(devices.FirmwareUpdateResult{Name: "Lamp", From: "1.0", To: "1.1"})
+	ws.LogFirmwareUpdate(devices.FirmwareUpdateResult{Name: "Lamp", Err: errors.New("timeout")})
+	log := strings.Join(ws.eventLog, "\n")
+	if !strings.Contains(log, "Firmware of Lamp updated from 1.0 to 1.1") || !strings.Contains(log, "Firmware update of Lamp failed: timeout") {
+		t.Errorf("event log lacks the results:\n%s", log)
+	}
+}
+
+func TestRenderFirmwareUpdate(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	lamp := devices.Device{ID: "lamp", Name: "Lamp", Type: devices.DeviceTypeLightbulb}
+
+	card := ws.renderDeviceCard("lamp", lamp, devices.State{
+		Update: &devices.FirmwareUpdate{State: devices.UpdateUpdating, Progress: devices.Ptr(42.0), Remaining: devices.Ptr(90)},
+	}).Render()
+	if !strings.Contains(card, `data-state="updating"`) || !strings.Contains(card, `value="42"`) || !strings.Contains(card, "Updating firmware: 42%, 2 min left") {
+		t.Errorf("card lacks the update progress:\n%s", card)
+	}
+
+	card = ws.renderDeviceCard("lamp", lamp, devices.State{Update: &devices.FirmwareUpdate{State: devices.UpdateAvailable}}).Render()
+	if !strings.Contains(card, `hx-post="/ota/lamp"`) || !strings.Contains(card, "Firmware update available") {
+		t.Errorf("card lacks the update button:\n%s", card)
+	}
+}
+
+func TestParseFirmwareUpdate(t *testing.T) {
+	hook := &MQTTHook{logger: testLogger()}
+	device := devices.Device{ID: "lamp", Name: "Lamp", Type: devices.DeviceTypeLightbulb}
+
+	state, _ := hook.parseZ2MMessage(device, map[string]any{
+		"update": map[string]any{"state": "updating", "progress": 13.37, "remaining": 219.0},
+	})
+	u := state.Update
+	if u == nil || u.State != devices.UpdateUpdating || u.Progress == nil || *u.Progress != 13.37 || u.Remaining == nil || *u.Remaining != 219 {
+		t.Errorf("update = %+v", u)
+	}
+}
@@ -0,0 +1,99 @@
+package z2mhomekit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chasefleming/elem-go"
+	"github.com/chasefleming/elem-go/attrs"
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+// PermitJoinResponse is the permit join state served by
+// /api/v1/permitjoin.
+type PermitJoinResponse struct {
+	Open      bool `json:"open"`
+	Remaining int  `json:"remaining"` // seconds the network stays open
+}
+
+// HandlePermitJoin reports whether the Zigbee network is open for new
+// devices on GET, and opens it on POST for seconds (up to 254), or closes
+// it with seconds=0.
+func (ws *WebServer) HandlePermitJoin(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		seconds, err := formValue(r, "seconds", strconv.Atoi)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := ws.controller.PermitJoin(time.Duration(*seconds) * time.Second); err != nil {
+			if errors.Is(err, devices.ErrZ2MOffline) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if *seconds > 0 {
+			ws.LogEvent(fmt.Sprintf("Permit join opened for %ds by %s", *seconds, requestActor(r)))
+		} else {
+			ws.LogEvent(fmt.Sprintf("Permit join closed by %s", requestActor(r)))
+		}
+
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	remaining := permitJoinSeconds(ws.controller.PermitJoinRemaining())
+	ws.writeJSON(w, PermitJoinResponse{Open: remaining > 0, Remaining: remaining})
+}
+
+// LogDeviceJoined records a device joining the Zigbee network in the event
+// log.
+func (ws *WebServer) LogDeviceJoined(friendlyName, ieeeAddress string) {
+	if friendlyName == "" || friendlyName == ieeeAddress {
+		ws.LogEvent(fmt.Sprintf("Device joined: %s", ieeeAddress))
+		return
+	}
+	ws.LogEvent(fmt.Sprintf("Device joined: %s (%s)", friendlyName, ieeeAddress))
+}
+
+// renderPermitJoin renders the permit join button, with a countdown while
+// the network is open that the script ticks down.
+func (ws *WebServer) renderPermitJoin() elem.Node {
+	remaining := permitJoinSeconds(ws.controller.PermitJoinRemaining())
+	if remaining == 0 {
+		return elem.Form(attrs.Props{attrs.Class: "permit-join", attrs.Method: "post", attrs.Action: "/permitjoin"},
+			elem.Span(attrs.Props{attrs.Class: "sort-label"}, elem.Text("📡 Pairing: closed")),
+			elem.Button(attrs.Props{attrs.Type: "submit", attrs.Name: "seconds", attrs.Value: strconv.Itoa(int(devices.MaxPermitJoin / time.Second))},
+				elem.Text("Permit join")),
+		)
+	}
+
+	return elem.Form(attrs.Props{attrs.Class: "permit-join open", attrs.Method: "post", attrs.Action: "/permitjoin"},
+		elem.Span(attrs.Props{attrs.Class: "sort-label"},
+			elem.Text("📡 Pairing: open for "),
+			elem.Span(attrs.Props{"data-role": "permit-join-countdown", "data-remaining": strconv.Itoa(remaining)},
+				elem.Text(fmt.Sprintf("%d:%02d", remaining/60, remaining%60))),
+		),
+		elem.Button(attrs.Props{attrs.Type: "submit", attrs.Name: "seconds", attrs.Value: "0"}, elem.Text("Stop")),
+	)
+}
+
+// permitJoinSeconds rounds the time the network stays open up to whole
+// seconds.
+func permitJoinSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,62 @@
+package z2mhomekit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlePermitJoin(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ctrl := &fakeController{}
+	ws.controller = ctrl
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		ws.HandlePermitJoin(rec, req)
+		return rec
+	}
+
+	rec := post("/api/v1/permitjoin", "seconds=120")
+	var resp PermitJoinResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !resp.Open || resp.Remaining != 120 {
+		t.Errorf("response = %+v, want open for 120s", resp)
+	}
+	if rec := post("/permitjoin", "seconds=0"); rec.Code != http.StatusSeeOther {
+		t.Errorf("web status = %d, want a redirect", rec.Code)
+	}
+	if rec := post("/api/v1/permitjoin", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("missing seconds status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if len(ctrl.calls) != 2 || ctrl.calls[0] != "permit join 2m0s" || ctrl.calls[1] != "permit join 0s" {
+		t.Errorf("calls = %v", ctrl.calls)
+	}
+
+	ctrl.permitJoin = 90 * time.Second
+	if html := ws.renderPermitJoin().Render(); !strings.Contains(html, `data-remaining="90"`) || !strings.Contains(html, "1:30") {
+		t.Errorf("open permit join lacks the countdown:\n%s", html)
+	}
+
+	ws.LogDeviceJoined("0x00158d0009", "0x00158d0009")
+	if last := ws.eventLog[len(ws.eventLog)-1]; !strings.HasSuffix(last, ": Device joined: 0x00158d0009") {
+		t.Errorf("last event = %q, want the joined device", last)
+	}
+}
+
+func TestParseDeviceJoined(t *testing.T) {
+	name, ieee, ok := parseDeviceJoined([]byte(`{"type":"device_joined","data":{"friendly_name":"0x00158d0009","ieee_address":"0x00158d0009"}}`))
+	if !ok || name != "0x00158d0009" || ieee != "0x00158d0009" {
+		t.Errorf("parseDeviceJoined = %q, %q, %v", name, ieee, ok)
+	}
+	if _, _, ok := parseDeviceJoined([]byte(`{"type":"device_leave","data":{"friendly_name":"plug","ieee_address":"0x1"}}`)); ok {
+		t.Error("device_leave parsed as a join")
+	}
+}
@@ -0,0 +1,50 @@
+package z2mhomekit
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimit allows a burst of events, then one per interval.
+type rateLimit struct {
+	interval time.Duration
+	burst    int
+}
+
+// tokenBucket is the bucket of one key.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// tokenBuckets rate limits events per key, such as a guest token or a
+// device, with a token bucket for each.
+type tokenBuckets struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// allow reports whether an event for key at now is within limit, taking a
+// token if it is.
+func (t *tokenBuckets) allow(key string, limit rateLimit, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.buckets == nil {
+		t.buckets = make(map[string]*tokenBucket)
+	}
+	burst := float64(limit.burst)
+	b, ok := t.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		t.buckets[key] = b
+	}
+
+	b.tokens = min(burst, b.tokens+float64(now.Sub(b.last))/float64(limit.interval))
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,152 @@
+package z2mhomekit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/devices"
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+// replayDefaultWindow is how far back a replay reaches without since.
+const replayDefaultWindow = time.Hour
+
+// ReplayStep is one journalled message replayed through the test sink and
+// the state it produced.
+type ReplayStep struct {
+	At      time.Time               `json:"at"`
+	Payload json.RawMessage         `json:"payload"`
+	Fields  []string                `json:"fields"`
+	State   events.StateUpdateEvent `json:"state"`
+}
+
+// replayJournal feeds journalled messages for device through a scratch
+// device manager, the test sink, which parses and merges them exactly as
+// the live bridge does but sends no commands. Shutoff valves are dropped
+// from the device so a replayed leak cannot reach other devices.
+func replayJournal(ctx context.Context, device devices.Device, recs []journalRecord) ([]ReplayStep, error) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	bus, err := events.New(logger)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = bus.Close() }()
+
+	device.ShutoffValves = nil
+	dm, err := devices.NewManager([]devices.Device{device}, nil, bus, nil, logger)
+	if err != nil {
+		return nil, err
+	}
+	hook := &MQTTHook{deviceManager: dm, logger: logger}
+
+	steps := make([]ReplayStep, 0, len(recs))
+	for _, rec := range recs {
+		var msg map[string]any
+		if err := json.Unmarshal(rec.Payload, &msg); err != nil {
+			continue
+		}
+
+		state, fields := hook.parseZ2MMessage(device, msg)
+		state.LastSeen, state.LastUpdated = rec.At, rec.At
+		dm.ApplyStateChange(ctx, devices.StateChangedEvent{
+			DeviceID:      device.ID,
+			State:         state,
+			UpdatedFields: fields,
+		})
+
+		evt, _ := dm.StateUpdate(device.ID)
+		evt.Timestamp = rec.At
+		evt.Source = "replay"
+		steps = append(steps, ReplayStep{At: rec.At, Payload: rec.Payload, Fields: fields, State: evt})
+	}
+	return steps, nil
+}
+
+// parseSince parses the since parameter, an RFC 3339 time or a duration
+// back from now such as 30m.
+func parseSince(raw string, now time.Time) (time.Time, error) {
+	if raw == "" {
+		return now.Add(-replayDefaultWindow), nil
+	}
+	if d, err := time.ParseDuration(raw); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("since must be an RFC 3339 time or a duration, got %q", raw)
+	}
+	return t, nil
+}
+
+// SetEventJournal enables the event replay API.
+func (ws *WebServer) SetEventJournal(j *EventJournal) {
+	ws.journal = j
+}
+
+// HandleEventReplay returns the journalled zigbee2mqtt messages for a
+// device as NDJSON. With sink=test they are replayed through a scratch
+// device manager and each line also holds the resulting state, to
+// reproduce a bad transition sequence offline.
+func (ws *WebServer) HandleEventReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ws.journal == nil {
+		http.Error(w, "Event journal is disabled", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	device, _, exists := ws.deviceProvider.Device(q.Get("device"))
+	if !exists {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+	since, err := parseSince(q.Get("since"), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recs, err := ws.journal.Read(device.ID, since)
+	if err != nil {
+		ws.logger.Error("Failed to read event journal", "error", err)
+		http.Error(w, "Failed to read event journal", http.StatusInternalServerError)
+		return
+	}
+
+	var lines []any
+	switch q.Get("sink") {
+	case "":
+		for _, rec := range recs {
+			lines = append(lines, rec)
+		}
+	case "test":
+		steps, err := replayJournal(r.Context(), device, recs)
+		if err != nil {
+			ws.logger.Error("Failed to replay events", "device_id", device.ID, "error", err)
+			http.Error(w, "Failed to replay events", http.StatusInternalServerError)
+			return
+		}
+		for _, step := range steps {
+			lines = append(lines, step)
+		}
+	default:
+		http.Error(w, "sink must be test or unset", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	for _, line := range lines {
+		if err := enc.Encode(line); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package z2mhomekit
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+func TestEventJournalRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	j, err := OpenEventJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	start := time.Now()
+	big := json.RawMessage(`"` + strings.Repeat("x", 512<<10) + `"`)
+	for i := range 40 {
+		rec := journalRecord{At: start.Add(time.Duration(i) * time.Second), DeviceID: "lamp", Topic: "zigbee2mqtt/lamp", Payload: big}
+		if err := j.Record(rec); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	if err := j.Record(journalRecord{At: start.Add(time.Minute), DeviceID: "plug", Payload: json.RawMessage(`{"state":"ON"}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	lamp, err := j.Read("lamp", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(lamp); n == 0 || n >= 40 {
+		t.Errorf("read %d lamp records after rotation, want some but not all", n)
+	}
+	if !lamp[len(lamp)-1].At.Equal(start.Add(39 * time.Second)) {
+		t.Errorf("latest lamp record at %v, want the last written", lamp[len(lamp)-1].At)
+	}
+
+	plug, _ := j.Read("plug", start.Add(30*time.Second))
+	if len(plug) != 1 {
+		t.Errorf("read %d plug records, want 1", len(plug))
+	}
+}
+
+func TestHandleEventReplay(t *testing.T) {
+	j, err := OpenEventJournal(filepath.Join(t.TempDir(), "events.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	start := time.Now().Add(-10 * time.Minute)
+	for i, p := range []string{`{"state":"ON","brightness":254}`, `{"brightness":127}`, `{"state":"OFF"}`} {
+		_ = j.Record(journalRecord{At: start.Add(time.Duration(i) * time.Second), DeviceID: "lamp", Topic: "zigbee2mqtt/lamp", Payload: json.RawMessage(p)})
+	}
+
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ws.deviceProvider = fakeDeviceProvider{
+		"lamp": {Device: devices.Device{ID: "lamp", Name: "Lamp", Topic: "lamp", Type: devices.DeviceTypeLightbulb, Features: devices.DeviceFeatures{Brightness: true}}},
+	}
+	ws.SetEventJournal(j)
+
+	rec := httptest.NewRecorder()
+	ws.HandleEventReplay(rec, httptest.NewRequest("GET", "/api/v1/events/replay?device=lamp&since=1h&sink=test", nil))
+	if rec.Code != 200 {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+
+	var steps []ReplayStep
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var step ReplayStep
+		if err := json.Unmarshal(scanner.Bytes(), &step); err != nil {
+			t.Fatalf("decode %s: %v", scanner.Text(), err)
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) != 3 {
+		t.Fatalf("got %d steps, want 3", len(steps))
+	}
+	if s := steps[1].State; s.On == nil || !*s.On || s.Brightness == nil || *s.Brightness != 50 {
+		t.Errorf("second step state = on %v brightness %v, want on at 50", s.On, s.Brightness)
+	}
+	if s := steps[2].State; *s.On || *s.Brightness != 50 {
+		t.Errorf("final state = on %v brightness %v, want off keeping 50", *s.On, *s.Brightness)
+	}
+
+	for query, want := range map[string]int{
+		"device=lamp&since=yesterday": 400,
+		"device=lamp&sink=prod":       400,
+		"device=nope":                 404,
+	} {
+		rec := httptest.NewRecorder()
+		ws.HandleEventReplay(rec, httptest.NewRequest("GET", "/api/v1/events/replay?"+query, nil))
+		if rec.Code != want {
+			t.Errorf("%s: status = %d, want %d", query, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package z2mhomekit
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/chasefleming/elem-go"
+	"github.com/chasefleming/elem-go/attrs"
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+// HandleScenes lists the scenes with a button to recall each, and saves
+// the current state of the chosen devices as a new scene.
+func (ws *WebServer) HandleScenes(w http.ResponseWriter, r *http.Request) {
+	var formErr string
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form", http.StatusBadRequest)
+			return
+		}
+		scene, err := ws.controller.SaveScene(r.PostFormValue("name"), r.PostForm["device"])
+		if err != nil {
+			formErr = err.Error()
+			break
+		}
+		ws.LogEvent(fmt.Sprintf("Web UI: Saved scene %q", scene.Name))
+		http.Redirect(w, r, "/scenes", http.StatusSeeOther)
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if formErr != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if _, err := fmt.Fprint(w, ws.renderPage("z2m-homekit · scenes", ws.renderScenes(formErr))); err != nil {
+		ws.logger.Error("Failed to write scenes response", slog.Any("error", err))
+	}
+}
+
+// HandleSceneRecall recalls the scene named in the path.
+func (ws *WebServer) HandleSceneRecall(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sceneID := strings.TrimPrefix(r.URL.Path, "/scenes/recall/")
+	if !ws.recallScene(w, sceneID, "Web UI") {
+		return
+	}
+	http.Redirect(w, r, "/scenes", http.StatusSeeOther)
+}
+
+// HandleSceneDelete deletes the saved scene named in the path.
+func (ws *WebServer) HandleSceneDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sceneID := strings.TrimPrefix(r.URL.Path, "/scenes/delete/")
+	if err := ws.controller.DeleteScene(sceneID); err != nil {
+		if errors.Is(err, devices.ErrSceneNotFound) {
+			http.Error(w, "Scene not found", http.StatusNotFound)
+			return
+		}
+		ws.logger.Error("Failed to delete scene", "scene_id", sceneID, "error", err)
+		http.Error(w, "Failed to delete scene", http.StatusInternalServerError)
+		return
+	}
+
+	ws.LogEvent(fmt.Sprintf("Web UI: Deleted scene %s", sceneID))
+	http.Redirect(w, r, "/scenes", http.StatusSeeOther)
+}
+
+// HandleScenesAPI returns the configured and saved scenes.
+func (ws *WebServer) HandleScenesAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	scenes := ws.controller.Scenes()
+	if scenes == nil {
+		scenes = []devices.Scene{}
+	}
+	ws.writeJSON(w, scenes)
+}
+
+// HandleSceneRecallAPI recalls a scene from /api/v1/scenes/<id>/recall. It
+// replies 204 once the commands are queued.
+func (ws *WebServer) HandleSceneRecallAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sceneID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/scenes/"), "/recall")
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if !ws.recallScene(w, sceneID, "API: "+requestActor(r)) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// recallScene recalls a scene, writing the error response if it fails.
+func (ws *WebServer) recallScene(w http.ResponseWriter, sceneID, by string) bool {
+	if err := ws.controller.RecallScene(sceneID); err != nil {
+		if errors.Is(err, devices.ErrSceneNotFound) {
+			http.Error(w, "Scene not found", http.StatusNotFound)
+			return false
+		}
+		http.Error(w, err.Error(), http.StatusConflict)
+		return false
+	}
+	ws.LogEvent(fmt.Sprintf("%s: Recalled scene %s", by, sceneID))
+	return true
+}
+
+func (ws *WebServer) renderScenes(formErr string) elem.Node {
+	snapshot := ws.deviceProvider.Snapshot()
+
+	rows := []elem.Node{
+		elem.Tr(attrs.Props{},
+			elem.Th(attrs.Props{}, elem.Text("Scene")),
+			elem.Th(attrs.Props{}, elem.Text("Devices")),
+			elem.Th(attrs.Props{}, elem.Text("")),
+		),
+	}
+	for _, s := range ws.controller.Scenes() {
+		names := make([]string, 0, len(s.States))
+		for _, state := range s.States {
+			name := state.Device
+			if item, ok := snapshot[state.Device]; ok {
+				name = item.Device.Name
+			}
+			names = append(names, name)
+		}
+
+		actions := []elem.Node{
+			elem.Form(attrs.Props{attrs.Method: "post", attrs.Action: "/scenes/recall/" + s.ID},
+				elem.Button(attrs.Props{attrs.Type: "submit", attrs.Class: "on"}, elem.Text("Recall")),
+			),
+		}
+		if s.Saved {
+			actions = append(actions, elem.Form(attrs.Props{attrs.Method: "post", attrs.Action: "/scenes/delete/" + s.ID},
+				elem.Button(attrs.Props{attrs.Type: "submit", attrs.Class: "off"}, elem.Text("Delete")),
+			))
+		}
+
+		rows = append(rows, elem.Tr(attrs.Props{"data-scene-id": s.ID},
+			elem.Td(attrs.Props{}, elem.Text(s.Name)),
+			elem.Td(attrs.Props{}, elem.Text(strings.Join(names, ", "))),
+			elem.Td(attrs.Props{}, actions...),
+		))
+	}
+
+	content := []elem.Node{
+		elem.H1(attrs.Props{}, elem.Text("Scenes")),
+		elem.P(attrs.Props{}, elem.A(attrs.Props{attrs.Href: "/"}, elem.Text("Back to dashboard"))),
+		elem.Table(attrs.Props{attrs.Class: "scenes-table"}, rows...),
+	}
+
+	if !ws.controller.CanSaveScenes() {
+		return elem.Div(attrs.Props{}, content...)
+	}
+
+	var deviceInputs []elem.Node
+	for _, id := range sortedDeviceIDs(snapshot, sortByName, "") {
+		item := snapshot[id]
+		if !onDashboard(item.Device) || !sceneDevice(item.Device.Type) {
+			continue
+		}
+		deviceInputs = append(deviceInputs, elem.Label(attrs.Props{attrs.Class: "scene-device"},
+			elem.Input(attrs.Props{attrs.Type: "checkbox", attrs.Name: "device", attrs.Value: id}),
+			elem.Text(" "+item.Device.Name),
+		))
+	}
+
+	content = append(content,
+		elem.H2(attrs.Props{}, elem.Text("Save Scene")),
+		elem.P(attrs.Props{}, elem.Text("Saves how the chosen devices are now, to set them back to later.")),
+	)
+	if formErr != "" {
+		content = append(content, elem.Div(attrs.Props{attrs.Class: "token-error"}, elem.Text(formErr)))
+	}
+	content = append(content,
+		elem.Form(attrs.Props{attrs.Method: "post", attrs.Action: "/scenes", attrs.Class: "scene-form"},
+			elem.Label(attrs.Props{}, elem.Text("Name "),
+				elem.Input(attrs.Props{attrs.Type: "text", attrs.Name: "name", attrs.Required: "true"}),
+			),
+			elem.Div(attrs.Props{}, deviceInputs...),
+			elem.Button(attrs.Props{attrs.Type: "submit"}, elem.Text("Save")),
+		),
+	)
+	return elem.Div(attrs.Props{}, content...)
+}
+
+// sceneDevice reports whether a scene can save the state of a device type.
+func sceneDevice(t devices.DeviceType) bool {
+	switch t {
+	case devices.DeviceTypeLightbulb, devices.DeviceTypeOutlet, devices.DeviceTypeSwitch,
+		devices.DeviceTypeFan, devices.DeviceTypeCover:
+		return true
+	}
+	return false
+}
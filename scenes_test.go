@@ -0,0 +1,96 @@
+package z2mhomekit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+func TestHandleScenes(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ctrl := &fakeController{scenes: []devices.Scene{
+		{ID: "movie", Name: "Movie", States: []devices.SceneState{{Device: "lamp", On: devices.Ptr(false)}}},
+	}}
+	ws.controller = ctrl
+	ws.deviceProvider = fakeDeviceProvider{
+		"lamp": {Device: devices.Device{ID: "lamp", Name: "Lamp", Type: devices.DeviceTypeLightbulb}},
+	}
+
+	rec := httptest.NewRecorder()
+	ws.HandleScenes(rec, httptest.NewRequest(http.MethodGet, "/scenes", nil))
+	if body := rec.Body.String(); !strings.Contains(body, "/scenes/recall/movie") || !strings.Contains(body, `value="lamp"`) {
+		t.Errorf("scenes page lacks the recall button or the lamp:\n%s", body)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/scenes", strings.NewReader("name=Evening&device=lamp"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	ws.HandleScenes(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("save status = %d, want %d", rec.Code, http.StatusSeeOther)
+	}
+
+	rec = httptest.NewRecorder()
+	ws.HandleSceneRecallAPI(rec, httptest.NewRequest(http.MethodPost, "/api/v1/scenes/movie/recall", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("recall status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	rec = httptest.NewRecorder()
+	ws.HandleSceneRecallAPI(rec, httptest.NewRequest(http.MethodPost, "/api/v1/scenes/party/recall", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown scene status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	want := []string{"save scene Evening [lamp]", "scene movie"}
+	if strings.Join(ctrl.calls, ";") != strings.Join(want, ";") {
+		t.Errorf("calls = %v, want %v", ctrl.calls, want)
+	}
+
+	rec = httptest.NewRecorder()
+	ws.HandleScenesAPI(rec, httptest.NewRequest(http.MethodGet, "/api/v1/scenes", nil))
+	var scenes []devices.Scene
+	if err := json.NewDecoder(rec.Body).Decode(&scenes); err != nil || len(scenes) != 1 {
+		t.Errorf("scenes API = %v, %v, want the movie scene", scenes, err)
+	}
+}
+
+func TestSceneSwitch(t *testing.T) {
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	plug := devices.Device{ID: "plug", Name: "Plug", Topic: "plug", Type: devices.DeviceTypeOutlet}
+	commands := make(chan devices.CommandEvent, 4)
+	dm := newTestDeviceManager(t, bus, []devices.Device{plug}, commands)
+	scene := devices.Scene{ID: "away", Name: "Away", HomeKit: true, States: []devices.SceneState{{Device: "plug", On: devices.Ptr(false)}}}
+	dm.SetScenes([]devices.Scene{scene})
+
+	hm := NewHAPManager([]devices.Device{plug}, "Test Bridge", commands, dm, bus, logger)
+	if got := len(hm.GetAccessories()); got != 3 {
+		t.Fatalf("GetAccessories returned %d, want bridge, plug and the scene switch", got)
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/characteristics", nil)
+	hm.sceneSwitches[0].Switch.On.SetValueRequest(true, req)
+	if cmd := <-commands; cmd.DeviceID != "plug" || *cmd.On {
+		t.Errorf("scene switch sent %+v, want the plug off", cmd)
+	}
+
+	// Changing only a scene's states keeps the switch; hiding it rebuilds.
+	scene.States[0].On = devices.Ptr(true)
+	dm.SetScenes([]devices.Scene{scene})
+	if hm.SetDevices([]devices.Device{plug}) {
+		t.Error("changing a scene's states rebuilt the accessories")
+	}
+	scene.HomeKit = false
+	dm.SetScenes([]devices.Scene{scene})
+	if !hm.SetDevices([]devices.Device{plug}) {
+		t.Error("hiding the scene switch did not rebuild the accessories")
+	}
+	if got := len(hm.GetAccessories()); got != 2 {
+		t.Errorf("GetAccessories returned %d after hiding the scene", got)
+	}
+}
@@ -0,0 +1,115 @@
+// Package secrets encrypts configuration secrets at rest with NaCl secretbox
+// and a key file, so credentials can be stored in env files and on disk
+// without being readable in plaintext.
+package secrets
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// Prefix marks an encrypted value.
+const Prefix = "enc:v1:"
+
+const (
+	keySize   = 32
+	nonceSize = 24
+)
+
+// ErrNoKey is returned when an encrypted value is found but no key is loaded.
+var ErrNoKey = errors.New("value is encrypted but no secrets key file is configured")
+
+// Box seals and opens secrets with a single symmetric key.
+type Box struct {
+	key [keySize]byte
+}
+
+// IsEncrypted reports whether value was produced by Seal.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// GenerateKey writes a new random key to path. It refuses to overwrite an
+// existing file, since that would make existing secrets unreadable.
+func GenerateKey(path string) error {
+	var key [keySize]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create key file: %w", err)
+	}
+	if _, err := f.WriteString(base64.StdEncoding.EncodeToString(key[:]) + "\n"); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	return f.Close()
+}
+
+// LoadKey reads a key file created by GenerateKey.
+func LoadKey(path string) (*Box, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets key file: %w", err)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid secrets key file %q: %w", path, err)
+	}
+	if len(raw) != keySize {
+		return nil, fmt.Errorf("invalid secrets key file %q: key must be %d bytes, got %d", path, keySize, len(raw))
+	}
+
+	b := &Box{}
+	copy(b.key[:], raw)
+	return b, nil
+}
+
+// Seal encrypts plaintext and returns it in the Prefix form.
+func (b *Box) Seal(plaintext string) (string, error) {
+	var nonce [nonceSize]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := secretbox.Seal(nonce[:], []byte(plaintext), &nonce, &b.key)
+	return Prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value produced by Seal. Values without the prefix are
+// returned unchanged so plaintext configuration keeps working.
+func (b *Box) Open(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	if b == nil {
+		return "", ErrNoKey
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, Prefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	if len(sealed) < nonceSize+secretbox.Overhead {
+		return "", fmt.Errorf("invalid encrypted value: too short")
+	}
+
+	var nonce [nonceSize]byte
+	copy(nonce[:], sealed[:nonceSize])
+
+	plaintext, ok := secretbox.Open(nil, sealed[nonceSize:], &nonce, &b.key)
+	if !ok {
+		return "", fmt.Errorf("failed to decrypt value: wrong key or corrupted data")
+	}
+
+	return string(plaintext), nil
+}
@@ -0,0 +1,76 @@
+package secrets
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func newTestBox(t *testing.T) (*Box, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "secrets.key")
+	if err := GenerateKey(path); err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	box, err := LoadKey(path)
+	if err != nil {
+		t.Fatalf("LoadKey() error = %v", err)
+	}
+	return box, path
+}
+
+func TestSealOpen(t *testing.T) {
+	box, _ := newTestBox(t)
+
+	sealed, err := box.Seal("tskey-auth-secret")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if !IsEncrypted(sealed) {
+		t.Fatalf("Seal() = %q, missing prefix", sealed)
+	}
+
+	plain, err := box.Open(sealed)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if plain != "tskey-auth-secret" {
+		t.Errorf("Open() = %q, want original", plain)
+	}
+}
+
+func TestOpenPlaintextPassthrough(t *testing.T) {
+	var box *Box
+	plain, err := box.Open("not-encrypted")
+	if err != nil || plain != "not-encrypted" {
+		t.Errorf("Open(plaintext) = %q, %v", plain, err)
+	}
+}
+
+func TestOpenWithoutKey(t *testing.T) {
+	var box *Box
+	if _, err := box.Open(Prefix + "AAAA"); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Open() error = %v, want ErrNoKey", err)
+	}
+}
+
+func TestOpenWrongKey(t *testing.T) {
+	box, _ := newTestBox(t)
+	other, _ := newTestBox(t)
+
+	sealed, err := box.Seal("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Open(sealed); err == nil {
+		t.Error("Open() with the wrong key succeeded")
+	}
+}
+
+func TestGenerateKeyRefusesOverwrite(t *testing.T) {
+	_, path := newTestBox(t)
+	if err := GenerateKey(path); err == nil {
+		t.Error("GenerateKey() overwrote an existing key file")
+	}
+}
@@ -0,0 +1,80 @@
+package z2mhomekit
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kradalby/z2m-homekit/secrets"
+)
+
+// Secrets implements the secrets subcommand and returns the process exit
+// code.
+func Secrets(args []string) int {
+	usage := func(w io.Writer) {
+		fmt.Fprintf(w, "Usage: z2m-homekit secrets <command> [flags]\n\n")
+		fmt.Fprintf(w, "Commands:\n")
+		fmt.Fprintf(w, "  keygen   create a new key file\n")
+		fmt.Fprintf(w, "  encrypt  read a value from stdin and print it encrypted\n\n")
+		fmt.Fprintf(w, "Set Z2M_HOMEKIT_SECRETS_KEY_FILE to the key file and use the printed\n")
+		fmt.Fprintf(w, "%s... value in place of the plaintext, e.g. for Z2M_HOMEKIT_TS_AUTHKEY.\n", secrets.Prefix)
+	}
+
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("secrets "+args[0], flag.ContinueOnError)
+	keyFile := fs.String("key", os.Getenv("Z2M_HOMEKIT_SECRETS_KEY_FILE"), "path to the secrets key file")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *keyFile == "" {
+		fmt.Fprintln(os.Stderr, "secrets: -key or Z2M_HOMEKIT_SECRETS_KEY_FILE is required")
+		return 2
+	}
+
+	switch args[0] {
+	case "keygen":
+		if err := secrets.GenerateKey(*keyFile); err != nil {
+			fmt.Fprintf(os.Stderr, "secrets: %v\n", err)
+			return 1
+		}
+		fmt.Printf("wrote %s\n", *keyFile)
+
+	case "encrypt":
+		box, err := secrets.LoadKey(*keyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "secrets: %v\n", err)
+			return 1
+		}
+
+		value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			fmt.Fprintf(os.Stderr, "secrets: failed to read value: %v\n", err)
+			return 1
+		}
+		value = strings.TrimRight(value, "\r\n")
+		if value == "" {
+			fmt.Fprintln(os.Stderr, "secrets: no value on stdin")
+			return 2
+		}
+
+		sealed, err := box.Seal(value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "secrets: %v\n", err)
+			return 1
+		}
+		fmt.Println(sealed)
+
+	default:
+		usage(os.Stderr)
+		return 2
+	}
+
+	return 0
+}
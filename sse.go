@@ -0,0 +1,112 @@
+package z2mhomekit
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+// sseReplaySize is how many state events are kept for clients resuming a
+// stream with Last-Event-ID.
+const sseReplaySize = 256
+
+// sseEvent is a state update tagged with its stream position.
+type sseEvent struct {
+	ID    uint64
+	Event events.StateUpdateEvent
+}
+
+// sseReplayBuffer assigns monotonically increasing IDs to state events and
+// keeps the most recent ones so reconnecting clients can catch up. IDs
+// restart with every process, so on the wire they carry the epoch of the
+// buffer that assigned them.
+type sseReplayBuffer struct {
+	epoch string
+
+	mu     sync.Mutex
+	events []sseEvent // ring buffer, oldest at start
+	start  int
+	lastID uint64
+}
+
+func newSSEReplayBuffer(size int) *sseReplayBuffer {
+	return &sseReplayBuffer{
+		epoch:  strconv.FormatInt(time.Now().UnixNano(), 36),
+		events: make([]sseEvent, 0, size),
+	}
+}
+
+// FormatID returns the wire form of an event ID, "<epoch>-<id>".
+func (b *sseReplayBuffer) FormatID(id uint64) string {
+	return b.epoch + "-" + strconv.FormatUint(id, 10)
+}
+
+// ParseID parses a Last-Event-ID sent by a client. ok is false when the ID
+// is malformed or was assigned by another process, whose IDs say nothing
+// about this buffer.
+func (b *sseReplayBuffer) ParseID(s string) (uint64, bool) {
+	epoch, id, found := strings.Cut(s, "-")
+	if !found || epoch != b.epoch {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(id, 10, 64)
+	return n, err == nil
+}
+
+// Add records an event and returns it with its assigned ID.
+func (b *sseReplayBuffer) Add(evt events.StateUpdateEvent) sseEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e := sseEvent{ID: b.lastID, Event: evt}
+
+	if len(b.events) < cap(b.events) {
+		b.events = append(b.events, e)
+	} else {
+		b.events[b.start] = e
+		b.start = (b.start + 1) % len(b.events)
+	}
+
+	return e
+}
+
+// LastID returns the ID of the most recent event, or 0 if none.
+func (b *sseReplayBuffer) LastID() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.lastID
+}
+
+// Since returns the events after id. ok is false when id is older than the
+// buffer or newer than any event it assigned, in which case the caller
+// should fall back to a full snapshot. IDs from a previous process are not
+// detected here; ParseID rejects them first.
+func (b *sseReplayBuffer) Since(id uint64) ([]sseEvent, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if id > b.lastID {
+		return nil, false
+	}
+	if id == b.lastID {
+		return nil, true
+	}
+	if len(b.events) == 0 || id+1 < b.events[b.start].ID {
+		return nil, false
+	}
+
+	missed := make([]sseEvent, 0, b.lastID-id)
+	for i := range len(b.events) {
+		e := b.events[(b.start+i)%len(b.events)]
+		if e.ID > id {
+			missed = append(missed, e)
+		}
+	}
+
+	return missed, true
+}
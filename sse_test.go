@@ -0,0 +1,83 @@
+package z2mhomekit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+func TestSSEReplayBufferSince(t *testing.T) {
+	b := newSSEReplayBuffer(3)
+
+	if _, ok := b.Since(0); !ok {
+		t.Fatal("empty buffer should be up to date at id 0")
+	}
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		b.Add(events.StateUpdateEvent{DeviceID: id})
+	}
+
+	if got := b.LastID(); got != 4 {
+		t.Fatalf("LastID = %d, want 4", got)
+	}
+
+	missed, ok := b.Since(2)
+	if !ok {
+		t.Fatal("Since(2) should be replayable")
+	}
+	if len(missed) != 2 || missed[0].Event.DeviceID != "c" || missed[1].Event.DeviceID != "d" {
+		t.Fatalf("Since(2) = %+v, want c, d", missed)
+	}
+
+	// Event 1 was evicted, but everything after it is still buffered.
+	if missed, ok := b.Since(1); !ok || len(missed) != 3 {
+		t.Fatalf("Since(1) = %d events, ok=%v; want 3, true", len(missed), ok)
+	}
+
+	if _, ok := b.Since(0); ok {
+		t.Fatal("Since(0) should require a snapshot once events were evicted")
+	}
+
+	if _, ok := b.Since(10); ok {
+		t.Fatal("unknown future id should require a snapshot")
+	}
+
+	if missed, ok := b.Since(4); !ok || len(missed) != 0 {
+		t.Fatalf("Since(4) = %d events, ok=%v; want 0, true", len(missed), ok)
+	}
+}
+
+func TestSSEResumeAcrossRestart(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ws.currentState["lamp"] = events.StateUpdateEvent{DeviceID: "lamp"}
+	ws.currentState["plug"] = events.StateUpdateEvent{DeviceID: "plug"}
+	for _, id := range []string{"lamp", "plug", "lamp"} {
+		ws.sseHistory.Add(events.StateUpdateEvent{DeviceID: id})
+	}
+
+	resume := func(lastEventID string) ([]sseEvent, bool) {
+		r := httptest.NewRequest(http.MethodGet, "/events", nil)
+		r.Header.Set("Last-Event-ID", lastEventID)
+		return ws.sseResumeEvents(r)
+	}
+
+	if missed, resumed := resume(ws.sseHistory.FormatID(2)); !resumed || len(missed) != 1 {
+		t.Fatalf("resume from this process = %d events, resumed=%v; want 1, true", len(missed), resumed)
+	}
+
+	// A client that saw event 2 of a previous process must not be handed
+	// event 3 of this one as if it were the only thing it missed.
+	previous := newSSEReplayBuffer(sseReplaySize)
+	previous.epoch = "previous"
+	if replay, resumed := resume(previous.FormatID(2)); resumed || len(replay) != 2 {
+		t.Fatalf("resume across restart = %d events, resumed=%v; want snapshot of 2", len(replay), resumed)
+	}
+
+	for _, header := range []string{"2", "garbage", ws.sseHistory.epoch + "-x"} {
+		if _, resumed := resume(header); resumed {
+			t.Errorf("Last-Event-ID %q resumed, want snapshot", header)
+		}
+	}
+}
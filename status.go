@@ -0,0 +1,151 @@
+package z2mhomekit
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+// processStart is used to report bridge uptime.
+var processStart = time.Now()
+
+// BridgeStatus is the document served by GET /api/v1/status.
+type BridgeStatus struct {
+	Version       string                     `json:"version"`
+	Build         BuildInfo                  `json:"build"`
+	StartedAt     time.Time                  `json:"started_at"`
+	UptimeSeconds int64                      `json:"uptime_seconds"`
+	RestartCause  string                     `json:"restart_cause"`
+	LastShutdown  *Shutdown                  `json:"last_shutdown,omitempty"`
+	Components    map[string]ComponentStatus `json:"components"`
+	Devices       DeviceCounts               `json:"devices"`
+	HAP           HAPStatus                  `json:"hap"`
+	MQTT          MQTTStatus                 `json:"mqtt"`
+	EventBus      events.Stats               `json:"eventbus"`
+	SSEClients    int                        `json:"sse_clients"`
+	Timestamp     time.Time                  `json:"timestamp"`
+}
+
+// ComponentStatus is the last connection status reported by a component.
+type ComponentStatus struct {
+	Status  events.ConnectionStatus `json:"status"`
+	Error   string                  `json:"error,omitempty"`
+	Detail  string                  `json:"detail,omitempty"`
+	Updated time.Time               `json:"updated"`
+	// Restarts counts how often the component came up again in this
+	// process, e.g. on configuration reload.
+	Restarts int `json:"restarts"`
+	// Reconnects counts how often the component reconnected since the
+	// bridge started. Attempt and NextRetry are set while it is
+	// reconnecting.
+	Reconnects int       `json:"reconnects"`
+	Attempt    int       `json:"attempt,omitempty"`
+	NextRetry  time.Time `json:"next_retry,omitzero"`
+}
+
+// DeviceCounts summarises the configured devices.
+type DeviceCounts struct {
+	Total int `json:"total"`
+	// Seen counts devices that have reported at least once since startup.
+	Seen   int            `json:"seen"`
+	ByType map[string]int `json:"by_type"`
+}
+
+// HAPStatus summarises the HomeKit side of the bridge.
+type HAPStatus struct {
+	Paired           bool   `json:"paired"`
+	Accessories      int    `json:"accessories"`
+	IncomingCommands uint64 `json:"incoming_commands"`
+	OutgoingUpdates  uint64 `json:"outgoing_updates"`
+}
+
+// MQTTStatus summarises the embedded broker.
+type MQTTStatus struct {
+	ClientsConnected int64 `json:"clients_connected"`
+	MessagesReceived int64 `json:"messages_received"`
+	MessagesSent     int64 `json:"messages_sent"`
+}
+
+// Status collects the current bridge status.
+func (ws *WebServer) Status() BridgeStatus {
+	now := time.Now()
+	status := BridgeStatus{
+		Version:       version,
+		Build:         buildInfo(),
+		StartedAt:     processStart,
+		UptimeSeconds: int64(now.Sub(processStart).Seconds()),
+		RestartCause:  lifecycle.RestartCause(),
+		LastShutdown:  lifecycle.PreviousShutdown(),
+		Components:    make(map[string]ComponentStatus),
+		Devices:       DeviceCounts{ByType: make(map[string]int)},
+		EventBus:      ws.eventBus.Stats(),
+		Timestamp:     now,
+	}
+
+	restarts := lifecycle.ComponentRestarts()
+	for _, evt := range ws.snapshotStatuses() {
+		status.Components[evt.Component] = ComponentStatus{
+			Status:     evt.Status,
+			Error:      evt.Error,
+			Detail:     evt.Detail,
+			Updated:    evt.Timestamp,
+			Restarts:   max(restarts[evt.Component], 0),
+			Reconnects: evt.Reconnects,
+			Attempt:    evt.Attempt,
+			NextRetry:  evt.NextRetry,
+		}
+	}
+
+	if ws.deviceProvider != nil {
+		for _, entry := range ws.deviceProvider.Snapshot() {
+			status.Devices.Total++
+			status.Devices.ByType[string(entry.Device.Type)]++
+			if !entry.State.LastSeen.IsZero() {
+				status.Devices.Seen++
+			}
+		}
+	}
+
+	if ws.hapManager != nil {
+		incoming, outgoing, _ := ws.hapManager.Stats()
+		status.HAP = HAPStatus{
+			Paired:           ws.hapManager.Paired(),
+			Accessories:      len(ws.hapManager.GetAccessories()),
+			IncomingCommands: incoming,
+			OutgoingUpdates:  outgoing,
+		}
+	}
+
+	if ws.mqttServer != nil {
+		info := ws.mqttServer.Info
+		status.MQTT = MQTTStatus{
+			ClientsConnected: atomic.LoadInt64(&info.ClientsConnected),
+			MessagesReceived: atomic.LoadInt64(&info.MessagesReceived),
+			MessagesSent:     atomic.LoadInt64(&info.MessagesSent),
+		}
+	}
+
+	ws.sseClientsMu.RLock()
+	status.SSEClients = len(ws.sseClients)
+	ws.sseClientsMu.RUnlock()
+
+	return status
+}
+
+// HandleStatus serves the bridge status as a single JSON document for
+// external monitoring.
+func (ws *WebServer) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ws.Status()); err != nil {
+		ws.logger.Error("Failed to write status response", slog.Any("error", err))
+	}
+}
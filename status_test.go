@@ -0,0 +1,70 @@
+package z2mhomekit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+type fakeDeviceProvider map[string]struct {
+	Device devices.Device
+	State  devices.State
+}
+
+func (f fakeDeviceProvider) Snapshot() map[string]struct {
+	Device devices.Device
+	State  devices.State
+} {
+	return f
+}
+
+func (f fakeDeviceProvider) Groups() []devices.Group { return nil }
+
+func (f fakeDeviceProvider) Device(id string) (devices.Device, devices.State, bool) {
+	entry, ok := f[id]
+	return entry.Device, entry.State, ok
+}
+
+func TestHandleStatus(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ws.deviceProvider = fakeDeviceProvider{
+		"plug": {
+			Device: devices.Device{ID: "plug", Type: devices.DeviceTypeOutlet},
+			State:  devices.State{LastSeen: time.Now()},
+		},
+		"lamp": {Device: devices.Device{ID: "lamp", Type: devices.DeviceTypeLightbulb}},
+		"desk": {Device: devices.Device{ID: "desk", Type: devices.DeviceTypeLightbulb}},
+	}
+
+	rec := httptest.NewRecorder()
+	ws.HandleStatus(rec, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want 200", rec.Code)
+	}
+
+	var status BridgeStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if status.Version != version {
+		t.Errorf("version = %q, want %q", status.Version, version)
+	}
+	if status.Devices.Total != 3 || status.Devices.Seen != 1 {
+		t.Errorf("devices = %+v, want total 3 seen 1", status.Devices)
+	}
+	if got := status.Devices.ByType[string(devices.DeviceTypeLightbulb)]; got != 2 {
+		t.Errorf("lightbulb count = %d, want 2", got)
+	}
+
+	rec = httptest.NewRecorder()
+	ws.HandleStatus(rec, httptest.NewRequest(http.MethodPost, "/api/v1/status", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status code = %d, want 405", rec.Code)
+	}
+}
@@ -0,0 +1,212 @@
+package z2mhomekit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+	"tailscale.com/ipn"
+	"tailscale.com/util/eventbus"
+)
+
+const (
+	// reconnectMinDelay is the wait before the first restart of a failed
+	// component; each further failure doubles it up to reconnectMaxDelay.
+	reconnectMinDelay = time.Second
+	reconnectMaxDelay = time.Minute
+
+	// tailscaleCheckInterval is how often a running tsnet node is
+	// checked; a node that is down is checked on the backoff instead.
+	tailscaleCheckInterval = 30 * time.Second
+	tailscaleComponent     = "tailscale"
+)
+
+// backoff computes exponential restart delays.
+type backoff struct {
+	min time.Duration
+	max time.Duration
+}
+
+// delay returns the wait before restart attempt n, counting from 1.
+func (b backoff) delay(attempt int) time.Duration {
+	d := b.min
+	for i := 1; i < attempt && d < b.max; i++ {
+		d *= 2
+	}
+	return min(d, b.max)
+}
+
+// permanentError marks a component failure that restarting will not fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// permanent wraps err so the supervisor reports the component as failed
+// instead of restarting it.
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// supervisor restarts a component that fails, waiting an exponential
+// backoff between attempts and publishing its status on the eventbus.
+// While it waits the component is reconnecting, with the attempt count and
+// the time of the next retry set so the UI and metrics can show them.
+type supervisor struct {
+	component string
+	bus       *events.Bus
+	client    *eventbus.Client
+	logger    *slog.Logger
+	backoff   backoff
+
+	// now and sleep are replaced in tests.
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) bool
+}
+
+func newSupervisor(component string, bus *events.Bus, client *eventbus.Client, logger *slog.Logger) *supervisor {
+	return &supervisor{
+		component: component,
+		bus:       bus,
+		client:    client,
+		logger:    logger.With(slog.String("component", component)),
+		backoff:   backoff{min: reconnectMinDelay, max: reconnectMaxDelay},
+		now:       time.Now,
+		sleep:     sleepContext,
+	}
+}
+
+// serve runs fn until ctx is cancelled or fn returns without an error,
+// restarting it after failures. fn calls up once the component is
+// serving.
+func (s *supervisor) serve(ctx context.Context, fn func(ctx context.Context) error) {
+	attempt := 0
+	for {
+		started := s.now()
+		err := fn(ctx)
+		// A component that stayed up longer than the longest backoff
+		// failed afresh rather than in a loop.
+		if s.now().Sub(started) > s.backoff.max {
+			attempt = 0
+		}
+		attempt++
+		if !s.failed(ctx, err, attempt) {
+			return
+		}
+	}
+}
+
+// failed handles fn returning err on restart attempt. It reports whether
+// to start the component again, having waited out the backoff.
+func (s *supervisor) failed(ctx context.Context, err error, attempt int) bool {
+	if err == nil || ctx.Err() != nil ||
+		errors.Is(err, context.Canceled) || errors.Is(err, http.ErrServerClosed) {
+		s.publish(events.ConnectionStatusDisconnected, nil, 0, time.Time{})
+		return false
+	}
+	var perm *permanentError
+	if errors.As(err, &perm) {
+		s.logger.Error("component failed", slog.Any("error", perm.err))
+		s.publish(events.ConnectionStatusFailed, perm.err, 0, time.Time{})
+		return false
+	}
+
+	delay := s.backoff.delay(attempt)
+	next := s.now().Add(delay)
+	s.logger.Warn("component failed, restarting",
+		slog.Any("error", err),
+		slog.Int("attempt", attempt),
+		slog.Duration("retry_in", delay),
+	)
+	s.publish(events.ConnectionStatusReconnecting, err, attempt, next)
+
+	if !s.sleep(ctx, delay) {
+		s.publish(events.ConnectionStatusDisconnected, nil, 0, time.Time{})
+		return false
+	}
+	return true
+}
+
+// up reports the component as serving.
+func (s *supervisor) up() {
+	s.publish(events.ConnectionStatusConnected, nil, 0, time.Time{})
+}
+
+// connecting reports the component as starting for the first time.
+func (s *supervisor) connecting() {
+	s.publish(events.ConnectionStatusConnecting, nil, 0, time.Time{})
+}
+
+func (s *supervisor) publish(status events.ConnectionStatus, err error, attempt int, next time.Time) {
+	if s.bus == nil || s.client == nil {
+		return
+	}
+	evt := events.ConnectionStatusEvent{
+		Timestamp: s.now(),
+		Component: s.component,
+		Status:    status,
+		Attempt:   attempt,
+		NextRetry: next,
+	}
+	if err != nil {
+		evt.Error = err.Error()
+	}
+	s.bus.PublishConnectionStatus(s.client, evt)
+}
+
+// watchTailscale reports the tsnet node's backend state until ctx is
+// cancelled. tsnet reconnects to the control plane by itself, so the
+// watcher only tracks it: while the node is not running it is
+// reconnecting, and is checked again on the backoff.
+func watchTailscale(ctx context.Context, s *supervisor, backendState func(ctx context.Context) (string, error)) {
+	s.connecting()
+	attempt := 0
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		state, err := backendState(checkCtx)
+		cancel()
+		if ctx.Err() != nil {
+			s.publish(events.ConnectionStatusDisconnected, nil, 0, time.Time{})
+			return
+		}
+
+		wait := tailscaleCheckInterval
+		if err == nil && state == ipn.Running.String() {
+			attempt = 0
+			s.up()
+		} else {
+			if err == nil {
+				err = fmt.Errorf("backend state %s", state)
+			}
+			attempt++
+			wait = s.backoff.delay(attempt)
+			s.publish(events.ConnectionStatusReconnecting, err, attempt, s.now().Add(wait))
+		}
+
+		if !s.sleep(ctx, wait) {
+			s.publish(events.ConnectionStatusDisconnected, nil, 0, time.Time{})
+			return
+		}
+	}
+}
+
+// sleepContext waits for d, returning false if ctx is cancelled first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,196 @@
+package z2mhomekit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+	"tailscale.com/util/eventbus"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := backoff{min: time.Second, max: time.Minute}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{6, 32 * time.Second},
+		{7, time.Minute},
+		{100, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := b.delay(tt.attempt); got != tt.want {
+			t.Errorf("delay(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+// newTestSupervisor returns a supervisor on a fake clock whose sleeps
+// return immediately, and a subscriber for the statuses it publishes.
+func newTestSupervisor(t *testing.T) (*supervisor, *eventbus.Subscriber[events.ConnectionStatusEvent], *[]time.Duration) {
+	t.Helper()
+
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	client, err := bus.Client(events.ClientMQTT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	observer, err := bus.Client(events.ClientMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := eventbus.Subscribe[events.ConnectionStatusEvent](observer)
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	var slept []time.Duration
+	s := newSupervisor("mqtt", bus, client, logger)
+	s.now = func() time.Time { return now }
+	s.sleep = func(ctx context.Context, d time.Duration) bool {
+		slept = append(slept, d)
+		now = now.Add(d)
+		return ctx.Err() == nil
+	}
+	return s, statuses, &slept
+}
+
+func nextStatus(t *testing.T, sub *eventbus.Subscriber[events.ConnectionStatusEvent]) events.ConnectionStatusEvent {
+	t.Helper()
+
+	select {
+	case evt := <-sub.Events():
+		return evt
+	case <-time.After(5 * time.Second):
+		t.Fatal("no connection status published")
+	}
+	return events.ConnectionStatusEvent{}
+}
+
+func TestSupervisorRestartsWithBackoff(t *testing.T) {
+	s, statuses, slept := newTestSupervisor(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s.connecting()
+	runs := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.serve(ctx, func(ctx context.Context) error {
+			runs++
+			if runs < 3 {
+				return errors.New("address in use")
+			}
+			s.up()
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+
+	if evt := nextStatus(t, statuses); evt.Status != events.ConnectionStatusConnecting {
+		t.Fatalf("status = %s, want connecting", evt.Status)
+	}
+	for attempt := 1; attempt <= 2; attempt++ {
+		evt := nextStatus(t, statuses)
+		if evt.Status != events.ConnectionStatusReconnecting {
+			t.Fatalf("status = %s, want reconnecting", evt.Status)
+		}
+		if evt.Attempt != attempt {
+			t.Errorf("Attempt = %d, want %d", evt.Attempt, attempt)
+		}
+		if evt.Error != "address in use" {
+			t.Errorf("Error = %q, want the serve error", evt.Error)
+		}
+		if want := evt.Timestamp.Add(s.backoff.delay(attempt)); !evt.NextRetry.Equal(want) {
+			t.Errorf("NextRetry = %s, want %s", evt.NextRetry, want)
+		}
+	}
+	if evt := nextStatus(t, statuses); evt.Status != events.ConnectionStatusConnected {
+		t.Fatalf("status = %s, want connected", evt.Status)
+	}
+
+	cancel()
+	<-done
+	if evt := nextStatus(t, statuses); evt.Status != events.ConnectionStatusDisconnected {
+		t.Fatalf("status = %s, want disconnected", evt.Status)
+	}
+
+	want := []time.Duration{time.Second, 2 * time.Second}
+	if len(*slept) != len(want) || (*slept)[0] != want[0] || (*slept)[1] != want[1] {
+		t.Errorf("slept %v, want %v", *slept, want)
+	}
+}
+
+func TestSupervisorPermanentFailure(t *testing.T) {
+	s, statuses, slept := newTestSupervisor(t)
+
+	s.connecting()
+	s.serve(context.Background(), func(context.Context) error {
+		return permanent(errors.New("tailscale handlers already registered"))
+	})
+
+	if evt := nextStatus(t, statuses); evt.Status != events.ConnectionStatusConnecting {
+		t.Fatalf("status = %s, want connecting", evt.Status)
+	}
+	evt := nextStatus(t, statuses)
+	if evt.Status != events.ConnectionStatusFailed {
+		t.Fatalf("status = %s, want failed", evt.Status)
+	}
+	if evt.Error != "tailscale handlers already registered" {
+		t.Errorf("Error = %q, want the unwrapped error", evt.Error)
+	}
+	if len(*slept) != 0 {
+		t.Errorf("slept %v, want no retry", *slept)
+	}
+}
+
+func TestWatchTailscale(t *testing.T) {
+	s, statuses, slept := newTestSupervisor(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	states := []string{"Starting", "NeedsLogin", "Running"}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watchTailscale(ctx, s, func(context.Context) (string, error) {
+			state := states[0]
+			if len(states) > 1 {
+				states = states[1:]
+			}
+			return state, nil
+		})
+	}()
+
+	want := []struct {
+		status  events.ConnectionStatus
+		attempt int
+	}{
+		{events.ConnectionStatusConnecting, 0},
+		{events.ConnectionStatusReconnecting, 1},
+		{events.ConnectionStatusReconnecting, 2},
+		{events.ConnectionStatusConnected, 0},
+	}
+	for _, w := range want {
+		evt := nextStatus(t, statuses)
+		if evt.Status != w.status || evt.Attempt != w.attempt {
+			t.Fatalf("status = %s attempt %d, want %s attempt %d", evt.Status, evt.Attempt, w.status, w.attempt)
+		}
+	}
+
+	cancel()
+	<-done
+	if evt := nextStatus(t, statuses); evt.Status != events.ConnectionStatusDisconnected {
+		t.Fatalf("status = %s, want disconnected", evt.Status)
+	}
+
+	if len(*slept) < 2 || (*slept)[0] != time.Second || (*slept)[1] != 2*time.Second {
+		t.Errorf("slept %v, want the backoff while not running", *slept)
+	}
+}
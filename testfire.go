@@ -0,0 +1,105 @@
+package z2mhomekit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/chasefleming/elem-go"
+	"github.com/chasefleming/elem-go/attrs"
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+// HandleTestFire test-fires a leak, smoke or contact sensor: its alert and
+// response plan run as if it had triggered, labelled as a test, and reset
+// after duration (a Go duration, default 30s). It serves both the web UI
+// (/testfire/{id}) and the API (/api/v1/testfire/{id}), which returns the
+// test as JSON.
+func (ws *WebServer) HandleTestFire(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deviceID := path.Base(r.URL.Path)
+	device, _, exists := ws.deviceProvider.Device(deviceID)
+	if !exists {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	var duration time.Duration
+	if v := r.FormValue("duration"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			http.Error(w, "Invalid duration", http.StatusBadRequest)
+			return
+		}
+		duration = d
+	}
+
+	actor := requestActor(r)
+	test, err := ws.controller.TestFire(r.Context(), deviceID, duration, actor)
+	switch {
+	case errors.Is(err, devices.ErrTestFireRunning), errors.Is(err, devices.ErrSensorAlarm):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ws.LogEvent(fmt.Sprintf("TEST: %s test-fired by %s until %s", device.Name, actor, test.Until.Format("15:04:05")))
+
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		http.Redirect(w, r, "/device/"+deviceID, http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(test); err != nil {
+		ws.logger.Error("Failed to write test-fire response", slog.Any("error", err))
+	}
+}
+
+// renderTestFireBanner renders the banner marking a sensor under test.
+func renderTestFireBanner(state devices.State) elem.Node {
+	if state.TestFire == nil {
+		return nil
+	}
+	return elem.Div(attrs.Props{attrs.Class: "test-fire"},
+		elem.Text(fmt.Sprintf("🧪 TEST by %s, resets at %s", state.TestFire.By, state.TestFire.Until.Format("15:04:05"))),
+	)
+}
+
+// renderTestFireForm renders the test-fire button of the device page for
+// sensors raising alerts.
+func renderTestFireForm(deviceID string, device devices.Device, state devices.State) elem.Node {
+	switch {
+	case device.Type == devices.DeviceTypeLeakSensor, device.Type == devices.DeviceTypeSmokeSensor:
+	case device.Type == devices.DeviceTypeContactSensor && device.AlertOnOpen:
+	default:
+		return nil
+	}
+	if state.TestFire != nil {
+		// The card shows the running test.
+		return nil
+	}
+
+	return elem.Form(attrs.Props{attrs.Class: "test-fire-form", attrs.Method: "post", attrs.Action: "/testfire/" + deviceID},
+		elem.Select(attrs.Props{attrs.Name: "duration"},
+			elem.Option(attrs.Props{attrs.Value: "30s"}, elem.Text("30 seconds")),
+			elem.Option(attrs.Props{attrs.Value: "2m"}, elem.Text("2 minutes")),
+			elem.Option(attrs.Props{attrs.Value: "5m"}, elem.Text("5 minutes")),
+		),
+		elem.Button(attrs.Props{
+			attrs.Type: "submit",
+			"onclick":  "return confirm('Trigger this sensor\\'s alert and response plan as a test?')",
+		}, elem.Text("Test-fire")),
+	)
+}
@@ -0,0 +1,65 @@
+package z2mhomekit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+func TestHandleTestFire(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ctrl := &fakeController{}
+	ws.controller = ctrl
+	ws.deviceProvider = fakeDeviceProvider{
+		"leak": {Device: devices.Device{ID: "leak", Name: "Sink leak", Type: devices.DeviceTypeLeakSensor}},
+	}
+
+	form := url.Values{"duration": {"2m"}}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/testfire/leak", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(context.WithValue(req.Context(), tokenNameKey{}, "ops"))
+	rec := httptest.NewRecorder()
+	ws.HandleTestFire(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("test-fire = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), `"by":"token ops"`) {
+		t.Errorf("test-fire response = %s, want by token ops", rec.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/testfire/leak", nil)
+	rec = httptest.NewRecorder()
+	ws.HandleTestFire(rec, req)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/device/leak" {
+		t.Errorf("web test-fire = %d to %q, want 303 to /device/leak", rec.Code, rec.Header().Get("Location"))
+	}
+
+	for path, want := range map[string]int{
+		"/testfire/missing":            http.StatusNotFound,
+		"/testfire/leak?duration=soon": http.StatusBadRequest,
+	} {
+		rec = httptest.NewRecorder()
+		ws.HandleTestFire(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		if rec.Code != want {
+			t.Errorf("%s = %d, want %d", path, rec.Code, want)
+		}
+	}
+
+	want := []string{"test-fire leak 2m0s by token ops", "test-fire leak 0s by web UI 192.0.2.1"}
+	if !slices.Equal(ctrl.calls, want) {
+		t.Errorf("controller calls = %v, want %v", ctrl.calls, want)
+	}
+
+	ws.eventLogMu.RLock()
+	last := ws.eventLog[len(ws.eventLog)-1]
+	ws.eventLogMu.RUnlock()
+	if !strings.Contains(last, "TEST: Sink leak test-fired by web UI 192.0.2.1") {
+		t.Errorf("event log = %q, want the test-fire labelled", last)
+	}
+}
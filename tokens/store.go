@@ -0,0 +1,277 @@
+// Package tokens manages named API tokens with scopes and expiry. Only a
+// hash of each token is persisted; the secret is shown once at creation.
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope limits what a token may do.
+type Scope string
+
+const (
+	// ScopeRead allows reading status and device state.
+	ScopeRead Scope = "read"
+	// ScopeControl allows sending commands to devices.
+	ScopeControl Scope = "control"
+	// ScopeAdmin allows everything, including configuration changes.
+	ScopeAdmin Scope = "admin"
+	// ScopeGuest allows the guest dashboard and its devices only.
+	ScopeGuest Scope = "guest"
+)
+
+// Scopes lists the known scopes in display order.
+var Scopes = []Scope{ScopeRead, ScopeControl, ScopeAdmin, ScopeGuest}
+
+// secretPrefix makes tokens recognisable in logs and secret scanners.
+const secretPrefix = "z2mh_"
+
+// lastUsedResolution limits how often token use is written to disk.
+const lastUsedResolution = time.Minute
+
+var (
+	// ErrInvalidToken is returned for unknown, revoked or malformed tokens.
+	ErrInvalidToken = errors.New("invalid API token")
+	// ErrExpired is returned for tokens past their expiry.
+	ErrExpired = errors.New("API token expired")
+	// ErrScope is returned when a token lacks the required scope.
+	ErrScope = errors.New("API token lacks the required scope")
+)
+
+// Token is the persisted metadata of an API token.
+type Token struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	Scopes    []Scope   `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	LastUsed  time.Time `json:"last_used,omitzero"`
+}
+
+// Expired reports whether the token has an expiry in the past.
+func (t Token) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && now.After(t.ExpiresAt)
+}
+
+// Allows reports whether the token grants scope.
+func (t Token) Allows(scope Scope) bool {
+	return slices.Contains(t.Scopes, ScopeAdmin) || slices.Contains(t.Scopes, scope)
+}
+
+// Store keeps tokens in a JSON file.
+type Store struct {
+	path   string
+	mu     sync.Mutex
+	tokens map[string]Token
+	now    func() time.Time
+}
+
+// Open loads the store at path. A missing file is an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:   path,
+		tokens: make(map[string]Token),
+		now:    time.Now,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token store: %w", err)
+	}
+
+	var list []Token
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse token store %q: %w", path, err)
+	}
+	for _, t := range list {
+		s.tokens[t.ID] = t
+	}
+
+	return s, nil
+}
+
+// Enabled reports whether any token exists. APIs stay open until the first
+// token is created.
+func (s *Store) Enabled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tokens) > 0
+}
+
+// List returns the tokens sorted by creation time.
+func (s *Store) List() []Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Token, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Create adds a token and returns it with its secret. A zero ttl never
+// expires.
+func (s *Store) Create(name string, scopes []Scope, ttl time.Duration) (Token, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Token{}, "", fmt.Errorf("token name is required")
+	}
+	if len(scopes) == 0 {
+		return Token{}, "", fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return Token{}, "", fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	if ttl < 0 {
+		return Token{}, "", fmt.Errorf("expiry cannot be negative")
+	}
+
+	id, err := randomString(6, hex.EncodeToString)
+	if err != nil {
+		return Token{}, "", err
+	}
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return Token{}, "", err
+	}
+	secret = secretPrefix + secret
+
+	now := s.now()
+	t := Token{
+		ID:        id,
+		Name:      name,
+		Hash:      hashSecret(secret),
+		Scopes:    slices.Clone(scopes),
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		t.ExpiresAt = now.Add(ttl)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[id] = t
+	if err := s.saveLocked(); err != nil {
+		delete(s.tokens, id)
+		return Token{}, "", err
+	}
+
+	return t, secret, nil
+}
+
+// Revoke deletes the token with id.
+func (s *Store) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[id]
+	if !ok {
+		return fmt.Errorf("token %q not found", id)
+	}
+
+	delete(s.tokens, id)
+	if err := s.saveLocked(); err != nil {
+		s.tokens[id] = t
+		return err
+	}
+	return nil
+}
+
+// Authenticate checks secret against the store and records its use.
+func (s *Store) Authenticate(secret string, scope Scope) (Token, error) {
+	if !strings.HasPrefix(secret, secretPrefix) {
+		return Token{}, ErrInvalidToken
+	}
+	hash := hashSecret(secret)
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, t := range s.tokens {
+		if t.Hash != hash {
+			continue
+		}
+		if t.Expired(now) {
+			return t, ErrExpired
+		}
+		if !t.Allows(scope) {
+			return t, ErrScope
+		}
+
+		if now.Sub(t.LastUsed) >= lastUsedResolution {
+			t.LastUsed = now
+			s.tokens[id] = t
+			// Failing to record last use must not reject a valid token.
+			_ = s.saveLocked()
+		}
+		return t, nil
+	}
+
+	return Token{}, ErrInvalidToken
+}
+
+func (s *Store) saveLocked() error {
+	list := make([]Token, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode token store: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create token store directory: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write token store: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write token store: %w", err)
+	}
+	return nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return encode(b), nil
+}
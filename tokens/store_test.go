@@ -0,0 +1,94 @@
+package tokens
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCreateAuthenticateRevoke(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if store.Enabled() {
+		t.Fatal("empty store reports Enabled")
+	}
+
+	tok, secret, err := store.Create("grafana", []Scope{ScopeRead}, 0)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if _, err := store.Authenticate(secret, ScopeRead); err != nil {
+		t.Errorf("Authenticate(read) error = %v", err)
+	}
+	if _, err := store.Authenticate(secret, ScopeControl); !errors.Is(err, ErrScope) {
+		t.Errorf("Authenticate(control) error = %v, want ErrScope", err)
+	}
+	if _, err := store.Authenticate("z2mh_wrong", ScopeRead); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Authenticate(wrong) error = %v, want ErrInvalidToken", err)
+	}
+
+	// Reopen from disk: the token and its last use survive.
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	list := reopened.List()
+	if len(list) != 1 || list[0].ID != tok.ID || list[0].LastUsed.IsZero() {
+		t.Fatalf("List() after reopen = %+v", list)
+	}
+	if list[0].Hash == secret {
+		t.Fatal("secret stored in plaintext")
+	}
+
+	if err := reopened.Revoke(tok.ID); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if _, err := reopened.Authenticate(secret, ScopeRead); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Authenticate(revoked) error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	_, secret, err := store.Create("temp", []Scope{ScopeAdmin}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Authenticate(secret, ScopeControl); err != nil {
+		t.Errorf("admin token rejected for control: %v", err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := store.Authenticate(secret, ScopeRead); !errors.Is(err, ErrExpired) {
+		t.Errorf("Authenticate() error = %v, want ErrExpired", err)
+	}
+}
+
+func TestCreateValidation(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := store.Create("", []Scope{ScopeRead}, 0); err == nil {
+		t.Error("Create() accepted an empty name")
+	}
+	if _, _, err := store.Create("x", nil, 0); err == nil {
+		t.Error("Create() accepted no scopes")
+	}
+	if _, _, err := store.Create("x", []Scope{"root"}, 0); err == nil {
+		t.Error("Create() accepted an unknown scope")
+	}
+}
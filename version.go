@@ -0,0 +1,88 @@
+package z2mhomekit
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set via -ldflags "-X github.com/kradalby/z2m-homekit.version=..." and
+// friends. Commit and build date fall back to the VCS information embedded by
+// the Go toolchain.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+func buildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value
+				}
+			}
+		}
+	}
+
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+
+	return info
+}
+
+// firmwareRevision returns the version in a form HomeKit accepts for
+// FirmwareRevision, which must look like x[.y[.z]]. Anything else, such as
+// "dev" or a git hash, is reported as 0.0.0.
+func firmwareRevision(v string) string {
+	if len(v) > 0 && v[0] == 'v' {
+		v = v[1:]
+	}
+
+	parts := 0
+	digits := 0
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; {
+		case c >= '0' && c <= '9':
+			digits++
+		case c == '.' && digits > 0 && parts < 2:
+			parts++
+			digits = 0
+		default:
+			// Drop pre-release or build suffixes like -rc1 or +dirty.
+			if (c == '-' || c == '+') && digits > 0 {
+				return v[:i]
+			}
+			return "0.0.0"
+		}
+	}
+	if digits == 0 {
+		return "0.0.0"
+	}
+
+	return v
+}
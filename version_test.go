@@ -0,0 +1,28 @@
+package z2mhomekit
+
+import "testing"
+
+func TestFirmwareRevision(t *testing.T) {
+	tests := map[string]string{
+		"1.2.3":       "1.2.3",
+		"v1.4":        "1.4",
+		"2":           "2",
+		"v1.2.3-rc1":  "1.2.3",
+		"1.2.3+dirty": "1.2.3",
+		// Versions built by the flake, from a clean and a dirty tree.
+		"0.1.0+3f2a9c1":       "0.1.0",
+		"0.1.0+3f2a9c1-dirty": "0.1.0",
+		"dev":                 "0.0.0",
+		"":                    "0.0.0",
+		"1.2.3.4":             "0.0.0",
+		"1..2":                "0.0.0",
+		"1.":                  "0.0.0",
+		"3f2a9c1d8e":          "0.0.0",
+	}
+
+	for in, want := range tests {
+		if got := firmwareRevision(in); got != want {
+			t.Errorf("firmwareRevision(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
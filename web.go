@@ -6,9 +6,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -18,6 +22,8 @@ import (
 	"github.com/kradalby/kra/web"
 	"github.com/kradalby/z2m-homekit/devices"
 	"github.com/kradalby/z2m-homekit/events"
+	"github.com/kradalby/z2m-homekit/tokens"
+	mqtt "github.com/mochi-mqtt/server/v2"
 	"tailscale.com/util/eventbus"
 )
 
@@ -33,121 +39,280 @@ type deviceStateProvider interface {
 		State  devices.State
 	}
 	Device(string) (devices.Device, devices.State, bool)
+	Groups() []devices.Group
 }
 
 type DeviceController interface {
 	SetPower(ctx context.Context, deviceID string, on bool) error
 	SetBrightness(ctx context.Context, deviceID string, brightness int) error
+	SetColor(ctx context.Context, deviceID string, hue, saturation float64) error
+	SetColorTemp(ctx context.Context, deviceID string, colorTemp int) error
+	SetCoverPosition(ctx context.Context, deviceID string, position int) error
+	SetArmMode(ctx context.Context, deviceID string, mode devices.ArmMode) error
+	SetSiren(ctx context.Context, deviceID string, on bool) error
+	StartDimming(ctx context.Context, deviceID string, up bool) error
+	StopDimming(ctx context.Context, deviceID string) error
+	AcknowledgeLeak(ctx context.Context, valveID string) error
+	SmokeDrill(ctx context.Context, live bool) ([]string, error)
+	AcknowledgeAlert(deviceID, by string) (devices.AlertAck, error)
+	TestFire(ctx context.Context, sensorID string, d time.Duration, by string) (devices.TestFire, error)
+	CalibrateCover(ctx context.Context, deviceID string, action devices.CoverCalibration, by string) (devices.Calibration, error)
+	NightModeConfigured() bool
+	NightModeActive() bool
+	SetNightMode(on bool) error
+	SetGroupPower(ctx context.Context, groupID string, on bool) error
+	Scenes() []devices.Scene
+	RecallScene(sceneID string) error
+	SaveScene(name string, deviceIDs []string) (devices.Scene, error)
+	DeleteScene(sceneID string) error
+	CanSaveScenes() bool
+	SetDeviceDisabled(deviceID string, disabled bool) error
+	UpdateFirmware(deviceID string) error
+	PermitJoin(d time.Duration) error
+	PermitJoinRemaining() time.Duration
+	SubmitCommand(cmd devices.CommandEvent) error
 }
 
 // WebServer manages the web UI
 type WebServer struct {
-	logger           *slog.Logger
-	kraweb           *web.KraWeb
-	deviceProvider   deviceStateProvider
-	controller       DeviceController
-	eventLog         []string
-	eventBus         *events.Bus
-	client           *eventbus.Client
-	stateSubscriber  *eventbus.Subscriber[events.StateUpdateEvent]
-	statusSubscriber *eventbus.Subscriber[events.ConnectionStatusEvent]
-	currentState     map[string]events.StateUpdateEvent
-	connectionState  map[string]events.ConnectionStatusEvent
-	stateMu          sync.RWMutex
-	statusMu         sync.RWMutex
-	sseClients       map[chan events.StateUpdateEvent]struct{}
-	sseClientsMu     sync.RWMutex
-	hapPin           string
-	qrCode           string
-	hapManager       *HAPManager
-	ctx              context.Context
+	logger          *slog.Logger
+	kraweb          *web.KraWeb
+	mux             *http.ServeMux
+	listenAddr      string
+	serveDone       chan struct{}
+	supervisor      *supervisor
+	tailscale       bool
+	deviceProvider  deviceStateProvider
+	controller      DeviceController
+	eventLog        []string
+	eventLogMu      sync.RWMutex
+	eventBus        *events.Bus
+	client          *eventbus.Client
+	stateSubscriber *eventbus.Subscriber[events.StateUpdateEvent]
+	alertSubscriber *eventbus.Subscriber[events.AlertEvent]
+	seenSubscriber  *eventbus.Subscriber[events.DeviceSeenEvent]
+	currentState    map[string]events.StateUpdateEvent
+	stateMu         sync.RWMutex
+	sseClients      map[chan sseEvent]struct{}
+	sseClientsMu    sync.RWMutex
+	sseHistory      *sseReplayBuffer
+	hapPin          string
+	qrCode          string
+	hapManager      *HAPManager
+	mqttServer      *mqtt.Server
+	tokenStore      *tokens.Store
+	webAuth         WebAuth
+	journal         *EventJournal
+	history         *History
+	configSnapshots *ConfigSnapshots
+	rollbackConfig  func(id string) (devices.DeviceChanges, error)
+	applyConfig     func(data []byte, dryRun bool, source string) (ConfigPlanResponse, error)
+	inventory       func() devices.Inventory
+	guests          tokenBuckets
+	widgets         []string
+	clock           devices.Clock
+	ctx             context.Context
 }
 
 // NewWebServer creates a new web server
-func NewWebServer(logger *slog.Logger, deviceProvider deviceStateProvider, controller DeviceController, bus *events.Bus, kraweb *web.KraWeb, hapPin, qrCode string, hapManager *HAPManager) *WebServer {
+func NewWebServer(logger *slog.Logger, deviceProvider deviceStateProvider, controller DeviceController, bus *events.Bus, kraweb *web.KraWeb, listenAddr, hapPin, qrCode string, hapManager *HAPManager) *WebServer {
 	client, err := bus.Client(events.ClientWeb)
 	if err != nil {
 		panic(fmt.Sprintf("failed to create web client: %v", err))
 	}
 
-	return &WebServer{
-		logger:           logger,
-		kraweb:           kraweb,
-		deviceProvider:   deviceProvider,
-		controller:       controller,
-		eventLog:         make([]string, 0, 100),
-		eventBus:         bus,
-		client:           client,
-		stateSubscriber:  eventbus.Subscribe[events.StateUpdateEvent](client),
-		statusSubscriber: eventbus.Subscribe[events.ConnectionStatusEvent](client),
-		currentState:     make(map[string]events.StateUpdateEvent),
-		connectionState:  make(map[string]events.ConnectionStatusEvent),
-		sseClients:       make(map[chan events.StateUpdateEvent]struct{}),
-		hapPin:           hapPin,
-		qrCode:           qrCode,
-		hapManager:       hapManager,
-		ctx:              context.Background(),
-	}
+	ws := &WebServer{
+		logger:          logger,
+		kraweb:          kraweb,
+		mux:             http.NewServeMux(),
+		listenAddr:      listenAddr,
+		deviceProvider:  deviceProvider,
+		controller:      controller,
+		eventLog:        make([]string, 0, 100),
+		eventBus:        bus,
+		client:          client,
+		stateSubscriber: eventbus.Subscribe[events.StateUpdateEvent](client),
+		alertSubscriber: eventbus.Subscribe[events.AlertEvent](client),
+		seenSubscriber:  eventbus.Subscribe[events.DeviceSeenEvent](client),
+		currentState:    make(map[string]events.StateUpdateEvent),
+		sseClients:      make(map[chan sseEvent]struct{}),
+		sseHistory:      newSSEReplayBuffer(sseReplaySize),
+		hapPin:          hapPin,
+		qrCode:          qrCode,
+		hapManager:      hapManager,
+		widgets:         allWidgets,
+		clock:           devices.WallClock{},
+		ctx:             context.Background(),
+		supervisor:      newSupervisor(string(events.ClientWeb), bus, client, logger),
+	}
+
+	return ws
+}
+
+// SetClock sets the clock device freshness is judged by, e.g. the
+// simulated clock.
+func (ws *WebServer) SetClock(clock devices.Clock) {
+	ws.clock = clock
+}
+
+// SetMQTTServer gives the status API access to the embedded broker.
+func (ws *WebServer) SetMQTTServer(s *mqtt.Server) {
+	ws.mqttServer = s
 }
 
 // LogEvent adds an event to the log
 func (ws *WebServer) LogEvent(event string) {
+	ws.eventLogMu.Lock()
+	defer ws.eventLogMu.Unlock()
+
 	ws.eventLog = append(ws.eventLog, fmt.Sprintf("%s: %s", time.Now().Format("15:04:05"), event))
 	if len(ws.eventLog) > 100 {
 		ws.eventLog = ws.eventLog[1:]
 	}
 }
 
-func (ws *WebServer) Start(ctx context.Context) {
+// Start begins processing events and serving the web UI. It returns once the
+// local listener is bound, or an error if it cannot be.
+func (ws *WebServer) Start(ctx context.Context) error {
 	ws.ctx = ctx
 	go ws.processStateChanges(ctx)
-	go ws.processConnectionStatuses(ctx)
-	ws.publishConnectionStatus(events.ConnectionStatusConnecting, "")
+	go ws.processAlerts(ctx)
+	ws.supervisor.connecting()
+
+	if ws.kraweb == nil {
+		return nil
+	}
 
+	ws.logger.Info("Starting web interface", "addr", ws.listenAddr)
+
+	// The first start must succeed; later failures are restarted by the
+	// supervisor when that is safe.
+	ready := make(chan error, 1)
+	started := false
+	ws.serveDone = make(chan struct{})
 	go func() {
-		if ws.kraweb == nil {
-			return
-		}
-		ws.logger.Info("Starting web interface")
-		ws.publishConnectionStatus(events.ConnectionStatusConnected, "")
-		if err := ws.kraweb.ListenAndServe(ctx); err != nil {
-			ws.logger.Error("Web server error", slog.Any("error", err))
-			if errors.Is(err, context.Canceled) {
-				ws.publishConnectionStatus(events.ConnectionStatusDisconnected, "")
-			} else {
-				ws.publishConnectionStatus(events.ConnectionStatusFailed, err.Error())
+		defer close(ws.serveDone)
+		ws.supervisor.serve(ctx, func(ctx context.Context) error {
+			err := ws.listenAndServe(ctx, func() {
+				if !started {
+					started = true
+					ready <- nil
+				}
+			})
+			switch {
+			case !started:
+				ready <- err
+				return permanent(err)
+			case err != nil && ws.tailscale:
+				return permanent(err)
 			}
-			return
-		}
-		ws.publishConnectionStatus(events.ConnectionStatusDisconnected, "")
+			return err
+		})
+	}()
+
+	return <-ready
+}
+
+// SetTailscale makes the web server serve over Tailscale too, next to the
+// local listener. kraweb registers its Tailscale handlers on every
+// ListenAndServe, so the supervisor only restarts a web server without
+// Tailscale.
+func (ws *WebServer) SetTailscale(enabled bool) {
+	ws.tailscale = enabled
+}
+
+// Handle registers a handler on the local listener and, through kraweb,
+// on Tailscale.
+func (ws *WebServer) Handle(pattern string, handler http.Handler) {
+	ws.mux.Handle(pattern, handler)
+	if ws.kraweb != nil {
+		ws.kraweb.HandleTSOnly(pattern, handler)
+	}
+}
+
+// localMux registers handlers on the local listener only, for routes
+// kraweb already serves over Tailscale.
+type localMux struct {
+	ws *WebServer
+}
+
+func (m localMux) Handle(pattern string, handler http.Handler) {
+	m.ws.mux.Handle(pattern, handler)
+}
+
+// handleMetrics serves /metrics on the local listener, behind the web auth
+// and taking read tokens unless public. kraweb serves its own over
+// Tailscale.
+func (ws *WebServer) handleMetrics(metrics http.Handler, public bool) {
+	if public {
+		localMux{ws: ws}.Handle("/metrics", metrics)
+		return
+	}
+	authMux{mux: localMux{ws: ws}, ws: ws}.Handle("/metrics", ws.requireSessionOrScope(tokens.ScopeRead, metrics.ServeHTTP))
+}
+
+// listenAndServe runs the web server until it stops, calling up once the
+// local listener is bound.
+func (ws *WebServer) listenAndServe(ctx context.Context, up func()) error {
+	ln, err := net.Listen("tcp", ws.listenAddr)
+	if err != nil {
+		return fmt.Errorf("web listener %s: %w", ws.listenAddr, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	srv := &http.Server{
+		Handler:     ws.mux,
+		ReadTimeout: 5 * time.Minute,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Shutdown(context.Background())
 	}()
+
+	serveErr := make(chan error, 2)
+	go func() {
+		serveErr <- srv.Serve(ln)
+	}()
+	if ws.tailscale {
+		go func() {
+			serveErr <- ws.kraweb.ListenAndServe(ctx)
+		}()
+	}
+
+	ws.supervisor.up()
+	up()
+
+	err = <-serveErr
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		ws.logger.Error("Web server error", slog.Any("error", err))
+	}
+	return err
 }
 
+// Close releases subscriptions and SSE clients. If the web UI was started,
+// it waits for the listener to shut down, so cancel the Start context first.
 func (ws *WebServer) Close() {
+	if ws.serveDone != nil {
+		<-ws.serveDone
+	}
+
 	ws.stateSubscriber.Close()
-	ws.statusSubscriber.Close()
+	ws.alertSubscriber.Close()
+	ws.seenSubscriber.Close()
 
 	ws.sseClientsMu.Lock()
 	for client := range ws.sseClients {
 		close(client)
 	}
-	ws.sseClients = make(map[chan events.StateUpdateEvent]struct{})
+	ws.sseClients = make(map[chan sseEvent]struct{})
 	ws.sseClientsMu.Unlock()
 }
 
-func (ws *WebServer) publishConnectionStatus(status events.ConnectionStatus, errMsg string) {
-	if ws.eventBus == nil || ws.client == nil {
-		return
-	}
-
-	ws.eventBus.PublishConnectionStatus(ws.client, events.ConnectionStatusEvent{
-		Timestamp: time.Now(),
-		Component: "web",
-		Status:    status,
-		Error:     errMsg,
-	})
-}
-
 func (ws *WebServer) processStateChanges(ctx context.Context) {
 	for {
 		select {
@@ -158,19 +323,41 @@ func (ws *WebServer) processStateChanges(ctx context.Context) {
 
 			ws.logger.Debug("Web UI: State change received", "device_id", event.DeviceID)
 			ws.broadcastSSE(event)
+		case seen := <-ws.seenSubscriber.Events():
+			// Keep last seen and link quality ticking on the cards while
+			// the state itself is unchanged.
+			ws.stateMu.Lock()
+			current, ok := ws.currentState[seen.DeviceID]
+			if ok {
+				current = current.WithSeen(seen)
+				ws.currentState[seen.DeviceID] = current
+			}
+			ws.stateMu.Unlock()
+			if ok {
+				ws.broadcastSSE(current)
+			}
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func (ws *WebServer) processConnectionStatuses(ctx context.Context) {
+func (ws *WebServer) processAlerts(ctx context.Context) {
 	for {
 		select {
-		case event := <-ws.statusSubscriber.Events():
-			ws.statusMu.Lock()
-			ws.connectionState[event.Component] = event
-			ws.statusMu.Unlock()
+		case event := <-ws.alertSubscriber.Events():
+			if event.Silenced {
+				ws.logger.Debug("Alert silenced by night mode", "device_id", event.DeviceID, "kind", event.Kind)
+				continue
+			}
+			prefix := "Alert"
+			switch {
+			case event.AcknowledgedBy != "":
+				prefix = "Acknowledged"
+			case !event.Active:
+				prefix = "Resolved"
+			}
+			ws.LogEvent(fmt.Sprintf("%s: %s (%s): %s", prefix, event.Name, event.DeviceID, event.Message))
 		case <-ctx.Done():
 			return
 		}
@@ -178,12 +365,15 @@ func (ws *WebServer) processConnectionStatuses(ctx context.Context) {
 }
 
 func (ws *WebServer) broadcastSSE(event events.StateUpdateEvent) {
-	ws.sseClientsMu.RLock()
-	defer ws.sseClientsMu.RUnlock()
+	// Hold the write lock so numbering and delivery are atomic with respect
+	// to clients registering in HandleSSE.
+	ws.sseClientsMu.Lock()
+	defer ws.sseClientsMu.Unlock()
 
+	e := ws.sseHistory.Add(event)
 	for client := range ws.sseClients {
 		select {
-		case client <- event:
+		case client <- e:
 		default:
 		}
 	}
@@ -205,20 +395,10 @@ func (ws *WebServer) snapshotState() []events.StateUpdateEvent {
 	return snapshot
 }
 
+// snapshotStatuses returns the component statuses, sorted by component,
+// from the eventbus's connection state machine.
 func (ws *WebServer) snapshotStatuses() []events.ConnectionStatusEvent {
-	ws.statusMu.RLock()
-	defer ws.statusMu.RUnlock()
-
-	statuses := make([]events.ConnectionStatusEvent, 0, len(ws.connectionState))
-	for _, evt := range ws.connectionState {
-		statuses = append(statuses, evt)
-	}
-
-	sort.Slice(statuses, func(i, j int) bool {
-		return statuses[i].Component < statuses[j].Component
-	})
-
-	return statuses
+	return ws.eventBus.ConnectionStatuses()
 }
 
 func (ws *WebServer) renderPage(title string, content elem.Node) string {
@@ -233,48 +413,54 @@ func (ws *WebServer) renderPage(title string, content elem.Node) string {
 			elem.Style(attrs.Props{}, elem.Text(cssContent)),
 			elem.Script(attrs.Props{}, elem.Raw(jsContent)),
 		),
-		elem.Body(attrs.Props{}, content),
+		elem.Body(attrs.Props{},
+			content,
+			ws.renderFooter(),
+		),
 	)
 	return page.Render()
 }
 
+func (ws *WebServer) renderFooter() elem.Node {
+	info := buildInfo()
+	commit := info.Commit
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+
+	links := []elem.Node{
+		elem.Text(fmt.Sprintf("z2m-homekit %s · %s · built %s · up %s (%s) · ",
+			info.Version, commit, info.BuildDate, time.Since(processStart).Round(time.Minute), lifecycle.RestartCause())),
+		elem.A(attrs.Props{attrs.Href: "/all"}, elem.Text("All devices")),
+		elem.Text(" · "),
+		elem.A(attrs.Props{attrs.Href: "/scenes"}, elem.Text("Scenes")),
+		elem.Text(" · "),
+	}
+	if ws.inventory != nil {
+		links = append(links,
+			elem.A(attrs.Props{attrs.Href: "/inventory"}, elem.Text("Inventory")),
+			elem.Text(" · "),
+		)
+	}
+	if ws.configSnapshots != nil {
+		links = append(links,
+			elem.A(attrs.Props{attrs.Href: "/config/snapshots"}, elem.Text("Config history")),
+			elem.Text(" · "),
+		)
+	}
+	links = append(links,
+		elem.A(attrs.Props{attrs.Href: "/tokens"}, elem.Text("API tokens")),
+		elem.Text(" · "),
+		elem.A(attrs.Props{attrs.Href: "/api/docs"}, elem.Text("API docs")),
+	)
+	return elem.Footer(attrs.Props{attrs.Class: "footer"}, links...)
+}
+
 func (ws *WebServer) renderDeviceCard(deviceID string, info devices.Device, state devices.State) elem.Node {
 	statusClass := "sensor"
 	icon := ws.getDeviceIcon(info.Type)
 
-	var connectionIndicator, connectionText string
-	if state.LastSeen.IsZero() {
-		connectionIndicator = "disconnected"
-		connectionText = "Never seen"
-	} else {
-		timeSinceSeen := time.Since(state.LastSeen)
-		if timeSinceSeen < 30*time.Second {
-			connectionIndicator = "connected"
-			connectionText = fmt.Sprintf("Last seen: %s ago", timeSinceSeen.Round(time.Second))
-		} else if timeSinceSeen < 60*time.Second {
-			connectionIndicator = "stale"
-			connectionText = fmt.Sprintf("Last seen: %s ago", timeSinceSeen.Round(time.Second))
-		} else {
-			connectionIndicator = "disconnected"
-			connectionText = fmt.Sprintf("Last seen: %s ago", timeSinceSeen.Round(time.Second))
-		}
-	}
-
-	cardChildren := []elem.Node{
-		elem.Div(attrs.Props{attrs.Class: "device-header"},
-			elem.Div(attrs.Props{attrs.Class: "device-icon"}, elem.Text(icon)),
-			elem.Div(attrs.Props{attrs.Class: "device-info"},
-				elem.Div(attrs.Props{attrs.Class: "device-name"}, elem.Text(info.Name)),
-				elem.Div(attrs.Props{attrs.Class: "device-status"},
-					elem.Div(attrs.Props{"data-role": "last-updated"}, elem.Text(fmt.Sprintf("Last updated: %s", state.LastUpdated.Format("15:04:05")))),
-				),
-				elem.Div(attrs.Props{attrs.Class: "connection-status"},
-					elem.Span(attrs.Props{"data-role": "connection-indicator", attrs.Class: "connection-indicator " + connectionIndicator}),
-					elem.Span(attrs.Props{"data-role": "connection-text"}, elem.Text(connectionText)),
-				),
-			),
-		),
-	}
+	cardChildren := []elem.Node{ws.renderDeviceHeader(deviceID, icon, info, state, "")}
 
 	switch info.Type {
 	case devices.DeviceTypeClimateSensor:
@@ -293,6 +479,24 @@ func (ws *WebServer) renderDeviceCard(deviceID string, info devices.Device, stat
 		statusClass, cardChildren = ws.renderOutlet(deviceID, info, state, cardChildren)
 	case devices.DeviceTypeFan:
 		statusClass, cardChildren = ws.renderFan(deviceID, info, state, cardChildren)
+	case devices.DeviceTypeCover:
+		statusClass, cardChildren = ws.renderCover(deviceID, info, state, cardChildren)
+	case devices.DeviceTypeSecuritySystem:
+		statusClass, cardChildren = ws.renderSecuritySystem(deviceID, info, state, cardChildren)
+	}
+
+	if test := renderTestFireBanner(state); test != nil {
+		cardChildren = append(cardChildren, test)
+	}
+	if alert := ws.renderAlertAck(deviceID, info, state); alert != nil {
+		cardChildren = append(cardChildren, alert)
+	}
+	if notes := renderDeviceNotes(info); notes != nil {
+		cardChildren = append(cardChildren, notes)
+	}
+	cardChildren = append(cardChildren, ws.renderFirmwareUpdate(deviceID, state), ws.renderDisable(deviceID, state))
+	if state.Disabled != nil {
+		statusClass += " disabled"
 	}
 
 	return elem.Div(
@@ -325,6 +529,14 @@ func (ws *WebServer) getDeviceIcon(deviceType devices.DeviceType) string {
 		return "🔘"
 	case devices.DeviceTypeFan:
 		return "🌀"
+	case devices.DeviceTypeCover:
+		return "🪟"
+	case devices.DeviceTypeButton:
+		return "🎛️"
+	case devices.DeviceTypeSecuritySystem:
+		return "🚨"
+	case devices.DeviceTypeDoorbell:
+		return "🔔"
 	default:
 		return "📱"
 	}
@@ -340,10 +552,22 @@ func (ws *WebServer) renderClimateSensor(info devices.Device, state devices.Stat
 				elem.Span(attrs.Props{attrs.Class: "sensor-value", "data-role": "temperature-value"},
 					elem.Text(fmt.Sprintf("%.1f °C", *state.Temperature)),
 				),
+				ws.renderAnomaly(state, "Temperature"),
 			),
 		)
 	}
 
+	if state.FrostWarning != nil && *state.FrostWarning {
+		items = append(items, elem.Div(attrs.Props{attrs.Class: "climate-warning frost"},
+			elem.Text(fmt.Sprintf("❄ Frost warning: below %.1f °C", *info.FrostBelow)),
+		))
+	}
+	if state.HeatWarning != nil && *state.HeatWarning {
+		items = append(items, elem.Div(attrs.Props{attrs.Class: "climate-warning heat"},
+			elem.Text(fmt.Sprintf("🔥 Heat warning: above %.1f °C", *info.HeatAbove)),
+		))
+	}
+
 	if info.Features.Humidity && state.Humidity != nil {
 		items = append(items,
 			elem.Div(attrs.Props{attrs.Class: "sensor-value-item"},
@@ -351,6 +575,7 @@ func (ws *WebServer) renderClimateSensor(info devices.Device, state devices.Stat
 				elem.Span(attrs.Props{attrs.Class: "sensor-value", "data-role": "humidity-value"},
 					elem.Text(fmt.Sprintf("%.1f %%", *state.Humidity)),
 				),
+				ws.renderAnomaly(state, "Humidity"),
 			),
 		)
 	}
@@ -373,6 +598,10 @@ func (ws *WebServer) renderClimateSensor(info devices.Device, state devices.Stat
 				elem.Span(attrs.Props{attrs.Class: "sensor-value", "data-role": "pressure-value"},
 					elem.Text(fmt.Sprintf("%.1f hPa", *state.Pressure)),
 				),
+				elem.Span(attrs.Props{attrs.Class: "pressure-trend", "data-role": "pressure-trend"},
+					elem.Text(state.PressureTrend.Symbol()),
+				),
+				ws.renderAnomaly(state, "Pressure"),
 			),
 		)
 	}
@@ -380,6 +609,70 @@ func (ws *WebServer) renderClimateSensor(info devices.Device, state devices.Stat
 	return elem.Div(attrs.Props{attrs.Class: "sensor-values"}, items...)
 }
 
+// renderAnomaly marks a sensor value whose latest reading was rejected as
+// anomalous. The displayed value is the last good reading.
+func (ws *WebServer) renderAnomaly(state devices.State, field string) elem.Node {
+	reason, ok := state.Anomalies[field]
+	if !ok {
+		return nil
+	}
+
+	return elem.Span(attrs.Props{
+		attrs.Class: "anomaly",
+		attrs.Title: reason + " (showing last good value)",
+	}, elem.Text("⚠"))
+}
+
+// renderWeatherCard renders a virtual sensor summarising the pressure trend
+// of the first pressure sensor with enough history. It returns nil when no
+// sensor has a trend yet.
+func (ws *WebServer) renderWeatherCard(snapshot map[string]struct {
+	Device devices.Device
+	State  devices.State
+},
+) elem.Node {
+	for _, id := range sortedDeviceIDs(snapshot, sortByID, "") {
+		item := snapshot[id]
+		if !onDashboard(item.Device) {
+			continue
+		}
+		state := item.State
+		if state.PressureTrend == devices.PressureTrendUnknown || state.Pressure == nil || state.PressureChange == nil {
+			continue
+		}
+
+		return elem.Div(attrs.Props{attrs.ID: "weather", attrs.Class: "device sensor weather", "data-weather-source": id},
+			elem.Div(attrs.Props{attrs.Class: "device-header"},
+				elem.Div(attrs.Props{attrs.Class: "device-icon"}, elem.Text("🌦️")),
+				elem.Div(attrs.Props{attrs.Class: "device-info"},
+					elem.Div(attrs.Props{attrs.Class: "device-name"}, elem.Text("Weather")),
+					elem.Div(attrs.Props{attrs.Class: "device-status"}, elem.Text("From "+item.Device.Name)),
+				),
+			),
+			elem.Div(attrs.Props{attrs.Class: "sensor-values"},
+				elem.Div(attrs.Props{attrs.Class: "sensor-value-item"},
+					elem.Span(attrs.Props{attrs.Class: "sensor-label"}, elem.Text("Forecast:")),
+					elem.Span(attrs.Props{attrs.Class: "sensor-value", "data-role": "forecast-value"}, elem.Text(state.PressureForecast)),
+				),
+				elem.Div(attrs.Props{attrs.Class: "sensor-value-item"},
+					elem.Span(attrs.Props{attrs.Class: "sensor-label"}, elem.Text("Trend:")),
+					elem.Span(attrs.Props{attrs.Class: "sensor-value", "data-role": "trend-value"},
+						elem.Text(fmt.Sprintf("%s %s (%+.1f hPa/3h)", state.PressureTrend.Symbol(), state.PressureTrend, *state.PressureChange)),
+					),
+				),
+				elem.Div(attrs.Props{attrs.Class: "sensor-value-item"},
+					elem.Span(attrs.Props{attrs.Class: "sensor-label"}, elem.Text("Pressure:")),
+					elem.Span(attrs.Props{attrs.Class: "sensor-value", "data-role": "pressure-value"},
+						elem.Text(fmt.Sprintf("%.1f hPa", *state.Pressure)),
+					),
+				),
+			),
+		)
+	}
+
+	return nil
+}
+
 func (ws *WebServer) renderOccupancySensor(info devices.Device, state devices.State) elem.Node {
 	var items []elem.Node
 
@@ -546,17 +839,7 @@ func (ws *WebServer) renderFan(deviceID string, info devices.Device, state devic
 		buttonAction = "off"
 	}
 
-	cardChildren[0] = elem.Div(attrs.Props{attrs.Class: "device-header"},
-		elem.Div(attrs.Props{attrs.Class: "device-icon"}, elem.Text("🌀")),
-		elem.Div(attrs.Props{attrs.Class: "device-info"},
-			elem.Div(attrs.Props{attrs.Class: "device-name"}, elem.Text(info.Name)),
-			elem.Div(attrs.Props{attrs.Class: "device-status"},
-				elem.Div(attrs.Props{"data-role": "status-label"}, elem.Text(fmt.Sprintf("Status: %s", statusText))),
-				elem.Div(attrs.Props{"data-role": "last-updated"}, elem.Text(fmt.Sprintf("Last updated: %s", state.LastUpdated.Format("15:04:05")))),
-			),
-			ws.renderConnectionStatus(state),
-		),
-	)
+	cardChildren[0] = ws.renderDeviceHeader(deviceID, "🌀", info, state, statusText)
 
 	// Add fan controls if speed feature is enabled
 	if info.Features.Speed && state.FanSpeed != nil {
@@ -572,6 +855,24 @@ func (ws *WebServer) renderFan(deviceID string, info devices.Device, state devic
 		)
 	}
 
+	if state.Lockout != nil {
+		sensor := state.Lockout.Sensor
+		if d, _, ok := ws.deviceProvider.Device(sensor); ok {
+			sensor = d.Name
+		}
+		cardChildren = append(cardChildren, elem.Div(attrs.Props{attrs.Class: "leak-lockout"},
+			elem.Div(attrs.Props{}, elem.Text(fmt.Sprintf("🚱 Closed by a leak at %s (%s)", state.Lockout.Since.Format("15:04:05"), sensor))),
+			elem.Form(attrs.Props{
+				"hx-post":   "/leak/ack/" + deviceID,
+				"hx-target": "#device-" + deviceID,
+				"hx-swap":   "outerHTML",
+			},
+				elem.Button(attrs.Props{attrs.Type: "submit", attrs.Class: "leak-ack"}, elem.Text("Acknowledge leak")),
+			),
+		))
+		return "off", cardChildren
+	}
+
 	cardChildren = append(cardChildren, elem.Form(
 		attrs.Props{
 			"hx-post":   "/toggle/" + deviceID,
@@ -588,6 +889,158 @@ func (ws *WebServer) renderFan(deviceID string, info devices.Device, state devic
 	return statusClass, cardChildren
 }
 
+// renderPowerMetering shows the power, voltage, current and energy an
+// outlet reports, or returns nil when it reports none of them.
+func renderPowerMetering(state devices.State) elem.Node {
+	var items []elem.Node
+	for _, v := range []struct {
+		label, role, format string
+		value               *float64
+	}{
+		{"Power:", "power-value", "%.1f W", state.Power},
+		{"Voltage:", "voltage-value", "%.1f V", state.Voltage},
+		{"Current:", "current-value", "%.2f A", state.Current},
+		{"Energy:", "energy-value", "%.2f kWh", state.Energy},
+	} {
+		if v.value == nil {
+			continue
+		}
+		items = append(items,
+			elem.Div(attrs.Props{attrs.Class: "sensor-value-item"},
+				elem.Span(attrs.Props{attrs.Class: "sensor-label"}, elem.Text(v.label)),
+				elem.Span(attrs.Props{attrs.Class: "sensor-value", "data-role": v.role},
+					elem.Text(fmt.Sprintf(v.format, *v.value)),
+				),
+			),
+		)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return elem.Div(attrs.Props{attrs.Class: "sensor-values"}, items...)
+}
+
+func (ws *WebServer) renderCover(deviceID string, info devices.Device, state devices.State, cardChildren []elem.Node) (string, []elem.Node) {
+	statusClass := "off"
+	statusText := "Unknown"
+	position := 0
+
+	if state.Position != nil {
+		position = *state.Position
+		statusText = "Closed"
+		if position > 0 {
+			statusClass = "on"
+			statusText = fmt.Sprintf("Open %d%%", position)
+		}
+	}
+
+	cardChildren[0] = ws.renderDeviceHeader(deviceID, "🪟", info, state, statusText)
+
+	items := []elem.Node{
+		elem.Div(attrs.Props{attrs.Class: "light-control-item brightness-slider-container"},
+			elem.Span(attrs.Props{attrs.Class: "light-control-label"}, elem.Text("Position:")),
+			elem.Span(attrs.Props{attrs.Class: "light-control-value", "data-role": "position-value"},
+				elem.Text(fmt.Sprintf("%d%%", position)),
+			),
+			elem.Input(attrs.Props{
+				attrs.Type:       "range",
+				attrs.Class:      "brightness-slider",
+				attrs.Min:        "0",
+				attrs.Max:        "100",
+				attrs.Value:      fmt.Sprintf("%d", position),
+				attrs.Name:       "position",
+				"data-device-id": deviceID,
+				"data-role":      "position-slider",
+				"hx-post":        "/position/" + deviceID,
+				"hx-trigger":     "change",
+				"hx-target":      "#device-" + deviceID,
+				"hx-swap":        "outerHTML",
+				"hx-include":     "this",
+			}),
+		),
+	}
+
+	if info.Features.Tilt && state.Tilt != nil {
+		items = append(items,
+			elem.Div(attrs.Props{attrs.Class: "light-control-item"},
+				elem.Span(attrs.Props{attrs.Class: "light-control-label"}, elem.Text("Tilt:")),
+				elem.Span(attrs.Props{attrs.Class: "light-control-value", "data-role": "tilt-value"},
+					elem.Text(fmt.Sprintf("%d%%", *state.Tilt)),
+				),
+			),
+		)
+	}
+
+	cardChildren = append(cardChildren, elem.Div(attrs.Props{attrs.Class: "light-controls"}, items...))
+
+	return statusClass, cardChildren
+}
+
+// armModeLabels are the arm modes in the order the web UI offers them.
+var armModeLabels = []struct {
+	Mode  devices.ArmMode
+	Label string
+}{
+	{devices.ArmModeDisarmed, "Disarm"},
+	{devices.ArmModeStay, "Home"},
+	{devices.ArmModeNight, "Night"},
+	{devices.ArmModeAway, "Away"},
+}
+
+func (ws *WebServer) renderSecuritySystem(deviceID string, info devices.Device, state devices.State, cardChildren []elem.Node) (string, []elem.Node) {
+	statusClass := "off"
+	statusText := "Unknown"
+	if state.ArmMode != nil {
+		statusText = "Disarmed"
+		if *state.ArmMode != devices.ArmModeDisarmed {
+			statusClass = "on"
+			statusText = fmt.Sprintf("Armed (%s)", *state.ArmMode)
+		}
+	}
+	if state.SirenSounding() {
+		statusClass = "on"
+		statusText = "Alarm sounding"
+	}
+
+	cardChildren[0] = ws.renderDeviceHeader(deviceID, "🚨", info, state, statusText)
+
+	var buttons []elem.Node
+	for _, m := range armModeLabels {
+		class := "on"
+		if state.ArmMode != nil && *state.ArmMode == m.Mode {
+			class = "off"
+		}
+		buttons = append(buttons, elem.Form(
+			attrs.Props{
+				"hx-post":   "/arm/" + deviceID,
+				"hx-target": "#device-" + deviceID,
+				"hx-swap":   "outerHTML",
+			},
+			elem.Input(attrs.Props{attrs.Type: "hidden", attrs.Name: "mode", attrs.Value: string(m.Mode)}),
+			elem.Button(attrs.Props{attrs.Type: "submit", attrs.Class: class, "data-role": "arm-" + string(m.Mode)}, elem.Text(m.Label)),
+		))
+	}
+	cardChildren = append(cardChildren, elem.Div(attrs.Props{attrs.Class: "light-controls"}, buttons...))
+
+	if hasSiren(info) {
+		action, text, class := "on", "Sound siren", "on"
+		if state.SirenSounding() {
+			action, text, class = "off", "Silence siren", "off"
+		}
+		cardChildren = append(cardChildren, elem.Form(
+			attrs.Props{
+				"hx-post":   "/siren/" + deviceID,
+				"hx-target": "#device-" + deviceID,
+				"hx-swap":   "outerHTML",
+			},
+			elem.Input(attrs.Props{attrs.Type: "hidden", attrs.Name: "action", attrs.Value: action}),
+			elem.Button(attrs.Props{attrs.Type: "submit", attrs.Class: class, "data-role": "siren-button"}, elem.Text(text)),
+		))
+	}
+
+	return statusClass, cardChildren
+}
+
 func (ws *WebServer) renderLightbulb(deviceID string, info devices.Device, state devices.State, cardChildren []elem.Node) (string, []elem.Node) {
 	statusClass := "off"
 	statusText := "OFF"
@@ -604,17 +1057,7 @@ func (ws *WebServer) renderLightbulb(deviceID string, info devices.Device, state
 	}
 
 	// Update status label
-	cardChildren[0] = elem.Div(attrs.Props{attrs.Class: "device-header"},
-		elem.Div(attrs.Props{attrs.Class: "device-icon"}, elem.Text("💡")),
-		elem.Div(attrs.Props{attrs.Class: "device-info"},
-			elem.Div(attrs.Props{attrs.Class: "device-name"}, elem.Text(info.Name)),
-			elem.Div(attrs.Props{attrs.Class: "device-status"},
-				elem.Div(attrs.Props{"data-role": "status-label"}, elem.Text(fmt.Sprintf("Status: %s", statusText))),
-				elem.Div(attrs.Props{"data-role": "last-updated"}, elem.Text(fmt.Sprintf("Last updated: %s", state.LastUpdated.Format("15:04:05")))),
-			),
-			ws.renderConnectionStatus(state),
-		),
-	)
+	cardChildren[0] = ws.renderDeviceHeader(deviceID, "💡", info, state, statusText)
 
 	// Add light controls if applicable
 	var lightItems []elem.Node
@@ -628,20 +1071,38 @@ func (ws *WebServer) renderLightbulb(deviceID string, info devices.Device, state
 					elem.Text(fmt.Sprintf("%d%%", brightnessHAP)),
 				),
 				elem.Input(attrs.Props{
-					attrs.Type:  "range",
-					attrs.Class: "brightness-slider",
-					attrs.Min:   "0",
-					attrs.Max:   "100",
-					attrs.Value: fmt.Sprintf("%d", brightnessHAP),
-					attrs.Name:  "brightness",
-					"data-device-id":   deviceID,
-					"data-role":        "brightness-slider",
-					"hx-post":          "/brightness/" + deviceID,
-					"hx-trigger":       "change",
-					"hx-target":        "#device-" + deviceID,
-					"hx-swap":          "outerHTML",
-					"hx-include":       "this",
+					attrs.Type:       "range",
+					attrs.Class:      "brightness-slider",
+					attrs.Min:        "0",
+					attrs.Max:        "100",
+					attrs.Value:      fmt.Sprintf("%d", brightnessHAP),
+					attrs.Name:       "brightness",
+					"data-device-id": deviceID,
+					"data-role":      "brightness-slider",
+					"hx-post":        "/brightness/" + deviceID,
+					"hx-trigger":     "change",
+					"hx-target":      "#device-" + deviceID,
+					"hx-swap":        "outerHTML",
+					"hx-include":     "this",
 				}),
+				elem.Div(attrs.Props{attrs.Class: "dim-buttons"},
+					elem.Button(attrs.Props{
+						attrs.Type:       "button",
+						attrs.Class:      "dim-button",
+						attrs.Title:      "Hold to dim down",
+						"data-role":      "dim-button",
+						"data-device-id": deviceID,
+						"data-direction": "down",
+					}, elem.Text("−")),
+					elem.Button(attrs.Props{
+						attrs.Type:       "button",
+						attrs.Class:      "dim-button",
+						attrs.Title:      "Hold to dim up",
+						"data-role":      "dim-button",
+						"data-device-id": deviceID,
+						"data-direction": "up",
+					}, elem.Text("+")),
+				),
 			),
 		)
 	}
@@ -720,17 +1181,7 @@ func (ws *WebServer) renderOutlet(deviceID string, info devices.Device, state de
 		icon = "🔘"
 	}
 
-	cardChildren[0] = elem.Div(attrs.Props{attrs.Class: "device-header"},
-		elem.Div(attrs.Props{attrs.Class: "device-icon"}, elem.Text(icon)),
-		elem.Div(attrs.Props{attrs.Class: "device-info"},
-			elem.Div(attrs.Props{attrs.Class: "device-name"}, elem.Text(info.Name)),
-			elem.Div(attrs.Props{attrs.Class: "device-status"},
-				elem.Div(attrs.Props{"data-role": "status-label"}, elem.Text(fmt.Sprintf("Status: %s", statusText))),
-				elem.Div(attrs.Props{"data-role": "last-updated"}, elem.Text(fmt.Sprintf("Last updated: %s", state.LastUpdated.Format("15:04:05")))),
-			),
-			ws.renderConnectionStatus(state),
-		),
-	)
+	cardChildren[0] = ws.renderDeviceHeader(deviceID, icon, info, state, statusText)
 
 	cardChildren = append(cardChildren, elem.Form(
 		attrs.Props{
@@ -745,32 +1196,181 @@ func (ws *WebServer) renderOutlet(deviceID string, info devices.Device, state de
 		),
 	))
 
+	if metering := renderPowerMetering(state); metering != nil {
+		cardChildren = append(cardChildren, metering)
+	}
+
 	return statusClass, cardChildren
 }
 
+// renderDeviceHeader renders a card's header, linking the name to the
+// device page. The status line is left out when statusText is empty.
+func (ws *WebServer) renderDeviceHeader(deviceID, icon string, info devices.Device, state devices.State, statusText string) elem.Node {
+	var status []elem.Node
+	if statusText != "" {
+		status = append(status, elem.Div(attrs.Props{"data-role": "status-label"}, elem.Text(fmt.Sprintf("Status: %s", statusText))))
+	}
+	status = append(status, elem.Div(attrs.Props{"data-role": "last-updated"}, elem.Text(fmt.Sprintf("Last updated: %s", state.LastUpdated.Format("15:04:05")))))
+
+	return elem.Div(attrs.Props{attrs.Class: "device-header"},
+		elem.Div(attrs.Props{attrs.Class: "device-icon"}, elem.Text(icon)),
+		elem.Div(attrs.Props{attrs.Class: "device-info"},
+			elem.Div(attrs.Props{attrs.Class: "device-name"},
+				elem.A(attrs.Props{attrs.Href: "/device/" + deviceID}, elem.Text(info.Name)),
+			),
+			elem.Div(attrs.Props{attrs.Class: "device-status"}, status...),
+			ws.renderConnectionStatus(state),
+		),
+	)
+}
+
 func (ws *WebServer) renderConnectionStatus(state devices.State) elem.Node {
 	var connectionIndicator, connectionText string
-	if state.LastSeen.IsZero() {
+	if state.Disabled != nil {
 		connectionIndicator = "disconnected"
-		connectionText = "Never seen"
+		connectionText = "Disabled since " + state.Disabled.Format("2006-01-02 15:04")
 	} else {
-		timeSinceSeen := time.Since(state.LastSeen)
-		if timeSinceSeen < 30*time.Second {
-			connectionIndicator = "connected"
-			connectionText = fmt.Sprintf("Last seen: %s ago", timeSinceSeen.Round(time.Second))
-		} else if timeSinceSeen < 60*time.Second {
-			connectionIndicator = "stale"
-			connectionText = fmt.Sprintf("Last seen: %s ago", timeSinceSeen.Round(time.Second))
-		} else {
-			connectionIndicator = "disconnected"
-			connectionText = fmt.Sprintf("Last seen: %s ago", timeSinceSeen.Round(time.Second))
-		}
+		connectionIndicator, connectionText = devices.ConnectionStatus(state.LastSeen, ws.clock.Now())
 	}
 
 	return elem.Div(attrs.Props{attrs.Class: "connection-status"},
 		elem.Span(attrs.Props{"data-role": "connection-indicator", attrs.Class: "connection-indicator " + connectionIndicator}),
 		elem.Span(attrs.Props{"data-role": "connection-text"}, elem.Text(connectionText)),
+		ws.renderLinkQuality(state.LinkQuality),
+		ws.renderHealth(state.Health),
+	)
+}
+
+func (ws *WebServer) renderHealth(h devices.Health) elem.Node {
+	title := "Device health"
+	if len(h.Issues) > 0 {
+		title += ": " + strings.Join(h.Issues, ", ")
+	}
+
+	return elem.Span(attrs.Props{
+		"data-role": "health",
+		attrs.Class: "health-badge " + h.Level(),
+		attrs.Title: title,
+	}, elem.Text(fmt.Sprintf("♥ %d", h.Score)))
+}
+
+func (ws *WebServer) renderLinkQuality(lq int) elem.Node {
+	text := "n/a"
+	if lq > 0 {
+		text = fmt.Sprintf("%d", lq)
+	}
+
+	return elem.Span(attrs.Props{
+		"data-role":  "link-quality",
+		attrs.Class:  "link-quality " + devices.LinkQualityLevel(lq),
+		attrs.Title:  "Zigbee link quality (0-255)",
+		"data-value": fmt.Sprintf("%d", lq),
+	},
+		elem.Span(attrs.Props{attrs.Class: "signal-icon"},
+			elem.Span(attrs.Props{attrs.Class: "bar bar-1"}),
+			elem.Span(attrs.Props{attrs.Class: "bar bar-2"}),
+			elem.Span(attrs.Props{attrs.Class: "bar bar-3"}),
+		),
+		elem.Span(attrs.Props{"data-role": "link-quality-value"}, elem.Text(text)),
+	)
+}
+
+// Dashboard sort modes.
+const (
+	sortByCustom      = "custom"
+	sortByID          = "id"
+	sortByName        = "name"
+	sortByLinkQuality = "link_quality"
+	sortByHealth      = "health"
+)
+
+// sortedDeviceIDs orders and filters the snapshot for the dashboard. The
+// link quality and health sorts put the weakest devices first; levelFilter restricts the
+// result to a LinkQualityLevel bucket.
+func sortedDeviceIDs(snapshot map[string]struct {
+	Device devices.Device
+	State  devices.State
+}, sortMode, levelFilter string,
+) []string {
+	ids := make([]string, 0, len(snapshot))
+	for id, item := range snapshot {
+		if levelFilter != "" && devices.LinkQualityLevel(item.State.LinkQuality) != levelFilter {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := snapshot[ids[i]], snapshot[ids[j]]
+		switch sortMode {
+		case sortByName:
+			if a.Device.Name != b.Device.Name {
+				return a.Device.Name < b.Device.Name
+			}
+		case sortByLinkQuality:
+			if a.State.LinkQuality != b.State.LinkQuality {
+				return a.State.LinkQuality < b.State.LinkQuality
+			}
+		case sortByHealth:
+			if a.State.Health.Score != b.State.Health.Score {
+				return a.State.Health.Score < b.State.Health.Score
+			}
+		case sortByCustom:
+			if a.Device.SortWeight != b.Device.SortWeight {
+				return a.Device.SortWeight < b.Device.SortWeight
+			}
+		}
+		return ids[i] < ids[j]
+	})
+
+	return ids
+}
+
+func (ws *WebServer) renderSortBar(sortMode, levelFilter string, customised bool) elem.Node {
+	link := func(label, sortValue, filterValue string) elem.Node {
+		class := "sort-link"
+		if sortValue == sortMode && filterValue == levelFilter {
+			class += " active"
+		}
+		href := "/?sort=" + sortValue
+		if filterValue != "" {
+			href += "&link_quality=" + filterValue
+		}
+		return elem.A(attrs.Props{attrs.Href: href, attrs.Class: class}, elem.Text(label))
+	}
+
+	children := []elem.Node{
+		elem.Span(attrs.Props{attrs.Class: "sort-label"}, elem.Text("Sort:")),
+		link("Custom", sortByCustom, ""),
+	}
+	if sortMode == sortByCustom && customised {
+		children = append(children, elem.Form(attrs.Props{attrs.Method: "post", attrs.Action: "/order", attrs.Class: "sort-reset"},
+			elem.Input(attrs.Props{attrs.Type: "hidden", attrs.Name: "order", attrs.Value: ""}),
+			elem.Button(attrs.Props{attrs.Type: "submit", attrs.Class: "sort-link"}, elem.Text("Reset order")),
+		))
+	}
+	children = append(children,
+		link("ID", sortByID, ""),
+		link("Name", sortByName, ""),
+		link("Link quality", sortByLinkQuality, ""),
+		link("Health", sortByHealth, ""),
+		elem.Span(attrs.Props{attrs.Class: "sort-label"}, elem.Text("Filter:")),
+		link("Weak links", sortByLinkQuality, "weak"),
 	)
+
+	return elem.Div(attrs.Props{attrs.Class: "sort-bar"}, children...)
+}
+
+// presentNodes drops nil nodes, which elem cannot render, so optional
+// sections can return nil when they have nothing to show.
+func presentNodes(nodes ...elem.Node) []elem.Node {
+	present := nodes[:0]
+	for _, n := range nodes {
+		if n != nil {
+			present = append(present, n)
+		}
+	}
+	return present
 }
 
 // HandleIndex renders the main dashboard
@@ -778,24 +1378,36 @@ func (ws *WebServer) HandleIndex(w http.ResponseWriter, r *http.Request) {
 	var deviceElements []elem.Node
 
 	snapshot := ws.deviceProvider.Snapshot()
-	var deviceIDs []string
-	for id := range snapshot {
-		deviceIDs = append(deviceIDs, id)
+
+	sortMode := resolveSortMode(w, r)
+	levelFilter := r.URL.Query().Get("link_quality")
+	order := userOrder(r)
+
+	if weather := ws.renderWeatherCard(snapshot); weather != nil {
+		deviceElements = append(deviceElements, weather)
+	}
+	for _, g := range ws.deviceProvider.Groups() {
+		deviceElements = append(deviceElements, renderGroupCard(g, snapshot))
 	}
-	sort.Strings(deviceIDs)
 
-	for _, id := range deviceIDs {
+	ids := sortedDeviceIDs(snapshot, sortMode, levelFilter)
+	if sortMode == sortByCustom {
+		ids = applyUserOrder(ids, order)
+	}
+	for _, id := range ids {
 		item := snapshot[id]
-		if item.Device.Web != nil && !*item.Device.Web {
+		if !onDashboard(item.Device) {
 			continue
 		}
 		deviceElements = append(deviceElements, ws.renderDeviceCard(id, item.Device, item.State))
 	}
 
 	var eventElements []elem.Node
+	ws.eventLogMu.RLock()
 	for i := len(ws.eventLog) - 1; i >= 0 && i >= len(ws.eventLog)-20; i-- {
 		eventElements = append(eventElements, elem.Div(attrs.Props{attrs.Class: "event"}, elem.Text(ws.eventLog[i])))
 	}
+	ws.eventLogMu.RUnlock()
 
 	var homekitSection elem.Node
 	if ws.hapPin != "" {
@@ -840,16 +1452,21 @@ func (ws *WebServer) HandleIndex(w http.ResponseWriter, r *http.Request) {
 		)
 	}
 
-	content := elem.Div(attrs.Props{},
+	content := elem.Div(attrs.Props{}, presentNodes(
 		elem.H1(attrs.Props{}, elem.Text("Zigbee2MQTT HomeKit Bridge")),
-		elem.P(attrs.Props{}, elem.Text(fmt.Sprintf("Managing %d devices", len(snapshot)))),
+		ws.renderDeviceCount(snapshot),
 		homekitSection,
-		elem.Div(attrs.Props{attrs.Class: "devices-grid"}, deviceElements...),
+		ws.renderWidgets(snapshot),
+		ws.renderSortBar(sortMode, levelFilter, len(order) > 0),
+		ws.renderSmokeDrill(snapshot),
+		ws.renderNightMode(),
+		ws.renderPermitJoin(),
+		elem.Div(attrs.Props{attrs.Class: "devices-grid", "data-sortable": fmt.Sprint(sortMode == sortByCustom && levelFilter == "")}, deviceElements...),
 		elem.Div(attrs.Props{attrs.Class: "events"},
 			elem.H2(attrs.Props{}, elem.Text("Recent Events")),
 			elem.Div(attrs.Props{}, eventElements...),
 		),
-	)
+	)...)
 
 	w.Header().Set("Content-Type", "text/html")
 	if _, err := fmt.Fprint(w, ws.renderPage("z2m-homekit", content)); err != nil {
@@ -882,6 +1499,10 @@ func (ws *WebServer) HandleToggle(w http.ResponseWriter, r *http.Request) {
 	on := action == "on"
 
 	if err := ws.controller.SetPower(r.Context(), deviceID, on); err != nil {
+		if errors.Is(err, devices.ErrValveLocked) || errors.Is(err, devices.ErrDeviceDisabled) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		ws.logger.Error("Failed to set power", "device_id", deviceID, "error", err)
 		http.Error(w, "Failed to set power", http.StatusInternalServerError)
 		return
@@ -965,13 +1586,463 @@ func (ws *WebServer) HandleBrightness(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-// HandleEventBusDebug renders a simple diagnostic view of the current state map.
-func (ws *WebServer) HandleEventBusDebug(w http.ResponseWriter, r *http.Request) {
-	snapshot := ws.snapshotState()
+// HandlePosition handles cover position slider requests
+func (ws *WebServer) HandlePosition(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-	ws.sseClientsMu.RLock()
-	clientCount := len(ws.sseClients)
-	ws.sseClientsMu.RUnlock()
+	deviceID := strings.TrimPrefix(r.URL.Path, "/position/")
+
+	device, state, exists := ws.deviceProvider.Device(deviceID)
+	if !exists {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	if device.Web != nil && !*device.Web {
+		http.Error(w, "Device not available on web", http.StatusNotFound)
+		return
+	}
+
+	if device.Type != devices.DeviceTypeCover {
+		http.Error(w, "Device is not a cover", http.StatusBadRequest)
+		return
+	}
+
+	var position int
+	if _, err := fmt.Sscanf(r.FormValue("position"), "%d", &position); err != nil {
+		http.Error(w, "Invalid position value", http.StatusBadRequest)
+		return
+	}
+	position = devices.ClampPercentage(position)
+
+	if err := ws.controller.SetCoverPosition(r.Context(), deviceID, position); err != nil {
+		ws.logger.Error("Failed to set position", "device_id", deviceID, "error", err)
+		http.Error(w, "Failed to set position", http.StatusInternalServerError)
+		return
+	}
+
+	ws.LogEvent(fmt.Sprintf("Web UI: Position %s -> %d%%", deviceID, position))
+
+	if r.Header.Get("HX-Request") == "true" {
+		if updatedDevice, updatedState, ok := ws.deviceProvider.Device(deviceID); ok {
+			device = updatedDevice
+			state = updatedState
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		if _, err := fmt.Fprint(w, ws.renderDeviceCard(deviceID, device, state).Render()); err != nil {
+			ws.logger.Error("Failed to write response", slog.Any("error", err))
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// HandleArm handles security system arm mode requests
+func (ws *WebServer) HandleArm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deviceID := strings.TrimPrefix(r.URL.Path, "/arm/")
+
+	device, _, exists := ws.deviceProvider.Device(deviceID)
+	if !exists || !webEnabled(device) {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	if device.Type != devices.DeviceTypeSecuritySystem {
+		http.Error(w, "Device is not a security system", http.StatusBadRequest)
+		return
+	}
+
+	mode, err := devices.ParseArmMode(r.FormValue("mode"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := ws.controller.SetArmMode(r.Context(), deviceID, mode); err != nil {
+		ws.logger.Error("Failed to set arm mode", "device_id", deviceID, "error", err)
+		http.Error(w, "Failed to set arm mode", http.StatusInternalServerError)
+		return
+	}
+
+	ws.LogEvent(fmt.Sprintf("Web UI: Arm mode %s -> %s", deviceID, mode))
+	ws.respondDevice(w, r, deviceID)
+}
+
+// HandleSiren handles requests to sound or silence a siren
+func (ws *WebServer) HandleSiren(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deviceID := strings.TrimPrefix(r.URL.Path, "/siren/")
+
+	device, _, exists := ws.deviceProvider.Device(deviceID)
+	if !exists || !webEnabled(device) {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	if !hasSiren(device) {
+		http.Error(w, "Device has no siren", http.StatusBadRequest)
+		return
+	}
+
+	var on bool
+	switch r.FormValue("action") {
+	case "on":
+		on = true
+	case "off":
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+
+	if err := ws.controller.SetSiren(r.Context(), deviceID, on); err != nil {
+		ws.logger.Error("Failed to set siren", "device_id", deviceID, "error", err)
+		http.Error(w, "Failed to set siren", http.StatusInternalServerError)
+		return
+	}
+
+	ws.LogEvent(fmt.Sprintf("Web UI: Siren %s -> %s", deviceID, r.FormValue("action")))
+	ws.respondDevice(w, r, deviceID)
+}
+
+// respondDevice answers an htmx request with the device's card and
+// redirects anything else to the index.
+func (ws *WebServer) respondDevice(w http.ResponseWriter, r *http.Request, deviceID string) {
+	if r.Header.Get("HX-Request") != "true" {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	device, state, ok := ws.deviceProvider.Device(deviceID)
+	if !ok {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if _, err := fmt.Fprint(w, ws.renderDeviceCard(deviceID, device, state).Render()); err != nil {
+		ws.logger.Error("Failed to write response", slog.Any("error", err))
+	}
+}
+
+// HandleLeakAck acknowledges a leak so its shutoff valve can be reopened.
+// It serves both the web UI (/leak/ack/{id}) and the API
+// (/api/v1/leak/ack/{id}), which answers 204 instead of a page.
+func (ws *WebServer) HandleLeakAck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deviceID := path.Base(r.URL.Path)
+	device, _, exists := ws.deviceProvider.Device(deviceID)
+	if !exists {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	if err := ws.controller.AcknowledgeLeak(r.Context(), deviceID); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	ws.LogEvent(fmt.Sprintf("Leak acknowledged for %s", device.Name))
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/"):
+		w.WriteHeader(http.StatusNoContent)
+	case r.Header.Get("HX-Request") == "true":
+		device, state, _ := ws.deviceProvider.Device(deviceID)
+		w.Header().Set("Content-Type", "text/html")
+		if _, err := fmt.Fprint(w, ws.renderDeviceCard(deviceID, device, state).Render()); err != nil {
+			ws.logger.Error("Failed to write response", slog.Any("error", err))
+		}
+	default:
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// renderAlertAck renders the acknowledgement banner for a sensor raising a
+// leak, smoke or contact alert.
+func (ws *WebServer) renderAlertAck(deviceID string, info devices.Device, state devices.State) elem.Node {
+	if _, active := devices.ActiveAlert(info, state); !active {
+		return nil
+	}
+
+	if state.Ack != nil {
+		return elem.Div(attrs.Props{attrs.Class: "alert-ack acknowledged"},
+			elem.Text(fmt.Sprintf("🔕 Acknowledged by %s at %s, silenced until %s",
+				state.Ack.By, state.Ack.At.Format("15:04:05"), state.Ack.Until.Format("15:04"))),
+		)
+	}
+
+	return elem.Div(attrs.Props{attrs.Class: "alert-ack"},
+		elem.Form(attrs.Props{
+			"hx-post":   "/alert/ack/" + deviceID,
+			"hx-target": "#device-" + deviceID,
+			"hx-swap":   "outerHTML",
+		},
+			elem.Button(attrs.Props{attrs.Type: "submit", attrs.Class: "leak-ack"}, elem.Text("Acknowledge alert")),
+		),
+	)
+}
+
+// AlertAckResponse describes an alert acknowledgement made through the API.
+type AlertAckResponse struct {
+	DeviceID string           `json:"device_id"`
+	Kind     events.AlertKind `json:"kind"`
+	By       string           `json:"acknowledged_by"`
+	At       time.Time        `json:"acknowledged_at"`
+	Until    time.Time        `json:"silenced_until"`
+}
+
+// HandleAlertAck acknowledges a sensor's active leak, smoke or contact
+// alert, silencing repeats. The acknowledger is the API token's name, or the
+// client address for the web UI.
+func (ws *WebServer) HandleAlertAck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deviceID := path.Base(r.URL.Path)
+	if _, _, exists := ws.deviceProvider.Device(deviceID); !exists {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	ack, err := ws.controller.AcknowledgeAlert(deviceID, requestActor(r))
+	switch {
+	case errors.Is(err, devices.ErrNoActiveAlert):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/"):
+		resp := AlertAckResponse{deviceID, ack.Kind, ack.By, ack.At, ack.Until}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			ws.logger.Error("Failed to write alert ack response", slog.Any("error", err))
+		}
+	case r.Header.Get("HX-Request") == "true":
+		device, state, _ := ws.deviceProvider.Device(deviceID)
+		w.Header().Set("Content-Type", "text/html")
+		if _, err := fmt.Fprint(w, ws.renderDeviceCard(deviceID, device, state).Render()); err != nil {
+			ws.logger.Error("Failed to write response", slog.Any("error", err))
+		}
+	default:
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// renderNightMode renders the night mode switch when night mode is
+// configured.
+func (ws *WebServer) renderNightMode() elem.Node {
+	if !ws.controller.NightModeConfigured() {
+		return nil
+	}
+
+	active := ws.controller.NightModeActive()
+	status, label, value := "Off", "Turn on", "true"
+	if active {
+		status, label, value = "On", "Turn off", "false"
+	}
+
+	return elem.Form(attrs.Props{attrs.Class: "night-mode", attrs.Method: "post", attrs.Action: "/nightmode"},
+		elem.Span(attrs.Props{attrs.Class: "sort-label"}, elem.Text("🌙 Night mode: "+status)),
+		elem.Button(attrs.Props{attrs.Type: "submit", attrs.Name: "on", attrs.Value: value}, elem.Text(label)),
+	)
+}
+
+// NightModeResponse is the night mode state served by /api/v1/nightmode.
+type NightModeResponse struct {
+	Configured bool `json:"configured"`
+	Active     bool `json:"active"`
+}
+
+// HandleNightMode reports night mode on GET and switches it on POST with
+// on=true or on=false. A manual switch holds until the schedule next
+// changes.
+func (ws *WebServer) HandleNightMode(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		on, err := strconv.ParseBool(r.FormValue("on"))
+		if err != nil {
+			http.Error(w, "on must be true or false", http.StatusBadRequest)
+			return
+		}
+		if err := ws.controller.SetNightMode(on); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		ws.LogEvent(fmt.Sprintf("Night mode switched to %v by %s", on, requestActor(r)))
+
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp := NightModeResponse{ws.controller.NightModeConfigured(), ws.controller.NightModeActive()}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		ws.logger.Error("Failed to write night mode response", slog.Any("error", err))
+	}
+}
+
+// renderSmokeDrill renders the smoke response drill buttons when any smoke
+// sensor is configured.
+func (ws *WebServer) renderSmokeDrill(snapshot map[string]struct {
+	Device devices.Device
+	State  devices.State
+},
+) elem.Node {
+	for _, item := range snapshot {
+		if item.Device.Type != devices.DeviceTypeSmokeSensor {
+			continue
+		}
+
+		return elem.Form(attrs.Props{attrs.Class: "smoke-drill", attrs.Method: "post", attrs.Action: "/smoke/drill"},
+			elem.Span(attrs.Props{attrs.Class: "sort-label"}, elem.Text("Smoke response:")),
+			elem.Button(attrs.Props{attrs.Type: "submit", attrs.Name: "live", attrs.Value: "false"}, elem.Text("Dry run")),
+			elem.Button(attrs.Props{
+				attrs.Type:  "submit",
+				attrs.Name:  "live",
+				attrs.Value: "true",
+				"onclick":   "return confirm('Switch on all sirens and lights now?')",
+			}, elem.Text("Live drill")),
+		)
+	}
+
+	return nil
+}
+
+// SmokeDrillResponse lists the steps a smoke drill ran.
+type SmokeDrillResponse struct {
+	Live  bool     `json:"live"`
+	Steps []string `json:"steps"`
+}
+
+// HandleSmokeDrill runs the smoke response plan as a drill. live=true sends
+// the commands, anything else only reports them. The API returns the steps
+// as JSON; the web UI logs them to the event log.
+func (ws *WebServer) HandleSmokeDrill(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	live := r.FormValue("live") == "true"
+	steps, err := ws.controller.SmokeDrill(r.Context(), live)
+	if err != nil {
+		if errors.Is(err, devices.ErrNoSmokeResponse) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		ws.logger.Error("Smoke drill failed", "error", err)
+		http.Error(w, "Smoke drill failed", http.StatusInternalServerError)
+		return
+	}
+
+	kind := "Dry run"
+	if live {
+		kind = "Live drill"
+	}
+	ws.LogEvent(fmt.Sprintf("Smoke drill (%s): %s", kind, strings.Join(steps, ", ")))
+
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	resp := SmokeDrillResponse{Live: live, Steps: steps}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		ws.logger.Error("Failed to write smoke drill response", slog.Any("error", err))
+	}
+}
+
+// HandleDim starts or stops press-and-hold dimming. The web UI posts
+// direction=up or down when a dim button is pressed and direction=stop when
+// it is released.
+func (ws *WebServer) HandleDim(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deviceID := strings.TrimPrefix(r.URL.Path, "/dim/")
+
+	device, _, exists := ws.deviceProvider.Device(deviceID)
+	if !exists {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	if device.Web != nil && !*device.Web {
+		http.Error(w, "Device not available on web", http.StatusNotFound)
+		return
+	}
+
+	if device.Type != devices.DeviceTypeLightbulb || !device.Features.Brightness {
+		http.Error(w, "Device does not support dimming", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	direction := r.FormValue("direction")
+	switch direction {
+	case "up", "down":
+		err = ws.controller.StartDimming(r.Context(), deviceID, direction == "up")
+	case "stop":
+		err = ws.controller.StopDimming(r.Context(), deviceID)
+	default:
+		http.Error(w, "Invalid direction", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		ws.logger.Error("Failed to dim", "device_id", deviceID, "direction", direction, "error", err)
+		http.Error(w, "Failed to dim", http.StatusInternalServerError)
+		return
+	}
+
+	if direction != "stop" {
+		ws.LogEvent(fmt.Sprintf("Web UI: Dim %s %s", deviceID, direction))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleEventBusDebug renders a simple diagnostic view of the current state map.
+func (ws *WebServer) HandleEventBusDebug(w http.ResponseWriter, r *http.Request) {
+	snapshot := ws.snapshotState()
+
+	ws.sseClientsMu.RLock()
+	clientCount := len(ws.sseClients)
+	ws.sseClientsMu.RUnlock()
 
 	rows := []elem.Node{
 		elem.Tr(attrs.Props{},
@@ -980,6 +2051,7 @@ func (ws *WebServer) HandleEventBusDebug(w http.ResponseWriter, r *http.Request)
 			elem.Th(attrs.Props{}, elem.Text("On")),
 			elem.Th(attrs.Props{}, elem.Text("Last Updated")),
 			elem.Th(attrs.Props{}, elem.Text("Last Seen")),
+			elem.Th(attrs.Props{}, elem.Text("Link Quality")),
 			elem.Th(attrs.Props{}, elem.Text("Connection")),
 		),
 	}
@@ -996,6 +2068,7 @@ func (ws *WebServer) HandleEventBusDebug(w http.ResponseWriter, r *http.Request)
 				elem.Td(attrs.Props{}, elem.Text(onText)),
 				elem.Td(attrs.Props{}, elem.Text(evt.LastUpdated.Format(time.RFC3339))),
 				elem.Td(attrs.Props{}, elem.Text(evt.LastSeen.Format(time.RFC3339))),
+				elem.Td(attrs.Props{}, elem.Text(fmt.Sprintf("%d", evt.LinkQuality))),
 				elem.Td(attrs.Props{}, elem.Text(evt.ConnectionNote)),
 			),
 		)
@@ -1006,17 +2079,27 @@ func (ws *WebServer) HandleEventBusDebug(w http.ResponseWriter, r *http.Request)
 			elem.Th(attrs.Props{}, elem.Text("Component")),
 			elem.Th(attrs.Props{}, elem.Text("Status")),
 			elem.Th(attrs.Props{}, elem.Text("Updated")),
+			elem.Th(attrs.Props{}, elem.Text("Reconnects")),
+			elem.Th(attrs.Props{}, elem.Text("Next retry")),
 			elem.Th(attrs.Props{}, elem.Text("Error")),
+			elem.Th(attrs.Props{}, elem.Text("Detail")),
 		),
 	}
 
 	for _, status := range ws.snapshotStatuses() {
+		nextRetry := ""
+		if !status.NextRetry.IsZero() {
+			nextRetry = fmt.Sprintf("%s (attempt %d)", status.NextRetry.Format(time.RFC3339), status.Attempt)
+		}
 		statusRows = append(statusRows,
 			elem.Tr(attrs.Props{},
 				elem.Td(attrs.Props{}, elem.Text(status.Component)),
 				elem.Td(attrs.Props{}, elem.Text(string(status.Status))),
 				elem.Td(attrs.Props{}, elem.Text(status.Timestamp.Format(time.RFC3339))),
+				elem.Td(attrs.Props{}, elem.Text(strconv.Itoa(status.Reconnects))),
+				elem.Td(attrs.Props{}, elem.Text(nextRetry)),
 				elem.Td(attrs.Props{}, elem.Text(status.Error)),
+				elem.Td(attrs.Props{}, elem.Text(status.Detail)),
 			),
 		)
 	}
@@ -1051,11 +2134,18 @@ func (ws *WebServer) HandleSSE(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
+	// Send headers right away so clients see the stream open even when
+	// there is no state to replay yet.
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
 
-	clientChan := make(chan events.StateUpdateEvent, 10)
+	clientChan := make(chan sseEvent, 10)
 
+	// Register and decide what to replay under the broadcast lock, so no
+	// event falls between the replay and the live stream.
 	ws.sseClientsMu.Lock()
 	ws.sseClients[clientChan] = struct{}{}
+	replay, resumed := ws.sseResumeEvents(r)
 	ws.sseClientsMu.Unlock()
 
 	defer func() {
@@ -1065,23 +2155,21 @@ func (ws *WebServer) HandleSSE(w http.ResponseWriter, r *http.Request) {
 		close(clientChan)
 	}()
 
-	for _, evt := range ws.snapshotState() {
-		select {
-		case clientChan <- evt:
-		default:
+	if resumed {
+		ws.logger.Debug("Resuming SSE stream", "replayed", len(replay))
+	}
+
+	for _, evt := range replay {
+		if !ws.writeSSE(w, evt) {
+			return
 		}
 	}
+	flusher.Flush()
 
 	for {
 		select {
 		case evt := <-clientChan:
-			payload, err := json.Marshal(evt)
-			if err != nil {
-				ws.logger.Error("Failed to marshal SSE payload", slog.Any("error", err))
-				continue
-			}
-
-			if _, err := fmt.Fprintf(w, "data: %s\n\n", payload); err != nil {
+			if !ws.writeSSE(w, evt) {
 				return
 			}
 			flusher.Flush()
@@ -1094,6 +2182,56 @@ func (ws *WebServer) HandleSSE(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// sseResumeEvents returns the events a new SSE client should receive first.
+// Clients sending a Last-Event-ID from this process that is still covered
+// by the replay buffer get the events they missed; everyone else, including
+// clients resuming across a restart, gets the current state of every
+// device, tagged with the latest ID. Callers must hold sseClientsMu.
+func (ws *WebServer) sseResumeEvents(r *http.Request) ([]sseEvent, bool) {
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		if lastID, ok := ws.sseHistory.ParseID(header); ok {
+			if missed, ok := ws.sseHistory.Since(lastID); ok {
+				return missed, true
+			}
+		}
+	}
+
+	lastID := ws.sseHistory.LastID()
+	snapshot := ws.snapshotState()
+	replay := make([]sseEvent, 0, len(snapshot))
+	for _, evt := range snapshot {
+		replay = append(replay, sseEvent{ID: lastID, Event: evt})
+	}
+
+	return replay, false
+}
+
+// writeSSE writes one event in SSE framing. It returns false when the
+// client has gone away.
+func (ws *WebServer) writeSSE(w io.Writer, evt sseEvent) bool {
+	payload, err := json.Marshal(evt.Event)
+	if err != nil {
+		ws.logger.Error("Failed to marshal SSE payload", slog.Any("error", err))
+		return true
+	}
+
+	if evt.ID > 0 {
+		if _, err := fmt.Fprintf(w, "id: %s\n", ws.sseHistory.FormatID(evt.ID)); err != nil {
+			return false
+		}
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", payload)
+	return err == nil
+}
+
+// HealthResponse is the health summary served by /health.
+type HealthResponse struct {
+	Status     string    `json:"status"`
+	Devices    int       `json:"devices"`
+	SSEClients int       `json:"sse_clients"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
 // HandleHealth exposes a JSON health summary.
 func (ws *WebServer) HandleHealth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -1107,12 +2245,7 @@ func (ws *WebServer) HandleHealth(w http.ResponseWriter, r *http.Request) {
 	sseClients := len(ws.sseClients)
 	ws.sseClientsMu.RUnlock()
 
-	resp := struct {
-		Status     string    `json:"status"`
-		Devices    int       `json:"devices"`
-		SSEClients int       `json:"sse_clients"`
-		Timestamp  time.Time `json:"timestamp"`
-	}{
+	resp := HealthResponse{
 		Status:     "ok",
 		Devices:    len(snapshot),
 		SSEClients: sseClients,
@@ -0,0 +1,419 @@
+package z2mhomekit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kradalby/kra/web"
+	"github.com/kradalby/z2m-homekit/devices"
+	"github.com/kradalby/z2m-homekit/events"
+	"tailscale.com/util/eventbus"
+)
+
+func newTestWebServer(t *testing.T, addr string) (*WebServer, *eventbus.Subscriber[events.ConnectionStatusEvent]) {
+	t.Helper()
+
+	logger := testLogger()
+	bus := newTestBus(t)
+
+	client, err := bus.Client(events.ClientMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := eventbus.Subscribe[events.ConnectionStatusEvent](client)
+
+	kraWeb, err := web.NewServer(web.ServerConfig{LocalAddr: addr},
+		web.WithLogger(logger),
+		web.WithStdLogger(log.New(io.Discard, "", 0)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewWebServer(logger, nil, nil, bus, kraWeb, addr, "00102003", "", nil), statuses
+}
+
+func nextWebStatus(t *testing.T, sub *eventbus.Subscriber[events.ConnectionStatusEvent]) events.ConnectionStatus {
+	t.Helper()
+
+	for {
+		select {
+		case evt := <-sub.Events():
+			if evt.Component == "web" {
+				return evt.Status
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no web connection status published")
+		}
+	}
+}
+
+func TestWebServerStartReportsBindFailure(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	ws, statuses := newTestWebServer(t, taken.Addr().String())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := ws.Start(ctx); err == nil {
+		t.Fatal("Start succeeded on a port that is in use")
+	}
+
+	if got := nextWebStatus(t, statuses); got != events.ConnectionStatusConnecting {
+		t.Fatalf("first status = %s, want connecting", got)
+	}
+	if got := nextWebStatus(t, statuses); got != events.ConnectionStatusFailed {
+		t.Fatalf("second status = %s, want failed", got)
+	}
+}
+
+func TestWebServerStartConnectedAfterBind(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	ws, statuses := newTestWebServer(t, addr)
+	ws.Handle("/health", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := ws.Start(ctx); err != nil {
+		cancel()
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() {
+		cancel()
+		ws.Close()
+	}()
+
+	if got := nextWebStatus(t, statuses); got != events.ConnectionStatusConnecting {
+		t.Fatalf("first status = %s, want connecting", got)
+	}
+	if got := nextWebStatus(t, statuses); got != events.ConnectionStatusConnected {
+		t.Fatalf("second status = %s, want connected", got)
+	}
+
+	resp, err := http.Get("http://" + addr + "/health")
+	if err != nil {
+		t.Fatalf("web listener not reachable once connected: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /health = %d, want 200", resp.StatusCode)
+	}
+}
+
+type fakeController struct {
+	calls      []string
+	night      bool
+	scenes     []devices.Scene
+	permitJoin time.Duration
+}
+
+func (f *fakeController) SetPower(_ context.Context, id string, on bool) error {
+	f.calls = append(f.calls, fmt.Sprintf("power %s %v", id, on))
+	return nil
+}
+
+func (f *fakeController) SetBrightness(_ context.Context, id string, brightness int) error {
+	f.calls = append(f.calls, fmt.Sprintf("brightness %s %d", id, brightness))
+	return nil
+}
+
+func (f *fakeController) SetColor(_ context.Context, id string, hue, saturation float64) error {
+	f.calls = append(f.calls, fmt.Sprintf("color %s %g %g", id, hue, saturation))
+	return nil
+}
+
+func (f *fakeController) SetCoverPosition(_ context.Context, id string, position int) error {
+	f.calls = append(f.calls, fmt.Sprintf("position %s %d", id, position))
+	return nil
+}
+
+func (f *fakeController) SetArmMode(_ context.Context, id string, mode devices.ArmMode) error {
+	f.calls = append(f.calls, fmt.Sprintf("arm %s %s", id, mode))
+	return nil
+}
+
+func (f *fakeController) SetSiren(_ context.Context, id string, on bool) error {
+	f.calls = append(f.calls, fmt.Sprintf("siren %s %v", id, on))
+	return nil
+}
+
+func (f *fakeController) SetColorTemp(_ context.Context, id string, colorTemp int) error {
+	f.calls = append(f.calls, fmt.Sprintf("color_temp %s %d", id, colorTemp))
+	return nil
+}
+
+func (f *fakeController) StartDimming(_ context.Context, id string, up bool) error {
+	f.calls = append(f.calls, fmt.Sprintf("dim %s up=%v", id, up))
+	return nil
+}
+
+func (f *fakeController) StopDimming(_ context.Context, id string) error {
+	f.calls = append(f.calls, "stop "+id)
+	return nil
+}
+
+func (f *fakeController) AcknowledgeLeak(_ context.Context, id string) error {
+	f.calls = append(f.calls, "ack "+id)
+	return nil
+}
+
+func (f *fakeController) SmokeDrill(_ context.Context, live bool) ([]string, error) {
+	f.calls = append(f.calls, fmt.Sprintf("drill live=%v", live))
+	return []string{"Siren on"}, nil
+}
+
+func (f *fakeController) AcknowledgeAlert(id, by string) (devices.AlertAck, error) {
+	f.calls = append(f.calls, fmt.Sprintf("ack alert %s by %s", id, by))
+	return devices.AlertAck{Kind: events.AlertKindLeak, By: by}, nil
+}
+
+func (f *fakeController) TestFire(_ context.Context, id string, d time.Duration, by string) (devices.TestFire, error) {
+	f.calls = append(f.calls, fmt.Sprintf("test-fire %s %s by %s", id, d, by))
+	return devices.TestFire{SensorID: id, Kind: events.AlertKindLeak, By: by, Until: time.Now().Add(d)}, nil
+}
+
+func (f *fakeController) CalibrateCover(_ context.Context, id string, action devices.CoverCalibration, by string) (devices.Calibration, error) {
+	f.calls = append(f.calls, fmt.Sprintf("calibrate %s %s by %s", id, action, by))
+	return devices.Calibration{Action: action, By: by, Requested: time.Now()}, nil
+}
+
+func (f *fakeController) NightModeConfigured() bool { return true }
+
+func (f *fakeController) NightModeActive() bool { return f.night }
+
+func (f *fakeController) SetNightMode(on bool) error {
+	f.calls = append(f.calls, fmt.Sprintf("night %v", on))
+	f.night = on
+	return nil
+}
+
+func (f *fakeController) SetGroupPower(_ context.Context, id string, on bool) error {
+	f.calls = append(f.calls, fmt.Sprintf("group %s %v", id, on))
+	return nil
+}
+
+func (f *fakeController) Scenes() []devices.Scene { return f.scenes }
+
+func (f *fakeController) RecallScene(id string) error {
+	if !slices.ContainsFunc(f.scenes, func(s devices.Scene) bool { return s.ID == id }) {
+		return devices.ErrSceneNotFound
+	}
+	f.calls = append(f.calls, "scene "+id)
+	return nil
+}
+
+func (f *fakeController) SaveScene(name string, ids []string) (devices.Scene, error) {
+	f.calls = append(f.calls, fmt.Sprintf("save scene %s %v", name, ids))
+	return devices.Scene{ID: name, Name: name, Saved: true}, nil
+}
+
+func (f *fakeController) DeleteScene(id string) error {
+	f.calls = append(f.calls, "delete scene "+id)
+	return nil
+}
+
+func (f *fakeController) CanSaveScenes() bool { return true }
+
+func (f *fakeController) SetDeviceDisabled(id string, disabled bool) error {
+	f.calls = append(f.calls, fmt.Sprintf("disabled %s %v", id, disabled))
+	return nil
+}
+
+func (f *fakeController) UpdateFirmware(id string) error {
+	f.calls = append(f.calls, "ota "+id)
+	return nil
+}
+
+func (f *fakeController) PermitJoin(d time.Duration) error {
+	f.calls = append(f.calls, fmt.Sprintf("permit join %s", d))
+	f.permitJoin = d
+	return nil
+}
+
+func (f *fakeController) PermitJoinRemaining() time.Duration { return f.permitJoin }
+
+func (f *fakeController) SubmitCommand(cmd devices.CommandEvent) error {
+	if cmd.On != nil {
+		f.calls = append(f.calls, fmt.Sprintf("command %s on=%v", cmd.DeviceID, *cmd.On))
+	}
+	if cmd.Brightness != nil {
+		f.calls = append(f.calls, fmt.Sprintf("command %s brightness=%d", cmd.DeviceID, *cmd.Brightness))
+	}
+	return nil
+}
+
+func TestHandleDim(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ctrl := &fakeController{}
+	ws.controller = ctrl
+	ws.deviceProvider = fakeDeviceProvider{
+		"lamp": {Device: devices.Device{ID: "lamp", Type: devices.DeviceTypeLightbulb, Features: devices.DeviceFeatures{Brightness: true}}},
+		"plug": {Device: devices.Device{ID: "plug", Type: devices.DeviceTypeOutlet}},
+	}
+
+	dim := func(id, direction string) int {
+		req := httptest.NewRequest(http.MethodPost, "/dim/"+id, strings.NewReader("direction="+direction))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		ws.HandleDim(rec, req)
+		return rec.Code
+	}
+
+	if code := dim("lamp", "up"); code != http.StatusNoContent {
+		t.Errorf("dim up = %d, want 204", code)
+	}
+	if code := dim("lamp", "stop"); code != http.StatusNoContent {
+		t.Errorf("dim stop = %d, want 204", code)
+	}
+	if code := dim("lamp", "sideways"); code != http.StatusBadRequest {
+		t.Errorf("invalid direction = %d, want 400", code)
+	}
+	if code := dim("plug", "down"); code != http.StatusBadRequest {
+		t.Errorf("dim outlet = %d, want 400", code)
+	}
+	if code := dim("missing", "down"); code != http.StatusNotFound {
+		t.Errorf("dim missing device = %d, want 404", code)
+	}
+
+	want := []string{"dim lamp up=true", "stop lamp"}
+	if !slices.Equal(ctrl.calls, want) {
+		t.Errorf("controller calls = %v, want %v", ctrl.calls, want)
+	}
+}
+
+func TestHandleAlertAck(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ctrl := &fakeController{}
+	ws.controller = ctrl
+	ws.deviceProvider = fakeDeviceProvider{
+		"leak": {Device: devices.Device{ID: "leak", Type: devices.DeviceTypeLeakSensor}},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/alert/ack/leak", nil)
+	req = req.WithContext(context.WithValue(req.Context(), tokenNameKey{}, "ops"))
+	rec := httptest.NewRecorder()
+	ws.HandleAlertAck(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ack = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), `"acknowledged_by":"token ops"`) {
+		t.Errorf("ack response = %s, want acknowledged by token ops", rec.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/alert/ack/leak", nil)
+	rec = httptest.NewRecorder()
+	ws.HandleAlertAck(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("web ack = %d, want 303", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/alert/ack/missing", nil)
+	rec = httptest.NewRecorder()
+	ws.HandleAlertAck(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("ack missing device = %d, want 404", rec.Code)
+	}
+
+	want := []string{"ack alert leak by token ops", "ack alert leak by web UI 192.0.2.1"}
+	if !slices.Equal(ctrl.calls, want) {
+		t.Errorf("controller calls = %v, want %v", ctrl.calls, want)
+	}
+}
+
+// fixedClock is a clock stopped at a time.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+func TestRenderConnectionStatus(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	now := time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC)
+	ws.SetClock(fixedClock(now))
+	disabled := now.Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		state     devices.State
+		wantClass string
+		wantText  string
+	}{
+		{"never seen", devices.State{}, "connection-indicator disconnected", "Never seen"},
+		{"fresh", devices.State{LastSeen: now.Add(-10 * time.Second)}, "connection-indicator connected", "Last seen: 10s ago"},
+		{"at 30s", devices.State{LastSeen: now.Add(-30 * time.Second)}, "connection-indicator stale", "Last seen: 30s ago"},
+		{"under 60s", devices.State{LastSeen: now.Add(-59 * time.Second)}, "connection-indicator stale", "Last seen: 59s ago"},
+		{"at 60s", devices.State{LastSeen: now.Add(-time.Minute)}, "connection-indicator disconnected", "Last seen: 1m0s ago"},
+		{"disabled", devices.State{LastSeen: now, Disabled: &disabled}, "connection-indicator disconnected", "Disabled since"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html := ws.renderConnectionStatus(tt.state).Render()
+			if !strings.Contains(html, `class="`+tt.wantClass+`"`) {
+				t.Errorf("indicator missing %q in %s", tt.wantClass, html)
+			}
+			if !strings.Contains(html, tt.wantText) {
+				t.Errorf("text missing %q in %s", tt.wantText, html)
+			}
+		})
+	}
+}
+
+func TestRenderPowerMetering(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	power, voltage, current, energy := 1200.5, 230.1, 5.22, 12.3
+	state := devices.State{On: devices.Ptr(true), Power: &power, Voltage: &voltage, Current: &current, Energy: &energy}
+
+	html := ws.renderDeviceCard("plug", devices.Device{ID: "plug", Name: "Plug", Type: devices.DeviceTypeOutlet}, state).Render()
+	for _, want := range []string{
+		`data-role="power-value">1200.5 W<`,
+		`data-role="voltage-value">230.1 V<`,
+		`data-role="current-value">5.22 A<`,
+		`data-role="energy-value">12.30 kWh<`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("outlet card missing %s", want)
+		}
+	}
+
+	html = ws.renderDeviceCard("fan", devices.Device{ID: "fan", Name: "Fan", Type: devices.DeviceTypeFan}, state).Render()
+	if strings.Contains(html, "power-value") {
+		t.Error("fan card shows power metering")
+	}
+}
+
+func TestRenderDeviceCardLinksDevicePage(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+
+	for _, typ := range []devices.DeviceType{
+		devices.DeviceTypeClimateSensor,
+		devices.DeviceTypeLightbulb,
+		devices.DeviceTypeOutlet,
+		devices.DeviceTypeSwitch,
+		devices.DeviceTypeFan,
+		devices.DeviceTypeCover,
+		devices.DeviceTypeSecuritySystem,
+	} {
+		html := ws.renderDeviceCard("dev", devices.Device{ID: "dev", Name: "Dev", Type: typ}, devices.State{}).Render()
+		if !strings.Contains(html, `<a href="/device/dev">Dev</a>`) {
+			t.Errorf("%s card does not link to /device/dev", typ)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package z2mhomekit
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/kradalby/z2m-homekit/tokens"
+)
+
+// Web auth modes.
+const (
+	WebAuthNone      = "none"
+	WebAuthBasic     = "basic"
+	WebAuthTailscale = "tailscale"
+)
+
+// webAuthExempt lists the routes left outside the web auth: /health for
+// monitoring, and the guest pages, which take a guest token of their own.
+var webAuthExempt = map[string]bool{
+	"/health":         true,
+	"/guest":          true,
+	"/guest/control/": true,
+}
+
+type webUserKey struct{}
+
+// WebAuth configures who may use the web UI and API.
+type WebAuth struct {
+	Mode     string
+	Username string
+	Password string
+	// Users limits tailscale mode to these login names; empty allows
+	// any tailnet user.
+	Users []string
+	// WhoIs returns the Tailscale login name of the client at
+	// remoteAddr, failing for clients that are not on the tailnet.
+	WhoIs func(ctx context.Context, remoteAddr string) (string, error)
+}
+
+// ParseWebUsers splits a comma separated list of Tailscale login names.
+func ParseWebUsers(s string) []string {
+	var users []string
+	for user := range strings.SplitSeq(s, ",") {
+		if user = strings.TrimSpace(user); user != "" {
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+// SetWebAuth sets the authentication of the web UI and API.
+func (ws *WebServer) SetWebAuth(auth WebAuth) {
+	ws.webAuth = auth
+}
+
+// authMux registers handlers behind the web auth, apart from the exempt
+// routes.
+type authMux struct {
+	mux interface {
+		Handle(pattern string, handler http.Handler)
+	}
+	ws *WebServer
+}
+
+func (m authMux) Handle(pattern string, handler http.Handler) {
+	if !webAuthExempt[pattern] {
+		handler = m.ws.requireAuth(handler)
+	}
+	m.mux.Handle(pattern, handler)
+}
+
+// requireAuth wraps a handler with the web auth. A valid API token gets
+// through to the API routes, where requireScope checks its scope, and
+// needs the admin scope anywhere else.
+func (ws *WebServer) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := ws.webAuth
+		if !auth.enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && ws.validAPIToken(strings.TrimSpace(secret)) {
+			// The web UI routes do not check scopes, so they take only
+			// admin tokens.
+			if !scopedRoute(r.URL.Path) && !ws.tokenAllows(strings.TrimSpace(secret), tokens.ScopeAdmin) {
+				http.Error(w, `API token lacks the "admin" scope needed outside the API`, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if auth.Mode == WebAuthTailscale && auth.WhoIs != nil {
+			if user, err := auth.WhoIs(r.Context(), r.RemoteAddr); err == nil {
+				if len(auth.Users) > 0 && !slices.Contains(auth.Users, user) {
+					ws.logger.Warn("Rejected Tailscale user", "user", user, "path", r.URL.Path)
+					http.Error(w, "Tailscale user not allowed", http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), webUserKey{}, user)))
+				return
+			}
+		}
+
+		if auth.Password == "" {
+			http.Error(w, "Access is limited to the tailnet", http.StatusForbidden)
+			return
+		}
+		user, password, ok := r.BasicAuth()
+		if !ok || !auth.checkBasic(user, password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="z2m-homekit", charset="UTF-8"`)
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), webUserKey{}, user)))
+	})
+}
+
+// enabled reports whether a web auth mode other than none is set.
+func (auth WebAuth) enabled() bool {
+	return auth.Mode != "" && auth.Mode != WebAuthNone
+}
+
+// checkBasic compares basic auth credentials in constant time.
+func (auth WebAuth) checkBasic(user, password string) bool {
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(auth.Username)) == 1
+	passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(auth.Password)) == 1
+	return userOK && passwordOK
+}
+
+// validAPIToken reports whether secret is a current API token with more
+// than guest access.
+func (ws *WebServer) validAPIToken(secret string) bool {
+	return ws.tokenAllows(secret, tokens.ScopeRead) || ws.tokenAllows(secret, tokens.ScopeControl)
+}
+
+// tokenAllows reports whether secret is a current API token with scope.
+func (ws *WebServer) tokenAllows(secret string, scope tokens.Scope) bool {
+	if ws.tokenStore == nil {
+		return false
+	}
+	_, err := ws.tokenStore.Authenticate(secret, scope)
+	return err == nil
+}
+
+// scopedRoute reports whether a route checks API token scopes itself with
+// requireScope.
+func scopedRoute(path string) bool {
+	return strings.HasPrefix(path, "/api/") || path == "/ws" || path == "/metrics"
+}
+
+// requireSessionOrScope lets requests signed in to the web UI through
+// without an API token, for routes browsers use but cannot send an
+// Authorization header to, and otherwise requires an API token with scope.
+func (ws *WebServer) requireSessionOrScope(scope tokens.Scope, next http.HandlerFunc) http.HandlerFunc {
+	scoped := ws.requireScope(scope, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(webUserKey{}).(string); ok && !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			next(w, r)
+			return
+		}
+		scoped(w, r)
+	}
+}
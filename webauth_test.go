@@ -0,0 +1,201 @@
+package z2mhomekit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/tokens"
+)
+
+func TestRequireAuth(t *testing.T) {
+	store, err := tokens.Open(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	_, readSecret, err := store.Create("monitor", []tokens.Scope{tokens.ScopeRead}, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	_, guestSecret, err := store.Create("visitor", []tokens.Scope{tokens.ScopeGuest}, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	_, adminSecret, err := store.Create("ops", []tokens.Scope{tokens.ScopeAdmin}, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	whoIs := func(_ context.Context, remoteAddr string) (string, error) {
+		switch remoteAddr {
+		case "100.64.0.1:1234":
+			return "alice@example.com", nil
+		case "100.64.0.2:1234":
+			return "mallory@example.com", nil
+		}
+		return "", errors.New("not a tailnet peer")
+	}
+
+	tests := []struct {
+		name       string
+		auth       WebAuth
+		remoteAddr string
+		setup      func(r *http.Request)
+		wantCode   int
+		wantActor  string
+	}{
+		{"none", WebAuth{}, "192.168.1.5:1234", nil, http.StatusOK, "web UI 192.168.1.5"},
+		{"basic missing", WebAuth{Mode: WebAuthBasic, Username: "admin", Password: "secret"}, "192.168.1.5:1234", nil, http.StatusUnauthorized, ""},
+		{"basic wrong", WebAuth{Mode: WebAuthBasic, Username: "admin", Password: "secret"}, "192.168.1.5:1234",
+			func(r *http.Request) { r.SetBasicAuth("admin", "guess") }, http.StatusUnauthorized, ""},
+		{"basic", WebAuth{Mode: WebAuthBasic, Username: "admin", Password: "secret"}, "192.168.1.5:1234",
+			func(r *http.Request) { r.SetBasicAuth("admin", "secret") }, http.StatusOK, "user admin"},
+		{"admin token", WebAuth{Mode: WebAuthBasic, Username: "admin", Password: "secret"}, "192.168.1.5:1234",
+			func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+adminSecret) }, http.StatusOK, "web UI 192.168.1.5"},
+		{"read token outside the api", WebAuth{Mode: WebAuthBasic, Username: "admin", Password: "secret"}, "192.168.1.5:1234",
+			func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+readSecret) }, http.StatusForbidden, ""},
+		{"guest token", WebAuth{Mode: WebAuthBasic, Username: "admin", Password: "secret"}, "192.168.1.5:1234",
+			func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+guestSecret) }, http.StatusUnauthorized, ""},
+		{"tailscale", WebAuth{Mode: WebAuthTailscale, WhoIs: whoIs}, "100.64.0.1:1234", nil, http.StatusOK, "user alice@example.com"},
+		{"tailscale user not allowed", WebAuth{Mode: WebAuthTailscale, WhoIs: whoIs, Users: []string{"alice@example.com"}}, "100.64.0.2:1234", nil, http.StatusForbidden, ""},
+		{"tailscale from lan", WebAuth{Mode: WebAuthTailscale, WhoIs: whoIs}, "192.168.1.5:1234", nil, http.StatusForbidden, ""},
+		{"tailscale from lan with basic", WebAuth{Mode: WebAuthTailscale, WhoIs: whoIs, Username: "admin", Password: "secret"}, "192.168.1.5:1234",
+			func(r *http.Request) { r.SetBasicAuth("admin", "secret") }, http.StatusOK, "user admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws, _ := newTestWebServer(t, "127.0.0.1:0")
+			ws.SetTokenStore(store)
+			ws.SetWebAuth(tt.auth)
+
+			var actor string
+			handler := ws.requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				actor = requestActor(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.setup != nil {
+				tt.setup(req)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if actor != tt.wantActor {
+				t.Errorf("actor = %q, want %q", actor, tt.wantActor)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
+
+func TestAuthMuxExemptsHealth(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ws.SetWebAuth(WebAuth{Mode: WebAuthBasic, Username: "admin", Password: "secret"})
+
+	mux := http.NewServeMux()
+	authed := authMux{mux: mux, ws: ws}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	authed.Handle("/health", ok)
+	authed.Handle("/", ok)
+
+	for path, want := range map[string]int{"/health": http.StatusOK, "/": http.StatusUnauthorized} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("%s status = %d, want %d", path, rec.Code, want)
+		}
+	}
+}
+
+func TestRequireAuthTokenScopes(t *testing.T) {
+	store, err := tokens.Open(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	_, readSecret, err := store.Create("monitor", []tokens.Scope{tokens.ScopeRead}, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ws.SetTokenStore(store)
+	ws.SetWebAuth(WebAuth{Mode: WebAuthBasic, Username: "admin", Password: "secret"})
+
+	mux := http.NewServeMux()
+	authed := authMux{mux: mux, ws: ws}
+	authed.Handle("/tokens", http.HandlerFunc(ws.HandleTokens))
+	authed.Handle("/api/v1/status", ws.requireScope(tokens.ScopeRead, ws.HandleStatus))
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodPost, "/tokens", http.StatusForbidden},
+		{http.MethodGet, "/api/v1/status", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+readSecret)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s with a read token = %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+	if list := store.List(); len(list) != 1 {
+		t.Errorf("store has %d tokens, want the read token only", len(list))
+	}
+}
+
+func TestMetricsAuth(t *testing.T) {
+	store, err := tokens.Open(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	_, readSecret, err := store.Create("prometheus", []tokens.Scope{tokens.ScopeRead}, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name   string
+		public bool
+		setup  func(r *http.Request)
+		want   int
+	}{
+		{"anonymous", false, nil, http.StatusUnauthorized},
+		{"read token", false, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+readSecret) }, http.StatusOK},
+		{"basic", false, func(r *http.Request) { r.SetBasicAuth("admin", "secret") }, http.StatusOK},
+		{"public", true, nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws, _ := newTestWebServer(t, "127.0.0.1:0")
+			ws.SetTokenStore(store)
+			ws.SetWebAuth(WebAuth{Mode: WebAuthBasic, Username: "admin", Password: "secret"})
+			ws.handleMetrics(metrics, tt.public)
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.setup != nil {
+				tt.setup(req)
+			}
+			rec := httptest.NewRecorder()
+			ws.mux.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,380 @@
+package z2mhomekit
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/events"
+)
+
+// The WebSocket protocol (RFC 6455), as much of it as /ws needs: text
+// messages, fragmented or not, with pings and close answered. Extensions
+// and subprotocols are not offered.
+
+// websocketGUID is appended to the client's key to accept the handshake.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsMaxMessage limits the size of a message from a client.
+const wsMaxMessage = 64 << 10
+
+// wsWriteTimeout bounds writing a frame to a client that stopped reading.
+const wsWriteTimeout = 10 * time.Second
+
+// WebSocket frame opcodes.
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+)
+
+// errWSClosed is returned by ReadMessage once the client closes the
+// connection.
+var errWSClosed = errors.New("websocket closed")
+
+// wsConn is a server side WebSocket connection. Messages are read from one
+// goroutine; writes may come from several.
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	writeMu sync.Mutex
+}
+
+// upgradeWebSocket answers a WebSocket handshake and takes over the
+// connection. On error the response has been written.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet ||
+		!headerContainsToken(r.Header, "Connection", "upgrade") ||
+		!headerContainsToken(r.Header, "Upgrade", "websocket") ||
+		key == "" {
+		http.Error(w, "WebSocket upgrade required", http.StatusUpgradeRequired)
+		return nil, errors.New("not a websocket handshake")
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "Cross-origin WebSocket not allowed", http.StatusForbidden)
+		return nil, fmt.Errorf("cross-origin websocket from %q", r.Header.Get("Origin"))
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported websocket version")
+	}
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "WebSocket unsupported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("failed to hijack connection: %w", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	handshake := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"
+	if _, err := brw.WriteString(handshake); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, br: brw.Reader}, nil
+}
+
+// sameOrigin reports whether a browser's handshake comes from a page
+// served by this host, so other sites cannot open a socket with the
+// user's credentials. Clients other than browsers send no Origin.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// headerContainsToken reports whether the comma separated header lists
+// token, ignoring case.
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for v := range strings.SplitSeq(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next text or binary message, answering pings
+// on the way. It returns errWSClosed once the client closes.
+func (c *wsConn) ReadMessage() (opcode byte, data []byte, err error) {
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			// Echo the status code, as the protocol asks.
+			if len(payload) > 2 {
+				payload = payload[:2]
+			}
+			_ = c.writeFrame(wsOpClose, payload)
+			return 0, nil, errWSClosed
+		case wsOpText, wsOpBinary:
+			if opcode != 0 {
+				return 0, nil, errors.New("websocket: new message inside a fragmented one")
+			}
+			opcode = op
+		case wsOpContinuation:
+			if opcode == 0 {
+				return 0, nil, errors.New("websocket: continuation without a message")
+			}
+		default:
+			return 0, nil, fmt.Errorf("websocket: unknown opcode %#x", op)
+		}
+
+		if len(data)+len(payload) > wsMaxMessage {
+			return 0, nil, fmt.Errorf("websocket: message over %d bytes", wsMaxMessage)
+		}
+		data = append(data, payload...)
+		if fin {
+			return opcode, data, nil
+		}
+	}
+}
+
+// readFrame reads and unmasks one frame.
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, errors.New("websocket: reserved bits set")
+	}
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, errors.New("websocket: client frame not masked")
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if opcode >= wsOpClose && (length > 125 || !fin) {
+		return false, 0, nil, errors.New("websocket: invalid control frame")
+	}
+	if length > wsMaxMessage {
+		return false, 0, nil, fmt.Errorf("websocket: frame over %d bytes", wsMaxMessage)
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteText sends a text message.
+func (c *wsConn) WriteText(data []byte) error {
+	return c.writeFrame(wsOpText, data)
+}
+
+// writeFrame sends one unfragmented, unmasked frame.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode
+	switch n := len(payload); {
+	case n <= 125:
+		header[1] = byte(n)
+	case n <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Close closes the connection, telling the client first when it is still
+// there.
+func (c *wsConn) Close() error {
+	_ = c.writeFrame(wsOpClose, binary.BigEndian.AppendUint16(nil, 1001)) // going away
+	return c.conn.Close()
+}
+
+// WebSocketMessage is a message sent to /ws clients: the state of a
+// device, or the result of a command, which has Error set when the
+// command was rejected.
+type WebSocketMessage struct {
+	Type  string                   `json:"type"` // "state" or "result"
+	State *events.StateUpdateEvent `json:"state,omitempty"`
+	ID    string                   `json:"id,omitempty"`
+	Error string                   `json:"error,omitempty"`
+}
+
+// wsCommand is a command sent by a /ws client: the device and the fields
+// of a command as accepted on the MQTT command topics. ID is echoed in
+// the result.
+type wsCommand struct {
+	ID     string `json:"id"`
+	Device string `json:"device"`
+	mqttCommand
+}
+
+// HandleWebSocket streams state updates to a WebSocket client, starting
+// with the current state of every device like /events, and queues the
+// commands it sends, answering each with a result.
+func (ws *WebServer) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		ws.logger.Debug("Rejected WebSocket connection", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	clientChan := make(chan sseEvent, 10)
+
+	// Register and take the snapshot under the broadcast lock, so no
+	// update falls between them.
+	ws.sseClientsMu.Lock()
+	ws.sseClients[clientChan] = struct{}{}
+	snapshot := ws.snapshotState()
+	ws.sseClientsMu.Unlock()
+
+	defer func() {
+		ws.sseClientsMu.Lock()
+		delete(ws.sseClients, clientChan)
+		ws.sseClientsMu.Unlock()
+		close(clientChan)
+	}()
+
+	actor := requestActor(r)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				if !errors.Is(err, errWSClosed) && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+					ws.logger.Debug("WebSocket read failed", "error", err)
+				}
+				return
+			}
+			ws.writeWebSocket(conn, ws.handleWebSocketCommand(data, actor))
+		}
+	}()
+
+	for i := range snapshot {
+		if !ws.writeWebSocket(conn, WebSocketMessage{Type: "state", State: &snapshot[i]}) {
+			return
+		}
+	}
+	for {
+		select {
+		case evt, ok := <-clientChan:
+			if !ok || !ws.writeWebSocket(conn, WebSocketMessage{Type: "state", State: &evt.Event}) {
+				return
+			}
+		case <-done:
+			return
+		case <-ws.ctx.Done():
+			return
+		}
+	}
+}
+
+// handleWebSocketCommand queues a command from a /ws client and returns
+// its result.
+func (ws *WebServer) handleWebSocketCommand(data []byte, actor string) WebSocketMessage {
+	var msg wsCommand
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return WebSocketMessage{Type: "result", Error: "invalid command: " + err.Error()}
+	}
+	result := WebSocketMessage{Type: "result", ID: msg.ID}
+
+	device, _, exists := ws.deviceProvider.Device(msg.Device)
+	if !exists || !webEnabled(device) {
+		result.Error = "device not found"
+		return result
+	}
+	cmd, err := msg.command(device)
+	if err == nil {
+		err = ws.controller.SubmitCommand(cmd)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	ws.LogEvent(fmt.Sprintf("WebSocket: command %s by %s", msg.Device, actor))
+	return result
+}
+
+// writeWebSocket sends msg, returning false when the client has gone away.
+func (ws *WebServer) writeWebSocket(conn *wsConn, msg WebSocketMessage) bool {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		ws.logger.Error("Failed to marshal WebSocket message", "error", err)
+		return true
+	}
+	return conn.WriteText(data) == nil
+}
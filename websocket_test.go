@@ -0,0 +1,228 @@
+package z2mhomekit
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kradalby/z2m-homekit/devices"
+	"github.com/kradalby/z2m-homekit/events"
+	"github.com/kradalby/z2m-homekit/tokens"
+)
+
+// dialWebSocket opens a WebSocket to the test server at path.
+func dialWebSocket(t *testing.T, srv *httptest.Server, path string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, err = io.WriteString(conn, "GET "+path+" HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("handshake response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake = %d %v", resp.StatusCode, resp.Header)
+	}
+	return conn, br
+}
+
+// writeClientFrame sends a masked frame, as clients must.
+func writeClientFrame(t *testing.T, conn net.Conn, opcode byte, payload []byte) {
+	t.Helper()
+
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("write frame: %v", err)
+	}
+}
+
+// readServerFrame reads an unmasked frame.
+func readServerFrame(t *testing.T, br *bufio.Reader) (byte, []byte) {
+	t.Helper()
+
+	var header [2]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		var ext [2]byte
+		if _, err := io.ReadFull(br, ext[:]); err != nil {
+			t.Fatalf("read frame: %v", err)
+		}
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	return header[0] & 0x0f, payload
+}
+
+func readWebSocketMessage(t *testing.T, br *bufio.Reader) WebSocketMessage {
+	t.Helper()
+
+	opcode, payload := readServerFrame(t, br)
+	if opcode != wsOpText {
+		t.Fatalf("opcode = %#x, want text", opcode)
+	}
+	var msg WebSocketMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		t.Fatalf("decode %s: %v", payload, err)
+	}
+	return msg
+}
+
+func TestHandleWebSocket(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ctrl := &fakeController{}
+	ws.controller = ctrl
+	ws.deviceProvider = fakeDeviceProvider{
+		"lamp":   {Device: devices.Device{ID: "lamp", Name: "Lamp", Type: devices.DeviceTypeLightbulb}},
+		"sensor": {Device: devices.Device{ID: "sensor", Name: "Sensor", Type: devices.DeviceTypeClimateSensor}},
+	}
+	ws.currentState["lamp"] = events.StateUpdateEvent{DeviceID: "lamp", On: devices.Ptr(true)}
+
+	srv := httptest.NewServer(http.HandlerFunc(ws.HandleWebSocket))
+	defer srv.Close()
+	conn, br := dialWebSocket(t, srv, "/ws")
+
+	if msg := readWebSocketMessage(t, br); msg.Type != "state" || msg.State == nil || msg.State.DeviceID != "lamp" {
+		t.Errorf("first message = %+v, want the lamp's state", msg)
+	}
+
+	ws.broadcastSSE(events.StateUpdateEvent{DeviceID: "lamp", On: devices.Ptr(false)})
+	if msg := readWebSocketMessage(t, br); msg.State == nil || msg.State.On == nil || *msg.State.On {
+		t.Errorf("update = %+v, want the lamp off", msg)
+	}
+
+	writeClientFrame(t, conn, wsOpPing, []byte("hi"))
+	if opcode, payload := readServerFrame(t, br); opcode != wsOpPong || string(payload) != "hi" {
+		t.Errorf("ping answered with %#x %q", opcode, payload)
+	}
+
+	writeClientFrame(t, conn, wsOpText, []byte(`{"id":"1","device":"lamp","on":true,"brightness":40}`))
+	if msg := readWebSocketMessage(t, br); msg.Type != "result" || msg.ID != "1" || msg.Error != "" {
+		t.Errorf("result = %+v, want success", msg)
+	}
+	if len(ctrl.calls) != 2 || ctrl.calls[0] != "command lamp on=true" || ctrl.calls[1] != "command lamp brightness=40" {
+		t.Errorf("calls = %v", ctrl.calls)
+	}
+
+	writeClientFrame(t, conn, wsOpText, []byte(`{"id":"2","device":"sensor","on":true}`))
+	if msg := readWebSocketMessage(t, br); msg.ID != "2" || !strings.Contains(msg.Error, "cannot be switched") {
+		t.Errorf("result = %+v, want a rejection", msg)
+	}
+	writeClientFrame(t, conn, wsOpText, []byte(`{"id":"3","device":"missing","on":true}`))
+	if msg := readWebSocketMessage(t, br); msg.ID != "3" || msg.Error != "device not found" {
+		t.Errorf("result = %+v, want device not found", msg)
+	}
+
+	writeClientFrame(t, conn, wsOpClose, []byte{0x03, 0xe8})
+	if opcode, payload := readServerFrame(t, br); opcode != wsOpClose || binary.BigEndian.Uint16(payload) != 1000 {
+		t.Errorf("close answered with %#x %v", opcode, payload)
+	}
+}
+
+func TestHandleWebSocketRequiresUpgrade(t *testing.T) {
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+
+	rec := httptest.NewRecorder()
+	ws.HandleWebSocket(rec, httptest.NewRequest(http.MethodGet, "/ws", nil))
+	if rec.Code != http.StatusUpgradeRequired {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUpgradeRequired)
+	}
+}
+
+func TestWebSocketAuth(t *testing.T) {
+	store, err := tokens.Open(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	_, readSecret, err := store.Create("monitor", []tokens.Scope{tokens.ScopeRead}, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	_, controlSecret, err := store.Create("panel", []tokens.Scope{tokens.ScopeControl}, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	ws, _ := newTestWebServer(t, "127.0.0.1:0")
+	ws.SetTokenStore(store)
+	ws.SetWebAuth(WebAuth{Mode: WebAuthBasic, Username: "admin", Password: "secret"})
+	ws.deviceProvider = fakeDeviceProvider{}
+
+	mux := http.NewServeMux()
+	authMux{mux: mux, ws: ws}.Handle("/ws", ws.requireSessionOrScope(tokens.ScopeControl, ws.HandleWebSocket))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	session := "Basic " + base64.StdEncoding.EncodeToString([]byte("admin:secret"))
+	tests := []struct {
+		name          string
+		authorization string
+		origin        string
+		want          int
+	}{
+		{"web session", session, "http://test", http.StatusSwitchingProtocols},
+		{"web session cross-origin", session, "https://evil.example", http.StatusForbidden},
+		{"control token", "Bearer " + controlSecret, "", http.StatusSwitchingProtocols},
+		{"read token", "Bearer " + readSecret, "", http.StatusForbidden},
+		{"no credentials", "", "http://test", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			req := "GET /ws HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+				"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n"
+			if tt.authorization != "" {
+				req += "Authorization: " + tt.authorization + "\r\n"
+			}
+			if tt.origin != "" {
+				req += "Origin: " + tt.origin + "\r\n"
+			}
+			if _, err := io.WriteString(conn, req+"\r\n"); err != nil {
+				t.Fatalf("handshake: %v", err)
+			}
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				t.Fatalf("handshake response: %v", err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
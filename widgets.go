@@ -0,0 +1,234 @@
+package z2mhomekit
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/chasefleming/elem-go"
+	"github.com/chasefleming/elem-go/attrs"
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+// OutdoorTag marks climate sensors that are outside. They feed the weather
+// widget instead of the indoor climate summary.
+const OutdoorTag = "outdoor"
+
+// Dashboard widgets, in default display order.
+const (
+	widgetClimate = "climate"
+	widgetWeather = "weather"
+	widgetWindows = "windows"
+	widgetLights  = "lights"
+	widgetAlerts  = "alerts"
+)
+
+var allWidgets = []string{widgetClimate, widgetWeather, widgetWindows, widgetLights, widgetAlerts}
+
+// parseWidgets parses a comma separated widget list. Empty selects all
+// widgets and "none" disables the row.
+func parseWidgets(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	switch s {
+	case "":
+		return allWidgets, nil
+	case "none":
+		return nil, nil
+	}
+
+	var widgets []string
+	for name := range strings.SplitSeq(s, ",") {
+		name = strings.TrimSpace(name)
+		if !slices.Contains(allWidgets, name) {
+			return nil, fmt.Errorf("unknown dashboard widget %q, want one of %s", name, strings.Join(allWidgets, ", "))
+		}
+		if !slices.Contains(widgets, name) {
+			widgets = append(widgets, name)
+		}
+	}
+	return widgets, nil
+}
+
+// SetDashboardWidgets selects the widgets shown at the top of the
+// dashboard; see parseWidgets.
+func (ws *WebServer) SetDashboardWidgets(s string) error {
+	widgets, err := parseWidgets(s)
+	if err != nil {
+		return err
+	}
+	ws.widgets = widgets
+	return nil
+}
+
+// dashboardWidget is a computed summary tile.
+type dashboardWidget struct {
+	Name   string
+	Icon   string
+	Label  string
+	Value  string
+	Detail string
+	Alert  bool
+}
+
+type average struct {
+	sum   float64
+	count int
+}
+
+func (a *average) add(v *float64) {
+	if v != nil {
+		a.sum += *v
+		a.count++
+	}
+}
+
+func (a average) String(format string) string {
+	if a.count == 0 {
+		return "–"
+	}
+	return fmt.Sprintf(format, a.sum/float64(a.count))
+}
+
+// computeWidgets summarises the state snapshot for the given widgets.
+// Devices hidden from the web are left out.
+func computeWidgets(snapshot map[string]struct {
+	Device devices.Device
+	State  devices.State
+}, names []string,
+) []dashboardWidget {
+	var indoorTemp, indoorHum, outdoorTemp average
+	var forecast string
+	var open []string
+	var lightsOn, lights, alerts int
+
+	for _, id := range sortedDeviceIDs(snapshot, sortByName, "") {
+		item := snapshot[id]
+		device, state := item.Device, item.State
+		if !onDashboard(device) {
+			continue
+		}
+
+		switch device.Type {
+		case devices.DeviceTypeClimateSensor:
+			if slices.Contains(device.Tags, OutdoorTag) {
+				outdoorTemp.add(state.Temperature)
+			} else {
+				indoorTemp.add(state.Temperature)
+				indoorHum.add(state.Humidity)
+			}
+			if forecast == "" {
+				forecast = state.PressureForecast
+			}
+		case devices.DeviceTypeContactSensor:
+			// zigbee2mqtt reports contact=false when open.
+			if state.Contact != nil && !*state.Contact {
+				open = append(open, device.Name)
+			}
+		case devices.DeviceTypeLightbulb:
+			lights++
+			if state.On != nil && *state.On {
+				lightsOn++
+			}
+		}
+
+		if _, active := devices.ActiveAlert(device, state); active ||
+			(state.FrostWarning != nil && *state.FrostWarning) ||
+			(state.HeatWarning != nil && *state.HeatWarning) ||
+			len(state.Anomalies) > 0 || state.Lockout != nil {
+			alerts++
+		}
+	}
+
+	var widgets []dashboardWidget
+	for _, name := range names {
+		switch name {
+		case widgetClimate:
+			widgets = append(widgets, dashboardWidget{
+				Name: name, Icon: "🏠", Label: "Indoor",
+				Value:  indoorTemp.String("%.1f°C"),
+				Detail: indoorHum.String("%.0f%% humidity"),
+			})
+		case widgetWeather:
+			if outdoorTemp.count == 0 && forecast == "" {
+				continue
+			}
+			widgets = append(widgets, dashboardWidget{
+				Name: name, Icon: "🌦️", Label: "Outdoor",
+				Value:  outdoorTemp.String("%.1f°C"),
+				Detail: forecast,
+			})
+		case widgetWindows:
+			widgets = append(widgets, dashboardWidget{
+				Name: name, Icon: "🪟", Label: "Open",
+				Value:  fmt.Sprint(len(open)),
+				Detail: strings.Join(open, ", "),
+			})
+		case widgetLights:
+			widgets = append(widgets, dashboardWidget{
+				Name: name, Icon: "💡", Label: "Lights on",
+				Value: fmt.Sprintf("%d/%d", lightsOn, lights),
+			})
+		case widgetAlerts:
+			widgets = append(widgets, dashboardWidget{
+				Name: name, Icon: "⚠️", Label: "Alerts",
+				Value: fmt.Sprint(alerts),
+				Alert: alerts > 0,
+			})
+		}
+	}
+	return widgets
+}
+
+// renderWidgets renders the widget row. It refreshes itself from
+// /widgets so the summaries stay current.
+func (ws *WebServer) renderWidgets(snapshot map[string]struct {
+	Device devices.Device
+	State  devices.State
+},
+) elem.Node {
+	if len(ws.widgets) == 0 {
+		return nil
+	}
+
+	var tiles []elem.Node
+	for _, w := range computeWidgets(snapshot, ws.widgets) {
+		class := "widget widget-" + w.Name
+		if w.Alert {
+			class += " alert"
+		}
+		tiles = append(tiles, elem.Div(attrs.Props{attrs.Class: class, attrs.Title: w.Detail},
+			elem.Div(attrs.Props{attrs.Class: "widget-label"}, elem.Text(w.Icon+" "+w.Label)),
+			elem.Div(attrs.Props{attrs.Class: "widget-value"}, elem.Text(w.Value)),
+			elem.Div(attrs.Props{attrs.Class: "widget-detail"}, elem.Text(w.Detail)),
+		))
+	}
+
+	return elem.Div(attrs.Props{
+		attrs.ID:     "widgets",
+		attrs.Class:  "widgets",
+		"hx-get":     "/widgets",
+		"hx-trigger": "every 30s",
+		"hx-swap":    "outerHTML",
+	}, tiles...)
+}
+
+// HandleWidgets renders the dashboard widget row.
+func (ws *WebServer) HandleWidgets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	row := ws.renderWidgets(ws.deviceProvider.Snapshot())
+	if row == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if _, err := fmt.Fprint(w, row.Render()); err != nil {
+		ws.logger.Error("Failed to write widgets response", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,61 @@
+package z2mhomekit
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/kradalby/z2m-homekit/devices"
+)
+
+func TestParseWidgets(t *testing.T) {
+	if got, err := parseWidgets(""); err != nil || !slices.Equal(got, allWidgets) {
+		t.Errorf(`parseWidgets("") = %v, %v, want all`, got, err)
+	}
+	if got, err := parseWidgets("none"); err != nil || got != nil {
+		t.Errorf(`parseWidgets("none") = %v, %v, want none`, got, err)
+	}
+	if got, err := parseWidgets("alerts, lights,alerts"); err != nil || !slices.Equal(got, []string{"alerts", "lights"}) {
+		t.Errorf("parseWidgets(alerts, lights) = %v, %v", got, err)
+	}
+	if _, err := parseWidgets("clock"); err == nil {
+		t.Error("unknown widget accepted")
+	}
+}
+
+func TestComputeWidgets(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	snapshot := fakeDeviceProvider{
+		"lounge":  {Device: devices.Device{Name: "Lounge", Type: devices.DeviceTypeClimateSensor}, State: devices.State{Temperature: f(20), Humidity: f(40)}},
+		"bedroom": {Device: devices.Device{Name: "Bedroom", Type: devices.DeviceTypeClimateSensor}, State: devices.State{Temperature: f(22), Humidity: f(50)}},
+		"garden":  {Device: devices.Device{Name: "Garden", Type: devices.DeviceTypeClimateSensor, Tags: []string{"outdoor"}}, State: devices.State{Temperature: f(3)}},
+		"window":  {Device: devices.Device{Name: "Window", Type: devices.DeviceTypeContactSensor}, State: devices.State{Contact: devices.Ptr(false)}},
+		"door":    {Device: devices.Device{Name: "Door", Type: devices.DeviceTypeContactSensor}, State: devices.State{Contact: devices.Ptr(true)}},
+		"lamp":    {Device: devices.Device{Name: "Lamp", Type: devices.DeviceTypeLightbulb}, State: devices.State{On: devices.Ptr(true)}},
+		"spot":    {Device: devices.Device{Name: "Spot", Type: devices.DeviceTypeLightbulb}},
+		"leak":    {Device: devices.Device{Name: "Leak", Type: devices.DeviceTypeLeakSensor}, State: devices.State{WaterLeak: devices.Ptr(true)}},
+		"hidden":  {Device: devices.Device{Name: "Hidden", Type: devices.DeviceTypeLightbulb, Web: devices.Ptr(false)}, State: devices.State{On: devices.Ptr(true)}},
+	}.Snapshot()
+
+	got := map[string]dashboardWidget{}
+	for _, w := range computeWidgets(snapshot, allWidgets) {
+		got[w.Name] = w
+	}
+
+	checks := []struct{ widget, field, got, want string }{
+		{widgetClimate, "value", got[widgetClimate].Value, "21.0°C"},
+		{widgetClimate, "detail", got[widgetClimate].Detail, "45% humidity"},
+		{widgetWeather, "value", got[widgetWeather].Value, "3.0°C"},
+		{widgetWindows, "value", got[widgetWindows].Value, "1"},
+		{widgetWindows, "detail", got[widgetWindows].Detail, "Window"},
+		{widgetLights, "value", got[widgetLights].Value, "1/2"},
+		{widgetAlerts, "value", got[widgetAlerts].Value, "1"},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s %s = %q, want %q", c.widget, c.field, c.got, c.want)
+		}
+	}
+	if !got[widgetAlerts].Alert {
+		t.Error("alerts widget not highlighted with an active leak")
+	}
+}